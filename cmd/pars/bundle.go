@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/sambeau/parsley/pkg/bundle"
+	"github.com/sambeau/parsley/pkg/config"
+)
+
+// bundleScript implements `pars bundle script.pars -o name`: it writes a copy
+// of this executable with the script, its modules and the files they use
+// appended, which runs the script when started
+func bundleScript(args []string) {
+	bundleFlags := flag.NewFlagSet("bundle", flag.ExitOnError)
+	outFlag := bundleFlags.String("o", "", "Executable to write (default: the script's name)")
+	includeFlag := bundleFlags.String("include", "", "Comma-separated files and directories to add")
+
+	// Flags may come before or after the script
+	bundleFlags.Parse(args)
+	rest := bundleFlags.Args()
+	if len(rest) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: pars bundle [-o name] [--include=PATHS] script.pars")
+		os.Exit(2)
+	}
+	script := rest[0]
+	bundleFlags.Parse(rest[1:])
+	if extra := bundleFlags.Args(); len(extra) > 0 {
+		fmt.Fprintf(os.Stderr, "Error: unexpected argument %q\n", extra[0])
+		os.Exit(2)
+	}
+
+	out := *outFlag
+	if out == "" {
+		out = strings.TrimSuffix(filepath.Base(script), filepath.Ext(script))
+		if runtime.GOOS == "windows" {
+			out += ".exe"
+		}
+	}
+
+	var include []string
+	for _, p := range strings.Split(*includeFlag, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			include = append(include, p)
+		}
+	}
+
+	if err := writeBundle(script, out, include, loadConfig(filepath.Dir(script))); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// writeBundle collects a script's files and writes the bundled executable
+func writeBundle(script, out string, include []string, cfg *config.Config) error {
+	root, files, err := bundle.Collect(script, include)
+	if err != nil {
+		return err
+	}
+	entry, err := bundle.EntryName(root, script)
+	if err != nil {
+		return err
+	}
+
+	// The bundle runs with the settings it was made with
+	manifest := bundle.Manifest{
+		Entry:           entry,
+		Version:         Version,
+		AllowWriteAll:   *allowWriteAllFlag || *allowWriteAllShort,
+		AllowExecuteAll: *allowExecuteAllFlag || *allowExecuteAllShort,
+		Strict:          *strictFlag,
+		Pretty:          *prettyPrintFlag || *prettyLongFlag,
+		Raw:             *rawFlag || *rawLongFlag,
+	}
+	if cfg != nil {
+		manifest.AllowWriteAll = manifest.AllowWriteAll || cfg.Security.AllowWriteAll
+		manifest.AllowExecuteAll = manifest.AllowExecuteAll || cfg.Security.AllowExecuteAll
+		manifest.Strict = manifest.Strict || cfg.Strict
+		manifest.Pretty = manifest.Pretty || cfg.Output.Pretty
+		manifest.Raw = manifest.Raw || cfg.Output.Raw
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	exe, err := os.ReadFile(self)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(out, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	err = bundle.Write(f, exe, manifest, root, files)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(out)
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Bundled %d files from %s into %s\n", len(files), root, out)
+	return nil
+}
+
+// openOwnBundle returns the bundle appended to this executable, or nil
+func openOwnBundle() *bundle.Bundle {
+	self, err := os.Executable()
+	if err != nil {
+		return nil
+	}
+	b, err := bundle.Open(self)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	return b
+}
+
+// runBundle extracts a bundle into the user's cache directory and runs its
+// script with the settings it was bundled with, plus any given flags
+func runBundle(b *bundle.Bundle) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		cacheDir = os.TempDir()
+	}
+	bundlesDir := filepath.Join(cacheDir, "parsley", "bundles")
+	entry, err := b.Extract(bundlesDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error extracting bundle: %s\n", err)
+		os.Exit(1)
+	}
+
+	// Bundles don't read parsley.toml; the manifest stands in for it. The
+	// bundle's own modules can always be imported.
+	cfg := &config.Config{
+		Strict: b.Manifest.Strict,
+		Security: config.Security{
+			AllowWriteAll:   b.Manifest.AllowWriteAll,
+			AllowExecute:    []string{filepath.Join(bundlesDir, b.Hash)},
+			AllowExecuteAll: b.Manifest.AllowExecuteAll,
+		},
+		Output: config.Output{Pretty: b.Manifest.Pretty, Raw: b.Manifest.Raw},
+	}
+	executeFile(entry, cfg)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+// recorded collects the interactions of a run with --record
+var recorded *evaluator.Cassette
+
+// startCassette starts recording for --record or replaying for --replay,
+// exiting if the cassette to replay can't be read
+func startCassette() {
+	switch {
+	case *recordFlag != "" && *replayFlag != "":
+		fmt.Fprintln(os.Stderr, "Error: --record and --replay can't be used together")
+		os.Exit(1)
+	case *recordFlag != "":
+		recorded = &evaluator.Cassette{}
+		evaluator.RecordTo(recorded)
+	case *replayFlag != "":
+		c, err := evaluator.LoadCassette(*replayFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading cassette: %s\n", err)
+			os.Exit(1)
+		}
+		evaluator.ReplayFrom(c)
+	}
+}
+
+// saveCassette writes what --record recorded, exiting if it can't
+func saveCassette() {
+	if recorded == nil {
+		return
+	}
+	if err := recorded.Save(*recordFlag); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving cassette: %s\n", err)
+		os.Exit(1)
+	}
+}
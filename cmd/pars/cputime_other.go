@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "time"
+
+// cpuTime returns 0 where the process's CPU time isn't available, and the
+// summary leaves it out
+func cpuTime() time.Duration {
+	return 0
+}
@@ -6,7 +6,10 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/sambeau/parsley/pkg/config"
+	"github.com/sambeau/parsley/pkg/diagnostics"
 	"github.com/sambeau/parsley/pkg/evaluator"
 	"github.com/sambeau/parsley/pkg/formatter"
 	"github.com/sambeau/parsley/pkg/lexer"
@@ -25,6 +28,17 @@ var (
 	versionLongFlag = flag.Bool("version", false, "Show version information")
 	prettyPrintFlag = flag.Bool("pp", false, "Pretty-print HTML output")
 	prettyLongFlag  = flag.Bool("pretty", false, "Pretty-print HTML output")
+	rawFlag         = flag.Bool("r", false, "Write the result as exact bytes, without a trailing newline")
+	rawLongFlag     = flag.Bool("raw", false, "Write the result as exact bytes, without a trailing newline")
+	validateFlag    = flag.Bool("validate", false, "Check HTML output for unclosed tags, duplicate ids and invalid nesting")
+	watchFlag       = flag.Bool("watch", false, "Re-run the script when it changes, printing only what changed in the output")
+	colorFlag       = flag.String("color", "auto", "Color error messages: auto, always or never")
+	summaryFlag     = flag.Bool("summary", false, "Print the files, requests, queries and commands the run used, and how long it took")
+	outputFlag      = flag.String("output", "", "Write dictionary and array results as json, yaml or csv")
+
+	// Testing flags
+	recordFlag = flag.String("record", "", "Record HTTP requests, SQL statements and commands to a cassette file")
+	replayFlag = flag.String("replay", "", "Answer HTTP requests, SQL statements and commands from a cassette file")
 
 	// Security flags
 	restrictReadFlag     = flag.String("restrict-read", "", "Comma-separated read blacklist paths")
@@ -35,6 +49,14 @@ var (
 	allowExecuteFlag     = flag.String("allow-execute", "", "Comma-separated execute whitelist paths")
 	allowExecuteAllFlag  = flag.Bool("allow-execute-all", false, "Allow unrestricted executes")
 	allowExecuteAllShort = flag.Bool("x", false, "Shorthand for --allow-execute-all")
+	dryRunFlag           = flag.Bool("dry-run", false, "Log writes, commands, SQL changes, uploads and non-GET requests instead of doing them")
+	envFlag              = flag.String("env", "", "Comma-separated environment variables the script can read as env")
+
+	// Config flags
+	noConfigFlag = flag.Bool("no-config", false, "Ignore parsley.toml workspace files")
+
+	// Language flags
+	strictFlag = flag.Bool("strict", false, "Enable strict mode")
 )
 
 func main() {
@@ -54,21 +76,60 @@ func main() {
 		os.Exit(0)
 	}
 
+	if *outputFlag != "" && *outputFlag != "json" && *outputFlag != "yaml" && *outputFlag != "csv" {
+		fmt.Fprintf(os.Stderr, "Error: --output must be json, yaml or csv, got %q\n", *outputFlag)
+		os.Exit(1)
+	}
+
+	// A bundled executable runs its own script
+	if b := openOwnBundle(); b != nil {
+		runBundle(b)
+		return
+	}
+
 	// Get filename from remaining args
 	args := flag.Args()
+
+	// Bundle mode: pars bundle script.pars -o name
+	if len(args) > 0 && args[0] == "bundle" {
+		bundleScript(args[1:])
+		return
+	}
+
+	// Server mode: pars serve app.pars
+	if len(args) > 0 && args[0] == "serve" {
+		serveScript(args[1:])
+		return
+	}
+
+	// Module downloads: pars mod download [file...]
+	if len(args) > 0 && args[0] == "mod" {
+		modCommand(args[1:])
+		return
+	}
+
+	// Task runner mode: pars run [task...]
+	if len(args) > 0 && args[0] == "run" {
+		runTasks(args[1:], loadConfig("."))
+		return
+	}
+
 	var filename string
 	if len(args) > 0 {
 		filename = args[0]
 	}
 
-	// Determine pretty print setting
-	prettyPrint := *prettyPrintFlag || *prettyLongFlag
-
-	if filename != "" {
-		// File execution mode
-		executeFile(filename, prettyPrint)
+	if filename != "" && *watchFlag {
+		// Watch mode: re-run the script whenever it or its modules change
+		watchFile(filename, loadConfig(filepath.Dir(filename)))
+	} else if filename != "" {
+		// File execution mode, with the workspace config found above the script
+		executeFile(filename, loadConfig(filepath.Dir(filename)))
 	} else {
 		// REPL mode
+		if cfg := loadConfig("."); cfg != nil && cfg.Locale != "" {
+			evaluator.DefaultLocale = cfg.Locale
+		}
 		repl.Start(os.Stdin, os.Stdout, Version)
 	}
 }
@@ -78,11 +139,35 @@ func printHelp() {
 
 Usage:
   pars [options] [file]
+  pars [options] run [--force] [--list] [--file=PATH] [task...]
+  pars [options] bundle [-o name] [--include=PATHS] file
+  pars [options] serve [--port=N] [--host=ADDR] file
+  pars mod download [file...]
 
 Display Options:
   -h, --help            Show this help message
   -V, --version         Show version information
   -pp, --pretty         Pretty-print HTML output with proper indentation
+  -r, --raw             Write the result exactly: no trailing newline, byte arrays as binary
+  --validate            Report unclosed tags, duplicate ids and invalid nesting in
+                        HTML output, exiting with status 1 if there are any
+  --watch               Re-run the script when it or a module it imports changes,
+                        printing a diff of the output instead of the whole output
+  --no-config           Ignore parsley.toml workspace files
+  --color=WHEN          Color error messages: auto (on terminals), always or never
+  --summary             After the run, print the files read and written, output
+                        size, HTTP requests, SQL queries, commands and time to stderr
+  --output=FORMAT       Write a dictionary or array result as json, yaml or csv
+
+Testing Options:
+  --record=FILE         Save the run's HTTP requests, SQL statements and commands,
+                        with their results, to a cassette file
+  --replay=FILE         Answer HTTP requests, SQL statements and commands from a
+                        cassette instead of doing them; anything not recorded fails
+
+Language Options:
+  --strict              Strict mode: undeclared assignments, missing dictionary
+                        keys, string + number and implicit let exports are errors
 
 Security Options:
   --restrict-read=PATHS     Deny reading from comma-separated paths
@@ -91,36 +176,365 @@ Security Options:
   --allow-write-all, -w     Allow unrestricted writes
   --allow-execute=PATHS     Allow executing scripts from paths
   --allow-execute-all, -x   Allow unrestricted script execution
+  --dry-run                 Log file writes, commands, SQL changes, SFTP uploads
+                            and non-GET requests to stderr instead of doing them
+  --env=NAMES               Let the script read comma-separated environment
+                            variables as env (e.g. env.API_HOST)
 
 Security Examples:
   pars -w script.pars                           # Allow all writes
   pars --allow-write=./output script.pars       # Allow writes to ./output only
   pars -x --allow-write=./data script.pars      # Allow all executes, writes to ./data
   pars --restrict-read=/etc script.pars         # Deny reads from /etc
+  pars -w -x --dry-run deploy.pars              # Show what a deploy would change
+  pars --env=API_HOST,DATA_DIR build.pars       # Expose two environment variables
+
+Workspace Config:
+  Defaults for the options above, module paths, output and locale are read
+  from the nearest parsley.toml, searching up from the script's directory.
+  Command-line flags add to the config's settings.
+
+Task Runner:
+  run [task...]             Run tasks (and their dependencies) from parsfile.pars;
+                            with no task, runs "default" or lists the tasks
+  --force                   Run tasks even if their outputs are up to date
+  --list                    List tasks and their descriptions
+  --file=PATH               Use another parsfile
+
+Bundles:
+  bundle file               Write an executable that runs the script, with the
+                            modules and files it names by relative path
+  -o name                   Executable to write (default: the script's name)
+  --include=PATHS           Comma-separated files and directories to add
+
+Remote Modules:
+  mod download [file...]    Download the modules the files import by URL (every
+                            .pars file under the current directory by default)
+                            into ~/.parsley/cache and record them in parsley.lock
+
+Web Server:
+  serve file                Serve the handler function the script returns,
+                            reloading it when the script or its modules change
+  --port=N                  Port to listen on (default: 8080)
+  --host=ADDR               Address to listen on (default: 127.0.0.1)
 
 Examples:
   pars                      Start interactive REPL
   pars script.pars          Execute a Parsley script
   pars -pp page.pars        Execute and pretty-print HTML output
+  pars --validate page.pars Check the generated HTML for template mistakes
+  pars --watch page.pars    Show what changes in a page's HTML as you edit it
+  pars -x run deploy        Run the deploy task, allowing commands
+  pars -r icon.pars > a.png Write a byte-array result as a binary file
+  pars --output=json stats.pars | jq .total
+                            Pipe a script's data to another tool
+  pars --replay=report.cassette.json report.pars
+                            Rerun a report without the network or database
+  pars bundle report.pars --include=./assets -o report
+                            Package a report generator as one executable
+  pars serve --port=3000 app.pars
+                            Serve a Parsley web app on http://127.0.0.1:3000
 
 For more information, visit: https://github.com/sambeau/parsley
 `, Version)
 }
 
 // executeFile reads and executes a pars source file
-func executeFile(filename string, prettyPrint bool) {
+func executeFile(filename string, cfg *config.Config) {
+	start := time.Now()
+	env := newEnvironment(cfg)
+	startCassette()
+	evaluated, ok := evalFile(filename, env)
+	saveCassette()
+	if !ok {
+		printSummary(start, 0)
+		os.Exit(1)
+	}
+
+	// Print result if not null and not an error
+	if evaluated != nil && evaluated.Type() != evaluator.ERROR_OBJ && evaluated.Type() != evaluator.NULL_OBJ {
+		out, err := renderOutput(filename, evaluated, cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+		if err := out.write(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+			os.Exit(1)
+		}
+		printSummary(start, len(out.data))
+
+		// The output is still written so the problems can be inspected
+		if len(out.problems) > 0 {
+			out.printProblems(filename)
+			os.Exit(1)
+		}
+		return
+	}
+	printSummary(start, 0)
+}
+
+// output is a script's rendered result and where it goes
+type output struct {
+	data []byte
+	// path is the file in the workspace output directory to write, or ""
+	// for stdout
+	path     string
+	raw      bool
+	problems []formatter.Problem
+}
+
+// renderOutput renders a script's result as the output flags and workspace
+// config say
+func renderOutput(filename string, evaluated evaluator.Object, cfg *config.Config) (output, error) {
+	// Determine output settings
+	prettyPrint := *prettyPrintFlag || *prettyLongFlag
+	raw := *rawFlag || *rawLongFlag
+	validate := *validateFlag
+	out := output{}
+	if cfg != nil {
+		prettyPrint = prettyPrint || cfg.Output.Pretty
+		raw = raw || cfg.Output.Raw
+		validate = validate || cfg.Output.Validate
+		if cfg.Output.Dir != "" {
+			name := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+			out.path = filepath.Join(cfg.Output.Dir, name+cfg.Output.Ext)
+		}
+	}
+
+	// Data results are serialized for pipelines with --output
+	switch evaluated.(type) {
+	case *evaluator.Dictionary, *evaluator.Array:
+		if *outputFlag != "" {
+			data, err := evaluator.ObjectToData(evaluated, *outputFlag)
+			if err != nil {
+				return out, fmt.Errorf("can't write the result as %s: %w", *outputFlag, err)
+			}
+			out.data = data
+			return out, nil
+		}
+	}
+
+	out.raw = raw
+	if raw {
+		// Raw mode writes the exact bytes, e.g. for binary output in pipelines
+		out.data = evaluator.ObjectToBytes(evaluated)
+		return out, nil
+	}
+
+	text := evaluator.ObjectToPrintString(evaluated)
+
+	// Validate before pretty-printing, which would repair the HTML
+	if validate {
+		out.problems = formatter.ValidateHTML(text)
+	}
+
+	// Apply HTML formatting if --pp flag is set
+	if prettyPrint {
+		text = formatter.FormatHTML(text)
+	}
+	out.data = []byte(text + "\n")
+	return out, nil
+}
+
+// write writes the output to its file, or to stdout
+func (o output) write() error {
+	if o.path == "" {
+		_, err := os.Stdout.Write(o.data)
+		return err
+	}
+
+	if *dryRunFlag {
+		fmt.Fprintf(evaluator.DryRunLog, "dry run: write %d bytes to %s\n", len(o.data), o.path)
+		return nil
+	}
+
+	// The workspace output directory receives results as files
+	err := os.MkdirAll(filepath.Dir(o.path), 0755)
+	if err == nil {
+		err = os.WriteFile(o.path, o.data, 0644)
+	}
+	return err
+}
+
+// printProblems reports the problems --validate found in the output
+func (o output) printProblems(filename string) {
+	for _, p := range o.problems {
+		fmt.Fprintf(os.Stderr, "%s: output %s\n", filename, p)
+	}
+}
+
+// watchInterval is how often watch mode checks for changed files
+const watchInterval = 250 * time.Millisecond
+
+// watchContext is the number of unchanged lines shown around each change
+const watchContext = 2
+
+// watchFile runs a script, then runs it again whenever it or a module it
+// imports changes. After the first run only the lines of the output that
+// changed are printed, and an output file is only rewritten if it changed.
+func watchFile(filename string, cfg *config.Config) {
+	var previous *output
+	for {
+		modTime := fileModTime(filename)
+		if out, ok := watchRun(filename, cfg); ok {
+			if previous == nil {
+				if err := out.write(); err != nil {
+					fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+				}
+			} else {
+				printOutputChanges(filename, *previous, out)
+			}
+			out.printProblems(filename)
+			previous = &out
+		}
+
+		// Wait for the script or one of its modules to change. Checking the
+		// modules drops them from the import cache, so the next run reloads
+		// them.
+		for fileModTime(filename).Equal(modTime) && len(evaluator.InvalidateChangedModules()) == 0 {
+			time.Sleep(watchInterval)
+		}
+	}
+}
+
+// watchRun runs a script once for watch mode, printing any error rather than
+// exiting
+func watchRun(filename string, cfg *config.Config) (output, bool) {
+	env := newEnvironment(cfg)
+	evaluated, ok := evalFile(filename, env)
+	if !ok {
+		return output{}, false
+	}
+	if evaluated == nil || evaluated.Type() == evaluator.NULL_OBJ {
+		return output{}, true
+	}
+	out, err := renderOutput(filename, evaluated, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return output{}, false
+	}
+	return out, true
+}
+
+// printOutputChanges prints how a re-run's output differs from the last
+// one's, writing the output file if it changed
+func printOutputChanges(filename string, previous, out output) {
+	stamp := time.Now().Format("15:04:05")
+	if string(previous.data) == string(out.data) {
+		fmt.Fprintf(os.Stderr, "[%s] %s: output unchanged\n", stamp, filename)
+		return
+	}
+
+	if out.path != "" {
+		if err := out.write(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "[%s] %s: wrote %s\n", stamp, filename, out.path)
+	} else {
+		fmt.Fprintf(os.Stderr, "[%s] %s: output changed\n", stamp, filename)
+	}
+
+	if out.raw {
+		fmt.Fprintf(os.Stderr, "  %d bytes, was %d\n", len(out.data), len(previous.data))
+		return
+	}
+	fmt.Print(formatter.DiffLines(diffableOutput(previous.data), diffableOutput(out.data), watchContext))
+}
+
+// diffableOutput splits HTML output into lines by pretty-printing it, so a
+// change to a page shows as the lines that changed rather than the whole
+// page
+func diffableOutput(data []byte) string {
+	text := string(data)
+	if strings.HasPrefix(strings.TrimSpace(text), "<") {
+		return formatter.FormatHTML(text)
+	}
+	return text
+}
+
+// fileModTime returns the modification time of a file, or the zero time if
+// it can't be read
+func fileModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// loadConfig loads the nearest parsley.toml above dir, or returns nil if
+// there is none or --no-config is set
+func loadConfig(dir string) *config.Config {
+	if *noConfigFlag {
+		return nil
+	}
+	path, err := config.Find(dir)
+	if err == nil && path == "" {
+		return nil
+	}
+	var cfg *config.Config
+	if err == nil {
+		cfg, err = config.Load(path)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %s\n", err)
+		os.Exit(1)
+	}
+	return cfg
+}
+
+// newEnvironment creates the root environment for a script from the
+// workspace config and command-line flags
+func newEnvironment(cfg *config.Config) *evaluator.Environment {
 	// Build security policy (always create one to enable default restrictions)
-	policy, err := buildSecurityPolicy()
+	policy, err := buildSecurityPolicy(cfg)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 		os.Exit(1)
 	}
 
+	env := evaluator.NewEnvironment()
+	env.Security = policy
+	env.Strict = *strictFlag
+	env.LockFile = lockFilePath(cfg)
+	var envNames []string
+	if cfg != nil {
+		env.Strict = env.Strict || cfg.Strict
+		env.ModulePaths = cfg.Modules.Paths
+		envNames = cfg.Env
+		if cfg.Locale != "" {
+			evaluator.DefaultLocale = cfg.Locale
+		}
+	}
+	for _, name := range strings.Split(*envFlag, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			envNames = append(envNames, name)
+		}
+	}
+	env.EnvVars = evaluator.ExposeEnv(envNames)
+	return env
+}
+
+// evalFileOrExit reads, parses and evaluates a pars source file in env,
+// printing any parse or runtime error and exiting
+func evalFileOrExit(filename string, env *evaluator.Environment) evaluator.Object {
+	evaluated, ok := evalFile(filename, env)
+	if !ok {
+		os.Exit(1)
+	}
+	return evaluated
+}
+
+// evalFile reads, parses and evaluates a pars source file in env, printing
+// any parse or runtime error and returning false
+func evalFile(filename string, env *evaluator.Environment) (evaluator.Object, bool) {
 	// Read the file
 	content, err := os.ReadFile(filename)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error reading file '%s': %v\n", filename, err)
-		os.Exit(1)
+		return nil, false
 	}
 
 	// Create lexer and parser with filename
@@ -131,14 +545,13 @@ func executeFile(filename string, prettyPrint bool) {
 	program := p.ParseProgram()
 	if errors := p.Errors(); len(errors) != 0 {
 		printErrors(filename, string(content), errors)
-		os.Exit(1)
+		return nil, false
 	}
 
 	// Evaluate the program
-	env := evaluator.NewEnvironment()
 	env.Filename = filename
-	env.Security = policy
 	evaluated := evaluator.Eval(program, env)
+	evaluator.EndScript(env)
 
 	// Check for evaluation errors
 	if evaluated != nil && evaluated.Type() == evaluator.ERROR_OBJ {
@@ -146,95 +559,167 @@ func executeFile(filename string, prettyPrint bool) {
 		errObj, ok := evaluated.(*evaluator.Error)
 		if ok && errObj.Line > 0 {
 			// Error has position information
-			printErrors(filename, string(content), []string{errObj.Inspect()})
+			printRuntimeError(filename, string(content), errObj)
 		} else {
 			// Error without position information (legacy format)
 			fmt.Fprintf(os.Stderr, "%s: %s\n", filename, evaluated.Inspect())
 		}
+		return nil, false
+	}
+
+	return evaluated, true
+}
+
+// parsfileName is the task file used by `pars run`
+const parsfileName = "parsfile.pars"
+
+// runTasks loads the parsfile and runs the named tasks, or the default task
+func runTasks(args []string, cfg *config.Config) {
+	parsfile, defaultTask := parsfileName, "default"
+	if cfg != nil {
+		parsfile, defaultTask = cfg.Build.Parsfile, cfg.Build.DefaultTask
+	}
+
+	runFlags := flag.NewFlagSet("run", flag.ExitOnError)
+	forceFlag := runFlags.Bool("force", false, "Run tasks even if their outputs are up to date")
+	listFlag := runFlags.Bool("list", false, "List tasks and their descriptions")
+	fileFlag := runFlags.String("file", parsfile, "Parsfile to load")
+	runFlags.Parse(args)
+
+	start := time.Now()
+	env := newEnvironment(cfg)
+	env.Tasks = evaluator.NewTaskRegistry()
+	startCassette()
+	evalFileOrExit(*fileFlag, env)
+
+	targets := runFlags.Args()
+	if len(targets) == 0 && !*listFlag {
+		if _, ok := env.Tasks.Get(defaultTask); ok {
+			targets = []string{defaultTask}
+		}
+	}
+
+	if len(targets) == 0 {
+		printTasks(env.Tasks)
+		return
+	}
+
+	opts := evaluator.TaskRunOptions{Force: *forceFlag, Log: os.Stderr}
+	err := env.Tasks.Run(targets, opts)
+	saveCassette()
+	printSummary(start, 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 		os.Exit(1)
 	}
+}
 
-	// Print result if not null and not an error
-	if evaluated != nil && evaluated.Type() != evaluator.ERROR_OBJ && evaluated.Type() != evaluator.NULL_OBJ {
-		output := evaluator.ObjectToPrintString(evaluated)
+// printTasks lists the tasks defined in a parsfile
+func printTasks(tasks *evaluator.TaskRegistry) {
+	all := tasks.Tasks()
+	if len(all) == 0 {
+		fmt.Println("No tasks defined")
+		return
+	}
 
-		// Apply HTML formatting if --pp flag is set
-		if prettyPrint {
-			output = formatter.FormatHTML(output)
+	width := 0
+	for _, t := range all {
+		if len(t.Name) > width {
+			width = len(t.Name)
 		}
+	}
 
-		fmt.Println(output)
+	fmt.Println("Tasks:")
+	for _, t := range all {
+		details := t.Description
+		if len(t.Deps) > 0 {
+			details = strings.TrimSpace(fmt.Sprintf("%s (after %s)", details, strings.Join(t.Deps, ", ")))
+		}
+		fmt.Println(strings.TrimRight(fmt.Sprintf("  %-*s  %s", width, t.Name, details), " "))
 	}
 }
 
-// printErrors prints formatted error messages with context
+// printErrors prints parser error messages with the source they point at
 func printErrors(filename string, source string, errors []string) {
-	fmt.Fprintf(os.Stderr, "Error in '%s':\n", filename)
-	lines := strings.Split(source, "\n")
-
-	for _, msg := range errors {
-		fmt.Fprintf(os.Stderr, "  %s\n", msg)
-
-		// Try to extract line number and column, then show context
-		var lineNum, colNum int
-		if n, _ := fmt.Sscanf(msg, "line %d, column %d", &lineNum, &colNum); n == 2 && lineNum > 0 && lineNum <= len(lines) {
-			sourceLine := lines[lineNum-1]
-
-			// Calculate how many columns to trim from the left
-			trimCount := 0
-			for i := 0; i < len(sourceLine); i++ {
-				if sourceLine[i] == ' ' || sourceLine[i] == '\t' {
-					if sourceLine[i] == '\t' {
-						trimCount += 8
-					} else {
-						trimCount++
-					}
-				} else {
-					break
-				}
-			}
+	diags := make([]diagnostics.Diagnostic, len(errors))
+	for i, msg := range errors {
+		diags[i] = diagnostics.FromMessage(msg)
+	}
+	printDiagnostics(filename, source, diags)
+}
 
-			// Trim left whitespace from the source line
-			trimmedLine := strings.TrimLeft(sourceLine, " \t")
-
-			// Show the trimmed line with slight indentation
-			fmt.Fprintf(os.Stderr, "    %s\n", trimmedLine)
-
-			// Show pointer to the error position
-			if colNum > 0 {
-				// Calculate visual column accounting for tabs (8 spaces each) up to error position
-				visualCol := 0
-				for i := 0; i < colNum-1 && i < len(sourceLine); i++ {
-					if sourceLine[i] == '\t' {
-						visualCol += 8
-					} else {
-						visualCol++
-					}
-				}
+// printRuntimeError prints an evaluation error with the source it points at,
+// and any hint and notes it has. Errors in imported modules show the module's
+// source and the imports that led to it.
+func printRuntimeError(filename string, source string, err *evaluator.Error) {
+	d := diagnostics.Diagnostic{
+		Message: err.Message,
+		Line:    err.Line,
+		Column:  err.Column,
+		Length:  err.Length,
+		Hint:    err.Hint,
+	}
+	for _, n := range err.Notes {
+		d.Notes = append(d.Notes, diagnostics.Note{Message: n.Message, Line: n.Line, Column: n.Column})
+	}
+	for _, imp := range err.Imports {
+		d.Imports = append(d.Imports, diagnostics.Location{File: displayPath(imp.File), Line: imp.Line, Column: imp.Column})
+	}
 
-				// Adjust pointer position by subtracting trimmed columns
-				adjustedCol := visualCol - trimCount
-				if adjustedCol < 0 {
-					adjustedCol = 0
-				}
+	if err.File != "" && err.File != filename {
+		// A module that can't be read is printed without its source
+		content, _ := os.ReadFile(err.File)
+		filename, source = displayPath(err.File), string(content)
+	}
+	printDiagnostics(filename, source, []diagnostics.Diagnostic{d})
+}
 
-				pointer := strings.Repeat(" ", adjustedCol) + "^"
-				fmt.Fprintf(os.Stderr, "    %s\n", pointer)
-			}
-		} else if _, err := fmt.Sscanf(msg, "line %d", &lineNum); err == nil && lineNum > 0 && lineNum <= len(lines) {
-			// Fallback: show line without pointer if only line number available
-			trimmedLine := strings.TrimLeft(lines[lineNum-1], " \t")
-			fmt.Fprintf(os.Stderr, "    %s\n", trimmedLine)
-		}
+// displayPath returns path relative to the working directory if it's inside
+// it, for error messages
+func displayPath(path string) string {
+	if !filepath.IsAbs(path) {
+		return path
 	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
+
+// printDiagnostics prints diagnostics to stderr, in color if --color says so
+func printDiagnostics(filename string, source string, diags []diagnostics.Diagnostic) {
+	var color bool
+	switch *colorFlag {
+	case "always":
+		color = true
+	case "never":
+		color = false
+	default:
+		color = diagnostics.ColorEnabled(os.Stderr)
+	}
+	diagnostics.Printer{Color: color}.Print(os.Stderr, filename, source, diags)
 }
 
-// buildSecurityPolicy creates a SecurityPolicy from command-line flags
-func buildSecurityPolicy() (*evaluator.SecurityPolicy, error) {
+// buildSecurityPolicy creates a SecurityPolicy from the workspace config
+// (if any) and command-line flags, which add to the config's settings
+func buildSecurityPolicy(cfg *config.Config) (*evaluator.SecurityPolicy, error) {
 	policy := &evaluator.SecurityPolicy{
 		NoRead:          *noReadFlag,
 		AllowWriteAll:   *allowWriteAllFlag || *allowWriteAllShort,
 		AllowExecuteAll: *allowExecuteAllFlag || *allowExecuteAllShort,
+		DryRun:          *dryRunFlag,
+	}
+	if cfg != nil {
+		policy.NoRead = policy.NoRead || cfg.Security.NoRead
+		policy.AllowWriteAll = policy.AllowWriteAll || cfg.Security.AllowWriteAll
+		policy.AllowExecuteAll = policy.AllowExecuteAll || cfg.Security.AllowExecuteAll
+		policy.RestrictRead = cfg.Security.RestrictRead
+		policy.AllowWrite = cfg.Security.AllowWrite
+		policy.AllowExecute = cfg.Security.AllowExecute
 	}
 
 	// Parse restrict list
@@ -243,7 +728,7 @@ func buildSecurityPolicy() (*evaluator.SecurityPolicy, error) {
 		if err != nil {
 			return nil, fmt.Errorf("invalid --restrict-read: %s", err)
 		}
-		policy.RestrictRead = paths
+		policy.RestrictRead = append(policy.RestrictRead, paths...)
 	}
 
 	// Parse allow lists
@@ -252,7 +737,7 @@ func buildSecurityPolicy() (*evaluator.SecurityPolicy, error) {
 		if err != nil {
 			return nil, fmt.Errorf("invalid --allow-write: %s", err)
 		}
-		policy.AllowWrite = paths
+		policy.AllowWrite = append(policy.AllowWrite, paths...)
 	}
 
 	if *allowExecuteFlag != "" {
@@ -260,7 +745,7 @@ func buildSecurityPolicy() (*evaluator.SecurityPolicy, error) {
 		if err != nil {
 			return nil, fmt.Errorf("invalid --allow-execute: %s", err)
 		}
-		policy.AllowExecute = paths
+		policy.AllowExecute = append(policy.AllowExecute, paths...)
 	}
 
 	return policy, nil
@@ -278,13 +763,7 @@ func parseAndResolvePaths(pathList string) ([]string, error) {
 		}
 
 		// Expand home directory
-		if strings.HasPrefix(p, "~/") {
-			home, err := os.UserHomeDir()
-			if err != nil {
-				return nil, fmt.Errorf("cannot expand ~: %s", err)
-			}
-			p = filepath.Join(home, p[2:])
-		}
+		p = evaluator.ExpandHome(p)
 
 		// Convert to absolute path
 		absPath, err := filepath.Abs(p)
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sambeau/parsley/pkg/config"
+	"github.com/sambeau/parsley/pkg/evaluator"
+	"github.com/sambeau/parsley/pkg/lexer"
+	"github.com/sambeau/parsley/pkg/parser"
+)
+
+// modCommand implements `pars mod download [file...]`: it downloads the
+// remote modules the files import (every .pars file under the current
+// directory by default) into the module cache and records them in
+// parsley.lock
+func modCommand(args []string) {
+	if len(args) == 0 || args[0] != "download" {
+		fmt.Fprintln(os.Stderr, "Usage: pars mod download [file...]")
+		os.Exit(2)
+	}
+
+	files := args[1:]
+	if len(files) == 0 {
+		var err error
+		if files, err = findScripts("."); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var urls []string
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+		p := parser.New(lexer.New(string(content)))
+		program := p.ParseProgram()
+		if len(p.Errors()) > 0 {
+			fmt.Fprintf(os.Stderr, "Error in '%s': %s\n", file, p.Errors()[0])
+			os.Exit(1)
+		}
+		urls = append(urls, evaluator.RemoteImports(program, "")...)
+	}
+
+	lockFile := lockFilePath(loadConfig("."))
+	modules, err := evaluator.DownloadModules(urls, lockFile)
+	for _, m := range modules {
+		fmt.Printf("%s %s\n", m.URL, m.Hash)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	if len(modules) == 0 {
+		fmt.Println("No remote modules imported")
+	}
+}
+
+// findScripts lists the .pars files under dir, skipping hidden directories
+func findScripts(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && path != dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() && filepath.Ext(path) == ".pars" {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// lockFilePath returns where remote module hashes are recorded: next to the
+// workspace's parsley.toml, or in the current directory without one
+func lockFilePath(cfg *config.Config) string {
+	if cfg != nil {
+		return filepath.Join(filepath.Dir(cfg.Path), evaluator.LockFileName)
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		return filepath.Join(cwd, evaluator.LockFileName)
+	}
+	return evaluator.LockFileName
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sambeau/parsley/pkg/config"
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+// serveScript implements `pars serve app.pars`: the script's result is a
+// handler function, which is served until pars is stopped. The script is
+// run again when it or a module it imports changes.
+func serveScript(args []string) {
+	serveFlags := flag.NewFlagSet("serve", flag.ExitOnError)
+	portFlag := serveFlags.Int("port", 8080, "Port to listen on")
+	hostFlag := serveFlags.String("host", "127.0.0.1", "Address to listen on (0.0.0.0 for every interface)")
+
+	// Flags may come before or after the script
+	serveFlags.Parse(args)
+	rest := serveFlags.Args()
+	if len(rest) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: pars serve [--port=N] [--host=ADDR] app.pars")
+		os.Exit(2)
+	}
+	script := rest[0]
+	serveFlags.Parse(rest[1:])
+	if extra := serveFlags.Args(); len(extra) > 0 {
+		fmt.Fprintf(os.Stderr, "Error: unexpected argument %q\n", extra[0])
+		os.Exit(2)
+	}
+
+	s := &scriptServer{filename: script, cfg: loadConfig(filepath.Dir(script))}
+	if !s.load() {
+		os.Exit(1)
+	}
+	addr := net.JoinHostPort(*hostFlag, strconv.Itoa(*portFlag))
+	if err := evaluator.Serve(addr, s); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// scriptServer serves the handler returned by a script, reloading the
+// script before a request if it has changed
+type scriptServer struct {
+	filename string
+	cfg      *config.Config
+
+	mu      sync.Mutex
+	modTime time.Time
+	handler http.Handler
+}
+
+// load runs the script and takes its result as the handler, printing any
+// error and returning false
+func (s *scriptServer) load() bool {
+	s.modTime = fileModTime(s.filename)
+	env := newEnvironment(s.cfg)
+	evaluated, ok := evalFile(s.filename, env)
+	if !ok {
+		return false
+	}
+	handler, err := evaluator.ServeHandler(evaluated, env)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: the script must end with a handler function: %s\n", s.filename, err)
+		return false
+	}
+	s.handler = handler
+	return true
+}
+
+func (s *scriptServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Requests are handled one at a time, so a reload never happens while
+	// the handler runs
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := !fileModTime(s.filename).Equal(s.modTime)
+	if len(evaluator.InvalidateChangedModules()) > 0 || changed {
+		if !s.load() {
+			s.handler = nil
+		}
+	}
+	if s.handler == nil {
+		http.Error(w, "The script failed to load; see the pars output", http.StatusInternalServerError)
+		return
+	}
+	s.handler.ServeHTTP(w, r)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+// printSummary prints what the run did to stderr, if --summary is set:
+//
+//	Summary:
+//	  files read      3 (12.4 KB)
+//	  files written   1 (2.0 KB)
+//	  output          4.2 KB
+//	  HTTP requests   2 (1.3 MB in 340ms)
+//	  SQL queries     12 (8ms)
+//	  commands        1 (1.2s)
+//	  time            1.52s wall, 810ms CPU
+//
+// output is the size of the script's result, to which anything written to
+// stdout and stderr with ==> is added.
+func printSummary(start time.Time, output int) {
+	if !*summaryFlag {
+		return
+	}
+	writeSummary(os.Stderr, evaluator.CurrentUsage(), output, time.Since(start), cpuTime())
+}
+
+// writeSummary writes the --summary report to w
+func writeSummary(w io.Writer, u evaluator.Usage, output int, wall, cpu time.Duration) {
+	fmt.Fprintln(w, "Summary:")
+	line := func(label, value string) {
+		fmt.Fprintf(w, "  %-15s %s\n", label, value)
+	}
+	line("files read", fmt.Sprintf("%d (%s)", u.FilesRead, formatSize(u.BytesRead)))
+	line("files written", fmt.Sprintf("%d (%s)", u.FilesWritten, formatSize(u.BytesWritten)))
+	line("output", formatSize(int64(output)+u.BytesOutput))
+	line("HTTP requests", fmt.Sprintf("%d (%s in %s)", u.HTTPRequests, formatSize(u.HTTPBytes), formatElapsed(u.HTTPTime)))
+	line("SQL queries", fmt.Sprintf("%d (%s)", u.SQLQueries, formatElapsed(u.SQLTime)))
+	line("commands", fmt.Sprintf("%d (%s)", u.Commands, formatElapsed(u.CommandTime)))
+	times := formatElapsed(wall) + " wall"
+	if cpu > 0 {
+		times += ", " + formatElapsed(cpu) + " CPU"
+	}
+	line("time", times)
+}
+
+// formatSize formats a byte count as B, KB or MB
+func formatSize(n int64) string {
+	switch {
+	case n < 1024:
+		return fmt.Sprintf("%d B", n)
+	case n < 1024*1024:
+		return fmt.Sprintf("%.1f KB", float64(n)/1024)
+	default:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1024*1024))
+	}
+}
+
+// formatElapsed rounds a duration for the summary: milliseconds under a
+// second, hundredths of a second above
+func formatElapsed(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(10 * time.Millisecond).String()
+}
@@ -149,6 +149,76 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+// PropsStatement declares the props a component expects, like
+// 'props {title: string, items: array = []}'
+type PropsStatement struct {
+	Token lexer.Token // the 'props' token
+	Props []*PropDeclaration
+}
+
+func (ps *PropsStatement) statementNode()       {}
+func (ps *PropsStatement) TokenLiteral() string { return ps.Token.Literal }
+func (ps *PropsStatement) String() string {
+	props := []string{}
+	for _, p := range ps.Props {
+		props = append(props, p.String())
+	}
+	return "props {" + strings.Join(props, ", ") + "}"
+}
+
+// PropDeclaration is one 'name: type = default' entry of a props statement
+type PropDeclaration struct {
+	Token   lexer.Token // the prop name token
+	Name    *Identifier
+	Type    string     // "" accepts any type
+	Default Expression // nil if the prop is required
+}
+
+func (pd *PropDeclaration) TokenLiteral() string { return pd.Token.Literal }
+func (pd *PropDeclaration) String() string {
+	out := pd.Name.String()
+	if pd.Type != "" {
+		out += ": " + pd.Type
+	}
+	if pd.Default != nil {
+		out += " = " + pd.Default.String()
+	}
+	return out
+}
+
+// ImportStatement binds names exported by a module, like
+// 'import {add, PI as pi} from @./math.pars'
+type ImportStatement struct {
+	Token lexer.Token // the 'import' token
+	Names []*ImportName
+	Path  Expression
+}
+
+func (is *ImportStatement) statementNode()       {}
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImportStatement) String() string {
+	names := []string{}
+	for _, n := range is.Names {
+		names = append(names, n.String())
+	}
+	return "import {" + strings.Join(names, ", ") + "} from " + is.Path.String()
+}
+
+// ImportName is one 'name' or 'name as alias' entry of an import statement
+type ImportName struct {
+	Token lexer.Token // the name token
+	Name  *Identifier
+	Alias *Identifier // nil if the name is bound as is
+}
+
+func (in *ImportName) TokenLiteral() string { return in.Token.Literal }
+func (in *ImportName) String() string {
+	if in.Alias != nil {
+		return in.Name.String() + " as " + in.Alias.String()
+	}
+	return in.Name.String()
+}
+
 // ExpressionStatement represents expression statements
 type ExpressionStatement struct {
 	Token      lexer.Token // the first token of the expression
@@ -421,6 +491,97 @@ func (oe *InfixExpression) String() string {
 	return out.String()
 }
 
+// ComparisonChain represents chained comparisons like 'a < x <= b', which
+// mean 'a < x and x <= b' with each operand evaluated once
+type ComparisonChain struct {
+	Token     lexer.Token // the first operator token
+	Operands  []Expression
+	Operators []string // Operators[i] compares Operands[i] and Operands[i+1]
+}
+
+func (cc *ComparisonChain) expressionNode()      {}
+func (cc *ComparisonChain) TokenLiteral() string { return cc.Token.Literal }
+func (cc *ComparisonChain) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(cc.Operands[0].String())
+	for i, op := range cc.Operators {
+		out.WriteString(" " + op + " ")
+		out.WriteString(cc.Operands[i+1].String())
+	}
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// CondExpression represents multi-branch conditionals like
+// 'cond { x > 10 => "big", x > 0 => "small", else => "none" }'
+type CondExpression struct {
+	Token    lexer.Token // the 'cond' token
+	Branches []*CondBranch
+	Else     Expression // nil if there is no else branch
+}
+
+func (ce *CondExpression) expressionNode()      {}
+func (ce *CondExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CondExpression) String() string {
+	var out bytes.Buffer
+
+	branches := []string{}
+	for _, b := range ce.Branches {
+		branches = append(branches, b.String())
+	}
+	if ce.Else != nil {
+		branches = append(branches, "else => "+ce.Else.String())
+	}
+
+	out.WriteString("cond { ")
+	out.WriteString(strings.Join(branches, ", "))
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+// CondBranch is one 'condition => value' branch of a cond expression
+type CondBranch struct {
+	Token     lexer.Token // the '=>' token
+	Condition Expression
+	Value     Expression
+}
+
+func (cb *CondBranch) expressionNode()      {}
+func (cb *CondBranch) TokenLiteral() string { return cb.Token.Literal }
+func (cb *CondBranch) String() string {
+	return cb.Condition.String() + " => " + cb.Value.String()
+}
+
+// RangeExpression represents inclusive ranges like '1..10' or '1..10 by 2'
+type RangeExpression struct {
+	Token lexer.Token // the '..' token
+	Start Expression
+	End   Expression
+	Step  Expression // nil unless 'by' is given
+}
+
+func (re *RangeExpression) expressionNode()      {}
+func (re *RangeExpression) TokenLiteral() string { return re.Token.Literal }
+func (re *RangeExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(re.Start.String())
+	out.WriteString("..")
+	out.WriteString(re.End.String())
+	if re.Step != nil {
+		out.WriteString(" by ")
+		out.WriteString(re.Step.String())
+	}
+	out.WriteString(")")
+
+	return out.String()
+}
+
 // IfExpression represents if expressions
 type IfExpression struct {
 	Token       lexer.Token // the 'if' token
@@ -0,0 +1,361 @@
+// Package bundle packs a Parsley script, the modules it imports and the files
+// it uses into a single executable. A bundle is the pars executable with a zip
+// archive appended, followed by the archive's length and a marker, so the
+// executable can find and extract its own files when it starts.
+package bundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sambeau/parsley/pkg/lexer"
+)
+
+// magic ends every bundled executable
+const magic = "PARSBNDL"
+
+// trailerSize is the size of the archive length and the marker
+const trailerSize = 8 + len(magic)
+
+// manifestName is the archive entry holding the Manifest
+const manifestName = "bundle.json"
+
+// filesDir is the archive directory holding the bundled files
+const filesDir = "files/"
+
+// Manifest describes how to run a bundle
+type Manifest struct {
+	// Entry is the script to run, relative to the bundle's root
+	Entry string `json:"entry"`
+	// Version is the pars version that made the bundle
+	Version string `json:"version"`
+
+	// Settings in effect when the bundle was made
+	AllowWriteAll   bool `json:"allowWriteAll,omitempty"`
+	AllowExecuteAll bool `json:"allowExecuteAll,omitempty"`
+	Strict          bool `json:"strict,omitempty"`
+	Pretty          bool `json:"pretty,omitempty"`
+	Raw             bool `json:"raw,omitempty"`
+}
+
+// Collect finds the files to bundle with a script: the script, the files its
+// relative path literals (@./x, @../x) name, and the same for each module it
+// imports. Directories are only bundled when listed in include, which may
+// also name extra files. It returns the deepest directory containing every
+// file and the files' absolute paths.
+func Collect(entry string, include []string) (string, []string, error) {
+	entry, err := filepath.Abs(entry)
+	if err != nil {
+		return "", nil, err
+	}
+	if _, err := os.Stat(entry); err != nil {
+		return "", nil, err
+	}
+
+	seen := map[string]bool{entry: true}
+	files := []string{entry}
+	add := func(p string) {
+		if !seen[p] {
+			seen[p] = true
+			files = append(files, p)
+		}
+	}
+
+	// Scripts are scanned in the order found, including ones found on the way
+	for i := 0; i < len(files); i++ {
+		if filepath.Ext(files[i]) != ".pars" {
+			continue
+		}
+		refs, err := referencedFiles(files[i])
+		if err != nil {
+			return "", nil, err
+		}
+		for _, ref := range refs {
+			add(ref)
+		}
+	}
+
+	for _, inc := range include {
+		abs, err := filepath.Abs(inc)
+		if err != nil {
+			return "", nil, err
+		}
+		err = filepath.WalkDir(abs, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.Type().IsRegular() {
+				add(p)
+			}
+			return nil
+		})
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	root := filepath.Dir(entry)
+	for _, f := range files {
+		for !within(root, f) {
+			root = filepath.Dir(root)
+		}
+	}
+	sort.Strings(files[1:])
+	return root, files, nil
+}
+
+// referencedFiles returns the existing files named by relative path literals
+// in a script. Path templates and strings aren't followed.
+func referencedFiles(script string) ([]string, error) {
+	src, err := os.ReadFile(script)
+	if err != nil {
+		return nil, err
+	}
+	var refs []string
+	l := lexer.New(string(src))
+	for tok := l.NextToken(); tok.Type != lexer.EOF; tok = l.NextToken() {
+		if tok.Type != lexer.PATH_LITERAL {
+			continue
+		}
+		if !strings.HasPrefix(tok.Literal, "./") && !strings.HasPrefix(tok.Literal, "../") {
+			continue
+		}
+		p := filepath.Join(filepath.Dir(script), filepath.FromSlash(tok.Literal))
+		if info, err := os.Stat(p); err == nil && info.Mode().IsRegular() {
+			refs = append(refs, p)
+		}
+	}
+	return refs, nil
+}
+
+// within reports whether p is inside dir
+func within(dir, p string) bool {
+	rel, err := filepath.Rel(dir, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Write writes a bundle: exe (any bundle already on it is removed), then an
+// archive of files, stored relative to root, and the manifest
+func Write(w io.Writer, exe []byte, manifest Manifest, root string, files []string) error {
+	if n, ok := payloadSize(exe); ok {
+		exe = exe[:len(exe)-int(n)-trailerSize]
+	}
+
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	mw, err := zw.Create(manifestName)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(mw).Encode(manifest); err != nil {
+		return err
+	}
+	for _, f := range files {
+		rel, err := filepath.Rel(root, f)
+		if err != nil {
+			return err
+		}
+		fw, err := zw.Create(filesDir + filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	trailer := make([]byte, 8, trailerSize)
+	binary.LittleEndian.PutUint64(trailer, uint64(archive.Len()))
+	trailer = append(trailer, magic...)
+	for _, b := range [][]byte{exe, archive.Bytes(), trailer} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// payloadSize returns the length of the archive at the end of data, if any
+func payloadSize(data []byte) (int64, bool) {
+	if len(data) < trailerSize || string(data[len(data)-len(magic):]) != magic {
+		return 0, false
+	}
+	n := binary.LittleEndian.Uint64(data[len(data)-trailerSize:])
+	if n > uint64(len(data)-trailerSize) {
+		return 0, false
+	}
+	return int64(n), true
+}
+
+// Bundle is the archive appended to an executable
+type Bundle struct {
+	Manifest Manifest
+	// Hash identifies the bundle's contents
+	Hash    string
+	archive *zip.Reader
+}
+
+// Open reads the bundle appended to the executable at exePath. It returns
+// nil, nil if there isn't one.
+func Open(exePath string) (*Bundle, error) {
+	f, err := os.Open(exePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < int64(trailerSize) {
+		return nil, nil
+	}
+	trailer := make([]byte, trailerSize)
+	if _, err := f.ReadAt(trailer, info.Size()-int64(trailerSize)); err != nil {
+		return nil, err
+	}
+	if string(trailer[8:]) != magic {
+		return nil, nil
+	}
+	n := int64(binary.LittleEndian.Uint64(trailer))
+	if n < 0 || n > info.Size()-int64(trailerSize) {
+		return nil, errors.New("bundle is damaged")
+	}
+
+	// The archive is read into memory: bundles are scripts and their assets
+	data := make([]byte, n)
+	if _, err := f.ReadAt(data, info.Size()-int64(trailerSize)-n); err != nil {
+		return nil, err
+	}
+	return openArchive(data)
+}
+
+// openArchive reads a bundle's archive and manifest
+func openArchive(data []byte) (*Bundle, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("bundle is damaged: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	b := &Bundle{Hash: hex.EncodeToString(sum[:8]), archive: zr}
+
+	mf, err := zr.Open(manifestName)
+	if err != nil {
+		return nil, fmt.Errorf("bundle has no manifest: %w", err)
+	}
+	defer mf.Close()
+	if err := json.NewDecoder(mf).Decode(&b.Manifest); err != nil {
+		return nil, fmt.Errorf("bundle manifest: %w", err)
+	}
+	if b.Manifest.Entry == "" {
+		return nil, errors.New("bundle manifest has no entry script")
+	}
+	return b, nil
+}
+
+// Files lists the bundled files, relative to the bundle's root
+func (b *Bundle) Files() []string {
+	var names []string
+	for _, f := range b.archive.File {
+		if name, ok := strings.CutPrefix(f.Name, filesDir); ok && name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Extract writes the bundled files into dir/<hash> and returns the path of
+// the entry script. Files already extracted by an earlier run are reused.
+func (b *Bundle) Extract(dir string) (string, error) {
+	target := filepath.Join(dir, b.Hash)
+	entry := filepath.Join(target, filepath.FromSlash(b.Manifest.Entry))
+	if _, err := os.Stat(entry); err == nil {
+		return entry, nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	// Extract beside the target and rename, so a run never sees half a bundle
+	tmp, err := os.MkdirTemp(dir, "."+b.Hash+"-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, f := range b.archive.File {
+		name, ok := strings.CutPrefix(f.Name, filesDir)
+		if !ok || name == "" || strings.HasSuffix(name, "/") {
+			continue
+		}
+		if !fs.ValidPath(name) {
+			return "", fmt.Errorf("bundle contains an invalid path: %s", f.Name)
+		}
+		if err := extractFile(f, filepath.Join(tmp, filepath.FromSlash(name))); err != nil {
+			return "", err
+		}
+	}
+
+	if err := os.Rename(tmp, target); err != nil {
+		// Another run may have extracted the same bundle first
+		if _, statErr := os.Stat(entry); statErr == nil {
+			return entry, nil
+		}
+		return "", err
+	}
+	return entry, nil
+}
+
+// extractFile writes one archive entry to dest
+func extractFile(f *zip.File, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, rc)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// EntryName returns the manifest entry for a script bundled from root
+func EntryName(root, script string) (string, error) {
+	abs, err := filepath.Abs(script)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil {
+		return "", err
+	}
+	return path.Clean(filepath.ToSlash(rel)), nil
+}
@@ -0,0 +1,286 @@
+// Package config loads parsley.toml workspace configuration files.
+// A workspace file sets defaults for the pars command (security policy,
+// module search paths, output, locale and task runner settings) so they
+// don't have to be repeated as flags on every invocation.
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sambeau/parsley/pkg/toml"
+)
+
+// FileName is the name of the workspace configuration file
+const FileName = "parsley.toml"
+
+// Config is a parsed workspace configuration. Paths are absolute.
+type Config struct {
+	// Path is the file the configuration was loaded from
+	Path string
+	// Locale is the default locale for formatting (e.g., "en-GB")
+	Locale string
+	// Strict enables strict mode (pars --strict)
+	Strict bool
+	// Env names the environment variables scripts can read as env (pars --env)
+	Env      []string
+	Security Security
+	Modules  Modules
+	Output   Output
+	Build    Build
+}
+
+// Security holds the default security policy, merged with command-line flags
+type Security struct {
+	NoRead          bool
+	RestrictRead    []string
+	AllowWrite      []string
+	AllowWriteAll   bool
+	AllowExecute    []string
+	AllowExecuteAll bool
+}
+
+// Modules holds module resolution settings
+type Modules struct {
+	// Paths are searched, in order, for imports not found relative to the importing file
+	Paths []string
+}
+
+// Output holds defaults for how pars prints script results
+type Output struct {
+	// Dir, when set, receives script results as files instead of stdout
+	Dir string
+	// Ext is the extension of result files written to Dir (default ".html")
+	Ext    string
+	Pretty bool
+	Raw    bool
+	// Validate checks HTML results for well-formedness (pars --validate)
+	Validate bool
+}
+
+// Build holds task runner settings for `pars run`
+type Build struct {
+	// Parsfile is the task file to load (default parsfile.pars next to the config)
+	Parsfile string
+	// DefaultTask runs when no task is named (default "default")
+	DefaultTask string
+}
+
+// Find walks up from dir to the filesystem root looking for parsley.toml.
+// It returns "" if there is none.
+func Find(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		path := filepath.Join(dir, FileName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// Load reads and parses a configuration file
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := Parse(string(data), filepath.Dir(absPath))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	cfg.Path = absPath
+	return cfg, nil
+}
+
+// Parse parses configuration text, resolving relative paths against dir
+func Parse(data string, dir string) (*Config, error) {
+	doc, err := toml.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{
+		Output: Output{Ext: ".html"},
+		Build:  Build{Parsfile: filepath.Join(dir, "parsfile.pars"), DefaultTask: "default"},
+	}
+	d := &decoder{dir: dir}
+
+	d.section(doc, "", map[string]func(string, interface{}){
+		"locale": d.str(&cfg.Locale),
+		"strict": d.boolean(&cfg.Strict),
+		"env":    d.strs(&cfg.Env),
+		"security": d.table(map[string]func(string, interface{}){
+			"no_read":           d.boolean(&cfg.Security.NoRead),
+			"restrict_read":     d.paths(&cfg.Security.RestrictRead),
+			"allow_write":       d.paths(&cfg.Security.AllowWrite),
+			"allow_write_all":   d.boolean(&cfg.Security.AllowWriteAll),
+			"allow_execute":     d.paths(&cfg.Security.AllowExecute),
+			"allow_execute_all": d.boolean(&cfg.Security.AllowExecuteAll),
+		}),
+		"modules": d.table(map[string]func(string, interface{}){
+			"paths": d.paths(&cfg.Modules.Paths),
+		}),
+		"output": d.table(map[string]func(string, interface{}){
+			"dir":      d.path(&cfg.Output.Dir),
+			"ext":      d.str(&cfg.Output.Ext),
+			"pretty":   d.boolean(&cfg.Output.Pretty),
+			"raw":      d.boolean(&cfg.Output.Raw),
+			"validate": d.boolean(&cfg.Output.Validate),
+		}),
+		"build": d.table(map[string]func(string, interface{}){
+			"parsfile":     d.path(&cfg.Build.Parsfile),
+			"default_task": d.str(&cfg.Build.DefaultTask),
+		}),
+	})
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	if cfg.Output.Ext != "" && !strings.HasPrefix(cfg.Output.Ext, ".") {
+		cfg.Output.Ext = "." + cfg.Output.Ext
+	}
+	return cfg, nil
+}
+
+// decoder copies parsed TOML values into a Config, recording the first error
+type decoder struct {
+	dir string
+	err error
+}
+
+func (d *decoder) fail(format string, a ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf(format, a...)
+	}
+}
+
+// section decodes each key of a table with its field setter, rejecting unknown keys
+func (d *decoder) section(values map[string]interface{}, prefix string, fields map[string]func(string, interface{})) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name := prefix + key
+		set, ok := fields[key]
+		if !ok {
+			d.fail("unknown setting %q", name)
+			return
+		}
+		set(name, values[key])
+	}
+}
+
+func (d *decoder) table(fields map[string]func(string, interface{})) func(string, interface{}) {
+	return func(name string, v interface{}) {
+		t, ok := v.(map[string]interface{})
+		if !ok {
+			d.fail("%s must be a table ([%s])", name, name)
+			return
+		}
+		d.section(t, name+".", fields)
+	}
+}
+
+func (d *decoder) boolean(dst *bool) func(string, interface{}) {
+	return func(name string, v interface{}) {
+		b, ok := v.(bool)
+		if !ok {
+			d.fail("%s must be true or false", name)
+			return
+		}
+		*dst = b
+	}
+}
+
+func (d *decoder) str(dst *string) func(string, interface{}) {
+	return func(name string, v interface{}) {
+		s, ok := v.(string)
+		if !ok {
+			d.fail("%s must be a string", name)
+			return
+		}
+		*dst = s
+	}
+}
+
+func (d *decoder) path(dst *string) func(string, interface{}) {
+	return func(name string, v interface{}) {
+		s, ok := v.(string)
+		if !ok || s == "" {
+			d.fail("%s must be a non-empty string", name)
+			return
+		}
+		*dst = d.resolve(s)
+	}
+}
+
+func (d *decoder) strs(dst *[]string) func(string, interface{}) {
+	return func(name string, v interface{}) {
+		arr, ok := v.([]interface{})
+		if !ok {
+			d.fail("%s must be an array of strings", name)
+			return
+		}
+		list := make([]string, len(arr))
+		for i, elem := range arr {
+			s, ok := elem.(string)
+			if !ok || s == "" {
+				d.fail("%s must be an array of strings", name)
+				return
+			}
+			list[i] = s
+		}
+		*dst = list
+	}
+}
+
+func (d *decoder) paths(dst *[]string) func(string, interface{}) {
+	return func(name string, v interface{}) {
+		arr, ok := v.([]interface{})
+		if !ok {
+			d.fail("%s must be an array of strings", name)
+			return
+		}
+		list := make([]string, len(arr))
+		for i, elem := range arr {
+			s, ok := elem.(string)
+			if !ok || s == "" {
+				d.fail("%s must be an array of strings", name)
+				return
+			}
+			list[i] = d.resolve(s)
+		}
+		*dst = list
+	}
+}
+
+// resolve makes a path absolute relative to the config file's directory
+func (d *decoder) resolve(p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") || strings.HasPrefix(p, "~"+string(filepath.Separator)) {
+		if home, err := os.UserHomeDir(); err == nil {
+			p = filepath.Join(home, p[1:])
+		}
+	}
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(d.dir, p)
+	}
+	return filepath.Clean(p)
+}
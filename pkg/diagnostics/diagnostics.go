@@ -0,0 +1,201 @@
+// Package diagnostics prints parse and runtime errors with the source lines
+// they point at: the span underlined, an optional "did you mean" hint, and
+// notes pointing at related places in the source, in color on terminals.
+package diagnostics
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// Diagnostic is an error at a place in a source file
+type Diagnostic struct {
+	Message string
+	// Line and Column are 1-based, counting bytes as the lexer does; 0 means
+	// unknown
+	Line   int
+	Column int
+	// Length is the number of bytes of source to underline, which may run
+	// onto following lines; 0 or 1 marks a single character
+	Length int
+	// Hint is a suggested fix, such as "did you mean `formatDate`?"
+	Hint  string
+	Notes []Note
+	// Imports are the imports that led to the file the diagnostic is in,
+	// innermost first
+	Imports []Location
+}
+
+// Note points at another place in the source related to a diagnostic
+type Note struct {
+	Message string
+	Line    int
+	Column  int
+}
+
+// Location is a place in another file
+type Location struct {
+	File   string
+	Line   int
+	Column int
+}
+
+// FromMessage makes a diagnostic from a "line N, column M: message" string,
+// as the parser reports errors. Messages without a position are kept whole.
+func FromMessage(msg string) Diagnostic {
+	var line, col int
+	if n, _ := fmt.Sscanf(msg, "line %d, column %d", &line, &col); n == 2 {
+		if i := strings.Index(msg, ": "); i >= 0 {
+			return Diagnostic{Message: msg[i+2:], Line: line, Column: col}
+		}
+	} else if n == 1 {
+		if i := strings.Index(msg, ": "); i >= 0 {
+			return Diagnostic{Message: msg[i+2:], Line: line}
+		}
+	}
+	return Diagnostic{Message: msg}
+}
+
+// Position returns the "line N, column M: " prefix of a diagnostic, or ""
+func (d Diagnostic) Position() string {
+	switch {
+	case d.Line > 0 && d.Column > 0:
+		return fmt.Sprintf("line %d, column %d: ", d.Line, d.Column)
+	case d.Line > 0:
+		return fmt.Sprintf("line %d: ", d.Line)
+	}
+	return ""
+}
+
+// ANSI styles
+const (
+	styleReset = "\x1b[0m"
+	styleError = "\x1b[1;31m"
+	styleBold  = "\x1b[1m"
+	styleHint  = "\x1b[32m"
+	styleNote  = "\x1b[36m"
+	styleDim   = "\x1b[2m"
+)
+
+// tabWidth is the number of columns a tab is shown as
+const tabWidth = 8
+
+// Printer prints diagnostics
+type Printer struct {
+	// Color uses ANSI colors
+	Color bool
+}
+
+// ColorEnabled reports whether output to f should be colored: f is a
+// terminal, NO_COLOR isn't set and TERM isn't "dumb"
+func ColorEnabled(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// style wraps s in an ANSI style if color is on
+func (p Printer) style(style, s string) string {
+	if !p.Color || s == "" {
+		return s
+	}
+	return style + s + styleReset
+}
+
+// Print writes the diagnostics for a file to w, each with the source it
+// points at
+func (p Printer) Print(w io.Writer, filename, source string, diags []Diagnostic) {
+	fmt.Fprintf(w, "%s in '%s':\n", p.style(styleError, "Error"), filename)
+	lines := strings.Split(source, "\n")
+
+	for _, d := range diags {
+		fmt.Fprintf(w, "  %s%s\n", p.style(styleDim, d.Position()), p.style(styleBold, d.Message))
+		p.printSpan(w, lines, d.Line, d.Column, d.Length, styleError)
+		if d.Hint != "" {
+			fmt.Fprintf(w, "    %s %s\n", p.style(styleHint, "help:"), d.Hint)
+		}
+		for _, n := range d.Notes {
+			pos := Diagnostic{Line: n.Line, Column: n.Column}.Position()
+			fmt.Fprintf(w, "    %s %s%s\n", p.style(styleNote, "note:"), p.style(styleDim, pos), n.Message)
+			p.printSpan(w, lines, n.Line, n.Column, 0, styleNote)
+		}
+		for _, imp := range d.Imports {
+			pos := strings.TrimSuffix(Diagnostic{Line: imp.Line, Column: imp.Column}.Position(), ": ")
+			if pos != "" {
+				pos = ", " + pos
+			}
+			fmt.Fprintf(w, "  %s '%s'%s\n", p.style(styleNote, "imported from"), imp.File, pos)
+		}
+	}
+}
+
+// printSpan prints the source lines a span covers, each underlined where
+// the span falls on it. Leading indentation is trimmed.
+func (p Printer) printSpan(w io.Writer, lines []string, line, col, length int, style string) {
+	if line <= 0 || line > len(lines) {
+		return
+	}
+	if col <= 0 {
+		// Without a column there's nothing to underline
+		fmt.Fprintf(w, "    %s\n", strings.TrimLeft(lines[line-1], " \t"))
+		return
+	}
+	if length < 1 {
+		length = 1
+	}
+
+	remaining := length
+	for first := true; line <= len(lines) && remaining > 0; first = false {
+		src := lines[line-1]
+		indent := len(src) - len(strings.TrimLeft(src, " \t"))
+		start := indent
+		if first {
+			start = max(min(col-1, len(src)), indent)
+		} else {
+			// The span's length includes the indentation it runs over
+			remaining -= indent
+		}
+
+		// The span ends on this line, or runs to its end and on to the next
+		end := start
+		for end < len(src) && remaining > 0 {
+			_, size := utf8.DecodeRuneInString(src[end:])
+			end += size
+			remaining -= size
+		}
+		width := displayWidth(src[start:end])
+		if width == 0 {
+			// Point just past the end of the line, e.g. at a missing token
+			width = 1
+			remaining--
+		}
+		remaining-- // the newline
+		line++
+
+		underline := strings.Repeat("~", width)
+		if first {
+			underline = "^" + underline[1:]
+		}
+		fmt.Fprintf(w, "    %s\n", src[indent:])
+		fmt.Fprintf(w, "    %s%s\n", strings.Repeat(" ", displayWidth(src[indent:start])), p.style(style, underline))
+	}
+}
+
+// displayWidth returns the number of columns s takes, with tabs as
+// tabWidth columns
+func displayWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		if r == '\t' {
+			width += tabWidth
+		} else {
+			width++
+		}
+	}
+	return width
+}
@@ -0,0 +1,53 @@
+package diagnostics
+
+import "strings"
+
+// Suggest returns the candidate closest to name, for "did you mean" hints,
+// or "" if none is close. Names that differ only in case are closest;
+// otherwise up to one edit is allowed for every three characters of name.
+func Suggest(name string, candidates []string) string {
+	maxDist := len([]rune(name)) / 3
+	lower := strings.ToLower(name)
+
+	best, bestDist := "", maxDist+1
+	for _, c := range candidates {
+		if c == name {
+			continue
+		}
+		dist := levenshtein(lower, strings.ToLower(c))
+		if dist == 0 {
+			// Differs only in case: closer than any edit
+			dist = -1
+		}
+		if dist < bestDist || (dist == bestDist && c < best) {
+			best, bestDist = c, dist
+		}
+	}
+	if bestDist > maxDist {
+		return ""
+	}
+	return best
+}
+
+// levenshtein returns the number of single-character insertions, deletions
+// and substitutions that turn a into b
+func levenshtein(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	prev := make([]int, len(br)+1)
+	curr := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		curr[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(br)]
+}
@@ -0,0 +1,409 @@
+package evaluator
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/sambeau/parsley/pkg/ast"
+	"github.com/sambeau/parsley/pkg/lexer"
+	"github.com/sambeau/parsley/pkg/parser"
+)
+
+// AST dictionaries are what parse() returns and eval() accepts. Each node
+// becomes {type: "InfixExpression", line, column, token, ...fields}, with
+// field names in lowerCamelCase (e.g. {type: "LetStatement", name: {...},
+// value: {...}}). Nodes are converted by reflection so new AST nodes only
+// need adding to astNodeTypes.
+
+// astNodeTypes maps node type names to AST struct types
+var astNodeTypes = make(map[string]reflect.Type)
+
+func init() {
+	for _, node := range []interface{}{
+		&ast.Program{}, &ast.LetStatement{}, &ast.AssignmentStatement{}, &ast.ReturnStatement{},
+		&ast.ExpressionStatement{}, &ast.BlockStatement{}, &ast.PropsStatement{}, &ast.PropDeclaration{}, &ast.ImportStatement{}, &ast.ImportName{}, &ast.Identifier{}, &ast.IntegerLiteral{},
+		&ast.FloatLiteral{}, &ast.StringLiteral{}, &ast.TemplateLiteral{}, &ast.RegexLiteral{},
+		&ast.DatetimeLiteral{}, &ast.DurationLiteral{}, &ast.PathLiteral{}, &ast.UrlLiteral{},
+		&ast.PathTemplateLiteral{}, &ast.UrlTemplateLiteral{}, &ast.DatetimeTemplateLiteral{},
+		&ast.TagLiteral{}, &ast.TagPairExpression{}, &ast.TextNode{}, &ast.Boolean{},
+		&ast.PrefixExpression{}, &ast.InfixExpression{}, &ast.ComparisonChain{}, &ast.RangeExpression{}, &ast.CondExpression{}, &ast.CondBranch{}, &ast.IfExpression{}, &ast.FunctionParameter{},
+		&ast.FunctionLiteral{}, &ast.CallExpression{}, &ast.ArrayLiteral{}, &ast.ForExpression{},
+		&ast.IndexExpression{}, &ast.SliceExpression{}, &ast.DictionaryLiteral{}, &ast.DotExpression{},
+		&ast.ExecuteExpression{}, &ast.ReadStatement{}, &ast.FetchStatement{}, &ast.WriteStatement{},
+		&ast.QueryOneStatement{}, &ast.QueryManyStatement{}, &ast.ExecuteStatement{},
+		&ast.DictDestructuringPattern{}, &ast.DictDestructuringKey{}, &ast.InterpolationBlock{},
+	} {
+		t := reflect.TypeOf(node).Elem()
+		astNodeTypes[t.Name()] = t
+	}
+}
+
+var tokenType = reflect.TypeOf(lexer.Token{})
+
+// parseSource parses Parsley source, joining any parse errors into one error
+func parseSource(source string) (*ast.Program, *Error) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		return nil, newError("parse error: %s", strings.Join(errs, "; "))
+	}
+	return program, nil
+}
+
+// astToObject converts an AST node (or any value inside one) to a Parsley value
+func astToObject(v reflect.Value) Object {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return NULL
+		}
+		return astToObject(v.Elem())
+	case reflect.Struct:
+		return astNodeToDict(v)
+	case reflect.Slice:
+		elements := make([]Object, v.Len())
+		for i := range elements {
+			elements[i] = astToObject(v.Index(i))
+		}
+		return &Array{Elements: elements}
+	case reflect.Map:
+		pairs := make(map[string]ast.Expression, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			pairs[iter.Key().String()] = objectToExpression(astToObject(iter.Value()))
+		}
+		return &Dictionary{Pairs: pairs, Env: NewEnvironment()}
+	case reflect.String:
+		return &String{Value: v.String()}
+	case reflect.Bool:
+		return nativeBoolToParsBoolean(v.Bool())
+	case reflect.Int64:
+		return &Integer{Value: v.Int()}
+	case reflect.Float64:
+		return &Float{Value: v.Float()}
+	}
+	return NULL
+}
+
+func astNodeToDict(v reflect.Value) *Dictionary {
+	t := v.Type()
+	pairs := map[string]ast.Expression{
+		"type": objectToExpression(&String{Value: t.Name()}),
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		value := v.Field(i)
+		switch {
+		case field.Type == tokenType:
+			tok := value.Interface().(lexer.Token)
+			pairs["line"] = objectToExpression(&Integer{Value: int64(tok.Line)})
+			pairs["column"] = objectToExpression(&Integer{Value: int64(tok.Column)})
+			pairs["token"] = objectToExpression(&String{Value: tok.Literal})
+		case field.Type.Kind() == reflect.Interface && field.Type.NumMethod() == 0:
+			// Runtime values (ObjectLiteralExpression) have no source form
+		default:
+			pairs[astFieldName(field.Name)] = objectToExpression(astToObject(value))
+		}
+	}
+	return &Dictionary{Pairs: pairs, Env: NewEnvironment()}
+}
+
+// objectToAST converts an AST dictionary back to an AST node
+func objectToAST(obj Object) (ast.Node, error) {
+	dict, ok := obj.(*Dictionary)
+	if !ok {
+		return nil, fmt.Errorf("AST node must be a dictionary, got %s", obj.Type())
+	}
+	v, err := dictToASTNode(dict)
+	if err != nil {
+		return nil, err
+	}
+	node, ok := v.Interface().(ast.Node)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a statement or expression", v.Elem().Type().Name())
+	}
+	return node, nil
+}
+
+func dictToASTNode(dict *Dictionary) (reflect.Value, error) {
+	name, ok := dictField(dict, "type").(*String)
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("AST node is missing its `type`")
+	}
+	t, ok := astNodeTypes[name.Value]
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("unknown AST node type %q", name.Value)
+	}
+
+	node := reflect.New(t)
+	var literalSet bool
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		target := node.Elem().Field(i)
+		switch {
+		case field.Type == tokenType:
+			tok := lexer.Token{}
+			if n, ok := dictField(dict, "line").(*Integer); ok {
+				tok.Line = int(n.Value)
+			}
+			if n, ok := dictField(dict, "column").(*Integer); ok {
+				tok.Column = int(n.Value)
+			}
+			if s, ok := dictField(dict, "token").(*String); ok {
+				tok.Literal = s.Value
+				literalSet = true
+			}
+			target.Set(reflect.ValueOf(tok))
+		case field.Type.Kind() == reflect.Interface && field.Type.NumMethod() == 0:
+			// No source form
+		default:
+			key := astFieldName(field.Name)
+			value, err := objectToASTValue(dictField(dict, key), field.Type)
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("%s.%s: %s", t.Name(), key, err)
+			}
+			target.Set(value)
+		}
+	}
+
+	// Hand-built nodes have no token text; literals print it, so derive it
+	if !literalSet {
+		if tok := node.Elem().FieldByName("Token"); tok.IsValid() {
+			if value := node.Elem().FieldByName("Value"); value.IsValid() {
+				tok.FieldByName("Literal").SetString(fmt.Sprint(value.Interface()))
+			}
+		}
+	}
+	return node, nil
+}
+
+// objectToASTValue converts a Parsley value to a value of an AST field's type
+func objectToASTValue(obj Object, t reflect.Type) (reflect.Value, error) {
+	// Missing fields and null take the zero value (e.g. export: false)
+	if _, isNull := obj.(*Null); isNull || obj == nil {
+		return reflect.Zero(t), nil
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		dict, ok := obj.(*Dictionary)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected an AST node, got %s", obj.Type())
+		}
+		node, err := dictToASTNode(dict)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if !node.Type().AssignableTo(t) {
+			return reflect.Value{}, fmt.Errorf("%s cannot be used here", node.Elem().Type().Name())
+		}
+		return node, nil
+
+	case reflect.Slice:
+		arr, ok := obj.(*Array)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected an array, got %s", obj.Type())
+		}
+		slice := reflect.MakeSlice(t, len(arr.Elements), len(arr.Elements))
+		for i, elem := range arr.Elements {
+			value, err := objectToASTValue(elem, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			slice.Index(i).Set(value)
+		}
+		return slice, nil
+
+	case reflect.Map:
+		dict, ok := obj.(*Dictionary)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected a dictionary, got %s", obj.Type())
+		}
+		m := reflect.MakeMapWithSize(t, len(dict.Pairs))
+		for key := range dict.Pairs {
+			value, err := objectToASTValue(dictField(dict, key), t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			m.SetMapIndex(reflect.ValueOf(key), value)
+		}
+		return m, nil
+
+	case reflect.String:
+		if s, ok := obj.(*String); ok {
+			return reflect.ValueOf(s.Value), nil
+		}
+	case reflect.Bool:
+		if b, ok := obj.(*Boolean); ok {
+			return reflect.ValueOf(b.Value), nil
+		}
+	case reflect.Int64:
+		if n, ok := obj.(*Integer); ok {
+			return reflect.ValueOf(n.Value), nil
+		}
+	case reflect.Float64:
+		switch n := obj.(type) {
+		case *Float:
+			return reflect.ValueOf(n.Value), nil
+		case *Integer:
+			return reflect.ValueOf(float64(n.Value)), nil
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("expected %s, got %s", t.Kind(), obj.Type())
+}
+
+// dictField evaluates a dictionary value, returning NULL if the key is missing
+func dictField(dict *Dictionary, key string) Object {
+	expr, ok := dict.Pairs[key]
+	if !ok {
+		return NULL
+	}
+	return Eval(expr, dictionaryThisEnv(dict))
+}
+
+// astFieldName is the dictionary key for an AST struct field. Export is
+// renamed because `export` is a keyword and couldn't be read with a dot.
+func astFieldName(name string) string {
+	if name == "Export" {
+		return "exported"
+	}
+	return lowerFirst(name)
+}
+
+func lowerFirst(s string) string {
+	r := []rune(s)
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
+
+// evalEval implements eval(source_or_ast, options?). The code runs in a fresh
+// environment that sees only the `env` bindings, under the caller's security
+// policy narrowed by the read/write/execute/sandbox options.
+func evalEval(args []Object, env *Environment) Object {
+	if len(args) < 1 || len(args) > 2 {
+		return newError("wrong number of arguments to `eval`. got=%d, want=1-2", len(args))
+	}
+
+	var program *ast.Program
+	switch src := args[0].(type) {
+	case *String:
+		var errObj *Error
+		program, errObj = parseSource(src.Value)
+		if errObj != nil {
+			return newError("in eval: %s", errObj.Message)
+		}
+	case *Dictionary:
+		node, err := objectToAST(src)
+		if err != nil {
+			return newError("in eval: invalid AST: %s", err.Error())
+		}
+		switch n := node.(type) {
+		case *ast.Program:
+			program = n
+		case ast.Statement:
+			program = &ast.Program{Statements: []ast.Statement{n}}
+		case ast.Expression:
+			program = &ast.Program{Statements: []ast.Statement{&ast.ExpressionStatement{Expression: n}}}
+		}
+	default:
+		return newError("first argument to `eval` must be a string or AST dictionary, got %s", args[0].Type())
+	}
+
+	evalEnv := NewEnvironment()
+	evalEnv.Filename = env.Filename
+	evalEnv.Logger = env.Logger
+	evalEnv.ModulePaths = env.ModulePaths
+	evalEnv.LockFile = env.LockFile
+	evalEnv.moduleURL = env.moduleURL
+	evalEnv.EnvVars = env.EnvVars
+	evalEnv.Strict = env.Strict
+	evalEnv.Security = env.Security
+
+	if len(args) == 2 {
+		opts, ok := args[1].(*Dictionary)
+		if !ok {
+			return newError("options to `eval` must be a dictionary, got %s", args[1].Type())
+		}
+		if errObj := applyEvalOptions(evalEnv, opts); errObj != nil {
+			return errObj
+		}
+	}
+
+	result := Eval(program, evalEnv)
+	if errObj, ok := result.(*Error); ok {
+		if errObj.Line > 0 {
+			return newError("in eval: line %d, column %d: %s", errObj.Line, errObj.Column, errObj.Message)
+		}
+		return newError("in eval: %s", errObj.Message)
+	}
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+// applyEvalOptions binds `env` variables and narrows the security policy.
+// Options can only take permissions away, never grant them.
+func applyEvalOptions(evalEnv *Environment, opts *Dictionary) *Error {
+	policy := &SecurityPolicy{}
+	if evalEnv.Security != nil {
+		copied := *evalEnv.Security
+		policy = &copied
+	}
+	restricted := false
+
+	for _, key := range dictionaryKeys(opts) {
+		val := dictField(opts, key)
+		if isError(val) {
+			return val.(*Error)
+		}
+		switch key {
+		case "env":
+			vars, ok := val.(*Dictionary)
+			if !ok {
+				return newError("`env` option to `eval` must be a dictionary, got %s", val.Type())
+			}
+			for _, name := range dictionaryKeys(vars) {
+				value := dictField(vars, name)
+				if isError(value) {
+					return value.(*Error)
+				}
+				evalEnv.Set(name, value)
+			}
+		case "sandbox", "read", "write", "execute":
+			b, ok := val.(*Boolean)
+			if !ok {
+				return newError("`%s` option to `eval` must be a boolean, got %s", key, val.Type())
+			}
+			deny := !b.Value
+			if key == "sandbox" {
+				deny = b.Value
+			}
+			if !deny {
+				continue
+			}
+			restricted = true
+			if key == "sandbox" || key == "read" {
+				policy.NoRead = true
+			}
+			if key == "sandbox" || key == "write" {
+				policy.AllowWrite, policy.AllowWriteAll = nil, false
+			}
+			if key == "sandbox" || key == "execute" {
+				policy.AllowExecute, policy.AllowExecuteAll = nil, false
+			}
+			if key == "sandbox" {
+				evalEnv.EnvVars = nil
+			}
+		default:
+			return newError("unknown option `%s` for `eval`", key)
+		}
+	}
+
+	if restricted {
+		evalEnv.Security = policy
+	}
+	return nil
+}
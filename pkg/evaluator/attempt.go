@@ -0,0 +1,48 @@
+package evaluator
+
+// attempt(fn) calls fn and returns {ok, value, error} instead of stopping
+// the script if it fails, so a missing file, failed fetch or database error
+// can be handled:
+//
+//	let {ok, value, error} = attempt(fn() { let s <== JSON(@./settings.json); s })
+//	let settings = if (ok) { value } else { log("using defaults:", error); {} }
+//
+// error is the error's message. The error a generator's yield() returns
+// once its consumer has stopped isn't caught, so a generator can't carry on
+// after it's been told to stop.
+
+// evalAttempt implements attempt(fn)
+func evalAttempt(args []Object, env *Environment) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments to `attempt`. got=%d, want=1", len(args))
+	}
+	switch f := args[0].(type) {
+	case *Function:
+		if f.ParamCount() != 0 {
+			return newError("function passed to `attempt` must take no parameters, got %d", f.ParamCount())
+		}
+	case *Builtin:
+	default:
+		return newError("argument to `attempt` must be a function, got %s", args[0].Type())
+	}
+
+	result := applyFunctionWithEnv(args[0], nil, env)
+	if errObj, ok := result.(*Error); ok {
+		if errObj.stop {
+			return errObj
+		}
+		return NewDictionaryFromObjects(map[string]Object{
+			"ok":    FALSE,
+			"value": NULL,
+			"error": &String{Value: errObj.Message},
+		})
+	}
+	if result == nil {
+		result = NULL
+	}
+	return NewDictionaryFromObjects(map[string]Object{
+		"ok":    TRUE,
+		"value": result,
+		"error": NULL,
+	})
+}
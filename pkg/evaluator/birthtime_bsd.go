@@ -0,0 +1,18 @@
+//go:build darwin || freebsd || netbsd
+
+package evaluator
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// birthTime returns when a file was created
+func birthTime(info os.FileInfo, pathStr string) (time.Time, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(stat.Birthtimespec.Unix()), true
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !windows
+
+package evaluator
+
+import (
+	"os"
+	"time"
+)
+
+// birthTime isn't available on systems that don't record creation times
+func birthTime(info os.FileInfo, pathStr string) (time.Time, bool) {
+	return time.Time{}, false
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package evaluator
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// birthTime returns when a file was created
+func birthTime(info os.FileInfo, pathStr string) (time.Time, bool) {
+	data, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(0, data.CreationTime.Nanoseconds()), true
+}
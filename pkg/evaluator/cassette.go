@@ -0,0 +1,183 @@
+package evaluator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// pars --record cassette.json saves the HTTP requests, SQL statements and
+// commands a run makes, with their results, and pars --replay cassette.json
+// answers them from the recording instead of the network, database or
+// programs. A replayed run that does something the recording doesn't have
+// fails, so tests and CI builds can't quietly reach the outside world.
+//
+// Interactions are matched by what they are: the method and URL of a
+// request, the text and parameters of a statement, or a command line. The
+// same interaction made several times replays its recordings in order.
+
+// Cassette is a recording of a run's HTTP requests, SQL statements and
+// commands
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a recorded request, statement or command and its result
+type Interaction struct {
+	Kind string `json:"kind"` // "http", "sql" or "command"
+	// Key is the request's method and URL, the statement and its parameters,
+	// or the command line
+	Key string `json:"key"`
+
+	Status  int               `json:"status,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+
+	Rows     json.RawMessage `json:"rows,omitempty"` // Query results as JSON
+	Affected int64           `json:"affected,omitempty"`
+	LastID   int64           `json:"lastId,omitempty"`
+
+	Stdout   string `json:"stdout,omitempty"`
+	Stderr   string `json:"stderr,omitempty"`
+	ExitCode int64  `json:"exitCode,omitempty"`
+}
+
+var (
+	cassetteMu sync.Mutex
+	recording  *Cassette
+	replaying  *Cassette
+	replayed   map[string]int
+)
+
+// LoadCassette reads a cassette saved by Save
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid cassette %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Save writes the cassette as JSON
+func (c *Cassette) Save(path string) error {
+	if c.Interactions == nil {
+		c.Interactions = []Interaction{}
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// RecordTo adds the interactions that follow to c, or stops recording if c
+// is nil
+func RecordTo(c *Cassette) {
+	cassetteMu.Lock()
+	defer cassetteMu.Unlock()
+	recording = c
+}
+
+// ReplayFrom answers the interactions that follow from c, or stops
+// replaying if c is nil
+func ReplayFrom(c *Cassette) {
+	cassetteMu.Lock()
+	defer cassetteMu.Unlock()
+	replaying = c
+	replayed = map[string]int{}
+}
+
+// replay returns the next recorded result of an interaction, or nil if
+// nothing is being replayed. It is an error to make an interaction the
+// recording doesn't have.
+func replay(kind, key string) (*Interaction, error) {
+	cassetteMu.Lock()
+	defer cassetteMu.Unlock()
+	if replaying == nil {
+		return nil, nil
+	}
+	seen := 0
+	for i := range replaying.Interactions {
+		in := &replaying.Interactions[i]
+		if in.Kind != kind || in.Key != key {
+			continue
+		}
+		if seen == replayed[kind+" "+key] {
+			replayed[kind+" "+key]++
+			return in, nil
+		}
+		seen++
+	}
+	return nil, fmt.Errorf("replay: no recorded %s for %s", kind, key)
+}
+
+// isRecording reports whether interactions are being recorded
+func isRecording() bool {
+	cassetteMu.Lock()
+	defer cassetteMu.Unlock()
+	return recording != nil
+}
+
+// recordInteraction adds an interaction to the recording, if there is one
+func recordInteraction(in Interaction) {
+	cassetteMu.Lock()
+	defer cassetteMu.Unlock()
+	if recording != nil {
+		recording.Interactions = append(recording.Interactions, in)
+	}
+}
+
+// recordRows records the rows a query returned
+func recordRows(key string, rows []Object) {
+	if !isRecording() {
+		return
+	}
+	data, err := encodeJSON(&Array{Elements: rows})
+	if err != nil {
+		return
+	}
+	recordInteraction(Interaction{Kind: "sql", Key: key, Rows: data})
+}
+
+// rows returns up to limit (-1 for all) of the recorded rows of a query,
+// with dates and durations revived
+func (in *Interaction) rows(limit int) ([]Object, *Error) {
+	var data interface{}
+	if err := json.Unmarshal(in.Rows, &data); err != nil {
+		return nil, newError("query failed: replay: invalid rows for %s: %s", in.Key, err.Error())
+	}
+	arr, ok := reviveTypedValues(jsonToObject(data)).(*Array)
+	if !ok {
+		return nil, newError("query failed: replay: invalid rows for %s", in.Key)
+	}
+	rows := arr.Elements
+	if limit >= 0 && len(rows) > limit {
+		rows = rows[:limit]
+	}
+	return rows, nil
+}
+
+// recordResponse records an HTTP response, returning it with its body
+// ready to read again
+func recordResponse(key string, resp *http.Response) (*http.Response, error) {
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	headers := map[string]string{}
+	for name := range resp.Header {
+		headers[name] = resp.Header.Get(name)
+	}
+	recordInteraction(Interaction{Kind: "http", Key: key, Status: resp.StatusCode, Headers: headers, Body: string(body)})
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
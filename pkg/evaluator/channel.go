@@ -0,0 +1,371 @@
+package evaluator
+
+import (
+	"reflect"
+	"sync"
+	"time"
+)
+
+// channel(n) makes a queue that parallel() calls pass values through, for
+// pipelines where one call produces work as another consumes it:
+//
+//	let pages = channel(10)
+//	let crawl = fn() {
+//	    for (u in urls) { let {data} <=/= text(url(u)); pages.send(data) }
+//	    pages.close()
+//	}
+//	let render = fn() { for (page in pages) { page.length() } }
+//	parallel([crawl, render], fn(task) { task() })
+//
+// send waits while the channel holds n values, and receive waits while it's
+// empty, returning null once it's closed and empty. for loops over a channel
+// receive until it's closed. select(channels) receives from whichever
+// channel has a value first.
+//
+// Only calls made by parallel() can wait: outside it nothing else is running
+// to send or receive, so an operation that would wait is an error instead.
+// When a parallel() call fails, the calls waiting on channels stop with an
+// error, so parallel() doesn't wait for them forever, and when every call is
+// waiting on another, the waits fail with a deadlock error.
+
+// Channel is a bounded queue shared by parallel() calls. The Go channel is
+// never closed, so a send racing a close can't panic; done is closed instead.
+type Channel struct {
+	ch   chan Object
+	done chan struct{}
+	mu   sync.Mutex // Held while closing
+}
+
+func (c *Channel) Type() ObjectType { return CHANNEL_OBJ }
+func (c *Channel) Inspect() string  { return "<channel>" }
+
+// newChannel implements channel(n?)
+func newChannel(args []Object) Object {
+	if len(args) > 1 {
+		return newError("wrong number of arguments to `channel`. got=%d, want=0 or 1", len(args))
+	}
+	size := int64(0)
+	if len(args) == 1 {
+		n, ok := args[0].(*Integer)
+		if !ok || n.Value < 0 {
+			return newError("argument to `channel` must be a non-negative integer, got %s", args[0].Inspect())
+		}
+		size = n.Value
+	}
+	return &Channel{ch: make(chan Object, size), done: make(chan struct{})}
+}
+
+// isClosed reports whether the channel has been closed
+func (c *Channel) isClosed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// parallelCalls counts the goroutines running parallel() calls and how many
+// of them are waiting, on a channel or on a parallel() call of their own, so
+// a program where they all wait on each other fails instead of hanging.
+// progress counts the waits that have ended, which tells a moment when every
+// call is waiting apart from every call staying that way.
+var parallelCalls struct {
+	sync.Mutex
+	running  int
+	waiting  int
+	progress int64
+}
+
+// deadlockCheckInterval is how often waiting calls check for a deadlock. A
+// deadlock is reported when every call is waiting at two checks in a row
+// and no wait has ended between them.
+const deadlockCheckInterval = 50 * time.Millisecond
+
+// parallelCallsChange adjusts the running and waiting counts. A wait ending
+// counts as progress.
+func parallelCallsChange(running, waiting int) {
+	parallelCalls.Lock()
+	defer parallelCalls.Unlock()
+	parallelCalls.running += running
+	parallelCalls.waiting += waiting
+	if waiting < 0 {
+		parallelCalls.progress++
+	}
+}
+
+// parallelCallsStuck reports whether every running call is waiting, and the
+// progress count
+func parallelCallsStuck() (bool, int64) {
+	parallelCalls.Lock()
+	defer parallelCalls.Unlock()
+	return parallelCalls.waiting >= parallelCalls.running, parallelCalls.progress
+}
+
+// waitOn waits until one of cases is ready, for a channel operation that
+// can't go ahead yet, and returns which one as reflect.Select does, or -1 if
+// timeout passes first. Inside parallel() it gives up with an error when
+// another call of the run fails, or, without a timeout, when every
+// parallel() call is waiting and none ever will stop.
+func waitOn(op string, cases []reflect.SelectCase, timeout <-chan time.Time, env *Environment) (int, reflect.Value, bool, *Error) {
+	n := len(cases)
+	var stopped, ticks reflect.Value
+	if timeout != nil {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(timeout)})
+	} else {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv})
+	}
+	if env.parallel != nil {
+		stopped = reflect.ValueOf(env.parallel.stopped)
+		if timeout == nil {
+			ticker := time.NewTicker(deadlockCheckInterval)
+			defer ticker.Stop()
+			ticks = reflect.ValueOf(ticker.C)
+			parallelCallsChange(0, 1)
+			defer parallelCallsChange(0, -1)
+		}
+	}
+	cases = append(cases,
+		reflect.SelectCase{Dir: reflect.SelectRecv, Chan: stopped},
+		reflect.SelectCase{Dir: reflect.SelectRecv, Chan: ticks})
+
+	lastProgress := int64(-1)
+	for {
+		chosen, value, ok := reflect.Select(cases)
+		switch chosen {
+		case n:
+			return -1, value, false, nil
+		case n + 1:
+			env.parallel.interrupted = true
+			return chosen, value, false, newError("%s stopped: another parallel() call failed", op)
+		case n + 2:
+			stuck, progress := parallelCallsStuck()
+			if stuck && progress == lastProgress {
+				return chosen, value, false, newError("deadlock: every parallel() call is waiting on a channel (%s can never finish)", op)
+			}
+			lastProgress = -1
+			if stuck {
+				lastProgress = progress
+			}
+		default:
+			return chosen, value, ok, nil
+		}
+	}
+}
+
+// send adds a value, waiting for room inside parallel()
+func (c *Channel) send(value Object, env *Environment) Object {
+	if c.isClosed() {
+		return newError("cannot send on a closed channel")
+	}
+	select {
+	case c.ch <- value:
+		return NULL
+	default:
+	}
+	if env.parallel == nil {
+		return newError("channel is full: send would wait forever outside parallel()")
+	}
+	chosen, _, _, errObj := waitOn("send", []reflect.SelectCase{
+		{Dir: reflect.SelectSend, Chan: reflect.ValueOf(c.ch), Send: reflect.ValueOf(value)},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.done)},
+	}, nil, env)
+	switch {
+	case errObj != nil:
+		return errObj
+	case chosen == 1:
+		return newError("cannot send on a closed channel")
+	}
+	return NULL
+}
+
+// receive takes the next value, waiting for one inside parallel(). ok is
+// false once the channel is closed and empty.
+func (c *Channel) receive(env *Environment) (value Object, ok bool, errObj *Error) {
+	select {
+	case v := <-c.ch:
+		return v, true, nil
+	default:
+	}
+	if c.isClosed() {
+		return c.drain()
+	}
+	if env.parallel == nil {
+		return nil, false, newError("channel is empty: receive would wait forever outside parallel()")
+	}
+	chosen, v, _, errObj := waitOn("receive", []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.ch)},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.done)},
+	}, nil, env)
+	switch {
+	case errObj != nil:
+		return nil, false, errObj
+	case chosen == 1:
+		return c.drain()
+	}
+	return v.Interface().(Object), true, nil
+}
+
+// drain takes a value left in a closed channel, if there is one
+func (c *Channel) drain() (Object, bool, *Error) {
+	select {
+	case v := <-c.ch:
+		return v, true, nil
+	default:
+		return NULL, false, nil
+	}
+}
+
+// each receives values until the channel is closed, for for loops
+func (c *Channel) each(env *Environment) sequence {
+	return func(visit func(Object) Object) Object {
+		for {
+			value, ok, errObj := c.receive(env)
+			if errObj != nil {
+				return errObj
+			}
+			if !ok {
+				return nil
+			}
+			if result := visit(value); result != nil {
+				return result
+			}
+		}
+	}
+}
+
+// evalChannelMethod evaluates a method call on a Channel
+func evalChannelMethod(c *Channel, method string, args []Object, env *Environment) Object {
+	switch method {
+	case "send":
+		if len(args) != 1 {
+			return newError("wrong number of arguments to `send`. got=%d, want=1", len(args))
+		}
+		return c.send(args[0], env)
+
+	case "receive":
+		if len(args) != 0 {
+			return newError("wrong number of arguments to `receive`. got=%d, want=0", len(args))
+		}
+		value, _, errObj := c.receive(env)
+		if errObj != nil {
+			return errObj
+		}
+		return value
+
+	case "close":
+		if len(args) != 0 {
+			return newError("wrong number of arguments to `close`. got=%d, want=0", len(args))
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.isClosed() {
+			return newError("channel is already closed")
+		}
+		close(c.done)
+		return NULL
+
+	case "isClosed":
+		if len(args) != 0 {
+			return newError("wrong number of arguments to `isClosed`. got=%d, want=0", len(args))
+		}
+		return nativeBoolToParsBoolean(c.isClosed())
+
+	case "length":
+		if len(args) != 0 {
+			return newError("wrong number of arguments to `length`. got=%d, want=0", len(args))
+		}
+		return &Integer{Value: int64(len(c.ch))}
+
+	default:
+		return newError("unknown method '%s' for channel", method)
+	}
+}
+
+// evalSelect implements select(channels, options?): it receives from
+// whichever channel has a value first and returns {index, value, ok}, with
+// ok false if that channel was closed and empty. With a timeout option it
+// returns null if nothing arrives in time.
+func evalSelect(args []Object, env *Environment) Object {
+	if len(args) < 1 || len(args) > 2 {
+		return newError("wrong number of arguments to `select`. got=%d, want=1 or 2", len(args))
+	}
+	arr, ok := args[0].(*Array)
+	if !ok || len(arr.Elements) == 0 {
+		return newError("first argument to `select` must be a non-empty array of channels, got %s", args[0].Inspect())
+	}
+	channels := make([]*Channel, len(arr.Elements))
+	for i, elem := range arr.Elements {
+		c, ok := elem.(*Channel)
+		if !ok {
+			return newError("first argument to `select` must be an array of channels, got %s at index %d", elem.Type(), i)
+		}
+		channels[i] = c
+	}
+
+	var timeout <-chan time.Time
+	if len(args) == 2 {
+		opts, ok := args[1].(*Dictionary)
+		if !ok {
+			return newError("second argument to `select` must be a dictionary, got %s", args[1].Type())
+		}
+		if expr, ok := opts.Pairs["timeout"]; ok {
+			dur, ok := Eval(expr, opts.Env).(*Duration)
+			if !ok {
+				return newError("`timeout` option for `select` must be a duration")
+			}
+			d, err := dur.toGo()
+			if err != nil || d < 0 {
+				return newError("`timeout` option for `select` must be a positive duration without months or years")
+			}
+			timeout = time.After(d)
+		}
+	}
+
+	// Channels with a value waiting are taken in order; closed ones only
+	// once none has a value, as receive does
+	for i, c := range channels {
+		select {
+		case v := <-c.ch:
+			return selectResult(i, v, true)
+		default:
+		}
+	}
+	for i, c := range channels {
+		if c.isClosed() {
+			return selectResult(i, NULL, false)
+		}
+	}
+	if env.parallel == nil && timeout == nil {
+		return newError("no channel is ready: select would wait forever outside parallel()")
+	}
+
+	// Wait on each channel's values and on its closing
+	cases := make([]reflect.SelectCase, 0, 2*len(channels))
+	for _, c := range channels {
+		cases = append(cases,
+			reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.ch)},
+			reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.done)})
+	}
+	chosen, value, _, errObj := waitOn("select", cases, timeout, env)
+	switch {
+	case errObj != nil:
+		return errObj
+	case chosen < 0:
+		return NULL
+	case chosen%2 == 0:
+		return selectResult(chosen/2, value.Interface().(Object), true)
+	default:
+		v, ok, _ := channels[chosen/2].drain()
+		return selectResult(chosen/2, v, ok)
+	}
+}
+
+// selectResult returns the dictionary select() returns
+func selectResult(index int, value Object, ok bool) Object {
+	return NewDictionaryFromObjects(map[string]Object{
+		"index": &Integer{Value: int64(index)},
+		"value": value,
+		"ok":    nativeBoolToParsBoolean(ok),
+	})
+}
@@ -0,0 +1,456 @@
+package evaluator
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/sambeau/parsley/pkg/ast"
+	"github.com/sambeau/parsley/pkg/lexer"
+)
+
+// color(value) makes a color from a CSS hex, rgb(), hsl() or named color
+// string, from {r, g, b, a} or from red, green and blue channels. Colors are
+// dictionaries with __type "color", so their fields can be read directly,
+// and they print as hex:
+//
+//	let brand = color("#3366ff")
+//	let theme = {
+//	    primary: brand,
+//	    hover: brand.darken(0.1),
+//	    muted: brand.mix("white", 0.6),
+//	    shadow: brand.alpha(0.25).rgb()
+//	}
+//	brand.contrastRatio("white") >= 4.5    // readable text on brand?
+
+// rgba is a color with channels from 0 to 255 and alpha from 0 to 1
+type rgba struct {
+	r, g, b, a float64
+}
+
+// namedColors are the CSS basic color keywords
+var namedColors = map[string]rgba{
+	"black":       {0, 0, 0, 1},
+	"silver":      {192, 192, 192, 1},
+	"gray":        {128, 128, 128, 1},
+	"grey":        {128, 128, 128, 1},
+	"white":       {255, 255, 255, 1},
+	"maroon":      {128, 0, 0, 1},
+	"red":         {255, 0, 0, 1},
+	"purple":      {128, 0, 128, 1},
+	"fuchsia":     {255, 0, 255, 1},
+	"green":       {0, 128, 0, 1},
+	"lime":        {0, 255, 0, 1},
+	"olive":       {128, 128, 0, 1},
+	"yellow":      {255, 255, 0, 1},
+	"navy":        {0, 0, 128, 1},
+	"blue":        {0, 0, 255, 1},
+	"teal":        {0, 128, 128, 1},
+	"aqua":        {0, 255, 255, 1},
+	"orange":      {255, 165, 0, 1},
+	"transparent": {0, 0, 0, 0},
+}
+
+// isColorDict checks if a dictionary is a color
+func isColorDict(dict *Dictionary) bool {
+	if typeExpr, ok := dict.Pairs["__type"]; ok {
+		if strLit, ok := typeExpr.(*ast.StringLiteral); ok {
+			return strLit.Value == "color"
+		}
+	}
+	return false
+}
+
+// colorToDict converts a color to a color dictionary, rounding its channels
+func colorToDict(c rgba) *Dictionary {
+	dict := NewDictionaryFromObjects(map[string]Object{
+		"r": &Integer{Value: int64(math.Round(clamp(c.r, 0, 255)))},
+		"g": &Integer{Value: int64(math.Round(clamp(c.g, 0, 255)))},
+		"b": &Integer{Value: int64(math.Round(clamp(c.b, 0, 255)))},
+		"a": &Float{Value: math.Round(clamp(c.a, 0, 1)*1000) / 1000},
+	})
+	dict.Pairs["__type"] = &ast.StringLiteral{
+		Token: lexer.Token{Type: lexer.STRING, Literal: "color"},
+		Value: "color",
+	}
+	return dict
+}
+
+// colorFromDict reads a color from a dictionary with r, g, b and optional a
+func colorFromDict(dict *Dictionary) (rgba, error) {
+	c := rgba{a: 1}
+	for _, ch := range []struct {
+		key string
+		dst *float64
+		max float64
+	}{{"r", &c.r, 255}, {"g", &c.g, 255}, {"b", &c.b, 255}, {"a", &c.a, 1}} {
+		expr, ok := dict.Pairs[ch.key]
+		if !ok {
+			if ch.key == "a" {
+				continue
+			}
+			return c, fmt.Errorf("missing `%s` channel", ch.key)
+		}
+		v, ok := numberValue(Eval(expr, dict.Env))
+		if !ok || v < 0 || v > ch.max {
+			return c, fmt.Errorf("`%s` channel must be a number from 0 to %g", ch.key, ch.max)
+		}
+		*ch.dst = v
+	}
+	return c, nil
+}
+
+// numberValue returns the value of an integer or float
+func numberValue(obj Object) (float64, bool) {
+	switch n := obj.(type) {
+	case *Integer:
+		return float64(n.Value), true
+	case *Float:
+		return n.Value, true
+	}
+	return 0, false
+}
+
+func clamp(v, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, v))
+}
+
+// parseColor parses a CSS hex, rgb(), hsl() or named color
+func parseColor(s string) (rgba, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	if c, ok := namedColors[s]; ok {
+		return c, nil
+	}
+
+	if hex, ok := strings.CutPrefix(s, "#"); ok {
+		if len(hex) == 3 || len(hex) == 4 {
+			var long strings.Builder
+			for _, ch := range hex {
+				long.WriteRune(ch)
+				long.WriteRune(ch)
+			}
+			hex = long.String()
+		}
+		if len(hex) != 6 && len(hex) != 8 {
+			return rgba{}, fmt.Errorf("hex colors have 3, 4, 6 or 8 digits")
+		}
+		n, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil {
+			return rgba{}, fmt.Errorf("invalid hex digits %q", hex)
+		}
+		if len(hex) == 6 {
+			n = n<<8 | 0xff
+		}
+		return rgba{float64(n >> 24), float64(n >> 16 & 0xff), float64(n >> 8 & 0xff), float64(n&0xff) / 255}, nil
+	}
+
+	open := strings.Index(s, "(")
+	if open < 0 || !strings.HasSuffix(s, ")") {
+		return rgba{}, fmt.Errorf("expected a hex, rgb(), hsl() or named color")
+	}
+	fn := s[:open]
+	parts := strings.Fields(strings.NewReplacer(",", " ", "/", " ").Replace(s[open+1 : len(s)-1]))
+	if len(parts) != 3 && len(parts) != 4 {
+		return rgba{}, fmt.Errorf("%s() takes 3 or 4 values", fn)
+	}
+
+	vals := make([]float64, 4)
+	vals[3] = 1
+	for i, p := range parts {
+		percent := strings.HasSuffix(p, "%")
+		p = strings.TrimSuffix(strings.TrimSuffix(p, "%"), "deg")
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return rgba{}, fmt.Errorf("invalid %s() value %q", fn, parts[i])
+		}
+		switch {
+		case i == 3 && percent:
+			v /= 100
+		case fn == "rgb" || fn == "rgba":
+			if percent {
+				v *= 2.55
+			}
+		case i > 0:
+			// hsl() saturation and lightness are percentages, with or without %
+			v /= 100
+		}
+		vals[i] = v
+	}
+
+	switch fn {
+	case "rgb", "rgba":
+		return rgba{clamp(vals[0], 0, 255), clamp(vals[1], 0, 255), clamp(vals[2], 0, 255), clamp(vals[3], 0, 1)}, nil
+	case "hsl", "hsla":
+		c := hslToRGB(vals[0], clamp(vals[1], 0, 1), clamp(vals[2], 0, 1))
+		c.a = clamp(vals[3], 0, 1)
+		return c, nil
+	}
+	return rgba{}, fmt.Errorf("unknown color function %s()", fn)
+}
+
+// toHSL returns a color's hue (0-360), saturation and lightness (0-1)
+func (c rgba) toHSL() (h, s, l float64) {
+	r, g, b := c.r/255, c.g/255, c.b/255
+	hi, lo := math.Max(r, math.Max(g, b)), math.Min(r, math.Min(g, b))
+	l = (hi + lo) / 2
+	if hi == lo {
+		return 0, 0, l
+	}
+	d := hi - lo
+	if l > 0.5 {
+		s = d / (2 - hi - lo)
+	} else {
+		s = d / (hi + lo)
+	}
+	switch hi {
+	case r:
+		h = math.Mod((g-b)/d+6, 6)
+	case g:
+		h = (b-r)/d + 2
+	default:
+		h = (r-g)/d + 4
+	}
+	return h * 60, s, l
+}
+
+// hslToRGB converts hue (degrees), saturation and lightness to an opaque color
+func hslToRGB(h, s, l float64) rgba {
+	h = math.Mod(math.Mod(h, 360)+360, 360)
+	c := (1 - math.Abs(2*l-1)) * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := l - c/2
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g = c, x
+	case h < 120:
+		r, g = x, c
+	case h < 180:
+		g, b = c, x
+	case h < 240:
+		g, b = x, c
+	case h < 300:
+		r, b = x, c
+	default:
+		r, b = c, x
+	}
+	return rgba{(r + m) * 255, (g + m) * 255, (b + m) * 255, 1}
+}
+
+// luminance returns a color's WCAG relative luminance
+func (c rgba) luminance() float64 {
+	linear := func(v float64) float64 {
+		v /= 255
+		if v <= 0.03928 {
+			return v / 12.92
+		}
+		return math.Pow((v+0.055)/1.055, 2.4)
+	}
+	return 0.2126*linear(c.r) + 0.7152*linear(c.g) + 0.0722*linear(c.b)
+}
+
+// hex formats a color as #rrggbb, or #rrggbbaa if it isn't opaque
+func (c rgba) hex() string {
+	s := fmt.Sprintf("#%02x%02x%02x", int(math.Round(c.r)), int(math.Round(c.g)), int(math.Round(c.b)))
+	if c.a < 1 {
+		s += fmt.Sprintf("%02x", int(math.Round(c.a*255)))
+	}
+	return s
+}
+
+// colorDictToString converts a color dictionary to its hex form
+func colorDictToString(dict *Dictionary) string {
+	c, err := colorFromDict(dict)
+	if err != nil {
+		return dict.Inspect()
+	}
+	return c.hex()
+}
+
+// colorArg converts a color or color string argument to a color
+func colorArg(obj Object, method string) (rgba, *Error) {
+	switch v := obj.(type) {
+	case *Dictionary:
+		if c, err := colorFromDict(v); err == nil {
+			return c, nil
+		}
+	case *String:
+		c, err := parseColor(v.Value)
+		if err != nil {
+			return rgba{}, newError("argument to `%s`: %s", method, err.Error())
+		}
+		return c, nil
+	}
+	return rgba{}, newError("argument to `%s` must be a color, got %s", method, typeName(obj))
+}
+
+// amountArg reads a number from 0 to 1
+func amountArg(obj Object, method string) (float64, *Error) {
+	v, ok := numberValue(obj)
+	if !ok || v < 0 || v > 1 {
+		return 0, newError("argument to `%s` must be a number from 0 to 1, got %s", method, objectToPrintString(obj))
+	}
+	return v, nil
+}
+
+// evalColor implements color()
+func evalColor(args []Object) Object {
+	switch len(args) {
+	case 1:
+		switch v := args[0].(type) {
+		case *String:
+			c, err := parseColor(v.Value)
+			if err != nil {
+				return newError("color(): %s", err.Error())
+			}
+			return colorToDict(c)
+		case *Dictionary:
+			c, err := colorFromDict(v)
+			if err != nil {
+				return newError("color(): %s", err.Error())
+			}
+			return colorToDict(c)
+		}
+		return newError("argument to `color` must be a string or dictionary, got %s", typeName(args[0]))
+	case 3, 4:
+		c := rgba{a: 1}
+		for i, dst := range []*float64{&c.r, &c.g, &c.b, &c.a}[:len(args)] {
+			v, ok := numberValue(args[i])
+			limit := 255.0
+			if i == 3 {
+				limit = 1
+			}
+			if !ok || v < 0 || v > limit {
+				return newError("color(): channel %d must be a number from 0 to %g", i+1, limit)
+			}
+			*dst = v
+		}
+		return colorToDict(c)
+	}
+	return newError("wrong number of arguments to `color`. got=%d, want=1, 3 or 4", len(args))
+}
+
+// evalColorMethod evaluates a method call on a color dictionary
+func evalColorMethod(dict *Dictionary, method string, args []Object) Object {
+	c, err := colorFromDict(dict)
+	if err != nil {
+		return newError("invalid color: %s", err.Error())
+	}
+
+	wantArgs := func(min, max int) *Error {
+		if len(args) < min || len(args) > max {
+			if min == max {
+				return newError("wrong number of arguments to `%s`. got=%d, want=%d", method, len(args), min)
+			}
+			return newError("wrong number of arguments to `%s`. got=%d, want=%d-%d", method, len(args), min, max)
+		}
+		return nil
+	}
+
+	switch method {
+	case "toDict":
+		if errObj := wantArgs(0, 0); errObj != nil {
+			return errObj
+		}
+		return dict
+
+	case "hex":
+		if errObj := wantArgs(0, 0); errObj != nil {
+			return errObj
+		}
+		return &String{Value: c.hex()}
+
+	case "rgb":
+		if errObj := wantArgs(0, 0); errObj != nil {
+			return errObj
+		}
+		r, g, b := math.Round(c.r), math.Round(c.g), math.Round(c.b)
+		if c.a < 1 {
+			return &String{Value: fmt.Sprintf("rgba(%g, %g, %g, %g)", r, g, b, c.a)}
+		}
+		return &String{Value: fmt.Sprintf("rgb(%g, %g, %g)", r, g, b)}
+
+	case "hsl":
+		if errObj := wantArgs(0, 0); errObj != nil {
+			return errObj
+		}
+		h, s, l := c.toHSL()
+		h, s, l = math.Round(h), math.Round(s*100), math.Round(l*100)
+		if c.a < 1 {
+			return &String{Value: fmt.Sprintf("hsla(%g, %g%%, %g%%, %g)", h, s, l, c.a)}
+		}
+		return &String{Value: fmt.Sprintf("hsl(%g, %g%%, %g%%)", h, s, l)}
+
+	case "lighten", "darken":
+		// lighten(amount) and darken(amount) move the HSL lightness by amount
+		if errObj := wantArgs(1, 1); errObj != nil {
+			return errObj
+		}
+		amount, errObj := amountArg(args[0], method)
+		if errObj != nil {
+			return errObj
+		}
+		if method == "darken" {
+			amount = -amount
+		}
+		h, s, l := c.toHSL()
+		out := hslToRGB(h, s, clamp(l+amount, 0, 1))
+		out.a = c.a
+		return colorToDict(out)
+
+	case "alpha":
+		if errObj := wantArgs(1, 1); errObj != nil {
+			return errObj
+		}
+		a, errObj := amountArg(args[0], method)
+		if errObj != nil {
+			return errObj
+		}
+		c.a = a
+		return colorToDict(c)
+
+	case "mix":
+		// mix(other, weight?) - weight is how much of other to use (default 0.5)
+		if errObj := wantArgs(1, 2); errObj != nil {
+			return errObj
+		}
+		other, errObj := colorArg(args[0], method)
+		if errObj != nil {
+			return errObj
+		}
+		weight := 0.5
+		if len(args) == 2 {
+			if weight, errObj = amountArg(args[1], method); errObj != nil {
+				return errObj
+			}
+		}
+		lerp := func(a, b float64) float64 { return a + (b-a)*weight }
+		return colorToDict(rgba{lerp(c.r, other.r), lerp(c.g, other.g), lerp(c.b, other.b), lerp(c.a, other.a)})
+
+	case "luminance":
+		if errObj := wantArgs(0, 0); errObj != nil {
+			return errObj
+		}
+		return &Float{Value: c.luminance()}
+
+	case "contrastRatio":
+		// contrastRatio(other) - WCAG contrast ratio, from 1 to 21
+		if errObj := wantArgs(1, 1); errObj != nil {
+			return errObj
+		}
+		other, errObj := colorArg(args[0], method)
+		if errObj != nil {
+			return errObj
+		}
+		l1, l2 := c.luminance(), other.luminance()
+		if l1 < l2 {
+			l1, l2 = l2, l1
+		}
+		return &Float{Value: math.Round((l1+0.05)/(l2+0.05)*100) / 100}
+
+	default:
+		return newError("unknown method '%s' for color", method)
+	}
+}
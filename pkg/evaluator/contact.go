@@ -0,0 +1,401 @@
+package evaluator
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+
+	"github.com/sambeau/parsley/pkg/phone"
+	"github.com/sambeau/parsley/pkg/postal"
+)
+
+// Helpers for the contact details people type into forms. Phone numbers are
+// parsed for a home country, so national numbers ("020 7946 0018") and
+// international ones ("+44 20 7946 0018") both work, and are written the way
+// that country writes them:
+//
+//	formatPhone("+15551234567", "US")                     // "(555) 123-4567"
+//	formatPhone("020 7946 0018", "GB", {format: "e164"})  // "+442079460018"
+//	validatePhone(form.phone, "GB")
+//	formatPostalCode("sw1a1aa", "GB")                     // "SW1A 1AA"
+//	validatePostalCode(form.zip, "US")
+//
+// Email addresses can be checked and normalized, and written into pages in a
+// form scrapers don't recognize:
+//
+//	isEmail(form.email)
+//	normalizeEmail(" Ada.Lovelace+news@GoogleMail.com ")  // "adalovelace@gmail.com"
+//	obfuscateEmail("ada@example.com", {style: "js"})
+
+// phoneCountryArg resolves a country code argument to its numbering plan
+func phoneCountryArg(obj Object, fnName string) (*phone.Country, *Error) {
+	code, ok := obj.(*String)
+	if !ok {
+		return nil, newError("country for `%s` must be a string, got %s", fnName, obj.Type())
+	}
+	c, ok := phone.Lookup(code.Value)
+	if !ok {
+		return nil, newError("`%s`: unknown country %q (available: %s)", fnName, code.Value, strings.Join(phone.Countries(), ", "))
+	}
+	return c, nil
+}
+
+// postalCountryArg resolves a country code argument to its postal code formats
+func postalCountryArg(obj Object, fnName string) (*postal.Country, *Error) {
+	code, ok := obj.(*String)
+	if !ok {
+		return nil, newError("second argument to `%s` must be a string, got %s", fnName, obj.Type())
+	}
+	c, ok := postal.Lookup(code.Value)
+	if !ok {
+		return nil, newError("`%s`: unknown country %q (available: %s)", fnName, code.Value, strings.Join(postal.Countries(), ", "))
+	}
+	return c, nil
+}
+
+// evalFormatPhone implements formatPhone(number, country?, options?). A
+// number of the country is written in its national format and any other in
+// international format, unless the format option says otherwise; a number
+// that can't be read is null.
+func evalFormatPhone(args []Object) Object {
+	if len(args) < 1 || len(args) > 3 {
+		return newError("wrong number of arguments to `formatPhone`. got=%d, want=1 to 3", len(args))
+	}
+	number, ok := args[0].(*String)
+	if !ok {
+		return newError("first argument to `formatPhone` must be a string, got %s", args[0].Type())
+	}
+
+	rest := args[1:]
+	var home *phone.Country
+	if len(rest) > 0 {
+		if _, isOpts := rest[0].(*Dictionary); !isOpts {
+			c, errObj := phoneCountryArg(rest[0], "formatPhone")
+			if errObj != nil {
+				return errObj
+			}
+			home, rest = c, rest[1:]
+		}
+	}
+
+	style := phone.Style("")
+	if len(rest) > 0 {
+		opts, ok := rest[0].(*Dictionary)
+		if !ok || len(rest) > 1 {
+			return newError("options for `formatPhone` must be a dictionary, got %s", rest[0].Type())
+		}
+		if formatExpr, ok := opts.Pairs["format"]; ok {
+			formatStr, ok := Eval(formatExpr, opts.Env).(*String)
+			if !ok {
+				return newError("`format` option for `formatPhone` must be a string")
+			}
+			switch phone.Style(formatStr.Value) {
+			case phone.StyleNational, phone.StyleInternational, phone.StyleE164:
+				style = phone.Style(formatStr.Value)
+			default:
+				return newError("invalid format %q for `formatPhone`, use 'national', 'international' or 'e164'", formatStr.Value)
+			}
+		}
+	}
+
+	n, err := phone.Parse(number.Value, home)
+	if err != nil {
+		return NULL
+	}
+	if style == "" {
+		style = phone.StyleInternational
+		if n.Country == home {
+			style = phone.StyleNational
+		}
+	}
+	return &String{Value: n.Format(style)}
+}
+
+// evalValidatePhone implements validatePhone(number, country?), which is
+// true if the number is in use in its country's numbering plan
+func evalValidatePhone(args []Object) Object {
+	if len(args) < 1 || len(args) > 2 {
+		return newError("wrong number of arguments to `validatePhone`. got=%d, want=1 or 2", len(args))
+	}
+	number, ok := args[0].(*String)
+	if !ok {
+		return newError("first argument to `validatePhone` must be a string, got %s", args[0].Type())
+	}
+	var home *phone.Country
+	if len(args) == 2 {
+		c, errObj := phoneCountryArg(args[1], "validatePhone")
+		if errObj != nil {
+			return errObj
+		}
+		home = c
+	}
+
+	n, err := phone.Parse(number.Value, home)
+	return nativeBoolToParsBoolean(err == nil && n.Valid())
+}
+
+// evalFormatPostalCode implements formatPostalCode(code, country), which is
+// null if the code isn't valid in the country
+func evalFormatPostalCode(args []Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments to `formatPostalCode`. got=%d, want=2", len(args))
+	}
+	code, ok := args[0].(*String)
+	if !ok {
+		return newError("first argument to `formatPostalCode` must be a string, got %s", args[0].Type())
+	}
+	c, errObj := postalCountryArg(args[1], "formatPostalCode")
+	if errObj != nil {
+		return errObj
+	}
+	formatted, ok := c.Format(code.Value)
+	if !ok {
+		return NULL
+	}
+	return &String{Value: formatted}
+}
+
+// evalValidatePostalCode implements validatePostalCode(code, country)
+func evalValidatePostalCode(args []Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments to `validatePostalCode`. got=%d, want=2", len(args))
+	}
+	code, ok := args[0].(*String)
+	if !ok {
+		return newError("first argument to `validatePostalCode` must be a string, got %s", args[0].Type())
+	}
+	c, errObj := postalCountryArg(args[1], "validatePostalCode")
+	if errObj != nil {
+		return errObj
+	}
+	return nativeBoolToParsBoolean(c.Valid(code.Value))
+}
+
+// emailAtomChars are the punctuation characters allowed unquoted in the local
+// part of an address (RFC 5322 atext)
+const emailAtomChars = "!#$%&'*+/=?^_`{|}~-"
+
+// splitEmail splits an email address into its local part and domain,
+// reporting false if it isn't an address. Local parts are dot-separated atoms
+// or a quoted string of up to 64 bytes; domains are at least two labels of
+// letters, digits and hyphens, with a top-level domain that isn't numeric.
+// Letters outside ASCII are allowed, as in internationalized addresses.
+func splitEmail(s string) (string, string, bool) {
+	at := strings.LastIndex(s, "@")
+	if at < 1 || len(s) > 254 {
+		return "", "", false
+	}
+	local, domain := s[:at], s[at+1:]
+	if len(local) > 64 || !validEmailLocal(local) || !validEmailDomain(domain) {
+		return "", "", false
+	}
+	return local, domain, true
+}
+
+// validEmailLocal reports whether s is a valid local part
+func validEmailLocal(s string) bool {
+	if len(s) >= 2 && strings.HasPrefix(s, `"`) && strings.HasSuffix(s, `"`) {
+		escaped := false
+		for _, r := range s[1 : len(s)-1] {
+			switch {
+			case escaped:
+				escaped = false
+			case r == '\\':
+				escaped = true
+			case r == '"' || r < ' ' || r == 0x7f:
+				return false
+			}
+		}
+		return !escaped
+	}
+
+	for _, atom := range strings.Split(s, ".") {
+		if atom == "" {
+			return false
+		}
+		for _, r := range atom {
+			if r < 0x80 && !isASCIIAlphanumeric(r) && !strings.ContainsRune(emailAtomChars, r) {
+				return false
+			}
+			if r >= 0x80 && !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// validEmailDomain reports whether s is a domain name an address can use
+func validEmailDomain(s string) bool {
+	labels := strings.Split(s, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+		for _, r := range label {
+			if r != '-' && !isASCIIAlphanumeric(r) && (r < 0x80 || !(unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r))) {
+				return false
+			}
+		}
+	}
+	tld := labels[len(labels)-1]
+	return strings.TrimFunc(tld, unicode.IsDigit) != ""
+}
+
+// isASCIIAlphanumeric reports whether r is an ASCII letter or digit
+func isASCIIAlphanumeric(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+}
+
+// evalIsEmail implements isEmail(str)
+func evalIsEmail(args []Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments to `isEmail`. got=%d, want=1", len(args))
+	}
+	str, ok := args[0].(*String)
+	if !ok {
+		return FALSE
+	}
+	_, _, ok = splitEmail(strings.TrimSpace(str.Value))
+	return nativeBoolToParsBoolean(ok)
+}
+
+// evalNormalizeEmail implements normalizeEmail(str, options?). Addresses are
+// trimmed and lowercased (except quoted local parts); Gmail addresses lose
+// their dots and +tags, as Gmail ignores them, and the removeTags option
+// drops +tags from every address. Anything that isn't an address is null.
+func evalNormalizeEmail(args []Object) Object {
+	if len(args) < 1 || len(args) > 2 {
+		return newError("wrong number of arguments to `normalizeEmail`. got=%d, want=1 or 2", len(args))
+	}
+	str, ok := args[0].(*String)
+	if !ok {
+		return newError("first argument to `normalizeEmail` must be a string, got %s", args[0].Type())
+	}
+	removeTags := false
+	if len(args) == 2 {
+		opts, ok := args[1].(*Dictionary)
+		if !ok {
+			return newError("second argument to `normalizeEmail` must be a dictionary, got %s", args[1].Type())
+		}
+		if expr, ok := opts.Pairs["removeTags"]; ok {
+			b, ok := Eval(expr, opts.Env).(*Boolean)
+			if !ok {
+				return newError("`removeTags` option for `normalizeEmail` must be a boolean")
+			}
+			removeTags = b.Value
+		}
+	}
+
+	local, domain, ok := splitEmail(strings.TrimSpace(str.Value))
+	if !ok {
+		return NULL
+	}
+	domain = strings.ToLower(domain)
+	if !strings.HasPrefix(local, `"`) {
+		local = strings.ToLower(local)
+		if domain == "gmail.com" || domain == "googlemail.com" {
+			domain = "gmail.com"
+			local = strings.ReplaceAll(local, ".", "")
+			removeTags = true
+		}
+		if i := strings.Index(local, "+"); removeTags && i > 0 {
+			local = local[:i]
+		}
+	}
+	return &String{Value: local + "@" + domain}
+}
+
+// evalObfuscateEmail implements obfuscateEmail(address, options?), which
+// returns a mailto: link that's hidden from scrapers. The "entities" style
+// (the default) writes every character as an HTML character reference; the
+// "js" style builds the link with a script, with the address spelled out
+// ("ada [at] example [dot] com") for readers without JavaScript. link: false
+// gives just the address, and text sets the link's content.
+func evalObfuscateEmail(args []Object) Object {
+	if len(args) < 1 || len(args) > 2 {
+		return newError("wrong number of arguments to `obfuscateEmail`. got=%d, want=1 or 2", len(args))
+	}
+	str, ok := args[0].(*String)
+	if !ok {
+		return newError("first argument to `obfuscateEmail` must be a string, got %s", args[0].Type())
+	}
+	address := strings.TrimSpace(str.Value)
+	if _, _, ok := splitEmail(address); !ok {
+		return newError("obfuscateEmail(): %q is not an email address", str.Value)
+	}
+
+	style, link, text := "entities", true, ""
+	if len(args) == 2 {
+		opts, ok := args[1].(*Dictionary)
+		if !ok {
+			return newError("second argument to `obfuscateEmail` must be a dictionary, got %s", args[1].Type())
+		}
+		if expr, ok := opts.Pairs["style"]; ok {
+			s, ok := Eval(expr, opts.Env).(*String)
+			if !ok || (s.Value != "entities" && s.Value != "js") {
+				return newError("`style` option for `obfuscateEmail` must be 'entities' or 'js'")
+			}
+			style = s.Value
+		}
+		if expr, ok := opts.Pairs["link"]; ok {
+			b, ok := Eval(expr, opts.Env).(*Boolean)
+			if !ok {
+				return newError("`link` option for `obfuscateEmail` must be a boolean")
+			}
+			link = b.Value
+		}
+		if expr, ok := opts.Pairs["text"]; ok {
+			s, ok := Eval(expr, opts.Env).(*String)
+			if !ok {
+				return newError("`text` option for `obfuscateEmail` must be a string")
+			}
+			text = s.Value
+		}
+	}
+
+	if style == "js" {
+		content := html.EscapeString(address)
+		if text != "" {
+			content = text
+		}
+		if link {
+			content = `<a href="mailto:` + html.EscapeString(address) + `">` + content + `</a>`
+		}
+		codes := make([]string, 0, len(content))
+		for _, r := range content {
+			codes = append(codes, fmt.Sprint(r))
+		}
+		spelled := strings.NewReplacer("@", " [at] ", ".", " [dot] ").Replace(address)
+		return &String{Value: `<script>document.currentScript.insertAdjacentHTML("beforebegin",String.fromCodePoint(` +
+			strings.Join(codes, ",") + `))</script><noscript>` + html.EscapeString(spelled) + `</noscript>`}
+	}
+
+	content := htmlCharacterReferences(address)
+	if text != "" {
+		content = text
+	}
+	if link {
+		content = `<a href="` + htmlCharacterReferences("mailto:"+address) + `">` + content + `</a>`
+	}
+	return &String{Value: content}
+}
+
+// htmlCharacterReferences writes every character of s as a character
+// reference, alternating decimal and hexadecimal so the output doesn't match
+// a simple pattern
+func htmlCharacterReferences(s string) string {
+	var b strings.Builder
+	for i, r := range []rune(s) {
+		if i%2 == 0 {
+			fmt.Fprintf(&b, "&#%d;", r)
+		} else {
+			fmt.Fprintf(&b, "&#x%x;", r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,410 @@
+package evaluator
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// css(rules) writes nested dictionaries as a stylesheet. Keys holding
+// dictionaries are selectors, nested ones are joined to their parent (with &
+// standing for the parent), and keys starting with @ are at-rules. Other keys
+// are declarations, with camelCase names written in kebab-case:
+//
+//	css({
+//	    ":root": {"--brand": color("#3366ff")},
+//	    ".card": {
+//	        padding: "1rem",
+//	        "&:hover": {borderColor: "var(--brand)"},
+//	        "@media (max-width: 600px)": {padding: "0.5rem"}
+//	    }
+//	})
+//
+// tokens(source, options?) turns a design token file into CSS custom
+// properties, a JSON snapshot and var() references for css().
+
+// cssIndent is the indent for each level of a stylesheet
+const cssIndent = "  "
+
+// kebabCase converts a camelCase name to kebab-case. A leading capital
+// gives a vendor prefix (WebkitTransition is -webkit-transition).
+func kebabCase(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if unicode.IsUpper(r) {
+			b.WriteByte('-')
+			b.WriteRune(unicode.ToLower(r))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// cssProperty converts a declaration key to a CSS property name
+func cssProperty(key string) string {
+	if strings.HasPrefix(key, "--") {
+		return key
+	}
+	return kebabCase(key)
+}
+
+// cssValue formats a declaration value. It reports false for null and
+// false, whose declarations are left out.
+func cssValue(obj Object) (string, bool) {
+	switch v := rangeAsArray(obj).(type) {
+	case *Null:
+		return "", false
+	case *Boolean:
+		if !v.Value {
+			return "", false
+		}
+	case *Array:
+		parts := make([]string, 0, len(v.Elements))
+		for _, elem := range v.Elements {
+			if s, ok := cssValue(elem); ok {
+				parts = append(parts, s)
+			}
+		}
+		return strings.Join(parts, ", "), len(parts) > 0
+	}
+	return objectToPrintString(obj), true
+}
+
+// isCSSBlock reports whether a value is a block of rules or declarations:
+// a plain dictionary, or an array of them
+func isCSSBlock(obj Object) bool {
+	switch v := obj.(type) {
+	case *Dictionary:
+		return typeName(v) == "dict"
+	case *Array:
+		if len(v.Elements) == 0 {
+			return false
+		}
+		for _, elem := range v.Elements {
+			if !isCSSBlock(elem) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// nestSelector joins a nested selector to its parent. Each side can be a
+// comma-separated list.
+func nestSelector(parent, child string) string {
+	if parent == "" {
+		return child
+	}
+	var out []string
+	for _, p := range strings.Split(parent, ",") {
+		p = strings.TrimSpace(p)
+		for _, c := range strings.Split(child, ",") {
+			c = strings.TrimSpace(c)
+			if strings.Contains(c, "&") {
+				out = append(out, strings.ReplaceAll(c, "&", p))
+			} else {
+				out = append(out, p+" "+c)
+			}
+		}
+	}
+	return strings.Join(out, ", ")
+}
+
+// writeCSSBlock writes a block's declarations under selector, then its
+// nested rules, then its at-rules. Arrays of blocks are written in order,
+// since dictionaries have no order of their own.
+func writeCSSBlock(b *strings.Builder, selector string, block Object, depth int, inAtRule bool) *Error {
+	if arr, ok := block.(*Array); ok {
+		for _, elem := range arr.Elements {
+			if errObj := writeCSSBlock(b, selector, elem, depth, inAtRule); errObj != nil {
+				return errObj
+			}
+		}
+		return nil
+	}
+
+	dict := block.(*Dictionary)
+	keys := make([]string, 0, len(dict.Pairs))
+	for key := range dict.Pairs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var decls []string
+	var rules, atRules []string
+	values := make(map[string]Object, len(keys))
+	for _, key := range keys {
+		value := Eval(dict.Pairs[key], dict.Env)
+		if isError(value) {
+			return value.(*Error)
+		}
+		values[key] = value
+		switch {
+		case !isCSSBlock(value):
+			if s, ok := cssValue(value); ok {
+				decls = append(decls, cssProperty(key)+": "+s+";")
+			}
+		case strings.HasPrefix(key, "@"):
+			atRules = append(atRules, key)
+		default:
+			rules = append(rules, key)
+		}
+	}
+
+	indent := strings.Repeat(cssIndent, depth)
+	if len(decls) > 0 {
+		switch {
+		case selector != "":
+			b.WriteString(indent + selector + " {\n")
+			for _, decl := range decls {
+				b.WriteString(indent + cssIndent + decl + "\n")
+			}
+			b.WriteString(indent + "}\n")
+		case inAtRule:
+			// Declarations directly in an at-rule, as in @font-face
+			for _, decl := range decls {
+				b.WriteString(indent + decl + "\n")
+			}
+		default:
+			return newError("css(): declaration %q is not inside a selector", decls[0])
+		}
+	}
+
+	for _, key := range rules {
+		if errObj := writeCSSBlock(b, nestSelector(selector, key), values[key], depth, false); errObj != nil {
+			return errObj
+		}
+	}
+
+	for _, key := range atRules {
+		b.WriteString(indent + key + " {\n")
+		if errObj := writeCSSBlock(b, selector, values[key], depth+1, true); errObj != nil {
+			return errObj
+		}
+		b.WriteString(indent + "}\n")
+	}
+	return nil
+}
+
+// evalCSS implements css(rules)
+func evalCSS(args []Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments to `css`. got=%d, want=1", len(args))
+	}
+	if !isCSSBlock(args[0]) {
+		return newError("argument to `css` must be a dictionary or an array of dictionaries, got %s", typeName(args[0]))
+	}
+	var b strings.Builder
+	if errObj := writeCSSBlock(&b, "", args[0], 0, false); errObj != nil {
+		return errObj
+	}
+	return &String{Value: b.String()}
+}
+
+// designToken is one value from a token file
+type designToken struct {
+	path  string // dotted path, as aliases refer to it
+	name  string // custom property name, without the leading --
+	value Object
+}
+
+// tokenAliasRegex matches a token whose value is another token, like "{color.blue}"
+var tokenAliasRegex = regexp.MustCompile(`^\{([^{}]+)\}$`)
+
+// collectTokens flattens a token group into tokens. A dictionary with a
+// $value key is a token in the design tokens format; other keys starting
+// with $ ($type, $description) are skipped.
+func collectTokens(group *Dictionary, path []string, prefix string, tokens map[string]*designToken) *Error {
+	for key, expr := range group.Pairs {
+		if strings.HasPrefix(key, "$") {
+			continue
+		}
+		value := Eval(expr, group.Env)
+		if isError(value) {
+			return value.(*Error)
+		}
+		tokenPath := append(append([]string{}, path...), key)
+		if dict, ok := value.(*Dictionary); ok && typeName(dict) == "dict" {
+			if valueExpr, ok := dict.Pairs["$value"]; ok {
+				value = Eval(valueExpr, dict.Env)
+			} else {
+				if errObj := collectTokens(dict, tokenPath, prefix, tokens); errObj != nil {
+					return errObj
+				}
+				continue
+			}
+		}
+
+		nameParts := make([]string, 0, len(tokenPath)+1)
+		if prefix != "" {
+			nameParts = append(nameParts, prefix)
+		}
+		for _, part := range tokenPath {
+			nameParts = append(nameParts, kebabCase(part))
+		}
+		dotted := strings.Join(tokenPath, ".")
+		tokens[dotted] = &designToken{path: dotted, name: strings.Join(nameParts, "-"), value: value}
+	}
+	return nil
+}
+
+// resolveToken follows a token's aliases to its value, returning the token
+// it aliases directly, if any
+func resolveToken(tok *designToken, tokens map[string]*designToken, seen map[string]bool) (Object, *designToken, *Error) {
+	str, ok := tok.value.(*String)
+	if !ok {
+		return tok.value, nil, nil
+	}
+	m := tokenAliasRegex.FindStringSubmatch(str.Value)
+	if m == nil {
+		return tok.value, nil, nil
+	}
+	target, ok := tokens[m[1]]
+	if !ok {
+		return nil, nil, newError("tokens(): %s refers to unknown token {%s}", tok.path, m[1])
+	}
+	if seen[target.path] {
+		return nil, nil, newError("tokens(): %s refers to itself through {%s}", tok.path, m[1])
+	}
+	seen[target.path] = true
+	value, _, errObj := resolveToken(target, tokens, seen)
+	return value, target, errObj
+}
+
+// buildTokenTree rebuilds a token group with each token replaced by a value
+func buildTokenTree(group *Dictionary, path []string, leaf func(dotted string) Object) *Dictionary {
+	pairs := make(map[string]Object)
+	for key, expr := range group.Pairs {
+		if strings.HasPrefix(key, "$") {
+			continue
+		}
+		tokenPath := append(append([]string{}, path...), key)
+		if dict, ok := Eval(expr, group.Env).(*Dictionary); ok && typeName(dict) == "dict" {
+			if _, ok := dict.Pairs["$value"]; !ok {
+				pairs[key] = buildTokenTree(dict, tokenPath, leaf)
+				continue
+			}
+		}
+		pairs[key] = leaf(strings.Join(tokenPath, "."))
+	}
+	return NewDictionaryFromObjects(pairs)
+}
+
+// readTokenSource reads the tokens from a path, file handle or dictionary
+func readTokenSource(source Object, env *Environment) (*Dictionary, *Error) {
+	var data Object
+	switch src := source.(type) {
+	case *Path:
+		path := src.Inspect()
+		format := dataModuleFormat(path)
+		if format != "json" && format != "yaml" {
+			return nil, newError("tokens(): %s is not a .json, .yaml or .yml file", path)
+		}
+		content, errObj := readFileContent(fileToDict(src, format, nil, env), env)
+		if errObj != nil {
+			return nil, errObj
+		}
+		data = content
+	case *Dictionary:
+		if !isFileDict(src) {
+			if typeName(src) != "dict" {
+				return nil, newError("first argument to `tokens` must be a path, file or dictionary, got %s", typeName(src))
+			}
+			return src, nil
+		}
+		content, errObj := readFileContent(src, env)
+		if errObj != nil {
+			return nil, errObj
+		}
+		data = content
+	default:
+		return nil, newError("first argument to `tokens` must be a path, file or dictionary, got %s", typeName(source))
+	}
+
+	tokens, ok := data.(*Dictionary)
+	if !ok || typeName(tokens) != "dict" {
+		return nil, newError("tokens(): token file must hold a dictionary, got %s", typeName(data))
+	}
+	return tokens, nil
+}
+
+// evalTokens implements tokens(source, options?), returning {css, json,
+// values, vars}
+func evalTokens(args []Object, env *Environment) Object {
+	if len(args) < 1 || len(args) > 2 {
+		return newError("wrong number of arguments to `tokens`. got=%d, want=1 or 2", len(args))
+	}
+
+	prefix, selector := "", ":root"
+	if len(args) == 2 {
+		opts, ok := args[1].(*Dictionary)
+		if !ok {
+			return newError("second argument to `tokens` must be a dictionary, got %s", typeName(args[1]))
+		}
+		for key, dst := range map[string]*string{"prefix": &prefix, "selector": &selector} {
+			if expr, ok := opts.Pairs[key]; ok {
+				s, ok := Eval(expr, opts.Env).(*String)
+				if !ok {
+					return newError("`%s` option for `tokens` must be a string", key)
+				}
+				*dst = s.Value
+			}
+		}
+	}
+
+	source, errObj := readTokenSource(args[0], env)
+	if errObj != nil {
+		return errObj
+	}
+
+	tokens := make(map[string]*designToken)
+	if errObj := collectTokens(source, nil, prefix, tokens); errObj != nil {
+		return errObj
+	}
+
+	ordered := make([]*designToken, 0, len(tokens))
+	for _, tok := range tokens {
+		ordered = append(ordered, tok)
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].name < ordered[j].name })
+
+	resolved := make(map[string]Object, len(tokens))
+	var b strings.Builder
+	b.WriteString(selector + " {\n")
+	for _, tok := range ordered {
+		value, alias, errObj := resolveToken(tok, tokens, map[string]bool{tok.path: true})
+		if errObj != nil {
+			return errObj
+		}
+		resolved[tok.path] = value
+
+		// Aliases stay live in CSS, so overriding one variable updates the rest
+		css, ok := cssValue(value)
+		if alias != nil {
+			css, ok = "var(--"+alias.name+")", true
+		}
+		if ok {
+			b.WriteString(cssIndent + "--" + tok.name + ": " + css + ";\n")
+		}
+	}
+	b.WriteString("}\n")
+
+	values := buildTokenTree(source, nil, func(dotted string) Object { return resolved[dotted] })
+	vars := buildTokenTree(source, nil, func(dotted string) Object {
+		return &String{Value: "var(--" + tokens[dotted].name + ")"}
+	})
+	snapshot, err := encodeJSON(values)
+	if err != nil {
+		return newError("tokens(): %s", err.Error())
+	}
+
+	return NewDictionaryFromObjects(map[string]Object{
+		"css":    &String{Value: b.String()},
+		"json":   &String{Value: string(snapshot)},
+		"values": values,
+		"vars":   vars,
+	})
+}
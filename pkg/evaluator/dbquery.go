@@ -0,0 +1,702 @@
+package evaluator
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sambeau/parsley/pkg/ast"
+	"github.com/sambeau/parsley/pkg/lexer"
+)
+
+// db.prepare(sql) returns a statement that can be run many times with
+// different parameters, and db.table(name) starts a query built up with
+// methods, which passes every value as a parameter rather than in the SQL:
+//
+//	let byEmail = db.prepare("SELECT * FROM users WHERE email = ?")
+//	let user = byEmail.queryOne(email)
+//
+//	db.table("users").where({active: true}).orderBy("name").limit(10).all()
+
+// DBStatement is a prepared statement
+type DBStatement struct {
+	Conn   *DBConnection
+	Stmt   *sql.Stmt
+	SQL    string
+	Types  map[string]string // Column type overrides
+	Closed bool
+}
+
+func (s *DBStatement) Type() ObjectType { return DB_STATEMENT_OBJ }
+func (s *DBStatement) Inspect() string {
+	return fmt.Sprintf("<DBStatement %s>", strings.Join(strings.Fields(s.SQL), " "))
+}
+
+// DBQuery is a query built with db.table(). Its methods return a new query,
+// so a base query can be shared and refined.
+type DBQuery struct {
+	Conn    *DBConnection
+	Table   string
+	Columns []string
+	Where   []string // Conditions, with ? placeholders
+	Params  []Object // Values for the placeholders in Where
+	Order   []string // Quoted columns, with DESC for descending
+	Limit   int64    // -1 for no limit
+	Offset  int64
+	Types   map[string]string // Column type overrides
+}
+
+func (q *DBQuery) Type() ObjectType { return DB_QUERY_OBJ }
+func (q *DBQuery) Inspect() string {
+	query, _ := q.selectSQL()
+	return fmt.Sprintf("<DBQuery %s>", query)
+}
+
+// clone returns a copy of the query that can be changed without changing q
+func (q *DBQuery) clone() *DBQuery {
+	next := *q
+	next.Columns = append([]string(nil), q.Columns...)
+	next.Where = append([]string(nil), q.Where...)
+	next.Params = append([]Object(nil), q.Params...)
+	next.Order = append([]string(nil), q.Order...)
+	return &next
+}
+
+// quote quotes a table or column name for the connection's database
+func (q *DBQuery) quote(name string) string {
+	if q.Conn.Driver == "mysql" {
+		return "`" + name + "`"
+	}
+	return `"` + name + `"`
+}
+
+// whereSQL returns the query's WHERE clause, or ""
+func (q *DBQuery) whereSQL() string {
+	if len(q.Where) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(q.Where, " AND ")
+}
+
+// selectSQL returns the query's SELECT statement and its parameters
+func (q *DBQuery) selectSQL() (string, []interface{}) {
+	columns := "*"
+	if len(q.Columns) > 0 {
+		quoted := make([]string, len(q.Columns))
+		for i, col := range q.Columns {
+			quoted[i] = q.quote(col)
+		}
+		columns = strings.Join(quoted, ", ")
+	}
+
+	var b strings.Builder
+	b.WriteString("SELECT " + columns + " FROM " + q.quote(q.Table) + q.whereSQL())
+	if len(q.Order) > 0 {
+		b.WriteString(" ORDER BY " + strings.Join(q.Order, ", "))
+	}
+	limit := q.Limit
+	if limit < 0 && q.Offset > 0 {
+		// SQLite and MySQL only allow OFFSET after a LIMIT
+		switch q.Conn.Driver {
+		case "sqlite":
+			b.WriteString(" LIMIT -1")
+		case "mysql":
+			b.WriteString(" LIMIT 18446744073709551615")
+		}
+	}
+	if limit >= 0 {
+		b.WriteString(" LIMIT " + strconv.FormatInt(limit, 10))
+	}
+	if q.Offset > 0 {
+		b.WriteString(" OFFSET " + strconv.FormatInt(q.Offset, 10))
+	}
+	return q.rebind(b.String()), goValues(q.Params)
+}
+
+// rebind rewrites the query's ? placeholders for its driver
+func (q *DBQuery) rebind(query string) string {
+	return rebindPlaceholders(q.Conn.Driver, query)
+}
+
+// rebindPlaceholders rewrites ? placeholders as $1, $2... for PostgreSQL,
+// skipping quoted strings
+func rebindPlaceholders(driver, query string) string {
+	if driver != "postgres" {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// goValues converts Parsley values to database parameters
+func goValues(objs []Object) []interface{} {
+	params := make([]interface{}, len(objs))
+	for i, obj := range objs {
+		params[i] = objectToGoValue(obj)
+	}
+	return params
+}
+
+// statementParams converts the arguments of a statement method to
+// parameters: values for ? placeholders, an array of them, or a dictionary
+// for :name placeholders
+func statementParams(args []Object) []interface{} {
+	if len(args) == 1 {
+		switch v := args[0].(type) {
+		case *Array:
+			return goValues(v.Elements)
+		case *Dictionary:
+			keys := make([]string, 0, len(v.Pairs))
+			for key := range v.Pairs {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			params := make([]interface{}, len(keys))
+			for i, key := range keys {
+				params[i] = sql.Named(key, objectToGoValue(Eval(v.Pairs[key], v.Env)))
+			}
+			return params
+		}
+	}
+	return goValues(args)
+}
+
+// scanRows reads up to limit rows (all of them if limit is negative) as
+// dictionaries and closes rows. types overrides the kinds of columns.
+func scanRows(conn *DBConnection, rows *sql.Rows, limit int, types map[string]string, env *Environment) ([]Object, *Error) {
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		conn.LastError = err.Error()
+		return nil, newError("failed to get columns: %s", err.Error())
+	}
+	kinds := columnKinds(rows, columns, types)
+
+	results := []Object{}
+	for (limit < 0 || len(results) < limit) && rows.Next() {
+		values := make([]interface{}, len(columns))
+		valuePtrs := make([]interface{}, len(columns))
+		for i := range values {
+			valuePtrs[i] = &values[i]
+		}
+		if err := rows.Scan(valuePtrs...); err != nil {
+			conn.LastError = err.Error()
+			return nil, newError("failed to scan row: %s", err.Error())
+		}
+		results = append(results, rowToDict(columns, kinds, values, env))
+	}
+	if err := rows.Err(); err != nil {
+		conn.LastError = err.Error()
+		return nil, newError("error iterating rows: %s", err.Error())
+	}
+	return results, nil
+}
+
+// queryRows runs a query and reads up to limit rows (-1 for all)
+func queryRows(conn *DBConnection, query string, params []interface{}, limit int, types map[string]string, env *Environment) ([]Object, *Error) {
+	return readRows(conn, query, params, limit, types, env, func() (*sql.Rows, error) {
+		if len(params) == 0 {
+			return conn.querier().Query(query)
+		}
+		stmt, query, err := cachedStatement(conn, query, params)
+		if err != nil {
+			return nil, err
+		}
+		if stmt == nil {
+			return conn.querier().Query(query, params...)
+		}
+		return stmt.Query(params...)
+	})
+}
+
+// cachedStatements holds the prepared statements that queries with
+// parameters run as, for each database, so running a query again with new
+// values doesn't parse it again. Connections opened with the same DSN share
+// a database, and so share its statements.
+var (
+	cachedStatementsMu sync.Mutex
+	cachedStatements   = make(map[*sql.DB]map[string]*sql.Stmt)
+)
+
+// maxCachedStatements is how many statements are kept for each database;
+// queries beyond that run unprepared
+const maxCachedStatements = 256
+
+// cachedStatement returns the statement a query with params runs as,
+// preparing it the first time, and the query rewritten with the driver's
+// placeholders. The statement is nil once the database's cache is full, and
+// in a transaction, which runs queries on its own connection.
+func cachedStatement(conn *DBConnection, query string, params []interface{}) (*sql.Stmt, string, error) {
+	if !namedParams(params) {
+		query = rebindPlaceholders(conn.Driver, query)
+	}
+	if conn.Tx != nil {
+		return nil, query, nil
+	}
+
+	cachedStatementsMu.Lock()
+	defer cachedStatementsMu.Unlock()
+	stmts := cachedStatements[conn.DB]
+	if stmt, ok := stmts[query]; ok {
+		return stmt, query, nil
+	}
+	if len(stmts) >= maxCachedStatements {
+		return nil, query, nil
+	}
+	stmt, err := conn.DB.Prepare(query)
+	if err != nil {
+		return nil, query, err
+	}
+	if stmts == nil {
+		stmts = make(map[string]*sql.Stmt)
+		cachedStatements[conn.DB] = stmts
+	}
+	stmts[query] = stmt
+	return stmt, query, nil
+}
+
+// closeCachedStatements closes and forgets a database's statements
+func closeCachedStatements(db *sql.DB) {
+	cachedStatementsMu.Lock()
+	defer cachedStatementsMu.Unlock()
+	for _, stmt := range cachedStatements[db] {
+		stmt.Close()
+	}
+	delete(cachedStatements, db)
+}
+
+// namedParams reports whether params are for :name placeholders
+func namedParams(params []interface{}) bool {
+	for _, p := range params {
+		if _, ok := p.(sql.NamedArg); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// readRows reads up to limit rows from a query run with run, unless the
+// query is mocked or replayed
+func readRows(conn *DBConnection, query string, params []interface{}, limit int, types map[string]string, env *Environment, run func() (*sql.Rows, error)) ([]Object, *Error) {
+	if results, ok := mockedRows(conn, query, limit); ok {
+		return results, nil
+	}
+	key := describeSQL(query, params)
+	if in, err := replay("sql", key); err != nil {
+		return nil, newError("query failed: %s", err.Error())
+	} else if in != nil {
+		return in.rows(limit)
+	}
+
+	start := time.Now()
+	rows, err := run()
+	recordSQLQuery(start)
+	if err != nil {
+		conn.LastError = err.Error()
+		return nil, newError("query failed: %s", err.Error())
+	}
+	results, errObj := scanRows(conn, rows, limit, types, env)
+	if errObj == nil {
+		recordRows(key, results)
+	}
+	return results, errObj
+}
+
+// execResultDict returns the {affected, lastId} result of a mutation
+func execResultDict(result sql.Result, env *Environment) *Dictionary {
+	affected, _ := result.RowsAffected()
+	lastId, _ := result.LastInsertId()
+	return &Dictionary{
+		Pairs: map[string]ast.Expression{
+			"affected": &ast.IntegerLiteral{
+				Token: lexer.Token{Type: lexer.INT, Literal: strconv.FormatInt(affected, 10)},
+				Value: affected,
+			},
+			"lastId": &ast.IntegerLiteral{
+				Token: lexer.Token{Type: lexer.INT, Literal: strconv.FormatInt(lastId, 10)},
+				Value: lastId,
+			},
+		},
+		Env: env,
+	}
+}
+
+// dbPrepare implements db.prepare(sql, {types})
+func dbPrepare(conn *DBConnection, args []Object) Object {
+	if len(args) < 1 || len(args) > 2 {
+		return newError("prepare() takes 1 or 2 arguments, got=%d", len(args))
+	}
+	query, ok := args[0].(*String)
+	if !ok {
+		return newError("prepare() argument must be a string, got %s", args[0].Type())
+	}
+
+	var types map[string]string
+	if len(args) == 2 {
+		opts, ok := args[1].(*Dictionary)
+		if !ok {
+			return newError("prepare() options must be a dictionary, got %s", args[1].Type())
+		}
+		for key, expr := range opts.Pairs {
+			if key != "types" {
+				return newError("unknown option %q for prepare()", key)
+			}
+			var errObj *Error
+			if types, errObj = parseColumnTypes(Eval(expr, opts.Env)); errObj != nil {
+				return errObj
+			}
+		}
+	}
+
+	stmt, err := conn.DB.Prepare(query.Value)
+	if err != nil {
+		conn.LastError = err.Error()
+		return newError("prepare failed: %s", err.Error())
+	}
+	return &DBStatement{Conn: conn, Stmt: stmt, SQL: query.Value, Types: types}
+}
+
+// dbTable implements db.table(name)
+func dbTable(conn *DBConnection, args []Object) Object {
+	if len(args) != 1 {
+		return newError("table() takes 1 argument, got=%d", len(args))
+	}
+	table, ok := args[0].(*String)
+	if !ok || !sqlIdentifierRegex.MatchString(table.Value) {
+		return newError("table() argument must be a table name, got %s", args[0].Inspect())
+	}
+	return &DBQuery{Conn: conn, Table: table.Value, Limit: -1}
+}
+
+// evalDBStatementMethod handles method calls on prepared statements
+func evalDBStatementMethod(stmt *DBStatement, method string, args []Object, env *Environment) Object {
+	if stmt.Closed && method != "close" {
+		return newError("statement is closed")
+	}
+
+	switch method {
+	case "query", "queryOne":
+		limit := -1
+		if method == "queryOne" {
+			limit = 1
+		}
+		params := statementParams(args)
+		results, errObj := readRows(stmt.Conn, stmt.SQL, params, limit, stmt.Types, env, func() (*sql.Rows, error) {
+			return stmt.Conn.stmt(stmt.Stmt).Query(params...)
+		})
+		if errObj != nil {
+			return errObj
+		}
+		if method == "query" {
+			return &Array{Elements: results}
+		}
+		if len(results) == 0 {
+			return NULL
+		}
+		return results[0]
+
+	case "exec":
+		params := statementParams(args)
+		result, err := runStatement(stmt.Conn, stmt.SQL, params, env, func() (sql.Result, error) {
+			return stmt.Conn.stmt(stmt.Stmt).Exec(params...)
+		})
+		if err != nil {
+			stmt.Conn.LastError = err.Error()
+			return newError("execute failed: %s", err.Error())
+		}
+		return execResultDict(result, env)
+
+	case "close":
+		if len(args) != 0 {
+			return newError("close() takes no arguments, got=%d", len(args))
+		}
+		if !stmt.Closed {
+			stmt.Closed = true
+			if err := stmt.Stmt.Close(); err != nil {
+				return newError("failed to close statement: %s", err.Error())
+			}
+		}
+		return NULL
+
+	default:
+		return newError("unknown method for statement: %s", method)
+	}
+}
+
+// evalDBQueryMethod handles method calls on queries built with db.table()
+func evalDBQueryMethod(q *DBQuery, method string, args []Object, env *Environment) Object {
+	switch method {
+	case "select":
+		next := q.clone()
+		next.Columns = nil
+		for _, name := range flattenArgs(args) {
+			col, ok := name.(*String)
+			if !ok || !sqlIdentifierRegex.MatchString(col.Value) {
+				return newError("select() arguments must be column names, got %s", name.Inspect())
+			}
+			next.Columns = append(next.Columns, col.Value)
+		}
+		return next
+
+	case "where":
+		return queryWhere(q, args)
+
+	case "orderBy":
+		next := q.clone()
+		for _, name := range flattenArgs(args) {
+			col, ok := name.(*String)
+			if !ok || !sqlIdentifierRegex.MatchString(strings.TrimPrefix(col.Value, "-")) {
+				return newError("orderBy() arguments must be column names, optionally starting with - for descending, got %s", name.Inspect())
+			}
+			if strings.HasPrefix(col.Value, "-") {
+				next.Order = append(next.Order, q.quote(col.Value[1:])+" DESC")
+			} else {
+				next.Order = append(next.Order, q.quote(col.Value))
+			}
+		}
+		return next
+
+	case "types":
+		if len(args) != 1 {
+			return newError("types() takes 1 argument, got=%d", len(args))
+		}
+		types, errObj := parseColumnTypes(args[0])
+		if errObj != nil {
+			return errObj
+		}
+		next := q.clone()
+		next.Types = make(map[string]string, len(q.Types)+len(types))
+		for col, kind := range q.Types {
+			next.Types[col] = kind
+		}
+		for col, kind := range types {
+			next.Types[col] = kind
+		}
+		return next
+
+	case "limit", "offset":
+		if len(args) != 1 {
+			return newError("%s() takes 1 argument, got=%d", method, len(args))
+		}
+		n, ok := args[0].(*Integer)
+		if !ok || n.Value < 0 {
+			return newError("%s() argument must be a non-negative integer, got %s", method, args[0].Inspect())
+		}
+		next := q.clone()
+		if method == "limit" {
+			next.Limit = n.Value
+		} else {
+			next.Offset = n.Value
+		}
+		return next
+
+	case "all", "first":
+		if len(args) != 0 {
+			return newError("%s() takes no arguments, got=%d", method, len(args))
+		}
+		query := q
+		if method == "first" {
+			query = q.clone()
+			query.Limit = 1
+		}
+		stmt, params := query.selectSQL()
+		results, errObj := queryRows(q.Conn, stmt, params, -1, q.Types, env)
+		if errObj != nil {
+			return errObj
+		}
+		if method == "all" {
+			return &Array{Elements: results}
+		}
+		if len(results) == 0 {
+			return NULL
+		}
+		return results[0]
+
+	case "count":
+		if len(args) != 0 {
+			return newError("count() takes no arguments, got=%d", len(args))
+		}
+		var count int64
+		stmt := q.rebind("SELECT COUNT(*) FROM " + q.quote(q.Table) + q.whereSQL())
+		start := time.Now()
+		err := q.Conn.querier().QueryRow(stmt, goValues(q.Params)...).Scan(&count)
+		recordSQLQuery(start)
+		if err != nil {
+			q.Conn.LastError = err.Error()
+			return newError("query failed: %s", err.Error())
+		}
+		return &Integer{Value: count}
+
+	case "toSQL":
+		if len(args) != 0 {
+			return newError("toSQL() takes no arguments, got=%d", len(args))
+		}
+		stmt, _ := q.selectSQL()
+		return &Dictionary{
+			Pairs: map[string]ast.Expression{
+				"sql":    &ast.StringLiteral{Value: stmt},
+				"params": createLiteralExpression(&Array{Elements: append([]Object{}, q.Params...)}),
+			},
+			Env: env,
+		}
+
+	case "insert", "update":
+		if len(args) != 1 {
+			return newError("%s() takes 1 argument, got=%d", method, len(args))
+		}
+		row, ok := args[0].(*Dictionary)
+		if !ok || len(row.Pairs) == 0 {
+			return newError("%s() argument must be a dictionary of column values", method)
+		}
+		keys := make([]string, 0, len(row.Pairs))
+		for key := range row.Pairs {
+			if !sqlIdentifierRegex.MatchString(key) {
+				return newError("%s() keys must be column names, got %q", method, key)
+			}
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		values := make([]Object, len(keys))
+		for i, key := range keys {
+			values[i] = Eval(row.Pairs[key], row.Env)
+			if isError(values[i]) {
+				return values[i]
+			}
+		}
+
+		var stmt string
+		if method == "insert" {
+			columns := make([]string, len(keys))
+			for i, key := range keys {
+				columns[i] = q.quote(key)
+			}
+			stmt = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", q.quote(q.Table),
+				strings.Join(columns, ", "), strings.TrimSuffix(strings.Repeat("?, ", len(keys)), ", "))
+		} else {
+			if len(q.Where) == 0 {
+				return newError("update() on %s has no where() condition; use db <=!=> to update every row", q.Table)
+			}
+			sets := make([]string, len(keys))
+			for i, key := range keys {
+				sets[i] = q.quote(key) + " = ?"
+			}
+			stmt = "UPDATE " + q.quote(q.Table) + " SET " + strings.Join(sets, ", ") + q.whereSQL()
+			values = append(values, q.Params...)
+		}
+		return q.exec(stmt, values, env)
+
+	case "delete":
+		if len(args) != 0 {
+			return newError("delete() takes no arguments, got=%d", len(args))
+		}
+		if len(q.Where) == 0 {
+			return newError("delete() on %s has no where() condition; use db <=!=> to delete every row", q.Table)
+		}
+		return q.exec("DELETE FROM "+q.quote(q.Table)+q.whereSQL(), q.Params, env)
+
+	default:
+		return newError("unknown method for query: %s", method)
+	}
+}
+
+// exec runs a mutation built from the query
+func (q *DBQuery) exec(stmt string, params []Object, env *Environment) Object {
+	result, err := execSQL(q.Conn, q.rebind(stmt), goValues(params), env)
+	if err != nil {
+		q.Conn.LastError = err.Error()
+		return newError("execute failed: %s", err.Error())
+	}
+	return execResultDict(result, env)
+}
+
+// queryWhere implements query.where(), which takes a dictionary of column
+// values to match, or an SQL condition with ? placeholders and their values
+func queryWhere(q *DBQuery, args []Object) Object {
+	if len(args) == 0 {
+		return newError("where() needs a dictionary or a condition")
+	}
+	next := q.clone()
+
+	switch cond := args[0].(type) {
+	case *Dictionary:
+		if len(args) != 1 {
+			return newError("where() with a dictionary takes 1 argument, got=%d", len(args))
+		}
+		keys := make([]string, 0, len(cond.Pairs))
+		for key := range cond.Pairs {
+			if !sqlIdentifierRegex.MatchString(key) {
+				return newError("where() keys must be column names, got %q", key)
+			}
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			val := Eval(cond.Pairs[key], cond.Env)
+			if isError(val) {
+				return val
+			}
+			col := q.quote(key)
+			switch v := val.(type) {
+			case *Null:
+				next.Where = append(next.Where, col+" IS NULL")
+			case *Array:
+				if len(v.Elements) == 0 {
+					next.Where = append(next.Where, "1 = 0")
+					continue
+				}
+				placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(v.Elements)), ", ")
+				next.Where = append(next.Where, col+" IN ("+placeholders+")")
+				next.Params = append(next.Params, v.Elements...)
+			default:
+				next.Where = append(next.Where, col+" = ?")
+				next.Params = append(next.Params, val)
+			}
+		}
+
+	case *String:
+		// The condition is written by the script, not taken from its data;
+		// values go in the parameters
+		if strings.Count(cond.Value, "?") != len(args)-1 {
+			return newError("where() condition has %d ? placeholders but %d values", strings.Count(cond.Value, "?"), len(args)-1)
+		}
+		next.Where = append(next.Where, "("+cond.Value+")")
+		next.Params = append(next.Params, args[1:]...)
+
+	default:
+		return newError("where() needs a dictionary or a condition, got %s", args[0].Type())
+	}
+	return next
+}
+
+// flattenArgs returns the arguments, with a single array argument spread
+func flattenArgs(args []Object) []Object {
+	if len(args) == 1 {
+		if arr, ok := args[0].(*Array); ok {
+			return arr.Elements
+		}
+	}
+	return args
+}
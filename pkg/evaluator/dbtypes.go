@@ -0,0 +1,232 @@
+package evaluator
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Drivers return column values in whatever Go type suits them: SQLite
+// returns booleans as 0 and 1 and dates as text, and MySQL returns most
+// values, DECIMAL included, as bytes. Query results are normalized using the
+// columns' declared types, so a BOOLEAN column gives true or false and a
+// DATETIME column gives a datetime, whatever the driver. A query's types
+// option overrides the kind of individual columns:
+//
+//	db.prepare("SELECT * FROM orders", {types: {total: "float"}})
+//	db.table("orders").types({shippedOn: "date"})
+
+// columnKindNames are the kinds a types option can give a column. "raw"
+// keeps the driver's value.
+var columnKindNames = map[string]bool{
+	"int": true, "float": true, "bool": true, "string": true,
+	"datetime": true, "date": true, "raw": true,
+}
+
+// parseColumnTypes reads a types option: a dictionary of column kinds
+func parseColumnTypes(obj Object) (map[string]string, *Error) {
+	if isError(obj) {
+		return nil, obj.(*Error)
+	}
+	dict, ok := obj.(*Dictionary)
+	if !ok {
+		return nil, newError("query types must be a dictionary of column types, got %s", obj.Type())
+	}
+	types := make(map[string]string, len(dict.Pairs))
+	for col, expr := range dict.Pairs {
+		kind, ok := Eval(expr, dict.Env).(*String)
+		if !ok || !columnKindNames[kind.Value] {
+			return nil, newError("type for column `%s` must be \"int\", \"float\", \"bool\", \"string\", \"datetime\", \"date\" or \"raw\"", col)
+		}
+		types[col] = kind.Value
+	}
+	return types, nil
+}
+
+// columnKinds returns the kind of each column of rows: the override from
+// types if there is one, otherwise the kind of its declared type
+func columnKinds(rows *sql.Rows, columns []string, types map[string]string) []string {
+	kinds := make([]string, len(columns))
+	colTypes, _ := rows.ColumnTypes()
+	for i, col := range columns {
+		if kind, ok := types[col]; ok {
+			kinds[i] = kind
+		} else if i < len(colTypes) {
+			kinds[i] = kindForDatabaseType(colTypes[i].DatabaseTypeName())
+		}
+	}
+	return kinds
+}
+
+// kindForDatabaseType maps a declared column type, such as VARCHAR(20) or
+// TIMESTAMPTZ, to the kind of value it holds, or "" if it isn't known.
+// Names are matched loosely, like SQLite's type affinity rules.
+func kindForDatabaseType(name string) string {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if i := strings.IndexByte(name, '('); i >= 0 {
+		name = strings.TrimSpace(name[:i])
+	}
+
+	switch name {
+	case "BOOL", "BOOLEAN":
+		return "bool"
+	case "DATE":
+		return "date"
+	case "DATETIME", "TIMESTAMP", "TIMESTAMPTZ", "TIMESTAMP WITH TIME ZONE", "TIMESTAMP WITHOUT TIME ZONE":
+		return "datetime"
+	case "INTERVAL", "POINT":
+		return ""
+	}
+	switch {
+	case strings.Contains(name, "INT") || strings.HasSuffix(name, "SERIAL"):
+		return "int"
+	case strings.Contains(name, "CHAR"), strings.Contains(name, "TEXT"), strings.Contains(name, "CLOB"),
+		name == "UUID", name == "JSON", name == "JSONB":
+		return "string"
+	case strings.Contains(name, "REAL"), strings.Contains(name, "FLOA"), strings.Contains(name, "DOUB"),
+		name == "DECIMAL", name == "NUMERIC", name == "NUMBER", name == "MONEY":
+		return "float"
+	}
+	return ""
+}
+
+// datetimeLayouts are the formats datetime columns stored as text are read in
+var datetimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// parseDatetimeColumn parses a datetime stored as text
+func parseDatetimeColumn(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range datetimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// columnValue converts a value from the driver to the given kind. Values
+// that can't be converted are kept as the driver returned them.
+func columnValue(v interface{}, kind string, env *Environment) Object {
+	if b, ok := v.([]byte); ok && kind != "raw" {
+		v = string(b)
+	}
+
+	switch kind {
+	case "int":
+		switch val := v.(type) {
+		case int64:
+			return &Integer{Value: val}
+		case float64:
+			if val == float64(int64(val)) {
+				return &Integer{Value: int64(val)}
+			}
+		case bool:
+			if val {
+				return &Integer{Value: 1}
+			}
+			return &Integer{Value: 0}
+		case string:
+			if n, err := strconv.ParseInt(strings.TrimSpace(val), 10, 64); err == nil {
+				return &Integer{Value: n}
+			}
+		}
+
+	case "float":
+		switch val := v.(type) {
+		case int64:
+			return &Float{Value: float64(val)}
+		case float64:
+			return &Float{Value: val}
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(val), 64); err == nil {
+				return &Float{Value: f}
+			}
+		}
+
+	case "bool":
+		switch val := v.(type) {
+		case bool:
+			return nativeBoolToParsBoolean(val)
+		case int64:
+			return nativeBoolToParsBoolean(val != 0)
+		case float64:
+			return nativeBoolToParsBoolean(val != 0)
+		case string:
+			switch strings.ToLower(strings.TrimSpace(val)) {
+			case "1", "t", "true", "y", "yes", "on":
+				return TRUE
+			case "0", "f", "false", "n", "no", "off":
+				return FALSE
+			}
+		}
+
+	case "datetime", "date":
+		var t time.Time
+		ok := false
+		switch val := v.(type) {
+		case time.Time:
+			t, ok = val, true
+		case string:
+			t, ok = parseDatetimeColumn(val)
+		case int64:
+			// Unix seconds, as SQLite's unixepoch() stores them
+			t, ok = time.Unix(val, 0).UTC(), true
+		}
+		if ok {
+			if kind == "date" {
+				t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+			}
+			return newDatetime(t, kind)
+		}
+
+	case "string":
+		switch val := v.(type) {
+		case string:
+			return &String{Value: val}
+		case int64:
+			return &String{Value: strconv.FormatInt(val, 10)}
+		case float64:
+			return &String{Value: strconv.FormatFloat(val, 'f', -1, 64)}
+		case bool:
+			return &String{Value: strconv.FormatBool(val)}
+		case time.Time:
+			return &String{Value: val.Format(time.RFC3339)}
+		}
+	}
+
+	return driverValue(v, env)
+}
+
+// driverValue converts a value from the driver as it is
+func driverValue(v interface{}, env *Environment) Object {
+	switch val := v.(type) {
+	case nil:
+		return NULL
+	case int64:
+		return &Integer{Value: val}
+	case float64:
+		return &Float{Value: val}
+	case string:
+		return &String{Value: val}
+	case []byte:
+		return &String{Value: string(val)}
+	case bool:
+		return nativeBoolToParsBoolean(val)
+	case time.Time:
+		return newDatetime(val, "datetime")
+	default:
+		// For unknown types, convert to string
+		return &String{Value: fmt.Sprintf("%v", val)}
+	}
+}
@@ -0,0 +1,109 @@
+package evaluator
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// pars --dry-run sets SecurityPolicy.DryRun. Reads, fetches and queries run
+// as usual, but anything that changes the world outside the script is logged
+// instead of done:
+//
+//	dry run: write 1204 bytes to /srv/site/index.html
+//	dry run: run rsync -a ./public/ deploy@example.com:/srv/site
+//	dry run: execute SQL: UPDATE posts SET published = ? [true]
+//
+// Skipped operations return what success would look like with nothing done:
+// commands give empty output and exit code 0, SQL statements affect no rows
+// and requests other than GET get an empty 204 response.
+
+// DryRunLog receives the operations --dry-run skips
+var DryRunLog io.Writer = os.Stderr
+
+// dryRun reports whether side effects are being skipped, logging the one that
+// would have happened
+func (e *Environment) dryRun(format string, args ...interface{}) bool {
+	if e == nil || e.Security == nil || !e.Security.DryRun {
+		return false
+	}
+	fmt.Fprintf(DryRunLog, "dry run: "+format+"\n", args...)
+	return true
+}
+
+// describeSQL describes a statement and its parameters for the dry run log
+// and recordings
+func describeSQL(query string, params []interface{}) string {
+	query = strings.Join(strings.Fields(query), " ")
+	if len(params) == 0 {
+		return query
+	}
+	return fmt.Sprintf("%s %v", query, params)
+}
+
+// sftpLocation describes a remote path for the dry run log
+func sftpLocation(handle *SFTPFileHandle) string {
+	return fmt.Sprintf("%s@%s:%s", handle.Connection.User, handle.Connection.Host, handle.Path)
+}
+
+// execSQL runs a statement that changes the database, or logs it in a dry run
+func execSQL(conn *DBConnection, query string, params []interface{}, env *Environment) (sql.Result, error) {
+	return runStatement(conn, query, params, env, func() (sql.Result, error) {
+		if len(params) == 0 {
+			return conn.querier().Exec(query)
+		}
+		stmt, query, err := cachedStatement(conn, query, params)
+		if err != nil {
+			return nil, err
+		}
+		if stmt == nil {
+			return conn.querier().Exec(query, params...)
+		}
+		return stmt.Exec(params...)
+	})
+}
+
+// runStatement runs a statement with exec, unless it is mocked, replayed or
+// skipped by a dry run
+func runStatement(conn *DBConnection, query string, params []interface{}, env *Environment, exec func() (sql.Result, error)) (sql.Result, error) {
+	if result, ok := mockedExec(conn, query); ok {
+		return result, nil
+	}
+	key := describeSQL(query, params)
+	if in, err := replay("sql", key); err != nil || in != nil {
+		if err != nil {
+			return nil, err
+		}
+		return mockResult{affected: in.Affected, lastId: in.LastID}, nil
+	}
+	if env.dryRun("execute SQL: %s", key) {
+		return dryRunResult{}, nil
+	}
+	start := time.Now()
+	result, err := exec()
+	recordSQLQuery(start)
+	if err == nil {
+		affected, _ := result.RowsAffected()
+		lastID, _ := result.LastInsertId()
+		recordInteraction(Interaction{Kind: "sql", Key: key, Affected: affected, LastID: lastID})
+	}
+	return result, err
+}
+
+// dryRunResult is the result of a statement a dry run skipped
+type dryRunResult struct{}
+
+func (dryRunResult) LastInsertId() (int64, error) { return 0, nil }
+func (dryRunResult) RowsAffected() (int64, error) { return 0, nil }
+
+// dryRunRequest reports whether an HTTP request that could change something
+// on the server is being skipped, logging it
+func (e *Environment) dryRunRequest(method, url string) bool {
+	if method == "GET" || method == "HEAD" || method == "OPTIONS" {
+		return false
+	}
+	return e.dryRun("send %s %s", method, url)
+}
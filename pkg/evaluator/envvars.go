@@ -0,0 +1,47 @@
+package evaluator
+
+import (
+	"os"
+
+	"github.com/sambeau/parsley/pkg/ast"
+)
+
+// Scripts can't read the process environment, where secrets usually live.
+// The host exposes the variables a script may use (pars --env=API_HOST,DATA_DIR)
+// and the script reads them from env, so it can move between machines and
+// deployments without edits:
+//
+//	let users <=/= JSON(@(https://{env.API_HOST}/v1/users))
+//	let config <== JSON(@({env.DATA_DIR}/config.json))
+//
+// Reading a variable that wasn't exposed, or isn't set, is an error rather
+// than null, so a missing --env fails at once instead of producing a
+// broken URL.
+
+// ExposeEnv returns the values of the named environment variables that are
+// set, for Environment.EnvVars
+func ExposeEnv(names []string) map[string]string {
+	vars := make(map[string]string, len(names))
+	for _, name := range names {
+		if value, ok := os.LookupEnv(name); ok {
+			vars[name] = value
+		}
+	}
+	return vars
+}
+
+// envDict creates the env dictionary of a script's exposed variables
+func envDict(env *Environment) *Dictionary {
+	pairs := map[string]ast.Expression{
+		"__type": createLiteralExpression(&String{Value: "env"}),
+	}
+	for name, value := range env.EnvVars {
+		pairs[name] = createLiteralExpression(&String{Value: value})
+	}
+	return &Dictionary{Pairs: pairs, Env: env}
+}
+
+// isEnvDict checks if a dictionary is the env dictionary
+func isEnvDict(dict *Dictionary) bool {
+	return typeName(dict) == "env"
+}
@@ -3,17 +3,19 @@ package evaluator
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"database/sql"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math"
-	"net"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"sort"
 	"strconv"
@@ -25,16 +27,23 @@ import (
 	"github.com/goodsign/monday"
 	"github.com/pkg/sftp"
 	"github.com/sambeau/parsley/pkg/ast"
+	"github.com/sambeau/parsley/pkg/filelock"
+	"github.com/sambeau/parsley/pkg/formatter"
+	"github.com/sambeau/parsley/pkg/holidays"
 	"github.com/sambeau/parsley/pkg/lexer"
 	"github.com/sambeau/parsley/pkg/locale"
 	"github.com/sambeau/parsley/pkg/parser"
 	"github.com/yuin/goldmark"
 	"golang.org/x/crypto/ssh"
-	"golang.org/x/crypto/ssh/knownhosts"
 	"gopkg.in/yaml.v3"
 	_ "modernc.org/sqlite"
 
 	"golang.org/x/text/currency"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/japanese"
+	textunicode "golang.org/x/text/encoding/unicode"
 	"golang.org/x/text/language"
 	"golang.org/x/text/message"
 	"golang.org/x/text/number"
@@ -68,8 +77,21 @@ const (
 	ARRAY_OBJ            = "ARRAY"
 	DICTIONARY_OBJ       = "DICTIONARY"
 	DB_CONNECTION_OBJ    = "DB_CONNECTION"
+	DB_STATEMENT_OBJ     = "DB_STATEMENT"
+	DB_QUERY_OBJ         = "DB_QUERY"
 	SFTP_CONNECTION_OBJ  = "SFTP_CONNECTION"
 	SFTP_FILE_HANDLE_OBJ = "SFTP_FILE_HANDLE"
+	ITERATOR_OBJ         = "ITERATOR"
+	RANGE_OBJ            = "RANGE"
+	COUNTER_OBJ          = "COUNTER"
+	COLLECTOR_OBJ        = "COLLECTOR"
+	ATOMIC_DICT_OBJ      = "ATOMIC_DICT"
+	CHANNEL_OBJ          = "CHANNEL"
+	STOPWATCH_OBJ        = "STOPWATCH"
+	DATETIME_OBJ         = "DATETIME"
+	DURATION_OBJ         = "DURATION"
+	PATH_OBJ             = "PATH"
+	URL_OBJ              = "URL"
 )
 
 // Object represents all values in our language
@@ -102,9 +124,11 @@ type Boolean struct {
 func (b *Boolean) Inspect() string  { return strconv.FormatBool(b.Value) }
 func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
 
-// String represents string objects
+// String represents string objects. Untrusted marks strings that came from
+// a web request (see serve.go); they are escaped when put into tags.
 type String struct {
-	Value string
+	Value     string
+	Untrusted bool
 }
 
 func (s *String) Inspect() string  { return s.Value }
@@ -129,14 +153,32 @@ type Error struct {
 	Message string
 	Line    int
 	Column  int
+	Length  int           // Bytes of source the error covers, for underlining (0 if unknown)
+	Hint    string        // Suggested fix, such as "did you mean `formatDate`?"
+	Notes   []ErrorNote   // Related places in the source
+	File    string        // Module the position is in, if not the file being run
+	Imports []ErrorImport // Imports that led to File, innermost first
+	stop    bool          // Unwinds a generator whose consumer has stopped, past attempt() (see iterator.go)
+}
+
+// ErrorNote points at a place in the source related to an error, such as the
+// declaration of a variable hiding a builtin
+type ErrorNote struct {
+	Message string
+	Line    int
+	Column  int
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
 func (e *Error) Inspect() string {
+	module := ""
+	if e.File != "" {
+		module = fmt.Sprintf("in module %s: ", e.File)
+	}
 	if e.Line > 0 {
-		return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+		return fmt.Sprintf("%sline %d, column %d: %s", module, e.Line, e.Column, e.Message)
 	}
-	return "ERROR: " + e.Message
+	return "ERROR: " + module + e.Message
 }
 
 // Function represents function objects
@@ -162,6 +204,9 @@ type BuiltinFunction func(args ...Object) Object
 // Builtin represents built-in function objects
 type Builtin struct {
 	Fn BuiltinFunction
+	// Ranges is set for builtins that take ranges as they are; others are
+	// passed a range's elements as an array
+	Ranges bool
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
@@ -224,6 +269,8 @@ type DBConnection struct {
 	Driver        string // "sqlite", "postgres", "mysql"
 	DSN           string // Data Source Name
 	InTransaction bool
+	Tx            *sql.Tx // The open transaction, if any (see transaction.go)
+	savepoints    int     // Savepoints open inside Tx
 	LastError     string
 	Managed       bool // If true, connection is managed by host application (won't be closed by Parsley)
 }
@@ -293,6 +340,7 @@ type SecurityPolicy struct {
 	AllowWriteAll   bool     // Allow all writes
 	AllowExecute    []string // Allowed execute directories (whitelist)
 	AllowExecuteAll bool     // Allow all executes
+	DryRun          bool     // Log writes, commands and SQL changes instead of doing them (see dryrun.go)
 }
 
 // Logger interface for log()/logLine() output
@@ -326,35 +374,58 @@ func (l *defaultStdoutLogger) LogLine(values ...interface{}) {
 // DefaultLogger is the default stdout logger
 var DefaultLogger Logger = &defaultStdoutLogger{}
 
+// DefaultLocale is the locale used by formatting functions when none is given
+var DefaultLocale = "en-US"
+
 // Environment represents the environment for variable bindings
 type Environment struct {
-	store       map[string]Object
-	outer       *Environment
-	Filename    string
-	LastToken   *lexer.Token
-	letBindings map[string]bool // tracks which variables were declared with 'let'
-	exports     map[string]bool // tracks which variables were explicitly exported
-	Security    *SecurityPolicy // File system security policy
-	Logger      Logger          // Logger for log()/logLine() output
-}
-
-// NewEnvironment creates a new environment
+	store        map[string]Object
+	outer        *Environment
+	Filename     string
+	LastToken    *lexer.Token
+	letBindings  map[string]bool        // tracks which variables were declared with 'let'
+	exports      map[string]bool        // tracks which variables were explicitly exported
+	Security     *SecurityPolicy        // File system security policy
+	Logger       Logger                 // Logger for log()/logLine() output
+	Tasks        *TaskRegistry          // Tasks defined with task() (nil outside `pars run`)
+	ModulePaths  []string               // Directories searched by import() after the importing file's directory
+	LockFile     string                 // parsley.lock recording the hashes of remote modules (see remote.go)
+	Strict       bool                   // Strict mode for the whole run, inherited by imported modules (see strict.go)
+	EnvVars      map[string]string      // Environment variables the script can read as env (see envvars.go)
+	strictFile   bool                   // Strict mode from a "use strict" pragma, for the current file only
+	moduleURL    string                 // The URL of the remote module running in this environment
+	call         *functionCall          // The call whose function body runs in this environment (see props.go)
+	provided     map[string]Object      // Values from provide() for called functions (see provide.go)
+	declared     map[string]lexer.Token // Where let bindings were declared, for error notes (see hints.go)
+	parallel     *parallelIteration     // The parallel() call this environment belongs to (see parallel.go)
+	transactions []*DBConnection        // Transactions the script began, rolled back if it ends with them open (see transaction.go)
+}
+
+// NewEnvironment creates a new environment. A function call or loop
+// iteration makes one, so the let and export maps are only made when
+// something is declared.
 func NewEnvironment() *Environment {
-	s := make(map[string]Object)
-	l := make(map[string]bool)
-	x := make(map[string]bool)
-	return &Environment{store: s, outer: nil, letBindings: l, exports: x, Logger: DefaultLogger}
+	return &Environment{store: make(map[string]Object), Logger: DefaultLogger}
 }
 
 // NewEnclosedEnvironment creates a new environment with outer reference
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
-	// Preserve filename, token, and logger from outer environment
+	// Preserve filename, token, logger, security policy and tasks from outer environment
 	if outer != nil {
 		env.Filename = outer.Filename
 		env.LastToken = outer.LastToken
 		env.Logger = outer.Logger
+		env.Security = outer.Security
+		env.Tasks = outer.Tasks
+		env.ModulePaths = outer.ModulePaths
+		env.LockFile = outer.LockFile
+		env.Strict = outer.Strict
+		env.EnvVars = outer.EnvVars
+		env.strictFile = outer.strictFile
+		env.moduleURL = outer.moduleURL
+		env.parallel = outer.parallel
 	}
 	return env
 }
@@ -377,23 +448,37 @@ func (e *Environment) Set(name string, val Object) Object {
 // SetLet stores a value in the environment and marks it as a let binding
 func (e *Environment) SetLet(name string, val Object) Object {
 	e.store[name] = val
-	e.letBindings[name] = true
+	e.markLet(name)
 	return val
 }
 
 // SetExport stores a value in the environment and marks it as explicitly exported
 func (e *Environment) SetExport(name string, val Object) Object {
 	e.store[name] = val
-	e.exports[name] = true
+	e.markExport(name)
 	return val
 }
 
 // SetLetExport stores a value in the environment, marks it as a let binding AND exported
 func (e *Environment) SetLetExport(name string, val Object) Object {
 	e.store[name] = val
+	e.markLet(name)
+	e.markExport(name)
+	return val
+}
+
+func (e *Environment) markLet(name string) {
+	if e.letBindings == nil {
+		e.letBindings = make(map[string]bool)
+	}
 	e.letBindings[name] = true
+}
+
+func (e *Environment) markExport(name string) {
+	if e.exports == nil {
+		e.exports = make(map[string]bool)
+	}
 	e.exports[name] = true
-	return val
 }
 
 // IsLetBinding checks if a variable was declared with let
@@ -412,8 +497,8 @@ func (e *Environment) IsExported(name string) bool {
 	if e.exports[name] {
 		return true
 	}
-	// Backward compatibility: let bindings are also exported
-	if e.letBindings[name] {
+	// Backward compatibility: let bindings are also exported, except in strict mode
+	if e.letBindings[name] && !e.isStrict() {
 		return true
 	}
 	return false
@@ -469,12 +554,13 @@ func (e *Environment) checkPathAccess(path string, operation string) error {
 		return nil
 	}
 
-	// Convert to absolute path
+	// Convert to absolute path, following symlinks so a link inside an
+	// allowed directory can't reach outside it
 	absPath, err := filepath.Abs(path)
 	if err != nil {
 		return fmt.Errorf("invalid path: %s", err)
 	}
-	absPath = filepath.Clean(absPath)
+	absPath = resolveSymlinks(absPath)
 
 	switch operation {
 	case "read":
@@ -515,7 +601,7 @@ func isPathAllowed(path string, allowList []string) bool {
 
 	// Check if path is within any allowed directory
 	for _, allowed := range allowList {
-		if path == allowed || strings.HasPrefix(path, allowed+string(filepath.Separator)) {
+		if pathWithin(path, resolveSymlinks(allowed)) {
 			return true
 		}
 	}
@@ -532,7 +618,7 @@ func isPathRestricted(path string, restrictList []string) bool {
 
 	// Check if path is within any restricted directory
 	for _, restricted := range restrictList {
-		if path == restricted || strings.HasPrefix(path, restricted+string(filepath.Separator)) {
+		if pathWithin(path, resolveSymlinks(restricted)) {
 			return true
 		}
 	}
@@ -540,6 +626,44 @@ func isPathRestricted(path string, restrictList []string) bool {
 	return false
 }
 
+// maxSymlinks is how many dangling symlinks resolveSymlinks follows in a row
+const maxSymlinks = 40
+
+// resolveSymlinks returns the real location of a path. Paths that don't
+// exist yet, like files about to be written, are resolved from their nearest
+// existing parent, and a dangling symlink is resolved to where it points.
+func resolveSymlinks(path string) string {
+	return resolveSymlinksFollowing(path, maxSymlinks)
+}
+
+func resolveSymlinksFollowing(path string, links int) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	path = filepath.Clean(path)
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path
+	}
+	resolved := filepath.Join(resolveSymlinksFollowing(parent, links), filepath.Base(path))
+
+	// A write through a dangling symlink creates its target
+	if links == 0 {
+		return resolved
+	}
+	if info, err := os.Lstat(resolved); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return resolved
+	}
+	target, err := os.Readlink(resolved)
+	if err != nil {
+		return resolved
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(resolved), target)
+	}
+	return resolveSymlinksFollowing(target, links-1)
+}
+
 // Global constants
 var (
 	NULL  = &Null{}
@@ -549,14 +673,115 @@ var (
 
 // ModuleCache caches imported modules
 type ModuleCache struct {
-	modules map[string]*Dictionary // absolute path -> module dictionary
-	loading map[string]bool        // tracks currently loading modules for cycle detection
+	modules    map[string]Object          // absolute path -> module dictionary or imported data
+	modTimes   map[string]time.Time       // absolute path -> file modification time when loaded
+	dependents map[string]map[string]bool // absolute path -> files that import it
+	loading    map[string]*moduleLoad     // modules currently being evaluated, for circular imports
+	stack      []string                   // import chain being evaluated, outermost first
+}
+
+// moduleLoad tracks a module whose evaluation is in progress. A circular
+// import gets a live proxy of its exports, which is completed when the
+// module finishes loading (like Node's partial exports).
+type moduleLoad struct {
+	env     *Environment
+	exports []string    // names declared at the module's top level
+	proxy   *Dictionary // nil until the module is imported circularly
+	cycle   []string    // the import cycle that reached this module
 }
 
 // Global module cache
 var moduleCache = &ModuleCache{
-	modules: make(map[string]*Dictionary),
-	loading: make(map[string]bool),
+	modules:    make(map[string]Object),
+	modTimes:   make(map[string]time.Time),
+	dependents: make(map[string]map[string]bool),
+	loading:    make(map[string]*moduleLoad),
+}
+
+// store caches a loaded module along with its file's modification time
+func (c *ModuleCache) store(path string, module Object) {
+	c.modules[path] = module
+	if info, err := os.Stat(path); err == nil {
+		c.modTimes[path] = info.ModTime()
+	}
+}
+
+// addDependent records that importer imports path, so editing path also
+// invalidates importer
+func (c *ModuleCache) addDependent(path, importer string) {
+	if importer == "" {
+		return
+	}
+	if abs, err := filepath.Abs(importer); err == nil {
+		importer = abs
+	}
+	if c.dependents[path] == nil {
+		c.dependents[path] = make(map[string]bool)
+	}
+	c.dependents[path][importer] = true
+}
+
+// InvalidateModule removes a module from the import cache, along with every
+// cached module that imports it (directly or indirectly), so the next
+// import reloads them. It returns the invalidated paths, sorted.
+// Watch and serve modes call this when files change; it must not be called
+// while a script is being evaluated.
+func InvalidateModule(path string) []string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+
+	var invalidated []string
+	var invalidate func(p string)
+	invalidate = func(p string) {
+		if _, ok := moduleCache.modules[p]; !ok {
+			return
+		}
+		delete(moduleCache.modules, p)
+		delete(moduleCache.modTimes, p)
+		invalidated = append(invalidated, p)
+		for importer := range moduleCache.dependents[p] {
+			invalidate(importer)
+		}
+	}
+	invalidate(path)
+
+	sort.Strings(invalidated)
+	return invalidated
+}
+
+// InvalidateChangedModules invalidates cached modules whose files have been
+// modified or removed since they were loaded (and the modules that import
+// them). Calling it before each evaluation gives hot reloading without a
+// file watcher. It returns the invalidated paths, sorted.
+func InvalidateChangedModules() []string {
+	var changed []string
+	for path := range moduleCache.modules {
+		info, err := os.Stat(path)
+		if err != nil || !info.ModTime().Equal(moduleCache.modTimes[path]) {
+			changed = append(changed, path)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var invalidated []string
+	for _, path := range changed {
+		for _, p := range InvalidateModule(path) {
+			if !seen[p] {
+				seen[p] = true
+				invalidated = append(invalidated, p)
+			}
+		}
+	}
+	sort.Strings(invalidated)
+	return invalidated
+}
+
+// ClearModuleCache removes every module from the import cache
+func ClearModuleCache() {
+	moduleCache.modules = make(map[string]Object)
+	moduleCache.modTimes = make(map[string]time.Time)
+	moduleCache.dependents = make(map[string]map[string]bool)
 }
 
 // naturalCompare compares two objects using natural sort order
@@ -699,72 +924,6 @@ func objectsEqual(a, b Object) bool {
 	}
 }
 
-// timeToDictWithKind converts a Go time.Time to a Parsley Dictionary with a specified kind
-func timeToDictWithKind(t time.Time, kind string, env *Environment) *Dictionary {
-	pairs := make(map[string]ast.Expression)
-
-	// Mark this as a datetime dictionary for special operator handling
-	pairs["__type"] = &ast.StringLiteral{
-		Token: lexer.Token{Type: lexer.STRING, Literal: "datetime"},
-		Value: "datetime",
-	}
-
-	// Store the kind (datetime, date, or time)
-	pairs["kind"] = &ast.StringLiteral{
-		Token: lexer.Token{Type: lexer.STRING, Literal: kind},
-		Value: kind,
-	}
-
-	// Create integer literals for numeric values with proper tokens
-	pairs["year"] = &ast.IntegerLiteral{
-		Token: lexer.Token{Type: lexer.INT, Literal: fmt.Sprintf("%d", t.Year())},
-		Value: int64(t.Year()),
-	}
-	pairs["month"] = &ast.IntegerLiteral{
-		Token: lexer.Token{Type: lexer.INT, Literal: fmt.Sprintf("%d", t.Month())},
-		Value: int64(t.Month()),
-	}
-	pairs["day"] = &ast.IntegerLiteral{
-		Token: lexer.Token{Type: lexer.INT, Literal: fmt.Sprintf("%d", t.Day())},
-		Value: int64(t.Day()),
-	}
-	pairs["hour"] = &ast.IntegerLiteral{
-		Token: lexer.Token{Type: lexer.INT, Literal: fmt.Sprintf("%d", t.Hour())},
-		Value: int64(t.Hour()),
-	}
-	pairs["minute"] = &ast.IntegerLiteral{
-		Token: lexer.Token{Type: lexer.INT, Literal: fmt.Sprintf("%d", t.Minute())},
-		Value: int64(t.Minute()),
-	}
-	pairs["second"] = &ast.IntegerLiteral{
-		Token: lexer.Token{Type: lexer.INT, Literal: fmt.Sprintf("%d", t.Second())},
-		Value: int64(t.Second()),
-	}
-	pairs["unix"] = &ast.IntegerLiteral{
-		Token: lexer.Token{Type: lexer.INT, Literal: fmt.Sprintf("%d", t.Unix())},
-		Value: t.Unix(),
-	}
-
-	// Create string literals for string values with proper tokens
-	weekday := t.Weekday().String()
-	pairs["weekday"] = &ast.StringLiteral{
-		Token: lexer.Token{Type: lexer.STRING, Literal: weekday},
-		Value: weekday,
-	}
-	iso := t.Format(time.RFC3339)
-	pairs["iso"] = &ast.StringLiteral{
-		Token: lexer.Token{Type: lexer.STRING, Literal: iso},
-		Value: iso,
-	}
-
-	return &Dictionary{Pairs: pairs, Env: env}
-}
-
-// timeToDict converts a Go time.Time to a Parsley Dictionary (defaults to kind: "datetime")
-func timeToDict(t time.Time, env *Environment) *Dictionary {
-	return timeToDictWithKind(t, "datetime", env)
-}
-
 // dictToTime converts a Parsley Dictionary to a Go time.Time
 func dictToTime(dict *Dictionary, env *Environment) (time.Time, error) {
 	// Evaluate the year field
@@ -836,76 +995,6 @@ func dictToTime(dict *Dictionary, env *Environment) (time.Time, error) {
 	), nil
 }
 
-// isDatetimeDict checks if a dictionary is a datetime by looking for __type field
-func isDatetimeDict(dict *Dictionary) bool {
-	if typeExpr, ok := dict.Pairs["__type"]; ok {
-		if strLit, ok := typeExpr.(*ast.StringLiteral); ok {
-			return strLit.Value == "datetime"
-		}
-	}
-	return false
-}
-
-// isDurationDict checks if a dictionary is a duration by looking for __type field
-func isDurationDict(dict *Dictionary) bool {
-	if typeExpr, ok := dict.Pairs["__type"]; ok {
-		if strLit, ok := typeExpr.(*ast.StringLiteral); ok {
-			return strLit.Value == "duration"
-		}
-	}
-	return false
-}
-
-// getDurationComponents extracts months and seconds from a duration dictionary
-func getDurationComponents(dict *Dictionary, env *Environment) (int64, int64, error) {
-	monthsExpr, ok := dict.Pairs["months"]
-	if !ok {
-		return 0, 0, fmt.Errorf("duration dictionary missing months field")
-	}
-	monthsObj := Eval(monthsExpr, env)
-	monthsInt, ok := monthsObj.(*Integer)
-	if !ok {
-		return 0, 0, fmt.Errorf("months must be an integer")
-	}
-
-	secondsExpr, ok := dict.Pairs["seconds"]
-	if !ok {
-		return 0, 0, fmt.Errorf("duration dictionary missing seconds field")
-	}
-	secondsObj := Eval(secondsExpr, env)
-	secondsInt, ok := secondsObj.(*Integer)
-	if !ok {
-		return 0, 0, fmt.Errorf("seconds must be an integer")
-	}
-
-	return monthsInt.Value, secondsInt.Value, nil
-}
-
-// getDatetimeKind extracts the kind from a datetime dictionary (defaults to "datetime")
-func getDatetimeKind(dict *Dictionary, env *Environment) string {
-	if kindExpr, ok := dict.Pairs["kind"]; ok {
-		kindObj := Eval(kindExpr, env)
-		if kindStr, ok := kindObj.(*String); ok {
-			return kindStr.Value
-		}
-	}
-	return "datetime"
-}
-
-// getDatetimeUnix extracts the unix timestamp from a datetime dictionary
-func getDatetimeUnix(dict *Dictionary, env *Environment) (int64, error) {
-	unixExpr, ok := dict.Pairs["unix"]
-	if !ok {
-		return 0, fmt.Errorf("datetime dictionary missing unix field")
-	}
-	unixObj := Eval(unixExpr, env)
-	unixInt, ok := unixObj.(*Integer)
-	if !ok {
-		return 0, fmt.Errorf("unix field is not an integer")
-	}
-	return unixInt.Value, nil
-}
-
 // getMondayLocale maps a BCP 47 locale string to monday.Locale
 func getMondayLocale(locale string) monday.Locale {
 	// Normalize locale string
@@ -1097,173 +1186,6 @@ func getDateFormatForStyle(style string, locale monday.Locale) string {
 	}
 }
 
-// datetimeDictToString converts a datetime dictionary to a human-friendly ISO 8601 string
-// Uses the "kind" field to determine output format: "datetime", "date", or "time"
-func datetimeDictToString(dict *Dictionary) string {
-	// Check for kind field to determine output format
-	kind := "datetime" // default
-	if kindExpr, ok := dict.Pairs["kind"]; ok {
-		if kindLit, ok := kindExpr.(*ast.StringLiteral); ok {
-			kind = kindLit.Value
-		}
-	}
-
-	// Extract time components
-	var hour, minute, second int64
-	if hExpr, ok := dict.Pairs["hour"]; ok {
-		if hLit, ok := hExpr.(*ast.IntegerLiteral); ok {
-			hour = hLit.Value
-		}
-	}
-	if minExpr, ok := dict.Pairs["minute"]; ok {
-		if minLit, ok := minExpr.(*ast.IntegerLiteral); ok {
-			minute = minLit.Value
-		}
-	}
-	if sExpr, ok := dict.Pairs["second"]; ok {
-		if sLit, ok := sExpr.(*ast.IntegerLiteral); ok {
-			second = sLit.Value
-		}
-	}
-
-	// Extract date components
-	var year, month, day int64
-	if yearExpr, ok := dict.Pairs["year"]; ok {
-		if yLit, ok := yearExpr.(*ast.IntegerLiteral); ok {
-			year = yLit.Value
-		}
-	}
-	if mExpr, ok := dict.Pairs["month"]; ok {
-		if mLit, ok := mExpr.(*ast.IntegerLiteral); ok {
-			month = mLit.Value
-		}
-	}
-	if dExpr, ok := dict.Pairs["day"]; ok {
-		if dLit, ok := dExpr.(*ast.IntegerLiteral); ok {
-			day = dLit.Value
-		}
-	}
-
-	// Format based on kind
-	switch kind {
-	case "time":
-		// Time only without seconds: HH:MM
-		return fmt.Sprintf("%02d:%02d", hour, minute)
-
-	case "time_seconds":
-		// Time with seconds: HH:MM:SS
-		return fmt.Sprintf("%02d:%02d:%02d", hour, minute, second)
-
-	case "date":
-		// Date only: YYYY-MM-DD
-		return fmt.Sprintf("%04d-%02d-%02d", year, month, day)
-
-	default:
-		// Full datetime: YYYY-MM-DDTHH:MM:SSZ
-		// If time is all zeros, still include it for datetime kind
-		return fmt.Sprintf("%04d-%02d-%02dT%02d:%02d:%02dZ", year, month, day, hour, minute, second)
-	}
-}
-
-// durationDictToString converts a duration dictionary to a human-readable string
-func durationDictToString(dict *Dictionary) string {
-	var months, seconds int64
-
-	// Get months
-	if monthsExpr, ok := dict.Pairs["months"]; ok {
-		monthsObj := Eval(monthsExpr, dict.Env)
-		if i, ok := monthsObj.(*Integer); ok {
-			months = i.Value
-		}
-	}
-
-	// Get seconds
-	if secondsExpr, ok := dict.Pairs["seconds"]; ok {
-		secondsObj := Eval(secondsExpr, dict.Env)
-		if i, ok := secondsObj.(*Integer); ok {
-			seconds = i.Value
-		}
-	}
-
-	// Handle zero duration
-	if months == 0 && seconds == 0 {
-		return "0 seconds"
-	}
-
-	var parts []string
-	isNegative := months < 0 || seconds < 0
-
-	// Handle negative values
-	if months < 0 {
-		months = -months
-	}
-	if seconds < 0 {
-		seconds = -seconds
-	}
-
-	// Convert months to years and months
-	years := months / 12
-	months = months % 12
-
-	if years > 0 {
-		if years == 1 {
-			parts = append(parts, "1 year")
-		} else {
-			parts = append(parts, fmt.Sprintf("%d years", years))
-		}
-	}
-	if months > 0 {
-		if months == 1 {
-			parts = append(parts, "1 month")
-		} else {
-			parts = append(parts, fmt.Sprintf("%d months", months))
-		}
-	}
-
-	// Convert seconds to days, hours, minutes, seconds
-	days := seconds / 86400
-	seconds = seconds % 86400
-	hours := seconds / 3600
-	seconds = seconds % 3600
-	minutes := seconds / 60
-	seconds = seconds % 60
-
-	if days > 0 {
-		if days == 1 {
-			parts = append(parts, "1 day")
-		} else {
-			parts = append(parts, fmt.Sprintf("%d days", days))
-		}
-	}
-	if hours > 0 {
-		if hours == 1 {
-			parts = append(parts, "1 hour")
-		} else {
-			parts = append(parts, fmt.Sprintf("%d hours", hours))
-		}
-	}
-	if minutes > 0 {
-		if minutes == 1 {
-			parts = append(parts, "1 minute")
-		} else {
-			parts = append(parts, fmt.Sprintf("%d minutes", minutes))
-		}
-	}
-	if seconds > 0 {
-		if seconds == 1 {
-			parts = append(parts, "1 second")
-		} else {
-			parts = append(parts, fmt.Sprintf("%d seconds", seconds))
-		}
-	}
-
-	result := strings.Join(parts, " ")
-	if isNegative {
-		return "-" + result
-	}
-	return result
-}
-
 // regexDictToString converts a regex dictionary to its literal form /pattern/flags
 func regexDictToString(dict *Dictionary) string {
 	var pattern, flags string
@@ -1287,83 +1209,17 @@ func regexDictToString(dict *Dictionary) string {
 
 // fileDictToString converts a file dictionary to its path string
 func fileDictToString(dict *Dictionary) string {
-	// Extract path components from the file dict
-	var components []string
-	var isAbsolute bool
-
-	if compExpr, ok := dict.Pairs["_pathComponents"]; ok {
-		compObj := Eval(compExpr, dict.Env)
-		if arr, ok := compObj.(*Array); ok {
-			for _, elem := range arr.Elements {
-				if str, ok := elem.(*String); ok {
-					components = append(components, str.Value)
-				}
-			}
-		}
-	}
-
-	if absExpr, ok := dict.Pairs["_pathAbsolute"]; ok {
-		absObj := Eval(absExpr, dict.Env)
-		if b, ok := absObj.(*Boolean); ok {
-			isAbsolute = b.Value
-		}
-	}
-
-	// Build path string
-	var result strings.Builder
-	for i, comp := range components {
-		if comp == "" && i == 0 && isAbsolute {
-			result.WriteString("/")
-		} else {
-			if i > 0 && (i > 1 || !isAbsolute) {
-				result.WriteString("/")
-			}
-			result.WriteString(comp)
-		}
+	if p := handlePath(dict); p != nil {
+		return p.Inspect()
 	}
-
-	return result.String()
+	return ""
 }
 
 // dirDictToString converts a directory dictionary to its path string (with trailing slash)
 func dirDictToString(dict *Dictionary) string {
-	// Extract path components from the dir dict
-	var components []string
-	var isAbsolute bool
-
-	if compExpr, ok := dict.Pairs["_pathComponents"]; ok {
-		compObj := Eval(compExpr, dict.Env)
-		if arr, ok := compObj.(*Array); ok {
-			for _, elem := range arr.Elements {
-				if str, ok := elem.(*String); ok {
-					components = append(components, str.Value)
-				}
-			}
-		}
-	}
-
-	if absExpr, ok := dict.Pairs["_pathAbsolute"]; ok {
-		absObj := Eval(absExpr, dict.Env)
-		if b, ok := absObj.(*Boolean); ok {
-			isAbsolute = b.Value
-		}
-	}
-
-	// Build path string
-	var result strings.Builder
-	for i, comp := range components {
-		if comp == "" && i == 0 && isAbsolute {
-			result.WriteString("/")
-		} else {
-			if i > 0 && (i > 1 || !isAbsolute) {
-				result.WriteString("/")
-			}
-			result.WriteString(comp)
-		}
-	}
+	pathStr := fileDictToString(dict)
 
 	// Add trailing slash for directories
-	pathStr := result.String()
 	if !strings.HasSuffix(pathStr, "/") {
 		pathStr += "/"
 	}
@@ -1384,79 +1240,9 @@ func requestDictToString(dict *Dictionary) string {
 		}
 	}
 
-	// Reconstruct URL from _url_* fields
-	var result strings.Builder
-
-	// Scheme
-	if schemeExpr, ok := dict.Pairs["_url_scheme"]; ok {
-		schemeObj := Eval(schemeExpr, dict.Env)
-		if str, ok := schemeObj.(*String); ok {
-			result.WriteString(str.Value)
-			result.WriteString("://")
-		}
-	}
-
-	// Host
-	if hostExpr, ok := dict.Pairs["_url_host"]; ok {
-		hostObj := Eval(hostExpr, dict.Env)
-		if str, ok := hostObj.(*String); ok {
-			result.WriteString(str.Value)
-		}
-	}
-
-	// Port
-	if portExpr, ok := dict.Pairs["_url_port"]; ok {
-		portObj := Eval(portExpr, dict.Env)
-		if i, ok := portObj.(*Integer); ok && i.Value != 0 {
-			result.WriteString(":")
-			result.WriteString(strconv.FormatInt(i.Value, 10))
-		}
-	}
-
-	// Path
-	if pathExpr, ok := dict.Pairs["_url_path"]; ok {
-		pathObj := Eval(pathExpr, dict.Env)
-		if arr, ok := pathObj.(*Array); ok && len(arr.Elements) > 0 {
-			startIdx := 0
-			if str, ok := arr.Elements[0].(*String); ok && str.Value == "" {
-				result.WriteString("/")
-				startIdx = 1
-			} else if len(arr.Elements) > 0 {
-				result.WriteString("/")
-			}
-			for i := startIdx; i < len(arr.Elements); i++ {
-				if str, ok := arr.Elements[i].(*String); ok && str.Value != "" {
-					if i > startIdx {
-						result.WriteString("/")
-					}
-					result.WriteString(str.Value)
-				}
-			}
-		}
-	}
-
-	// Query
-	if queryExpr, ok := dict.Pairs["_url_query"]; ok {
-		queryObj := Eval(queryExpr, dict.Env)
-		if queryDict, ok := queryObj.(*Dictionary); ok && len(queryDict.Pairs) > 0 {
-			result.WriteString("?")
-			first := true
-			for key, expr := range queryDict.Pairs {
-				if !first {
-					result.WriteString("&")
-				}
-				first = false
-				result.WriteString(key)
-				result.WriteString("=")
-				valObj := Eval(expr, dict.Env)
-				if str, ok := valObj.(*String); ok {
-					result.WriteString(str.Value)
-				}
-			}
-		}
+	if u := requestUrl(dict); u != nil {
+		urlStr = u.requestString()
 	}
-
-	urlStr = result.String()
 	return method + " " + urlStr
 }
 
@@ -1582,18 +1368,18 @@ func evalDatetimeLiteral(node *ast.DatetimeLiteral, env *Environment) Object {
 	}
 
 	// Convert to dictionary using the new function with kind
-	return timeToDictWithKind(t, kind, env)
+	return newDatetime(t, kind)
 }
 
 // evalDurationLiteral parses a duration literal like @2h30m, @7d, @1y6mo
 func evalDurationLiteral(node *ast.DurationLiteral, env *Environment) Object {
-	// Parse the duration string into months and seconds
-	months, seconds, err := parseDurationString(node.Value)
+	// Parse the duration string into months and milliseconds
+	months, millis, err := parseDurationString(node.Value)
 	if err != nil {
 		return newError("invalid duration literal: %s", err.Error())
 	}
 
-	return durationToDict(months, seconds, env)
+	return newDuration(months, millis)
 }
 
 // evalPathLiteral parses a path literal like @/usr/local/bin or @./config.json
@@ -1603,26 +1389,26 @@ func evalPathLiteral(node *ast.PathLiteral, env *Environment) Object {
 	switch node.Value {
 	case "-":
 		// @- is context-dependent: stdin for reads, stdout for writes
-		return stdioToDict("stdio", env)
+		return newStdioPath("stdio")
 	case "stdin":
-		return stdioToDict("stdin", env)
+		return newStdioPath("stdin")
 	case "stdout":
-		return stdioToDict("stdout", env)
+		return newStdioPath("stdout")
 	case "stderr":
-		return stdioToDict("stderr", env)
+		return newStdioPath("stderr")
 	}
 
 	// Parse the path string into components
 	components, isAbsolute := parsePathString(node.Value)
 
 	// Create path dictionary
-	return pathToDict(components, isAbsolute, env)
+	return newPath(components, isAbsolute)
 }
 
 // evalUrlLiteral parses a URL literal like @https://example.com/api
 func evalUrlLiteral(node *ast.UrlLiteral, env *Environment) Object {
 	// Parse the URL string
-	urlDict, err := parseUrlString(node.Value, env)
+	urlDict, err := parseUrlString(node.Value)
 	if err != nil {
 		return newError("invalid URL literal: %s", err.Error())
 	}
@@ -1633,7 +1419,7 @@ func evalUrlLiteral(node *ast.UrlLiteral, env *Environment) Object {
 // evalPathTemplateLiteral evaluates an interpolated path template like @(./path/{name}/file)
 func evalPathTemplateLiteral(node *ast.PathTemplateLiteral, env *Environment) Object {
 	// First, interpolate the template
-	interpolated := interpolatePathUrlTemplate(node.Value, env)
+	interpolated := interpolatePathUrlTemplate(node.Value, literalPos(node.Token, 2), env)
 	if isError(interpolated) {
 		return interpolated
 	}
@@ -1645,13 +1431,13 @@ func evalPathTemplateLiteral(node *ast.PathTemplateLiteral, env *Environment) Ob
 	components, isAbsolute := parsePathString(pathStr)
 
 	// Create path dictionary
-	return pathToDict(components, isAbsolute, env)
+	return newPath(components, isAbsolute)
 }
 
 // evalUrlTemplateLiteral evaluates an interpolated URL template like @(https://api.com/{version}/users)
 func evalUrlTemplateLiteral(node *ast.UrlTemplateLiteral, env *Environment) Object {
 	// First, interpolate the template
-	interpolated := interpolatePathUrlTemplate(node.Value, env)
+	interpolated := interpolatePathUrlTemplate(node.Value, literalPos(node.Token, 2), env)
 	if isError(interpolated) {
 		return interpolated
 	}
@@ -1660,7 +1446,7 @@ func evalUrlTemplateLiteral(node *ast.UrlTemplateLiteral, env *Environment) Obje
 	urlStr := interpolated.(*String).Value
 
 	// Parse the URL string
-	urlDict, err := parseUrlString(urlStr, env)
+	urlDict, err := parseUrlString(urlStr)
 	if err != nil {
 		return newError("invalid URL in template: %s", err.Error())
 	}
@@ -1671,7 +1457,7 @@ func evalUrlTemplateLiteral(node *ast.UrlTemplateLiteral, env *Environment) Obje
 // evalDatetimeTemplateLiteral evaluates an interpolated datetime template like @(2024-{month}-{day})
 func evalDatetimeTemplateLiteral(node *ast.DatetimeTemplateLiteral, env *Environment) Object {
 	// First, interpolate the template
-	interpolated := interpolatePathUrlTemplate(node.Value, env)
+	interpolated := interpolatePathUrlTemplate(node.Value, literalPos(node.Token, 2), env)
 	if isError(interpolated) {
 		return interpolated
 	}
@@ -1728,12 +1514,12 @@ func evalDatetimeTemplateLiteral(node *ast.DatetimeTemplateLiteral, env *Environ
 	}
 
 	// Convert to dictionary using the function with kind
-	return timeToDictWithKind(t, kind, env)
+	return newDatetime(t, kind)
 }
 
 // interpolatePathUrlTemplate processes {expr} interpolations in path/URL templates
 // This is similar to evalTemplateLiteral but returns a String object
-func interpolatePathUrlTemplate(template string, env *Environment) Object {
+func interpolatePathUrlTemplate(template string, pos fragmentPos, env *Environment) Object {
 	var result strings.Builder
 
 	i := 0
@@ -1770,12 +1556,9 @@ func interpolatePathUrlTemplate(template string, env *Environment) Object {
 			}
 
 			// Parse and evaluate the expression
-			l := lexer.New(exprStr)
-			p := parser.New(l)
-			program := p.ParseProgram()
-
-			if len(p.Errors()) > 0 {
-				return newError("error parsing template expression: %s", p.Errors()[0])
+			program, errObj := parseFragment(exprStr, pos.at(template, exprStart), "template expression")
+			if errObj != nil {
+				return errObj
 			}
 
 			// Evaluate the expression
@@ -1801,12 +1584,12 @@ func interpolatePathUrlTemplate(template string, env *Environment) Object {
 	return &String{Value: result.String()}
 }
 
-// parseDurationString parses a duration string like "2h30m" or "1y6mo" or "-1d" into months and seconds
-// Returns (months, seconds, error)
+// parseDurationString parses a duration string like "2h30m" or "1y6mo" or "-1d" or "500ms" into months and milliseconds
+// Returns (months, milliseconds, error)
 // Negative durations (e.g., "-1d") return negative values
 func parseDurationString(s string) (int64, int64, error) {
 	var months int64
-	var seconds int64
+	var millis int64
 	negative := false
 
 	i := 0
@@ -1839,9 +1622,9 @@ func parseDurationString(s string) (int64, int64, error) {
 		}
 
 		var unit string
-		// Check for "mo" (months)
-		if i+1 < len(s) && s[i:i+2] == "mo" {
-			unit = "mo"
+		// Check for "mo" (months) and "ms" (milliseconds)
+		if i+1 < len(s) && (s[i:i+2] == "mo" || s[i:i+2] == "ms") {
+			unit = s[i : i+2]
 			i += 2
 		} else {
 			// Single letter unit
@@ -1849,22 +1632,24 @@ func parseDurationString(s string) (int64, int64, error) {
 			i++
 		}
 
-		// Convert to months or seconds
+		// Convert to months or milliseconds
 		switch unit {
 		case "y": // years = 12 months
 			months += num * 12
 		case "mo": // months
 			months += num
 		case "w": // weeks = 7 days = 7 * 24 * 60 * 60 seconds
-			seconds += num * 7 * 24 * 60 * 60
+			millis += num * 7 * 24 * 60 * 60 * 1000
 		case "d": // days = 24 * 60 * 60 seconds
-			seconds += num * 24 * 60 * 60
+			millis += num * 24 * 60 * 60 * 1000
 		case "h": // hours = 60 * 60 seconds
-			seconds += num * 60 * 60
+			millis += num * 60 * 60 * 1000
 		case "m": // minutes = 60 seconds
-			seconds += num * 60
+			millis += num * 60 * 1000
 		case "s": // seconds
-			seconds += num
+			millis += num * 1000
+		case "ms": // milliseconds
+			millis += num
 		default:
 			return 0, 0, fmt.Errorf("unknown unit: %s", unit)
 		}
@@ -1873,43 +1658,108 @@ func parseDurationString(s string) (int64, int64, error) {
 	// Apply negative sign if present
 	if negative {
 		months = -months
-		seconds = -seconds
+		millis = -millis
 	}
 
-	return months, seconds, nil
+	return months, millis, nil
 }
 
-// durationToDict converts months and seconds into a duration dictionary
-func durationToDict(months, seconds int64, env *Environment) *Dictionary {
-	dict := &Dictionary{Pairs: make(map[string]ast.Expression)}
-
-	// Add __type field
-	dict.Pairs["__type"] = &ast.StringLiteral{
-		Token: lexer.Token{Type: lexer.STRING, Literal: "duration"},
-		Value: "duration",
-	}
-
-	// Add months field
-	dict.Pairs["months"] = &ast.IntegerLiteral{
-		Token: lexer.Token{Type: lexer.INT, Literal: fmt.Sprintf("%d", months)},
-		Value: months,
-	}
-
-	// Add seconds field
-	dict.Pairs["seconds"] = &ast.IntegerLiteral{
-		Token: lexer.Token{Type: lexer.INT, Literal: fmt.Sprintf("%d", seconds)},
-		Value: seconds,
+// parseDurationInput parses a user-supplied duration string into months and milliseconds.
+// It accepts Parsley duration syntax with optional spaces ("1h 30m", "-2d 12h")
+// and ISO 8601 durations ("PT1H30M", "P1Y2M10DT2H30M", "-P1D").
+func parseDurationInput(s string) (int64, int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, 0, fmt.Errorf("empty duration")
 	}
 
-	// Add totalSeconds field (only present if no months)
-	if months == 0 {
-		dict.Pairs["totalSeconds"] = &ast.IntegerLiteral{
-			Token: lexer.Token{Type: lexer.INT, Literal: fmt.Sprintf("%d", seconds)},
-			Value: seconds,
+	body := strings.TrimPrefix(s, "-")
+	if len(body) > 0 && (body[0] == 'P' || body[0] == 'p') {
+		months, millis, err := parseISODuration(body)
+		if err != nil {
+			return 0, 0, err
 		}
+		if body != s {
+			months, millis = -months, -millis
+		}
+		return months, millis, nil
 	}
 
-	return dict
+	return parseDurationString(strings.Join(strings.Fields(s), ""))
+}
+
+// parseISODuration parses an ISO 8601 duration (without sign) such as "P1Y2M3DT4H5M6S",
+// "PT0.5S" or "P2W" into months and milliseconds
+func parseISODuration(s string) (int64, int64, error) {
+	var months, millis int64
+	s = strings.ToUpper(s)
+
+	if len(s) < 2 || s[0] != 'P' {
+		return 0, 0, fmt.Errorf("invalid ISO 8601 duration: %s", s)
+	}
+
+	inTime := false
+	i := 1
+	for i < len(s) {
+		if s[i] == 'T' {
+			if inTime || i == len(s)-1 {
+				return 0, 0, fmt.Errorf("invalid ISO 8601 duration: %s", s)
+			}
+			inTime = true
+			i++
+			continue
+		}
+
+		numStart := i
+		for i < len(s) && isDigit(rune(s[i])) {
+			i++
+		}
+		if numStart == i || i >= len(s) {
+			return 0, 0, fmt.Errorf("invalid ISO 8601 duration: %s", s)
+		}
+
+		num, err := strconv.ParseInt(s[numStart:i], 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		// Seconds can have a fraction, kept to the millisecond
+		if inTime && (s[i] == '.' || s[i] == ',') {
+			fracStart := i + 1
+			i++
+			for i < len(s) && isDigit(rune(s[i])) {
+				i++
+			}
+			if fracStart == i || i >= len(s) || s[i] != 'S' {
+				return 0, 0, fmt.Errorf("invalid ISO 8601 duration: %s", s)
+			}
+			frac := (s[fracStart:i] + "00")[:3]
+			ms, _ := strconv.ParseInt(frac, 10, 64)
+			millis += ms
+		}
+
+		switch designator := s[i]; {
+		case !inTime && designator == 'Y':
+			months += num * 12
+		case !inTime && designator == 'M':
+			months += num
+		case !inTime && designator == 'W':
+			millis += num * 7 * 24 * 60 * 60 * 1000
+		case !inTime && designator == 'D':
+			millis += num * 24 * 60 * 60 * 1000
+		case inTime && designator == 'H':
+			millis += num * 60 * 60 * 1000
+		case inTime && designator == 'M':
+			millis += num * 60 * 1000
+		case inTime && designator == 'S':
+			millis += num * 1000
+		default:
+			return 0, 0, fmt.Errorf("invalid ISO 8601 duration: unexpected %q", designator)
+		}
+		i++
+	}
+
+	return months, millis, nil
 }
 
 // isDigit checks if a rune is a digit
@@ -1927,21 +1777,11 @@ func isRegexDict(dict *Dictionary) bool {
 	return false
 }
 
-// isPathDict checks if a dictionary is a path by looking for __type field
-func isPathDict(dict *Dictionary) bool {
-	if typeExpr, ok := dict.Pairs["__type"]; ok {
-		if strLit, ok := typeExpr.(*ast.StringLiteral); ok {
-			return strLit.Value == "path"
-		}
-	}
-	return false
-}
-
-// isUrlDict checks if a dictionary is a URL by looking for __type field
-func isUrlDict(dict *Dictionary) bool {
+// isMatchDict checks if a dictionary is a regex match object
+func isMatchDict(dict *Dictionary) bool {
 	if typeExpr, ok := dict.Pairs["__type"]; ok {
 		if strLit, ok := typeExpr.(*ast.StringLiteral); ok {
-			return strLit.Value == "url"
+			return strLit.Value == "match"
 		}
 	}
 	return false
@@ -2008,7 +1848,8 @@ func tagDictToString(dict *Dictionary) string {
 
 	// Add attributes
 	if attrsDict != nil && len(attrsDict.Pairs) > 0 {
-		for key, expr := range attrsDict.Pairs {
+		for _, key := range sortedAttrNames(attrsDict) {
+			expr := attrsDict.Pairs[key]
 			result.WriteByte(' ')
 			result.WriteString(key)
 			result.WriteString(`="`)
@@ -2057,8 +1898,9 @@ func compileRegex(pattern, flags string) (*regexp.Regexp, error) {
 			prefix += "(?m)"
 		case 's': // dot matches newline
 			prefix += "(?s)"
+		case 'x': // verbose: whitespace and # comments are ignored
+			pattern = stripVerboseRegex(pattern)
 			// 'g' (global) is handled by match operator, not compilation
-			// Other flags like 'x' (verbose) could be added
 		}
 	}
 
@@ -2067,7 +1909,7 @@ func compileRegex(pattern, flags string) (*regexp.Regexp, error) {
 }
 
 // evalMatchExpression handles string ~ regex matching
-// Returns an array of matches (with captures) or null if no match
+// Returns a match object or null if no match
 func evalMatchExpression(tok lexer.Token, text string, regexDict *Dictionary, env *Environment) Object {
 	// Extract pattern and flags from regex dictionary
 	patternExpr, ok := regexDict.Pairs["pattern"]
@@ -2095,19 +1937,13 @@ func evalMatchExpression(tok lexer.Token, text string, regexDict *Dictionary, en
 		return newErrorWithPos(tok, "invalid regex: %s", err.Error())
 	}
 
-	// Find matches
-	matches := re.FindStringSubmatch(text)
-	if matches == nil {
+	// Find the first match
+	loc := re.FindStringSubmatchIndex(text)
+	if loc == nil {
 		return NULL // No match - returns null (falsy)
 	}
 
-	// Convert matches to array of strings
-	elements := make([]Object, len(matches))
-	for i, match := range matches {
-		elements[i] = &String{Value: match}
-	}
-
-	return &Array{Elements: elements}
+	return regexMatch(re, text, loc, env)
 }
 
 // cleanPathComponents implements Rob Pike's cleanname algorithm from Plan 9
@@ -2172,15 +2008,17 @@ func parsePathString(pathStr string) ([]string, bool) {
 		return []string{"."}, false
 	}
 
+	// A Windows drive or UNC share becomes the first component
+	volume, pathStr := splitVolume(pathStr)
+
 	// Detect absolute vs relative
-	isAbsolute := false
+	isAbsolute := volume != ""
 	hasLeadingDot := false
-	if pathStr[0] == '/' {
-		isAbsolute = true
-	} else if len(pathStr) >= 2 && pathStr[1] == ':' {
-		// Windows drive letter (C:, D:, etc.)
+	if pathStr == "" {
+		// Just a volume
+	} else if pathStr[0] == '/' || pathStr[0] == '\\' {
 		isAbsolute = true
-	} else if pathStr[0] == '.' && (len(pathStr) == 1 || pathStr[1] == '/') {
+	} else if pathStr[0] == '.' && (len(pathStr) == 1 || isPathSeparator(pathStr[1])) {
 		// Starts with ./ - remember this for output
 		hasLeadingDot = true
 	} else if pathStr[0] == '~' {
@@ -2202,6 +2040,9 @@ func parsePathString(pathStr string) ([]string, bool) {
 
 	// Clean the path components
 	cleaned := cleanPathComponents(components, isAbsolute)
+	if volume != "" {
+		cleaned[0] = volume
+	}
 
 	// For relative paths that originally started with ./, preserve that style
 	// unless the cleaned result already starts with . or ..
@@ -2212,126 +2053,27 @@ func parsePathString(pathStr string) ([]string, bool) {
 	return cleaned, isAbsolute
 }
 
-// pathToDict creates a path dictionary from components
-func pathToDict(components []string, isAbsolute bool, env *Environment) *Dictionary {
-	pairs := make(map[string]ast.Expression)
-
-	// Add __type field
-	pairs["__type"] = &ast.StringLiteral{
-		Token: lexer.Token{Type: lexer.STRING, Literal: "path"},
-		Value: "path",
-	}
-
-	// Add components as array literal
-	componentExprs := make([]ast.Expression, len(components))
-	for i, comp := range components {
-		componentExprs[i] = &ast.StringLiteral{
-			Token: lexer.Token{Type: lexer.STRING, Literal: comp},
-			Value: comp,
-		}
-	}
-	pairs["components"] = &ast.ArrayLiteral{
-		Token:    lexer.Token{Type: lexer.LBRACKET, Literal: "["},
-		Elements: componentExprs,
-	}
-
-	// Add absolute flag
-	tokenType := lexer.FALSE
-	tokenLiteral := "false"
-	if isAbsolute {
-		tokenType = lexer.TRUE
-		tokenLiteral = "true"
-	}
-	pairs["absolute"] = &ast.Boolean{
-		Token: lexer.Token{Type: tokenType, Literal: tokenLiteral},
-		Value: isAbsolute,
-	}
-
-	return &Dictionary{Pairs: pairs, Env: env}
-}
-
-// stdioToDict creates a path dictionary for stdin/stdout/stderr
-func stdioToDict(stream string, env *Environment) *Dictionary {
-	pairs := make(map[string]ast.Expression)
-
-	// Add __type field
-	pairs["__type"] = &ast.StringLiteral{
-		Token: lexer.Token{Type: lexer.STRING, Literal: "path"},
-		Value: "path",
-	}
-
-	// Add __stdio field to mark this as a stdio path
-	pairs["__stdio"] = &ast.StringLiteral{
-		Token: lexer.Token{Type: lexer.STRING, Literal: stream},
-		Value: stream,
-	}
-
-	// Add components as array with just "-"
-	pairs["components"] = &ast.ArrayLiteral{
-		Token: lexer.Token{Type: lexer.LBRACKET, Literal: "["},
-		Elements: []ast.Expression{
-			&ast.StringLiteral{
-				Token: lexer.Token{Type: lexer.STRING, Literal: "-"},
-				Value: "-",
-			},
-		},
-	}
-
-	// Not absolute
-	pairs["absolute"] = &ast.Boolean{
-		Token: lexer.Token{Type: lexer.FALSE, Literal: "false"},
-		Value: false,
-	}
-
-	// Add path property as "-" for display
-	pairs["path"] = &ast.StringLiteral{
-		Token: lexer.Token{Type: lexer.STRING, Literal: "-"},
-		Value: "-",
-	}
-
-	// Add name property
-	pairs["name"] = &ast.StringLiteral{
-		Token: lexer.Token{Type: lexer.STRING, Literal: stream},
-		Value: stream,
-	}
-
-	return &Dictionary{Pairs: pairs, Env: env}
-}
-
 // parseUrlString parses a URL string into components
 // Supports: scheme://[user:pass@]host[:port]/path?query#fragment
-func parseUrlString(urlStr string, env *Environment) (*Dictionary, error) {
+func parseUrlString(urlStr string) (*Url, error) {
 	// Simple URL parsing (not using net/url to keep it simple)
-	pairs := make(map[string]ast.Expression)
-
-	// Add __type field
-	pairs["__type"] = &ast.StringLiteral{
-		Token: lexer.Token{Type: lexer.STRING, Literal: "url"},
-		Value: "url",
-	}
+	u := &Url{Query: map[string]string{}, Path: []string{}}
 
 	// Parse scheme
 	schemeEnd := strings.Index(urlStr, "://")
 	if schemeEnd == -1 {
 		return nil, fmt.Errorf("invalid URL: missing scheme (expected scheme://...)")
 	}
-	scheme := urlStr[:schemeEnd]
+	u.Scheme = urlStr[:schemeEnd]
 	rest := urlStr[schemeEnd+3:]
 
-	pairs["scheme"] = &ast.StringLiteral{
-		Token: lexer.Token{Type: lexer.STRING, Literal: scheme},
-		Value: scheme,
-	}
-
 	// Parse fragment (if present)
-	var fragment string
 	if fragIdx := strings.Index(rest, "#"); fragIdx != -1 {
-		fragment = rest[fragIdx+1:]
+		u.Fragment = rest[fragIdx+1:]
 		rest = rest[:fragIdx]
 	}
 
 	// Parse query (if present)
-	queryPairs := make(map[string]ast.Expression)
 	if queryIdx := strings.Index(rest, "?"); queryIdx != -1 {
 		queryStr := rest[queryIdx+1:]
 		rest = rest[:queryIdx]
@@ -2342,450 +2084,174 @@ func parseUrlString(urlStr string, env *Environment) (*Dictionary, error) {
 				continue
 			}
 			parts := strings.SplitN(param, "=", 2)
-			key := parts[0]
 			value := ""
 			if len(parts) > 1 {
 				value = parts[1]
 			}
-			queryPairs[key] = &ast.StringLiteral{
-				Token: lexer.Token{Type: lexer.STRING, Literal: value},
-				Value: value,
-			}
+			u.Query[parts[0]] = value
 		}
 	}
-	pairs["query"] = &ast.DictionaryLiteral{
-		Token: lexer.Token{Type: lexer.LBRACE, Literal: "{"},
-		Pairs: queryPairs,
-	}
 
 	// Parse path (if present)
-	pathComponents := []string{}
-	var pathStr string
 	if pathIdx := strings.Index(rest, "/"); pathIdx != -1 {
-		pathStr = rest[pathIdx:]
+		u.Path, _ = parsePathString(rest[pathIdx:])
 		rest = rest[:pathIdx]
-		pathComponents, _ = parsePathString(pathStr)
-	}
-
-	pathExprs := make([]ast.Expression, len(pathComponents))
-	for i, comp := range pathComponents {
-		pathExprs[i] = &ast.StringLiteral{
-			Token: lexer.Token{Type: lexer.STRING, Literal: comp},
-			Value: comp,
-		}
-	}
-	pairs["path"] = &ast.ArrayLiteral{
-		Token:    lexer.Token{Type: lexer.LBRACKET, Literal: "["},
-		Elements: pathExprs,
 	}
 
-	// Parse authority (user:pass@host:port)
-	var username, password, host string
-	var port int64 = 0
-
 	// Check for userinfo (user:pass@)
 	if atIdx := strings.Index(rest, "@"); atIdx != -1 {
 		userinfo := rest[:atIdx]
 		rest = rest[atIdx+1:]
 
 		if colonIdx := strings.Index(userinfo, ":"); colonIdx != -1 {
-			username = userinfo[:colonIdx]
-			password = userinfo[colonIdx+1:]
+			u.Username = userinfo[:colonIdx]
+			u.Password = userinfo[colonIdx+1:]
 		} else {
-			username = userinfo
+			u.Username = userinfo
 		}
 	}
 
 	// Parse host:port
 	if colonIdx := strings.Index(rest, ":"); colonIdx != -1 {
-		host = rest[:colonIdx]
-		portStr := rest[colonIdx+1:]
-		if p, err := strconv.ParseInt(portStr, 10, 64); err == nil {
-			port = p
-		}
-	} else {
-		host = rest
-	}
-
-	pairs["host"] = &ast.StringLiteral{
-		Token: lexer.Token{Type: lexer.STRING, Literal: host},
-		Value: host,
-	}
-
-	pairs["port"] = &ast.IntegerLiteral{
-		Token: lexer.Token{Type: lexer.INT, Literal: fmt.Sprintf("%d", port)},
-		Value: port,
-	}
-
-	if username != "" {
-		pairs["username"] = &ast.StringLiteral{
-			Token: lexer.Token{Type: lexer.STRING, Literal: username},
-			Value: username,
+		u.Host = rest[:colonIdx]
+		if p, err := strconv.ParseInt(rest[colonIdx+1:], 10, 64); err == nil {
+			u.Port = p
 		}
 	} else {
-		pairs["username"] = &ast.Identifier{
-			Token: lexer.Token{Type: lexer.IDENT, Literal: "null"},
-			Value: "null",
-		}
-	}
-
-	if password != "" {
-		pairs["password"] = &ast.StringLiteral{
-			Token: lexer.Token{Type: lexer.STRING, Literal: password},
-			Value: password,
-		}
-	} else {
-		pairs["password"] = &ast.Identifier{
-			Token: lexer.Token{Type: lexer.IDENT, Literal: "null"},
-			Value: "null",
-		}
-	}
-
-	if fragment != "" {
-		pairs["fragment"] = &ast.StringLiteral{
-			Token: lexer.Token{Type: lexer.STRING, Literal: fragment},
-			Value: fragment,
-		}
-	} else {
-		pairs["fragment"] = &ast.Identifier{
-			Token: lexer.Token{Type: lexer.IDENT, Literal: "null"},
-			Value: "null",
-		}
+		u.Host = rest
 	}
 
-	return &Dictionary{Pairs: pairs, Env: env}, nil
+	return u, nil
 }
 
-// evalPathComputedProperty returns computed properties for path dictionaries
+// evalPathComputedProperty returns computed properties for paths
 // Returns nil if the property doesn't exist
-func evalPathComputedProperty(dict *Dictionary, key string, env *Environment) Object {
+func evalPathComputedProperty(p *Path, key string) Object {
 	switch key {
-	case "basename":
-		// Get last component
-		componentsExpr, ok := dict.Pairs["components"]
-		if !ok {
-			return NULL
-		}
-		componentsObj := Eval(componentsExpr, env)
-		arr, ok := componentsObj.(*Array)
-		if !ok || len(arr.Elements) == 0 {
+	case "basename", "name":
+		if len(p.Components) == 0 {
 			return NULL
 		}
-		return arr.Elements[len(arr.Elements)-1]
+		return &String{Value: p.basename()}
 
 	case "dirname", "parent":
-		// Get all but last component, return as path dict
-		componentsExpr, ok := dict.Pairs["components"]
-		if !ok {
-			return NULL
-		}
-		componentsObj := Eval(componentsExpr, env)
-		arr, ok := componentsObj.(*Array)
-		if !ok || len(arr.Elements) == 0 {
+		// All but the last component, as a path
+		if len(p.Components) == 0 {
 			return NULL
 		}
+		return newPath(append([]string{}, p.Components[:len(p.Components)-1]...), p.Absolute)
 
-		// Get absolute flag
-		absoluteExpr, ok := dict.Pairs["absolute"]
-		isAbsolute := false
-		if ok {
-			absoluteObj := Eval(absoluteExpr, env)
-			if b, ok := absoluteObj.(*Boolean); ok {
-				isAbsolute = b.Value
-			}
-		}
-
-		// Create new components array (all but last)
-		parentComponents := []string{}
-		for i := 0; i < len(arr.Elements)-1; i++ {
-			if str, ok := arr.Elements[i].(*String); ok {
-				parentComponents = append(parentComponents, str.Value)
-			}
-		}
-
-		return pathToDict(parentComponents, isAbsolute, env)
-
-	case "extension", "ext":
-		// Get extension from basename
-		componentsExpr, ok := dict.Pairs["components"]
-		if !ok {
-			return NULL
-		}
-		componentsObj := Eval(componentsExpr, env)
-		arr, ok := componentsObj.(*Array)
-		if !ok || len(arr.Elements) == 0 {
-			return NULL
-		}
-		basename, ok := arr.Elements[len(arr.Elements)-1].(*String)
-		if !ok {
+	case "extension", "ext", "suffix":
+		if len(p.Components) == 0 {
 			return NULL
 		}
-
-		// Find last dot
-		lastDot := strings.LastIndex(basename.Value, ".")
+		basename := p.basename()
+		lastDot := strings.LastIndex(basename, ".")
 		if lastDot == -1 || lastDot == 0 {
 			return &String{Value: ""}
 		}
-		return &String{Value: basename.Value[lastDot+1:]}
+		return &String{Value: basename[lastDot+1:]}
 
 	case "stem":
-		// Get filename without extension
-		componentsExpr, ok := dict.Pairs["components"]
-		if !ok {
-			return NULL
-		}
-		componentsObj := Eval(componentsExpr, env)
-		arr, ok := componentsObj.(*Array)
-		if !ok || len(arr.Elements) == 0 {
+		// Filename without extension
+		if len(p.Components) == 0 {
 			return NULL
 		}
-		basename, ok := arr.Elements[len(arr.Elements)-1].(*String)
-		if !ok {
-			return NULL
-		}
-
-		// Find last dot
-		lastDot := strings.LastIndex(basename.Value, ".")
+		basename := p.basename()
+		lastDot := strings.LastIndex(basename, ".")
 		if lastDot == -1 || lastDot == 0 {
-			return basename
+			return &String{Value: basename}
 		}
-		return &String{Value: basename.Value[:lastDot]}
-
-	case "name":
-		// Alias for basename
-		return evalPathComputedProperty(dict, "basename", env)
-
-	case "suffix":
-		// Alias for extension
-		return evalPathComputedProperty(dict, "extension", env)
+		return &String{Value: basename[:lastDot]}
 
 	case "suffixes":
-		// Get all extensions as array (e.g., ["tar", "gz"] from file.tar.gz)
-		componentsExpr, ok := dict.Pairs["components"]
-		if !ok {
-			return NULL
-		}
-		componentsObj := Eval(componentsExpr, env)
-		arr, ok := componentsObj.(*Array)
-		if !ok || len(arr.Elements) == 0 {
-			return &Array{Elements: []Object{}}
-		}
-		basename, ok := arr.Elements[len(arr.Elements)-1].(*String)
-		if !ok {
-			return &Array{Elements: []Object{}}
-		}
-
-		// Find all dots and extract suffixes
-		var suffixes []Object
-		parts := strings.Split(basename.Value, ".")
-		if len(parts) > 1 {
-			// Skip the first part (filename), collect rest as suffixes
-			for i := 1; i < len(parts); i++ {
-				if parts[i] != "" {
-					suffixes = append(suffixes, &String{Value: parts[i]})
-				}
+		// All extensions (e.g., ["tar", "gz"] from file.tar.gz)
+		suffixes := []Object{}
+		parts := strings.Split(p.basename(), ".")
+		for _, part := range parts[1:] {
+			if part != "" {
+				suffixes = append(suffixes, &String{Value: part})
 			}
 		}
 		return &Array{Elements: suffixes}
 
 	case "parts":
 		// Alias for components
-		componentsExpr, ok := dict.Pairs["components"]
-		if !ok {
-			return NULL
-		}
-		return Eval(componentsExpr, env)
+		return stringsToArray(p.Components)
 
 	case "isAbsolute":
-		// Boolean indicating if path is absolute
-		absoluteExpr, ok := dict.Pairs["absolute"]
-		if !ok {
-			return FALSE
-		}
-		return Eval(absoluteExpr, env)
+		return nativeBoolToParsBoolean(p.Absolute)
 
 	case "isRelative":
-		// Boolean indicating if path is relative (opposite of absolute)
-		absoluteExpr, ok := dict.Pairs["absolute"]
-		if !ok {
-			return TRUE
-		}
-		absoluteObj := Eval(absoluteExpr, env)
-		if b, ok := absoluteObj.(*Boolean); ok {
-			return nativeBoolToParsBoolean(!b.Value)
-		}
-		return TRUE
+		return nativeBoolToParsBoolean(!p.Absolute)
 
 	case "string":
 		// Full path as string
-		return &String{Value: pathDictToString(dict)}
+		return &String{Value: p.Inspect()}
 
 	case "dir":
 		// Directory path as string (all but the last component)
-		componentsExpr, ok := dict.Pairs["components"]
-		if !ok {
-			return &String{Value: ""}
-		}
-		componentsObj := Eval(componentsExpr, env)
-		arr, ok := componentsObj.(*Array)
-		if !ok || len(arr.Elements) <= 1 {
+		if len(p.Components) <= 1 {
 			// If only one component (or empty), dir is empty or root
-			absoluteExpr, ok := dict.Pairs["absolute"]
-			isAbsolute := false
-			if ok {
-				absoluteObj := Eval(absoluteExpr, env)
-				if b, ok := absoluteObj.(*Boolean); ok {
-					isAbsolute = b.Value
-				}
+			if !p.Absolute {
+				return &String{Value: "."}
 			}
-			if isAbsolute {
-				return &String{Value: "/"}
+			if len(p.Components) == 1 && isVolumeComponent(p.Components[0]) {
+				return &String{Value: joinPathComponents(p.Components)}
 			}
-			return &String{Value: "."}
+			return &String{Value: "/"}
 		}
+		return &String{Value: joinPathComponents(p.Components[:len(p.Components)-1])}
 
-		// Get absolute flag
-		absoluteExpr, ok := dict.Pairs["absolute"]
-		isAbsolute := false
-		if ok {
-			absoluteObj := Eval(absoluteExpr, env)
-			if b, ok := absoluteObj.(*Boolean); ok {
-				isAbsolute = b.Value
-			}
-		}
-
-		// Build directory path (all but last component)
-		var result strings.Builder
-		for i := 0; i < len(arr.Elements)-1; i++ {
-			if str, ok := arr.Elements[i].(*String); ok {
-				if str.Value == "" && i == 0 && isAbsolute {
-					result.WriteString("/")
-				} else {
-					if i > 0 && (i > 1 || !isAbsolute) {
-						result.WriteString("/")
-					}
-					result.WriteString(str.Value)
-				}
-			}
+	case "volume":
+		// Windows drive or UNC share the path starts with, or ""
+		if len(p.Components) > 0 && isVolumeComponent(p.Components[0]) {
+			return &String{Value: p.Components[0]}
 		}
-		return &String{Value: result.String()}
+		return &String{Value: ""}
 	}
 
 	return nil // Property doesn't exist
 }
 
-// evalUrlComputedProperty returns computed properties for URL dictionaries
+// evalUrlComputedProperty returns computed properties for URLs
 // Returns nil if the property doesn't exist
-func evalUrlComputedProperty(dict *Dictionary, key string, env *Environment) Object {
+func evalUrlComputedProperty(u *Url, key string) Object {
 	switch key {
 	case "origin":
 		// scheme://host[:port]
-		var result strings.Builder
-
-		if schemeExpr, ok := dict.Pairs["scheme"]; ok {
-			schemeObj := Eval(schemeExpr, env)
-			if str, ok := schemeObj.(*String); ok {
-				result.WriteString(str.Value)
-				result.WriteString("://")
-			}
-		}
-
-		if hostExpr, ok := dict.Pairs["host"]; ok {
-			hostObj := Eval(hostExpr, env)
-			if str, ok := hostObj.(*String); ok {
-				result.WriteString(str.Value)
-			}
-		}
-
-		if portExpr, ok := dict.Pairs["port"]; ok {
-			portObj := Eval(portExpr, env)
-			if i, ok := portObj.(*Integer); ok && i.Value != 0 {
-				result.WriteString(":")
-				result.WriteString(strconv.FormatInt(i.Value, 10))
-			}
-		}
-
-		return &String{Value: result.String()}
+		return &String{Value: u.origin()}
 
 	case "pathname":
-		// Just the path part as a string
-		if pathExpr, ok := dict.Pairs["path"]; ok {
-			pathObj := Eval(pathExpr, env)
-			if arr, ok := pathObj.(*Array); ok {
-				var result strings.Builder
-				hasLeadingSlash := false
-				for i, elem := range arr.Elements {
-					if str, ok := elem.(*String); ok {
-						if i == 0 && str.Value == "" {
-							// Leading empty string means absolute path
-							result.WriteString("/")
-							hasLeadingSlash = true
-						} else if str.Value != "" {
-							// Add slash before element (but not if we just added leading slash)
-							if i > 0 && !(i == 1 && hasLeadingSlash) {
-								result.WriteString("/")
-							}
-							result.WriteString(str.Value)
-						}
-					}
-				}
-				return &String{Value: result.String()}
+		// Just the path part as a string, with a leading slash only if the
+		// path has one (a path joined onto a bare host doesn't)
+		var parts []string
+		for _, part := range u.Path {
+			if part != "" {
+				parts = append(parts, part)
 			}
 		}
-		return &String{Value: ""}
+		pathname := strings.Join(parts, "/")
+		if len(u.Path) > 0 && u.Path[0] == "" {
+			pathname = "/" + pathname
+		}
+		return &String{Value: pathname}
 
 	case "hostname":
 		// Alias for host
-		if hostExpr, ok := dict.Pairs["host"]; ok {
-			return Eval(hostExpr, env)
-		}
-		return &String{Value: ""}
+		return &String{Value: u.Host}
 
 	case "protocol":
 		// Scheme with colon suffix (e.g., "https:")
-		if schemeExpr, ok := dict.Pairs["scheme"]; ok {
-			schemeObj := Eval(schemeExpr, env)
-			if str, ok := schemeObj.(*String); ok {
-				return &String{Value: str.Value + ":"}
-			}
-		}
-		return &String{Value: ""}
+		return &String{Value: u.Scheme + ":"}
 
 	case "search":
 		// Query string with ? prefix (e.g., "?key=value&foo=bar")
-		if queryExpr, ok := dict.Pairs["query"]; ok {
-			queryObj := Eval(queryExpr, env)
-			if queryDict, ok := queryObj.(*Dictionary); ok {
-				if len(queryDict.Pairs) == 0 {
-					return &String{Value: ""}
-				}
-				var result strings.Builder
-				result.WriteString("?")
-				first := true
-				for key, expr := range queryDict.Pairs {
-					val := Eval(expr, env)
-					if str, ok := val.(*String); ok {
-						if !first {
-							result.WriteString("&")
-						}
-						result.WriteString(key)
-						result.WriteString("=")
-						result.WriteString(str.Value)
-						first = false
-					}
-				}
-				return &String{Value: result.String()}
-			}
-		}
-		return &String{Value: ""}
+		return &String{Value: u.search()}
 
-	case "href":
-		// Full URL as string (alias for toString)
-		return &String{Value: urlDictToString(dict)}
-
-	case "string":
-		// Full URL as string (alias for href)
-		return &String{Value: urlDictToString(dict)}
+	case "href", "string":
+		// Full URL as string
+		return &String{Value: u.Inspect()}
 	}
 
 	return nil // Property doesn't exist
@@ -2793,7 +2259,7 @@ func evalUrlComputedProperty(dict *Dictionary, key string, env *Environment) Obj
 
 // fileToDict creates a file dictionary from a path and format
 // format can be: "json", "csv", "lines", "text", "bytes", or "" for auto-detect
-func fileToDict(pathDict *Dictionary, format string, options *Dictionary, env *Environment) *Dictionary {
+func fileToDict(path *Path, format string, options *Dictionary, env *Environment) *Dictionary {
 	pairs := make(map[string]ast.Expression)
 
 	// Add __type field
@@ -2802,18 +2268,15 @@ func fileToDict(pathDict *Dictionary, format string, options *Dictionary, env *E
 		Value: "file",
 	}
 
-	// Add path field (the original path dictionary)
-	// Store the path components and absolute flag from the path dict
-	if compExpr, ok := pathDict.Pairs["components"]; ok {
-		pairs["_pathComponents"] = compExpr
-	}
-	if absExpr, ok := pathDict.Pairs["absolute"]; ok {
-		pairs["_pathAbsolute"] = absExpr
-	}
+	// Add the path
+	pairs["_path"] = &ast.ObjectLiteralExpression{Obj: path}
 
-	// Propagate __stdio marker from path dict (for stdin/stdout/stderr)
-	if stdioExpr, ok := pathDict.Pairs["__stdio"]; ok {
-		pairs["__stdio"] = stdioExpr
+	// Mark stdin/stdout/stderr
+	if path.Stdio != "" {
+		pairs["__stdio"] = &ast.StringLiteral{
+			Token: lexer.Token{Type: lexer.STRING, Literal: path.Stdio},
+			Value: path.Stdio,
+		}
 	}
 
 	// Add format field
@@ -2844,9 +2307,9 @@ func fileToDict(pathDict *Dictionary, format string, options *Dictionary, env *E
 	return &Dictionary{Pairs: pairs, Env: env}
 }
 
-// dirToDict creates a directory dictionary from a path dictionary
+// dirToDict creates a directory dictionary from a path
 // Directory dictionaries have __type: "dir" and can be read to list contents
-func dirToDict(pathDict *Dictionary, env *Environment) *Dictionary {
+func dirToDict(path *Path, env *Environment) *Dictionary {
 	pairs := make(map[string]ast.Expression)
 
 	// Add __type field
@@ -2855,17 +2318,22 @@ func dirToDict(pathDict *Dictionary, env *Environment) *Dictionary {
 		Value: "dir",
 	}
 
-	// Store the path components and absolute flag from the path dict
-	if compExpr, ok := pathDict.Pairs["components"]; ok {
-		pairs["_pathComponents"] = compExpr
-	}
-	if absExpr, ok := pathDict.Pairs["absolute"]; ok {
-		pairs["_pathAbsolute"] = absExpr
-	}
+	// Add the path
+	pairs["_path"] = &ast.ObjectLiteralExpression{Obj: path}
 
 	return &Dictionary{Pairs: pairs, Env: env}
 }
 
+// handlePath returns the path of a file or directory dictionary, or nil
+func handlePath(dict *Dictionary) *Path {
+	if expr, ok := dict.Pairs["_path"].(*ast.ObjectLiteralExpression); ok {
+		if p, ok := expr.Obj.(*Path); ok {
+			return p
+		}
+	}
+	return nil
+}
+
 // isDirDict checks if a dictionary is a directory handle
 func isDirDict(dict *Dictionary) bool {
 	typeExpr, ok := dict.Pairs["__type"]
@@ -2887,34 +2355,11 @@ func evalDirComputedProperty(dict *Dictionary, key string, env *Environment) Obj
 
 	switch key {
 	case "path":
-		// Return the underlying path dictionary
-		compExpr, ok := dict.Pairs["_pathComponents"]
-		if !ok {
-			return NULL
-		}
-		compObj := Eval(compExpr, env)
-		arr, ok := compObj.(*Array)
-		if !ok {
-			return NULL
-		}
-
-		absExpr, ok := dict.Pairs["_pathAbsolute"]
-		isAbsolute := false
-		if ok {
-			absObj := Eval(absExpr, env)
-			if b, ok := absObj.(*Boolean); ok {
-				isAbsolute = b.Value
-			}
-		}
-
-		components := []string{}
-		for _, elem := range arr.Elements {
-			if str, ok := elem.(*String); ok {
-				components = append(components, str.Value)
-			}
+		// Return the underlying path
+		if p := handlePath(dict); p != nil {
+			return p
 		}
-
-		return pathToDict(components, isAbsolute, env)
+		return NULL
 
 	case "exists":
 		info, err := os.Stat(pathStr)
@@ -2936,7 +2381,7 @@ func evalDirComputedProperty(dict *Dictionary, key string, env *Environment) Obj
 	case "parent", "dirname":
 		dir := filepath.Dir(pathStr)
 		components, isAbsolute := parsePathString(dir)
-		return pathToDict(components, isAbsolute, env)
+		return newPath(components, isAbsolute)
 
 	case "mode":
 		info, err := os.Stat(pathStr)
@@ -2950,7 +2395,7 @@ func evalDirComputedProperty(dict *Dictionary, key string, env *Environment) Obj
 		if err != nil {
 			return NULL
 		}
-		return timeToDatetimeDict(info.ModTime(), env)
+		return newDatetime(info.ModTime(), "datetime")
 
 	case "files":
 		// Return array of file handles in directory
@@ -2965,7 +2410,7 @@ func evalDirComputedProperty(dict *Dictionary, key string, env *Environment) Obj
 		return &Integer{Value: int64(len(entries))}
 	}
 
-	return nil // Property doesn't exist
+	return fileMetadataProperty(key, pathStr, env)
 }
 
 // readDirContents reads directory contents and returns array of file/dir handles
@@ -2984,7 +2429,7 @@ func readDirContents(dirPath string, env *Environment) Object {
 	for _, entry := range entries {
 		entryPath := filepath.Join(dirPath, entry.Name())
 		components, isAbsolute := parsePathString(entryPath)
-		pathDict := pathToDict(components, isAbsolute, env)
+		pathDict := newPath(components, isAbsolute)
 
 		var handle *Dictionary
 		if entry.IsDir() {
@@ -3001,56 +2446,23 @@ func readDirContents(dirPath string, env *Environment) Object {
 
 // getFilePathString extracts the filesystem path string from a file dictionary
 func getFilePathString(dict *Dictionary, env *Environment) string {
-	// Get path components
-	compExpr, ok := dict.Pairs["_pathComponents"]
-	if !ok {
+	p := handlePath(dict)
+	if p == nil {
 		return ""
 	}
-	if compExpr == nil {
-		return ""
+
+	var parts []string
+	for i, component := range p.Components {
+		if component != "" || (i == 0 && p.Absolute) {
+			parts = append(parts, component)
+		}
 	}
-	compObj := Eval(compExpr, env)
-	arr, ok := compObj.(*Array)
-	if !ok {
+	if len(parts) == 0 {
 		return ""
 	}
 
-	// Get absolute flag
-	absExpr, ok := dict.Pairs["_pathAbsolute"]
-	isAbsolute := false
-	if ok && absExpr != nil {
-		absObj := Eval(absExpr, env)
-		if b, ok := absObj.(*Boolean); ok {
-			isAbsolute = b.Value
-		}
-	}
-
-	// Build path string
-	var result strings.Builder
-	for i, elem := range arr.Elements {
-		if str, ok := elem.(*String); ok {
-			if i == 0 && isAbsolute && str.Value == "" {
-				result.WriteString("/")
-			} else if str.Value == "." && i == 0 {
-				result.WriteString(".")
-			} else if str.Value == "~" && i == 0 {
-				// Expand home directory
-				home, err := os.UserHomeDir()
-				if err == nil {
-					result.WriteString(home)
-				} else {
-					result.WriteString("~")
-				}
-			} else if str.Value != "" {
-				if i > 0 && result.Len() > 0 && !strings.HasSuffix(result.String(), "/") {
-					result.WriteString("/")
-				}
-				result.WriteString(str.Value)
-			}
-		}
-	}
-
-	return result.String()
+	// Expand home directory
+	return ExpandHome(joinPathComponents(parts))
 }
 
 // inferFormatFromExtension guesses the file format from its extension
@@ -3077,34 +2489,11 @@ func evalFileComputedProperty(dict *Dictionary, key string, env *Environment) Ob
 
 	switch key {
 	case "path":
-		// Return the underlying path dictionary
-		compExpr, ok := dict.Pairs["_pathComponents"]
-		if !ok {
-			return NULL
+		// Return the underlying path
+		if p := handlePath(dict); p != nil {
+			return p
 		}
-		compObj := Eval(compExpr, env)
-		arr, ok := compObj.(*Array)
-		if !ok {
-			return NULL
-		}
-
-		absExpr, ok := dict.Pairs["_pathAbsolute"]
-		isAbsolute := false
-		if ok {
-			absObj := Eval(absExpr, env)
-			if b, ok := absObj.(*Boolean); ok {
-				isAbsolute = b.Value
-			}
-		}
-
-		components := []string{}
-		for _, elem := range arr.Elements {
-			if str, ok := elem.(*String); ok {
-				components = append(components, str.Value)
-			}
-		}
-
-		return pathToDict(components, isAbsolute, env)
+		return NULL
 
 	case "exists":
 		_, err := os.Stat(pathStr)
@@ -3122,7 +2511,7 @@ func evalFileComputedProperty(dict *Dictionary, key string, env *Environment) Ob
 		if err != nil {
 			return NULL
 		}
-		return timeToDatetimeDict(info.ModTime(), env)
+		return newDatetime(info.ModTime(), "datetime")
 
 	case "isDir":
 		info, err := os.Stat(pathStr)
@@ -3158,7 +2547,7 @@ func evalFileComputedProperty(dict *Dictionary, key string, env *Environment) Ob
 	case "dirname", "parent":
 		dir := filepath.Dir(pathStr)
 		components, isAbsolute := parsePathString(dir)
-		return pathToDict(components, isAbsolute, env)
+		return newPath(components, isAbsolute)
 
 	case "stem":
 		base := filepath.Base(pathStr)
@@ -3166,120 +2555,24 @@ func evalFileComputedProperty(dict *Dictionary, key string, env *Environment) Ob
 		return &String{Value: strings.TrimSuffix(base, ext)}
 	}
 
-	return nil // Property doesn't exist
-}
-
-// timeToDatetimeDict converts a time.Time to a datetime dictionary
-func timeToDatetimeDict(t time.Time, env *Environment) *Dictionary {
-	pairs := make(map[string]ast.Expression)
-
-	pairs["__type"] = &ast.StringLiteral{
-		Token: lexer.Token{Type: lexer.STRING, Literal: "datetime"},
-		Value: "datetime",
-	}
-
-	pairs["year"] = &ast.IntegerLiteral{
-		Token: lexer.Token{Type: lexer.INT, Literal: strconv.Itoa(t.Year())},
-		Value: int64(t.Year()),
-	}
-
-	pairs["month"] = &ast.IntegerLiteral{
-		Token: lexer.Token{Type: lexer.INT, Literal: strconv.Itoa(int(t.Month()))},
-		Value: int64(t.Month()),
-	}
-
-	pairs["day"] = &ast.IntegerLiteral{
-		Token: lexer.Token{Type: lexer.INT, Literal: strconv.Itoa(t.Day())},
-		Value: int64(t.Day()),
-	}
-
-	pairs["hour"] = &ast.IntegerLiteral{
-		Token: lexer.Token{Type: lexer.INT, Literal: strconv.Itoa(t.Hour())},
-		Value: int64(t.Hour()),
-	}
-
-	pairs["minute"] = &ast.IntegerLiteral{
-		Token: lexer.Token{Type: lexer.INT, Literal: strconv.Itoa(t.Minute())},
-		Value: int64(t.Minute()),
-	}
-
-	pairs["second"] = &ast.IntegerLiteral{
-		Token: lexer.Token{Type: lexer.INT, Literal: strconv.Itoa(t.Second())},
-		Value: int64(t.Second()),
-	}
-
-	pairs["unix"] = &ast.IntegerLiteral{
-		Token: lexer.Token{Type: lexer.INT, Literal: strconv.FormatInt(t.Unix(), 10)},
-		Value: t.Unix(),
-	}
-
-	weekday := t.Weekday().String()
-	pairs["weekday"] = &ast.StringLiteral{
-		Token: lexer.Token{Type: lexer.STRING, Literal: weekday},
-		Value: weekday,
-	}
-
-	iso := t.UTC().Format(time.RFC3339)
-	// Simplify to the format we use
-	if strings.HasSuffix(iso, "+00:00") || strings.HasSuffix(iso, "-00:00") {
-		iso = strings.TrimSuffix(iso, "+00:00")
-		iso = strings.TrimSuffix(iso, "-00:00")
-		iso = iso + "Z"
-	}
-	pairs["iso"] = &ast.StringLiteral{
-		Token: lexer.Token{Type: lexer.STRING, Literal: iso},
-		Value: iso,
-	}
-
-	return &Dictionary{Pairs: pairs, Env: env}
+	return fileMetadataProperty(key, pathStr, env)
 }
 
-// evalDatetimeComputedProperty returns computed properties for datetime dictionaries
+// evalDatetimeComputedProperty returns computed properties for datetimes
 // Returns nil if the property doesn't exist
-func evalDatetimeComputedProperty(dict *Dictionary, key string, env *Environment) Object {
+func evalDatetimeComputedProperty(dt *Datetime, key string, env *Environment) Object {
+	t := dt.Time
 	switch key {
 	case "date":
 		// Just the date part as string (YYYY-MM-DD)
-		if yearExpr, ok := dict.Pairs["year"]; ok {
-			if monthExpr, ok := dict.Pairs["month"]; ok {
-				if dayExpr, ok := dict.Pairs["day"]; ok {
-					year := Eval(yearExpr, env)
-					month := Eval(monthExpr, env)
-					day := Eval(dayExpr, env)
-					if yInt, ok := year.(*Integer); ok {
-						if mInt, ok := month.(*Integer); ok {
-							if dInt, ok := day.(*Integer); ok {
-								return &String{Value: fmt.Sprintf("%04d-%02d-%02d", yInt.Value, mInt.Value, dInt.Value)}
-							}
-						}
-					}
-				}
-			}
-		}
-		return NULL
+		return &String{Value: fmt.Sprintf("%04d-%02d-%02d", t.Year(), t.Month(), t.Day())}
 
 	case "time":
 		// Just the time part as string (HH:MM:SS or HH:MM if seconds are zero)
-		if hourExpr, ok := dict.Pairs["hour"]; ok {
-			if minExpr, ok := dict.Pairs["minute"]; ok {
-				if secExpr, ok := dict.Pairs["second"]; ok {
-					hour := Eval(hourExpr, env)
-					minute := Eval(minExpr, env)
-					second := Eval(secExpr, env)
-					if hInt, ok := hour.(*Integer); ok {
-						if mInt, ok := minute.(*Integer); ok {
-							if sInt, ok := second.(*Integer); ok {
-								if sInt.Value == 0 {
-									return &String{Value: fmt.Sprintf("%02d:%02d", hInt.Value, mInt.Value)}
-								}
-								return &String{Value: fmt.Sprintf("%02d:%02d:%02d", hInt.Value, mInt.Value, sInt.Value)}
-							}
-						}
-					}
-				}
-			}
+		if t.Second() == 0 {
+			return &String{Value: fmt.Sprintf("%02d:%02d", t.Hour(), t.Minute())}
 		}
-		return NULL
+		return &String{Value: fmt.Sprintf("%02d:%02d:%02d", t.Hour(), t.Minute(), t.Second())}
 
 	case "format":
 		// Human-readable format: "Month DD, YYYY" or "Month DD, YYYY at HH:MM"
@@ -3287,227 +2580,37 @@ func evalDatetimeComputedProperty(dict *Dictionary, key string, env *Environment
 		// Note: THIS IS A SIMPLE IMPLEMENTATION
 		// as it does not handle localization.
 		//
-		if yearExpr, ok := dict.Pairs["year"]; ok {
-			if monthExpr, ok := dict.Pairs["month"]; ok {
-				if dayExpr, ok := dict.Pairs["day"]; ok {
-					year := Eval(yearExpr, env)
-					month := Eval(monthExpr, env)
-					day := Eval(dayExpr, env)
-					if yInt, ok := year.(*Integer); ok {
-						if mInt, ok := month.(*Integer); ok {
-							if dInt, ok := day.(*Integer); ok {
-								monthNames := []string{
-									"January", "February", "March", "April", "May", "June",
-									"July", "August", "September", "October", "November", "December",
-								}
-								monthName := "Invalid"
-								if mInt.Value >= 1 && mInt.Value <= 12 {
-									monthName = monthNames[mInt.Value-1]
-								}
-
-								// Check if time is set (not all zeros)
-								hasTime := false
-								if hourExpr, ok := dict.Pairs["hour"]; ok {
-									if minExpr, ok := dict.Pairs["minute"]; ok {
-										hour := Eval(hourExpr, env)
-										minute := Eval(minExpr, env)
-										if hInt, ok := hour.(*Integer); ok {
-											if mInt, ok := minute.(*Integer); ok {
-												if hInt.Value != 0 || mInt.Value != 0 {
-													hasTime = true
-													timeStr := fmt.Sprintf("%02d:%02d", hInt.Value, mInt.Value)
-													return &String{Value: fmt.Sprintf("%s %d, %d at %s", monthName, dInt.Value, yInt.Value, timeStr)}
-												}
-											}
-										}
-									}
-								}
-
-								if !hasTime {
-									return &String{Value: fmt.Sprintf("%s %d, %d", monthName, dInt.Value, yInt.Value)}
-								}
-							}
-						}
-					}
-				}
-			}
+		if t.Hour() != 0 || t.Minute() != 0 {
+			return &String{Value: fmt.Sprintf("%s %d, %d at %02d:%02d", t.Month(), t.Day(), t.Year(), t.Hour(), t.Minute())}
 		}
-		return NULL
+		return &String{Value: fmt.Sprintf("%s %d, %d", t.Month(), t.Day(), t.Year())}
 
 	case "timestamp":
 		// Alias for unix field - more intuitive name
-		if unixExpr, ok := dict.Pairs["unix"]; ok {
-			return Eval(unixExpr, env)
-		}
-		return NULL
+		return &Integer{Value: t.Unix()}
 
 	case "dayOfYear":
 		// Calculate day of year (1-366)
-		if unixExpr, ok := dict.Pairs["unix"]; ok {
-			unixObj := Eval(unixExpr, env)
-			if unixInt, ok := unixObj.(*Integer); ok {
-				t := time.Unix(unixInt.Value, 0).UTC()
-				return &Integer{Value: int64(t.YearDay())}
-			}
-		}
-		return NULL
+		return &Integer{Value: int64(t.UTC().YearDay())}
 
 	case "week":
 		// ISO week number (1-53)
-		if unixExpr, ok := dict.Pairs["unix"]; ok {
-			unixObj := Eval(unixExpr, env)
-			if unixInt, ok := unixObj.(*Integer); ok {
-				t := time.Unix(unixInt.Value, 0).UTC()
-				_, week := t.ISOWeek()
-				return &Integer{Value: int64(week)}
-			}
-		}
-		return NULL
+		_, week := t.UTC().ISOWeek()
+		return &Integer{Value: int64(week)}
 	}
 
 	return nil // Property doesn't exist
 }
 
-// pathDictToString converts a path dictionary back to a string
-func pathDictToString(dict *Dictionary) string {
-	// Get components array
-	componentsExpr, ok := dict.Pairs["components"]
-	if !ok {
-		return ""
-	}
-
-	// Evaluate the array expression
-	componentsObj := Eval(componentsExpr, dict.Env)
-	arr, ok := componentsObj.(*Array)
-	if !ok {
-		return ""
-	}
-
-	// Build path string - first element being empty indicates absolute path
-	var parts []string
-	for _, elem := range arr.Elements {
-		if str, ok := elem.(*String); ok {
-			parts = append(parts, str.Value)
-		}
-	}
-
-	if len(parts) == 0 {
-		return "."
-	}
-
-	// Join with "/" - if first element is empty, this creates a leading /
-	result := strings.Join(parts, "/")
-	if result == "" {
-		return "."
-	}
-	return result
-}
-
-// urlDictToString converts a URL dictionary back to a string
-func urlDictToString(dict *Dictionary) string {
-	var result strings.Builder
-
-	// Scheme
-	if schemeExpr, ok := dict.Pairs["scheme"]; ok {
-		schemeObj := Eval(schemeExpr, dict.Env)
-		if str, ok := schemeObj.(*String); ok {
-			result.WriteString(str.Value)
-			result.WriteString("://")
-		}
-	}
-
-	// Username and password
-	if usernameExpr, ok := dict.Pairs["username"]; ok {
-		usernameObj := Eval(usernameExpr, dict.Env)
-		if str, ok := usernameObj.(*String); ok && str.Value != "" {
-			result.WriteString(str.Value)
-
-			if passwordExpr, ok := dict.Pairs["password"]; ok {
-				passwordObj := Eval(passwordExpr, dict.Env)
-				if pstr, ok := passwordObj.(*String); ok && pstr.Value != "" {
-					result.WriteString(":")
-					result.WriteString(pstr.Value)
-				}
-			}
-			result.WriteString("@")
-		}
-	}
-
-	// Host
-	if hostExpr, ok := dict.Pairs["host"]; ok {
-		hostObj := Eval(hostExpr, dict.Env)
-		if str, ok := hostObj.(*String); ok {
-			result.WriteString(str.Value)
-		}
-	}
-
-	// Port (if non-zero)
-	if portExpr, ok := dict.Pairs["port"]; ok {
-		portObj := Eval(portExpr, dict.Env)
-		if i, ok := portObj.(*Integer); ok && i.Value != 0 {
-			result.WriteString(":")
-			result.WriteString(strconv.FormatInt(i.Value, 10))
-		}
-	}
-
-	// Path
-	if pathExpr, ok := dict.Pairs["path"]; ok {
-		pathObj := Eval(pathExpr, dict.Env)
-		if arr, ok := pathObj.(*Array); ok && len(arr.Elements) > 0 {
-			// Check if first element is empty string (indicates leading slash)
-			startIdx := 0
-			if str, ok := arr.Elements[0].(*String); ok && str.Value == "" {
-				// Leading empty string means path starts with /
-				result.WriteString("/")
-				startIdx = 1
-			} else if len(arr.Elements) > 0 {
-				// No leading empty, but we have segments, so add /
-				result.WriteString("/")
-			}
-
-			// Add remaining path segments
-			for i := startIdx; i < len(arr.Elements); i++ {
-				if str, ok := arr.Elements[i].(*String); ok && str.Value != "" {
-					if i > startIdx {
-						result.WriteString("/")
-					}
-					result.WriteString(str.Value)
-				}
-			}
-		}
-	}
-
-	// Query
-	if queryExpr, ok := dict.Pairs["query"]; ok {
-		queryObj := Eval(queryExpr, dict.Env)
-		if queryDict, ok := queryObj.(*Dictionary); ok && len(queryDict.Pairs) > 0 {
-			result.WriteString("?")
-			first := true
-			for key, expr := range queryDict.Pairs {
-				if !first {
-					result.WriteString("&")
-				}
-				first = false
-				result.WriteString(key)
-				result.WriteString("=")
-				valObj := Eval(expr, dict.Env)
-				if str, ok := valObj.(*String); ok {
-					result.WriteString(str.Value)
-				}
-			}
-		}
-	}
-
-	// Fragment
-	if fragmentExpr, ok := dict.Pairs["fragment"]; ok {
-		fragmentObj := Eval(fragmentExpr, dict.Env)
-		if str, ok := fragmentObj.(*String); ok && str.Value != "" {
-			result.WriteString("#")
-			result.WriteString(str.Value)
-		}
+// sortedKeys returns a dictionary's keys in a stable order, so query strings
+// render the same way on every run
+func sortedKeys(dict *Dictionary) []string {
+	keys := make([]string, 0, len(dict.Pairs))
+	for key := range dict.Pairs {
+		keys = append(keys, key)
 	}
-
-	return result.String()
+	sort.Strings(keys)
+	return keys
 }
 
 // getBuiltins returns the map of built-in functions
@@ -3739,229 +2842,6 @@ func getBuiltins() map[string]*Builtin {
 				}
 			},
 		},
-		"SFTP": {
-			Fn: func(args ...Object) Object {
-				if len(args) < 1 || len(args) > 2 {
-					return newError("wrong number of arguments to `SFTP`. got=%d, want=1 or 2", len(args))
-				}
-
-				// First arg: URL (can be dictionary or string)
-				var urlStr string
-				switch arg := args[0].(type) {
-				case *Dictionary:
-					if !isUrlDict(arg) {
-						return newError("first argument to SFTP must be a URL, got dictionary")
-					}
-					// Extract URL string from dictionary
-					if schemeExpr, ok := arg.Pairs["scheme"]; ok {
-						scheme := Eval(schemeExpr, arg.Env)
-						if schemeVal, ok := scheme.(*String); ok && schemeVal.Value != "sftp" {
-							return newError("SFTP requires sftp:// URL scheme, got %s://", schemeVal.Value)
-						}
-					}
-					urlStr = urlDictToString(arg)
-				case *String:
-					urlStr = arg.Value
-				default:
-					return newError("first argument to SFTP must be a URL, got %s", args[0].Type())
-				}
-
-				// Optional second arg: options dictionary
-				var options map[string]Object
-				if len(args) == 2 {
-					dict, ok := args[1].(*Dictionary)
-					if !ok {
-						return newError("second argument to SFTP must be a dictionary, got %s", args[1].Type())
-					}
-					options = make(map[string]Object)
-					for key := range dict.Pairs {
-						options[key] = Eval(dict.Pairs[key], dict.Env)
-					}
-				}
-
-				// Parse SFTP URL
-				if !strings.HasPrefix(urlStr, "sftp://") {
-					return newError("SFTP URL must start with sftp://")
-				}
-
-				// Parse URL components
-				parsedURL := urlStr[7:] // Remove "sftp://"
-				var user, password, host string
-				port := 22
-
-				// Extract user@host:port
-				atIndex := strings.Index(parsedURL, "@")
-				if atIndex >= 0 {
-					userPass := parsedURL[:atIndex]
-					parsedURL = parsedURL[atIndex+1:]
-
-					// Check for password in user:pass format
-					colonIndex := strings.Index(userPass, ":")
-					if colonIndex >= 0 {
-						user = userPass[:colonIndex]
-						password = userPass[colonIndex+1:]
-					} else {
-						user = userPass
-					}
-				} else {
-					user = "anonymous"
-				}
-
-				// Extract host and port
-				slashIndex := strings.Index(parsedURL, "/")
-				hostPort := parsedURL
-				if slashIndex >= 0 {
-					hostPort = parsedURL[:slashIndex]
-				}
-
-				colonIndex := strings.LastIndex(hostPort, ":")
-				if colonIndex >= 0 {
-					host = hostPort[:colonIndex]
-					portStr := hostPort[colonIndex+1:]
-					if p, err := strconv.Atoi(portStr); err == nil {
-						port = p
-					}
-				} else {
-					host = hostPort
-				}
-
-				// Check cache
-				cacheKey := fmt.Sprintf("sftp:%s@%s:%d", user, host, port)
-				sftpConnectionsMu.RLock()
-				conn, exists := sftpConnections[cacheKey]
-				sftpConnectionsMu.RUnlock()
-
-				if exists && conn.Connected {
-					return conn
-				}
-
-				// Create new SFTP connection
-				var authMethods []ssh.AuthMethod
-
-				// Check for SSH key authentication
-				if options != nil {
-					if keyFileObj, ok := options["keyFile"]; ok {
-						var keyPath string
-						if keyDict, ok := keyFileObj.(*Dictionary); ok && isPathDict(keyDict) {
-							keyPath = pathDictToString(keyDict)
-						} else if keyStr, ok := keyFileObj.(*String); ok {
-							keyPath = keyStr.Value
-						}
-
-						if keyPath != "" {
-							keyData, err := os.ReadFile(keyPath)
-							if err != nil {
-								return newError("failed to read SSH key file: %s", err.Error())
-							}
-
-							var signer ssh.Signer
-							var signerErr error
-
-							// Check if key has passphrase
-							if passphraseObj, ok := options["passphrase"]; ok {
-								if passphraseStr, ok := passphraseObj.(*String); ok {
-									signer, signerErr = ssh.ParsePrivateKeyWithPassphrase(keyData, []byte(passphraseStr.Value))
-								}
-							} else {
-								signer, signerErr = ssh.ParsePrivateKey(keyData)
-							}
-
-							if signerErr != nil {
-								return newError("failed to parse SSH key: %s", signerErr.Error())
-							}
-
-							authMethods = append(authMethods, ssh.PublicKeys(signer))
-						}
-					}
-
-					// Check for password from options
-					if passwordObj, ok := options["password"]; ok {
-						if passwordStr, ok := passwordObj.(*String); ok {
-							password = passwordStr.Value
-						}
-					}
-				}
-
-				// Add password auth if password provided
-				if password != "" {
-					authMethods = append(authMethods, ssh.Password(password))
-				}
-
-				if len(authMethods) == 0 {
-					return newError("SFTP requires authentication: provide keyFile or password in options")
-				}
-
-				// Configure SSH client
-				config := &ssh.ClientConfig{
-					User:            user,
-					Auth:            authMethods,
-					HostKeyCallback: ssh.InsecureIgnoreHostKey(), // Default to accept any (user can override)
-					Timeout:         30 * time.Second,
-				}
-
-				// Check for known_hosts file
-				if options != nil {
-					if knownHostsObj, ok := options["knownHostsFile"]; ok {
-						var knownHostsPath string
-						if khDict, ok := knownHostsObj.(*Dictionary); ok && isPathDict(khDict) {
-							knownHostsPath = pathDictToString(khDict)
-						} else if khStr, ok := knownHostsObj.(*String); ok {
-							knownHostsPath = khStr.Value
-						}
-
-						if knownHostsPath != "" {
-							callback, err := knownhosts.New(knownHostsPath)
-							if err != nil {
-								return newError("failed to load known_hosts: %s", err.Error())
-							}
-							config.HostKeyCallback = callback
-						}
-					}
-
-					// Check for timeout
-					if timeoutObj, ok := options["timeout"]; ok {
-						if timeoutDict, ok := timeoutObj.(*Dictionary); ok && isDurationDict(timeoutDict) {
-							tempEnv := NewEnvironment()
-							_, seconds, err := getDurationComponents(timeoutDict, tempEnv)
-							if err == nil {
-								config.Timeout = time.Duration(seconds) * time.Second
-							}
-						}
-					}
-				}
-
-				// Connect to SSH server
-				sshClient, err := ssh.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)), config)
-				if err != nil {
-					return newError("failed to connect to SSH server: %s", err.Error())
-				}
-
-				// Create SFTP client
-				sftpClient, err := sftp.NewClient(sshClient)
-				if err != nil {
-					sshClient.Close()
-					return newError("failed to create SFTP client: %s", err.Error())
-				}
-
-				// Create connection object
-				newConn := &SFTPConnection{
-					Client:    sftpClient,
-					SSHClient: sshClient,
-					Host:      host,
-					Port:      port,
-					User:      user,
-					Connected: true,
-					LastError: "",
-				}
-
-				// Cache connection
-				sftpConnectionsMu.Lock()
-				sftpConnections[cacheKey] = newConn
-				sftpConnectionsMu.Unlock()
-
-				return newConn
-			},
-		},
 		"import": {
 			Fn: func(args ...Object) Object {
 				// This is a placeholder - actual implementation happens in CallExpression
@@ -4105,6 +2985,28 @@ func getBuiltins() map[string]*Builtin {
 				}
 			},
 		},
+		"idiv": {
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments to `idiv`. got=%d, want=2", len(args))
+				}
+
+				a, ok := args[0].(*Integer)
+				if !ok {
+					return newError("first argument to `idiv` must be an integer, got %s", args[0].Type())
+				}
+				b, ok := args[1].(*Integer)
+				if !ok {
+					return newError("second argument to `idiv` must be an integer, got %s", args[1].Type())
+				}
+				if b.Value == 0 {
+					return newError("division by zero")
+				}
+
+				// Truncates toward zero, so idiv(a, b) * b + a % b == a
+				return &Integer{Value: a.Value / b.Value}
+			},
+		},
 		"pow": {
 			Fn: func(args ...Object) Object {
 				if len(args) != 2 {
@@ -4150,10 +3052,7 @@ func getBuiltins() map[string]*Builtin {
 				if len(args) != 0 {
 					return newError("wrong number of arguments to `now`. got=%d, want=0", len(args))
 				}
-				// Get current environment from context (we'll pass it through the Builtin)
-				// For now, create a new environment for the dictionary
-				env := NewEnvironment()
-				return timeToDict(time.Now(), env)
+				return newDatetime(time.Now(), "datetime")
 			},
 		},
 		"time": {
@@ -4182,6 +3081,8 @@ func getBuiltins() map[string]*Builtin {
 				case *Integer:
 					// Unix timestamp
 					t = time.Unix(arg.Value, 0).UTC()
+				case *Datetime:
+					t = arg.Time
 				case *Dictionary:
 					// From dictionary
 					t, err = dictToTime(arg, env)
@@ -4201,7 +3102,26 @@ func getBuiltins() map[string]*Builtin {
 					t = applyDelta(t, delta, env)
 				}
 
-				return timeToDict(t, env)
+				return newDatetime(t, "datetime")
+			},
+		},
+		"parseDuration": {
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `parseDuration`. got=%d, want=1", len(args))
+				}
+
+				str, ok := args[0].(*String)
+				if !ok {
+					return newError("argument to `parseDuration` must be a string, got %s", args[0].Type())
+				}
+
+				months, millis, err := parseDurationInput(str.Value)
+				if err != nil {
+					return newError("invalid duration string %q: %s", str.Value, err.Error())
+				}
+
+				return newDuration(months, millis)
 			},
 		},
 		"path": {
@@ -4216,8 +3136,7 @@ func getBuiltins() map[string]*Builtin {
 				}
 
 				components, isAbsolute := parsePathString(str.Value)
-				env := NewEnvironment()
-				return pathToDict(components, isAbsolute, env)
+				return newPath(components, isAbsolute)
 			},
 		},
 		"url": {
@@ -4231,13 +3150,12 @@ func getBuiltins() map[string]*Builtin {
 					return newError("argument to `url` must be a string, got %s", args[0].Type())
 				}
 
-				env := NewEnvironment()
-				urlDict, err := parseUrlString(str.Value, env)
+				u, err := parseUrlString(str.Value)
 				if err != nil {
 					return newError("invalid URL: %s", err.Error())
 				}
 
-				return urlDict
+				return u
 			},
 		},
 		// File handle factories
@@ -4247,31 +3165,23 @@ func getBuiltins() map[string]*Builtin {
 					return newError("wrong number of arguments to `file`. got=%d, want=1 or 2", len(args))
 				}
 
-				// First argument must be a path dictionary or string
-				var pathDict *Dictionary
+				// First argument must be a path or string
+				var path *Path
 				env := NewEnvironment()
 
 				switch arg := args[0].(type) {
-				case *Dictionary:
-					if !isPathDict(arg) {
-						return newError("first argument to `file` must be a path, got dictionary")
-					}
-					pathDict = arg
+				case *Path:
+					path = arg
 				case *String:
 					components, isAbsolute := parsePathString(arg.Value)
-					pathDict = pathToDict(components, isAbsolute, env)
+					path = newPath(components, isAbsolute)
 				default:
 					return newError("first argument to `file` must be a path or string, got %s", args[0].Type())
 				}
 
 				// Get the path string for format inference
-				pathStr := getFilePathString(&Dictionary{Pairs: map[string]ast.Expression{
-					"_pathComponents": pathDict.Pairs["components"],
-					"_pathAbsolute":   pathDict.Pairs["absolute"],
-				}, Env: env}, env)
-
 				// Auto-detect format from extension
-				format := inferFormatFromExtension(pathStr)
+				format := inferFormatFromExtension(path.Inspect())
 
 				// Second argument is optional options dict
 				var options *Dictionary
@@ -4281,7 +3191,7 @@ func getBuiltins() map[string]*Builtin {
 					}
 				}
 
-				return fileToDict(pathDict, format, options, env)
+				return fileToDict(path, format, options, env)
 			},
 		},
 		"JSON": {
@@ -4302,20 +3212,16 @@ func getBuiltins() map[string]*Builtin {
 
 				// First argument can be a path, URL, or string
 				switch arg := args[0].(type) {
-				case *Dictionary:
-					if isUrlDict(arg) {
-						// URL dictionary - create request handle for fetch
-						return requestToDict(arg, "json", options, env)
-					}
-					if isPathDict(arg) {
-						// Path dictionary - create file handle
-						return fileToDict(arg, "json", options, env)
-					}
-					return newError("first argument to `JSON` must be a path or URL, got dictionary")
+				case *Url:
+					// URL - create request handle for fetch
+					return requestToDict(arg, "json", options, env)
+				case *Path:
+					// Path - create file handle
+					return fileToDict(arg, "json", options, env)
 				case *String:
 					components, isAbsolute := parsePathString(arg.Value)
-					pathDict := pathToDict(components, isAbsolute, env)
-					return fileToDict(pathDict, "json", options, env)
+					path := newPath(components, isAbsolute)
+					return fileToDict(path, "json", options, env)
 				default:
 					return newError("first argument to `JSON` must be a path, URL, or string, got %s", args[0].Type())
 				}
@@ -4327,8 +3233,8 @@ func getBuiltins() map[string]*Builtin {
 					return newError("wrong number of arguments to `YAML`. got=%d, want=1 or 2", len(args))
 				}
 
-				// First argument must be a path dictionary, URL dictionary, or string
-				var pathDict *Dictionary
+				// First argument must be a path, URL, or string
+				var path *Path
 				env := NewEnvironment()
 
 				// Second argument is optional options dict
@@ -4340,24 +3246,87 @@ func getBuiltins() map[string]*Builtin {
 				}
 
 				switch arg := args[0].(type) {
-				case *Dictionary:
-					// Check if it's a URL dict first
-					if isUrlDict(arg) {
-						// Create request dictionary for URL
-						return requestToDict(arg, "yaml", options, env)
+				case *Url:
+					// Create request dictionary for URL
+					return requestToDict(arg, "yaml", options, env)
+				case *Path:
+					path = arg
+				case *String:
+					components, isAbsolute := parsePathString(arg.Value)
+					path = newPath(components, isAbsolute)
+				default:
+					return newError("first argument to `YAML` must be a path, URL, or string, got %s", args[0].Type())
+				}
+
+				return fileToDict(path, "yaml", options, env)
+			},
+		},
+		"TOML": {
+			Fn: func(args ...Object) Object {
+				if len(args) < 1 || len(args) > 2 {
+					return newError("wrong number of arguments to `TOML`. got=%d, want=1 or 2", len(args))
+				}
+
+				// First argument must be a path, URL, or string
+				var path *Path
+				env := NewEnvironment()
+
+				// Second argument is optional options dict
+				var options *Dictionary
+				if len(args) == 2 {
+					if optDict, ok := args[1].(*Dictionary); ok {
+						options = optDict
 					}
-					if !isPathDict(arg) {
-						return newError("first argument to `YAML` must be a path or URL, got dictionary")
+				}
+
+				switch arg := args[0].(type) {
+				case *Url:
+					// Create request dictionary for URL
+					return requestToDict(arg, "toml", options, env)
+				case *Path:
+					path = arg
+				case *String:
+					components, isAbsolute := parsePathString(arg.Value)
+					path = newPath(components, isAbsolute)
+				default:
+					return newError("first argument to `TOML` must be a path, URL, or string, got %s", args[0].Type())
+				}
+
+				return fileToDict(path, "toml", options, env)
+			},
+		},
+		"XML": {
+			Fn: func(args ...Object) Object {
+				if len(args) < 1 || len(args) > 2 {
+					return newError("wrong number of arguments to `XML`. got=%d, want=1 or 2", len(args))
+				}
+
+				// First argument must be a path, URL, or string
+				var path *Path
+				env := NewEnvironment()
+
+				// Second argument is optional options dict
+				var options *Dictionary
+				if len(args) == 2 {
+					if optDict, ok := args[1].(*Dictionary); ok {
+						options = optDict
 					}
-					pathDict = arg
+				}
+
+				switch arg := args[0].(type) {
+				case *Url:
+					// Create request dictionary for URL
+					return requestToDict(arg, "xml", options, env)
+				case *Path:
+					path = arg
 				case *String:
 					components, isAbsolute := parsePathString(arg.Value)
-					pathDict = pathToDict(components, isAbsolute, env)
+					path = newPath(components, isAbsolute)
 				default:
-					return newError("first argument to `YAML` must be a path, URL, or string, got %s", args[0].Type())
+					return newError("first argument to `XML` must be a path, URL, or string, got %s", args[0].Type())
 				}
 
-				return fileToDict(pathDict, "yaml", options, env)
+				return fileToDict(path, "xml", options, env)
 			},
 		},
 		"CSV": {
@@ -4366,8 +3335,8 @@ func getBuiltins() map[string]*Builtin {
 					return newError("wrong number of arguments to `CSV`. got=%d, want=1 or 2", len(args))
 				}
 
-				// First argument must be a path dictionary, URL dictionary, or string
-				var pathDict *Dictionary
+				// First argument must be a path, URL, or string
+				var path *Path
 				env := NewEnvironment()
 
 				// Second argument is optional options dict (e.g., {header: true})
@@ -4379,24 +3348,19 @@ func getBuiltins() map[string]*Builtin {
 				}
 
 				switch arg := args[0].(type) {
-				case *Dictionary:
-					// Check if it's a URL dict first
-					if isUrlDict(arg) {
-						// Create request dictionary for URL
-						return requestToDict(arg, "csv", options, env)
-					}
-					if !isPathDict(arg) {
-						return newError("first argument to `CSV` must be a path or URL, got dictionary")
-					}
-					pathDict = arg
+				case *Url:
+					// Create request dictionary for URL
+					return requestToDict(arg, "csv", options, env)
+				case *Path:
+					path = arg
 				case *String:
 					components, isAbsolute := parsePathString(arg.Value)
-					pathDict = pathToDict(components, isAbsolute, env)
+					path = newPath(components, isAbsolute)
 				default:
 					return newError("first argument to `CSV` must be a path, URL, or string, got %s", args[0].Type())
 				}
 
-				return fileToDict(pathDict, "csv", options, env)
+				return fileToDict(path, "csv", options, env)
 			},
 		},
 		"lines": {
@@ -4405,8 +3369,8 @@ func getBuiltins() map[string]*Builtin {
 					return newError("wrong number of arguments to `lines`. got=%d, want=1 or 2", len(args))
 				}
 
-				// First argument must be a path dictionary, URL dictionary, or string
-				var pathDict *Dictionary
+				// First argument must be a path, URL, or string
+				var path *Path
 				env := NewEnvironment()
 
 				// Second argument is optional options dict
@@ -4418,24 +3382,19 @@ func getBuiltins() map[string]*Builtin {
 				}
 
 				switch arg := args[0].(type) {
-				case *Dictionary:
-					// Check if it's a URL dict first
-					if isUrlDict(arg) {
-						// Create request dictionary for URL
-						return requestToDict(arg, "lines", options, env)
-					}
-					if !isPathDict(arg) {
-						return newError("first argument to `lines` must be a path or URL, got dictionary")
-					}
-					pathDict = arg
+				case *Url:
+					// Create request dictionary for URL
+					return requestToDict(arg, "lines", options, env)
+				case *Path:
+					path = arg
 				case *String:
 					components, isAbsolute := parsePathString(arg.Value)
-					pathDict = pathToDict(components, isAbsolute, env)
+					path = newPath(components, isAbsolute)
 				default:
 					return newError("first argument to `lines` must be a path, URL, or string, got %s", args[0].Type())
 				}
 
-				return fileToDict(pathDict, "lines", options, env)
+				return fileToDict(path, "lines", options, env)
 			},
 		},
 		"text": {
@@ -4444,8 +3403,8 @@ func getBuiltins() map[string]*Builtin {
 					return newError("wrong number of arguments to `text`. got=%d, want=1 or 2", len(args))
 				}
 
-				// First argument must be a path dictionary, URL dictionary, or string
-				var pathDict *Dictionary
+				// First argument must be a path, URL, or string
+				var path *Path
 				env := NewEnvironment()
 
 				// Second argument is optional options dict (e.g., {encoding: "latin1"})
@@ -4457,24 +3416,19 @@ func getBuiltins() map[string]*Builtin {
 				}
 
 				switch arg := args[0].(type) {
-				case *Dictionary:
-					// Check if it's a URL dict first
-					if isUrlDict(arg) {
-						// Create request dictionary for URL
-						return requestToDict(arg, "text", options, env)
-					}
-					if !isPathDict(arg) {
-						return newError("first argument to `text` must be a path or URL, got dictionary")
-					}
-					pathDict = arg
+				case *Url:
+					// Create request dictionary for URL
+					return requestToDict(arg, "text", options, env)
+				case *Path:
+					path = arg
 				case *String:
 					components, isAbsolute := parsePathString(arg.Value)
-					pathDict = pathToDict(components, isAbsolute, env)
+					path = newPath(components, isAbsolute)
 				default:
 					return newError("first argument to `text` must be a path, URL, or string, got %s", args[0].Type())
 				}
 
-				return fileToDict(pathDict, "text", options, env)
+				return fileToDict(path, "text", options, env)
 			},
 		},
 		"bytes": {
@@ -4483,8 +3437,8 @@ func getBuiltins() map[string]*Builtin {
 					return newError("wrong number of arguments to `bytes`. got=%d, want=1 or 2", len(args))
 				}
 
-				// First argument must be a path dictionary, URL dictionary, or string
-				var pathDict *Dictionary
+				// First argument must be a path, URL, or string
+				var path *Path
 				env := NewEnvironment()
 
 				// Second argument is optional options dict
@@ -4496,24 +3450,19 @@ func getBuiltins() map[string]*Builtin {
 				}
 
 				switch arg := args[0].(type) {
-				case *Dictionary:
-					// Check if it's a URL dict first
-					if isUrlDict(arg) {
-						// Create request dictionary for URL
-						return requestToDict(arg, "bytes", options, env)
-					}
-					if !isPathDict(arg) {
-						return newError("first argument to `bytes` must be a path or URL, got dictionary")
-					}
-					pathDict = arg
+				case *Url:
+					// Create request dictionary for URL
+					return requestToDict(arg, "bytes", options, env)
+				case *Path:
+					path = arg
 				case *String:
 					components, isAbsolute := parsePathString(arg.Value)
-					pathDict = pathToDict(components, isAbsolute, env)
+					path = newPath(components, isAbsolute)
 				default:
 					return newError("first argument to `bytes` must be a path, URL, or string, got %s", args[0].Type())
 				}
 
-				return fileToDict(pathDict, "bytes", options, env)
+				return fileToDict(path, "bytes", options, env)
 			},
 		},
 		// SVG file format - reads SVG files and strips XML prolog for use as components
@@ -4523,8 +3472,8 @@ func getBuiltins() map[string]*Builtin {
 					return newError("wrong number of arguments to `SVG`. got=%d, want=1 or 2", len(args))
 				}
 
-				// First argument must be a path dictionary, URL dictionary, or string
-				var pathDict *Dictionary
+				// First argument must be a path, URL, or string
+				var path *Path
 				env := NewEnvironment()
 
 				// Second argument is optional options dict
@@ -4536,24 +3485,19 @@ func getBuiltins() map[string]*Builtin {
 				}
 
 				switch arg := args[0].(type) {
-				case *Dictionary:
-					// Check if it's a URL dict first
-					if isUrlDict(arg) {
-						// Create request dictionary for URL
-						return requestToDict(arg, "svg", options, env)
-					}
-					if !isPathDict(arg) {
-						return newError("first argument to `SVG` must be a path or URL, got dictionary")
-					}
-					pathDict = arg
+				case *Url:
+					// Create request dictionary for URL
+					return requestToDict(arg, "svg", options, env)
+				case *Path:
+					path = arg
 				case *String:
 					components, isAbsolute := parsePathString(arg.Value)
-					pathDict = pathToDict(components, isAbsolute, env)
+					path = newPath(components, isAbsolute)
 				default:
 					return newError("first argument to `SVG` must be a path, URL, or string, got %s", args[0].Type())
 				}
 
-				return fileToDict(pathDict, "svg", options, env)
+				return fileToDict(path, "svg", options, env)
 			},
 		},
 		// Markdown file format - reads MD files with frontmatter support
@@ -4563,8 +3507,8 @@ func getBuiltins() map[string]*Builtin {
 					return newError("wrong number of arguments to `MD`. got=%d, want=1 or 2", len(args))
 				}
 
-				// First argument must be a path dictionary, URL dictionary, or string
-				var pathDict *Dictionary
+				// First argument must be a path, URL, or string
+				var path *Path
 				env := NewEnvironment()
 
 				// Second argument is optional options dict
@@ -4576,24 +3520,19 @@ func getBuiltins() map[string]*Builtin {
 				}
 
 				switch arg := args[0].(type) {
-				case *Dictionary:
-					// Check if it's a URL dict first
-					if isUrlDict(arg) {
-						// Create request dictionary for URL
-						return requestToDict(arg, "md", options, env)
-					}
-					if !isPathDict(arg) {
-						return newError("first argument to `MD` must be a path or URL, got dictionary")
-					}
-					pathDict = arg
+				case *Url:
+					// Create request dictionary for URL
+					return requestToDict(arg, "md", options, env)
+				case *Path:
+					path = arg
 				case *String:
 					components, isAbsolute := parsePathString(arg.Value)
-					pathDict = pathToDict(components, isAbsolute, env)
+					path = newPath(components, isAbsolute)
 				default:
 					return newError("first argument to `MD` must be a path, URL, or string, got %s", args[0].Type())
 				}
 
-				return fileToDict(pathDict, "md", options, env)
+				return fileToDict(path, "md", options, env)
 			},
 		},
 		// Directory handle factory
@@ -4603,24 +3542,21 @@ func getBuiltins() map[string]*Builtin {
 					return newError("wrong number of arguments to `dir`. got=%d, want=1", len(args))
 				}
 
-				// First argument must be a path dictionary or string
-				var pathDict *Dictionary
+				// First argument must be a path or string
+				var path *Path
 				env := NewEnvironment()
 
 				switch arg := args[0].(type) {
-				case *Dictionary:
-					if !isPathDict(arg) {
-						return newError("argument to `dir` must be a path, got dictionary")
-					}
-					pathDict = arg
+				case *Path:
+					path = arg
 				case *String:
 					components, isAbsolute := parsePathString(arg.Value)
-					pathDict = pathToDict(components, isAbsolute, env)
+					path = newPath(components, isAbsolute)
 				default:
 					return newError("argument to `dir` must be a path or string, got %s", args[0].Type())
 				}
 
-				return dirToDict(pathDict, env)
+				return dirToDict(path, env)
 			},
 		},
 		// File pattern matching (glob patterns)
@@ -4634,17 +3570,8 @@ func getBuiltins() map[string]*Builtin {
 				env := NewEnvironment()
 
 				switch arg := args[0].(type) {
-				case *Dictionary:
-					if isPathDict(arg) {
-						// Convert path dict to string
-						// Ensure the dict has an env for evaluation
-						if arg.Env == nil {
-							arg.Env = env
-						}
-						pattern = pathDictToString(arg)
-					} else {
-						return newError("argument to `files` must be a path or string pattern, got dictionary")
-					}
+				case *Path:
+					pattern = arg.Inspect()
 				case *String:
 					pattern = arg.Value
 				default:
@@ -4652,12 +3579,7 @@ func getBuiltins() map[string]*Builtin {
 				}
 
 				// Expand home directory if needed
-				if strings.HasPrefix(pattern, "~/") {
-					home, err := os.UserHomeDir()
-					if err == nil {
-						pattern = filepath.Join(home, pattern[2:])
-					}
-				}
+				pattern = ExpandHome(pattern)
 
 				// Use doublestar for ** glob patterns, fallback to filepath.Glob for simple patterns
 				matches, err := filepath.Glob(pattern)
@@ -4674,14 +3596,14 @@ func getBuiltins() map[string]*Builtin {
 					}
 
 					components, isAbsolute := parsePathString(match)
-					pathDict := pathToDict(components, isAbsolute, env)
+					path := newPath(components, isAbsolute)
 
 					var fileHandle *Dictionary
 					if info.IsDir() {
-						fileHandle = dirToDict(pathDict, env)
+						fileHandle = dirToDict(path, env)
 					} else {
 						format := inferFormatFromExtension(match)
-						fileHandle = fileToDict(pathDict, format, nil, env)
+						fileHandle = fileToDict(path, format, nil, env)
 					}
 					elements = append(elements, fileHandle)
 				}
@@ -4803,30 +3725,64 @@ func getBuiltins() map[string]*Builtin {
 				return &String{Value: p.Sprintf("%v", number.Percent(value))}
 			},
 		},
+		"humanSize": {
+			Fn: func(args ...Object) Object {
+				value, localeStr, opts, errObj := humanizeArgs("humanSize", args)
+				if errObj != nil {
+					return errObj
+				}
+				units := locale.ByteUnitsJEDEC
+				if opts != nil {
+					if unitsExpr, ok := opts.Pairs["units"]; ok {
+						unitsStr, ok := Eval(unitsExpr, opts.Env).(*String)
+						if !ok {
+							return newError("`units` option for `humanSize` must be a string")
+						}
+						switch locale.ByteUnits(unitsStr.Value) {
+						case locale.ByteUnitsJEDEC, locale.ByteUnitsIEC, locale.ByteUnitsSI:
+							units = locale.ByteUnits(unitsStr.Value)
+						default:
+							return newError("invalid units %q for `humanSize`, use 'jedec', 'iec' or 'si'", unitsStr.Value)
+						}
+					}
+				}
+				return &String{Value: locale.FormatByteSize(value, units, localeStr)}
+			},
+		},
+		"humanCount": {
+			Fn: func(args ...Object) Object {
+				value, localeStr, _, errObj := humanizeArgs("humanCount", args)
+				if errObj != nil {
+					return errObj
+				}
+				return &String{Value: locale.FormatCompact(value, locale.CompactStyleShort, localeStr)}
+			},
+		},
+		"approx": {
+			Fn: func(args ...Object) Object {
+				value, localeStr, _, errObj := humanizeArgs("approx", args)
+				if errObj != nil {
+					return errObj
+				}
+				return &String{Value: locale.FormatCompact(value, locale.CompactStyleLong, localeStr)}
+			},
+		},
 		"formatDate": {
 			Fn: func(args ...Object) Object {
 				if len(args) < 1 || len(args) > 3 {
 					return newError("wrong number of arguments to `formatDate`. got=%d, want=1, 2, or 3", len(args))
 				}
 
-				// First argument must be a datetime dictionary
-				dict, ok := args[0].(*Dictionary)
-				if !ok || !isDatetimeDict(dict) {
+				// First argument must be a datetime
+				dt, ok := args[0].(*Datetime)
+				if !ok {
 					return newError("first argument to `formatDate` must be a datetime, got %s", args[0].Type())
 				}
-
-				// Extract time from datetime dictionary
-				var t time.Time
-				if unixExpr, ok := dict.Pairs["unix"]; ok {
-					unixObj := Eval(unixExpr, NewEnvironment())
-					if unixInt, ok := unixObj.(*Integer); ok {
-						t = time.Unix(unixInt.Value, 0).UTC()
-					}
-				}
+				t := dt.Time.UTC()
 
 				// Default style and locale
 				style := "long"
-				locale := "en-US"
+				locale := DefaultLocale
 
 				if len(args) >= 2 {
 					styleStr, ok := args[1].(*String)
@@ -4875,7 +3831,7 @@ func getBuiltins() map[string]*Builtin {
 
 					// Get style (default to "and")
 					style := locale.ListStyleAnd
-					localeStr := "en-US"
+					localeStr := DefaultLocale
 
 					if len(args) >= 2 {
 						styleStr, ok := args[1].(*String)
@@ -4906,28 +3862,26 @@ func getBuiltins() map[string]*Builtin {
 					return &String{Value: result}
 				}
 
-				// Handle duration dictionaries
-				dict, ok := args[0].(*Dictionary)
+				// Handle durations
+				dur, ok := args[0].(*Duration)
 				if !ok {
 					return newError("first argument to `format` must be a duration or array, got %s", args[0].Type())
 				}
+				months, seconds := dur.Months, dur.Seconds()
 
-				if !isDurationDict(dict) {
-					return newError("first argument to `format` must be a duration, got dictionary")
-				}
-
-				// Extract months and seconds from duration
-				months, seconds, err := getDurationComponents(dict, NewEnvironment())
-				if err != nil {
-					return newError("invalid duration: %s", err.Error())
+				// Options dictionary formats the duration as a list of units
+				if len(args) == 2 {
+					if opts, ok := args[1].(*Dictionary); ok {
+						return formatDurationWithOptions(months, seconds, opts)
+					}
 				}
 
-				// Get locale (default to en-US)
-				localeStr := "en-US"
+				// Get locale (default to DefaultLocale)
+				localeStr := DefaultLocale
 				if len(args) == 2 {
 					locStr, ok := args[1].(*String)
 					if !ok {
-						return newError("second argument to `format` must be a string, got %s", args[1].Type())
+						return newError("second argument to `format` must be a string or dictionary, got %s", args[1].Type())
 					}
 					localeStr = locStr.Value
 				}
@@ -4937,6 +3891,205 @@ func getBuiltins() map[string]*Builtin {
 				return &String{Value: result}
 			},
 		},
+		"relative": {
+			Fn: func(args ...Object) Object {
+				if len(args) < 1 || len(args) > 2 {
+					return newError("wrong number of arguments to `relative`. got=%d, want=1 or 2", len(args))
+				}
+
+				dt, ok := args[0].(*Datetime)
+				if !ok {
+					return newError("first argument to `relative` must be a datetime, got %s", args[0].Type())
+				}
+
+				var opts *Dictionary
+				if len(args) == 2 {
+					opts, ok = args[1].(*Dictionary)
+					if !ok {
+						return newError("second argument to `relative` must be a dictionary, got %s", args[1].Type())
+					}
+				}
+
+				return formatRelativeDatetime(dt, opts, NewEnvironment())
+			},
+		},
+		"holidays": {
+			Fn: func(args ...Object) Object {
+				if len(args) < 2 || len(args) > 3 {
+					return newError("wrong number of arguments to `holidays`. got=%d, want=2 or 3", len(args))
+				}
+
+				cal, errObj := resolveHolidayCalendar(args[0], "holidays")
+				if errObj != nil {
+					return errObj
+				}
+
+				year, ok := args[1].(*Integer)
+				if !ok {
+					return newError("second argument to `holidays` must be an integer (year), got %s", args[1].Type())
+				}
+
+				withNames := false
+				if len(args) == 3 {
+					opts, ok := args[2].(*Dictionary)
+					if !ok {
+						return newError("third argument to `holidays` must be a dictionary, got %s", args[2].Type())
+					}
+					if namesExpr, ok := opts.Pairs["names"]; ok {
+						if namesBool, ok := Eval(namesExpr, opts.Env).(*Boolean); ok {
+							withNames = namesBool.Value
+						}
+					}
+				}
+
+				list := cal.Holidays(int(year.Value))
+				elements := make([]Object, len(list))
+				for i, h := range list {
+					date := newDatetime(h.Date, "date")
+					if withNames {
+						elements[i] = NewDictionaryFromObjects(map[string]Object{
+							"name": &String{Value: h.Name},
+							"date": date,
+						})
+					} else {
+						elements[i] = date
+					}
+				}
+				return &Array{Elements: elements}
+			},
+		},
+		"isHoliday": {
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments to `isHoliday`. got=%d, want=2", len(args))
+				}
+
+				t, errObj := datetimeArgToTime(args[0], "isHoliday")
+				if errObj != nil {
+					return errObj
+				}
+
+				cal, errObj := resolveHolidayCalendar(args[1], "isHoliday")
+				if errObj != nil {
+					return errObj
+				}
+
+				_, found := cal.Find(t)
+				return nativeBoolToParsBoolean(found)
+			},
+		},
+		"isWorkday": {
+			Fn: func(args ...Object) Object {
+				if len(args) < 1 || len(args) > 2 {
+					return newError("wrong number of arguments to `isWorkday`. got=%d, want=1 or 2", len(args))
+				}
+
+				t, errObj := datetimeArgToTime(args[0], "isWorkday")
+				if errObj != nil {
+					return errObj
+				}
+
+				if t.Weekday() == time.Saturday || t.Weekday() == time.Sunday {
+					return FALSE
+				}
+
+				if len(args) == 2 {
+					cal, errObj := resolveHolidayCalendar(args[1], "isWorkday")
+					if errObj != nil {
+						return errObj
+					}
+					if _, found := cal.Find(t); found {
+						return FALSE
+					}
+				}
+				return TRUE
+			},
+		},
+		"color": {
+			Fn: func(args ...Object) Object {
+				return evalColor(args)
+			},
+		},
+		"formatPhone": {
+			Fn: func(args ...Object) Object {
+				return evalFormatPhone(args)
+			},
+		},
+		"validatePhone": {
+			Fn: func(args ...Object) Object {
+				return evalValidatePhone(args)
+			},
+		},
+		"formatPostalCode": {
+			Fn: func(args ...Object) Object {
+				return evalFormatPostalCode(args)
+			},
+		},
+		"validatePostalCode": {
+			Fn: func(args ...Object) Object {
+				return evalValidatePostalCode(args)
+			},
+		},
+		"isEmail": {
+			Fn: func(args ...Object) Object {
+				return evalIsEmail(args)
+			},
+		},
+		"normalizeEmail": {
+			Fn: func(args ...Object) Object {
+				return evalNormalizeEmail(args)
+			},
+		},
+		"obfuscateEmail": {
+			Fn: func(args ...Object) Object {
+				return evalObfuscateEmail(args)
+			},
+		},
+		"css": {
+			Fn: func(args ...Object) Object {
+				return evalCSS(args)
+			},
+		},
+		"monthGrid": {
+			Fn: func(args ...Object) Object {
+				if len(args) < 1 || len(args) > 2 {
+					return newError("wrong number of arguments to `monthGrid`. got=%d, want=1 or 2", len(args))
+				}
+
+				t, errObj := datetimeArgToTime(args[0], "monthGrid")
+				if errObj != nil {
+					return errObj
+				}
+
+				weekStart, fixedWeeks := time.Sunday, false
+				if len(args) == 2 {
+					opts, ok := args[1].(*Dictionary)
+					if !ok {
+						return newError("second argument to `monthGrid` must be a dictionary, got %s", args[1].Type())
+					}
+					if expr, ok := opts.Pairs["weekStart"]; ok {
+						name, ok := Eval(expr, opts.Env).(*String)
+						if !ok {
+							return newError("`weekStart` option for `monthGrid` must be a weekday name")
+						}
+						day, ok := parseWeekday(name.Value)
+						if !ok {
+							return newError("`weekStart` option for `monthGrid`: unknown weekday %q", name.Value)
+						}
+						weekStart = day
+					}
+					if expr, ok := opts.Pairs["fixedWeeks"]; ok {
+						b, ok := Eval(expr, opts.Env).(*Boolean)
+						if !ok {
+							return newError("`fixedWeeks` option for `monthGrid` must be a boolean")
+						}
+						fixedWeeks = b.Value
+					}
+				}
+
+				return monthGrid(t, weekStart, fixedWeeks, NewEnvironment())
+			},
+		},
 		"map": {
 			Fn: func(args ...Object) Object {
 				if len(args) < 2 {
@@ -5064,8 +4217,6 @@ func getBuiltins() map[string]*Builtin {
 				}
 
 				// Second arg can be string or regex
-				var pattern string
-				var flags string
 				if str, ok := args[1].(*String); ok {
 					// String pattern - use literal replacement
 					replacement, ok := args[2].(*String)
@@ -5073,36 +4224,18 @@ func getBuiltins() map[string]*Builtin {
 						return newError("third argument to `replace` must be a string, got %s", args[2].Type())
 					}
 					return &String{Value: strings.Replace(text.Value, str.Value, replacement.Value, -1)}
-				} else if dict, ok := args[1].(*Dictionary); ok && isRegexDict(dict) {
-					// Regex pattern
-					patternExpr, _ := dict.Pairs["pattern"]
-					patternObj := Eval(patternExpr, NewEnvironment())
-					patternStr := patternObj.(*String)
-					pattern = patternStr.Value
-
-					flagsExpr, ok := dict.Pairs["flags"]
-					if ok {
-						flagsObj := Eval(flagsExpr, NewEnvironment())
-						if flagsStr, ok := flagsObj.(*String); ok {
-							flags = flagsStr.Value
-						}
-					}
-				} else {
-					return newError("second argument to `replace` must be a string or regex, got %s", args[1].Type())
 				}
-
-				replacement, ok := args[2].(*String)
-				if !ok {
-					return newError("third argument to `replace` must be a string, got %s", args[2].Type())
+				dict, ok := args[1].(*Dictionary)
+				if !ok || !isRegexDict(dict) {
+					return newError("second argument to `replace` must be a string or regex, got %s", args[1].Type())
 				}
 
-				re, err := compileRegex(pattern, flags)
+				// Regex pattern - the replacement can be a string or a function
+				re, err := compileRegexDict(dict, NewEnvironment())
 				if err != nil {
 					return newError("invalid regex: %s", err.Error())
 				}
-
-				result := re.ReplaceAllString(text.Value, replacement.Value)
-				return &String{Value: result}
+				return regexReplace(re, text.Value, args[2], NewEnvironment())
 			},
 		},
 		"split": {
@@ -5227,16 +4360,22 @@ func getBuiltins() map[string]*Builtin {
 						arg = Eval(dataExpr, dict.Env)
 					}
 				}
+				if dict, ok := arg.(*Dictionary); ok && isMatchDict(dict) {
+					arg = matchElements(dict)
+				}
 
 				switch a := arg.(type) {
 				case *String:
 					return &Integer{Value: int64(len(a.Value))}
 				case *Array:
 					return &Integer{Value: int64(len(a.Elements))}
+				case *Range:
+					return &Integer{Value: a.length()}
 				default:
 					return newError("argument to `len` not supported, got %s", args[0].Type())
 				}
 			},
+			Ranges: true,
 		},
 		"repr": {
 			Fn: func(args ...Object) Object {
@@ -5256,6 +4395,9 @@ func getBuiltins() map[string]*Builtin {
 				case *Dictionary:
 					// For all dictionaries (including pseudo-types), return the raw dict representation
 					return &String{Value: obj.Inspect()}
+				case fieldValue:
+					// Datetimes, durations, paths and URLs show their literal
+					return &String{Value: obj.literal()}
 				case *Array:
 					return &String{Value: obj.Inspect()}
 				case *String:
@@ -5278,37 +4420,120 @@ func getBuiltins() map[string]*Builtin {
 				}
 			},
 		},
-		"toInt": {
+		"parse": {
 			Fn: func(args ...Object) Object {
 				if len(args) != 1 {
-					return newError("wrong number of arguments to `toInt`. got=%d, want=1", len(args))
+					return newError("wrong number of arguments to `parse`. got=%d, want=1", len(args))
 				}
-
-				str, ok := args[0].(*String)
+				src, ok := args[0].(*String)
 				if !ok {
-					return newError("argument to `toInt` must be a string, got %s", args[0].Type())
+					return newError("argument to `parse` must be a string, got %s", args[0].Type())
 				}
-
-				var val int64
-				_, err := fmt.Sscanf(str.Value, "%d", &val)
-				if err != nil {
-					return newError("cannot convert '%s' to integer", str.Value)
+				program, errObj := parseSource(src.Value)
+				if errObj != nil {
+					return errObj
 				}
-
-				return &Integer{Value: val}
+				return astToObject(reflect.ValueOf(program))
 			},
 		},
-		"toFloat": {
+		"typeOf": {
 			Fn: func(args ...Object) Object {
 				if len(args) != 1 {
-					return newError("wrong number of arguments to `toFloat`. got=%d, want=1", len(args))
+					return newError("wrong number of arguments to `typeOf`. got=%d, want=1", len(args))
 				}
-
-				str, ok := args[0].(*String)
+				return &String{Value: typeName(args[0])}
+			},
+			Ranges: true,
+		},
+		"isA": {
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments to `isA`. got=%d, want=2", len(args))
+				}
+				name, ok := args[1].(*String)
 				if !ok {
-					return newError("argument to `toFloat` must be a string, got %s", args[0].Type())
+					return newError("second argument to `isA` must be a type name string, got %s", args[1].Type())
 				}
-
+				return nativeBoolToParsBoolean(isType(args[0], name.Value))
+			},
+			Ranges: true,
+		},
+		"methods": {
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `methods`. got=%d, want=1", len(args))
+				}
+				names := objectMethods(args[0])
+				elements := make([]Object, len(names))
+				for i, name := range names {
+					elements[i] = &String{Value: name}
+				}
+				return &Array{Elements: elements}
+			},
+			Ranges: true,
+		},
+		"arity": {
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `arity`. got=%d, want=1", len(args))
+				}
+				switch fn := args[0].(type) {
+				case *Function:
+					return &Integer{Value: int64(fn.ParamCount())}
+				case *Builtin:
+					// Builtins check their own arguments and many are variadic
+					return NULL
+				default:
+					return newError("argument to `arity` must be a function, got %s", args[0].Type())
+				}
+			},
+		},
+		"toInt": {
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `toInt`. got=%d, want=1", len(args))
+				}
+
+				var str *String
+				switch arg := args[0].(type) {
+				case *Integer:
+					return arg
+				case *Float:
+					// Truncates toward zero, like idiv()
+					return &Integer{Value: int64(arg.Value)}
+				case *String:
+					str = arg
+				default:
+					return newError("argument to `toInt` must be a string or number, got %s", args[0].Type())
+				}
+
+				var val int64
+				_, err := fmt.Sscanf(str.Value, "%d", &val)
+				if err != nil {
+					return newError("cannot convert '%s' to integer", str.Value)
+				}
+
+				return &Integer{Value: val}
+			},
+		},
+		"toFloat": {
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `toFloat`. got=%d, want=1", len(args))
+				}
+
+				var str *String
+				switch arg := args[0].(type) {
+				case *Float:
+					return arg
+				case *Integer:
+					return &Float{Value: float64(arg.Value)}
+				case *String:
+					str = arg
+				default:
+					return newError("argument to `toFloat` must be a string or number, got %s", args[0].Type())
+				}
+
 				var val float64
 				_, err := fmt.Sscanf(str.Value, "%f", &val)
 				if err != nil {
@@ -5324,9 +4549,14 @@ func getBuiltins() map[string]*Builtin {
 					return newError("wrong number of arguments to `toNumber`. got=%d, want=1", len(args))
 				}
 
-				str, ok := args[0].(*String)
-				if !ok {
-					return newError("argument to `toNumber` must be a string, got %s", args[0].Type())
+				var str *String
+				switch arg := args[0].(type) {
+				case *Integer, *Float:
+					return arg
+				case *String:
+					str = arg
+				default:
+					return newError("argument to `toNumber` must be a string or number, got %s", args[0].Type())
 				}
 
 				// Try to parse as integer first
@@ -5414,10 +4644,69 @@ func getBuiltins() map[string]*Builtin {
 				return NULL
 			},
 		},
-		"sort": {
+		"range": {
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 && len(args) != 3 {
+					return newError("wrong number of arguments to `range`. got=%d, want=2 or 3", len(args))
+				}
+
+				// range(start, end, step) is start..end by step
+				var step Object
+				if len(args) == 3 {
+					step = args[2]
+				}
+				r, err := newRange(lexer.Token{}, args[0], args[1], step)
+				if err != nil {
+					return err
+				}
+				return r
+			},
+		},
+		"iter": {
 			Fn: func(args ...Object) Object {
 				if len(args) != 1 {
-					return newError("wrong number of arguments to `sort`. got=%d, want=1", len(args))
+					return newError("wrong number of arguments to `iter`. got=%d, want=1", len(args))
+				}
+				return newGenerator(args[0])
+			},
+		},
+		"counter": {
+			Fn: func(args ...Object) Object {
+				return newCounter(args)
+			},
+		},
+		"stopwatch": {
+			Fn: func(args ...Object) Object {
+				return newStopwatch(args)
+			},
+		},
+		"sleep": {
+			Fn: func(args ...Object) Object {
+				return evalSleep(args)
+			},
+		},
+		"collector": {
+			Fn: func(args ...Object) Object {
+				if len(args) != 0 {
+					return newError("wrong number of arguments to `collector`. got=%d, want=0", len(args))
+				}
+				return &Collector{}
+			},
+		},
+		"atomicDict": {
+			Fn: func(args ...Object) Object {
+				return newAtomicDict(args)
+			},
+		},
+		"channel": {
+			Fn: func(args ...Object) Object {
+				return newChannel(args)
+			},
+		},
+		"sort": {
+			Fn: func(args ...Object) Object {
+				if len(args) < 1 || len(args) > 2 {
+					return newError("wrong number of arguments to `sort`. got=%d, want=1 or 2", len(args))
 				}
 
 				arr, ok := args[0].(*Array)
@@ -5425,6 +4714,18 @@ func getBuiltins() map[string]*Builtin {
 					return newError("argument to `sort` must be an array, got %s", args[0].Type())
 				}
 
+				if len(args) == 2 {
+					opts, ok := args[1].(*Dictionary)
+					if !ok {
+						return newError("second argument to `sort` must be a dictionary, got %s", args[1].Type())
+					}
+					so, errObj := parseSortOptions(opts)
+					if errObj != nil {
+						return errObj
+					}
+					return sortArrayWithOptions(arr, so)
+				}
+
 				// Create a copy to avoid modifying the original
 				sortedElements := make([]Object, len(arr.Elements))
 				copy(sortedElements, arr.Elements)
@@ -5468,40 +4769,108 @@ func getBuiltins() map[string]*Builtin {
 					return newError("first argument to `sortBy` must be an array, got %s", args[0].Type())
 				}
 
-				compareFn := args[1]
+				// Deprecated: 2-parameter comparator returning the pair in order
+				if fn, ok := args[1].(*Function); ok && fn.ParamCount() == 2 {
+					return sortArrayByComparator(arr, fn)
+				}
 
-				// Verify it's a function
-				fn, ok := compareFn.(*Function)
-				if !ok {
-					return newError("second argument to `sortBy` must be a function, got %s", compareFn.Type())
+				keys, errObj := parseSortKeys(args[1])
+				if errObj != nil {
+					return errObj
+				}
+				return sortArrayByKeys(arr, keys)
+			},
+		},
+		"windows": {
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments to `windows`. got=%d, want=2", len(args))
 				}
 
-				// Verify the function takes exactly 2 parameters
-				if fn.ParamCount() != 2 {
-					return newError("comparison function must take exactly 2 parameters, got %d", fn.ParamCount())
+				arr, ok := args[0].(*Array)
+				if !ok {
+					return newError("first argument to `windows` must be an array, got %s", args[0].Type())
+				}
+				size, ok := args[1].(*Integer)
+				if !ok || size.Value <= 0 {
+					return newError("second argument to `windows` must be a positive integer, got %s", args[1].Inspect())
 				}
 
-				// Create a copy to avoid modifying the original
-				sortedElements := make([]Object, len(arr.Elements))
-				copy(sortedElements, arr.Elements)
+				// Each run of size consecutive elements; none if the array is shorter
+				n := int(size.Value)
+				windows := []Object{}
+				for i := 0; i+n <= len(arr.Elements); i++ {
+					windows = append(windows, &Array{Elements: arr.Elements[i : i+n]})
+				}
+				return &Array{Elements: windows}
+			},
+		},
+		"partition": {
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments to `partition`. got=%d, want=2", len(args))
+				}
 
-				// Sort using the custom comparison function
-				sort.Slice(sortedElements, func(i, j int) bool {
-					// Call the comparison function with the two elements
-					result := applyFunction(fn, []Object{sortedElements[i], sortedElements[j]})
+				arr, ok := args[0].(*Array)
+				if !ok {
+					return newError("first argument to `partition` must be an array, got %s", args[0].Type())
+				}
+				fn, ok := args[1].(*Function)
+				if !ok {
+					return newError("second argument to `partition` must be a function, got %s", args[1].Type())
+				}
 
-					// The function should return a 2-element array
-					resultArr, ok := result.(*Array)
-					if !ok || len(resultArr.Elements) != 2 {
-						return false
+				// [elements fn accepts, the rest], each in their original order
+				matching, rest := []Object{}, []Object{}
+				for _, elem := range arr.Elements {
+					result := applyFunction(fn, []Object{elem})
+					if isError(result) {
+						return result
+					}
+					if isTruthy(result) {
+						matching = append(matching, elem)
+					} else {
+						rest = append(rest, elem)
 					}
+				}
+				return &Array{Elements: []Object{&Array{Elements: matching}, &Array{Elements: rest}}}
+			},
+		},
+		"splitWhen": {
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments to `splitWhen`. got=%d, want=2", len(args))
+				}
 
-					// Check if the first element equals sortedElements[i]
-					// If so, it means i comes before j (ascending order)
-					return objectsEqual(resultArr.Elements[0], sortedElements[i])
-				})
+				arr, ok := args[0].(*Array)
+				if !ok {
+					return newError("first argument to `splitWhen` must be an array, got %s", args[0].Type())
+				}
+				fn, ok := args[1].(*Function)
+				if !ok {
+					return newError("second argument to `splitWhen` must be a function, got %s", args[1].Type())
+				}
+				if fn.ParamCount() != 2 {
+					return newError("function passed to `splitWhen` must take 2 parameters (previous, current), got %d", fn.ParamCount())
+				}
 
-				return &Array{Elements: sortedElements}
+				// Start a new group between neighbours whenever fn(prev, curr) is true
+				groups := []Object{}
+				start := 0
+				for i := 1; i < len(arr.Elements); i++ {
+					result := applyFunction(fn, []Object{arr.Elements[i-1], arr.Elements[i]})
+					if isError(result) {
+						return result
+					}
+					if isTruthy(result) {
+						groups = append(groups, &Array{Elements: arr.Elements[start:i]})
+						start = i
+					}
+				}
+				if len(arr.Elements) > 0 {
+					groups = append(groups, &Array{Elements: arr.Elements[start:]})
+				}
+				return &Array{Elements: groups}
 			},
 		},
 		"keys": {
@@ -5565,6 +4934,151 @@ func getBuiltins() map[string]*Builtin {
 				return nativeBoolToParsBoolean(exists)
 			},
 		},
+		"get": {
+			Fn: func(args ...Object) Object {
+				if len(args) < 2 || len(args) > 3 {
+					return newError("wrong number of arguments to `get`. got=%d, want=2 or 3", len(args))
+				}
+
+				var def Object = NULL
+				if len(args) == 3 {
+					def = args[2]
+				}
+
+				var path []Object
+				switch p := args[1].(type) {
+				case *String:
+					if p.Value != "" {
+						for _, key := range strings.Split(p.Value, ".") {
+							path = append(path, &String{Value: key})
+						}
+					}
+				case *Array:
+					for _, key := range p.Elements {
+						if key.Type() != STRING_OBJ && key.Type() != INTEGER_OBJ {
+							return newError("path elements for `get` must be strings or integers, got %s", key.Type())
+						}
+					}
+					path = p.Elements
+				default:
+					return newError("second argument to `get` must be a string or array, got %s", args[1].Type())
+				}
+
+				value := getPath(args[0], path)
+				if value == nil || value == NULL {
+					return def
+				}
+				return value
+			},
+		},
+		"toc": {
+			Fn: func(args ...Object) Object {
+				if len(args) < 1 || len(args) > 2 {
+					return newError("wrong number of arguments to `toc`. got=%d, want=1 or 2", len(args))
+				}
+
+				src, errObj := htmlContent(args[0], "toc")
+				if errObj != nil {
+					return errObj
+				}
+				opts := tocOptions{min: 2, max: 3}
+				if len(args) == 2 {
+					optDict, ok := args[1].(*Dictionary)
+					if !ok {
+						return newError("second argument to `toc` must be a dictionary, got %s", args[1].Type())
+					}
+					if opts, errObj = parseTOCOptions(optDict); errObj != nil {
+						return errObj
+					}
+				}
+
+				out, headings := buildTOC(src, opts)
+				env := NewEnvironment()
+				return &Dictionary{Pairs: map[string]ast.Expression{
+					"html":  objectToExpression(&String{Value: out}),
+					"items": objectToExpression(tocItems(headings, env)),
+				}, Env: env}
+			},
+		},
+		"seo": {
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `seo`. got=%d, want=1", len(args))
+				}
+				opts, ok := args[0].(*Dictionary)
+				if !ok {
+					return newError("argument to `seo` must be a dictionary, got %s", args[0].Type())
+				}
+
+				tags, errObj := buildSEOTags(opts)
+				if errObj != nil {
+					return errObj
+				}
+				return &String{Value: tags}
+			},
+		},
+		"jsonld": {
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `jsonld`. got=%d, want=1", len(args))
+				}
+				data, ok := args[0].(*Dictionary)
+				if !ok {
+					return newError("argument to `jsonld` must be a dictionary, got %s", args[0].Type())
+				}
+
+				script, errObj := buildJSONLD(data)
+				if errObj != nil {
+					return errObj
+				}
+				return &String{Value: script}
+			},
+		},
+		"toText": {
+			Fn: func(args ...Object) Object {
+				if len(args) < 1 || len(args) > 2 {
+					return newError("wrong number of arguments to `toText`. got=%d, want=1 or 2", len(args))
+				}
+
+				src, errObj := htmlContent(args[0], "toText")
+				if errObj != nil {
+					return errObj
+				}
+				width := 72
+				if len(args) == 2 {
+					opts, ok := args[1].(*Dictionary)
+					if !ok {
+						return newError("second argument to `toText` must be a dictionary, got %s", args[1].Type())
+					}
+					if width, errObj = parseToTextOptions(opts); errObj != nil {
+						return errObj
+					}
+				}
+				return &String{Value: htmlToText(src, width)}
+			},
+		},
+		"validateHTML": {
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `validateHTML`. got=%d, want=1", len(args))
+				}
+				str, ok := args[0].(*String)
+				if !ok {
+					return newError("argument to `validateHTML` must be a string, got %s", args[0].Type())
+				}
+
+				problems := formatter.ValidateHTML(str.Value)
+				env := NewEnvironment()
+				elements := make([]Object, len(problems))
+				for i, p := range problems {
+					elements[i] = &Dictionary{Pairs: map[string]ast.Expression{
+						"line":    objectToExpression(&Integer{Value: int64(p.Line)}),
+						"message": objectToExpression(&String{Value: p.Message}),
+					}, Env: env}
+				}
+				return &Array{Elements: elements}
+			},
+		},
 		"toArray": {
 			Fn: func(args ...Object) Object {
 				if len(args) != 1 {
@@ -5619,68 +5133,92 @@ func getBuiltins() map[string]*Builtin {
 					Pairs: make(map[string]ast.Expression),
 					Env:   NewEnvironment(),
 				}
-
-				for _, elem := range arr.Elements {
-					pair, ok := elem.(*Array)
-					if !ok || len(pair.Elements) != 2 {
-						return newError("toDict requires array of [key, value] pairs")
-					}
-
-					keyObj, ok := pair.Elements[0].(*String)
-					if !ok {
-						return newError("dictionary keys must be strings, got %s", pair.Elements[0].Type())
-					}
-
-					// Create a literal expression from the value
-					valueObj := pair.Elements[1]
-					var expr ast.Expression
-
-					switch v := valueObj.(type) {
-					case *Integer:
-						expr = &ast.IntegerLiteral{Value: v.Value}
-					case *Float:
-						expr = &ast.FloatLiteral{Value: v.Value}
-					case *String:
-						expr = &ast.StringLiteral{Value: v.Value}
-					case *Boolean:
-						expr = &ast.Boolean{Value: v.Value}
-					case *Array:
-						// For arrays, we'll store a reference that evaluates to the array
-						// This is a workaround - store in environment and reference it
-						tempKey := "__toDict_temp_" + keyObj.Value
-						dict.Env.Set(tempKey, v)
-						expr = &ast.Identifier{Value: tempKey}
-					default:
-						return newError("toDict: unsupported value type %s", valueObj.Type())
-					}
-
-					dict.Pairs[keyObj.Value] = expr
+				if err := addDictionaryEntries(dict, arr, "toDict"); err != nil {
+					return err
 				}
-
 				return dict
 			},
 		},
-		"COMMAND": {
+		"fromEntries": {
 			Fn: func(args ...Object) Object {
-				if len(args) < 1 || len(args) > 3 {
-					return newError("wrong number of arguments to `COMMAND`. got=%d, want=1-3", len(args))
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `fromEntries`. got=%d, want=1", len(args))
 				}
 
-				env := NewEnvironment()
-
-				// First argument: binary name/path (string)
-				binary, ok := args[0].(*String)
+				arr, ok := args[0].(*Array)
 				if !ok {
-					return newError("first argument to `COMMAND` must be a string, got %s", args[0].Type())
+					return newError("argument to `fromEntries` must be an array, got %s", args[0].Type())
 				}
 
-				// Second argument (optional): args array
-				var cmdArgs []string
-				if len(args) >= 2 {
-					if argsArray, ok := args[1].(*Array); ok {
-						cmdArgs = make([]string, len(argsArray.Elements))
-						for i, arg := range argsArray.Elements {
-							if str, ok := arg.(*String); ok {
+				dict := &Dictionary{
+					Pairs: make(map[string]ast.Expression),
+					Env:   NewEnvironment(),
+				}
+				if err := addDictionaryEntries(dict, arr, "fromEntries"); err != nil {
+					return err
+				}
+				return dict
+			},
+		},
+		"resolve": {
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments to `resolve`. got=%d, want=1", len(args))
+				}
+				return evalResolve(args[0])
+			},
+		},
+		"ping": {
+			Fn: func(args ...Object) Object {
+				if len(args) < 1 || len(args) > 2 {
+					return newError("wrong number of arguments to `ping`. got=%d, want=1 or 2", len(args))
+				}
+				var opts *Dictionary
+				if len(args) == 2 {
+					var ok bool
+					if opts, ok = args[1].(*Dictionary); !ok {
+						return newError("second argument to `ping` must be a dictionary, got %s", args[1].Type())
+					}
+				}
+				return evalPing(args[0], opts)
+			},
+		},
+		"portOpen": {
+			Fn: func(args ...Object) Object {
+				if len(args) < 2 || len(args) > 3 {
+					return newError("wrong number of arguments to `portOpen`. got=%d, want=2 or 3", len(args))
+				}
+				var opts *Dictionary
+				if len(args) == 3 {
+					var ok bool
+					if opts, ok = args[2].(*Dictionary); !ok {
+						return newError("third argument to `portOpen` must be a dictionary, got %s", args[2].Type())
+					}
+				}
+				return evalPortOpen(args[0], args[1], opts)
+			},
+		},
+		"COMMAND": {
+			Fn: func(args ...Object) Object {
+				if len(args) < 1 || len(args) > 3 {
+					return newError("wrong number of arguments to `COMMAND`. got=%d, want=1-3", len(args))
+				}
+
+				env := NewEnvironment()
+
+				// First argument: binary name/path (string)
+				binary, ok := args[0].(*String)
+				if !ok {
+					return newError("first argument to `COMMAND` must be a string, got %s", args[0].Type())
+				}
+
+				// Second argument (optional): args array
+				var cmdArgs []string
+				if len(args) >= 2 {
+					if argsArray, ok := args[1].(*Array); ok {
+						cmdArgs = make([]string, len(argsArray.Elements))
+						for i, arg := range argsArray.Elements {
+							if str, ok := arg.(*String); ok {
 								cmdArgs[i] = str.Value
 							} else {
 								return newError("COMMAND arguments must be strings, got %s at index %d", arg.Type(), i)
@@ -5706,30 +5244,68 @@ func getBuiltins() map[string]*Builtin {
 		},
 		"parseJSON": {
 			Fn: func(args ...Object) Object {
-				if len(args) != 1 {
-					return newError("parseJSON() expects 1 argument, got=%d", len(args))
+				if len(args) < 1 || len(args) > 2 {
+					return newError("parseJSON() expects 1-2 arguments, got=%d", len(args))
 				}
 				str, ok := args[0].(*String)
 				if !ok {
 					return newError("parseJSON() expects string argument, got %s", args[0].Type())
 				}
 
+				revive := false
+				if len(args) == 2 {
+					opts, ok := args[1].(*Dictionary)
+					if !ok {
+						return newError("parseJSON() options must be a dictionary, got %s", args[1].Type())
+					}
+					if reviveExpr, ok := opts.Pairs["revive"]; ok {
+						b, ok := Eval(reviveExpr, opts.Env).(*Boolean)
+						if !ok {
+							return newError("`revive` option for parseJSON() must be a boolean")
+						}
+						revive = b.Value
+					}
+				}
+
 				var result interface{}
 				if err := json.Unmarshal([]byte(str.Value), &result); err != nil {
 					return newError("parseJSON error: %s", err.Error())
 				}
 
+				if revive {
+					return reviveTypedValues(jsonToObject(result))
+				}
 				return jsonToObject(result)
 			},
 		},
 		"stringifyJSON": {
 			Fn: func(args ...Object) Object {
-				if len(args) != 1 {
-					return newError("stringifyJSON() expects 1 argument, got=%d", len(args))
+				if len(args) < 1 || len(args) > 2 {
+					return newError("stringifyJSON() expects 1-2 arguments, got=%d", len(args))
+				}
+
+				indent := ""
+				if len(args) == 2 {
+					opts, ok := args[1].(*Dictionary)
+					if !ok {
+						return newError("stringifyJSON() options must be a dictionary, got %s", args[1].Type())
+					}
+					var errObj *Error
+					indent, errObj = parseJSONIndentOptions(opts)
+					if errObj != nil {
+						return errObj
+					}
 				}
 
+				// Dictionary keys are always emitted in sorted order, so output is stable
 				jsonData := objectToGo(args[0])
-				jsonBytes, err := json.Marshal(jsonData)
+				var jsonBytes []byte
+				var err error
+				if indent != "" {
+					jsonBytes, err = json.MarshalIndent(jsonData, "", indent)
+				} else {
+					jsonBytes, err = json.Marshal(jsonData)
+				}
 				if err != nil {
 					return newError("stringifyJSON error: %s", err.Error())
 				}
@@ -5737,103 +5313,165 @@ func getBuiltins() map[string]*Builtin {
 				return &String{Value: string(jsonBytes)}
 			},
 		},
-		"parseCSV": {
+		"parseYAML": {
 			Fn: func(args ...Object) Object {
 				if len(args) < 1 || len(args) > 2 {
-					return newError("parseCSV() expects 1-2 arguments, got=%d", len(args))
+					return newError("parseYAML() expects 1-2 arguments, got=%d", len(args))
 				}
 				str, ok := args[0].(*String)
 				if !ok {
-					return newError("parseCSV() expects string argument, got %s", args[0].Type())
+					return newError("parseYAML() expects string argument, got %s", args[0].Type())
 				}
 
-				// Parse options if provided
-				hasHeader := false
+				revive := false
 				if len(args) == 2 {
-					if optDict, ok := args[1].(*Dictionary); ok {
-						if headerExpr, exists := optDict.Pairs["header"]; exists {
-							headerObj := Eval(headerExpr, optDict.Env)
-							if headerBool, ok := headerObj.(*Boolean); ok {
-								hasHeader = headerBool.Value
-							}
+					opts, ok := args[1].(*Dictionary)
+					if !ok {
+						return newError("parseYAML() options must be a dictionary, got %s", args[1].Type())
+					}
+					if reviveExpr, ok := opts.Pairs["revive"]; ok {
+						b, ok := Eval(reviveExpr, opts.Env).(*Boolean)
+						if !ok {
+							return newError("`revive` option for parseYAML() must be a boolean")
 						}
+						revive = b.Value
 					}
 				}
 
-				reader := csv.NewReader(strings.NewReader(str.Value))
-				records, err := reader.ReadAll()
+				result, err := parseYAML(str.Value)
 				if err != nil {
-					return newError("parseCSV error: %s", err.Error())
+					return err
+				}
+				if revive {
+					return reviveTypedValues(result)
+				}
+				return result
+			},
+		},
+		"stringifyYAML": {
+			Fn: func(args ...Object) Object {
+				if len(args) < 1 || len(args) > 2 {
+					return newError("stringifyYAML() expects 1-2 arguments, got=%d", len(args))
 				}
 
-				if hasHeader && len(records) > 0 {
-					// Return array of dicts with headers as keys
-					headers := records[0]
-					rows := make([]Object, len(records)-1)
-					for i, record := range records[1:] {
-						dict := &Dictionary{
-							Pairs: make(map[string]ast.Expression),
-							Env:   NewEnvironment(),
-						}
-						for j, value := range record {
-							if j < len(headers) {
-								dict.Pairs[headers[j]] = &ast.StringLiteral{
-									Token: lexer.Token{Type: lexer.STRING, Literal: value},
-									Value: value,
-								}
-							}
+				indent := defaultYAMLIndent
+				if len(args) == 2 {
+					opts, ok := args[1].(*Dictionary)
+					if !ok {
+						return newError("stringifyYAML() options must be a dictionary, got %s", args[1].Type())
+					}
+					if indentExpr, ok := opts.Pairs["indent"]; ok {
+						var errObj *Error
+						indent, errObj = parseYAMLIndent(Eval(indentExpr, opts.Env))
+						if errObj != nil {
+							return errObj
 						}
-						rows[i] = dict
 					}
-					return &Array{Elements: rows}
 				}
 
-				// Return array of arrays
-				rows := make([]Object, len(records))
-				for i, record := range records {
-					row := make([]Object, len(record))
-					for j, value := range record {
-						row[j] = &String{Value: value}
+				data, err := encodeYAML(args[0], indent)
+				if err != nil {
+					return newError("stringifyYAML error: %s", err.Error())
+				}
+				return &String{Value: string(data)}
+			},
+		},
+		"parseTOML": {
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("parseTOML() expects 1 argument, got=%d", len(args))
+				}
+				str, ok := args[0].(*String)
+				if !ok {
+					return newError("parseTOML() expects string argument, got %s", args[0].Type())
+				}
+				result, err := parseTOML(str.Value)
+				if err != nil {
+					return err
+				}
+				return result
+			},
+		},
+		"stringifyTOML": {
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("stringifyTOML() expects 1 argument, got=%d", len(args))
+				}
+				data, err := encodeTOML(args[0])
+				if err != nil {
+					return newError("stringifyTOML error: %s", err.Error())
+				}
+				return &String{Value: string(data)}
+			},
+		},
+		"parseCSV": {
+			Fn: func(args ...Object) Object {
+				if len(args) < 1 || len(args) > 2 {
+					return newError("parseCSV() expects 1-2 arguments, got=%d", len(args))
+				}
+				str, ok := args[0].(*String)
+				if !ok {
+					return newError("parseCSV() expects string argument, got %s", args[0].Type())
+				}
+
+				// Parse options if provided
+				opts := defaultCSVOptions(false)
+				if len(args) == 2 {
+					optDict, ok := args[1].(*Dictionary)
+					if !ok {
+						return newError("parseCSV() options must be a dictionary, got %s", args[1].Type())
+					}
+					var optErr *Error
+					opts, optErr = parseCSVOptions(optDict, opts)
+					if optErr != nil {
+						return optErr
 					}
-					rows[i] = &Array{Elements: row}
 				}
-				return &Array{Elements: rows}
+
+				result, err := parseCSV([]byte(str.Value), opts)
+				if err != nil {
+					return err
+				}
+				return result
 			},
 		},
 		"stringifyCSV": {
 			Fn: func(args ...Object) Object {
-				if len(args) != 1 {
-					return newError("stringifyCSV() expects 1 argument, got=%d", len(args))
+				if len(args) < 1 || len(args) > 2 {
+					return newError("stringifyCSV() expects 1 or 2 arguments, got=%d", len(args))
 				}
 
 				arr, ok := args[0].(*Array)
 				if !ok {
 					return newError("stringifyCSV() expects array argument, got %s", args[0].Type())
 				}
-
-				var buf bytes.Buffer
-				writer := csv.NewWriter(&buf)
-
 				for _, elem := range arr.Elements {
-					if row, ok := elem.(*Array); ok {
-						record := make([]string, len(row.Elements))
-						for i, cell := range row.Elements {
-							record[i] = cell.Inspect()
-						}
-						if err := writer.Write(record); err != nil {
-							return newError("stringifyCSV error: %s", err.Error())
-						}
-					} else {
-						return newError("stringifyCSV expects array of arrays, got element of type %s", elem.Type())
+					switch elem.(type) {
+					case *Array, *Dictionary:
+					default:
+						return newError("stringifyCSV expects array of arrays or dictionaries, got element of type %s", elem.Type())
 					}
 				}
 
-				writer.Flush()
-				if err := writer.Error(); err != nil {
-					return newError("stringifyCSV error: %s", err.Error())
+				// Dictionary rows get a header row unless disabled
+				opts := defaultCSVOptions(true)
+				if len(args) == 2 {
+					optDict, ok := args[1].(*Dictionary)
+					if !ok {
+						return newError("stringifyCSV() options must be a dictionary, got %s", args[1].Type())
+					}
+					var optErr *Error
+					opts, optErr = parseCSVOptions(optDict, opts)
+					if optErr != nil {
+						return optErr
+					}
 				}
 
-				return &String{Value: buf.String()}
+				data, err := encodeCSV(arr, opts)
+				if err != nil {
+					return newError("stringifyCSV error: %s", err.Error())
+				}
+				return &String{Value: string(data)}
 			},
 		},
 	}
@@ -5903,8 +5541,93 @@ func isCommandHandle(dict *Dictionary) bool {
 	return typeLit.Value == "command"
 }
 
-// executeCommand executes a command handle with input and returns result dictionary
+// executeCommand executes a command handle with input and returns result dictionary.
+// The onFailure option turns a failed run (non-zero exit or an execution error)
+// into an error ("error") or null ("null") instead of the result dictionary.
 func executeCommand(cmdDict *Dictionary, input Object, env *Environment) Object {
+	onFailure, errObj := commandFailureMode(cmdDict, env)
+	if errObj != nil {
+		return errObj
+	}
+
+	result := runCommand(cmdDict, input, env)
+	resultDict, ok := result.(*Dictionary)
+	if !ok || onFailure == "result" {
+		return result
+	}
+
+	exitCode, _ := Eval(resultDict.Pairs["exitCode"], env).(*Integer)
+	errMsg, _ := Eval(resultDict.Pairs["error"], env).(*String)
+	if errMsg == nil && exitCode != nil && exitCode.Value == 0 {
+		return result
+	}
+
+	if onFailure == "null" {
+		return NULL
+	}
+	line := commandLine(cmdDict)
+	if errMsg != nil {
+		return newError("command `%s` failed: %s", line, errMsg.Value)
+	}
+	stderr, _ := Eval(resultDict.Pairs["stderr"], env).(*String)
+	if stderr != nil && strings.TrimSpace(stderr.Value) != "" {
+		return newError("command `%s` failed with exit code %d: %s", line, exitCode.Value, strings.TrimSpace(stderr.Value))
+	}
+	return newError("command `%s` failed with exit code %d", line, exitCode.Value)
+}
+
+// commandFailureMode reads the onFailure option of a command handle ("result" by default)
+func commandFailureMode(cmdDict *Dictionary, env *Environment) (string, *Error) {
+	optsLit, ok := cmdDict.Pairs["options"].(*ast.DictionaryLiteral)
+	if !ok {
+		return "result", nil
+	}
+	modeExpr, ok := optsLit.Pairs["onFailure"]
+	if !ok {
+		return "result", nil
+	}
+	mode, ok := Eval(modeExpr, env).(*String)
+	if !ok || (mode.Value != "result" && mode.Value != "error" && mode.Value != "null") {
+		return "", newError("COMMAND option `onFailure` must be \"result\", \"error\" or \"null\"")
+	}
+	return mode.Value, nil
+}
+
+// commandLine formats a command handle's binary and arguments for error messages,
+// quoting arguments that contain spaces or quotes
+func commandLine(cmdDict *Dictionary) string {
+	var parts []string
+	if binaryLit, ok := cmdDict.Pairs["binary"].(*ast.StringLiteral); ok {
+		parts = append(parts, binaryLit.Value)
+	}
+	if argsLit, ok := cmdDict.Pairs["args"].(*ast.ArrayLiteral); ok {
+		for _, argExpr := range argsLit.Elements {
+			argLit, ok := argExpr.(*ast.StringLiteral)
+			if !ok {
+				continue
+			}
+			if argLit.Value == "" || strings.ContainsAny(argLit.Value, " \t\n\"'") {
+				parts = append(parts, strconv.Quote(argLit.Value))
+			} else {
+				parts = append(parts, argLit.Value)
+			}
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// runCommand runs a command handle with input and returns its result dictionary
+func runCommand(cmdDict *Dictionary, input Object, env *Environment) Object {
+	if result, ok := mockedCommand(cmdDict); ok {
+		return result
+	}
+	key := commandLine(cmdDict)
+	if in, err := replay("command", key); err != nil {
+		return createErrorResult(err.Error(), -1)
+	} else if in != nil {
+		return commandResultDict(in.Stdout, in.Stderr, in.ExitCode)
+	}
+
 	// Extract binary
 	binaryExpr, ok := cmdDict.Pairs["binary"]
 	if !ok {
@@ -5986,7 +5709,23 @@ func executeCommand(cmdDict *Dictionary, input Object, env *Environment) Object
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
+	if env.dryRun("run %s", strings.Join(cmd.Args, " ")) {
+		return createResultDict("", "", nil)
+	}
+
+	start := time.Now()
 	err := cmd.Run()
+	recordCommand(start)
+
+	// Record the result, unless the command couldn't run at all
+	var exitErr *exec.ExitError
+	if err == nil || errors.As(err, &exitErr) {
+		in := Interaction{Kind: "command", Key: key, Stdout: stdout.String(), Stderr: stderr.String()}
+		if exitErr != nil {
+			in.ExitCode = int64(exitErr.ExitCode())
+		}
+		recordInteraction(in)
+	}
 
 	// Build result dict
 	return createResultDict(stdout.String(), stderr.String(), err)
@@ -6012,103 +5751,333 @@ func applyCommandOptions(cmd *exec.Cmd, optsLit *ast.DictionaryLiteral, env *Env
 	// dir option
 	if dirExpr, ok := optsLit.Pairs["dir"]; ok {
 		dirObj := Eval(dirExpr, env)
-		if pathDict, ok := dirObj.(*Dictionary); ok {
-			if isPathDict(pathDict) {
-				pathStr := pathDictToString(pathDict)
-				cmd.Dir = pathStr
-			}
+		if path, ok := dirObj.(*Path); ok {
+			cmd.Dir = path.Inspect()
 		}
 	}
 
 	// timeout option
 	if timeoutExpr, ok := optsLit.Pairs["timeout"]; ok {
 		timeoutObj := Eval(timeoutExpr, env)
-		if durDict, ok := timeoutObj.(*Dictionary); ok {
-			if isDurationDict(durDict) {
-				_, seconds, err := getDurationComponents(durDict, env)
-				if err == nil {
-					timeout := time.Duration(seconds) * time.Second
-					ctx, cancel := context.WithTimeout(context.Background(), timeout)
-					defer cancel()
+		if dur, ok := timeoutObj.(*Duration); ok {
+			timeout := time.Duration(dur.Seconds()) * time.Second
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			// Replace cmd with CommandContext
+			*cmd = *exec.CommandContext(ctx, cmd.Path, cmd.Args[1:]...)
+		}
+	}
+}
+
+// createResultDict creates a result dictionary from command output
+func createResultDict(stdout, stderr string, err error) *Dictionary {
+	pairs := make(map[string]ast.Expression)
+
+	// stdout
+	pairs["stdout"] = &ast.StringLiteral{
+		Token: lexer.Token{Type: lexer.STRING, Literal: stdout},
+		Value: stdout,
+	}
+
+	// stderr
+	pairs["stderr"] = &ast.StringLiteral{
+		Token: lexer.Token{Type: lexer.STRING, Literal: stderr},
+		Value: stderr,
+	}
+
+	// exitCode and error
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			// Non-zero exit
+			pairs["exitCode"] = &ast.IntegerLiteral{
+				Token: lexer.Token{Type: lexer.INT, Literal: strconv.Itoa(exitErr.ExitCode())},
+				Value: int64(exitErr.ExitCode()),
+			}
+			pairs["error"] = &ast.Identifier{Token: lexer.Token{Type: lexer.IDENT, Literal: "null"}, Value: "null"}
+		} else {
+			// Execution failed
+			pairs["exitCode"] = &ast.IntegerLiteral{
+				Token: lexer.Token{Type: lexer.INT, Literal: "-1"},
+				Value: -1,
+			}
+			pairs["error"] = &ast.StringLiteral{
+				Token: lexer.Token{Type: lexer.STRING, Literal: err.Error()},
+				Value: err.Error(),
+			}
+		}
+	} else {
+		// Success
+		pairs["exitCode"] = &ast.IntegerLiteral{
+			Token: lexer.Token{Type: lexer.INT, Literal: "0"},
+			Value: 0,
+		}
+		pairs["error"] = &ast.Identifier{Token: lexer.Token{Type: lexer.IDENT, Literal: "null"}, Value: "null"}
+	}
+
+	return &Dictionary{Pairs: pairs, Env: NewEnvironment()}
+}
+
+// createErrorResult creates a result dictionary for errors
+func createErrorResult(errMsg string, exitCode int64) *Dictionary {
+	pairs := make(map[string]ast.Expression)
+
+	pairs["stdout"] = &ast.StringLiteral{
+		Token: lexer.Token{Type: lexer.STRING, Literal: ""},
+		Value: "",
+	}
+	pairs["stderr"] = &ast.StringLiteral{
+		Token: lexer.Token{Type: lexer.STRING, Literal: ""},
+		Value: "",
+	}
+	pairs["exitCode"] = &ast.IntegerLiteral{
+		Token: lexer.Token{Type: lexer.INT, Literal: strconv.FormatInt(exitCode, 10)},
+		Value: exitCode,
+	}
+	pairs["error"] = &ast.StringLiteral{
+		Token: lexer.Token{Type: lexer.STRING, Literal: errMsg},
+		Value: errMsg,
+	}
+
+	return &Dictionary{Pairs: pairs, Env: NewEnvironment()}
+}
+
+// evalSh implements sh(template, values?, options?). The template is split into
+// words using shell quoting rules ('single', "double", backslash escapes) and
+// each {name} placeholder is replaced by a value from the values dictionary or
+// the calling scope. Substituted values are never re-split or interpreted, and
+// no shell is run, so filenames with spaces or metacharacters stay one argument.
+// The result is a command handle, as returned by COMMAND.
+func evalSh(args []Object, env *Environment) Object {
+	if len(args) < 1 || len(args) > 3 {
+		return newError("wrong number of arguments to `sh`. got=%d, want=1-3", len(args))
+	}
+
+	template, ok := args[0].(*String)
+	if !ok {
+		return newError("first argument to `sh` must be a string, got %s", args[0].Type())
+	}
+
+	var values *Dictionary
+	if len(args) >= 2 && args[1] != NULL {
+		values, ok = args[1].(*Dictionary)
+		if !ok {
+			return newError("second argument to `sh` must be a dictionary, got %s", args[1].Type())
+		}
+	}
+
+	var options *Dictionary
+	if len(args) == 3 {
+		options, ok = args[2].(*Dictionary)
+		if !ok {
+			return newError("third argument to `sh` must be a dictionary, got %s", args[2].Type())
+		}
+	}
+
+	lookup := func(name string) (Object, *Error) {
+		return shPlaceholderValue(name, values, env)
+	}
+	words, errObj := splitShTemplate(template.Value, lookup)
+	if errObj != nil {
+		return errObj
+	}
+	if len(words) == 0 {
+		return newError("`sh` template has no command")
+	}
+
+	return createCommandHandle(words[0], words[1:], options, NewEnvironment())
+}
+
+// splitShTemplate tokenizes a command template into words. Placeholders are
+// substituted inside the current word; an unquoted placeholder that makes up a
+// whole word and holds an array expands to one word per element.
+func splitShTemplate(template string, lookup func(string) (Object, *Error)) ([]string, *Error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	runes := []rune(template)
+
+	endWord := func() {
+		if inWord {
+			words = append(words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+
+	// readPlaceholder reads the name after '{' at index i and returns the index after '}'
+	readPlaceholder := func(i int) (string, int, *Error) {
+		end := i + 1
+		for end < len(runes) && runes[end] != '}' {
+			end++
+		}
+		if end == len(runes) {
+			return "", 0, newError("`sh` template has an unterminated placeholder")
+		}
+		name := strings.TrimSpace(string(runes[i+1 : end]))
+		if name == "" {
+			return "", 0, newError("`sh` template has an empty placeholder")
+		}
+		return name, end + 1, nil
+	}
+
+	for i := 0; i < len(runes); {
+		ch := runes[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n':
+			endWord()
+			i++
+
+		case ch == '\\':
+			if i+1 == len(runes) {
+				return nil, newError("`sh` template ends with a backslash")
+			}
+			word.WriteRune(runes[i+1])
+			inWord = true
+			i += 2
+
+		case ch == '\'':
+			end := i + 1
+			for end < len(runes) && runes[end] != '\'' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, newError("`sh` template has an unterminated single quote")
+			}
+			word.WriteString(string(runes[i+1 : end]))
+			inWord = true
+			i = end + 1
+
+		case ch == '"':
+			inWord = true
+			i++
+			for {
+				if i == len(runes) {
+					return nil, newError("`sh` template has an unterminated double quote")
+				}
+				c := runes[i]
+				if c == '"' {
+					i++
+					break
+				}
+				if c == '\\' && i+1 < len(runes) && strings.ContainsRune(`"\{}`, runes[i+1]) {
+					word.WriteRune(runes[i+1])
+					i += 2
+					continue
+				}
+				if c == '{' {
+					name, next, errObj := readPlaceholder(i)
+					if errObj != nil {
+						return nil, errObj
+					}
+					val, errObj := lookup(name)
+					if errObj != nil {
+						return nil, errObj
+					}
+					str, errObj := shArgString(name, val)
+					if errObj != nil {
+						return nil, errObj
+					}
+					word.WriteString(str)
+					i = next
+					continue
+				}
+				word.WriteRune(c)
+				i++
+			}
 
-					// Replace cmd with CommandContext
-					*cmd = *exec.CommandContext(ctx, cmd.Path, cmd.Args[1:]...)
+		case ch == '{':
+			name, next, errObj := readPlaceholder(i)
+			if errObj != nil {
+				return nil, errObj
+			}
+			val, errObj := lookup(name)
+			if errObj != nil {
+				return nil, errObj
+			}
+			val = rangeAsArray(val)
+			wholeWord := !inWord && (next == len(runes) || strings.ContainsRune(" \t\n", runes[next]))
+			if arr, ok := val.(*Array); ok && wholeWord {
+				for _, elem := range arr.Elements {
+					str, errObj := shArgString(name, elem)
+					if errObj != nil {
+						return nil, errObj
+					}
+					words = append(words, str)
 				}
+				i = next
+				continue
+			}
+			str, errObj := shArgString(name, val)
+			if errObj != nil {
+				return nil, errObj
 			}
+			word.WriteString(str)
+			inWord = true
+			i = next
+
+		default:
+			word.WriteRune(ch)
+			inWord = true
+			i++
 		}
 	}
+	endWord()
+
+	return words, nil
 }
 
-// createResultDict creates a result dictionary from command output
-func createResultDict(stdout, stderr string, err error) *Dictionary {
-	pairs := make(map[string]ast.Expression)
+// shPlaceholderValue resolves a placeholder such as {input} or {img.width}
+// from the values dictionary, falling back to the calling scope
+func shPlaceholderValue(name string, values *Dictionary, env *Environment) (Object, *Error) {
+	parts := strings.Split(name, ".")
 
-	// stdout
-	pairs["stdout"] = &ast.StringLiteral{
-		Token: lexer.Token{Type: lexer.STRING, Literal: stdout},
-		Value: stdout,
+	var val Object
+	if values != nil {
+		if expr, ok := values.Pairs[parts[0]]; ok {
+			val = Eval(expr, dictionaryThisEnv(values))
+		}
 	}
-
-	// stderr
-	pairs["stderr"] = &ast.StringLiteral{
-		Token: lexer.Token{Type: lexer.STRING, Literal: stderr},
-		Value: stderr,
+	if val == nil {
+		v, ok := env.Get(parts[0])
+		if !ok {
+			return nil, newError("`sh` placeholder {%s} is not defined", name)
+		}
+		val = v
 	}
 
-	// exitCode and error
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			// Non-zero exit
-			pairs["exitCode"] = &ast.IntegerLiteral{
-				Token: lexer.Token{Type: lexer.INT, Literal: strconv.Itoa(exitErr.ExitCode())},
-				Value: int64(exitErr.ExitCode()),
-			}
-			pairs["error"] = &ast.Identifier{Token: lexer.Token{Type: lexer.IDENT, Literal: "null"}, Value: "null"}
-		} else {
-			// Execution failed
-			pairs["exitCode"] = &ast.IntegerLiteral{
-				Token: lexer.Token{Type: lexer.INT, Literal: "-1"},
-				Value: -1,
-			}
-			pairs["error"] = &ast.StringLiteral{
-				Token: lexer.Token{Type: lexer.STRING, Literal: err.Error()},
-				Value: err.Error(),
-			}
+	for _, key := range parts[1:] {
+		dict, ok := val.(*Dictionary)
+		if !ok {
+			return nil, newError("`sh` placeholder {%s}: cannot read %s of %s", name, key, val.Type())
 		}
-	} else {
-		// Success
-		pairs["exitCode"] = &ast.IntegerLiteral{
-			Token: lexer.Token{Type: lexer.INT, Literal: "0"},
-			Value: 0,
+		expr, ok := dict.Pairs[key]
+		if !ok {
+			return nil, newError("`sh` placeholder {%s}: no key %s", name, key)
 		}
-		pairs["error"] = &ast.Identifier{Token: lexer.Token{Type: lexer.IDENT, Literal: "null"}, Value: "null"}
+		val = Eval(expr, dictionaryThisEnv(dict))
 	}
 
-	return &Dictionary{Pairs: pairs, Env: NewEnvironment()}
+	if isError(val) {
+		return nil, val.(*Error)
+	}
+	return val, nil
 }
 
-// createErrorResult creates a result dictionary for errors
-func createErrorResult(errMsg string, exitCode int64) *Dictionary {
-	pairs := make(map[string]ast.Expression)
-
-	pairs["stdout"] = &ast.StringLiteral{
-		Token: lexer.Token{Type: lexer.STRING, Literal: ""},
-		Value: "",
-	}
-	pairs["stderr"] = &ast.StringLiteral{
-		Token: lexer.Token{Type: lexer.STRING, Literal: ""},
-		Value: "",
-	}
-	pairs["exitCode"] = &ast.IntegerLiteral{
-		Token: lexer.Token{Type: lexer.INT, Literal: strconv.FormatInt(exitCode, 10)},
-		Value: exitCode,
+// shArgString converts a placeholder value to a single command argument
+func shArgString(name string, val Object) (string, *Error) {
+	switch v := val.(type) {
+	case *String:
+		return v.Value, nil
+	case *Integer, *Float, *Boolean:
+		return v.Inspect(), nil
+	case *Array:
+		return "", newError("`sh` placeholder {%s} is an array; arrays must be a whole unquoted word", name)
 	}
-	pairs["error"] = &ast.StringLiteral{
-		Token: lexer.Token{Type: lexer.STRING, Literal: errMsg},
-		Value: errMsg,
+	if str, ok := typedScalar(val); ok {
+		return str, nil
 	}
-
-	return &Dictionary{Pairs: pairs, Env: NewEnvironment()}
+	return "", newError("`sh` placeholder {%s} must be a string, number, path or array of them, got %s", name, val.Type())
 }
 
 // Helper function to evaluate a statement
@@ -6134,34 +6103,32 @@ func evalDBConnectionMethod(conn *DBConnection, method string, args []Object, en
 		if len(args) != 0 {
 			return newError("begin() takes no arguments, got=%d", len(args))
 		}
-		if conn.InTransaction {
-			return newError("connection is already in a transaction")
+		if errObj := beginTransaction(conn, env); errObj != nil {
+			return errObj
 		}
-		conn.InTransaction = true
 		return &Boolean{Value: true}
 
 	case "commit":
 		if len(args) != 0 {
 			return newError("commit() takes no arguments, got=%d", len(args))
 		}
-		if !conn.InTransaction {
-			return newError("no transaction in progress")
+		if errObj := endTransaction(conn, true); errObj != nil {
+			return errObj
 		}
-		// For now, just mark transaction as complete
-		// Real transaction support will be added with actual query execution
-		conn.InTransaction = false
 		return &Boolean{Value: true}
 
 	case "rollback":
 		if len(args) != 0 {
 			return newError("rollback() takes no arguments, got=%d", len(args))
 		}
-		if !conn.InTransaction {
-			return newError("no transaction in progress")
+		if errObj := endTransaction(conn, false); errObj != nil {
+			return errObj
 		}
-		conn.InTransaction = false
 		return &Boolean{Value: true}
 
+	case "transaction":
+		return evalTransaction(conn, args, env)
+
 	case "close":
 		if len(args) != 0 {
 			return newError("close() takes no arguments, got=%d", len(args))
@@ -6175,6 +6142,7 @@ func evalDBConnectionMethod(conn *DBConnection, method string, args []Object, en
 		dbConnectionsMu.Lock()
 		delete(dbConnections, cacheKey)
 		dbConnectionsMu.Unlock()
+		closeCachedStatements(conn.DB)
 
 		if err := conn.DB.Close(); err != nil {
 			conn.LastError = err.Error()
@@ -6192,6 +6160,18 @@ func evalDBConnectionMethod(conn *DBConnection, method string, args []Object, en
 		}
 		return &Boolean{Value: true}
 
+	case "createIndex":
+		return dbCreateIndex(conn, args, env)
+
+	case "search":
+		return dbSearch(conn, args, env)
+
+	case "prepare":
+		return dbPrepare(conn, args)
+
+	case "table":
+		return dbTable(conn, args)
+
 	default:
 		return newError("unknown method for database connection: %s", method)
 	}
@@ -6244,6 +6224,10 @@ func evalSFTPFileHandleMethod(handle *SFTPFileHandle, method string, args []Obje
 			}
 		}
 
+		if env.dryRun("create directory %s", sftpLocation(handle)) {
+			return NULL
+		}
+
 		var err error
 		if recursive {
 			err = handle.Connection.Client.MkdirAll(handle.Path)
@@ -6271,6 +6255,10 @@ func evalSFTPFileHandleMethod(handle *SFTPFileHandle, method string, args []Obje
 			}
 		}
 
+		if env.dryRun("remove directory %s", sftpLocation(handle)) {
+			return NULL
+		}
+
 		var err error
 		if recursive {
 			// Recursively remove directory and contents
@@ -6291,6 +6279,10 @@ func evalSFTPFileHandleMethod(handle *SFTPFileHandle, method string, args []Obje
 			return newError("remove() takes no arguments, got=%d", len(args))
 		}
 
+		if env.dryRun("delete %s", sftpLocation(handle)) {
+			return NULL
+		}
+
 		if err := handle.Connection.Client.Remove(handle.Path); err != nil {
 			return newError("failed to remove file: %s", err.Error())
 		}
@@ -6307,6 +6299,9 @@ func Eval(node ast.Node, env *Environment) Object {
 
 	// Statements
 	case *ast.Program:
+		if hasStrictPragma(node) {
+			env.strictFile = true
+		}
 		return evalProgram(node.Statements, env)
 
 	case *ast.ExpressionStatement:
@@ -6339,10 +6334,16 @@ func Eval(node ast.Node, env *Environment) Object {
 			} else {
 				env.SetLet(node.Name.Value, val)
 			}
+			env.declare(node.Name)
 		}
 		return val
 
 	case *ast.AssignmentStatement:
+		if !node.Export {
+			if err := checkDeclared(env, node.Name, node.Names, node.DictPattern); err != nil {
+				return err
+			}
+		}
 		val := Eval(node.Value, env)
 		if isError(val) {
 			return val
@@ -6370,21 +6371,46 @@ func Eval(node ast.Node, env *Environment) Object {
 		return val
 
 	case *ast.ReadStatement:
+		if !node.IsLet {
+			if err := checkDeclared(env, node.Name, node.Names, node.DictPattern); err != nil {
+				return err
+			}
+		}
 		return evalReadStatement(node, env)
 
 	case *ast.FetchStatement:
+		if !node.IsLet {
+			if err := checkDeclared(env, node.Name, node.Names, node.DictPattern); err != nil {
+				return err
+			}
+		}
 		return evalFetchStatement(node, env)
 
 	case *ast.WriteStatement:
 		return evalWriteStatement(node, env)
 
 	case *ast.QueryOneStatement:
+		if !node.IsLet && !node.Export {
+			if err := checkDeclared(env, nil, node.Names, nil); err != nil {
+				return err
+			}
+		}
 		return evalQueryOneStatement(node, env)
 
 	case *ast.QueryManyStatement:
+		if !node.IsLet && !node.Export {
+			if err := checkDeclared(env, nil, node.Names, nil); err != nil {
+				return err
+			}
+		}
 		return evalQueryManyStatement(node, env)
 
 	case *ast.ExecuteStatement:
+		if !node.IsLet && !node.Export {
+			if err := checkDeclared(env, nil, node.Names, nil); err != nil {
+				return err
+			}
+		}
 		return evalExecuteStatement(node, env)
 
 	case *ast.ReturnStatement:
@@ -6394,6 +6420,12 @@ func Eval(node ast.Node, env *Environment) Object {
 		}
 		return &ReturnValue{Value: val}
 
+	case *ast.PropsStatement:
+		return evalPropsStatement(node, env)
+
+	case *ast.ImportStatement:
+		return evalImportStatement(node, env)
+
 	// Expressions
 	case *ast.IntegerLiteral:
 		return &Integer{Value: node.Value}
@@ -6481,7 +6513,14 @@ func Eval(node ast.Node, env *Environment) Object {
 		// Special handling for nullish coalescing operator (??)
 		// It's short-circuit: only evaluate right if left is NULL
 		if node.Operator == "??" {
-			left := Eval(node.Left, env)
+			// Missing keys are allowed on the left in strict mode, as ?? is
+			// how optional keys are read
+			leftEnv := env
+			if env.isStrict() {
+				leftEnv = NewEnclosedEnvironment(env)
+				leftEnv.Strict, leftEnv.strictFile = false, false
+			}
+			left := Eval(node.Left, leftEnv)
 			if isError(left) {
 				return left
 			}
@@ -6501,8 +6540,55 @@ func Eval(node ast.Node, env *Environment) Object {
 		if isError(right) {
 			return right
 		}
+		if node.Operator == "+" {
+			if err := checkStrictConcat(env, node.Token, left, right); err != nil {
+				return err
+			}
+		}
 		return evalInfixExpression(node.Token, node.Operator, left, right)
 
+	case *ast.CondExpression:
+		for _, branch := range node.Branches {
+			condition := Eval(branch.Condition, env)
+			if isError(condition) {
+				return condition
+			}
+			if isTruthy(condition) {
+				return Eval(branch.Value, env)
+			}
+		}
+		if node.Else != nil {
+			return Eval(node.Else, env)
+		}
+		return NULL
+
+	case *ast.RangeExpression:
+		r, errObj := evalRange(node, env)
+		if errObj != nil {
+			return errObj
+		}
+		return r
+
+	case *ast.ComparisonChain:
+		// a < b < c is a < b and b < c, evaluating b once and stopping at
+		// the first false comparison
+		left := Eval(node.Operands[0], env)
+		if isError(left) {
+			return left
+		}
+		for i, op := range node.Operators {
+			right := Eval(node.Operands[i+1], env)
+			if isError(right) {
+				return right
+			}
+			result := evalInfixExpression(node.Token, op, left, right)
+			if isError(result) || !isTruthy(result) {
+				return result
+			}
+			left = right
+		}
+		return TRUE
+
 	case *ast.ExecuteExpression:
 		// Evaluate command handle
 		cmdObj := Eval(node.Command, env)
@@ -6563,7 +6649,11 @@ func Eval(node ast.Node, env *Environment) Object {
 			if len(args) == 1 && isError(args[0]) {
 				return args[0]
 			}
-			return evalImport(args, env)
+			result := evalImport(args, env)
+			if errObj, ok := result.(*Error); ok && errObj.File != "" {
+				return importedFrom(errObj, ident.Token, env)
+			}
+			return result
 		}
 
 		// Check if this is a call to log (needs env for Logger)
@@ -6584,6 +6674,215 @@ func Eval(node ast.Node, env *Environment) Object {
 			return evalLogLine(args, env)
 		}
 
+		// Check if this is a call to task (needs env for the task registry)
+		if ident, ok := node.Function.(*ast.Identifier); ok && ident.Value == "task" {
+			if _, shadowed := env.Get(ident.Value); !shadowed {
+				args := evalExpressions(node.Arguments, env)
+				if len(args) == 1 && isError(args[0]) {
+					return args[0]
+				}
+				return evalTask(args, env)
+			}
+		}
+
+		// Check if this is a call to eval (needs env for the security policy)
+		if ident, ok := node.Function.(*ast.Identifier); ok && ident.Value == "eval" {
+			if _, shadowed := env.Get(ident.Value); !shadowed {
+				args := evalExpressions(node.Arguments, env)
+				if len(args) == 1 && isError(args[0]) {
+					return args[0]
+				}
+				return evalEval(args, env)
+			}
+		}
+
+		// Check if this is a call to sh (needs env to resolve template placeholders)
+		if ident, ok := node.Function.(*ast.Identifier); ok && ident.Value == "sh" {
+			if _, shadowed := env.Get(ident.Value); !shadowed {
+				args := evalExpressions(node.Arguments, env)
+				if len(args) == 1 && isError(args[0]) {
+					return args[0]
+				}
+				return evalSh(args, env)
+			}
+		}
+
+		// Check if this is a call to lock/withLock (needs env for path resolution and security)
+		if ident, ok := node.Function.(*ast.Identifier); ok && (ident.Value == "lock" || ident.Value == "withLock") {
+			if _, shadowed := env.Get(ident.Value); !shadowed {
+				args := evalExpressions(node.Arguments, env)
+				if len(args) == 1 && isError(args[0]) {
+					return args[0]
+				}
+				return evalWithLock(ident.Value, args, env)
+			}
+		}
+
+		// Check if this is a call to writePDF (needs env for path resolution and security)
+		if ident, ok := node.Function.(*ast.Identifier); ok && ident.Value == "writePDF" {
+			if _, shadowed := env.Get(ident.Value); !shadowed {
+				args := evalExpressions(node.Arguments, env)
+				if len(args) == 1 && isError(args[0]) {
+					return args[0]
+				}
+				return evalWritePDF(args, env)
+			}
+		}
+
+		// Check if this is a call to snapshot (needs env for path resolution and security)
+		if ident, ok := node.Function.(*ast.Identifier); ok && ident.Value == "snapshot" {
+			if _, shadowed := env.Get(ident.Value); !shadowed {
+				args := evalExpressions(node.Arguments, env)
+				if len(args) == 1 && isError(args[0]) {
+					return args[0]
+				}
+				return evalSnapshot(args, env)
+			}
+		}
+
+		// Check if this is a call to provide/inject/provided (needs env for the call chain)
+		if ident, ok := node.Function.(*ast.Identifier); ok && (ident.Value == "provide" || ident.Value == "inject" || ident.Value == "provided") {
+			if _, shadowed := env.Get(ident.Value); !shadowed {
+				args := evalExpressions(node.Arguments, env)
+				if len(args) == 1 && isError(args[0]) {
+					return args[0]
+				}
+				return evalProvide(ident.Value, args, env)
+			}
+		}
+
+		// Check if this is a call to SFTP (needs env to check reads of key files)
+		if ident, ok := node.Function.(*ast.Identifier); ok && ident.Value == "SFTP" {
+			if _, shadowed := env.Get(ident.Value); !shadowed {
+				args := evalExpressions(node.Arguments, env)
+				if len(args) == 1 && isError(args[0]) {
+					return args[0]
+				}
+				return evalSFTP(args, env)
+			}
+		}
+
+		// Check if this is a call to parallel (needs env for the calls it makes)
+		if ident, ok := node.Function.(*ast.Identifier); ok && ident.Value == "parallel" {
+			if _, shadowed := env.Get(ident.Value); !shadowed {
+				args := evalExpressions(node.Arguments, env)
+				if len(args) == 1 && isError(args[0]) {
+					return args[0]
+				}
+				return evalParallel(args, env)
+			}
+		}
+
+		// Check if this is a call to walk (needs env for security and the callback)
+		if ident, ok := node.Function.(*ast.Identifier); ok && ident.Value == "walk" {
+			if _, shadowed := env.Get(ident.Value); !shadowed {
+				args := evalExpressions(node.Arguments, env)
+				if len(args) == 1 && isError(args[0]) {
+					return args[0]
+				}
+				return evalWalk(args, env)
+			}
+		}
+
+		// Check if this is a call to serve (needs env to call the handler)
+		if ident, ok := node.Function.(*ast.Identifier); ok && ident.Value == "serve" {
+			if _, shadowed := env.Get(ident.Value); !shadowed {
+				args := evalExpressions(node.Arguments, env)
+				if len(args) == 1 && isError(args[0]) {
+					return args[0]
+				}
+				return evalServe(args, env)
+			}
+		}
+
+		// Check if this is a call to select (needs env to know if it's inside parallel)
+		if ident, ok := node.Function.(*ast.Identifier); ok && ident.Value == "select" {
+			if _, shadowed := env.Get(ident.Value); !shadowed {
+				args := evalExpressions(node.Arguments, env)
+				if len(args) == 1 && isError(args[0]) {
+					return args[0]
+				}
+				return evalSelect(args, env)
+			}
+		}
+
+		// Check if this is a call to stream (needs env for path resolution)
+		if ident, ok := node.Function.(*ast.Identifier); ok && ident.Value == "stream" {
+			if _, shadowed := env.Get(ident.Value); !shadowed {
+				args := evalExpressions(node.Arguments, env)
+				if len(args) == 1 && isError(args[0]) {
+					return args[0]
+				}
+				return evalStream(args, env)
+			}
+		}
+
+		// Check if this is a call to attempt (needs env to call the function)
+		if ident, ok := node.Function.(*ast.Identifier); ok && ident.Value == "attempt" {
+			if _, shadowed := env.Get(ident.Value); !shadowed {
+				args := evalExpressions(node.Arguments, env)
+				if len(args) == 1 && isError(args[0]) {
+					return args[0]
+				}
+				return evalAttempt(args, env)
+			}
+		}
+
+		// Check if this is a call to retry (needs env to call the function)
+		if ident, ok := node.Function.(*ast.Identifier); ok && ident.Value == "retry" {
+			if _, shadowed := env.Get(ident.Value); !shadowed {
+				args := evalExpressions(node.Arguments, env)
+				if len(args) == 1 && isError(args[0]) {
+					return args[0]
+				}
+				return evalRetry(args, env)
+			}
+		}
+
+		// Check if this is a call to timeIt (needs env to call the function)
+		if ident, ok := node.Function.(*ast.Identifier); ok && ident.Value == "timeIt" {
+			if _, shadowed := env.Get(ident.Value); !shadowed {
+				args := evalExpressions(node.Arguments, env)
+				if len(args) == 1 && isError(args[0]) {
+					return args[0]
+				}
+				return evalTimeIt(args, env)
+			}
+		}
+
+		// Check if this is a call to tokens (needs env to read the token file)
+		if ident, ok := node.Function.(*ast.Identifier); ok && ident.Value == "tokens" {
+			if _, shadowed := env.Get(ident.Value); !shadowed {
+				args := evalExpressions(node.Arguments, env)
+				if len(args) == 1 && isError(args[0]) {
+					return args[0]
+				}
+				return evalTokens(args, env)
+			}
+		}
+
+		// Check if this is a call to checkLinks (needs env for path access)
+		if ident, ok := node.Function.(*ast.Identifier); ok && ident.Value == "checkLinks" {
+			if _, shadowed := env.Get(ident.Value); !shadowed {
+				args := evalExpressions(node.Arguments, env)
+				if len(args) == 1 && isError(args[0]) {
+					return args[0]
+				}
+				return evalCheckLinks(args, env)
+			}
+		}
+
+		// Check if this is a call to mock (needs env for path resolution)
+		if ident, ok := node.Function.(*ast.Identifier); ok && ident.Value == "mock" {
+			if _, shadowed := env.Get(ident.Value); !shadowed {
+				args := evalExpressions(node.Arguments, env)
+				if len(args) == 1 && isError(args[0]) {
+					return args[0]
+				}
+				return evalMock(args, env)
+			}
+		}
+
 		// Check if this is a method call (DotExpression as function)
 		if dotExpr, ok := node.Function.(*ast.DotExpression); ok {
 			left := Eval(dotExpr.Left, env)
@@ -6608,30 +6907,51 @@ func Eval(node ast.Node, env *Environment) Object {
 			switch receiver := left.(type) {
 			case *DBConnection:
 				return evalDBConnectionMethod(receiver, method, args, env)
+			case *DBStatement:
+				return evalDBStatementMethod(receiver, method, args, env)
+			case *DBQuery:
+				return evalDBQueryMethod(receiver, method, args, env)
 			case *SFTPConnection:
 				return evalSFTPConnectionMethod(receiver, method, args, env)
 			case *SFTPFileHandle:
 				return evalSFTPFileHandleMethod(receiver, method, args, env)
 			case *String:
+				if receiver.Untrusted && method != "raw" {
+					return markUntrusted(evalStringMethod(receiver, method, args))
+				}
 				return evalStringMethod(receiver, method, args)
 			case *Array:
 				return evalArrayMethod(receiver, method, args, env)
+			case *Iterator:
+				return evalIteratorMethod(receiver, method, args)
+			case *Range:
+				return evalRangeMethod(receiver, method, args, env)
+			case *Counter:
+				return evalCounterMethod(receiver, method, args)
+			case *Collector:
+				return evalCollectorMethod(receiver, method, args)
+			case *AtomicDict:
+				return evalAtomicDictMethod(receiver, method, args, env)
+			case *Channel:
+				return evalChannelMethod(receiver, method, args, env)
+			case *Stopwatch:
+				return evalStopwatchMethod(receiver, method, args, env)
 			case *Integer:
 				return evalIntegerMethod(receiver, method, args)
 			case *Float:
 				return evalFloatMethod(receiver, method, args)
+			case fieldValue:
+				return evalFieldValueMethod(receiver, method, args, env)
 			case *Dictionary:
 				// Check for special dictionary types first
-				if isDatetimeDict(receiver) {
-					result := evalDatetimeMethod(receiver, method, args, env)
+				if isTagDict(receiver) {
+					result := evalTagMethod(receiver, method, args)
 					if result != nil && !isError(result) {
 						return result
 					}
-					// Fall through to check dictionary methods if datetime method failed
+					// If unknown method, fall through to dictionary methods
 					if result != nil && isError(result) {
-						// Check if it's "unknown method" error - try dictionary method
 						if errObj, ok := result.(*Error); ok && strings.Contains(errObj.Message, "unknown method") {
-							// Try dictionary methods
 							dictResult := evalDictionaryMethod(receiver, method, args, env)
 							if dictResult != nil {
 								return dictResult
@@ -6640,14 +6960,8 @@ func Eval(node ast.Node, env *Environment) Object {
 						return result
 					}
 				}
-				if isDurationDict(receiver) {
-					result := evalDurationMethod(receiver, method, args, env)
-					if result != nil {
-						return result
-					}
-				}
-				if isPathDict(receiver) {
-					result := evalPathMethod(receiver, method, args, env)
+				if isMatchDict(receiver) {
+					result := evalMatchMethod(receiver, method, args)
 					if result != nil && !isError(result) {
 						return result
 					}
@@ -6662,8 +6976,8 @@ func Eval(node ast.Node, env *Environment) Object {
 						return result
 					}
 				}
-				if isUrlDict(receiver) {
-					result := evalUrlMethod(receiver, method, args, env)
+				if isRegexDict(receiver) {
+					result := evalRegexMethod(receiver, method, args, env)
 					if result != nil && !isError(result) {
 						return result
 					}
@@ -6678,8 +6992,8 @@ func Eval(node ast.Node, env *Environment) Object {
 						return result
 					}
 				}
-				if isRegexDict(receiver) {
-					result := evalRegexMethod(receiver, method, args, env)
+				if isColorDict(receiver) {
+					result := evalColorMethod(receiver, method, args)
 					if result != nil && !isError(result) {
 						return result
 					}
@@ -6768,7 +7082,7 @@ func Eval(node ast.Node, env *Environment) Object {
 					fnObj := Eval(fnExpr, receiver.Env)
 					if fn, ok := fnObj.(*Function); ok {
 						// Call the function with 'this' bound to the dictionary
-						return applyMethodWithThis(fn, args, receiver)
+						return applyMethodWithThis(fn, args, receiver, env)
 					}
 					// If it's not a function, return error
 					if !isError(fnObj) {
@@ -6787,7 +7101,13 @@ func Eval(node ast.Node, env *Environment) Object {
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
-		return applyFunctionWithEnv(function, args, env)
+		result := applyFunctionWithEnv(function, args, env)
+		if ident, ok := node.Function.(*ast.Identifier); ok {
+			if errObj, ok := result.(*Error); ok && errObj.Line == 0 && strings.HasPrefix(errObj.Message, "not a function:") {
+				return notCallableError(errObj, ident, env)
+			}
+		}
+		return result
 
 	case *ast.ForExpression:
 		return evalForExpression(node, env)
@@ -6801,6 +7121,15 @@ func Eval(node ast.Node, env *Environment) Object {
 		if isError(index) {
 			return index
 		}
+		if env.isStrict() {
+			if dict, ok := left.(*Dictionary); ok {
+				if key, ok := index.(*String); ok {
+					if _, exists := dict.Pairs[key.Value]; !exists {
+						return missingKeyError(node.Token, key.Value)
+					}
+				}
+			}
+		}
 		return evalIndexExpression(node.Token, left, index)
 
 	case *ast.SliceExpression:
@@ -6839,6 +7168,17 @@ func evalProgram(stmts []ast.Statement, env *Environment) Object {
 		case *ReturnValue:
 			return result.Value
 		case *Error:
+			// A script that stops with an error rolls back what it began
+			if env.outer == nil {
+				rollbackOpenTransactions(env)
+			}
+			// Errors in the program's own file aren't in a module (see
+			// applyFunction)
+			if result.File != "" && result.File == env.Filename && len(result.Imports) == 0 {
+				located := *result
+				located.File = ""
+				return &located
+			}
 			return result
 		}
 	}
@@ -6925,21 +7265,28 @@ func evalMinusPrefixOperatorExpression(right Object) Object {
 }
 
 func evalInfixExpression(tok lexer.Token, operator string, left, right Object) Object {
+	// x in a..b is checked arithmetically; otherwise ranges are operands as
+	// the arrays they stand for
+	if r, ok := right.(*Range); ok && operator == "in" {
+		if n, ok := left.(*Integer); ok {
+			return nativeBoolToParsBoolean(r.contains(n.Value))
+		}
+	}
+	left, right = rangeAsArray(left), rangeAsArray(right)
+
 	switch {
 	case operator == "&" || operator == "&&" || operator == "and":
 		// Array intersection
 		if left.Type() == ARRAY_OBJ && right.Type() == ARRAY_OBJ {
 			return evalArrayIntersection(left.(*Array), right.(*Array))
 		}
-		// Datetime intersection (must come before general dictionary intersection)
+		// Datetime intersection
+		if left.Type() == DATETIME_OBJ && right.Type() == DATETIME_OBJ {
+			return evalDatetimeIntersection(tok, left.(*Datetime), right.(*Datetime))
+		}
+		// Dictionary intersection
 		if left.Type() == DICTIONARY_OBJ && right.Type() == DICTIONARY_OBJ {
-			leftDict := left.(*Dictionary)
-			rightDict := right.(*Dictionary)
-			if isDatetimeDict(leftDict) && isDatetimeDict(rightDict) {
-				return evalDatetimeIntersection(tok, leftDict, rightDict, NewEnvironment())
-			}
-			// Regular dictionary intersection
-			return evalDictionaryIntersection(leftDict, rightDict)
+			return evalDictionaryIntersection(left.(*Dictionary), right.(*Dictionary))
 		}
 		// Boolean and
 		return nativeBoolToParsBoolean(isTruthy(left) && isTruthy(right))
@@ -6954,15 +7301,14 @@ func evalInfixExpression(tok lexer.Token, operator string, left, right Object) O
 		return evalConcatExpression(left, right)
 	case operator == "..":
 		return evalRangeExpression(tok, left, right)
+	case operator == "in":
+		return evalInExpression(tok, left, right)
 	// Path and URL operators with strings (must come before general string concatenation)
+	case left.Type() == PATH_OBJ && right.Type() == STRING_OBJ:
+		return evalPathStringInfixExpression(tok, operator, left.(*Path), right.(*String))
+	case left.Type() == URL_OBJ && right.Type() == STRING_OBJ:
+		return evalUrlStringInfixExpression(tok, operator, left.(*Url), right.(*String))
 	case left.Type() == DICTIONARY_OBJ && right.Type() == STRING_OBJ:
-		if dict := left.(*Dictionary); isPathDict(dict) {
-			return evalPathStringInfixExpression(tok, operator, dict, right.(*String))
-		}
-		if dict := left.(*Dictionary); isUrlDict(dict) {
-			return evalUrlStringInfixExpression(tok, operator, dict, right.(*String))
-		}
-		// Fall through to string concatenation if not path/url
 		if operator == "+" {
 			return evalStringConcatExpression(left, right)
 		}
@@ -6987,56 +7333,42 @@ func evalInfixExpression(tok lexer.Token, operator string, left, right Object) O
 			// !~ returns boolean: true if no match, false if match
 			return nativeBoolToParsBoolean(result == NULL)
 		}
-		return result // ~ returns array or null
-	// Datetime dictionary operations
+		return result // ~ returns a match object or null
+	// Datetime, duration, path and URL operations
+	case left.Type() == DATETIME_OBJ && right.Type() == DATETIME_OBJ:
+		return evalDatetimeInfixExpression(tok, operator, left.(*Datetime), right.(*Datetime))
+	case left.Type() == DURATION_OBJ && right.Type() == DURATION_OBJ:
+		return evalDurationInfixExpression(tok, operator, left.(*Duration), right.(*Duration))
+	case left.Type() == DATETIME_OBJ && right.Type() == DURATION_OBJ:
+		return evalDatetimeDurationInfixExpression(tok, operator, left.(*Datetime), right.(*Duration))
+	case left.Type() == DURATION_OBJ && right.Type() == DATETIME_OBJ:
+		// duration + datetime not allowed, only datetime + duration
+		return newErrorWithPos(tok, "cannot add datetime to duration (use datetime + duration instead)")
+	case left.Type() == PATH_OBJ && right.Type() == PATH_OBJ:
+		return evalPathInfixExpression(tok, operator, left.(*Path), right.(*Path))
+	case left.Type() == URL_OBJ && right.Type() == URL_OBJ:
+		return evalUrlInfixExpression(tok, operator, left.(*Url), right.(*Url))
+	case left.Type() == DATETIME_OBJ && right.Type() == INTEGER_OBJ:
+		return evalDatetimeIntegerInfixExpression(tok, operator, left.(*Datetime), right.(*Integer))
+	case left.Type() == DURATION_OBJ && right.Type() == INTEGER_OBJ:
+		return evalDurationIntegerInfixExpression(tok, operator, left.(*Duration), right.(*Integer))
+	case left.Type() == INTEGER_OBJ && right.Type() == DATETIME_OBJ:
+		return evalIntegerDatetimeInfixExpression(tok, operator, left.(*Integer), right.(*Datetime))
+	// Dictionary operations
 	case left.Type() == DICTIONARY_OBJ && right.Type() == DICTIONARY_OBJ:
 		leftDict := left.(*Dictionary)
 		rightDict := right.(*Dictionary)
-		if isDatetimeDict(leftDict) && isDatetimeDict(rightDict) {
-			return evalDatetimeInfixExpression(tok, operator, leftDict, rightDict)
-		}
-		if isDurationDict(leftDict) && isDurationDict(rightDict) {
-			return evalDurationInfixExpression(tok, operator, leftDict, rightDict)
-		}
-		if isDatetimeDict(leftDict) && isDurationDict(rightDict) {
-			return evalDatetimeDurationInfixExpression(tok, operator, leftDict, rightDict)
-		}
-		if isDurationDict(leftDict) && isDatetimeDict(rightDict) {
-			// duration + datetime not allowed, only datetime + duration
-			return newErrorWithPos(tok, "cannot add datetime to duration (use datetime + duration instead)")
-		}
-		// Path dictionary operations
-		if isPathDict(leftDict) && isPathDict(rightDict) {
-			return evalPathInfixExpression(tok, operator, leftDict, rightDict)
-		}
-		// URL dictionary operations
-		if isUrlDict(leftDict) && isUrlDict(rightDict) {
-			return evalUrlInfixExpression(tok, operator, leftDict, rightDict)
-		}
-		// Dictionary subtraction for regular dicts
+		// Dictionary subtraction
 		if operator == "-" {
 			return evalDictionarySubtraction(leftDict, rightDict)
 		}
-		// Fall through to default comparison for non-datetime dicts
+		// Fall through to default comparison
 		if operator == "==" {
 			return nativeBoolToParsBoolean(left == right)
 		} else if operator == "!=" {
 			return nativeBoolToParsBoolean(left != right)
 		}
 		return newErrorWithPos(tok, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
-	case left.Type() == DICTIONARY_OBJ && right.Type() == INTEGER_OBJ:
-		if dict := left.(*Dictionary); isDatetimeDict(dict) {
-			return evalDatetimeIntegerInfixExpression(tok, operator, dict, right.(*Integer))
-		}
-		if dict := left.(*Dictionary); isDurationDict(dict) {
-			return evalDurationIntegerInfixExpression(tok, operator, dict, right.(*Integer))
-		}
-		return newErrorWithPos(tok, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
-	case left.Type() == INTEGER_OBJ && right.Type() == DICTIONARY_OBJ:
-		if dict := right.(*Dictionary); isDatetimeDict(dict) {
-			return evalIntegerDatetimeInfixExpression(tok, operator, left.(*Integer), dict)
-		}
-		return newErrorWithPos(tok, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	// Array subtraction
 	case operator == "-" && left.Type() == ARRAY_OBJ && right.Type() == ARRAY_OBJ:
 		return evalArraySubtraction(left.(*Array), right.(*Array))
@@ -7085,7 +7417,12 @@ func evalIntegerInfixExpression(tok lexer.Token, operator string, left, right Ob
 		if rightVal == 0 {
 			return newErrorWithPos(tok, "division by zero")
 		}
-		return &Integer{Value: leftVal / rightVal}
+		// Exact division stays an integer; otherwise the result is a float
+		// (use idiv() for truncating integer division)
+		if leftVal%rightVal == 0 {
+			return &Integer{Value: leftVal / rightVal}
+		}
+		return &Float{Value: float64(leftVal) / float64(rightVal)}
 	case "%":
 		if rightVal == 0 {
 			return newErrorWithPos(tok, "modulo by zero")
@@ -7198,7 +7535,7 @@ func evalStringInfixExpression(operator string, left, right Object) Object {
 
 	switch operator {
 	case "+":
-		return &String{Value: leftVal + rightVal}
+		return &String{Value: leftVal + rightVal, Untrusted: isUntrusted(left) || isUntrusted(right)}
 	case "==":
 		return nativeBoolToParsBoolean(leftVal == rightVal)
 	case "!=":
@@ -7208,23 +7545,15 @@ func evalStringInfixExpression(operator string, left, right Object) Object {
 	}
 }
 
-// evalDatetimeInfixExpression handles operations between two datetime dictionaries
-func evalDatetimeInfixExpression(tok lexer.Token, operator string, left, right *Dictionary) Object {
-	env := NewEnvironment()
-
+// evalDatetimeInfixExpression handles operations between two datetimes
+func evalDatetimeInfixExpression(tok lexer.Token, operator string, left, right *Datetime) Object {
 	// Handle && operator for combining date and time components
 	if operator == "&" || operator == "&&" || operator == "and" {
-		return evalDatetimeIntersection(tok, left, right, env)
+		return evalDatetimeIntersection(tok, left, right)
 	}
 
-	leftUnix, err := getDatetimeUnix(left, env)
-	if err != nil {
-		return newErrorWithPos(tok, "invalid datetime: %s", err)
-	}
-	rightUnix, err := getDatetimeUnix(right, env)
-	if err != nil {
-		return newErrorWithPos(tok, "invalid datetime: %s", err)
-	}
+	leftUnix := left.Time.Unix()
+	rightUnix := right.Time.Unix()
 
 	switch operator {
 	case "<":
@@ -7244,7 +7573,7 @@ func evalDatetimeInfixExpression(tok lexer.Token, operator string, left, right *
 		// Calculate difference in seconds
 		diffSeconds := leftUnix - rightUnix
 		// Return as duration (0 months, diffSeconds seconds)
-		return durationToDict(0, diffSeconds, env)
+		return newDuration(0, diffSeconds*1000)
 	default:
 		return newErrorWithPos(tok, "unknown operator for datetime: %s", operator)
 	}
@@ -7259,19 +7588,9 @@ func evalDatetimeInfixExpression(tok lexer.Token, operator string, left, right *
 // - Date && Date -> Error (ambiguous)
 // - Time && Time -> Error (ambiguous)
 // - DateTime && DateTime -> Error (ambiguous)
-func evalDatetimeIntersection(tok lexer.Token, left, right *Dictionary, env *Environment) Object {
-	leftKind := getDatetimeKind(left, env)
-	rightKind := getDatetimeKind(right, env)
-
-	// Get components from both sides
-	leftTime, err := dictToTime(left, env)
-	if err != nil {
-		return newErrorWithPos(tok, "invalid datetime: %s", err)
-	}
-	rightTime, err := dictToTime(right, env)
-	if err != nil {
-		return newErrorWithPos(tok, "invalid datetime: %s", err)
-	}
+func evalDatetimeIntersection(tok lexer.Token, left, right *Datetime) Object {
+	leftKind, rightKind := left.Kind, right.Kind
+	leftTime, rightTime := left.Time, right.Time
 
 	var resultTime time.Time
 
@@ -7328,92 +7647,71 @@ func evalDatetimeIntersection(tok lexer.Token, left, right *Dictionary, env *Env
 		return newErrorWithPos(tok, "unknown datetime kinds: %s && %s", leftKind, rightKind)
 	}
 
-	return timeToDictWithKind(resultTime, "datetime", env)
+	return newDatetime(resultTime, "datetime")
 }
 
 // evalDatetimeIntegerInfixExpression handles datetime + integer or datetime - integer
-func evalDatetimeIntegerInfixExpression(tok lexer.Token, operator string, dt *Dictionary, seconds *Integer) Object {
-	env := NewEnvironment()
-	unixTime, err := getDatetimeUnix(dt, env)
-	if err != nil {
-		return newErrorWithPos(tok, "invalid datetime: %s", err)
-	}
-
-	// Get the kind from the original datetime
-	kind := getDatetimeKind(dt, env)
+func evalDatetimeIntegerInfixExpression(tok lexer.Token, operator string, dt *Datetime, seconds *Integer) Object {
+	unixTime := dt.Time.Unix()
+	kind := dt.Kind
 
 	switch operator {
 	case "+":
 		// Add seconds to datetime
 		newTime := time.Unix(unixTime+seconds.Value, 0).UTC()
-		return timeToDictWithKind(newTime, kind, env)
+		return newDatetime(newTime, kind)
 	case "-":
 		// Subtract seconds from datetime
 		newTime := time.Unix(unixTime-seconds.Value, 0).UTC()
-		return timeToDictWithKind(newTime, kind, env)
+		return newDatetime(newTime, kind)
 	default:
 		return newErrorWithPos(tok, "unknown operator for datetime and integer: %s", operator)
 	}
 }
 
 // evalIntegerDatetimeInfixExpression handles integer + datetime
-func evalIntegerDatetimeInfixExpression(tok lexer.Token, operator string, seconds *Integer, dt *Dictionary) Object {
-	env := NewEnvironment()
-	unixTime, err := getDatetimeUnix(dt, env)
-	if err != nil {
-		return newErrorWithPos(tok, "invalid datetime: %s", err)
-	}
-
-	// Get the kind from the original datetime
-	kind := getDatetimeKind(dt, env)
+func evalIntegerDatetimeInfixExpression(tok lexer.Token, operator string, seconds *Integer, dt *Datetime) Object {
+	unixTime := dt.Time.Unix()
+	kind := dt.Kind
 
 	switch operator {
 	case "+":
 		// Add seconds to datetime (commutative)
 		newTime := time.Unix(unixTime+seconds.Value, 0).UTC()
-		return timeToDictWithKind(newTime, kind, env)
+		return newDatetime(newTime, kind)
 	default:
 		return newErrorWithPos(tok, "unknown operator for integer and datetime: %s", operator)
 	}
 }
 
 // evalDurationInfixExpression handles duration + duration or duration - duration
-func evalDurationInfixExpression(tok lexer.Token, operator string, left, right *Dictionary) Object {
-	env := NewEnvironment()
-
-	leftMonths, leftSeconds, err := getDurationComponents(left, env)
-	if err != nil {
-		return newErrorWithPos(tok, "invalid duration: %s", err)
-	}
-
-	rightMonths, rightSeconds, err := getDurationComponents(right, env)
-	if err != nil {
-		return newErrorWithPos(tok, "invalid duration: %s", err)
-	}
+func evalDurationInfixExpression(tok lexer.Token, operator string, left, right *Duration) Object {
+	leftMonths, leftMillis := left.Months, left.Millis
+	rightMonths, rightMillis := right.Months, right.Millis
 
 	switch operator {
 	case "+":
-		return durationToDict(leftMonths+rightMonths, leftSeconds+rightSeconds, env)
+		return newDuration(leftMonths+rightMonths, leftMillis+rightMillis)
 	case "-":
-		return durationToDict(leftMonths-rightMonths, leftSeconds-rightSeconds, env)
+		return newDuration(leftMonths-rightMonths, leftMillis-rightMillis)
 	case "<", ">", "<=", ">=", "==", "!=":
-		// Comparison only allowed for pure-seconds durations (no months)
+		// Comparison only allowed for durations without months
 		if leftMonths != 0 || rightMonths != 0 {
 			return newErrorWithPos(tok, "cannot compare durations with month components (months have variable length)")
 		}
 		switch operator {
 		case "<":
-			return nativeBoolToParsBoolean(leftSeconds < rightSeconds)
+			return nativeBoolToParsBoolean(leftMillis < rightMillis)
 		case ">":
-			return nativeBoolToParsBoolean(leftSeconds > rightSeconds)
+			return nativeBoolToParsBoolean(leftMillis > rightMillis)
 		case "<=":
-			return nativeBoolToParsBoolean(leftSeconds <= rightSeconds)
+			return nativeBoolToParsBoolean(leftMillis <= rightMillis)
 		case ">=":
-			return nativeBoolToParsBoolean(leftSeconds >= rightSeconds)
+			return nativeBoolToParsBoolean(leftMillis >= rightMillis)
 		case "==":
-			return nativeBoolToParsBoolean(leftSeconds == rightSeconds && leftMonths == rightMonths)
+			return nativeBoolToParsBoolean(leftMillis == rightMillis && leftMonths == rightMonths)
 		case "!=":
-			return nativeBoolToParsBoolean(leftSeconds != rightSeconds || leftMonths != rightMonths)
+			return nativeBoolToParsBoolean(leftMillis != rightMillis || leftMonths != rightMonths)
 		}
 	}
 
@@ -7421,45 +7719,27 @@ func evalDurationInfixExpression(tok lexer.Token, operator string, left, right *
 }
 
 // evalDurationIntegerInfixExpression handles duration * integer or duration / integer
-func evalDurationIntegerInfixExpression(tok lexer.Token, operator string, dur *Dictionary, num *Integer) Object {
-	env := NewEnvironment()
-
-	months, seconds, err := getDurationComponents(dur, env)
-	if err != nil {
-		return newErrorWithPos(tok, "invalid duration: %s", err)
-	}
+func evalDurationIntegerInfixExpression(tok lexer.Token, operator string, dur *Duration, num *Integer) Object {
+	months, millis := dur.Months, dur.Millis
 
 	switch operator {
 	case "*":
-		return durationToDict(months*num.Value, seconds*num.Value, env)
+		return newDuration(months*num.Value, millis*num.Value)
 	case "/":
 		if num.Value == 0 {
 			return newErrorWithPos(tok, "division by zero")
 		}
-		return durationToDict(months/num.Value, seconds/num.Value, env)
+		return newDuration(months/num.Value, millis/num.Value)
 	default:
 		return newErrorWithPos(tok, "unknown operator for duration and integer: %s", operator)
 	}
 }
 
 // evalDatetimeDurationInfixExpression handles datetime + duration or datetime - duration
-func evalDatetimeDurationInfixExpression(tok lexer.Token, operator string, dt, dur *Dictionary) Object {
-	env := NewEnvironment()
-
-	// Get datetime as time.Time
-	t, err := dictToTime(dt, env)
-	if err != nil {
-		return newErrorWithPos(tok, "invalid datetime: %s", err)
-	}
-
-	// Get duration components
-	months, seconds, err := getDurationComponents(dur, env)
-	if err != nil {
-		return newErrorWithPos(tok, "invalid duration: %s", err)
-	}
-
-	// Get the kind from the original datetime
-	kind := getDatetimeKind(dt, env)
+func evalDatetimeDurationInfixExpression(tok lexer.Token, operator string, dt *Datetime, dur *Duration) Object {
+	t := dt.Time
+	months, seconds := dur.Months, dur.Seconds()
+	kind := dt.Kind
 
 	switch operator {
 	case "+":
@@ -7471,7 +7751,7 @@ func evalDatetimeDurationInfixExpression(tok lexer.Token, operator string, dt, d
 		if seconds != 0 {
 			t = t.Add(time.Duration(seconds) * time.Second)
 		}
-		return timeToDictWithKind(t, kind, env)
+		return newDatetime(t, kind)
 	case "-":
 		// Subtract months first
 		if months != 0 {
@@ -7481,23 +7761,23 @@ func evalDatetimeDurationInfixExpression(tok lexer.Token, operator string, dt, d
 		if seconds != 0 {
 			t = t.Add(-time.Duration(seconds) * time.Second)
 		}
-		return timeToDictWithKind(t, kind, env)
+		return newDatetime(t, kind)
 	default:
 		return newErrorWithPos(tok, "unknown operator for datetime and duration: %s", operator)
 	}
 }
 
-// evalPathInfixExpression handles operations between two path dictionaries
-func evalPathInfixExpression(tok lexer.Token, operator string, left, right *Dictionary) Object {
+// evalPathInfixExpression handles operations between two paths
+func evalPathInfixExpression(tok lexer.Token, operator string, left, right *Path) Object {
 	switch operator {
 	case "==":
 		// Compare paths by their string representation
-		leftStr := pathDictToString(left)
-		rightStr := pathDictToString(right)
+		leftStr := left.Inspect()
+		rightStr := right.Inspect()
 		return nativeBoolToParsBoolean(leftStr == rightStr)
 	case "!=":
-		leftStr := pathDictToString(left)
-		rightStr := pathDictToString(right)
+		leftStr := left.Inspect()
+		rightStr := right.Inspect()
 		return nativeBoolToParsBoolean(leftStr != rightStr)
 	default:
 		return newErrorWithPos(tok, "unknown operator for path: %s (supported: ==, !=)", operator)
@@ -7505,72 +7785,37 @@ func evalPathInfixExpression(tok lexer.Token, operator string, left, right *Dict
 }
 
 // evalPathStringInfixExpression handles path + string or path / string
-func evalPathStringInfixExpression(tok lexer.Token, operator string, path *Dictionary, str *String) Object {
-	env := path.Env
-	if env == nil {
-		env = NewEnvironment()
-	}
-
+func evalPathStringInfixExpression(tok lexer.Token, operator string, path *Path, str *String) Object {
 	switch operator {
 	case "+", "/":
 		// Join path with string segment
-		// Get current components
-		componentsExpr, ok := path.Pairs["components"]
-		if !ok {
-			return newErrorWithPos(tok, "path dictionary missing components field")
-		}
-		componentsObj := Eval(componentsExpr, env)
-		if componentsObj.Type() != ARRAY_OBJ {
-			return newErrorWithPos(tok, "path components is not an array")
-		}
-		componentsArr := componentsObj.(*Array)
-
-		// Get absolute flag
-		absoluteExpr, ok := path.Pairs["absolute"]
-		if !ok {
-			return newErrorWithPos(tok, "path dictionary missing absolute field")
-		}
-		absoluteObj := Eval(absoluteExpr, env)
-		if absoluteObj.Type() != BOOLEAN_OBJ {
-			return newErrorWithPos(tok, "path absolute is not a boolean")
-		}
-		isAbsolute := absoluteObj.(*Boolean).Value
-
-		// Parse the string to add as new path segments
 		newSegments, _ := parsePathString(str.Value)
 
-		// Combine components
-		var newComponents []string
-		for _, elem := range componentsArr.Elements {
-			if strObj, ok := elem.(*String); ok {
-				newComponents = append(newComponents, strObj.Value)
-			}
-		}
-
 		// Append new segments (skip empty leading segment if present)
+		newComponents := append([]string{}, path.Components...)
 		for _, seg := range newSegments {
 			if seg != "" || len(newComponents) == 0 {
 				newComponents = append(newComponents, seg)
 			}
 		}
 
-		return pathToDict(newComponents, isAbsolute, env)
+		return newPath(newComponents, path.Absolute)
 	default:
 		return newErrorWithPos(tok, "unknown operator for path and string: %s (supported: +, /)", operator)
 	}
 }
 
-// evalUrlInfixExpression handles operations between two URL dictionaries
-func evalUrlInfixExpression(tok lexer.Token, operator string, left, right *Dictionary) Object {
+// evalUrlInfixExpression handles operations between two URLs
+func evalUrlInfixExpression(tok lexer.Token, operator string, left, right *Url) Object {
 	switch operator {
 	case "==":
 		// Compare URLs by their string representation
-		leftStr := urlDictToString(left)
-		rightStr := urlDictToString(right)
+		leftStr := left.Inspect()
+		rightStr := right.Inspect()
 		return nativeBoolToParsBoolean(leftStr == rightStr)
 	case "!=":
-		leftStr := urlDictToString(left)
-		rightStr := urlDictToString(right)
+		leftStr := left.Inspect()
+		rightStr := right.Inspect()
 		return nativeBoolToParsBoolean(leftStr != rightStr)
 	default:
 		return newErrorWithPos(tok, "unknown operator for url: %s (supported: ==, !=)", operator)
@@ -7578,60 +7823,22 @@ func evalUrlInfixExpression(tok lexer.Token, operator string, left, right *Dicti
 }
 
 // evalUrlStringInfixExpression handles url + string for path joining
-func evalUrlStringInfixExpression(tok lexer.Token, operator string, urlDict *Dictionary, str *String) Object {
-	env := urlDict.Env
-	if env == nil {
-		env = NewEnvironment()
-	}
-
+func evalUrlStringInfixExpression(tok lexer.Token, operator string, u *Url, str *String) Object {
 	switch operator {
 	case "+":
 		// Add string to URL path
-		// Get current path array
-		pathExpr, ok := urlDict.Pairs["path"]
-		if !ok {
-			return newErrorWithPos(tok, "url dictionary missing path field")
-		}
-		pathObj := Eval(pathExpr, env)
-		if pathObj.Type() != ARRAY_OBJ {
-			return newErrorWithPos(tok, "url path is not an array")
-		}
-		pathArr := pathObj.(*Array)
-
-		// Parse the string as a path to add
 		newSegments, _ := parsePathString(str.Value)
 
-		// Combine path segments
-		var newPath []string
-		for _, elem := range pathArr.Elements {
-			if strObj, ok := elem.(*String); ok {
-				newPath = append(newPath, strObj.Value)
-			}
-		}
-
 		// Append new segments (skip empty leading segment)
+		joined := *u
+		joined.Path = append([]string{}, u.Path...)
 		for _, seg := range newSegments {
 			if seg != "" {
-				newPath = append(newPath, seg)
-			}
-		}
-
-		// Create new URL dict with updated path
-		pairs := make(map[string]ast.Expression)
-		for k, v := range urlDict.Pairs {
-			if k == "path" {
-				// Create new path array
-				pathElements := make([]ast.Expression, len(newPath))
-				for i, seg := range newPath {
-					pathElements[i] = &ast.StringLiteral{Value: seg}
-				}
-				pairs[k] = &ast.ArrayLiteral{Elements: pathElements}
-			} else {
-				pairs[k] = v
+				joined.Path = append(joined.Path, seg)
 			}
 		}
 
-		return &Dictionary{Pairs: pairs, Env: env}
+		return &joined
 	default:
 		return newErrorWithPos(tok, "unknown operator for url and string: %s (supported: +)", operator)
 	}
@@ -7641,7 +7848,7 @@ func evalUrlStringInfixExpression(tok lexer.Token, operator string, urlDict *Dic
 func evalStringConcatExpression(left, right Object) Object {
 	leftStr := objectToTemplateString(left)
 	rightStr := objectToTemplateString(right)
-	return &String{Value: leftStr + rightStr}
+	return &String{Value: leftStr + rightStr, Untrusted: isUntrusted(left) || isUntrusted(right)}
 }
 
 func evalIfExpression(ie *ast.IfExpression, env *Environment) Object {
@@ -7693,7 +7900,12 @@ func evalIdentifier(node *ast.Identifier, env *Environment) Object {
 		if builtin, ok := getBuiltins()[node.Value]; ok {
 			return builtin
 		}
-		return newErrorWithPos(node.Token, "identifier not found: %s", node.Value)
+		if node.Value == "env" {
+			return envDict(env)
+		}
+		err := newErrorWithPos(node.Token, "identifier not found: %s", node.Value)
+		err.Hint = identifierHint(node.Value, env)
+		return err
 	}
 
 	return val
@@ -7718,8 +7930,17 @@ func applyFunction(fn Object, args []Object) Object {
 	case *Function:
 		extendedEnv := extendFunctionEnv(fn, args)
 		evaluated := Eval(fn.Body, extendedEnv)
+		if errObj, ok := evaluated.(*Error); ok {
+			// Builtins calling back don't know their caller's file, so the
+			// error is put in the function's file; evalProgram drops the
+			// file again if it's the program's own
+			return errorInFile(errObj, extendedEnv.Filename, "")
+		}
 		return unwrapReturnValue(evaluated)
 	case *Builtin:
+		if !fn.Ranges {
+			args = rangesAsArrays(args)
+		}
 		return fn.Fn(args...)
 	default:
 		return newError("not a function: %s", fn.Type())
@@ -7729,10 +7950,13 @@ func applyFunction(fn Object, args []Object) Object {
 // applyMethodWithThis calls a function with 'this' bound to a dictionary.
 // This enables object-oriented style method calls like user.greet() where
 // the function can access the dictionary via 'this'.
-func applyMethodWithThis(fn *Function, args []Object, thisObj *Dictionary) Object {
+func applyMethodWithThis(fn *Function, args []Object, thisObj *Dictionary, env *Environment) Object {
 	extendedEnv := extendFunctionEnv(fn, args)
 	extendedEnv.Set("this", thisObj)
 	evaluated := Eval(fn.Body, extendedEnv)
+	if errObj, ok := evaluated.(*Error); ok {
+		return errorInFile(errObj, extendedEnv.Filename, env.Filename)
+	}
 	return unwrapReturnValue(evaluated)
 }
 
@@ -7740,9 +7964,19 @@ func applyFunctionWithEnv(fn Object, args []Object, env *Environment) Object {
 	switch fn := fn.(type) {
 	case *Function:
 		extendedEnv := extendFunctionEnv(fn, args)
+		extendedEnv.call.caller = env
+		if env.parallel != nil {
+			extendedEnv.parallel = env.parallel
+		}
 		evaluated := Eval(fn.Body, extendedEnv)
+		if errObj, ok := evaluated.(*Error); ok {
+			return errorInFile(errObj, extendedEnv.Filename, env.Filename)
+		}
 		return unwrapReturnValue(evaluated)
 	case *Builtin:
+		if !fn.Ranges {
+			args = rangesAsArrays(args)
+		}
 		return fn.Fn(args...)
 	case *SFTPConnection:
 		// SFTP connection is callable: conn(@/path) returns SFTP file handle
@@ -7753,11 +7987,8 @@ func applyFunctionWithEnv(fn Object, args []Object, env *Environment) Object {
 		// Extract path from argument
 		var pathStr string
 		switch arg := args[0].(type) {
-		case *Dictionary:
-			if !isPathDict(arg) {
-				return newError("argument to SFTP connection must be a path, got dictionary")
-			}
-			pathStr = pathDictToString(arg)
+		case *Path:
+			pathStr = arg.Inspect()
 		case *String:
 			pathStr = arg.Value
 		default:
@@ -7781,26 +8012,35 @@ func evalImport(args []Object, env *Environment) Object {
 	if len(args) != 1 {
 		return newError("wrong number of arguments to `import`. got=%d, want=1", len(args))
 	}
+	if env.parallel != nil {
+		return newError("cannot import inside parallel() (import the module before calling parallel)")
+	}
 
-	// Extract path string from argument (handle both path dictionaries and strings)
+	// Extract path string from argument (handle both paths and strings)
 	var pathStr string
 	switch arg := args[0].(type) {
-	case *Dictionary:
+	case *Url:
+		// Remote modules (@https://example.com/lib.pars) are downloaded and cached
+		return importRemote(arg.Inspect(), env)
+	case *Path:
 		// Handle path literal (@/path/to/file.pars)
-		if typeExpr, ok := arg.Pairs["__type"]; ok {
-			typeVal := Eval(typeExpr, arg.Env)
-			if typeStr, ok := typeVal.(*String); ok && typeStr.Value == "path" {
-				pathStr = pathDictToString(arg)
-			} else {
-				return newError("argument to `import` must be a path or string, got dictionary")
-			}
-		} else {
-			return newError("argument to `import` must be a path or string, got dictionary")
-		}
+		pathStr = arg.Inspect()
 	case *String:
 		pathStr = arg.Value
 	default:
-		return newError("argument to `import` must be a path or string, got %s", arg.Type())
+		return newError("argument to `import` must be a path, URL or string, got %s", arg.Type())
+	}
+
+	if isRemoteModulePath(pathStr) {
+		return importRemote(pathStr, env)
+	}
+	// A remote module's relative imports come from the same server
+	if env.moduleURL != "" && isExplicitModulePath(pathStr) && !filepath.IsAbs(pathStr) {
+		moduleURL, err := resolveModuleURL(env.moduleURL, pathStr)
+		if err != nil {
+			return newError("failed to resolve module path: %s", err.Error())
+		}
+		return importRemote(moduleURL, env)
 	}
 
 	// Resolve path relative to current file
@@ -7809,14 +8049,32 @@ func evalImport(args []Object, env *Environment) Object {
 		return newError("failed to resolve module path: %s", err.Error())
 	}
 
-	// Security check
-	if err := env.checkPathAccess(absPath, "execute"); err != nil {
+	// Fall back to the module search paths for paths that aren't explicitly relative
+	if _, statErr := os.Stat(absPath); statErr != nil && !isExplicitModulePath(pathStr) {
+		for _, dir := range env.ModulePaths {
+			candidate := filepath.Join(dir, pathStr)
+			if _, err := os.Stat(candidate); err == nil {
+				absPath = candidate
+				break
+			}
+		}
+	}
+
+	// Security check: data files are read, everything else is executed
+	dataFormat := dataModuleFormat(absPath)
+	operation := "execute"
+	if dataFormat != "" {
+		operation = "read"
+	}
+	if err := env.checkPathAccess(absPath, operation); err != nil {
 		return newError("security: %s", err.Error())
 	}
 
-	// Check if module is currently being loaded (circular dependency)
-	if moduleCache.loading[absPath] {
-		return newError("circular dependency detected when importing: %s", absPath)
+	moduleCache.addDependent(absPath, env.Filename)
+
+	// A module that is still loading was imported circularly
+	if load, ok := moduleCache.loading[absPath]; ok {
+		return load.circularImport(absPath)
 	}
 
 	// Check cache first
@@ -7824,57 +8082,244 @@ func evalImport(args []Object, env *Environment) Object {
 		return cached
 	}
 
-	// Mark as loading
-	moduleCache.loading[absPath] = true
-	defer delete(moduleCache.loading, absPath)
-
 	// Read the file
 	content, err := os.ReadFile(absPath)
 	if err != nil {
 		return newError("failed to read module file %s: %s", absPath, err.Error())
 	}
+	recordFileRead(len(content))
+
+	return evalModule(absPath, absPath, "", content, env)
+}
+
+// evalModule runs a module's source, or parses a data file, and caches the
+// result under key: the module's path, or its URL for a remote module, which
+// is run from the downloaded copy at filename
+func evalModule(key, filename, moduleURL string, content []byte, env *Environment) Object {
+	// Data files import as their parsed contents
+	if dataFormat := dataModuleFormat(filename); dataFormat != "" {
+		data, errObj := parseDataModule(dataFormat, content)
+		if errObj != nil {
+			return newError("in module %s: %s", key, errObj.Message)
+		}
+		moduleCache.store(key, data)
+		return data
+	}
 
 	// Parse the module
 	l := lexer.New(string(content))
 	p := parser.New(l)
 	program := p.ParseProgram()
 	if len(p.Errors()) > 0 {
-		var errMsg strings.Builder
-		errMsg.WriteString(fmt.Sprintf("parse errors in module %s:\n", absPath))
-		for _, msg := range p.Errors() {
-			errMsg.WriteString(fmt.Sprintf("  %s\n", msg))
-		}
-		return newError("%s", errMsg.String())
+		return moduleParseError(filename, p.Errors())
 	}
 
 	// Create isolated environment for the module
 	moduleEnv := NewEnvironment()
-	moduleEnv.Filename = absPath
-	// Copy security policy from parent environment
+	moduleEnv.Filename = filename
+	moduleEnv.moduleURL = moduleURL
+	// Copy security policy and module search paths from parent environment
 	moduleEnv.Security = env.Security
+	moduleEnv.ModulePaths = env.ModulePaths
+	moduleEnv.LockFile = env.LockFile
+	moduleEnv.Strict = env.Strict
+	moduleEnv.EnvVars = env.EnvVars
+	moduleEnv.strictFile = hasStrictPragma(program)
+
+	// Mark as loading
+	load := &moduleLoad{env: moduleEnv, exports: declaredNames(program, moduleEnv.isStrict())}
+	moduleCache.loading[key] = load
+	moduleCache.stack = append(moduleCache.stack, key)
+	defer func() {
+		delete(moduleCache.loading, key)
+		moduleCache.stack = moduleCache.stack[:len(moduleCache.stack)-1]
+	}()
 
 	// Evaluate the module
 	result := Eval(program, moduleEnv)
 
 	// Check for errors during module evaluation
 	if isError(result) {
-		errObj := result.(*Error)
-		// Include module path in error message for context
-		if errObj.Line > 0 {
-			return newError("in module %s: line %d, column %d: %s", absPath, errObj.Line, errObj.Column, errObj.Message)
+		// Errors keep their position in the module, and any import cycle
+		errObj := *result.(*Error)
+		if load.cycle != nil {
+			errObj.Message += fmt.Sprintf(" (import cycle: %s)", strings.Join(load.cycle, " -> "))
+		}
+		if errObj.File == "" {
+			errObj.File = filename
 		}
-		return newError("in module %s: %s", absPath, errObj.Message)
+		return &errObj
 	}
 
-	// Convert environment to dictionary
+	// Convert environment to dictionary, completing the proxy handed to
+	// circular imports so they see the final exports
 	moduleDict := environmentToDict(moduleEnv)
+	if load.proxy != nil {
+		load.proxy.Pairs = moduleDict.Pairs
+		moduleDict = load.proxy
+	}
 
 	// Cache the result
-	moduleCache.modules[absPath] = moduleDict
+	moduleCache.store(key, moduleDict)
 
 	return moduleDict
 }
 
+// evalImportStatement binds the names listed in
+// 'import {a, b as c} from path'. Importing a name the module doesn't export
+// is an error, where destructuring import()'s result would give null.
+func evalImportStatement(node *ast.ImportStatement, env *Environment) Object {
+	pathObj := Eval(node.Path, env)
+	if isError(pathObj) {
+		return pathObj
+	}
+	pathStr := node.Path.String()
+	switch p := pathObj.(type) {
+	case *String:
+		pathStr = p.Value
+	case *Path:
+		pathStr = p.Inspect()
+	}
+	module := evalImport([]Object{pathObj}, env)
+	if errObj, ok := module.(*Error); ok {
+		if errObj.File != "" {
+			return importedFrom(errObj, node.Token, env)
+		}
+		return errObj
+	}
+	dict, ok := module.(*Dictionary)
+	if !ok {
+		return newErrorWithPos(node.Token, "cannot import names from %s: it imports as %s, not a dictionary", pathStr, strings.ToLower(string(module.Type())))
+	}
+
+	for _, name := range node.Names {
+		expr, ok := dict.Pairs[name.Name.Value]
+		if !ok {
+			return notExportedError(name.Name, pathStr, dict)
+		}
+		val := Eval(expr, dict.Env)
+		if isError(val) {
+			return val
+		}
+		bound := name.Name
+		if name.Alias != nil {
+			bound = name.Alias
+		}
+		// Imported names are private to the importing module
+		env.Set(bound.Value, val)
+		env.declare(bound)
+	}
+	return NULL
+}
+
+// circularImport returns a proxy for a module imported while it is still
+// loading. Names it has already defined can be used straight away; the rest
+// resolve once the module finishes, so mutual references inside functions work.
+func (load *moduleLoad) circularImport(absPath string) *Dictionary {
+	start := 0
+	for i, p := range moduleCache.stack {
+		if p == absPath {
+			start = i
+			break
+		}
+	}
+	load.cycle = append(append([]string{}, moduleCache.stack[start:]...), absPath)
+
+	if load.proxy == nil {
+		pairs := make(map[string]ast.Expression, len(load.exports))
+		for _, name := range load.exports {
+			pairs[name] = &ast.Identifier{Token: lexer.Token{Type: lexer.IDENT, Literal: name}, Value: name}
+		}
+		load.proxy = &Dictionary{Pairs: pairs, Env: load.env}
+	}
+	return load.proxy
+}
+
+// declaredNames lists the names bound by a module's top-level let and
+// export statements, which become its exports (only export in strict mode)
+func declaredNames(program *ast.Program, strict bool) []string {
+	var names []string
+	var walk func(pattern *ast.DictDestructuringPattern)
+	walk = func(pattern *ast.DictDestructuringPattern) {
+		for _, key := range pattern.Keys {
+			if nested, ok := key.Nested.(*ast.DictDestructuringPattern); ok {
+				walk(nested)
+			} else if key.Alias != nil {
+				names = append(names, key.Alias.Value)
+			} else {
+				names = append(names, key.Key.Value)
+			}
+		}
+		if pattern.Rest != nil {
+			names = append(names, pattern.Rest.Value)
+		}
+	}
+
+	for _, stmt := range program.Statements {
+		var name *ast.Identifier
+		var list []*ast.Identifier
+		var pattern *ast.DictDestructuringPattern
+		switch st := stmt.(type) {
+		case *ast.LetStatement:
+			if strict && !st.Export {
+				continue
+			}
+			name, list, pattern = st.Name, st.Names, st.DictPattern
+		case *ast.AssignmentStatement:
+			if !st.Export {
+				continue
+			}
+			name, list, pattern = st.Name, st.Names, st.DictPattern
+		default:
+			continue
+		}
+		if name != nil {
+			names = append(names, name.Value)
+		}
+		for _, ident := range list {
+			names = append(names, ident.Value)
+		}
+		if pattern != nil {
+			walk(pattern)
+		}
+	}
+	return names
+}
+
+// dataModuleFormat returns the data format imported from a file by its
+// extension ("json", "yaml" or "csv"), or "" for a Parsley module
+func dataModuleFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return "json"
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".csv":
+		return "csv"
+	}
+	return ""
+}
+
+// parseDataModule parses an imported data file. CSV files are read with a
+// header row, giving an array of dictionaries.
+func parseDataModule(format string, content []byte) (Object, *Error) {
+	switch format {
+	case "json":
+		return parseJSON(string(content))
+	case "yaml":
+		return parseYAML(string(content))
+	default:
+		return parseCSV(content, defaultCSVOptions(true))
+	}
+}
+
+// isExplicitModulePath reports whether an import path is absolute or starts
+// with ./ or ../, so module search paths don't apply
+func isExplicitModulePath(pathStr string) bool {
+	return filepath.IsAbs(pathStr) || strings.HasPrefix(pathStr, "./") || strings.HasPrefix(pathStr, "../") ||
+		pathStr == "." || pathStr == ".."
+}
+
 // evalLogLine implements logLine with filename and line number
 func evalLogLine(args []Object, env *Environment) Object {
 	var result strings.Builder
@@ -7926,6 +8371,82 @@ func evalLogLine(args []Object, env *Environment) Object {
 	return NULL
 }
 
+// evalWithLock implements lock(path) { ... } and withLock(path, fn, options?).
+// It holds an advisory lock on the lock file while fn runs, so critical sections
+// are serialized across concurrently running scripts.
+func evalWithLock(fnName string, args []Object, env *Environment) Object {
+	if len(args) < 2 || len(args) > 3 {
+		return newError("wrong number of arguments to `%s`. got=%d, want=2-3", fnName, len(args))
+	}
+
+	var pathStr string
+	switch arg := args[0].(type) {
+	case *String:
+		pathStr = arg.Value
+	case *Path:
+		pathStr = arg.Inspect()
+	default:
+		return newError("first argument to `%s` must be a path or string, got %s", fnName, args[0].Type())
+	}
+
+	// lock(path, options) { ... } puts the block after the options
+	if len(args) == 3 {
+		if _, ok := args[2].(*Function); ok {
+			args[1], args[2] = args[2], args[1]
+		}
+	}
+
+	fn, ok := args[1].(*Function)
+	if !ok {
+		return newError("second argument to `%s` must be a function, got %s", fnName, args[1].Type())
+	}
+
+	var timeout time.Duration
+	if len(args) == 3 {
+		opts, ok := args[2].(*Dictionary)
+		if !ok {
+			return newError("options to `%s` must be a dictionary, got %s", fnName, args[2].Type())
+		}
+		if timeoutExpr, ok := opts.Pairs["timeout"]; ok {
+			dur, ok := Eval(timeoutExpr, opts.Env).(*Duration)
+			if !ok {
+				return newError("`timeout` option for `%s` must be a duration", fnName)
+			}
+			months, seconds := dur.Months, dur.Seconds()
+			if months != 0 || seconds < 0 {
+				return newError("`timeout` option for `%s` must be a positive duration without months or years", fnName)
+			}
+			// A zero timeout means "try once"; filelock uses negative values for that
+			timeout = time.Duration(seconds) * time.Second
+			if timeout == 0 {
+				timeout = -1
+			}
+		}
+	}
+
+	absPath, err := resolveModulePath(pathStr, env.Filename)
+	if err != nil {
+		return newError("failed to resolve lock path '%s': %s", pathStr, err.Error())
+	}
+
+	// Creating the lock file is a write
+	if err := env.checkPathAccess(absPath, "write"); err != nil {
+		return newError("security: %s", err.Error())
+	}
+
+	if env.dryRun("lock %s", absPath) {
+		return applyFunction(fn, []Object{})
+	}
+
+	lock, err := filelock.Acquire(absPath, timeout)
+	if err != nil {
+		return newError("could not acquire lock on '%s': %s", pathStr, err.Error())
+	}
+	defer lock.Unlock()
+
+	return applyFunction(fn, []Object{})
+}
+
 // evalLog implements log() using the environment's logger
 func evalLog(args []Object, env *Environment) Object {
 	var result strings.Builder
@@ -7967,6 +8488,7 @@ func evalLog(args []Object, env *Environment) Object {
 
 func extendFunctionEnv(fn *Function, args []Object) *Environment {
 	env := NewEnclosedEnvironment(fn.Env)
+	env.call = &functionCall{fn: fn, args: args}
 
 	// Use parameter list with destructuring support
 	for paramIdx, param := range fn.Params {
@@ -7999,6 +8521,14 @@ func evalArrayDestructuringForParam(pattern []*ast.Identifier, val Object, env *
 	switch v := val.(type) {
 	case *Array:
 		elements = v.Elements
+	case *Range:
+		elements = v.toArray().Elements
+	case *Dictionary:
+		if isMatchDict(v) {
+			elements = matchElements(v).Elements
+		} else {
+			elements = []Object{v}
+		}
 	default:
 		// Single value becomes single-element array
 		elements = []Object{v}
@@ -8055,11 +8585,28 @@ func evalForExpression(node *ast.ForExpression, env *Environment) Object {
 		}
 	}
 
-	// Handle dictionary iteration
-	if dict, ok := iterableObj.(*Dictionary); ok {
+	// Match objects iterate as [match, ...captures]
+	if dict, ok := iterableObj.(*Dictionary); ok && isMatchDict(dict) {
+		iterableObj = matchElements(dict)
+	}
+
+	// Handle dictionary iteration, including the fields of datetimes,
+	// durations, paths and URLs
+	if dict, ok := asDictionary(iterableObj, env); ok {
 		return evalForDictExpression(node, dict, env)
 	}
 
+	if it, ok := iterableObj.(*Iterator); ok {
+		return evalForElements(node, it.each, env)
+	}
+	// Ranges are iterated without generating them first
+	if r, ok := iterableObj.(*Range); ok {
+		return evalForElements(node, r.each, env)
+	}
+	if ch, ok := iterableObj.(*Channel); ok {
+		return evalForElements(node, ch.each(env), env)
+	}
+
 	// Convert to array (handle strings as rune arrays)
 	var elements []Object
 	switch arr := iterableObj.(type) {
@@ -8073,9 +8620,14 @@ func evalForExpression(node *ast.ForExpression, env *Environment) Object {
 			elements[i] = &String{Value: string(r)}
 		}
 	default:
-		return newError("for expects an array, string, or dictionary, got %s", iterableObj.Type())
+		return newError("for expects an array, string, dictionary, iterator or channel, got %s", iterableObj.Type())
 	}
 
+	return evalForElements(node, eachElement(elements), env)
+}
+
+// evalForElements runs a for loop over a sequence of elements
+func evalForElements(node *ast.ForExpression, each sequence, env *Environment) Object {
 	// Determine which function to use
 	var fn Object
 	if node.Function != nil {
@@ -8105,7 +8657,8 @@ func evalForExpression(node *ast.ForExpression, env *Environment) Object {
 
 	// Map function over array elements
 	result := []Object{}
-	for idx, elem := range elements {
+	idx := 0
+	errObj := each(func(elem Object) Object {
 		var evaluated Object
 
 		switch f := fn.(type) {
@@ -8144,11 +8697,16 @@ func evalForExpression(node *ast.ForExpression, env *Environment) Object {
 				}
 			}
 		}
+		idx++
 
 		// Skip null values (filter behavior)
 		if evaluated != NULL {
 			result = append(result, evaluated)
 		}
+		return nil
+	})
+	if errObj != nil {
+		return errObj
 	}
 
 	return &Array{Elements: result}
@@ -8226,6 +8784,7 @@ func newErrorWithPos(tok lexer.Token, format string, a ...interface{}) *Error {
 		Message: fmt.Sprintf(format, a...),
 		Line:    tok.Line,
 		Column:  tok.Column,
+		Length:  len(tok.Literal),
 	}
 }
 
@@ -8244,6 +8803,14 @@ func evalDestructuringAssignment(names []*ast.Identifier, val Object, env *Envir
 	switch v := val.(type) {
 	case *Array:
 		elements = v.Elements
+	case *Range:
+		elements = v.toArray().Elements
+	case *Dictionary:
+		if isMatchDict(v) {
+			elements = matchElements(v).Elements
+		} else {
+			elements = []Object{v}
+		}
 	default:
 		// Single value becomes single-element array
 		elements = []Object{v}
@@ -8305,8 +8872,8 @@ func evalDestructuringAssignment(names []*ast.Identifier, val Object, env *Envir
 
 // evalDictDestructuringAssignment evaluates dictionary destructuring patterns
 func evalDictDestructuringAssignment(pattern *ast.DictDestructuringPattern, val Object, env *Environment, isLet bool, export bool) Object {
-	// Type check: value must be a dictionary
-	dict, ok := val.(*Dictionary)
+	// Type check: value must be a dictionary or have fields like one
+	dict, ok := asDictionary(val, env)
 	if !ok {
 		return newError("dictionary destructuring requires a dictionary value, got %s", val.Type())
 	}
@@ -8356,7 +8923,7 @@ func evalDictDestructuringAssignment(pattern *ast.DictDestructuringPattern, val
 				} else if export {
 					env.SetExport(targetName, value)
 				} else if isLet {
-					env.Set(targetName, value)
+					env.SetLet(targetName, value)
 				} else {
 					env.Update(targetName, value)
 				}
@@ -8394,7 +8961,9 @@ func evalDictDestructuringAssignment(pattern *ast.DictDestructuringPattern, val
 // evalTemplateLiteral evaluates a template literal with interpolation
 func evalTemplateLiteral(node *ast.TemplateLiteral, env *Environment) Object {
 	template := node.Value
+	pos := literalPos(node.Token, 1)
 	var result strings.Builder
+	untrusted := false
 
 	i := 0
 	for i < len(template) {
@@ -8425,12 +8994,9 @@ func evalTemplateLiteral(node *ast.TemplateLiteral, env *Environment) Object {
 			i++ // skip closing }
 
 			// Parse and evaluate the expression
-			l := lexer.New(exprStr)
-			p := parser.New(l)
-			program := p.ParseProgram()
-
-			if len(p.Errors()) > 0 {
-				return newError("error parsing template expression: %s", p.Errors()[0])
+			program, errObj := parseFragment(exprStr, pos.at(template, exprStart), "template expression")
+			if errObj != nil {
+				return errObj
 			}
 
 			// Evaluate the expression
@@ -8445,6 +9011,7 @@ func evalTemplateLiteral(node *ast.TemplateLiteral, env *Environment) Object {
 			// Convert result to string
 			if evaluated != nil {
 				result.WriteString(objectToTemplateString(evaluated))
+				untrusted = untrusted || isUntrusted(evaluated)
 			}
 		} else {
 			// Regular character
@@ -8453,7 +9020,7 @@ func evalTemplateLiteral(node *ast.TemplateLiteral, env *Environment) Object {
 		}
 	}
 
-	return &String{Value: result.String()}
+	return &String{Value: result.String(), Untrusted: untrusted}
 }
 
 // evalTagLiteral evaluates a singleton tag
@@ -8468,15 +9035,21 @@ func evalTagLiteral(node *ast.TagLiteral, env *Environment) Object {
 	tagName := raw[:i]
 	rest := raw[i:]
 
+	// if={...} and for={...} render the tag without them (see tagdirectives.go)
+	if stripped, directives := extractTagDirectives(rest); directives != (tagDirectives{}) {
+		tag := &ast.TagLiteral{Token: node.Token, Raw: tagName + stripped}
+		return evalTagDirectives(tag, tagName, directives, env)
+	}
+
 	// Check if it's a custom tag (starts with uppercase)
 	isCustom := len(tagName) > 0 && unicode.IsUpper(rune(tagName[0]))
 
 	if isCustom {
 		// Custom tag - call function with props dictionary
-		return evalCustomTag(tagName, rest, env)
+		return evalCustomTag(node.Token, tagName, rest, propsPos(node.Token, tagName, rest), env)
 	} else {
 		// Standard tag - return as interpolated string
-		return evalStandardTag(tagName, rest, env)
+		return evalStandardTag(tagName, rest, propsPos(node.Token, tagName, rest), env)
 	}
 }
 
@@ -8487,6 +9060,13 @@ func evalTagPair(node *ast.TagPairExpression, env *Environment) Object {
 		return evalTagContents(node.Contents, env)
 	}
 
+	// if={...} and for={...} render the tag without them (see tagdirectives.go)
+	if stripped, directives := extractTagDirectives(node.Props); directives != (tagDirectives{}) {
+		tag := *node
+		tag.Props = stripped
+		return evalTagDirectives(&tag, node.Name, directives, env)
+	}
+
 	// Check if it's a custom component (starts with uppercase)
 	isCustom := len(node.Name) > 0 && unicode.IsUpper(rune(node.Name[0]))
 
@@ -8509,7 +9089,7 @@ func evalStandardTagPair(node *ast.TagPairExpression, env *Environment) Object {
 	// Process props with interpolation (similar to singleton tags)
 	if node.Props != "" {
 		result.WriteByte(' ')
-		propsResult := evalTagProps(node.Props, env)
+		propsResult := evalTagProps(node.Props, propsPos(node.Token, node.Name, node.Props), env)
 		if isError(propsResult) {
 			return propsResult
 		}
@@ -8552,7 +9132,7 @@ func evalCustomTagPair(node *ast.TagPairExpression, env *Environment) Object {
 	}
 
 	// Parse props into a dictionary and add contents
-	propsDict := parseTagProps(node.Props, env)
+	propsDict := parseTagProps(node.Props, propsPos(node.Token, node.Name, node.Props), env)
 	if isError(propsDict) {
 		return propsDict
 	}
@@ -8583,7 +9163,7 @@ func evalCustomTagPair(node *ast.TagPairExpression, env *Environment) Object {
 	}
 
 	// Call the function with the props dictionary
-	return applyFunction(val, []Object{dict})
+	return applyComponent(val, node.Name, node.Token, dict, env)
 }
 
 // evalTagContents evaluates tag contents and returns as a concatenated string
@@ -8595,7 +9175,7 @@ func evalTagContents(contents []ast.Node, env *Environment) Object {
 		if isError(obj) {
 			return obj
 		}
-		result.WriteString(objectToTemplateString(obj))
+		result.WriteString(tagString(obj))
 	}
 
 	return &String{Value: result.String()}
@@ -8614,7 +9194,7 @@ func evalTagContentsAsArray(contents []ast.Node, env *Environment) Object {
 			return obj
 		}
 		// Convert to string for consistency
-		elements = append(elements, &String{Value: objectToTemplateString(obj)})
+		elements = append(elements, &String{Value: tagString(obj)})
 	}
 
 	return &Array{Elements: elements}
@@ -8623,7 +9203,7 @@ func evalTagContentsAsArray(contents []ast.Node, env *Environment) Object {
 // evalSQLTag handles <SQL params={...}>...</SQL> tags
 func evalSQLTag(node *ast.TagPairExpression, env *Environment) Object {
 	// Parse props to get params
-	propsDict := parseTagProps(node.Props, env)
+	propsDict := parseTagProps(node.Props, propsPos(node.Token, node.Name, node.Props), env)
 	if isError(propsDict) {
 		return propsDict
 	}
@@ -8649,6 +9229,9 @@ func evalSQLTag(node *ast.TagPairExpression, env *Environment) Object {
 		if paramsExpr, hasParams := dict.Pairs["params"]; hasParams {
 			resultPairs["params"] = paramsExpr
 		}
+		if typesExpr, hasTypes := dict.Pairs["types"]; hasTypes {
+			resultPairs["types"] = typesExpr
+		}
 	}
 
 	return &Dictionary{
@@ -8658,7 +9241,7 @@ func evalSQLTag(node *ast.TagPairExpression, env *Environment) Object {
 }
 
 // evalTagProps evaluates tag props string with interpolations
-func evalTagProps(propsStr string, env *Environment) Object {
+func evalTagProps(propsStr string, pos fragmentPos, env *Environment) Object {
 	var result strings.Builder
 
 	i := 0
@@ -8705,12 +9288,9 @@ func evalTagProps(propsStr string, env *Environment) Object {
 			i++ // skip closing }
 
 			// Parse and evaluate the expression
-			l := lexer.New(exprStr)
-			p := parser.New(l)
-			program := p.ParseProgram()
-
-			if len(p.Errors()) > 0 {
-				return newError("error parsing tag prop expression: %s", p.Errors()[0])
+			program, errObj := parseFragment(exprStr, pos.at(propsStr, exprStart), "tag prop expression")
+			if errObj != nil {
+				return errObj
 			}
 
 			// Evaluate the expression
@@ -8724,7 +9304,7 @@ func evalTagProps(propsStr string, env *Environment) Object {
 
 			// Convert result to string
 			if evaluated != nil {
-				result.WriteString(objectToTemplateString(evaluated))
+				result.WriteString(tagString(evaluated))
 			}
 		} else {
 			// Regular character
@@ -8770,6 +9350,8 @@ func createLiteralExpression(obj Object) ast.Expression {
 			Token: lexer.Token{Type: lexer.IDENT, Literal: "__null__"},
 			Value: "__null__",
 		}
+	case *Range:
+		return createLiteralExpression(obj.toArray())
 	case *Array:
 		// For arrays, create array literal with elements
 		elements := make([]ast.Expression, len(obj.Elements))
@@ -8792,6 +9374,8 @@ func createLiteralExpression(obj Object) ast.Expression {
 			Token: lexer.Token{Type: lexer.LBRACE, Literal: "{"},
 			Pairs: pairs,
 		}
+	case fieldValue:
+		return &ast.ObjectLiteralExpression{Obj: obj}
 	default:
 		// For other types, return a string literal
 		return &ast.StringLiteral{
@@ -8802,7 +9386,7 @@ func createLiteralExpression(obj Object) ast.Expression {
 }
 
 // evalStandardTag evaluates a standard (lowercase) tag as an interpolated string
-func evalStandardTag(tagName string, propsStr string, env *Environment) Object {
+func evalStandardTag(tagName string, propsStr string, pos fragmentPos, env *Environment) Object {
 	var result strings.Builder
 	result.WriteByte('<')
 	result.WriteString(tagName)
@@ -8852,12 +9436,9 @@ func evalStandardTag(tagName string, propsStr string, env *Environment) Object {
 			i++ // skip closing }
 
 			// Parse and evaluate the expression
-			l := lexer.New(exprStr)
-			p := parser.New(l)
-			program := p.ParseProgram()
-
-			if len(p.Errors()) > 0 {
-				return newError("error parsing tag expression: %s", p.Errors()[0])
+			program, errObj := parseFragment(exprStr, pos.at(propsStr, exprStart), "tag expression")
+			if errObj != nil {
+				return errObj
 			}
 
 			// Evaluate the expression
@@ -8871,7 +9452,7 @@ func evalStandardTag(tagName string, propsStr string, env *Environment) Object {
 
 			// Convert result to string (don't add quotes - they should be in the tag already)
 			if evaluated != nil {
-				result.WriteString(objectToTemplateString(evaluated))
+				result.WriteString(tagString(evaluated))
 			}
 		} else {
 			// Regular character
@@ -8885,7 +9466,7 @@ func evalStandardTag(tagName string, propsStr string, env *Environment) Object {
 }
 
 // evalCustomTag evaluates a custom (uppercase) tag as a function call
-func evalCustomTag(tagName string, propsStr string, env *Environment) Object {
+func evalCustomTag(tok lexer.Token, tagName string, propsStr string, pos fragmentPos, env *Environment) Object {
 	// Look up the variable/function
 	val, ok := env.Get(tagName)
 	if !ok {
@@ -8902,17 +9483,17 @@ func evalCustomTag(tagName string, propsStr string, env *Environment) Object {
 	}
 
 	// Parse props into a dictionary
-	props := parseTagProps(propsStr, env)
+	props := parseTagProps(propsStr, pos, env)
 	if isError(props) {
 		return props
 	}
 
 	// Call the function with the props dictionary
-	return applyFunction(val, []Object{props})
+	return applyComponent(val, tagName, tok, props, env)
 }
 
 // parseTagProps parses tag properties into a dictionary
-func parseTagProps(propsStr string, env *Environment) Object {
+func parseTagProps(propsStr string, pos fragmentPos, env *Environment) Object {
 	pairs := make(map[string]ast.Expression)
 
 	i := 0
@@ -9012,12 +9593,9 @@ func parseTagProps(propsStr string, env *Environment) Object {
 						}
 						exprStr := valueStr[exprStart:j]
 						// Parse the expression
-						l := lexer.New(exprStr)
-						p := parser.New(l)
-						program := p.ParseProgram()
-
-						if len(p.Errors()) > 0 {
-							return newError("error parsing tag prop expression: %s", p.Errors()[0])
+						program, errObj := parseFragment(exprStr, pos.at(propsStr, valueStart+exprStart), "tag prop expression")
+						if errObj != nil {
+							return errObj
 						}
 
 						// Store as expression statement
@@ -9074,12 +9652,9 @@ func parseTagProps(propsStr string, env *Environment) Object {
 				i++ // skip }
 
 				// Parse and evaluate the spread expression
-				l := lexer.New(exprStr)
-				p := parser.New(l)
-				program := p.ParseProgram()
-
-				if len(p.Errors()) > 0 {
-					return newError("error parsing tag spread expression: %s", p.Errors()[0])
+				program, errObj := parseFragment(exprStr, pos.at(propsStr, exprStart), "tag spread expression")
+				if errObj != nil {
+					return errObj
 				}
 
 				if len(program.Statements) > 0 {
@@ -9140,12 +9715,9 @@ func parseTagProps(propsStr string, env *Environment) Object {
 			i++ // skip }
 
 			// Parse the expression
-			l := lexer.New(exprStr)
-			p := parser.New(l)
-			program := p.ParseProgram()
-
-			if len(p.Errors()) > 0 {
-				return newError("error parsing tag prop expression: %s", p.Errors()[0])
+			program, errObj := parseFragment(exprStr, pos.at(propsStr, exprStart), "tag prop expression")
+			if errObj != nil {
+				return errObj
 			}
 
 			// Store as expression statement
@@ -9174,6 +9746,8 @@ func objectToTemplateString(obj Object) string {
 		return "false"
 	case *String:
 		return obj.Value
+	case *Range:
+		return objectToTemplateString(obj.toArray())
 	case *Array:
 		// Arrays are printed without commas in templates
 		var result strings.Builder
@@ -9183,24 +9757,18 @@ func objectToTemplateString(obj Object) string {
 		return result.String()
 	case *Dictionary:
 		// Check for special dictionary types
-		if isPathDict(obj) {
-			return pathDictToString(obj)
-		}
-		if isUrlDict(obj) {
-			return urlDictToString(obj)
-		}
 		if isTagDict(obj) {
 			return tagDictToString(obj)
 		}
-		if isDatetimeDict(obj) {
-			return datetimeDictToString(obj)
-		}
-		if isDurationDict(obj) {
-			return durationDictToString(obj)
-		}
 		if isRegexDict(obj) {
 			return regexDictToString(obj)
 		}
+		if isMatchDict(obj) {
+			return matchDictToString(obj)
+		}
+		if isColorDict(obj) {
+			return colorDictToString(obj)
+		}
 		if isFileDict(obj) {
 			return fileDictToString(obj)
 		}
@@ -9236,6 +9804,8 @@ func objectToPrintString(obj Object) string {
 		return "false"
 	case *String:
 		return obj.Value
+	case *Range:
+		return objectToPrintString(obj.toArray())
 	case *Array:
 		// Arrays: recursively print each element without any separators
 		var result strings.Builder
@@ -9245,30 +9815,22 @@ func objectToPrintString(obj Object) string {
 		return result.String()
 	case *Dictionary:
 		// Check for special dictionary types
-		if isPathDict(obj) {
-			// Convert path dictionary back to string
-			return pathDictToString(obj)
-		}
-		if isUrlDict(obj) {
-			// Convert URL dictionary back to string
-			return urlDictToString(obj)
-		}
 		if isTagDict(obj) {
 			// Convert tag dictionary to HTML string
 			return tagDictToString(obj)
 		}
-		if isDatetimeDict(obj) {
-			// Convert datetime dictionary to ISO 8601 string
-			return datetimeDictToString(obj)
-		}
-		if isDurationDict(obj) {
-			// Convert duration dictionary to human-readable string
-			return durationDictToString(obj)
-		}
 		if isRegexDict(obj) {
 			// Convert regex dictionary to /pattern/flags format
 			return regexDictToString(obj)
 		}
+		if isMatchDict(obj) {
+			// Convert match object to the text it matched
+			return matchDictToString(obj)
+		}
+		if isColorDict(obj) {
+			// Convert color dictionary to #rrggbb hex
+			return colorDictToString(obj)
+		}
 		if isFileDict(obj) {
 			// Convert file dictionary to path string
 			return fileDictToString(obj)
@@ -9294,38 +9856,36 @@ func ObjectToPrintString(obj Object) string {
 	return objectToPrintString(obj)
 }
 
-// objectToDebugString converts an object to its debug string representation
-func objectToDebugString(obj Object) string {
-	switch obj := obj.(type) {
-	case *Integer:
-		return strconv.FormatInt(obj.Value, 10)
-	case *Float:
-		return fmt.Sprintf("%g", obj.Value)
-	case *Boolean:
-		if obj.Value {
-			return "true"
-		}
-		return "false"
-	case *String:
-		// Strings are wrapped in quotes for debug output
-		return fmt.Sprintf("\"%s\"", obj.Value)
-	case *Array:
-		// Arrays: recursively debug print each element with separators, wrapped in brackets
-		var result strings.Builder
-		result.WriteString("[")
-		for i, elem := range obj.Elements {
-			if i > 0 {
-				result.WriteString(", ")
-			}
-			result.WriteString(objectToDebugString(elem))
+// ObjectToBytes returns the exact bytes to output for a result: arrays of
+// integers 0-255 are raw bytes, everything else is its print string
+func ObjectToBytes(obj Object) []byte {
+	if arr, ok := rangeAsArray(obj).(*Array); ok && len(arr.Elements) > 0 {
+		if data, err := encodeBytes(arr); err == nil {
+			return data
 		}
-		result.WriteString("]")
-		return result.String()
-	case *Null:
-		return "null"
-	default:
-		return obj.Inspect()
 	}
+	return []byte(objectToPrintString(obj))
+}
+
+// ObjectToData serializes a result as "json", "yaml" or "csv", for pars
+// --output
+func ObjectToData(obj Object, format string) ([]byte, error) {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(objectToGo(obj), "", "  ")
+		return append(data, '\n'), err
+	case "yaml":
+		return encodeYAML(obj, defaultYAMLIndent)
+	case "csv":
+		return encodeCSV(obj, defaultCSVOptions(true))
+	}
+	return nil, fmt.Errorf("unknown output format %q (use json, yaml or csv)", format)
+}
+
+// objectToDebugString converts an object to its debug string representation
+// for toDebug(), log() and logLine()
+func objectToDebugString(obj Object) string {
+	return Pretty(obj, DefaultPrettyOptions)
 }
 
 // evalConcatExpression handles the ++ operator for array concatenation
@@ -9391,9 +9951,24 @@ func evalIndexExpression(tok lexer.Token, left, index Object) Object {
 		}
 	}
 
+	// Match objects index like the array [match, ...captures]
+	if dict, ok := left.(*Dictionary); ok && isMatchDict(dict) && index.Type() == INTEGER_OBJ {
+		left = matchElements(dict)
+	}
+
+	// Datetimes, durations, paths and URLs index by field name
+	if v, ok := left.(fieldValue); ok && index.Type() == STRING_OBJ {
+		if val, ok := v.field(index.(*String).Value); ok {
+			return val
+		}
+		return NULL
+	}
+
 	switch {
 	case left.Type() == ARRAY_OBJ && index.Type() == INTEGER_OBJ:
 		return evalArrayIndexExpression(tok, left, index)
+	case left.Type() == RANGE_OBJ && index.Type() == INTEGER_OBJ:
+		return evalRangeIndexExpression(tok, left.(*Range), index.(*Integer))
 	case left.Type() == STRING_OBJ && index.Type() == INTEGER_OBJ:
 		return evalStringIndexExpression(tok, left, index)
 	case left.Type() == DICTIONARY_OBJ && index.Type() == STRING_OBJ:
@@ -9444,6 +10019,8 @@ func evalSliceExpression(left, start, end Object) Object {
 	switch left.Type() {
 	case ARRAY_OBJ:
 		return evalArraySliceExpression(left, start, end)
+	case RANGE_OBJ:
+		return evalRangeSliceExpression(left.(*Range), start, end)
 	case STRING_OBJ:
 		return evalStringSliceExpression(left, start, end)
 	default:
@@ -9454,8 +10031,18 @@ func evalSliceExpression(left, start, end Object) Object {
 // evalArraySliceExpression handles array slicing
 func evalArraySliceExpression(array, start, end Object) Object {
 	arrayObject := array.(*Array)
-	max := int64(len(arrayObject.Elements))
+	startIdx, endIdx, errObj := sliceBounds(int64(len(arrayObject.Elements)), start, end)
+	if errObj != nil {
+		return errObj
+	}
+
+	// Create the slice
+	return &Array{Elements: arrayObject.Elements[startIdx:endIdx]}
+}
 
+// sliceBounds works out the start and end of a slice of max elements,
+// counting negative indexes from the end and clamping to the length
+func sliceBounds(max int64, start, end Object) (int64, int64, *Error) {
 	var startIdx, endIdx int64
 
 	// Determine start index
@@ -9467,7 +10054,7 @@ func evalArraySliceExpression(array, start, end Object) Object {
 			startIdx = max + startIdx
 		}
 	} else {
-		return newError("slice start index must be an integer, got %s", start.Type())
+		return 0, 0, newError("slice start index must be an integer, got %s", start.Type())
 	}
 
 	// Determine end index
@@ -9479,18 +10066,18 @@ func evalArraySliceExpression(array, start, end Object) Object {
 			endIdx = max + endIdx
 		}
 	} else {
-		return newError("slice end index must be an integer, got %s", end.Type())
+		return 0, 0, newError("slice end index must be an integer, got %s", end.Type())
 	}
 
 	// Validate and clamp indices
 	if startIdx < 0 {
-		return newError("slice start index out of range: %d", startIdx)
+		return 0, 0, newError("slice start index out of range: %d", start.(*Integer).Value)
 	}
 	if endIdx < 0 {
-		return newError("slice end index out of range: %d", endIdx)
+		return 0, 0, newError("slice end index out of range: %d", end.(*Integer).Value)
 	}
 	if startIdx > endIdx {
-		return newError("slice start index %d is greater than end index %d", startIdx, endIdx)
+		return 0, 0, newError("slice start index %d is greater than end index %d", startIdx, endIdx)
 	}
 
 	// Clamp to array bounds (allow slicing beyond length)
@@ -9501,8 +10088,7 @@ func evalArraySliceExpression(array, start, end Object) Object {
 		endIdx = max
 	}
 
-	// Create the slice
-	return &Array{Elements: arrayObject.Elements[startIdx:endIdx]}
+	return startIdx, endIdx, nil
 }
 
 // evalStringSliceExpression handles string slicing
@@ -9609,7 +10195,33 @@ func evalDotExpression(node *ast.DotExpression, env *Environment) Object {
 		return newErrorWithPos(node.Token, "unknown property for SFTP file handle: %s", node.Key)
 	}
 
-	// Handle Dictionary (including special types like datetime, path, url)
+	// Database connections have read-only properties
+	if conn, ok := left.(*DBConnection); ok {
+		switch node.Key {
+		case "type":
+			return &String{Value: conn.Driver}
+		case "connected":
+			return nativeBoolToParsBoolean(conn.DB.Ping() == nil)
+		case "inTransaction":
+			return nativeBoolToParsBoolean(conn.InTransaction)
+		case "lastError":
+			return &String{Value: conn.LastError}
+		}
+		return newErrorWithPos(node.Token, "unknown property for database connection: %s", node.Key)
+	}
+
+	// Datetimes, durations, paths and URLs have fields and computed properties
+	if v, ok := left.(fieldValue); ok {
+		if val := evalFieldValueProperty(v, node.Key, env); val != nil {
+			return val
+		}
+		if env.isStrict() {
+			return missingKeyError(node.Token, node.Key)
+		}
+		return NULL
+	}
+
+	// Handle Dictionary (including special types like file, dir, regex)
 	dict, ok := left.(*Dictionary)
 	if !ok {
 		return newErrorWithPos(node.Token, "dot notation can only be used on dictionaries, got %s", left.Type())
@@ -9642,16 +10254,6 @@ func evalDotExpression(node *ast.DotExpression, env *Environment) Object {
 	}
 
 	// Check for computed properties on special dictionary types
-	if isPathDict(dict) {
-		if computed := evalPathComputedProperty(dict, node.Key, env); computed != nil {
-			return computed
-		}
-	}
-	if isUrlDict(dict) {
-		if computed := evalUrlComputedProperty(dict, node.Key, env); computed != nil {
-			return computed
-		}
-	}
 	if isFileDict(dict) {
 		if computed := evalFileComputedProperty(dict, node.Key, env); computed != nil {
 			return computed
@@ -9662,15 +10264,16 @@ func evalDotExpression(node *ast.DotExpression, env *Environment) Object {
 			return computed
 		}
 	}
-	if isDatetimeDict(dict) {
-		if computed := evalDatetimeComputedProperty(dict, node.Key, env); computed != nil {
-			return computed
-		}
-	}
 
 	// Get the expression from the dictionary
 	expr, ok := dict.Pairs[node.Key]
 	if !ok {
+		if isEnvDict(dict) {
+			return newErrorWithPos(node.Token, "environment variable %s is not set or not exposed to the script (use --env=%s)", node.Key, node.Key)
+		}
+		if env.isStrict() {
+			return missingKeyError(node.Token, node.Key)
+		}
 		return NULL
 	}
 
@@ -9788,7 +10391,7 @@ func evalFetchStatement(node *ast.FetchStatement, env *Environment) Object {
 	if isError(source) {
 		if useErrorCapture {
 			return evalDictDestructuringAssignment(node.DictPattern,
-				makeFetchResponseDict(NULL, source.(*Error).Message, 0, nil, env), env, node.IsLet, false)
+				makeFetchResponseDict(NULL, source.(*Error).Message, 0, nil, 0, env), env, node.IsLet, false)
 		}
 		return source
 	}
@@ -9823,12 +10426,16 @@ func evalFetchStatement(node *ast.FetchStatement, env *Environment) Object {
 		return content
 	}
 
-	// The source should be a request dictionary (from JSON(@url), etc.) or a URL dictionary
+	// The source should be a request dictionary (from JSON(@url), etc.) or a URL
+	if u, ok := source.(*Url); ok {
+		// Wrap URL in a request dictionary with default format (text)
+		source = urlToRequestDict(u, "text", nil, env)
+	}
 	sourceDict, ok := source.(*Dictionary)
 	if !ok {
 		if useErrorCapture {
 			return evalDictDestructuringAssignment(node.DictPattern,
-				makeFetchResponseDict(NULL, fmt.Sprintf("fetch operator <=/= requires a request or URL handle, got %s", source.Type()), 0, nil, env), env, node.IsLet, false)
+				makeFetchResponseDict(NULL, fmt.Sprintf("fetch operator <=/= requires a request or URL handle, got %s", source.Type()), 0, nil, 0, env), env, node.IsLet, false)
 		}
 		return newError("fetch operator <=/= requires a request or URL handle, got %s", source.Type())
 	}
@@ -9837,13 +10444,10 @@ func evalFetchStatement(node *ast.FetchStatement, env *Environment) Object {
 
 	if isRequestDict(sourceDict) {
 		reqDict = sourceDict
-	} else if isUrlDict(sourceDict) {
-		// Wrap URL in a request dictionary with default format (text)
-		reqDict = urlToRequestDict(sourceDict, "text", nil, env)
 	} else {
 		if useErrorCapture {
 			return evalDictDestructuringAssignment(node.DictPattern,
-				makeFetchResponseDict(NULL, "fetch operator <=/= requires a request or URL handle, got dictionary", 0, nil, env), env, node.IsLet, false)
+				makeFetchResponseDict(NULL, "fetch operator <=/= requires a request or URL handle, got dictionary", 0, nil, 0, env), env, node.IsLet, false)
 		}
 		return newError("fetch operator <=/= requires a request or URL handle, got dictionary")
 	}
@@ -9855,7 +10459,7 @@ func evalFetchStatement(node *ast.FetchStatement, env *Environment) Object {
 	if info.Error != "" {
 		if useErrorCapture {
 			return evalDictDestructuringAssignment(node.DictPattern,
-				makeFetchResponseDict(NULL, info.Error, info.StatusCode, info.Headers, env), env, node.IsLet, false)
+				makeFetchResponseDict(NULL, info.Error, info.StatusCode, info.Headers, info.Attempts, env), env, node.IsLet, false)
 		}
 		return newError("%s", info.Error)
 	}
@@ -9870,6 +10474,7 @@ func evalFetchStatement(node *ast.FetchStatement, env *Environment) Object {
 		info.FinalURL,
 		info.Headers,
 		"",
+		info.Attempts,
 		env,
 	)
 
@@ -9878,7 +10483,7 @@ func evalFetchStatement(node *ast.FetchStatement, env *Environment) Object {
 		if useErrorCapture {
 			// Wrap successful result in {data: ..., error: null, status: ..., headers: ...} format
 			return evalDictDestructuringAssignment(node.DictPattern,
-				makeFetchResponseDict(info.Content, "", info.StatusCode, info.Headers, env), env, node.IsLet, false)
+				makeFetchResponseDict(info.Content, "", info.StatusCode, info.Headers, info.Attempts, env), env, node.IsLet, false)
 		}
 		// Normal dict destructuring - extract keys directly from __data
 		return evalDictDestructuringAssignment(node.DictPattern, info.Content, env, node.IsLet, false)
@@ -9942,17 +10547,8 @@ func setRequestMethod(dict *Dictionary, method string, env *Environment) *Dictio
 	return &Dictionary{Pairs: pairs, Env: env}
 }
 
-// parseURLToDict parses a URL string into a URL dictionary, returning nil on error
-func parseURLToDict(urlStr string, env *Environment) *Dictionary {
-	dict, err := parseUrlString(urlStr, env)
-	if err != nil {
-		return nil
-	}
-	return dict
-}
-
-// urlToRequestDict wraps a URL dictionary in a request dictionary
-func urlToRequestDict(urlDict *Dictionary, format string, options *Dictionary, env *Environment) *Dictionary {
+// urlToRequestDict wraps a URL in a request dictionary
+func urlToRequestDict(u *Url, format string, options *Dictionary, env *Environment) *Dictionary {
 	pairs := make(map[string]ast.Expression)
 
 	pairs["__type"] = &ast.StringLiteral{
@@ -9960,10 +10556,8 @@ func urlToRequestDict(urlDict *Dictionary, format string, options *Dictionary, e
 		Value: "request",
 	}
 
-	// Copy URL fields
-	for key, expr := range urlDict.Pairs {
-		pairs["_url_"+key] = expr
-	}
+	// Add the URL
+	pairs["_url"] = &ast.ObjectLiteralExpression{Obj: u}
 
 	pairs["method"] = &ast.StringLiteral{
 		Token: lexer.Token{Type: lexer.STRING, Literal: "GET"},
@@ -9984,8 +10578,8 @@ func urlToRequestDict(urlDict *Dictionary, format string, options *Dictionary, e
 	return &Dictionary{Pairs: pairs, Env: env}
 }
 
-// requestToDict creates a request dictionary from a URL dictionary with format and options
-func requestToDict(urlDict *Dictionary, format string, options *Dictionary, env *Environment) *Dictionary {
+// requestToDict creates a request dictionary from a URL with format and options
+func requestToDict(u *Url, format string, options *Dictionary, env *Environment) *Dictionary {
 	pairs := make(map[string]ast.Expression)
 
 	pairs["__type"] = &ast.StringLiteral{
@@ -9993,10 +10587,8 @@ func requestToDict(urlDict *Dictionary, format string, options *Dictionary, env
 		Value: "request",
 	}
 
-	// Copy URL fields with prefix
-	for key, expr := range urlDict.Pairs {
-		pairs["_url_"+key] = expr
-	}
+	// Add the URL
+	pairs["_url"] = &ast.ObjectLiteralExpression{Obj: u}
 
 	pairs["format"] = &ast.StringLiteral{
 		Token: lexer.Token{Type: lexer.STRING, Literal: format},
@@ -10032,9 +10624,17 @@ func requestToDict(urlDict *Dictionary, format string, options *Dictionary, env
 		if bodyExpr, ok := options.Pairs["body"]; ok {
 			pairs["body"] = bodyExpr
 		}
-		// Copy timeout from options
-		if timeoutExpr, ok := options.Pairs["timeout"]; ok {
-			pairs["timeout"] = timeoutExpr
+		// Copy timeout and retry settings from options
+		for _, key := range []string{"timeout", "retries", "backoff"} {
+			if expr, ok := options.Pairs[key]; ok {
+				pairs[key] = expr
+			}
+		}
+		// Copy proxy and TLS settings from options
+		for _, key := range transportOptions {
+			if expr, ok := options.Pairs[key]; ok {
+				pairs[key] = expr
+			}
 		}
 	} else {
 		pairs["headers"] = &ast.DictionaryLiteral{
@@ -10048,7 +10648,7 @@ func requestToDict(urlDict *Dictionary, format string, options *Dictionary, env
 
 // makeResponseTypedDict creates a response typed dictionary with __type, __format, __data, __response
 // This is the new response structure that auto-unwraps for iteration/indexing
-func makeResponseTypedDict(data Object, format string, statusCode int64, statusText string, ok bool, urlStr string, headers *Dictionary, errorMsg string, env *Environment) *Dictionary {
+func makeResponseTypedDict(data Object, format string, statusCode int64, statusText string, ok bool, urlStr string, headers *Dictionary, errorMsg string, attempts int64, env *Environment) *Dictionary {
 	pairs := make(map[string]ast.Expression)
 
 	// Set __type
@@ -10085,11 +10685,16 @@ func makeResponseTypedDict(data Object, format string, statusCode int64, statusT
 
 	responsePairs["ok"] = &ast.ObjectLiteralExpression{Obj: &Boolean{Value: ok}}
 
-	// URL as a URL dictionary
+	// Requests sent, including retries
+	responsePairs["attempts"] = &ast.IntegerLiteral{
+		Token: lexer.Token{Type: lexer.INT, Literal: fmt.Sprintf("%d", attempts)},
+		Value: attempts,
+	}
+
+	// URL as a URL value
 	if urlStr != "" {
-		urlDict := parseURLToDict(urlStr, env)
-		if urlDict != nil {
-			responsePairs["url"] = &ast.ObjectLiteralExpression{Obj: urlDict}
+		if u, err := parseUrlString(urlStr); err == nil {
+			responsePairs["url"] = &ast.ObjectLiteralExpression{Obj: u}
 		} else {
 			responsePairs["url"] = &ast.StringLiteral{
 				Token: lexer.Token{Type: lexer.STRING, Literal: urlStr},
@@ -10128,9 +10733,9 @@ func makeResponseTypedDict(data Object, format string, statusCode int64, statusT
 	return &Dictionary{Pairs: pairs, Env: env}
 }
 
-// makeFetchResponseDict creates a {data: ..., error: ..., status: ..., headers: ...} dictionary
+// makeFetchResponseDict creates a {data: ..., error: ..., status: ..., headers: ..., attempts: ...} dictionary
 // This is the legacy format for error capture pattern
-func makeFetchResponseDict(data Object, errorMsg string, status int64, headers *Dictionary, env *Environment) *Dictionary {
+func makeFetchResponseDict(data Object, errorMsg string, status int64, headers *Dictionary, attempts int64, env *Environment) *Dictionary {
 	pairs := make(map[string]ast.Expression)
 
 	// Set data field
@@ -10159,86 +10764,31 @@ func makeFetchResponseDict(data Object, errorMsg string, status int64, headers *
 		}
 	}
 
+	// Set attempts field
+	pairs["attempts"] = &ast.IntegerLiteral{
+		Token: lexer.Token{Type: lexer.INT, Literal: fmt.Sprintf("%d", attempts)},
+		Value: attempts,
+	}
+
 	return &Dictionary{Pairs: pairs, Env: env}
 }
 
 // getRequestUrlString extracts the URL string from a request dictionary
 func getRequestUrlString(dict *Dictionary, env *Environment) string {
-	var result strings.Builder
-
-	// Get scheme
-	schemeExpr, ok := dict.Pairs["_url_scheme"]
-	if !ok {
-		return ""
-	}
-	schemeObj := Eval(schemeExpr, env)
-	schemeStr, ok := schemeObj.(*String)
-	if !ok {
-		return ""
-	}
-	result.WriteString(schemeStr.Value)
-	result.WriteString("://")
-
-	// Get host
-	hostExpr, ok := dict.Pairs["_url_host"]
-	if !ok {
-		return ""
-	}
-	hostObj := Eval(hostExpr, env)
-	hostStr, ok := hostObj.(*String)
-	if !ok {
-		return ""
-	}
-	result.WriteString(hostStr.Value)
-
-	// Get port (if non-zero)
-	if portExpr, ok := dict.Pairs["_url_port"]; ok {
-		portObj := Eval(portExpr, env)
-		if portInt, ok := portObj.(*Integer); ok && portInt.Value != 0 {
-			result.WriteString(fmt.Sprintf(":%d", portInt.Value))
-		}
-	}
-
-	// Get path
-	if pathExpr, ok := dict.Pairs["_url_path"]; ok {
-		pathObj := Eval(pathExpr, env)
-		if pathArr, ok := pathObj.(*Array); ok {
-			for _, elem := range pathArr.Elements {
-				result.WriteString("/")
-				if str, ok := elem.(*String); ok {
-					result.WriteString(str.Value)
-				}
-			}
-		}
+	if u := requestUrl(dict); u != nil {
+		return u.requestString()
 	}
+	return ""
+}
 
-	// Get query
-	if queryExpr, ok := dict.Pairs["_url_query"]; ok {
-		queryObj := Eval(queryExpr, env)
-		if queryDict, ok := queryObj.(*Dictionary); ok && len(queryDict.Pairs) > 0 {
-			result.WriteString("?")
-			first := true
-			for key, valExpr := range queryDict.Pairs {
-				if !first {
-					result.WriteString("&")
-				}
-				first = false
-				valObj := Eval(valExpr, env)
-				result.WriteString(key)
-				result.WriteString("=")
-				switch v := valObj.(type) {
-				case *String:
-					result.WriteString(v.Value)
-				case *Integer:
-					result.WriteString(fmt.Sprintf("%d", v.Value))
-				default:
-					result.WriteString(valObj.Inspect())
-				}
-			}
+// requestUrl returns the URL of a request dictionary, or nil
+func requestUrl(dict *Dictionary) *Url {
+	if expr, ok := dict.Pairs["_url"].(*ast.ObjectLiteralExpression); ok {
+		if u, ok := expr.Obj.(*Url); ok {
+			return u
 		}
 	}
-
-	return result.String()
+	return nil
 }
 
 // HTTPResponseInfo holds all information about an HTTP response
@@ -10251,6 +10801,7 @@ type HTTPResponseInfo struct {
 	Headers    *Dictionary
 	Format     string
 	Error      string
+	Attempts   int64 // requests sent, including retries
 }
 
 // fetchUrlContentFull fetches content from a URL and returns full response info
@@ -10284,13 +10835,16 @@ func fetchUrlContentFull(reqDict *Dictionary, env *Environment) *HTTPResponseInf
 	}
 	info.Format = format
 
-	// Get timeout (default 30 seconds)
-	timeout := 30 * time.Second
-	if timeoutExpr, ok := reqDict.Pairs["timeout"]; ok {
-		timeoutObj := Eval(timeoutExpr, env)
-		if timeoutInt, ok := timeoutObj.(*Integer); ok {
-			timeout = time.Duration(timeoutInt.Value) * time.Millisecond
-		}
+	// Get timeout and retries
+	timeout, err := requestTimeout(reqDict, env)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	retries, err := requestRetries(reqDict, env)
+	if err != nil {
+		info.Error = err.Error()
+		return info
 	}
 
 	// Prepare request body
@@ -10314,9 +10868,18 @@ func fetchUrlContentFull(reqDict *Dictionary, env *Environment) *HTTPResponseInf
 		}
 	}
 
+	if env.dryRunRequest(method, urlStr) {
+		info.StatusCode, info.StatusText, info.OK = http.StatusNoContent, "204 No Content", true
+		info.Content = NULL
+		info.Headers = &Dictionary{Pairs: map[string]ast.Expression{}, Env: env}
+		return info
+	}
+
 	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: timeout,
+	client, err := httpClient(reqDict, timeout, env)
+	if err != nil {
+		info.Error = err.Error()
+		return info
 	}
 
 	// Create request
@@ -10345,8 +10908,11 @@ func fetchUrlContentFull(reqDict *Dictionary, env *Environment) *HTTPResponseInf
 	}
 
 	// Execute request
-	resp, err := client.Do(req)
+	start := time.Now()
+	resp, attempts, err := sendWithRetries(client, req, retries)
+	info.Attempts = int64(attempts)
 	if err != nil {
+		recordHTTPRequest(start, 0)
 		info.Error = fmt.Sprintf("fetch failed: %s", err.Error())
 		return info
 	}
@@ -10360,6 +10926,7 @@ func fetchUrlContentFull(reqDict *Dictionary, env *Environment) *HTTPResponseInf
 
 	// Read response body
 	data, err := io.ReadAll(resp.Body)
+	recordHTTPRequest(start, len(data))
 	if err != nil {
 		info.Error = fmt.Sprintf("failed to read response: %s", err.Error())
 		return info
@@ -10399,6 +10966,20 @@ func fetchUrlContentFull(reqDict *Dictionary, env *Environment) *HTTPResponseInf
 			return info
 		}
 
+	case "xml":
+		content, parseErr = parseXML(data, defaultXMLOptions())
+		if parseErr != nil {
+			info.Error = parseErr.Message
+			return info
+		}
+
+	case "toml":
+		content, parseErr = parseTOML(string(data))
+		if parseErr != nil {
+			info.Error = parseErr.Message
+			return info
+		}
+
 	case "lines":
 		lines := strings.Split(string(data), "\n")
 		elements := make([]Object, len(lines))
@@ -10479,9 +11060,14 @@ func fetchUrlContent(reqDict *Dictionary, env *Environment) (Object, int64, *Dic
 		}
 	}
 
+	if env.dryRunRequest(method, urlStr) {
+		return NULL, http.StatusNoContent, &Dictionary{Pairs: map[string]ast.Expression{}, Env: env}, nil
+	}
+
 	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: timeout,
+	client, err := httpClient(reqDict, timeout, env)
+	if err != nil {
+		return nil, 0, nil, newError("%s", err.Error())
 	}
 
 	// Create request
@@ -10509,14 +11095,17 @@ func fetchUrlContent(reqDict *Dictionary, env *Environment) (Object, int64, *Dic
 	}
 
 	// Execute request
-	resp, err := client.Do(req)
+	start := time.Now()
+	resp, err := sendRequest(client, req)
 	if err != nil {
+		recordHTTPRequest(start, 0)
 		return nil, 0, nil, newError("fetch failed: %s", err.Error())
 	}
 	defer resp.Body.Close()
 
 	// Read response body
 	data, err := io.ReadAll(resp.Body)
+	recordHTTPRequest(start, len(data))
 	if err != nil {
 		return nil, int64(resp.StatusCode), nil, newError("failed to read response: %s", err.Error())
 	}
@@ -10552,6 +11141,18 @@ func fetchUrlContent(reqDict *Dictionary, env *Environment) (Object, int64, *Dic
 			return nil, int64(resp.StatusCode), respHeaders, parseErr
 		}
 
+	case "xml":
+		content, parseErr = parseXML(data, defaultXMLOptions())
+		if parseErr != nil {
+			return nil, int64(resp.StatusCode), respHeaders, parseErr
+		}
+
+	case "toml":
+		content, parseErr = parseTOML(string(data))
+		if parseErr != nil {
+			return nil, int64(resp.StatusCode), respHeaders, parseErr
+		}
+
 	case "lines":
 		lines := strings.Split(string(data), "\n")
 		elements := make([]Object, len(lines))
@@ -10649,11 +11250,16 @@ func readFileContent(fileDict *Dictionary, env *Environment) (Object, *Error) {
 			return nil, newError("security: %s", err.Error())
 		}
 
-		// Read the raw file content
-		var readErr error
-		data, readErr = os.ReadFile(pathStr)
-		if readErr != nil {
-			return nil, newError("failed to read file '%s': %s", pathStr, readErr.Error())
+		// Read the raw file content, unless a test has mocked it
+		if mocked, ok := mockedFile(pathStr); ok {
+			data = mocked
+		} else {
+			var readErr error
+			data, readErr = os.ReadFile(pathStr)
+			if readErr != nil {
+				return nil, newError("failed to read file '%s': %s", pathStr, readErr.Error())
+			}
+			recordFileRead(len(data))
 		}
 	}
 
@@ -10671,6 +11277,28 @@ func readFileContent(fileDict *Dictionary, env *Environment) (Object, *Error) {
 		return nil, newError("file format must be a string, got %s", formatObj.Type())
 	}
 
+	// Convert text in other encodings to UTF-8 (bytes are returned as-is)
+	if formatStr.Value != "bytes" {
+		enc, encErr := fileTextEncoding(fileDict, env)
+		if encErr != nil {
+			return nil, encErr
+		}
+		if enc != nil {
+			decoded, err := enc.NewDecoder().Bytes(data)
+			if err != nil {
+				return nil, newError("failed to decode '%s': %s", pathStr, err.Error())
+			}
+			data = decoded
+		}
+
+		// Strip a UTF-8 BOM and normalize line endings if requested
+		var optErr *Error
+		data, optErr = applyTextReadOptions(fileDict, data, env)
+		if optErr != nil {
+			return nil, optErr
+		}
+	}
+
 	// Decode based on format
 	switch formatStr.Value {
 	case "text":
@@ -10682,67 +11310,342 @@ func readFileContent(fileDict *Dictionary, env *Environment) (Object, *Error) {
 		for i, b := range data {
 			elements[i] = &Integer{Value: int64(b)}
 		}
-		return &Array{Elements: elements}, nil
-
-	case "lines":
-		// Split into lines
-		content := string(data)
-		lines := strings.Split(content, "\n")
-		elements := make([]Object, len(lines))
-		for i, line := range lines {
-			elements[i] = &String{Value: line}
+		return &Array{Elements: elements}, nil
+
+	case "lines":
+		// Split into lines
+		content := string(data)
+		lines := strings.Split(content, "\n")
+		elements := make([]Object, len(lines))
+		for i, line := range lines {
+			elements[i] = &String{Value: line}
+		}
+		return &Array{Elements: elements}, nil
+
+	case "json":
+		// Parse JSON
+		content := string(data)
+		obj, err := parseJSON(content)
+		if err == nil && fileOptionEnabled(fileDict, "revive", env) {
+			obj = reviveTypedValues(obj)
+		}
+		return obj, err
+
+	case "yaml":
+		// Parse YAML
+		content := string(data)
+		obj, err := parseYAML(content)
+		if err == nil && fileOptionEnabled(fileDict, "revive", env) {
+			obj = reviveTypedValues(obj)
+		}
+		return obj, err
+
+	case "xml":
+		opts, optErr := parseXMLOptions(fileOptions(fileDict, env))
+		if optErr != nil {
+			return nil, optErr
+		}
+		return parseXML(data, opts)
+
+	case "toml":
+		return parseTOML(string(data))
+
+	case "csv", "csv-noheader":
+		// Parse CSV (with a header row unless disabled)
+		opts := defaultCSVOptions(formatStr.Value == "csv")
+		if fileOpts := fileOptions(fileDict, env); fileOpts != nil {
+			var optErr *Error
+			opts, optErr = parseCSVOptions(fileOpts, opts)
+			if optErr != nil {
+				return nil, optErr
+			}
+		}
+		return parseCSV(data, opts)
+
+	case "svg":
+		// Return SVG content with XML prolog stripped
+		content := string(data)
+		return &String{Value: stripXMLProlog(content)}, nil
+
+	case "md", "markdown":
+		// Parse markdown with optional YAML frontmatter
+		content := string(data)
+		return parseMarkdown(content, env)
+
+	default:
+		return nil, newError("unsupported file format: %s", formatStr.Value)
+	}
+}
+
+// parseJSON parses a JSON string into Parsley objects
+func parseJSON(content string) (Object, *Error) {
+	var data interface{}
+	if err := json.Unmarshal([]byte(content), &data); err != nil {
+		return nil, newError("failed to parse JSON: %s", err.Error())
+	}
+	return jsonToObject(data), nil
+}
+
+// parseYAML parses a YAML string into Parsley objects. Anchors, aliases and
+// merge keys (<<) are resolved. A stream of several documents (separated by
+// ---) becomes an array with one element per document.
+func parseYAML(content string) (Object, *Error) {
+	decoder := yaml.NewDecoder(strings.NewReader(content))
+	var docs []Object
+	for {
+		var data interface{}
+		err := decoder.Decode(&data)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, newError("failed to parse YAML: %s", err.Error())
+		}
+		docs = append(docs, yamlToObject(data))
+	}
+
+	switch len(docs) {
+	case 0:
+		return NULL, nil
+	case 1:
+		return docs[0], nil
+	default:
+		return &Array{Elements: docs}, nil
+	}
+}
+
+// defaultYAMLIndent is the number of spaces used to indent YAML output
+const defaultYAMLIndent = 4
+
+// parseYAMLIndent validates an `indent` option for YAML output
+func parseYAMLIndent(val Object) (int, *Error) {
+	n, ok := val.(*Integer)
+	if !ok || n.Value < 2 || n.Value > 9 {
+		return 0, newError("`indent` option for YAML must be an integer between 2 and 9")
+	}
+	return int(n.Value), nil
+}
+
+// fileOptionEnabled reports whether a boolean option was set to true when the file handle was created
+func fileOptionEnabled(fileDict *Dictionary, name string, env *Environment) bool {
+	b, ok := fileOption(fileDict, name, env).(*Boolean)
+	return ok && b.Value
+}
+
+// fileOptionString returns a string option given when the file handle was created, or ""
+func fileOptionString(fileDict *Dictionary, name string, env *Environment) string {
+	str, ok := fileOption(fileDict, name, env).(*String)
+	if !ok {
+		return ""
+	}
+	return str.Value
+}
+
+// fileOptions returns the options dictionary given when the file handle was created, or nil
+func fileOptions(fileDict *Dictionary, env *Environment) *Dictionary {
+	optsExpr, ok := fileDict.Pairs["options"]
+	if !ok {
+		return nil
+	}
+	opts, ok := Eval(optsExpr, env).(*Dictionary)
+	if !ok {
+		return nil
+	}
+	return opts
+}
+
+// fileOption returns an option given when the file handle was created, or nil
+func fileOption(fileDict *Dictionary, name string, env *Environment) Object {
+	opts := fileOptions(fileDict, env)
+	if opts == nil {
+		return nil
+	}
+	valExpr, ok := opts.Pairs[name]
+	if !ok {
+		return nil
+	}
+	return Eval(valExpr, opts.Env)
+}
+
+// fileTextEncoding returns the text encoding named by a file handle's encoding option.
+// It returns nil for UTF-8 (the default), which needs no conversion.
+func fileTextEncoding(fileDict *Dictionary, env *Environment) (encoding.Encoding, *Error) {
+	opt := fileOption(fileDict, "encoding", env)
+	if opt == nil {
+		return nil, nil
+	}
+	name, ok := opt.(*String)
+	if !ok {
+		return nil, newError("`encoding` option must be a string, got %s", opt.Type())
+	}
+	enc, err := lookupTextEncoding(name.Value)
+	if err != nil {
+		return nil, newError("%s", err.Error())
+	}
+	return enc, nil
+}
+
+// utf8BOM is the byte order mark some editors (and Excel) put at the start of UTF-8 files
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// applyTextReadOptions applies the stripBOM and newline options to UTF-8 text read from a file
+func applyTextReadOptions(fileDict *Dictionary, data []byte, env *Environment) ([]byte, *Error) {
+	if opt := fileOption(fileDict, "stripBOM", env); opt != nil {
+		strip, ok := opt.(*Boolean)
+		if !ok {
+			return nil, newError("`stripBOM` option must be a boolean, got %s", opt.Type())
+		}
+		if strip.Value {
+			data = bytes.TrimPrefix(data, utf8BOM)
+		}
+	}
+	return convertNewlines(fileDict, data, env)
+}
+
+// applyTextWriteOptions applies the newline and bom options to UTF-8 text before it is written
+func applyTextWriteOptions(fileDict *Dictionary, data []byte, addBOM bool, env *Environment) ([]byte, *Error) {
+	data, err := convertNewlines(fileDict, data, env)
+	if err != nil {
+		return nil, err
+	}
+	if opt := fileOption(fileDict, "bom", env); opt != nil {
+		bom, ok := opt.(*Boolean)
+		if !ok {
+			return nil, newError("`bom` option must be a boolean, got %s", opt.Type())
+		}
+		if bom.Value && addBOM && !bytes.HasPrefix(data, utf8BOM) {
+			data = append(append([]byte{}, utf8BOM...), data...)
 		}
-		return &Array{Elements: elements}, nil
+	}
+	return data, nil
+}
 
-	case "json":
-		// Parse JSON
-		content := string(data)
-		return parseJSON(content)
+// convertNewlines rewrites all line endings (CRLF, CR or LF) to the one named by the newline option
+func convertNewlines(fileDict *Dictionary, data []byte, env *Environment) ([]byte, *Error) {
+	opt := fileOption(fileDict, "newline", env)
+	if opt == nil {
+		return data, nil
+	}
+	name, ok := opt.(*String)
+	if !ok {
+		return nil, newError("`newline` option must be a string, got %s", opt.Type())
+	}
 
-	case "yaml":
-		// Parse YAML
-		content := string(data)
-		return parseYAML(content)
+	var newline []byte
+	switch strings.ToLower(name.Value) {
+	case "lf":
+		newline = []byte("\n")
+	case "crlf":
+		newline = []byte("\r\n")
+	default:
+		return nil, newError("`newline` option must be \"lf\" or \"crlf\", got %q", name.Value)
+	}
 
-	case "csv":
-		// Parse CSV with header
-		return parseCSV(data, true)
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	data = bytes.ReplaceAll(data, []byte("\r"), []byte("\n"))
+	if newline[0] == '\r' {
+		data = bytes.ReplaceAll(data, []byte("\n"), newline)
+	}
+	return data, nil
+}
 
-	case "csv-noheader":
-		// Parse CSV without header
-		return parseCSV(data, false)
+// fileIsEmpty reports whether a file is missing or has no content
+func fileIsEmpty(path string) bool {
+	info, err := os.Stat(path)
+	return err != nil || info.Size() == 0
+}
 
-	case "svg":
-		// Return SVG content with XML prolog stripped
-		content := string(data)
-		return &String{Value: stripXMLProlog(content)}, nil
+// textEncodings maps common encoding names to encodings. Names not listed here
+// are looked up as WHATWG labels (e.g., "euc-kr", "gbk", "iso-8859-15").
+var textEncodings = map[string]encoding.Encoding{
+	"latin1":       charmap.ISO8859_1,
+	"latin-1":      charmap.ISO8859_1,
+	"iso-8859-1":   charmap.ISO8859_1,
+	"windows-1252": charmap.Windows1252,
+	"cp1252":       charmap.Windows1252,
+	"shift-jis":    japanese.ShiftJIS,
+	"shift_jis":    japanese.ShiftJIS,
+	"sjis":         japanese.ShiftJIS,
+	"utf-16":       textunicode.UTF16(textunicode.LittleEndian, textunicode.UseBOM),
+	"utf-16le":     textunicode.UTF16(textunicode.LittleEndian, textunicode.IgnoreBOM),
+	"utf-16be":     textunicode.UTF16(textunicode.BigEndian, textunicode.IgnoreBOM),
+}
 
-	case "md", "markdown":
-		// Parse markdown with optional YAML frontmatter
-		content := string(data)
-		return parseMarkdown(content, env)
+// lookupTextEncoding finds an encoding by name; UTF-8 returns nil
+func lookupTextEncoding(name string) (encoding.Encoding, error) {
+	key := strings.ToLower(strings.TrimSpace(name))
+	if key == "utf-8" || key == "utf8" {
+		return nil, nil
+	}
+	if enc, ok := textEncodings[key]; ok {
+		return enc, nil
+	}
+	enc, err := htmlindex.Get(key)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported encoding: %s", name)
+	}
+	if enc == encoding.Nop || enc == textunicode.UTF8 {
+		return nil, nil
+	}
+	return enc, nil
+}
 
+// reviveTypedValues converts strings written by the JSON/YAML serializers back into
+// typed values: ISO 8601 dates and datetimes become datetimes, and ISO 8601
+// durations ("P1DT2H") become durations. Other strings are left unchanged.
+func reviveTypedValues(obj Object) Object {
+	switch v := obj.(type) {
+	case *String:
+		return reviveString(v)
+	case *Array:
+		elements := make([]Object, len(v.Elements))
+		for i, elem := range v.Elements {
+			elements[i] = reviveTypedValues(elem)
+		}
+		return &Array{Elements: elements}
+	case *Dictionary:
+		if _, ok := typedScalar(v); ok {
+			return v
+		}
+		pairs := make(map[string]ast.Expression, len(v.Pairs))
+		for key, expr := range v.Pairs {
+			pairs[key] = &ast.ObjectLiteralExpression{Obj: reviveTypedValues(Eval(expr, v.Env))}
+		}
+		return &Dictionary{Pairs: pairs, Env: v.Env}
 	default:
-		return nil, newError("unsupported file format: %s", formatStr.Value)
+		return obj
 	}
 }
 
-// parseJSON parses a JSON string into Parsley objects
-func parseJSON(content string) (Object, *Error) {
-	var data interface{}
-	if err := json.Unmarshal([]byte(content), &data); err != nil {
-		return nil, newError("failed to parse JSON: %s", err.Error())
+// reviveString converts a single ISO 8601 string to a datetime or duration if it is one
+func reviveString(str *String) Object {
+	s := str.Value
+
+	if len(s) == 10 {
+		if t, err := time.Parse("2006-01-02", s); err == nil {
+			return newDatetime(t, "date")
+		}
+	}
+	if len(s) > 10 && s[10] == 'T' {
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			return newDatetime(t, "datetime")
+		}
+		if t, err := time.Parse("2006-01-02T15:04:05", s); err == nil {
+			return newDatetime(t, "datetime")
+		}
 	}
-	return jsonToObject(data), nil
-}
 
-// parseYAML parses a YAML string into Parsley objects
-func parseYAML(content string) (Object, *Error) {
-	var data interface{}
-	if err := yaml.Unmarshal([]byte(content), &data); err != nil {
-		return nil, newError("failed to parse YAML: %s", err.Error())
+	// Only upper-case ISO durations are revived, so words starting with "p" are left alone
+	if body := strings.TrimPrefix(s, "-"); strings.HasPrefix(body, "P") {
+		if months, millis, err := parseISODuration(body); err == nil {
+			if body != s {
+				months, millis = -months, -millis
+			}
+			return newDuration(months, millis)
+		}
 	}
-	return yamlToObject(data), nil
+
+	return str
 }
 
 // parseMarkdown parses markdown content with optional YAML frontmatter
@@ -10809,12 +11712,18 @@ func yamlToObject(value interface{}) Object {
 		return &Float{Value: v}
 	case time.Time:
 		// YAML timestamps are parsed directly by yaml.v3
-		return timeToDatetimeDict(v, NewEnvironment())
+		return newDatetime(v, "datetime")
 	case string:
-		// Try to parse as date if it looks like ISO format
+		// Try to parse as date if it looks like ISO format, keeping the
+		// time and offset of a full datetime
+		if len(v) > 10 && v[10] == 'T' {
+			if t, err := time.Parse(time.RFC3339, v); err == nil {
+				return newDatetime(t, "datetime")
+			}
+		}
 		if len(v) >= 10 && v[4] == '-' && v[7] == '-' {
 			if t, err := time.Parse("2006-01-02", v[:10]); err == nil {
-				return timeToDatetimeDict(t, NewEnvironment())
+				return newDatetime(t, "datetime")
 			}
 		}
 		return &String{Value: v}
@@ -10831,6 +11740,14 @@ func yamlToObject(value interface{}) Object {
 			pairs[key] = &ast.ObjectLiteralExpression{Obj: obj}
 		}
 		return &Dictionary{Pairs: pairs, Env: NewEnvironment()}
+	case map[interface{}]interface{}:
+		// Mappings with non-string keys (e.g. 1: one) use the key's string form
+		pairs := make(map[string]ast.Expression)
+		for key, val := range v {
+			obj := yamlToObject(val)
+			pairs[fmt.Sprintf("%v", key)] = &ast.ObjectLiteralExpression{Obj: obj}
+		}
+		return &Dictionary{Pairs: pairs, Env: NewEnvironment()}
 	default:
 		// Handle other YAML types (like timestamps)
 		return &String{Value: fmt.Sprintf("%v", v)}
@@ -10916,45 +11833,236 @@ func stripXMLProlog(content string) string {
 	return strings.TrimSpace(result)
 }
 
-// parseCSV parses CSV data into an array of dictionaries (if header) or array of arrays
-func parseCSV(data []byte, hasHeader bool) (Object, *Error) {
-	reader := csv.NewReader(strings.NewReader(string(data)))
-	records, err := reader.ReadAll()
-	if err != nil {
-		return nil, newError("failed to parse CSV: %s", err.Error())
+// csvOptions holds the dialect and error-handling options for reading CSV
+type csvOptions struct {
+	header     bool
+	delimiter  rune
+	comment    rune
+	trim       bool
+	lazyQuotes bool
+	skipRows   int
+	ragged     string // "error", "pad" or "skip"
+	report     bool
+	columns    []string // Column order when writing
+}
+
+// defaultCSVOptions returns comma-separated, strict CSV options
+func defaultCSVOptions(header bool) csvOptions {
+	return csvOptions{header: header, delimiter: ',', ragged: "error"}
+}
+
+// parseCSVOptions reads CSV options from a dictionary on top of the given defaults
+func parseCSVOptions(dict *Dictionary, opts csvOptions) (csvOptions, *Error) {
+	for key, expr := range dict.Pairs {
+		val := Eval(expr, dict.Env)
+		switch key {
+		case "header", "trim", "lazyQuotes", "report":
+			b, ok := val.(*Boolean)
+			if !ok {
+				return opts, newError("CSV option `%s` must be a boolean, got %s", key, val.Type())
+			}
+			switch key {
+			case "header":
+				opts.header = b.Value
+			case "trim":
+				opts.trim = b.Value
+			case "lazyQuotes":
+				opts.lazyQuotes = b.Value
+			case "report":
+				opts.report = b.Value
+			}
+		case "delimiter", "comment":
+			str, ok := val.(*String)
+			if !ok || len([]rune(str.Value)) != 1 {
+				return opts, newError("CSV option `%s` must be a single character", key)
+			}
+			r := []rune(str.Value)[0]
+			if r == '"' || r == '\r' || r == '\n' {
+				return opts, newError("CSV option `%s` cannot be %q", key, str.Value)
+			}
+			if key == "delimiter" {
+				opts.delimiter = r
+			} else {
+				opts.comment = r
+			}
+		case "skipRows":
+			n, ok := val.(*Integer)
+			if !ok || n.Value < 0 {
+				return opts, newError("CSV option `skipRows` must be a non-negative integer")
+			}
+			opts.skipRows = int(n.Value)
+		case "ragged":
+			str, ok := val.(*String)
+			if !ok || (str.Value != "error" && str.Value != "pad" && str.Value != "skip") {
+				return opts, newError("CSV option `ragged` must be \"error\", \"pad\" or \"skip\"")
+			}
+			opts.ragged = str.Value
+		case "columns":
+			arr, ok := val.(*Array)
+			if !ok {
+				return opts, newError("CSV option `columns` must be an array of strings, got %s", val.Type())
+			}
+			opts.columns = make([]string, len(arr.Elements))
+			for i, elem := range arr.Elements {
+				str, ok := elem.(*String)
+				if !ok {
+					return opts, newError("CSV option `columns` must be an array of strings, got %s at index %d", elem.Type(), i)
+				}
+				opts.columns[i] = str.Value
+			}
+		}
+	}
+	if opts.comment != 0 && opts.comment == opts.delimiter {
+		return opts, newError("CSV options `comment` and `delimiter` must differ")
+	}
+	return opts, nil
+}
+
+// parseCSV parses CSV data into an array of dictionaries (with a header row)
+// or an array of arrays. Rows with a different number of fields from the first
+// row are handled according to opts.ragged. With opts.report, malformed rows are
+// skipped instead of failing and the result is {rows, errors}, where each error
+// is {line, message}.
+func parseCSV(data []byte, opts csvOptions) (Object, *Error) {
+	text := string(data)
+	for i := 0; i < opts.skipRows && text != ""; i++ {
+		if idx := strings.IndexByte(text, '\n'); idx >= 0 {
+			text = text[idx+1:]
+		} else {
+			text = ""
+		}
+	}
+
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.Comma = opts.delimiter
+	reader.Comment = opts.comment
+	reader.LazyQuotes = opts.lazyQuotes
+	reader.TrimLeadingSpace = opts.trim
+	reader.FieldsPerRecord = -1 // Ragged rows are handled below
+
+	var records [][]string
+	var problems []Object
+	addProblem := func(line int, message string) {
+		problems = append(problems, NewDictionaryFromObjects(map[string]Object{
+			"line":    &Integer{Value: int64(line)},
+			"message": &String{Value: message},
+		}))
+	}
+
+	width := -1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			line, message := 0, err.Error()
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				line, message = parseErr.StartLine+opts.skipRows, parseErr.Err.Error()
+			}
+			if !opts.report {
+				return nil, newError("failed to parse CSV: line %d: %s", line, message)
+			}
+			addProblem(line, message)
+			continue
+		}
+
+		line, _ := reader.FieldPos(0)
+		line += opts.skipRows
+
+		if opts.trim {
+			for i, field := range record {
+				record[i] = strings.TrimSpace(field)
+			}
+		}
+
+		if width < 0 {
+			width = len(record)
+		} else if len(record) != width {
+			message := fmt.Sprintf("expected %d fields, got %d", width, len(record))
+			switch opts.ragged {
+			case "pad":
+				if len(record) < width {
+					message += " (padded)"
+				} else {
+					message += " (truncated)"
+				}
+				fitted := make([]string, width)
+				copy(fitted, record)
+				record = fitted
+			case "skip":
+				addProblem(line, message+" (skipped)")
+				continue
+			default:
+				if !opts.report {
+					return nil, newError("failed to parse CSV: line %d: %s", line, message)
+				}
+				addProblem(line, message+" (skipped)")
+				continue
+			}
+			addProblem(line, message)
+		}
+
+		records = append(records, record)
 	}
 
+	rows := csvRecordsToRows(records, opts.header)
+	if !opts.report {
+		return rows, nil
+	}
+	if problems == nil {
+		problems = []Object{}
+	}
+	return NewDictionaryFromObjects(map[string]Object{
+		"rows":   rows,
+		"errors": &Array{Elements: problems},
+	}), nil
+}
+
+// csvRecordsToRows converts CSV records to an array of dictionaries keyed by the
+// first record (with a header) or an array of arrays of strings
+func csvRecordsToRows(records [][]string, hasHeader bool) *Array {
 	if len(records) == 0 {
-		return &Array{Elements: []Object{}}, nil
+		return &Array{Elements: []Object{}}
 	}
 
 	if hasHeader {
 		// First row is headers
 		headers := records[0]
 		rows := make([]Object, 0, len(records)-1)
-
 		for _, record := range records[1:] {
-			pairs := make(map[string]ast.Expression)
-			for i, value := range record {
-				if i < len(headers) {
-					pairs[headers[i]] = &ast.ObjectLiteralExpression{Obj: &String{Value: value}}
-				}
-			}
-			rows = append(rows, &Dictionary{Pairs: pairs, Env: NewEnvironment()})
+			rows = append(rows, csvRecordToRow(headers, record))
 		}
-		return &Array{Elements: rows}, nil
+		return &Array{Elements: rows}
 	}
 
 	// No header - return array of arrays
 	rows := make([]Object, len(records))
 	for i, record := range records {
-		elements := make([]Object, len(record))
-		for j, value := range record {
-			elements[j] = &String{Value: value}
+		rows[i] = csvRecordToRow(nil, record)
+	}
+	return &Array{Elements: rows}
+}
+
+// csvRecordToRow converts a CSV record to a dictionary keyed by headers, or
+// to an array of strings if headers is nil
+func csvRecordToRow(headers []string, record []string) Object {
+	if headers != nil {
+		pairs := make(map[string]ast.Expression)
+		for i, value := range record {
+			if i < len(headers) {
+				pairs[headers[i]] = objectToExpression(&String{Value: value})
+			}
 		}
-		rows[i] = &Array{Elements: elements}
+		return &Dictionary{Pairs: pairs, Env: NewEnvironment()}
+	}
+
+	elements := make([]Object, len(record))
+	for j, value := range record {
+		elements[j] = &String{Value: value}
 	}
-	return &Array{Elements: rows}, nil
+	return &Array{Elements: elements}
 }
 
 // evalWriteStatement evaluates the ==> and ==>> operators to write file content
@@ -10971,6 +12079,16 @@ func evalWriteStatement(node *ast.WriteStatement, env *Environment) Object {
 		return target
 	}
 
+	value = rangeAsArray(value)
+
+	// Iterators are only streamed to local files (see writeFileContent)
+	if fileDict, ok := target.(*Dictionary); !ok || !isFileDict(fileDict) {
+		value = collectIterator(value)
+		if isError(value) {
+			return value
+		}
+	}
+
 	// Check if it's an SFTP file handle
 	if sftpHandle, ok := target.(*SFTPFileHandle); ok {
 		err := evalSFTPWrite(sftpHandle, value, node.Append, env)
@@ -11048,6 +12166,7 @@ func evalHTTPWrite(reqDict *Dictionary, value Object, env *Environment) Object {
 		info.FinalURL,
 		info.Headers,
 		"",
+		info.Attempts,
 		env,
 	)
 }
@@ -11090,7 +12209,7 @@ func evalSFTPRead(handle *SFTPFileHandle, env *Environment) (Object, Object) {
 			fileInfo["isDir"] = &ast.ObjectLiteralExpression{Obj: &Boolean{Value: entry.IsDir()}}
 			fileInfo["isFile"] = &ast.ObjectLiteralExpression{Obj: &Boolean{Value: !entry.IsDir()}}
 			fileInfo["mode"] = &ast.StringLiteral{Value: entry.Mode().String()}
-			fileInfo["modified"] = &ast.ObjectLiteralExpression{Obj: timeToDict(entry.ModTime(), env)}
+			fileInfo["modified"] = &ast.ObjectLiteralExpression{Obj: newDatetime(entry.ModTime(), "datetime")}
 
 			files = append(files, &Dictionary{Pairs: fileInfo, Env: env})
 		}
@@ -11110,6 +12229,7 @@ func evalSFTPRead(handle *SFTPFileHandle, env *Environment) (Object, Object) {
 	if err != nil {
 		return nil, newError("SFTP read failed: %s", err.Error())
 	}
+	recordFileRead(len(data))
 
 	// Parse based on format
 	format := handle.Format
@@ -11134,7 +12254,7 @@ func evalSFTPRead(handle *SFTPFileHandle, env *Environment) (Object, Object) {
 		}
 		return &Array{Elements: elements}, nil
 	case "csv":
-		return parseCSV(data, true) // Assume CSV has headers by default
+		return parseCSV(data, defaultCSVOptions(true)) // Assume CSV has headers by default
 	case "bytes":
 		elements := make([]Object, len(data))
 		for i, b := range data {
@@ -11148,7 +12268,7 @@ func evalSFTPRead(handle *SFTPFileHandle, env *Environment) (Object, Object) {
 		case ".json":
 			return parseJSON(string(data))
 		case ".csv":
-			return parseCSV(data, true)
+			return parseCSV(data, defaultCSVOptions(true))
 		default:
 			return &String{Value: string(data)}, nil
 		}
@@ -11226,6 +12346,10 @@ func evalSFTPWrite(handle *SFTPFileHandle, value Object, append bool, env *Envir
 		return newError("unknown format: %s", format)
 	}
 
+	if env.dryRun("upload %d bytes to %s", len(content), sftpLocation(handle)) {
+		return NULL
+	}
+
 	// Open remote file via SFTP with appropriate flags
 	file, err := handle.Connection.Client.OpenFile(handle.Path, flags)
 	if err != nil {
@@ -11238,6 +12362,7 @@ func evalSFTPWrite(handle *SFTPFileHandle, value Object, append bool, env *Envir
 	if err != nil {
 		return newError("SFTP write failed: %s", err.Error())
 	}
+	recordFileWrite(len(content))
 
 	return NULL
 }
@@ -11262,49 +12387,21 @@ func evalQueryOneStatement(node *ast.QueryOneStatement, env *Environment) Object
 	}
 
 	// Extract SQL and params from the query object
-	sql, params, err := extractSQLAndParams(queryObj, env)
+	sql, params, types, err := extractSQLAndParams(queryObj, env)
 	if err != nil {
 		return err
 	}
 
-	// Execute the query
-	// For QueryRow, we need to get column info, so we use Query instead
-	rows, queryErr := conn.DB.Query(sql, params...)
-	if queryErr != nil {
-		conn.LastError = queryErr.Error()
-		return newError("query failed: %s", queryErr.Error())
-	}
-	defer rows.Close()
-
-	// Get column names
-	columns, colErr := rows.Columns()
-	if colErr != nil {
-		conn.LastError = colErr.Error()
-		return newError("failed to get columns: %s", colErr.Error())
+	// Run the query and read the first row, if there is one
+	results, scanErr := queryRows(conn, sql, params, 1, types, env)
+	if scanErr != nil {
+		return scanErr
 	}
-
-	// Check if there's a row
-	if !rows.Next() {
-		// No rows - return null
+	if len(results) == 0 {
 		return assignQueryResult(node.Names, NULL, env, node.IsLet)
 	}
 
-	// Scan the row into a map
-	values := make([]interface{}, len(columns))
-	valuePtrs := make([]interface{}, len(columns))
-	for i := range values {
-		valuePtrs[i] = &values[i]
-	}
-
-	if scanErr := rows.Scan(valuePtrs...); scanErr != nil {
-		conn.LastError = scanErr.Error()
-		return newError("failed to scan row: %s", scanErr.Error())
-	}
-
-	// Convert to dictionary
-	resultDict := rowToDict(columns, values, env)
-
-	return assignQueryResult(node.Names, resultDict, env, node.IsLet)
+	return assignQueryResult(node.Names, results[0], env, node.IsLet)
 }
 
 // evalQueryManyStatement evaluates the <=??=> operator to query multiple rows
@@ -11327,47 +12424,15 @@ func evalQueryManyStatement(node *ast.QueryManyStatement, env *Environment) Obje
 	}
 
 	// Extract SQL and params
-	sql, params, err := extractSQLAndParams(queryObj, env)
+	sql, params, types, err := extractSQLAndParams(queryObj, env)
 	if err != nil {
 		return err
 	}
 
-	// Execute the query
-	rows, queryErr := conn.DB.Query(sql, params...)
-	if queryErr != nil {
-		conn.LastError = queryErr.Error()
-		return newError("query failed: %s", queryErr.Error())
-	}
-	defer rows.Close()
-
-	// Get column names
-	columns, colErr := rows.Columns()
-	if colErr != nil {
-		conn.LastError = colErr.Error()
-		return newError("failed to get columns: %s", colErr.Error())
-	}
-
-	// Scan all rows
-	var results []Object
-	for rows.Next() {
-		values := make([]interface{}, len(columns))
-		valuePtrs := make([]interface{}, len(columns))
-		for i := range values {
-			valuePtrs[i] = &values[i]
-		}
-
-		if scanErr := rows.Scan(valuePtrs...); scanErr != nil {
-			conn.LastError = scanErr.Error()
-			return newError("failed to scan row: %s", scanErr.Error())
-		}
-
-		resultDict := rowToDict(columns, values, env)
-		results = append(results, resultDict)
-	}
-
-	if rowsErr := rows.Err(); rowsErr != nil {
-		conn.LastError = rowsErr.Error()
-		return newError("error iterating rows: %s", rowsErr.Error())
+	// Run the query and read every row
+	results, scanErr := queryRows(conn, sql, params, -1, types, env)
+	if scanErr != nil {
+		return scanErr
 	}
 
 	resultArray := &Array{Elements: results}
@@ -11394,13 +12459,13 @@ func evalExecuteStatement(node *ast.ExecuteStatement, env *Environment) Object {
 	}
 
 	// Extract SQL and params
-	sql, params, err := extractSQLAndParams(queryObj, env)
+	sql, params, _, err := extractSQLAndParams(queryObj, env)
 	if err != nil {
 		return err
 	}
 
 	// Execute the statement
-	result, execErr := conn.DB.Exec(sql, params...)
+	result, execErr := execSQL(conn, sql, params, env)
 	if execErr != nil {
 		conn.LastError = execErr.Error()
 		return newError("execute failed: %s", execErr.Error())
@@ -11428,27 +12493,50 @@ func evalExecuteStatement(node *ast.ExecuteStatement, env *Environment) Object {
 	return assignQueryResult(node.Names, resultDict, env, node.IsLet)
 }
 
-// extractSQLAndParams extracts SQL string and parameters from a query object
-func extractSQLAndParams(queryObj Object, env *Environment) (string, []interface{}, *Error) {
+// extractSQLAndParams extracts the SQL string, parameters and column type
+// overrides from a query object
+func extractSQLAndParams(queryObj Object, env *Environment) (string, []interface{}, map[string]string, *Error) {
 	// If it's a string, use it directly with no params
 	if str, ok := queryObj.(*String); ok {
-		return str.Value, nil, nil
+		return str.Value, nil, nil, nil
+	}
+
+	// A query built with db.table() carries its own params
+	if query, ok := queryObj.(*DBQuery); ok {
+		sql, params := query.selectSQL()
+		return sql, params, query.Types, nil
 	}
 
-	// If it's a dictionary (from <SQL> tag), extract sql and params
+	// [sql, params] pairs a query with its parameters
+	if arr, ok := queryObj.(*Array); ok {
+		if len(arr.Elements) != 2 {
+			return "", nil, nil, newError("query array must be [sql, params], got %d elements", len(arr.Elements))
+		}
+		sqlStr, ok := arr.Elements[0].(*String)
+		if !ok {
+			return "", nil, nil, newError("first element of query array must be a string, got %s", arr.Elements[0].Type())
+		}
+		params, errObj := queryParams(arr.Elements[1])
+		if errObj != nil {
+			return "", nil, nil, errObj
+		}
+		return sqlStr.Value, params, nil, nil
+	}
+
+	// If it's a dictionary ({sql, params} or from a <SQL> tag), extract sql and params
 	if dict, ok := queryObj.(*Dictionary); ok {
 		// Get SQL content
 		sqlExpr, hasSql := dict.Pairs["sql"]
 		if !hasSql {
-			return "", nil, newError("query object missing 'sql' property")
+			return "", nil, nil, newError("query object missing 'sql' property")
 		}
 		sqlObj := Eval(sqlExpr, env)
 		if isError(sqlObj) {
-			return "", nil, sqlObj.(*Error)
+			return "", nil, nil, sqlObj.(*Error)
 		}
 		sqlStr, ok := sqlObj.(*String)
 		if !ok {
-			return "", nil, newError("sql property must be a string, got %s", sqlObj.Type())
+			return "", nil, nil, newError("sql property must be a string, got %s", sqlObj.Type())
 		}
 
 		// Get params if present
@@ -11456,37 +12544,39 @@ func extractSQLAndParams(queryObj Object, env *Environment) (string, []interface
 		if paramsExpr, hasParams := dict.Pairs["params"]; hasParams {
 			paramsObj := Eval(paramsExpr, env)
 			if isError(paramsObj) {
-				return "", nil, paramsObj.(*Error)
+				return "", nil, nil, paramsObj.(*Error)
 			}
-			if paramsDict, ok := paramsObj.(*Dictionary); ok {
-				params = dictToNamedParams(paramsDict, env)
+			var errObj *Error
+			if params, errObj = queryParams(paramsObj); errObj != nil {
+				return "", nil, nil, errObj
+			}
+		}
+
+		// Get column types if present
+		var types map[string]string
+		if typesExpr, hasTypes := dict.Pairs["types"]; hasTypes {
+			var errObj *Error
+			if types, errObj = parseColumnTypes(Eval(typesExpr, env)); errObj != nil {
+				return "", nil, nil, errObj
 			}
 		}
 
-		return sqlStr.Value, params, nil
+		return sqlStr.Value, params, types, nil
 	}
 
-	return "", nil, newError("query must be a string or <SQL> tag, got %s", queryObj.Type())
+	return "", nil, nil, newError("query must be a string, [sql, params], {sql, params} or <SQL> tag, got %s", queryObj.Type())
 }
 
-// dictToNamedParams converts a dictionary to a slice of named parameters
-func dictToNamedParams(dict *Dictionary, env *Environment) []interface{} {
-	params := make([]interface{}, 0, len(dict.Pairs))
-
-	// Sort keys for consistent order
-	keys := make([]string, 0, len(dict.Pairs))
-	for key := range dict.Pairs {
-		keys = append(keys, key)
-	}
-	sort.Strings(keys)
-
-	for _, key := range keys {
-		expr := dict.Pairs[key]
-		val := Eval(expr, env)
-		params = append(params, objectToGoValue(val))
+// queryParams converts a query's params to parameters: an array of values
+// for ? placeholders, or a dictionary for :name placeholders
+func queryParams(obj Object) ([]interface{}, *Error) {
+	switch obj.(type) {
+	case *Array, *Dictionary:
+		return statementParams([]Object{obj}), nil
+	case *Null:
+		return nil, nil
 	}
-
-	return params
+	return nil, newError("query params must be an array or dictionary, got %s", obj.Type())
 }
 
 // objectToGoValue converts a Parsley object to a Go value for database params
@@ -11507,68 +12597,13 @@ func objectToGoValue(obj Object) interface{} {
 	}
 }
 
-// rowToDict converts a database row to a Parsley dictionary
-func rowToDict(columns []string, values []interface{}, env *Environment) *Dictionary {
+// rowToDict converts a database row to a Parsley dictionary, converting each
+// value to its column's kind (see columnKinds)
+func rowToDict(columns []string, kinds []string, values []interface{}, env *Environment) *Dictionary {
 	pairs := make(map[string]ast.Expression)
-
 	for i, col := range columns {
-		var expr ast.Expression
-
-		switch v := values[i].(type) {
-		case int64:
-			literal := strconv.FormatInt(v, 10)
-			expr = &ast.IntegerLiteral{
-				Token: lexer.Token{Type: lexer.INT, Literal: literal},
-				Value: v,
-			}
-		case float64:
-			literal := strconv.FormatFloat(v, 'f', -1, 64)
-			expr = &ast.FloatLiteral{
-				Token: lexer.Token{Type: lexer.FLOAT, Literal: literal},
-				Value: v,
-			}
-		case string:
-			expr = &ast.StringLiteral{
-				Token: lexer.Token{Type: lexer.STRING, Literal: v},
-				Value: v,
-			}
-		case []byte:
-			strVal := string(v)
-			expr = &ast.StringLiteral{
-				Token: lexer.Token{Type: lexer.STRING, Literal: strVal},
-				Value: strVal,
-			}
-		case bool:
-			var tokenType lexer.TokenType
-			var literal string
-			if v {
-				tokenType = lexer.TRUE
-				literal = "true"
-			} else {
-				tokenType = lexer.FALSE
-				literal = "false"
-			}
-			expr = &ast.Boolean{
-				Token: lexer.Token{Type: tokenType, Literal: literal},
-				Value: v,
-			}
-		case nil:
-			expr = &ast.Identifier{
-				Token: lexer.Token{Type: lexer.IDENT, Literal: "null"},
-				Value: "null",
-			}
-		default:
-			// For unknown types, convert to string
-			strVal := fmt.Sprintf("%v", v)
-			expr = &ast.StringLiteral{
-				Token: lexer.Token{Type: lexer.STRING, Literal: strVal},
-				Value: strVal,
-			}
-		}
-
-		pairs[col] = expr
+		pairs[col] = &ast.ObjectLiteralExpression{Obj: columnValue(values[i], kinds[i], env)}
 	}
-
 	return &Dictionary{Pairs: pairs, Env: env}
 }
 
@@ -11602,46 +12637,20 @@ func evalDatabaseQueryOne(connObj Object, queryObj Object, env *Environment) Obj
 	}
 
 	// Extract SQL and params from the query object
-	sql, params, err := extractSQLAndParams(queryObj, env)
+	sql, params, types, err := extractSQLAndParams(queryObj, env)
 	if err != nil {
 		return err
 	}
 
-	// Execute the query
-	rows, queryErr := conn.DB.Query(sql, params...)
-	if queryErr != nil {
-		conn.LastError = queryErr.Error()
-		return newError("query failed: %s", queryErr.Error())
-	}
-	defer rows.Close()
-
-	// Get column names
-	columns, colErr := rows.Columns()
-	if colErr != nil {
-		conn.LastError = colErr.Error()
-		return newError("failed to get columns: %s", colErr.Error())
+	// Run the query and read the first row - no rows gives null
+	results, scanErr := queryRows(conn, sql, params, 1, types, env)
+	if scanErr != nil {
+		return scanErr
 	}
-
-	// Check if there's a row
-	if !rows.Next() {
-		// No rows - return null
+	if len(results) == 0 {
 		return NULL
 	}
-
-	// Scan the row into a map
-	values := make([]interface{}, len(columns))
-	valuePtrs := make([]interface{}, len(columns))
-	for i := range values {
-		valuePtrs[i] = &values[i]
-	}
-
-	if scanErr := rows.Scan(valuePtrs...); scanErr != nil {
-		conn.LastError = scanErr.Error()
-		return newError("failed to scan row: %s", scanErr.Error())
-	}
-
-	// Convert to dictionary
-	return rowToDict(columns, values, env)
+	return results[0]
 }
 
 // evalDatabaseQueryMany evaluates database query for multiple rows (infix expression version)
@@ -11652,49 +12661,16 @@ func evalDatabaseQueryMany(connObj Object, queryObj Object, env *Environment) Ob
 	}
 
 	// Extract SQL and params
-	sql, params, err := extractSQLAndParams(queryObj, env)
+	sql, params, types, err := extractSQLAndParams(queryObj, env)
 	if err != nil {
 		return err
 	}
 
-	// Execute the query
-	rows, queryErr := conn.DB.Query(sql, params...)
-	if queryErr != nil {
-		conn.LastError = queryErr.Error()
-		return newError("query failed: %s", queryErr.Error())
-	}
-	defer rows.Close()
-
-	// Get column names
-	columns, colErr := rows.Columns()
-	if colErr != nil {
-		conn.LastError = colErr.Error()
-		return newError("failed to get columns: %s", colErr.Error())
-	}
-
-	// Scan all rows
-	var results []Object
-	for rows.Next() {
-		values := make([]interface{}, len(columns))
-		valuePtrs := make([]interface{}, len(columns))
-		for i := range values {
-			valuePtrs[i] = &values[i]
-		}
-
-		if scanErr := rows.Scan(valuePtrs...); scanErr != nil {
-			conn.LastError = scanErr.Error()
-			return newError("failed to scan row: %s", scanErr.Error())
-		}
-
-		resultDict := rowToDict(columns, values, env)
-		results = append(results, resultDict)
-	}
-
-	if rowsErr := rows.Err(); rowsErr != nil {
-		conn.LastError = rowsErr.Error()
-		return newError("error iterating rows: %s", rowsErr.Error())
+	// Run the query and read every row
+	results, scanErr := queryRows(conn, sql, params, -1, types, env)
+	if scanErr != nil {
+		return scanErr
 	}
-
 	return &Array{Elements: results}
 }
 
@@ -11706,13 +12682,13 @@ func evalDatabaseExecute(connObj Object, queryObj Object, env *Environment) Obje
 	}
 
 	// Extract SQL and params
-	sql, params, err := extractSQLAndParams(queryObj, env)
+	sql, params, _, err := extractSQLAndParams(queryObj, env)
 	if err != nil {
 		return err
 	}
 
 	// Execute the statement
-	result, execErr := conn.DB.Exec(sql, params...)
+	result, execErr := execSQL(conn, sql, params, env)
 	if execErr != nil {
 		conn.LastError = execErr.Error()
 		return newError("execute failed: %s", execErr.Error())
@@ -11784,6 +12760,21 @@ func writeFileContent(fileDict *Dictionary, value Object, appendMode bool, env *
 		}
 	}
 
+	// Options given when the file handle was created ({append, atomic, mode})
+	opts, optErr := parseWriteOptions(fileDict, env)
+	if optErr != nil {
+		return optErr
+	}
+	if opts.append {
+		appendMode = true
+	}
+	if appendMode && opts.atomic {
+		return newError("atomic writes cannot be used with append")
+	}
+	if appendMode && opts.onlyIfChanged {
+		return newError("onlyIfChanged cannot be used with append")
+	}
+
 	// Get the format
 	formatExpr, hasFormat := fileDict.Pairs["format"]
 	if !hasFormat {
@@ -11798,6 +12789,18 @@ func writeFileContent(fileDict *Dictionary, value Object, appendMode bool, env *
 		return newError("file format must be a string, got %s", formatObj.Type())
 	}
 
+	// Iterators are written as they're generated in the lines format, and
+	// collected into an array for the others
+	if it, ok := value.(*Iterator); ok {
+		if formatStr.Value == "lines" && !opts.onlyIfChanged {
+			return writeLinesStream(it, fileDict, pathStr, stdioStream, opts, appendMode, env)
+		}
+		value = it.toArray()
+		if errObj, ok := value.(*Error); ok {
+			return errObj
+		}
+	}
+
 	// Encode the value based on format
 	var data []byte
 	var encodeErr error
@@ -11816,13 +12819,39 @@ func writeFileContent(fileDict *Dictionary, value Object, appendMode bool, env *
 		data, encodeErr = encodeJSON(value)
 
 	case "csv", "csv-noheader":
-		data, encodeErr = encodeCSV(value, formatStr.Value == "csv")
+		opts := defaultCSVOptions(formatStr.Value == "csv")
+		if fileOpts := fileOptions(fileDict, env); fileOpts != nil {
+			var optErr *Error
+			opts, optErr = parseCSVOptions(fileOpts, opts)
+			if optErr != nil {
+				return optErr
+			}
+		}
+		data, encodeErr = encodeCSV(value, opts)
 
 	case "svg":
 		data, encodeErr = encodeSVG(value)
 
 	case "yaml":
-		data, encodeErr = encodeYAML(value)
+		indent := defaultYAMLIndent
+		if indentOpt := fileOption(fileDict, "indent", env); indentOpt != nil {
+			var optErr *Error
+			indent, optErr = parseYAMLIndent(indentOpt)
+			if optErr != nil {
+				return optErr
+			}
+		}
+		data, encodeErr = encodeYAML(value, indent)
+
+	case "xml":
+		opts, optErr := parseXMLOptions(fileOptions(fileDict, env))
+		if optErr != nil {
+			return optErr
+		}
+		data, encodeErr = encodeXML(value, opts)
+
+	case "toml":
+		data, encodeErr = encodeTOML(value)
 
 	default:
 		return newError("unsupported file format for writing: %s", formatStr.Value)
@@ -11832,6 +12861,48 @@ func writeFileContent(fileDict *Dictionary, value Object, appendMode bool, env *
 		return newError("failed to encode data: %s", encodeErr.Error())
 	}
 
+	// Convert UTF-8 text to the requested line endings and encoding (bytes are written as-is)
+	if formatStr.Value != "bytes" {
+		var optErr *Error
+		addBOM := !isStdio && (!appendMode || fileIsEmpty(pathStr))
+		data, optErr = applyTextWriteOptions(fileDict, data, addBOM, env)
+		if optErr != nil {
+			return optErr
+		}
+
+		enc, encErr := fileTextEncoding(fileDict, env)
+		if encErr != nil {
+			return encErr
+		}
+		if enc != nil {
+			encoded, err := enc.NewEncoder().Bytes(data)
+			if err != nil {
+				return newError("failed to encode text as %s: %s", fileOptionString(fileDict, "encoding", env), err.Error())
+			}
+			data = encoded
+		}
+	}
+
+	// An unchanged file is left alone, keeping its modification time
+	if !isStdio && opts.onlyIfChanged && env.checkPathAccess(pathStr, "read") == nil && sameFileContent(pathStr, data) {
+		if opts.hasMode && !env.dryRun("chmod %#o %s", opts.mode, pathStr) {
+			if err := os.Chmod(pathStr, opts.mode); err != nil {
+				return newError("failed to write to file '%s': %s", pathStr, err.Error())
+			}
+		}
+		return nil
+	}
+
+	if !isStdio {
+		verb := "write"
+		if appendMode {
+			verb = "append"
+		}
+		if env.dryRun("%s %d bytes to %s", verb, len(data), pathStr) {
+			return nil
+		}
+	}
+
 	// Write to stdout/stderr or file
 	var writeErr error
 	if isStdio {
@@ -11844,14 +12915,21 @@ func writeFileContent(fileDict *Dictionary, value Object, appendMode bool, env *
 		}
 		_, writeErr = w.Write(data)
 	} else if appendMode {
-		f, err := os.OpenFile(pathStr, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		f, err := os.OpenFile(pathStr, os.O_APPEND|os.O_CREATE|os.O_WRONLY, opts.mode)
 		if err != nil {
 			return newError("failed to open file '%s' for append: %s", pathStr, err.Error())
 		}
 		defer f.Close()
 		_, writeErr = f.Write(data)
+	} else if opts.atomic {
+		writeErr = writeFileAtomic(pathStr, data, opts.mode)
 	} else {
-		writeErr = os.WriteFile(pathStr, data, 0644)
+		writeErr = os.WriteFile(pathStr, data, opts.mode)
+	}
+
+	// os.WriteFile and os.OpenFile only apply the mode to new files
+	if writeErr == nil && !isStdio && opts.hasMode {
+		writeErr = os.Chmod(pathStr, opts.mode)
 	}
 
 	if writeErr != nil {
@@ -11861,6 +12939,137 @@ func writeFileContent(fileDict *Dictionary, value Object, appendMode bool, env *
 		return newError("failed to write to file '%s': %s", pathStr, writeErr.Error())
 	}
 
+	if isStdio {
+		recordOutput(len(data))
+	} else {
+		recordFileWrite(len(data))
+	}
+	return nil
+}
+
+// writeOptions holds the write-related options of a file handle
+type writeOptions struct {
+	append        bool
+	atomic        bool
+	onlyIfChanged bool
+	mode          os.FileMode
+	hasMode       bool
+}
+
+// parseWriteOptions reads {append, atomic, onlyIfChanged, mode} from a file
+// handle's options
+func parseWriteOptions(fileDict *Dictionary, env *Environment) (writeOptions, *Error) {
+	wo := writeOptions{mode: 0644}
+
+	optsExpr, ok := fileDict.Pairs["options"]
+	if !ok {
+		return wo, nil
+	}
+	opts, ok := Eval(optsExpr, env).(*Dictionary)
+	if !ok {
+		return wo, nil
+	}
+
+	if expr, ok := opts.Pairs["append"]; ok {
+		b, ok := Eval(expr, opts.Env).(*Boolean)
+		if !ok {
+			return wo, newError("`append` option must be a boolean")
+		}
+		wo.append = b.Value
+	}
+
+	if expr, ok := opts.Pairs["atomic"]; ok {
+		b, ok := Eval(expr, opts.Env).(*Boolean)
+		if !ok {
+			return wo, newError("`atomic` option must be a boolean")
+		}
+		wo.atomic = b.Value
+	}
+
+	if expr, ok := opts.Pairs["onlyIfChanged"]; ok {
+		b, ok := Eval(expr, opts.Env).(*Boolean)
+		if !ok {
+			return wo, newError("`onlyIfChanged` option must be a boolean")
+		}
+		wo.onlyIfChanged = b.Value
+	}
+
+	if expr, ok := opts.Pairs["mode"]; ok {
+		var mode int64
+		switch v := Eval(expr, opts.Env).(type) {
+		case *Integer:
+			// Integer literals with a leading zero are octal (0644)
+			mode = v.Value
+		case *String:
+			parsed, err := strconv.ParseInt(v.Value, 8, 64)
+			if err != nil {
+				return wo, newError("`mode` option must be an octal permission string like \"0644\", got %q", v.Value)
+			}
+			mode = parsed
+		default:
+			return wo, newError("`mode` option must be an integer or string, got %s", v.Type())
+		}
+		if mode < 0 || mode > 0777 {
+			return wo, newError("`mode` option must be between 0000 and 0777, got %#o", mode)
+		}
+		wo.mode = os.FileMode(mode)
+		wo.hasMode = true
+	}
+
+	return wo, nil
+}
+
+// sameFileContent reports whether the file at path already holds data. The
+// file is hashed as it's read rather than loaded whole.
+func sameFileContent(path string, data []byte) bool {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Size() != int64(len(data)) {
+		return false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return false
+	}
+	want := sha256.Sum256(data)
+	return bytes.Equal(h.Sum(nil), want[:])
+}
+
+// writeFileAtomic writes data to a temporary file in the target's directory and
+// renames it into place, so readers never see a partially written file
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Chmod(tmpName, mode); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
 	return nil
 }
 
@@ -11927,6 +13136,77 @@ func encodeJSON(value Object) ([]byte, error) {
 	return json.MarshalIndent(goValue, "", "  ")
 }
 
+// parseJSONIndentOptions reads the {pretty, indent, sortKeys} options for stringifyJSON
+// and returns the indent string to use ("" for compact output)
+func parseJSONIndentOptions(opts *Dictionary) (string, *Error) {
+	pretty := false
+	indent := "  "
+
+	if prettyExpr, ok := opts.Pairs["pretty"]; ok {
+		b, ok := Eval(prettyExpr, opts.Env).(*Boolean)
+		if !ok {
+			return "", newError("`pretty` option for stringifyJSON() must be a boolean")
+		}
+		pretty = b.Value
+	}
+
+	if indentExpr, ok := opts.Pairs["indent"]; ok {
+		switch v := Eval(indentExpr, opts.Env).(type) {
+		case *Integer:
+			if v.Value < 0 || v.Value > 10 {
+				return "", newError("`indent` option for stringifyJSON() must be between 0 and 10, got %d", v.Value)
+			}
+			indent = strings.Repeat(" ", int(v.Value))
+		case *String:
+			indent = v.Value
+		default:
+			return "", newError("`indent` option for stringifyJSON() must be an integer or string, got %s", v.Type())
+		}
+		// An explicit indent implies pretty output unless pretty is explicitly false
+		if _, hasPretty := opts.Pairs["pretty"]; !hasPretty {
+			pretty = true
+		}
+	}
+
+	if sortExpr, ok := opts.Pairs["sortKeys"]; ok {
+		// Keys are always sorted; the option is accepted for clarity
+		if _, ok := Eval(sortExpr, opts.Env).(*Boolean); !ok {
+			return "", newError("`sortKeys` option for stringifyJSON() must be a boolean")
+		}
+	}
+
+	if !pretty {
+		return "", nil
+	}
+	// An empty indent (indent: 0) gives compact output
+	return indent, nil
+}
+
+// typedScalar returns the scalar JSON form of a typed value, such as a
+// datetime's ISO 8601 string
+func typedScalar(obj Object) (string, bool) {
+	switch v := obj.(type) {
+	case *Datetime, *Path, *Url:
+		return v.Inspect(), true
+	case *Duration:
+		return v.iso(), true
+	case *Dictionary:
+		switch {
+		case isRegexDict(v):
+			return regexDictToString(v), true
+		case isMatchDict(v):
+			return matchDictToString(v), true
+		case isColorDict(v):
+			return colorDictToString(v), true
+		case isFileDict(v):
+			return fileDictToString(v), true
+		case isDirDict(v):
+			return dirDictToString(v), true
+		}
+	}
+	return "", false
+}
+
 // objectToGo converts a Parsley Object to a Go interface{} for JSON encoding
 func objectToGo(obj Object) interface{} {
 	switch v := obj.(type) {
@@ -11946,7 +13226,16 @@ func objectToGo(obj Object) interface{} {
 			result[i] = objectToGo(elem)
 		}
 		return result
+	case *Range:
+		return objectToGo(v.toArray())
+	case *Datetime, *Duration, *Path, *Url:
+		str, _ := typedScalar(v)
+		return str
 	case *Dictionary:
+		// Typed dictionaries serialize as their string form rather than their internal fields
+		if str, ok := typedScalar(v); ok {
+			return str
+		}
 		result := make(map[string]interface{})
 		for key, expr := range v.Pairs {
 			// Skip internal fields
@@ -11958,8 +13247,7 @@ func objectToGo(obj Object) interface{} {
 				result[key] = objectToGo(ole.Obj.(Object))
 			} else {
 				// For other expressions, we need to evaluate them
-				env := NewEnvironment()
-				val := Eval(expr, env)
+				val := Eval(expr, dictionaryThisEnv(v))
 				result[key] = objectToGo(val)
 			}
 		}
@@ -11980,14 +13268,25 @@ func encodeSVG(value Object) ([]byte, error) {
 	}
 }
 
-// encodeYAML encodes a value as YAML
-func encodeYAML(value Object) ([]byte, error) {
-	goValue := objectToGo(value)
-	return yaml.Marshal(goValue)
+// encodeYAML encodes a value as YAML, indenting nested blocks by indent spaces
+func encodeYAML(value Object, indent int) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(indent)
+	if err := encoder.Encode(objectToGo(value)); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
 
-// encodeCSV encodes a value as CSV
-func encodeCSV(value Object, hasHeader bool) ([]byte, error) {
+// encodeCSV encodes an array of dictionaries or arrays as CSV.
+// Dictionary rows are written in opts.columns order (default: all keys, sorted)
+// with a header row when opts.header is set; array rows get a header row only
+// when columns are given. Fields containing delimiters, quotes or newlines are quoted.
+func encodeCSV(value Object, opts csvOptions) ([]byte, error) {
 	arr, ok := value.(*Array)
 	if !ok {
 		return nil, fmt.Errorf("CSV format requires an array, got %s", value.Type())
@@ -11999,39 +13298,32 @@ func encodeCSV(value Object, hasHeader bool) ([]byte, error) {
 
 	var buf strings.Builder
 	writer := csv.NewWriter(&buf)
+	writer.Comma = opts.delimiter
 
-	// Check if first element is a dictionary (has header) or array (no header)
-	firstDict, isDict := arr.Elements[0].(*Dictionary)
+	// Check if first element is a dictionary (keyed rows) or array (positional rows)
+	_, isDict := arr.Elements[0].(*Dictionary)
 
-	if isDict && hasHeader {
-		// Write header from dictionary keys
-		var headers []string
-		for key := range firstDict.Pairs {
-			if !strings.HasPrefix(key, "_") {
-				headers = append(headers, key)
-			}
+	if isDict {
+		columns := opts.columns
+		if columns == nil {
+			columns = csvDictionaryColumns(arr)
 		}
-		sort.Strings(headers) // Consistent ordering
-		if err := writer.Write(headers); err != nil {
-			return nil, err
+		if opts.header {
+			if err := writer.Write(columns); err != nil {
+				return nil, err
+			}
 		}
 
 		// Write rows
 		for _, elem := range arr.Elements {
 			dict, ok := elem.(*Dictionary)
 			if !ok {
-				return nil, fmt.Errorf("CSV with header requires all rows to be dictionaries")
+				return nil, fmt.Errorf("CSV rows must all be dictionaries, got %s", elem.Type())
 			}
-			row := make([]string, len(headers))
-			for i, key := range headers {
+			row := make([]string, len(columns))
+			for i, key := range columns {
 				if expr, exists := dict.Pairs[key]; exists {
-					if ole, ok := expr.(*ast.ObjectLiteralExpression); ok {
-						row[i] = ole.Obj.(Object).Inspect()
-					} else {
-						env := NewEnvironment()
-						val := Eval(expr, env)
-						row[i] = val.Inspect()
-					}
+					row[i] = csvField(Eval(expr, dictionaryThisEnv(dict)))
 				}
 			}
 			if err := writer.Write(row); err != nil {
@@ -12039,24 +13331,25 @@ func encodeCSV(value Object, hasHeader bool) ([]byte, error) {
 			}
 		}
 	} else {
+		if opts.header && opts.columns != nil {
+			if err := writer.Write(opts.columns); err != nil {
+				return nil, err
+			}
+		}
+
 		// Write as array of arrays
 		for _, elem := range arr.Elements {
 			rowArr, ok := elem.(*Array)
 			if !ok {
 				// Single-element row
-				if err := writer.Write([]string{elem.Inspect()}); err != nil {
+				if err := writer.Write([]string{csvField(elem)}); err != nil {
 					return nil, err
 				}
 				continue
 			}
 			row := make([]string, len(rowArr.Elements))
 			for i, cell := range rowArr.Elements {
-				switch v := cell.(type) {
-				case *String:
-					row[i] = v.Value
-				default:
-					row[i] = cell.Inspect()
-				}
+				row[i] = csvField(cell)
 			}
 			if err := writer.Write(row); err != nil {
 				return nil, err
@@ -12072,6 +13365,42 @@ func encodeCSV(value Object, hasHeader bool) ([]byte, error) {
 	return []byte(buf.String()), nil
 }
 
+// csvDictionaryColumns returns the sorted keys used by any dictionary row,
+// skipping internal keys
+func csvDictionaryColumns(arr *Array) []string {
+	seen := make(map[string]bool)
+	var columns []string
+	for _, elem := range arr.Elements {
+		dict, ok := elem.(*Dictionary)
+		if !ok {
+			continue
+		}
+		for key := range dict.Pairs {
+			if !strings.HasPrefix(key, "_") && !seen[key] {
+				seen[key] = true
+				columns = append(columns, key)
+			}
+		}
+	}
+	sort.Strings(columns) // Consistent ordering
+	return columns
+}
+
+// csvField converts a value to a CSV field: strings as-is, null as empty,
+// typed values (dates, durations, paths, ...) as their string form
+func csvField(obj Object) string {
+	switch v := obj.(type) {
+	case *String:
+		return v.Value
+	case *Null:
+		return ""
+	}
+	if str, ok := typedScalar(obj); ok {
+		return str
+	}
+	return obj.Inspect()
+}
+
 // evalFileRemove removes/deletes a file from the filesystem
 func evalFileRemove(fileDict *Dictionary, env *Environment) Object {
 	// Get the path from the file dictionary
@@ -12091,6 +13420,10 @@ func evalFileRemove(fileDict *Dictionary, env *Environment) Object {
 		return newError("security: %s", err.Error())
 	}
 
+	if env.dryRun("delete %s", absPath) {
+		return &Null{}
+	}
+
 	// Delete the file
 	err := os.Remove(absPath)
 	if err != nil {
@@ -12120,6 +13453,62 @@ func evalDictionaryIndexExpression(dict, index Object) Object {
 	return Eval(expr, dictEnv)
 }
 
+// getPath walks a path of keys and indexes into nested dictionaries and
+// arrays. It returns nil if a key is missing, an index is out of range, or a
+// step reaches something that can't be indexed. Numeric keys index arrays
+// (negative from the end), so "items.0.name" works as a string path.
+func getPath(value Object, path []Object) Object {
+	for _, key := range path {
+		switch v := value.(type) {
+		case *Dictionary:
+			var name string
+			switch k := key.(type) {
+			case *String:
+				name = k.Value
+			case *Integer:
+				name = strconv.FormatInt(k.Value, 10)
+			}
+			if _, ok := v.Pairs[name]; !ok {
+				return nil
+			}
+			value = evalDictionaryIndexExpression(v, &String{Value: name})
+		case fieldValue:
+			k, ok := key.(*String)
+			if !ok {
+				return nil
+			}
+			if value, ok = v.field(k.Value); !ok {
+				return nil
+			}
+		case *Array:
+			var idx int64
+			switch k := key.(type) {
+			case *Integer:
+				idx = k.Value
+			case *String:
+				n, err := strconv.ParseInt(k.Value, 10, 64)
+				if err != nil {
+					return nil
+				}
+				idx = n
+			}
+			if idx < 0 {
+				idx += int64(len(v.Elements))
+			}
+			if idx < 0 || idx >= int64(len(v.Elements)) {
+				return nil
+			}
+			value = v.Elements[idx]
+		default:
+			return nil
+		}
+		if isError(value) {
+			return value
+		}
+	}
+	return value
+}
+
 // environmentToDict converts an environment's store to a Dictionary object
 // Only includes variables that are exported (either via explicit 'export' or 'let' for backward compat)
 func environmentToDict(env *Environment) *Dictionary {
@@ -12180,7 +13569,8 @@ func resolveModulePath(pathStr string, currentFile string) (string, error) {
 	var absPath string
 
 	// If path is absolute, use it directly
-	if strings.HasPrefix(pathStr, "/") {
+	pathStr = filepath.FromSlash(ExpandHome(pathStr))
+	if isAbsolutePathString(pathStr) {
 		absPath = pathStr
 	} else {
 		// Resolve relative to the current file's directory
@@ -12365,38 +13755,51 @@ func evalArrayRepetition(array *Array, count *Integer) Object {
 	return &Array{Elements: result}
 }
 
-// evalRangeExpression creates an inclusive range from start to end
-func evalRangeExpression(tok lexer.Token, left, right Object) Object {
-	if left.Type() != INTEGER_OBJ {
-		return newErrorWithPos(tok, "range start must be an integer, got %s", left.Type())
-	}
-	if right.Type() != INTEGER_OBJ {
-		return newErrorWithPos(tok, "range end must be an integer, got %s", right.Type())
-	}
-
-	start := left.(*Integer).Value
-	end := right.(*Integer).Value
-
-	// Calculate size and direction
-	var size int64
-	var step int64
-	if start <= end {
-		size = end - start + 1
-		step = 1
-	} else {
-		size = start - end + 1
-		step = -1
+// evalInExpression evaluates membership: an element of an array (by ==),
+// a key of a dictionary or a substring of a string. Nothing is in null.
+func evalInExpression(tok lexer.Token, left, right Object) Object {
+	switch right := right.(type) {
+	case *Array:
+		for _, elem := range right.Elements {
+			if isTruthy(evalInfixExpression(tok, "==", left, elem)) {
+				return TRUE
+			}
+		}
+		return FALSE
+	case *Dictionary:
+		key, ok := left.(*String)
+		if !ok {
+			return newErrorWithPos(tok, "left operand of in must be a string to look up a dictionary key, got %s", left.Type())
+		}
+		_, exists := right.Pairs[key.Value]
+		return nativeBoolToParsBoolean(exists)
+	case fieldValue:
+		key, ok := left.(*String)
+		if !ok {
+			return newErrorWithPos(tok, "left operand of in must be a string to look up a field, got %s", left.Type())
+		}
+		_, exists := right.field(key.Value)
+		return nativeBoolToParsBoolean(exists)
+	case *String:
+		sub, ok := left.(*String)
+		if !ok {
+			return newErrorWithPos(tok, "left operand of in must be a string to search a string, got %s", left.Type())
+		}
+		return nativeBoolToParsBoolean(strings.Contains(right.Value, sub.Value))
+	case *Null:
+		return FALSE
+	default:
+		return newErrorWithPos(tok, "right operand of in must be an array, dictionary or string, got %s", right.Type())
 	}
+}
 
-	// Pre-allocate array
-	elements := make([]Object, size)
-	val := start
-	for i := int64(0); i < size; i++ {
-		elements[i] = &Integer{Value: val}
-		val += step
+// evalRangeExpression creates an inclusive range from start to end
+func evalRangeExpression(tok lexer.Token, left, right Object) Object {
+	r, err := newRange(tok, left, right, nil)
+	if err != nil {
+		return err
 	}
-
-	return &Array{Elements: elements}
+	return r
 }
 
 // ============================================================================
@@ -12440,16 +13843,187 @@ func formatPercentWithLocale(value float64, localeStr string) Object {
 	return &String{Value: p.Sprintf("%v", number.Percent(value))}
 }
 
-// formatDateWithStyleAndLocale formats a datetime dictionary with the given style and locale
-func formatDateWithStyleAndLocale(dict *Dictionary, style string, localeStr string, env *Environment) Object {
-	// Extract time from datetime dictionary
-	var t time.Time
-	if unixExpr, ok := dict.Pairs["unix"]; ok {
-		unixObj := Eval(unixExpr, NewEnvironment())
-		if unixInt, ok := unixObj.(*Integer); ok {
-			t = time.Unix(unixInt.Value, 0).UTC()
+// humanizeArgs reads the number and the optional locale, or dictionary of
+// options with a locale, passed to humanSize(), humanCount() and approx()
+func humanizeArgs(name string, args []Object) (float64, string, *Dictionary, *Error) {
+	if len(args) < 1 || len(args) > 2 {
+		return 0, "", nil, newError("wrong number of arguments to `%s`. got=%d, want=1 or 2", name, len(args))
+	}
+
+	var value float64
+	switch arg := args[0].(type) {
+	case *Integer:
+		value = float64(arg.Value)
+	case *Float:
+		value = arg.Value
+	default:
+		return 0, "", nil, newError("first argument to `%s` must be an integer or float, got %s", name, args[0].Type())
+	}
+
+	localeStr := DefaultLocale
+	if len(args) == 1 {
+		return value, localeStr, nil, nil
+	}
+	switch arg := args[1].(type) {
+	case *String:
+		return value, arg.Value, nil, nil
+	case *Dictionary:
+		if localeExpr, ok := arg.Pairs["locale"]; ok {
+			locStr, ok := Eval(localeExpr, arg.Env).(*String)
+			if !ok {
+				return 0, "", nil, newError("`locale` option for `%s` must be a string", name)
+			}
+			localeStr = locStr.Value
+		}
+		return value, localeStr, arg, nil
+	default:
+		return 0, "", nil, newError("second argument to `%s` must be a string or dictionary, got %s", name, args[1].Type())
+	}
+}
+
+// formatDurationWithOptions formats a duration as a list of units ("1 hour, 30 minutes")
+// Options: style ("long" or "narrow"), locale (BCP 47 tag), maxUnits (largest N units)
+func formatDurationWithOptions(months, seconds int64, opts *Dictionary) Object {
+	style := locale.DurationStyleLong
+	localeStr := DefaultLocale
+	maxUnits := 0
+
+	if styleExpr, ok := opts.Pairs["style"]; ok {
+		styleStr, ok := Eval(styleExpr, opts.Env).(*String)
+		if !ok {
+			return newError("`style` option for duration format must be a string")
+		}
+		switch styleStr.Value {
+		case "long":
+			style = locale.DurationStyleLong
+		case "narrow":
+			style = locale.DurationStyleNarrow
+		default:
+			return newError("invalid style %q for duration format, use 'long' or 'narrow'", styleStr.Value)
+		}
+	}
+
+	if localeExpr, ok := opts.Pairs["locale"]; ok {
+		locStr, ok := Eval(localeExpr, opts.Env).(*String)
+		if !ok {
+			return newError("`locale` option for duration format must be a string")
+		}
+		localeStr = locStr.Value
+	}
+
+	if maxExpr, ok := opts.Pairs["maxUnits"]; ok {
+		maxInt, ok := Eval(maxExpr, opts.Env).(*Integer)
+		if !ok || maxInt.Value < 1 {
+			return newError("`maxUnits` option for duration format must be a positive integer")
+		}
+		maxUnits = int(maxInt.Value)
+	}
+
+	return &String{Value: locale.FormatDuration(months, seconds, style, maxUnits, localeStr)}
+}
+
+// formatRelativeDatetime formats a datetime relative to another ("3 days ago", "in 2 hours")
+// Options: to (datetime to compare against, default now), locale (BCP 47 tag)
+func formatRelativeDatetime(dt *Datetime, opts *Dictionary, env *Environment) Object {
+	base := time.Now().UTC()
+	localeStr := DefaultLocale
+
+	if opts != nil {
+		if toExpr, ok := opts.Pairs["to"]; ok {
+			to, ok := Eval(toExpr, opts.Env).(*Datetime)
+			if !ok {
+				return newError("`to` option for `relative` must be a datetime")
+			}
+			base = to.Time.UTC()
+		}
+
+		if localeExpr, ok := opts.Pairs["locale"]; ok {
+			locStr, ok := Eval(localeExpr, opts.Env).(*String)
+			if !ok {
+				return newError("`locale` option for `relative` must be a string")
+			}
+			localeStr = locStr.Value
+		}
+	}
+
+	return &String{Value: locale.RelativeTimeBetween(dt.Time.UTC(), base, localeStr)}
+}
+
+// resolveHolidayCalendar returns the holiday calendar for a country code string
+// or for a calendar dictionary in the same format as the embedded data
+func resolveHolidayCalendar(obj Object, fnName string) (*holidays.Calendar, *Error) {
+	switch v := obj.(type) {
+	case *String:
+		cal, ok := holidays.Lookup(v.Value)
+		if !ok {
+			return nil, newError("`%s`: unknown country %q (available: %s)", fnName, v.Value, strings.Join(holidays.Countries(), ", "))
+		}
+		return cal, nil
+	case *Dictionary:
+		data, err := json.Marshal(objectToGo(v))
+		if err != nil {
+			return nil, newError("`%s`: invalid calendar: %s", fnName, err.Error())
+		}
+		cal, err := holidays.ParseCalendar(data)
+		if err != nil {
+			return nil, newError("`%s`: invalid calendar: %s", fnName, err.Error())
 		}
+		return cal, nil
+	default:
+		return nil, newError("`%s` expects a country code or calendar dictionary, got %s", fnName, obj.Type())
+	}
+}
+
+// datetimeArgToTime converts a datetime argument to a UTC time.Time
+func datetimeArgToTime(obj Object, fnName string) (time.Time, *Error) {
+	dt, ok := obj.(*Datetime)
+	if !ok {
+		return time.Time{}, newError("first argument to `%s` must be a datetime, got %s", fnName, obj.Type())
+	}
+	return time.Unix(dt.Time.Unix(), 0).UTC(), nil
+}
+
+// parseWeekday looks up a weekday by its English name, in any case
+func parseWeekday(name string) (time.Weekday, bool) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(name, day.String()) {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+// monthGrid lays out the month containing t as weeks of seven days starting
+// on weekStart, padded with days from the months either side. fixedWeeks
+// pads every month to six weeks, so calendars don't change height.
+func monthGrid(t time.Time, weekStart time.Weekday, fixedWeeks bool, env *Environment) *Array {
+	first := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	last := first.AddDate(0, 1, -1)
+	day := first.AddDate(0, 0, -int((first.Weekday()-weekStart+7)%7))
+	today := time.Now().UTC().Format("2006-01-02")
+
+	var weeks []Object
+	for len(weeks) < 6 && (fixedWeeks || !day.After(last)) {
+		week := make([]Object, 7)
+		for i := range week {
+			week[i] = NewDictionaryFromObjects(map[string]Object{
+				"date":      newDatetime(day, "date"),
+				"day":       &Integer{Value: int64(day.Day())},
+				"weekday":   &String{Value: day.Weekday().String()},
+				"inMonth":   nativeBoolToParsBoolean(day.Month() == first.Month()),
+				"isWeekend": nativeBoolToParsBoolean(day.Weekday() == time.Saturday || day.Weekday() == time.Sunday),
+				"isToday":   nativeBoolToParsBoolean(day.Format("2006-01-02") == today),
+			})
+			day = day.AddDate(0, 0, 1)
+		}
+		weeks = append(weeks, &Array{Elements: week})
 	}
+	return &Array{Elements: weeks}
+}
+
+// formatDateWithStyleAndLocale formats a datetime with the given style and locale
+func formatDateWithStyleAndLocale(dt *Datetime, style string, localeStr string, env *Environment) Object {
+	t := dt.Time.UTC()
 
 	// Validate style
 	validStyles := map[string]bool{"short": true, "medium": true, "long": true, "full": true}
@@ -0,0 +1,124 @@
+package evaluator
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// File and directory handles describe themselves for listing pages and
+// deploy scripts without running ls or stat:
+//
+//	let f = file(@./site/index.html)
+//	f.owner             // "www"
+//	f.permissionsOctal  // "0644"
+//	f.mime              // "text/html"
+//	f.created           // when the file was made, where the system records it
+//
+// Symlinks are followed like everywhere else, except by isSymlink and
+// target, which describe the link itself.
+
+// fileMetadataProperty returns the metadata properties shared by file and
+// directory handles, or nil for other keys
+func fileMetadataProperty(key, pathStr string, env *Environment) Object {
+	switch key {
+	case "created":
+		info, err := os.Stat(pathStr)
+		if err != nil {
+			return NULL
+		}
+		created, ok := birthTime(info, pathStr)
+		if !ok {
+			return NULL
+		}
+		return newDatetime(created, "datetime")
+
+	case "owner", "group":
+		info, err := os.Stat(pathStr)
+		if err != nil {
+			return NULL
+		}
+		owner, group, ok := fileOwner(info)
+		if !ok {
+			return NULL
+		}
+		if key == "owner" {
+			return &String{Value: owner}
+		}
+		return &String{Value: group}
+
+	case "permissionsOctal":
+		info, err := os.Stat(pathStr)
+		if err != nil {
+			return NULL
+		}
+		return &String{Value: permissionsOctal(info.Mode())}
+
+	case "mime":
+		return &String{Value: fileMIMEType(pathStr, env)}
+
+	case "isSymlink":
+		info, err := os.Lstat(pathStr)
+		return nativeBoolToParsBoolean(err == nil && info.Mode()&os.ModeSymlink != 0)
+
+	case "target":
+		target, err := os.Readlink(pathStr)
+		if err != nil {
+			return NULL
+		}
+		components, isAbsolute := parsePathString(target)
+		return newPath(components, isAbsolute)
+	}
+
+	return nil
+}
+
+// permissionsOctal formats permission bits the way chmod takes them, with
+// the setuid, setgid and sticky bits in the leading digit
+func permissionsOctal(mode os.FileMode) string {
+	perm := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		perm |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		perm |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		perm |= 01000
+	}
+	return fmt.Sprintf("%04o", perm)
+}
+
+// fileMIMEType returns a file's media type from its extension, or from its
+// first bytes if the extension isn't known
+func fileMIMEType(pathStr string, env *Environment) string {
+	info, err := os.Stat(pathStr)
+	if err == nil && info.IsDir() {
+		return "inode/directory"
+	}
+	if mimeType := mime.TypeByExtension(filepath.Ext(pathStr)); mimeType != "" {
+		if mediaType, _, err := mime.ParseMediaType(mimeType); err == nil {
+			return mediaType
+		}
+		return mimeType
+	}
+
+	if err != nil || env.checkPathAccess(pathStr, "read") != nil {
+		return "application/octet-stream"
+	}
+	f, err := os.Open(pathStr)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(head[:n]))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return mediaType
+}
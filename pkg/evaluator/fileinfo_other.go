@@ -0,0 +1,10 @@
+//go:build !unix
+
+package evaluator
+
+import "os"
+
+// fileOwner isn't available without Unix ownership
+func fileOwner(info os.FileInfo) (string, string, bool) {
+	return "", "", false
+}
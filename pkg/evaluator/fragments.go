@@ -0,0 +1,86 @@
+package evaluator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sambeau/parsley/pkg/ast"
+	"github.com/sambeau/parsley/pkg/diagnostics"
+	"github.com/sambeau/parsley/pkg/lexer"
+	"github.com/sambeau/parsley/pkg/parser"
+)
+
+// The {...} expressions in templates, path, URL and datetime templates and
+// tag props are cut out of the literal's text and parsed on their own. The
+// lexer for each is started at the expression's place in the file, so its
+// tokens, and the errors that point at them, have positions in the file
+// rather than in the fragment:
+//
+//	line 4, column 18: identifier not found: nmae
+//	    let s = `Hello, {nmae}!`
+//	                     ^~~~
+
+// fragmentPos is the line and column in the file of the start of a
+// literal's text. The zero value means the position isn't known, and
+// fragments are parsed with positions of their own.
+type fragmentPos struct {
+	line, column int
+}
+
+// literalPos returns the position of the text of the literal tok, which
+// starts skip bytes after the token, past its opening delimiter
+func literalPos(tok lexer.Token, skip int) fragmentPos {
+	if tok.Line == 0 {
+		return fragmentPos{}
+	}
+	return fragmentPos{line: tok.Line, column: tok.Column + skip}
+}
+
+// propsPos returns the position of a tag's props, given the tag's token,
+// whose literal is the tag's source after the '<'. Props that aren't in the
+// source as written, such as those left after removing if={...} from the
+// middle, have no position.
+func propsPos(tok lexer.Token, name, props string) fragmentPos {
+	raw := tok.Literal
+	if props == "" || !strings.HasPrefix(raw, name) {
+		return fragmentPos{}
+	}
+	i := strings.Index(raw[len(name):], props)
+	if i < 0 {
+		return fragmentPos{}
+	}
+	return literalPos(tok, 1).at(raw, len(name)+i)
+}
+
+// at returns the position of text[i], where text starts at p
+func (p fragmentPos) at(text string, i int) fragmentPos {
+	if p.line == 0 {
+		return p
+	}
+	before := text[:i]
+	if n := strings.Count(before, "\n"); n > 0 {
+		return fragmentPos{line: p.line + n, column: i - strings.LastIndex(before, "\n")}
+	}
+	return fragmentPos{line: p.line, column: p.column + i}
+}
+
+// parseFragment parses an expression cut out of a literal, starting at pos
+// in the file. what names the expression in the error for a syntax error.
+func parseFragment(src string, pos fragmentPos, what string) (*ast.Program, *Error) {
+	l := lexer.New(src)
+	if pos.line > 0 {
+		l = lexer.NewAt(src, pos.line, pos.column)
+	}
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		return program, nil
+	}
+
+	msg := p.Errors()[0]
+	if pos.line == 0 {
+		return nil, newError("error parsing %s: %s", what, msg)
+	}
+	d := diagnostics.FromMessage(msg)
+	return nil, &Error{Message: fmt.Sprintf("error parsing %s: %s", what, d.Message), Line: d.Line, Column: d.Column}
+}
@@ -0,0 +1,166 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/sambeau/parsley/pkg/ast"
+	"github.com/sambeau/parsley/pkg/diagnostics"
+	"github.com/sambeau/parsley/pkg/lexer"
+)
+
+// Errors carry hints and notes for pars to print under the source line:
+//
+//	line 3, column 7: identifier not found: formatdate
+//	    let d = formatdate(now)
+//	            ^~~~~~~~~~
+//	    help: did you mean `formatDate`?
+
+// envBuiltinNames are the builtins Eval handles itself because they need the
+// environment, so they aren't in getBuiltins()
+var envBuiltinNames = []string{
+	"import", "log", "logLine", "task", "eval", "sh", "lock", "withLock",
+	"writePDF", "snapshot", "provide", "inject", "provided", "mock", "SFTP",
+	"parallel", "walk", "serve", "attempt", "stream", "select", "retry", "timeIt",
+	"tokens", "checkLinks",
+}
+
+// isBuiltinName reports whether name is a builtin function
+func isBuiltinName(name string) bool {
+	if _, ok := getBuiltins()[name]; ok {
+		return true
+	}
+	for _, n := range envBuiltinNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// identifierHint suggests a variable or builtin for a name that isn't
+// defined, or returns ""
+func identifierHint(name string, env *Environment) string {
+	candidates := append([]string{}, envBuiltinNames...)
+	for n := range getBuiltins() {
+		candidates = append(candidates, n)
+	}
+	for e := env; e != nil; e = e.outer {
+		for n := range e.store {
+			candidates = append(candidates, n)
+		}
+	}
+	if s := diagnostics.Suggest(name, candidates); s != "" {
+		return fmt.Sprintf("did you mean `%s`?", s)
+	}
+	return ""
+}
+
+// declare records where a let binding was declared
+func (e *Environment) declare(name *ast.Identifier) {
+	if e.declared == nil {
+		e.declared = make(map[string]lexer.Token)
+	}
+	e.declared[name.Value] = name.Token
+}
+
+// declaration returns where the binding name resolves to was declared
+func (e *Environment) declaration(name string) (lexer.Token, bool) {
+	for ; e != nil; e = e.outer {
+		if _, ok := e.store[name]; ok {
+			tok, ok := e.declared[name]
+			return tok, ok
+		}
+	}
+	return lexer.Token{}, false
+}
+
+// notCallableError gives a "not a function" error from calling a variable the
+// variable's position, and a note saying where it was declared
+func notCallableError(err *Error, ident *ast.Identifier, env *Environment) *Error {
+	located := *err
+	located.Line = ident.Token.Line
+	located.Column = ident.Token.Column
+	located.Length = len(ident.Value)
+
+	if tok, ok := env.declaration(ident.Value); ok {
+		msg := fmt.Sprintf("`%s` is declared here", ident.Value)
+		if isBuiltinName(ident.Value) {
+			msg = fmt.Sprintf("`%s` is declared here, hiding the builtin `%s`", ident.Value, ident.Value)
+			located.Hint = "rename the variable to use the builtin"
+		}
+		located.Notes = append(located.Notes, ErrorNote{Message: msg, Line: tok.Line, Column: tok.Column})
+	}
+	return &located
+}
+
+// notExportedError explains why a module has no export called name
+func notExportedError(name *ast.Identifier, path string, module *Dictionary) *Error {
+	var exports []string
+	for key := range module.Pairs {
+		exports = append(exports, key)
+	}
+	modEnv := module.Env
+	if modEnv != nil {
+		if _, defined := modEnv.store[name.Value]; defined {
+			errObj := newErrorWithPos(name.Token, "%s is not exported by %s", name.Value, path)
+			if modEnv.letBindings[name.Value] {
+				errObj.Hint = "let bindings are only exported outside strict mode; declare it with `export let`"
+			} else {
+				errObj.Hint = "declare it with `export` to import it"
+			}
+			return errObj
+		}
+	}
+	errObj := newErrorWithPos(name.Token, "%s has no export named %s", path, name.Value)
+	if s := diagnostics.Suggest(name.Value, exports); s != "" {
+		errObj.Hint = fmt.Sprintf("did you mean `%s`?", s)
+	}
+	return errObj
+}
+
+// Errors in imported modules say which module they're in, and the imports
+// that led there, so pars can show the module's source:
+//
+//	Error in 'lib/util.pars':
+//	  line 2, column 9: identifier not found: titel
+//	    export title = titel
+//	                   ^~~~~
+//	  imported from 'page.pars', line 1, column 12
+
+// ErrorImport is an import() call an error in a module was reached through
+type ErrorImport struct {
+	File   string
+	Line   int
+	Column int
+}
+
+// moduleParseError reports the syntax errors in a module at the first, with
+// the others as notes
+func moduleParseError(path string, errors []string) *Error {
+	first := diagnostics.FromMessage(errors[0])
+	errObj := &Error{Message: first.Message, Line: first.Line, Column: first.Column, File: path}
+	for _, msg := range errors[1:] {
+		d := diagnostics.FromMessage(msg)
+		errObj.Notes = append(errObj.Notes, ErrorNote{Message: d.Message, Line: d.Line, Column: d.Column})
+	}
+	return errObj
+}
+
+// importedFrom adds the import() call at tok to an error from a module
+func importedFrom(err *Error, tok lexer.Token, env *Environment) *Error {
+	located := *err
+	located.Imports = append(append([]ErrorImport{}, err.Imports...),
+		ErrorImport{File: env.Filename, Line: tok.Line, Column: tok.Column})
+	return &located
+}
+
+// errorInFile records that an error from a function declared in fnFile, and
+// called from callerFile, is in fnFile
+func errorInFile(err *Error, fnFile, callerFile string) *Error {
+	if err.File != "" || err.Line == 0 || fnFile == "" || fnFile == callerFile {
+		return err
+	}
+	located := *err
+	located.File = fnFile
+	return &located
+}
@@ -0,0 +1,241 @@
+package evaluator
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Requests go through HTTP_PROXY, HTTPS_PROXY and NO_PROXY like other
+// tools. A request's options can choose its own proxy and TLS settings for
+// internal services and corporate networks:
+//
+//	JSON(@https://intranet/api, {
+//	    proxy: @http://proxy.corp:3128,
+//	    caCert: @./corp-ca.pem,
+//	    clientCert: @./me.pem, clientKey: @./me.key
+//	})
+//
+// {insecureTLS: true} skips certificate verification altogether.
+
+// transportOptions are the request options that need their own transport
+var transportOptions = []string{"proxy", "caCert", "clientCert", "clientKey", "insecureTLS"}
+
+var (
+	transportsMu sync.Mutex
+	transports   = map[string]*http.Transport{}
+)
+
+// httpClient returns a client for a request handle, with a transport for its
+// proxy and TLS options if it has any
+func httpClient(reqDict *Dictionary, timeout time.Duration, env *Environment) (*http.Client, error) {
+	client := &http.Client{Timeout: timeout}
+
+	opts := map[string]Object{}
+	for _, key := range transportOptions {
+		if expr, ok := reqDict.Pairs[key]; ok {
+			opts[key] = Eval(expr, env)
+		}
+	}
+	if len(opts) == 0 {
+		return client, nil
+	}
+
+	proxy, err := proxyOption(opts["proxy"])
+	if err != nil {
+		return nil, err
+	}
+	var paths [3]string
+	for i, key := range []string{"caCert", "clientCert", "clientKey"} {
+		if paths[i], err = certFileOption(key, opts[key], env); err != nil {
+			return nil, err
+		}
+	}
+	if (paths[1] == "") != (paths[2] == "") {
+		return nil, fmt.Errorf("clientCert and clientKey must be given together")
+	}
+	insecure := false
+	if val, ok := opts["insecureTLS"]; ok {
+		b, ok := val.(*Boolean)
+		if !ok {
+			return nil, fmt.Errorf("insecureTLS must be a boolean, got %s", val.Type())
+		}
+		insecure = b.Value
+	}
+
+	_, noProxy := opts["proxy"].(*Null)
+
+	// Transports keep connections open, so requests with the same settings
+	// share one
+	key := fmt.Sprint(proxy, noProxy, paths, insecure)
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+	if transport, ok := transports[key]; ok {
+		client.Transport = transport
+		return client, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy != nil {
+		transport.Proxy = http.ProxyURL(proxy)
+	} else if noProxy {
+		transport.Proxy = nil
+	}
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: insecure}
+	if paths[0] != "" {
+		pem, err := os.ReadFile(paths[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read caCert: %s", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in caCert %s", paths[0])
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+	if paths[1] != "" {
+		cert, err := tls.LoadX509KeyPair(paths[1], paths[2])
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %s", err)
+		}
+		transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transports[key] = transport
+	client.Transport = transport
+	return client, nil
+}
+
+// proxyOption reads the proxy option: a URL, or null for no proxy
+func proxyOption(val Object) (*url.URL, error) {
+	var raw string
+	switch v := val.(type) {
+	case nil, *Null:
+		return nil, nil
+	case *String:
+		raw = v.Value
+	case *Url:
+		raw = v.Inspect()
+	default:
+		return nil, fmt.Errorf("proxy must be a URL, got %s", val.Type())
+	}
+	proxy, err := url.Parse(raw)
+	if err != nil || proxy.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %s", strconv.Quote(raw))
+	}
+	return proxy, nil
+}
+
+// certFileOption resolves a certificate or key option to an absolute path,
+// checking it may be read
+func certFileOption(key string, val Object, env *Environment) (string, error) {
+	var pathStr string
+	switch v := val.(type) {
+	case nil:
+		return "", nil
+	case *String:
+		pathStr = v.Value
+	case *Path:
+		pathStr = v.Inspect()
+	default:
+		return "", fmt.Errorf("%s must be a path, got %s", key, val.Type())
+	}
+	absPath, err := resolveModulePath(pathStr, env.Filename)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %s", key, err)
+	}
+	if err := env.checkPathAccess(absPath, "read"); err != nil {
+		return "", fmt.Errorf("security: %s", err)
+	}
+	return absPath, nil
+}
+
+// fetchRetries is how a request retries transient failures: network errors
+// and 5xx responses. Each retry waits twice as long as the one before.
+type fetchRetries struct {
+	retries int
+	backoff time.Duration
+}
+
+// defaultFetchBackoff is the wait before the first retry
+const defaultFetchBackoff = time.Second
+
+// requestTimeout reads a request's timeout, a duration or milliseconds
+// (30 seconds by default). Each attempt gets the whole timeout.
+func requestTimeout(reqDict *Dictionary, env *Environment) (time.Duration, error) {
+	expr, ok := reqDict.Pairs["timeout"]
+	if !ok {
+		return 30 * time.Second, nil
+	}
+	switch v := Eval(expr, env).(type) {
+	case *Integer:
+		return time.Duration(v.Value) * time.Millisecond, nil
+	case *Duration:
+		d, err := v.toGo()
+		if err == nil && d > 0 {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("`timeout` option must be a positive duration or a number of milliseconds")
+}
+
+// requestRetries reads a request's retries and backoff options
+func requestRetries(reqDict *Dictionary, env *Environment) (fetchRetries, error) {
+	policy := fetchRetries{backoff: defaultFetchBackoff}
+	if expr, ok := reqDict.Pairs["retries"]; ok {
+		n, ok := Eval(expr, env).(*Integer)
+		if !ok || n.Value < 0 {
+			return policy, fmt.Errorf("`retries` option must be a non-negative integer")
+		}
+		policy.retries = int(n.Value)
+	}
+	if expr, ok := reqDict.Pairs["backoff"]; ok {
+		dur, ok := Eval(expr, env).(*Duration)
+		if !ok {
+			return policy, fmt.Errorf("`backoff` option must be a duration")
+		}
+		d, err := dur.toGo()
+		if err != nil || d < 0 {
+			return policy, fmt.Errorf("`backoff` option must be a positive duration without months or years")
+		}
+		policy.backoff = d
+	}
+	return policy, nil
+}
+
+// sendWithRetries sends a request, retrying transient failures. It returns
+// the last attempt's response and how many attempts it made.
+func sendWithRetries(client *http.Client, req *http.Request, policy fetchRetries) (*http.Response, int, error) {
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		resp, err := sendRequest(client, req)
+		transient := err != nil || resp.StatusCode >= 500
+		if !transient || attempt > policy.retries {
+			return resp, attempt, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		recordHTTPRequest(start, 0)
+
+		time.Sleep(policy.backoff << (attempt - 1))
+
+		// The body was read by the last attempt, so send a fresh copy
+		if req.GetBody != nil {
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return nil, attempt, bodyErr
+			}
+			req.Body = body
+		}
+	}
+}
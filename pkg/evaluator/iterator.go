@@ -0,0 +1,344 @@
+package evaluator
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Iterators are lazy sequences made by iter(fn). fn is called with a yield
+// function and calls yield(x) for each element:
+//
+//	let pages = iter(fn(yield) {
+//	    for (url in urls) { yield(JSON(url)) }
+//	})
+//
+// Nothing runs until the iterator is consumed by for, a method or a write,
+// and elements are handed to the consumer one at a time, so they're never
+// all in memory at once unless collected with toArray(). Each time an
+// iterator is consumed its function runs again from the start.
+//
+// When a consumer stops early (take(n), or an error in a for body), yield
+// returns an error that unwinds the generator function. attempt() doesn't
+// catch it, so the function can't carry on generating.
+
+// sequence runs through a sequence of values, passing each to visit. A
+// non-nil result from visit stops the sequence and is returned; otherwise
+// sequence returns nil, or an error from generating the values.
+type sequence func(visit func(Object) Object) Object
+
+// Iterator is a lazy sequence of values
+type Iterator struct {
+	each sequence
+}
+
+func (it *Iterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *Iterator) Inspect() string  { return "<iterator>" }
+
+// eachElement returns the sequence of an array's elements
+func eachElement(elements []Object) sequence {
+	return func(visit func(Object) Object) Object {
+		for _, elem := range elements {
+			if result := visit(elem); result != nil {
+				return result
+			}
+		}
+		return nil
+	}
+}
+
+// newGenerator returns an iterator that runs fn with a yield function
+func newGenerator(fn Object) Object {
+	switch f := fn.(type) {
+	case *Function:
+		if f.ParamCount() != 1 {
+			return newError("function passed to `iter` must take 1 parameter (yield), got %d", f.ParamCount())
+		}
+	case *Builtin:
+	default:
+		return newError("argument to `iter` must be a function, got %s", fn.Type())
+	}
+
+	return &Iterator{each: func(visit func(Object) Object) Object {
+		var stop Object
+		stopped, finished := false, false
+
+		yield := &Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments to `yield`. got=%d, want=1", len(args))
+			}
+			if finished {
+				return newError("yield called after its iterator finished")
+			}
+			if stopped {
+				return &Error{Message: "iteration stopped", stop: true}
+			}
+			if result := visit(args[0]); result != nil {
+				stopped, stop = true, result
+				return &Error{Message: "iteration stopped", stop: true}
+			}
+			// NULL, so for loops in the generator don't collect anything
+			return NULL
+		}}
+
+		result := applyFunction(fn, []Object{yield})
+		finished = true
+		if stopped {
+			return stop
+		}
+		if isError(result) {
+			return result
+		}
+		return nil
+	}}
+}
+
+// toArray collects an iterator's elements
+func (it *Iterator) toArray() Object {
+	elements := []Object{}
+	errObj := it.each(func(elem Object) Object {
+		elements = append(elements, elem)
+		return nil
+	})
+	if errObj != nil {
+		return errObj
+	}
+	return &Array{Elements: elements}
+}
+
+// collectIterator returns value, or its elements if it's an iterator or a
+// range
+func collectIterator(value Object) Object {
+	switch v := value.(type) {
+	case *Iterator:
+		return v.toArray()
+	case *Range:
+		return v.toArray()
+	}
+	return value
+}
+
+// evalIteratorMethod evaluates a method call on an Iterator. map, filter and
+// take return new iterators; toArray consumes the iterator.
+func evalIteratorMethod(it *Iterator, method string, args []Object) Object {
+	switch method {
+	case "toArray":
+		if len(args) != 0 {
+			return newError("wrong number of arguments to `toArray`. got=%d, want=0", len(args))
+		}
+		return it.toArray()
+
+	case "map", "filter":
+		if len(args) != 1 {
+			return newError("wrong number of arguments to `%s`. got=%d, want=1", method, len(args))
+		}
+		fn := args[0]
+		switch fn.(type) {
+		case *Function, *Builtin:
+		default:
+			return newError("argument to '%s' must be a function, got %s", method, fn.Type())
+		}
+
+		return &Iterator{each: func(visit func(Object) Object) Object {
+			return it.each(func(elem Object) Object {
+				result := applyFunction(fn, []Object{elem})
+				if isError(result) {
+					return result
+				}
+				if method == "filter" {
+					if !isTruthy(result) {
+						return nil
+					}
+					return visit(elem)
+				}
+				// Like array map, null results are skipped
+				if result == NULL {
+					return nil
+				}
+				return visit(result)
+			})
+		}}
+
+	case "take":
+		if len(args) != 1 {
+			return newError("wrong number of arguments to `take`. got=%d, want=1", len(args))
+		}
+		n, ok := args[0].(*Integer)
+		if !ok || n.Value < 0 {
+			return newError("argument to `take` must be a non-negative integer, got %s", args[0].Inspect())
+		}
+
+		return &Iterator{each: func(visit func(Object) Object) Object {
+			if n.Value == 0 {
+				return nil
+			}
+			done := &Error{Message: "take finished"}
+			count := int64(0)
+			result := it.each(func(elem Object) Object {
+				if result := visit(elem); result != nil {
+					return result
+				}
+				count++
+				if count == n.Value {
+					return done
+				}
+				return nil
+			})
+			if result == done {
+				return nil
+			}
+			return result
+		}}
+
+	default:
+		return newError("unknown method '%s' for iterator", method)
+	}
+}
+
+// writeLinesStream writes an iterator in the lines format as its elements
+// are generated, rather than collecting them first
+func writeLinesStream(it *Iterator, fileDict *Dictionary, pathStr, stdioStream string, opts writeOptions, appendMode bool, env *Environment) *Error {
+	if stdioStream != "" {
+		w := os.Stdout
+		if stdioStream == "stderr" {
+			w = os.Stderr
+		}
+		cw := &countingWriter{w: w}
+		errObj := streamLines(cw, it, fileDict, false, false, env)
+		recordOutput(cw.n)
+		return errObj
+	}
+
+	if env.Security != nil && env.Security.DryRun {
+		// The lines are still generated, to say how much would be written
+		cw := &countingWriter{w: io.Discard}
+		if errObj := streamLines(cw, it, fileDict, false, appendMode, env); errObj != nil {
+			return errObj
+		}
+		verb := "write"
+		if appendMode {
+			verb = "append"
+		}
+		env.dryRun("%s %d bytes to %s", verb, cw.n, pathStr)
+		return nil
+	}
+
+	if opts.atomic {
+		tmp, err := os.CreateTemp(filepath.Dir(pathStr), "."+filepath.Base(pathStr)+".tmp-*")
+		if err != nil {
+			return newError("failed to write to file '%s': %s", pathStr, err.Error())
+		}
+		tmpName := tmp.Name()
+		cw := &countingWriter{w: tmp}
+		if errObj := streamLines(cw, it, fileDict, true, false, env); errObj != nil {
+			tmp.Close()
+			os.Remove(tmpName)
+			return errObj
+		}
+		err = tmp.Sync()
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Chmod(tmpName, opts.mode)
+		}
+		if err == nil {
+			err = os.Rename(tmpName, pathStr)
+		}
+		if err != nil {
+			os.Remove(tmpName)
+			return newError("failed to write to file '%s': %s", pathStr, err.Error())
+		}
+		recordFileWrite(cw.n)
+		return nil
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	addBOM := true
+	if appendMode {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		addBOM = fileIsEmpty(pathStr)
+	}
+	f, err := os.OpenFile(pathStr, flags, opts.mode)
+	if err != nil {
+		return newError("failed to open file '%s' for writing: %s", pathStr, err.Error())
+	}
+	cw := &countingWriter{w: f}
+	errObj := streamLines(cw, it, fileDict, addBOM, appendMode, env)
+	recordFileWrite(cw.n)
+	if err := f.Close(); err != nil && errObj == nil {
+		errObj = newError("failed to write to file '%s': %s", pathStr, err.Error())
+	}
+	if errObj != nil {
+		return errObj
+	}
+
+	// os.OpenFile only applies the mode to new files
+	if opts.hasMode {
+		if err := os.Chmod(pathStr, opts.mode); err != nil {
+			return newError("failed to write to file '%s': %s", pathStr, err.Error())
+		}
+	}
+	return nil
+}
+
+// streamLines writes each element of an iterator as a line of text, with the
+// file handle's newline, bom and encoding options applied. Lines are
+// separated, as in encodeLines, or terminated when appending, so later
+// appends start on a new line.
+func streamLines(w io.Writer, it *Iterator, fileDict *Dictionary, addBOM, terminate bool, env *Environment) *Error {
+	buf := bufio.NewWriter(w)
+	var out io.Writer = buf
+
+	enc, errObj := fileTextEncoding(fileDict, env)
+	if errObj != nil {
+		return errObj
+	}
+	if enc != nil {
+		out = enc.NewEncoder().Writer(buf)
+	}
+
+	first := true
+	result := it.each(func(elem Object) Object {
+		var line strings.Builder
+		if !first && !terminate {
+			line.WriteString("\n")
+		}
+		if str, ok := elem.(*String); ok {
+			line.WriteString(str.Value)
+		} else {
+			line.WriteString(elem.Inspect())
+		}
+		if terminate {
+			line.WriteString("\n")
+		}
+
+		data, errObj := applyTextWriteOptions(fileDict, []byte(line.String()), addBOM && first, env)
+		if errObj != nil {
+			return errObj
+		}
+		first = false
+		if _, err := out.Write(data); err != nil {
+			return newError("failed to write lines: %s", err.Error())
+		}
+		return nil
+	})
+	if result != nil {
+		if errObj, ok := result.(*Error); ok {
+			return errObj
+		}
+		return newError("failed to write lines: %s", result.Inspect())
+	}
+
+	if closer, ok := out.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			return newError("failed to write lines: %s", err.Error())
+		}
+	}
+	if err := buf.Flush(); err != nil {
+		return newError("failed to write lines: %s", err.Error())
+	}
+	return nil
+}
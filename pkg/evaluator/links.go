@@ -0,0 +1,616 @@
+package evaluator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// checkLinks(dir, options?) checks the links in a generated site: every
+// href and src in its HTML files must lead to a file in the site, and a
+// #fragment to an id on that page. It's meant as the last step of a build:
+//
+//	task("check", {deps: ["build"]}) {
+//	    checkLinks(@./public, {onBroken: "error"})
+//	}
+//
+// Links are resolved the way a static file server would: /about finds
+// about, about.html or about/index.html. If the site has a sitemap.xml, the
+// pages it lists are checked too, and absolute links to the sitemap's host
+// count as internal. Other http(s) links are only checked with
+// {external: true}: each URL once, a few at a time, with a pause between
+// requests to the same host. Links that worked can be kept in a cache file
+// so the next run doesn't check them again until they're older than ttl.
+
+// linkAttrs are the attributes that hold links, by tag
+var linkAttrs = map[string][]string{
+	"a":      {"href"},
+	"area":   {"href"},
+	"link":   {"href"},
+	"img":    {"src", "srcset"},
+	"script": {"src"},
+	"iframe": {"src"},
+	"embed":  {"src"},
+	"source": {"src", "srcset"},
+	"track":  {"src"},
+	"audio":  {"src"},
+	"video":  {"src", "poster"},
+}
+
+// sitemapLocRegex finds the page URLs in a sitemap
+var sitemapLocRegex = regexp.MustCompile(`<loc>\s*([^<\s]+)\s*</loc>`)
+
+// linkCheckOptions holds the options for checkLinks()
+type linkCheckOptions struct {
+	external    bool
+	timeout     time.Duration
+	concurrency int
+	hostDelay   time.Duration // the least time between requests to one host
+	cache       string        // path of the cache file, if any
+	ttl         time.Duration // how long a cached link is trusted
+	onBroken    string        // "result" or "error"
+}
+
+// defaultLinkCheckOptions are the options checkLinks() uses unless told
+// otherwise
+func defaultLinkCheckOptions() linkCheckOptions {
+	return linkCheckOptions{timeout: 10 * time.Second, concurrency: 8, ttl: 24 * time.Hour, onBroken: "result"}
+}
+
+// siteLink is a link found on a page
+type siteLink struct {
+	page string // the page's path in the site, with forward slashes
+	href string
+}
+
+// brokenLink is a link that doesn't lead anywhere, and why
+type brokenLink struct {
+	siteLink
+	reason string
+}
+
+// linkChecker checks the links in one site
+type linkChecker struct {
+	root   string
+	opts   linkCheckOptions
+	origin string                     // scheme://host from the sitemap, if any
+	ids    map[string]map[string]bool // ids on each page, read when first needed
+	remote map[string]string          // results of external checks, by URL
+	cached int                        // external links answered from the cache
+	env    *Environment
+}
+
+// linkKind says how a link is checked
+type linkKind int
+
+const (
+	linkSkipped  linkKind = iota // mailto:, tel:, data: and the like
+	linkInternal                 // a file in the site
+	linkExternal                 // a URL on another site
+)
+
+func parseLinkCheckOptions(opts *Dictionary, env *Environment) (linkCheckOptions, *Error) {
+	lo := defaultLinkCheckOptions()
+	for key, expr := range opts.Pairs {
+		val := Eval(expr, opts.Env)
+		switch key {
+		case "external":
+			b, ok := val.(*Boolean)
+			if !ok {
+				return lo, newError("`external` option for `checkLinks` must be a boolean")
+			}
+			lo.external = b.Value
+		case "timeout":
+			dur, ok := val.(*Duration)
+			if !ok {
+				return lo, newError("`timeout` option for `checkLinks` must be a duration")
+			}
+			d, err := dur.toGo()
+			if err != nil || d <= 0 {
+				return lo, newError("`timeout` option for `checkLinks` must be a positive duration without months or years")
+			}
+			lo.timeout = d
+		case "concurrency":
+			n, ok := val.(*Integer)
+			if !ok || n.Value < 1 {
+				return lo, newError("`concurrency` option for `checkLinks` must be a positive integer")
+			}
+			lo.concurrency = int(n.Value)
+		case "hostDelay", "ttl":
+			dur, ok := val.(*Duration)
+			if !ok {
+				return lo, newError("`%s` option for `checkLinks` must be a duration", key)
+			}
+			d, err := dur.toGo()
+			if err != nil || d < 0 {
+				return lo, newError("`%s` option for `checkLinks` must be a duration without months or years", key)
+			}
+			if key == "ttl" {
+				lo.ttl = d
+			} else {
+				lo.hostDelay = d
+			}
+		case "cache":
+			var pathStr string
+			switch v := val.(type) {
+			case *String:
+				pathStr = v.Value
+			case *Path:
+				pathStr = v.Inspect()
+			default:
+				return lo, newError("`cache` option for `checkLinks` must be a path or string, got %s", val.Type())
+			}
+			absPath, err := resolveModulePath(pathStr, env.Filename)
+			if err != nil {
+				return lo, newError("failed to resolve path '%s': %s", pathStr, err.Error())
+			}
+			lo.cache = absPath
+		case "onBroken":
+			s, ok := val.(*String)
+			if !ok || (s.Value != "result" && s.Value != "error") {
+				return lo, newError("`onBroken` option for `checkLinks` must be \"result\" or \"error\"")
+			}
+			lo.onBroken = s.Value
+		default:
+			return lo, newError("unknown option `%s` for `checkLinks`", key)
+		}
+	}
+	return lo, nil
+}
+
+// evalCheckLinks implements checkLinks(dir, options?)
+func evalCheckLinks(args []Object, env *Environment) Object {
+	if len(args) < 1 || len(args) > 2 {
+		return newError("wrong number of arguments to `checkLinks`. got=%d, want=1 or 2", len(args))
+	}
+
+	var root string
+	switch arg := args[0].(type) {
+	case *Path:
+		root = arg.Inspect()
+	case *Dictionary:
+		if !isDirDict(arg) {
+			return newError("first argument to `checkLinks` must be a path or directory, got dictionary")
+		}
+		root = getFilePathString(arg, env)
+	case *String:
+		root = arg.Value
+	default:
+		return newError("first argument to `checkLinks` must be a path or directory, got %s", args[0].Type())
+	}
+	root = ExpandHome(root)
+
+	opts := defaultLinkCheckOptions()
+	if len(args) == 2 {
+		optsDict, ok := args[1].(*Dictionary)
+		if !ok {
+			return newError("second argument to `checkLinks` must be a dictionary, got %s", args[1].Type())
+		}
+		var errObj *Error
+		if opts, errObj = parseLinkCheckOptions(optsDict, env); errObj != nil {
+			return errObj
+		}
+	}
+
+	if err := env.checkPathAccess(root, "read"); err != nil {
+		return newError("security: %s", err.Error())
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return newError("failed to read directory '%s': %s", root, err.Error())
+	}
+	if !info.IsDir() {
+		return newError("first argument to `checkLinks` must be a directory, got file '%s'", root)
+	}
+
+	c := &linkChecker{root: root, opts: opts, ids: map[string]map[string]bool{}, remote: map[string]string{}, env: env}
+	pages, links, err := c.collect()
+	if err != nil {
+		return newError("checkLinks(): %s", err.Error())
+	}
+
+	if opts.external {
+		if errObj := c.checkExternal(links); errObj != nil {
+			return errObj
+		}
+	}
+
+	var broken []brokenLink
+	for _, link := range links {
+		if reason := c.check(link); reason != "" {
+			broken = append(broken, brokenLink{link, reason})
+		}
+	}
+	sort.SliceStable(broken, func(i, j int) bool { return broken[i].page < broken[j].page })
+
+	if len(broken) > 0 && opts.onBroken == "error" {
+		var msg strings.Builder
+		fmt.Fprintf(&msg, "%d broken links in %s:", len(broken), root)
+		for _, b := range broken {
+			fmt.Fprintf(&msg, "\n  %s: %s (%s)", b.page, b.href, b.reason)
+		}
+		return newError("%s", msg.String())
+	}
+
+	items := make([]Object, len(broken))
+	for i, b := range broken {
+		items[i] = NewDictionaryFromObjects(map[string]Object{
+			"page":   &String{Value: b.page},
+			"link":   &String{Value: b.href},
+			"reason": &String{Value: b.reason},
+		})
+	}
+	return NewDictionaryFromObjects(map[string]Object{
+		"ok":       nativeBoolToParsBoolean(len(broken) == 0),
+		"pages":    &Integer{Value: int64(pages)},
+		"links":    &Integer{Value: int64(len(links))},
+		"external": &Integer{Value: int64(len(c.remote))},
+		"cached":   &Integer{Value: int64(c.cached)},
+		"broken":   &Array{Elements: items},
+	})
+}
+
+// collect reads the links from every HTML page in the site, and from its
+// sitemap, recording each page's ids as it goes
+func (c *linkChecker) collect() (int, []siteLink, error) {
+	var links []siteLink
+	pages := 0
+	err := filepath.WalkDir(c.root, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isHTMLFile(p) {
+			return nil
+		}
+		rel, _ := filepath.Rel(c.root, p)
+		page := filepath.ToSlash(rel)
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		recordFileRead(len(data))
+		pages++
+		hrefs, ids := scanHTMLLinks(data)
+		c.ids[page] = ids
+		for _, href := range hrefs {
+			links = append(links, siteLink{page: page, href: href})
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if data, err := os.ReadFile(filepath.Join(c.root, "sitemap.xml")); err == nil {
+		for _, m := range sitemapLocRegex.FindAllSubmatch(data, -1) {
+			loc := html.UnescapeString(string(m[1]))
+			if c.origin == "" {
+				if u, err := url.Parse(loc); err == nil && u.Host != "" {
+					c.origin = u.Scheme + "://" + u.Host
+				}
+			}
+			links = append(links, siteLink{page: "sitemap.xml", href: loc})
+		}
+	}
+	return pages, links, nil
+}
+
+func isHTMLFile(p string) bool {
+	ext := strings.ToLower(filepath.Ext(p))
+	return ext == ".html" || ext == ".htm"
+}
+
+// scanHTMLLinks returns the links in a page and the ids (and anchor names)
+// that fragments can point to
+func scanHTMLLinks(data []byte) ([]string, map[string]bool) {
+	var hrefs []string
+	ids := map[string]bool{}
+	z := html.NewTokenizer(strings.NewReader(string(data)))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return hrefs, ids
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		tok := z.Token()
+		attrs := linkAttrs[tok.Data]
+		for _, a := range tok.Attr {
+			switch {
+			case a.Key == "id" || (a.Key == "name" && tok.Data == "a"):
+				ids[a.Val] = true
+			case a.Key == "srcset" && containsString(attrs, a.Key):
+				// srcset is a list of "url width" candidates
+				for _, candidate := range strings.Split(a.Val, ",") {
+					if fields := strings.Fields(candidate); len(fields) > 0 {
+						hrefs = append(hrefs, fields[0])
+					}
+				}
+			case containsString(attrs, a.Key):
+				if v := strings.TrimSpace(a.Val); v != "" {
+					hrefs = append(hrefs, v)
+				}
+			}
+		}
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// classify works out how a link is checked. Internal links come back as a
+// path and fragment; external ones as the URL to request.
+func (c *linkChecker) classify(href string) (*url.URL, linkKind, error) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return nil, linkSkipped, err
+	}
+	switch {
+	case u.Scheme == "" && u.Host == "":
+		// A relative or root-relative link
+		return u, linkInternal, nil
+	case u.Host != "" && c.origin != "" && (u.Scheme+"://"+u.Host == c.origin || u.Scheme == "" && strings.HasSuffix(c.origin, "://"+u.Host)):
+		// An absolute link to this site, such as a sitemap entry
+		local := &url.URL{Path: u.Path, Fragment: u.Fragment}
+		if local.Path == "" {
+			local.Path = "/"
+		}
+		return local, linkInternal, nil
+	case u.Scheme == "http" || u.Scheme == "https" || (u.Scheme == "" && u.Host != ""):
+		if u.Scheme == "" {
+			u.Scheme = "https"
+		}
+		u.Fragment = ""
+		return u, linkExternal, nil
+	}
+	return u, linkSkipped, nil
+}
+
+// check returns why a link is broken, or "" if it isn't. External links
+// must already have been checked by checkExternal.
+func (c *linkChecker) check(link siteLink) string {
+	u, kind, err := c.classify(link.href)
+	switch {
+	case err != nil:
+		return "invalid URL"
+	case kind == linkSkipped:
+		return ""
+	case kind == linkExternal:
+		return c.remote[u.String()]
+	}
+
+	// Resolve the path against the page, within the site
+	target := link.page
+	if u.Path != "" {
+		p := u.Path
+		if !strings.HasPrefix(p, "/") {
+			p = path.Join(path.Dir(link.page), p)
+			if p == ".." || strings.HasPrefix(p, "../") {
+				return "outside the site"
+			}
+			p = "/" + p
+		}
+		if strings.HasSuffix(u.Path, "/") && p != "/" {
+			p += "/"
+		}
+		var ok bool
+		if target, ok = c.resolve(p); !ok {
+			return "not found"
+		}
+	}
+
+	if u.Fragment != "" && isHTMLFile(target) {
+		ids, ok := c.ids[target]
+		if !ok {
+			return ""
+		}
+		if !ids[u.Fragment] {
+			return "no #" + u.Fragment + " on " + target
+		}
+	}
+	return ""
+}
+
+// resolve finds the file a site path is served from: the file itself,
+// the path with .html added, or an index.html in it
+func (c *linkChecker) resolve(p string) (string, bool) {
+	rel := strings.TrimPrefix(path.Clean(p), "/")
+	if rel == "" {
+		rel = "."
+	}
+	candidates := []string{rel, rel + ".html", path.Join(rel, "index.html")}
+	if strings.HasSuffix(p, "/") {
+		candidates = []string{path.Join(rel, "index.html")}
+	}
+	for _, candidate := range candidates {
+		info, err := os.Stat(filepath.Join(c.root, filepath.FromSlash(candidate)))
+		if err == nil && !info.IsDir() {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// hostLimiter spaces out the requests to one host
+type hostLimiter struct {
+	mu   sync.Mutex
+	next time.Time
+}
+
+// wait blocks until the next request to the host may be sent
+func (h *hostLimiter) wait(delay time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if d := time.Until(h.next); d > 0 {
+		time.Sleep(d)
+	}
+	h.next = time.Now().Add(delay)
+}
+
+// checkExternal checks each external URL in links once, up to
+// opts.concurrency at a time, and records the results in c.remote
+func (c *linkChecker) checkExternal(links []siteLink) *Error {
+	cache, errObj := readLinkCache(c.opts.cache, c.env)
+	if errObj != nil {
+		return errObj
+	}
+
+	var urls []*url.URL
+	for _, link := range links {
+		u, kind, err := c.classify(link.href)
+		if err != nil || kind != linkExternal {
+			continue
+		}
+		key := u.String()
+		if _, seen := c.remote[key]; seen {
+			continue
+		}
+		c.remote[key] = ""
+		if checked, ok := cache[key]; ok && time.Since(checked) < c.opts.ttl {
+			c.cached++
+			continue
+		}
+		urls = append(urls, u)
+	}
+
+	client := &http.Client{Timeout: c.opts.timeout}
+	reasons := make([]string, len(urls))
+	var limitersMu sync.Mutex
+	limiters := map[string]*hostLimiter{}
+	var next int64 = -1
+	var wg sync.WaitGroup
+	for w := 0; w < c.opts.concurrency && w < len(urls); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= len(urls) {
+					return
+				}
+				limitersMu.Lock()
+				limiter := limiters[urls[i].Host]
+				if limiter == nil {
+					limiter = &hostLimiter{}
+					limiters[urls[i].Host] = limiter
+				}
+				limitersMu.Unlock()
+				limiter.wait(c.opts.hostDelay)
+				reasons[i] = checkRemoteLink(client, urls[i].String())
+			}
+		}()
+	}
+	wg.Wait()
+
+	now := time.Now()
+	for i, u := range urls {
+		c.remote[u.String()] = reasons[i]
+		if reasons[i] == "" {
+			cache[u.String()] = now
+		}
+	}
+	return writeLinkCache(c.opts.cache, cache, c.opts.ttl, c.env)
+}
+
+// checkRemoteLink checks an external link with a HEAD request, falling back
+// to GET for servers that don't allow HEAD, and returns why it's broken
+func checkRemoteLink(client *http.Client, link string) string {
+	for _, method := range []string{"HEAD", "GET"} {
+		req, err := http.NewRequest(method, link, nil)
+		if err != nil {
+			return "invalid URL"
+		}
+		start := time.Now()
+		resp, err := sendRequest(client, req)
+		if err != nil {
+			recordHTTPRequest(start, 0)
+			return "fetch failed: " + err.Error()
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+		resp.Body.Close()
+		recordHTTPRequest(start, 0)
+		if method == "HEAD" && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+			continue
+		}
+		if resp.StatusCode >= 400 {
+			return fmt.Sprintf("HTTP %d", resp.StatusCode)
+		}
+		return ""
+	}
+	return ""
+}
+
+// readLinkCache reads the external links that worked, and when each was
+// checked. A missing cache file is an empty cache.
+func readLinkCache(absPath string, env *Environment) (map[string]time.Time, *Error) {
+	cache := map[string]time.Time{}
+	if absPath == "" {
+		return cache, nil
+	}
+	if err := env.checkPathAccess(absPath, "read"); err != nil {
+		return nil, newError("security: %s", err.Error())
+	}
+	data, err := os.ReadFile(absPath)
+	if os.IsNotExist(err) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, newError("failed to read link cache '%s': %s", absPath, err.Error())
+	}
+	recordFileRead(len(data))
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, newError("failed to read link cache '%s': %s", absPath, err.Error())
+	}
+	return cache, nil
+}
+
+// writeLinkCache writes the cache back, leaving out links older than ttl
+func writeLinkCache(absPath string, cache map[string]time.Time, ttl time.Duration, env *Environment) *Error {
+	if absPath == "" {
+		return nil
+	}
+	for link, checked := range cache {
+		if time.Since(checked) >= ttl {
+			delete(cache, link)
+		}
+	}
+	if err := env.checkPathAccess(absPath, "write"); err != nil {
+		return newError("security: %s", err.Error())
+	}
+	if env.dryRun("write link cache %s", absPath) {
+		return nil
+	}
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return newError("failed to write link cache '%s': %s", absPath, err.Error())
+	}
+	data = append(data, '\n')
+	if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
+		return newError("failed to write link cache '%s': %s", absPath, err.Error())
+	}
+	if err := writeFileAtomic(absPath, data, 0644); err != nil {
+		return newError("failed to write link cache '%s': %s", absPath, err.Error())
+	}
+	recordFileWrite(len(data))
+	return nil
+}
@@ -3,12 +3,17 @@
 package evaluator
 
 import (
-	"fmt"
 	"os"
 	"sort"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/sambeau/parsley/pkg/ast"
+	"github.com/sambeau/parsley/pkg/lexer"
 	"github.com/sambeau/parsley/pkg/locale"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
 )
 
 // ============================================================================
@@ -36,6 +41,112 @@ func evalStringMethod(str *String, method string, args []Object) Object {
 		}
 		return &String{Value: strings.TrimSpace(str.Value)}
 
+	case "trimStart", "trimEnd":
+		if len(args) != 0 {
+			return newError("wrong number of arguments to `%s`. got=%d, want=0", method, len(args))
+		}
+		if method == "trimStart" {
+			return &String{Value: strings.TrimLeftFunc(str.Value, unicode.IsSpace)}
+		}
+		return &String{Value: strings.TrimRightFunc(str.Value, unicode.IsSpace)}
+
+	case "startsWith", "endsWith", "contains":
+		if len(args) != 1 {
+			return newError("wrong number of arguments to `%s`. got=%d, want=1", method, len(args))
+		}
+		sub, ok := args[0].(*String)
+		if !ok {
+			return newError("argument to `%s` must be a string, got %s", method, args[0].Type())
+		}
+		switch method {
+		case "startsWith":
+			return nativeBoolToParsBoolean(strings.HasPrefix(str.Value, sub.Value))
+		case "endsWith":
+			return nativeBoolToParsBoolean(strings.HasSuffix(str.Value, sub.Value))
+		}
+		return nativeBoolToParsBoolean(strings.Contains(str.Value, sub.Value))
+
+	case "indexOf", "lastIndexOf":
+		// Indexes count characters, like string indexing; -1 if not found
+		if len(args) != 1 {
+			return newError("wrong number of arguments to `%s`. got=%d, want=1", method, len(args))
+		}
+		sub, ok := args[0].(*String)
+		if !ok {
+			return newError("argument to `%s` must be a string, got %s", method, args[0].Type())
+		}
+		i := strings.Index(str.Value, sub.Value)
+		if method == "lastIndexOf" {
+			i = strings.LastIndex(str.Value, sub.Value)
+		}
+		if i < 0 {
+			return &Integer{Value: -1}
+		}
+		return &Integer{Value: int64(utf8.RuneCountInString(str.Value[:i]))}
+
+	case "padStart", "padEnd":
+		// padStart(width, pad?) - pads to width characters, with spaces by default
+		if len(args) < 1 || len(args) > 2 {
+			return newError("wrong number of arguments to `%s`. got=%d, want=1-2", method, len(args))
+		}
+		width, ok := args[0].(*Integer)
+		if !ok {
+			return newError("first argument to `%s` must be an integer, got %s", method, args[0].Type())
+		}
+		pad := " "
+		if len(args) == 2 {
+			padStr, ok := args[1].(*String)
+			if !ok {
+				return newError("second argument to `%s` must be a string, got %s", method, args[1].Type())
+			}
+			pad = padStr.Value
+		}
+		return &String{Value: padString(str.Value, int(width.Value), pad, method == "padStart")}
+
+	case "repeat":
+		if len(args) != 1 {
+			return newError("wrong number of arguments to `repeat`. got=%d, want=1", len(args))
+		}
+		n, ok := args[0].(*Integer)
+		if !ok || n.Value < 0 {
+			return newError("argument to `repeat` must be a non-negative integer, got %s", args[0].Inspect())
+		}
+		return &String{Value: strings.Repeat(str.Value, int(n.Value))}
+
+	case "lines":
+		// lines() - splits on \n or \r\n; a final newline doesn't add an empty line
+		if len(args) != 0 {
+			return newError("wrong number of arguments to `lines`. got=%d, want=0", len(args))
+		}
+		text := strings.TrimSuffix(str.Value, "\n")
+		elements := []Object{}
+		if str.Value != "" {
+			for _, line := range strings.Split(text, "\n") {
+				elements = append(elements, &String{Value: strings.TrimSuffix(line, "\r")})
+			}
+		}
+		return &Array{Elements: elements}
+
+	case "codePointAt":
+		// codePointAt(index) - the Unicode code point of a character; negative
+		// indexes count from the end, as in string indexing
+		if len(args) != 1 {
+			return newError("wrong number of arguments to `codePointAt`. got=%d, want=1", len(args))
+		}
+		idx, ok := args[0].(*Integer)
+		if !ok {
+			return newError("argument to `codePointAt` must be an integer, got %s", args[0].Type())
+		}
+		runes := []rune(str.Value)
+		i := idx.Value
+		if i < 0 {
+			i += int64(len(runes))
+		}
+		if i < 0 || i >= int64(len(runes)) {
+			return newError("index out of range: %d", idx.Value)
+		}
+		return &Integer{Value: int64(runes[i])}
+
 	case "split":
 		if len(args) != 1 {
 			return newError("wrong number of arguments to `split`. got=%d, want=1", len(args))
@@ -72,11 +183,34 @@ func evalStringMethod(str *String, method string, args []Object) Object {
 		// Return rune count for proper Unicode support
 		return &Integer{Value: int64(len([]rune(str.Value)))}
 
+	case "raw":
+		// raw() - the string without its request mark, so tags include it
+		// unescaped
+		if len(args) != 0 {
+			return newError("wrong number of arguments to `raw`. got=%d, want=0", len(args))
+		}
+		return &String{Value: str.Value}
+
 	default:
 		return newError("unknown method '%s' for STRING", method)
 	}
 }
 
+// padString pads s with repeats of pad to width characters, truncating the
+// last repeat if it doesn't fit. Strings already width or longer are
+// unchanged.
+func padString(s string, width int, pad string, atStart bool) string {
+	n := width - utf8.RuneCountInString(s)
+	if n <= 0 || pad == "" {
+		return s
+	}
+	padRunes := []rune(strings.Repeat(pad, n/utf8.RuneCountInString(pad)+1))[:n]
+	if atStart {
+		return string(padRunes) + s
+	}
+	return s + string(padRunes)
+}
+
 // ============================================================================
 // Array Methods
 // ============================================================================
@@ -103,8 +237,19 @@ func evalArrayMethod(arr *Array, method string, args []Object, env *Environment)
 		return &Array{Elements: newElements}
 
 	case "sort":
-		if len(args) != 0 {
-			return newError("wrong number of arguments to `sort`. got=%d, want=0", len(args))
+		if len(args) > 1 {
+			return newError("wrong number of arguments to `sort`. got=%d, want=0-1", len(args))
+		}
+		if len(args) == 1 {
+			opts, ok := args[0].(*Dictionary)
+			if !ok {
+				return newError("argument to `sort` must be a dictionary, got %s", args[0].Type())
+			}
+			so, errObj := parseSortOptions(opts)
+			if errObj != nil {
+				return errObj
+			}
+			return sortArrayWithOptions(arr, so)
 		}
 		return naturalSortArray(arr)
 
@@ -112,11 +257,11 @@ func evalArrayMethod(arr *Array, method string, args []Object, env *Environment)
 		if len(args) != 1 {
 			return newError("wrong number of arguments to `sortBy`. got=%d, want=1", len(args))
 		}
-		fn, ok := args[0].(*Function)
-		if !ok {
-			return newError("argument to 'sortBy' must be a function, got %s", args[0].Type())
+		keys, errObj := parseSortKeys(args[0])
+		if errObj != nil {
+			return errObj
 		}
-		return sortArrayByFunction(arr, fn, env)
+		return sortArrayByKeys(arr, keys)
 
 	case "map":
 		if len(args) != 1 {
@@ -152,7 +297,7 @@ func evalArrayMethod(arr *Array, method string, args []Object, env *Environment)
 
 		// Get style (default to "and")
 		style := locale.ListStyleAnd
-		localeStr := "en-US"
+		localeStr := DefaultLocale
 
 		if len(args) >= 1 {
 			styleStr, ok := args[0].(*String)
@@ -183,19 +328,37 @@ func evalArrayMethod(arr *Array, method string, args []Object, env *Environment)
 		return &String{Value: result}
 
 	case "join":
-		// join(separator?) - joins array elements into a string
-		if len(args) > 1 {
-			return newError("wrong number of arguments to `join`. got=%d, want=0-1", len(args))
+		// join(separator?, options?) - joins array elements into a string
+		// Options: {last: " and "} separates the final two elements
+		if len(args) > 2 {
+			return newError("wrong number of arguments to `join`. got=%d, want=0-2", len(args))
 		}
 
 		separator := ""
-		if len(args) == 1 {
+		if len(args) >= 1 {
 			sepStr, ok := args[0].(*String)
 			if !ok {
 				return newError("argument to `join` must be a string, got %s", args[0].Type())
 			}
 			separator = sepStr.Value
 		}
+		last := separator
+		if len(args) == 2 {
+			opts, ok := args[1].(*Dictionary)
+			if !ok {
+				return newError("second argument to `join` must be a dictionary, got %s", args[1].Type())
+			}
+			for key, expr := range opts.Pairs {
+				if key != "last" {
+					return newError("unknown option %q for `join`", key)
+				}
+				lastStr, ok := Eval(expr, opts.Env).(*String)
+				if !ok {
+					return newError("option `last` for `join` must be a string")
+				}
+				last = lastStr.Value
+			}
+		}
 
 		// Convert array elements to strings
 		items := make([]string, len(arr.Elements))
@@ -203,13 +366,124 @@ func evalArrayMethod(arr *Array, method string, args []Object, env *Environment)
 			items[i] = objectToTemplateString(elem)
 		}
 
-		return &String{Value: strings.Join(items, separator)}
+		untrusted := isUntrusted(arr)
+		if len(items) < 2 {
+			return &String{Value: strings.Join(items, separator), Untrusted: untrusted}
+		}
+		n := len(items) - 1
+		return &String{Value: strings.Join(items[:n], separator) + last + items[n], Untrusted: untrusted}
+
+	case "slice":
+		// slice(start, end?) - like arr[start:end], negative indexes count from the end
+		if len(args) < 1 || len(args) > 2 {
+			return newError("wrong number of arguments to `slice`. got=%d, want=1-2", len(args))
+		}
+		var end Object
+		if len(args) == 2 {
+			end = args[1]
+		}
+		return evalArraySliceExpression(arr, args[0], end)
+
+	case "first", "last":
+		// first(), last() - null for an empty array
+		if len(args) != 0 {
+			return newError("wrong number of arguments to `%s`. got=%d, want=0", method, len(args))
+		}
+		if len(arr.Elements) == 0 {
+			return NULL
+		}
+		if method == "first" {
+			return arr.Elements[0]
+		}
+		return arr.Elements[len(arr.Elements)-1]
+
+	case "take", "drop":
+		// take(n) - the first n elements; drop(n) - all but the first n
+		if len(args) != 1 {
+			return newError("wrong number of arguments to `%s`. got=%d, want=1", method, len(args))
+		}
+		n, ok := args[0].(*Integer)
+		if !ok || n.Value < 0 {
+			return newError("argument to `%s` must be a non-negative integer, got %s", method, args[0].Inspect())
+		}
+		count := len(arr.Elements)
+		if n.Value < int64(count) {
+			count = int(n.Value)
+		}
+		if method == "take" {
+			return &Array{Elements: arr.Elements[:count]}
+		}
+		return &Array{Elements: arr.Elements[count:]}
+
+	case "insert":
+		// insert(index, value) - a copy with value inserted before index;
+		// an index equal to the length appends
+		if len(args) != 2 {
+			return newError("wrong number of arguments to `insert`. got=%d, want=2", len(args))
+		}
+		i, errObj := arrayMethodIndex(arr, "insert", args[0], len(arr.Elements)+1)
+		if errObj != nil {
+			return errObj
+		}
+		elements := make([]Object, 0, len(arr.Elements)+1)
+		elements = append(elements, arr.Elements[:i]...)
+		elements = append(elements, args[1])
+		elements = append(elements, arr.Elements[i:]...)
+		return &Array{Elements: elements}
+
+	case "removeAt":
+		// removeAt(index) - a copy without the element at index
+		if len(args) != 1 {
+			return newError("wrong number of arguments to `removeAt`. got=%d, want=1", len(args))
+		}
+		i, errObj := arrayMethodIndex(arr, "removeAt", args[0], len(arr.Elements))
+		if errObj != nil {
+			return errObj
+		}
+		elements := make([]Object, 0, len(arr.Elements)-1)
+		elements = append(elements, arr.Elements[:i]...)
+		elements = append(elements, arr.Elements[i+1:]...)
+		return &Array{Elements: elements}
+
+	case "indexOf", "includes":
+		// indexOf(value) - the first index of an element == value, or -1
+		if len(args) != 1 {
+			return newError("wrong number of arguments to `%s`. got=%d, want=1", method, len(args))
+		}
+		index := -1
+		for i, elem := range arr.Elements {
+			if isTruthy(evalInfixExpression(lexer.Token{}, "==", args[0], elem)) {
+				index = i
+				break
+			}
+		}
+		if method == "includes" {
+			return nativeBoolToParsBoolean(index >= 0)
+		}
+		return &Integer{Value: int64(index)}
 
 	default:
 		return newError("unknown method '%s' for ARRAY", method)
 	}
 }
 
+// arrayMethodIndex resolves an index argument to an array method. Negative
+// indexes count from the end; the result is in [0, limit).
+func arrayMethodIndex(arr *Array, method string, index Object, limit int) (int, *Error) {
+	idx, ok := index.(*Integer)
+	if !ok {
+		return 0, newError("first argument to `%s` must be an integer, got %s", method, index.Type())
+	}
+	i := idx.Value
+	if i < 0 {
+		i += int64(len(arr.Elements))
+	}
+	if i < 0 || i >= int64(limit) {
+		return 0, newError("index out of range: %d", idx.Value)
+	}
+	return int(i), nil
+}
+
 // naturalSortArray performs a natural sort on an array
 func naturalSortArray(arr *Array) *Array {
 	// Make a copy of elements
@@ -224,29 +498,272 @@ func naturalSortArray(arr *Array) *Array {
 	return &Array{Elements: elements}
 }
 
-// sortArrayByFunction sorts an array using a key function
-func sortArrayByFunction(arr *Array, fn *Function, env *Environment) Object {
-	// Make a copy of elements
+// sortOptions controls how sort(arr, options) orders elements
+type sortOptions struct {
+	key      *Function         // key function applied to each element before comparing
+	desc     bool              // sort in descending order
+	natural  bool              // compare digit runs numerically ("a2" < "a10")
+	collator *collate.Collator // locale-aware string comparison (nil = code point order)
+}
+
+// parseSortOptions reads {key, desc, natural, locale} from an options dictionary
+func parseSortOptions(opts *Dictionary) (*sortOptions, *Error) {
+	so := &sortOptions{natural: true}
+
+	if keyExpr, ok := opts.Pairs["key"]; ok {
+		fn, ok := Eval(keyExpr, opts.Env).(*Function)
+		if !ok {
+			return nil, newError("`key` option for `sort` must be a function")
+		}
+		if fn.ParamCount() != 1 {
+			return nil, newError("`key` function for `sort` must take exactly 1 parameter, got %d", fn.ParamCount())
+		}
+		so.key = fn
+	}
+
+	if descExpr, ok := opts.Pairs["desc"]; ok {
+		desc, ok := Eval(descExpr, opts.Env).(*Boolean)
+		if !ok {
+			return nil, newError("`desc` option for `sort` must be a boolean")
+		}
+		so.desc = desc.Value
+	}
+
+	if naturalExpr, ok := opts.Pairs["natural"]; ok {
+		natural, ok := Eval(naturalExpr, opts.Env).(*Boolean)
+		if !ok {
+			return nil, newError("`natural` option for `sort` must be a boolean")
+		}
+		so.natural = natural.Value
+	}
+
+	if localeExpr, ok := opts.Pairs["locale"]; ok {
+		locStr, ok := Eval(localeExpr, opts.Env).(*String)
+		if !ok {
+			return nil, newError("`locale` option for `sort` must be a string")
+		}
+		tag, err := language.Parse(locStr.Value)
+		if err != nil {
+			return nil, newError("invalid locale: %s", locStr.Value)
+		}
+		if so.natural {
+			so.collator = collate.New(tag, collate.Numeric)
+		} else {
+			so.collator = collate.New(tag)
+		}
+	}
+
+	return so, nil
+}
+
+// compare orders two values: numbers before strings before other types
+func (so *sortOptions) compare(a, b Object) int {
+	aType, bType := getTypeOrder(a), getTypeOrder(b)
+	if aType != bType {
+		return aType - bType
+	}
+
+	aStr, aIsStr := a.(*String)
+	bStr, bIsStr := b.(*String)
+	if !aIsStr || !bIsStr {
+		return compareObjects(a, b)
+	}
+
+	switch {
+	case so.collator != nil:
+		return so.collator.CompareString(aStr.Value, bStr.Value)
+	case so.natural:
+		if naturalStringCompare(aStr.Value, bStr.Value) {
+			return -1
+		}
+		if naturalStringCompare(bStr.Value, aStr.Value) {
+			return 1
+		}
+		return 0
+	default:
+		return strings.Compare(aStr.Value, bStr.Value)
+	}
+}
+
+// sortArrayWithOptions performs a stable sort using the given options
+func sortArrayWithOptions(arr *Array, so *sortOptions) Object {
 	elements := make([]Object, len(arr.Elements))
 	copy(elements, arr.Elements)
 
-	// Compute keys for all elements
-	keys := make([]Object, len(elements))
+	// Compute keys up front so key function errors are reported
+	keys := elements
+	if so.key != nil {
+		keys = make([]Object, len(elements))
+		for i, elem := range elements {
+			key := applyFunction(so.key, []Object{elem})
+			if isError(key) {
+				return key
+			}
+			keys[i] = key
+		}
+	}
+
+	indices := make([]int, len(elements))
+	for i := range indices {
+		indices[i] = i
+	}
+	sort.SliceStable(indices, func(i, j int) bool {
+		cmp := so.compare(keys[indices[i]], keys[indices[j]])
+		if so.desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+
+	sorted := make([]Object, len(elements))
+	for i, idx := range indices {
+		sorted[i] = elements[idx]
+	}
+	return &Array{Elements: sorted}
+}
+
+// sortKey is one key of a multi-key sort: a dictionary field name or a key function
+type sortKey struct {
+	field string
+	fn    *Function
+	desc  bool
+}
+
+// parseSortKeys converts a sortBy argument into sort keys. Accepts a field name
+// ("age", or "-age" for descending), a 1-parameter key function, a dictionary
+// {key: name|fn, desc: bool}, or an array mixing any of these.
+func parseSortKeys(obj Object) ([]sortKey, *Error) {
+	switch v := obj.(type) {
+	case *String:
+		field := v.Value
+		desc := strings.HasPrefix(field, "-")
+		field = strings.TrimPrefix(field, "-")
+		if field == "" {
+			return nil, newError("sort key must not be empty")
+		}
+		return []sortKey{{field: field, desc: desc}}, nil
+
+	case *Function:
+		if v.ParamCount() != 1 {
+			return nil, newError("sort key function must take exactly 1 parameter, got %d", v.ParamCount())
+		}
+		return []sortKey{{fn: v}}, nil
+
+	case *Dictionary:
+		keyExpr, ok := v.Pairs["key"]
+		if !ok {
+			return nil, newError("sort key dictionary must have a `key` field")
+		}
+		keys, errObj := parseSortKeys(Eval(keyExpr, v.Env))
+		if errObj != nil {
+			return nil, errObj
+		}
+		if len(keys) != 1 {
+			return nil, newError("sort key dictionary `key` must be a field name or function")
+		}
+		if descExpr, ok := v.Pairs["desc"]; ok {
+			desc, ok := Eval(descExpr, v.Env).(*Boolean)
+			if !ok {
+				return nil, newError("`desc` in sort key must be a boolean")
+			}
+			keys[0].desc = desc.Value
+		}
+		return keys, nil
+
+	case *Array:
+		if len(v.Elements) == 0 {
+			return nil, newError("sort keys must not be empty")
+		}
+		var keys []sortKey
+		for _, elem := range v.Elements {
+			if _, nested := elem.(*Array); nested {
+				return nil, newError("sort keys must be field names, functions or dictionaries, got ARRAY")
+			}
+			elemKeys, errObj := parseSortKeys(elem)
+			if errObj != nil {
+				return nil, errObj
+			}
+			keys = append(keys, elemKeys...)
+		}
+		return keys, nil
+
+	default:
+		return nil, newError("sort key must be a field name, function, dictionary or array, got %s", obj.Type())
+	}
+}
+
+// value returns the key's value for an element
+func (k sortKey) value(elem Object) Object {
+	if k.fn != nil {
+		return applyFunction(k.fn, []Object{elem})
+	}
+	dict, ok := elem.(*Dictionary)
+	if !ok {
+		return newError("cannot sort %s by field '%s', elements must be dictionaries", elem.Type(), k.field)
+	}
+	return evalDictionaryIndexExpression(dict, &String{Value: k.field})
+}
+
+// sortArrayByKeys performs a stable sort by each key in turn, using natural order
+func sortArrayByKeys(arr *Array, keys []sortKey) Object {
+	elements := arr.Elements
+
+	// Compute every key value up front so errors are reported and functions run once
+	values := make([][]Object, len(elements))
 	for i, elem := range elements {
-		extendedEnv := extendFunctionEnv(fn, []Object{elem})
-		result := Eval(fn.Body, extendedEnv)
-		if isError(result) {
-			return result
+		values[i] = make([]Object, len(keys))
+		for j, key := range keys {
+			val := key.value(elem)
+			if isError(val) {
+				return val
+			}
+			values[i][j] = val
 		}
-		if returnValue, ok := result.(*ReturnValue); ok {
-			result = returnValue.Value
+	}
+
+	so := &sortOptions{natural: true}
+	indices := make([]int, len(elements))
+	for i := range indices {
+		indices[i] = i
+	}
+	sort.SliceStable(indices, func(a, b int) bool {
+		for j, key := range keys {
+			cmp := so.compare(values[indices[a]][j], values[indices[b]][j])
+			if cmp == 0 {
+				continue
+			}
+			if key.desc {
+				return cmp > 0
+			}
+			return cmp < 0
 		}
-		keys[i] = result
+		return false
+	})
+
+	sorted := make([]Object, len(elements))
+	for i, idx := range indices {
+		sorted[i] = elements[idx]
 	}
+	return &Array{Elements: sorted}
+}
+
+// sortArrayByComparator sorts using the legacy sortBy contract: fn(a, b) returns
+// [a, b] when a should come first. Prefer sort keys, which call fewer functions.
+func sortArrayByComparator(arr *Array, fn *Function) Object {
+	elements := make([]Object, len(arr.Elements))
+	copy(elements, arr.Elements)
 
-	// Sort by keys
 	sort.SliceStable(elements, func(i, j int) bool {
-		return compareObjects(keys[i], keys[j]) < 0
+		result := applyFunction(fn, []Object{elements[i], elements[j]})
+
+		// The function should return a 2-element array
+		resultArr, ok := result.(*Array)
+		if !ok || len(resultArr.Elements) != 2 {
+			return false
+		}
+
+		// If the first element is elements[i], then i comes before j
+		return objectsEqual(resultArr.Elements[0], elements[i])
 	})
 
 	return &Array{Elements: elements}
@@ -254,9 +771,15 @@ func sortArrayByFunction(arr *Array, fn *Function, env *Environment) Object {
 
 // mapArrayWithFunction applies a function to each element
 func mapArrayWithFunction(arr *Array, fn *Function, env *Environment) Object {
-	result := make([]Object, 0, len(arr.Elements))
+	return mapWithFunction(eachElement(arr.Elements), fn, env)
+}
+
+// mapWithFunction maps a sequence, so ranges can be mapped without
+// generating them first
+func mapWithFunction(each sequence, fn *Function, env *Environment) Object {
+	result := []Object{}
 
-	for _, elem := range arr.Elements {
+	errObj := each(func(elem Object) Object {
 		extendedEnv := extendFunctionEnv(fn, []Object{elem})
 
 		var evaluated Object
@@ -275,6 +798,10 @@ func mapArrayWithFunction(arr *Array, fn *Function, env *Environment) Object {
 		if evaluated != NULL {
 			result = append(result, evaluated)
 		}
+		return nil
+	})
+	if errObj != nil {
+		return errObj
 	}
 
 	return &Array{Elements: result}
@@ -282,9 +809,14 @@ func mapArrayWithFunction(arr *Array, fn *Function, env *Environment) Object {
 
 // filterArrayWithFunction filters array elements based on a predicate function
 func filterArrayWithFunction(arr *Array, fn *Function, env *Environment) Object {
-	result := make([]Object, 0, len(arr.Elements))
+	return filterWithFunction(eachElement(arr.Elements), fn, env)
+}
+
+// filterWithFunction filters a sequence
+func filterWithFunction(each sequence, fn *Function, env *Environment) Object {
+	result := []Object{}
 
-	for _, elem := range arr.Elements {
+	errObj := each(func(elem Object) Object {
 		extendedEnv := extendFunctionEnv(fn, []Object{elem})
 
 		var evaluated Object
@@ -303,6 +835,10 @@ func filterArrayWithFunction(arr *Array, fn *Function, env *Environment) Object
 		if isTruthy(evaluated) {
 			result = append(result, elem)
 		}
+		return nil
+	})
+	if errObj != nil {
+		return errObj
 	}
 
 	return &Array{Elements: result}
@@ -434,12 +970,167 @@ func evalDictionaryMethod(dict *Dictionary, method string, args []Object, env *E
 		delete(dict.Pairs, key.Value)
 		return NULL
 
+	case "size":
+		if len(args) != 0 {
+			return newError("wrong number of arguments to `size`. got=%d, want=0", len(args))
+		}
+		return &Integer{Value: int64(len(dictionaryKeys(dict)))}
+
+	case "entries":
+		if len(args) != 0 {
+			return newError("wrong number of arguments to `entries`. got=%d, want=0", len(args))
+		}
+		dictEnv := dictionaryThisEnv(dict)
+		keys := dictionaryKeys(dict)
+		entries := make([]Object, 0, len(keys))
+		for _, k := range keys {
+			val := Eval(dict.Pairs[k], dictEnv)
+			if isError(val) {
+				return val
+			}
+			entries = append(entries, &Array{Elements: []Object{&String{Value: k}, val}})
+		}
+		return &Array{Elements: entries}
+
+	case "fromEntries":
+		if len(args) != 1 {
+			return newError("wrong number of arguments to `fromEntries`. got=%d, want=1", len(args))
+		}
+		arr, ok := args[0].(*Array)
+		if !ok {
+			return newError("argument to `fromEntries` must be an array, got %s", args[0].Type())
+		}
+		// Entries are merged over a copy of the receiver
+		result := copyDictionary(dict)
+		if err := addDictionaryEntries(result, arr, "fromEntries"); err != nil {
+			return err
+		}
+		return result
+
+	case "mapValues":
+		if len(args) != 1 {
+			return newError("wrong number of arguments to `mapValues`. got=%d, want=1", len(args))
+		}
+		fn, ok := args[0].(*Function)
+		if !ok {
+			return newError("argument to `mapValues` must be a function, got %s", args[0].Type())
+		}
+		dictEnv := dictionaryThisEnv(dict)
+		result := &Dictionary{Pairs: make(map[string]ast.Expression), Env: NewEnvironment()}
+		for _, k := range dictionaryKeys(dict) {
+			val := Eval(dict.Pairs[k], dictEnv)
+			if isError(val) {
+				return val
+			}
+			mapped := applyFunction(fn, []Object{val, &String{Value: k}})
+			if isError(mapped) {
+				return mapped
+			}
+			result.Pairs[k] = &ast.ObjectLiteralExpression{Obj: mapped}
+		}
+		return result
+
+	case "filter":
+		if len(args) != 1 {
+			return newError("wrong number of arguments to `filter`. got=%d, want=1", len(args))
+		}
+		fn, ok := args[0].(*Function)
+		if !ok {
+			return newError("argument to `filter` must be a function, got %s", args[0].Type())
+		}
+		dictEnv := dictionaryThisEnv(dict)
+		result := &Dictionary{Pairs: make(map[string]ast.Expression), Env: dict.Env}
+		for _, k := range dictionaryKeys(dict) {
+			val := Eval(dict.Pairs[k], dictEnv)
+			if isError(val) {
+				return val
+			}
+			keep := applyFunction(fn, []Object{val, &String{Value: k}})
+			if isError(keep) {
+				return keep
+			}
+			if isTruthy(keep) {
+				result.Pairs[k] = dict.Pairs[k]
+			}
+		}
+		return result
+
+	case "pick", "omit":
+		if len(args) != 1 {
+			return newError("wrong number of arguments to `%s`. got=%d, want=1", method, len(args))
+		}
+		arr, ok := args[0].(*Array)
+		if !ok {
+			return newError("argument to `%s` must be an array of strings, got %s", method, args[0].Type())
+		}
+		selected := make(map[string]bool, len(arr.Elements))
+		for _, elem := range arr.Elements {
+			key, ok := elem.(*String)
+			if !ok {
+				return newError("argument to `%s` must be an array of strings, got %s in array", method, elem.Type())
+			}
+			selected[key.Value] = true
+		}
+		result := &Dictionary{Pairs: make(map[string]ast.Expression), Env: dict.Env}
+		for k, expr := range dict.Pairs {
+			// Internal fields are always kept so typed dictionaries stay typed
+			if strings.HasPrefix(k, "__") || selected[k] == (method == "pick") {
+				result.Pairs[k] = expr
+			}
+		}
+		return result
+
 	default:
 		// Return nil for unknown methods to allow user-defined methods to be checked
 		return nil
 	}
 }
 
+// dictionaryKeys returns the user-visible keys of a dictionary, sorted
+func dictionaryKeys(dict *Dictionary) []string {
+	keys := make([]string, 0, len(dict.Pairs))
+	for k := range dict.Pairs {
+		if !strings.HasPrefix(k, "__") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// dictionaryThisEnv returns an environment for evaluating dictionary values with 'this' bound
+func dictionaryThisEnv(dict *Dictionary) *Environment {
+	dictEnv := NewEnclosedEnvironment(dict.Env)
+	dictEnv.Set("this", dict)
+	return dictEnv
+}
+
+// copyDictionary returns a shallow copy of a dictionary sharing its environment
+func copyDictionary(dict *Dictionary) *Dictionary {
+	result := &Dictionary{Pairs: make(map[string]ast.Expression, len(dict.Pairs)), Env: dict.Env}
+	for k, expr := range dict.Pairs {
+		result.Pairs[k] = expr
+	}
+	return result
+}
+
+// addDictionaryEntries stores [key, value] pairs in a dictionary. Values of any
+// type (including arrays, dictionaries and functions) are stored as-is.
+func addDictionaryEntries(dict *Dictionary, arr *Array, fnName string) *Error {
+	for i, elem := range arr.Elements {
+		pair, ok := elem.(*Array)
+		if !ok || len(pair.Elements) != 2 {
+			return newError("`%s` expects [key, value] pairs, got %s at index %d", fnName, elem.Inspect(), i)
+		}
+		key, ok := pair.Elements[0].(*String)
+		if !ok {
+			return newError("`%s` keys must be strings, got %s at index %d", fnName, pair.Elements[0].Type(), i)
+		}
+		dict.Pairs[key.Value] = objectToExpression(pair.Elements[1])
+	}
+	return nil
+}
+
 // ============================================================================
 // Number Methods (Integer and Float)
 // ============================================================================
@@ -452,7 +1143,7 @@ func evalIntegerMethod(num *Integer, method string, args []Object) Object {
 		if len(args) > 1 {
 			return newError("wrong number of arguments to `format`. got=%d, want=0-1", len(args))
 		}
-		localeStr := "en-US"
+		localeStr := DefaultLocale
 		if len(args) == 1 {
 			loc, ok := args[0].(*String)
 			if !ok {
@@ -471,7 +1162,7 @@ func evalIntegerMethod(num *Integer, method string, args []Object) Object {
 		if !ok {
 			return newError("first argument to `currency` must be a string, got %s", args[0].Type())
 		}
-		localeStr := "en-US"
+		localeStr := DefaultLocale
 		if len(args) == 2 {
 			loc, ok := args[1].(*String)
 			if !ok {
@@ -486,7 +1177,7 @@ func evalIntegerMethod(num *Integer, method string, args []Object) Object {
 		if len(args) > 1 {
 			return newError("wrong number of arguments to `percent`. got=%d, want=0-1", len(args))
 		}
-		localeStr := "en-US"
+		localeStr := DefaultLocale
 		if len(args) == 1 {
 			loc, ok := args[0].(*String)
 			if !ok {
@@ -509,7 +1200,7 @@ func evalFloatMethod(num *Float, method string, args []Object) Object {
 		if len(args) > 1 {
 			return newError("wrong number of arguments to `format`. got=%d, want=0-1", len(args))
 		}
-		localeStr := "en-US"
+		localeStr := DefaultLocale
 		if len(args) == 1 {
 			loc, ok := args[0].(*String)
 			if !ok {
@@ -528,7 +1219,7 @@ func evalFloatMethod(num *Float, method string, args []Object) Object {
 		if !ok {
 			return newError("first argument to `currency` must be a string, got %s", args[0].Type())
 		}
-		localeStr := "en-US"
+		localeStr := DefaultLocale
 		if len(args) == 2 {
 			loc, ok := args[1].(*String)
 			if !ok {
@@ -543,7 +1234,7 @@ func evalFloatMethod(num *Float, method string, args []Object) Object {
 		if len(args) > 1 {
 			return newError("wrong number of arguments to `percent`. got=%d, want=0-1", len(args))
 		}
-		localeStr := "en-US"
+		localeStr := DefaultLocale
 		if len(args) == 1 {
 			loc, ok := args[0].(*String)
 			if !ok {
@@ -562,15 +1253,15 @@ func evalFloatMethod(num *Float, method string, args []Object) Object {
 // Datetime Methods
 // ============================================================================
 
-// evalDatetimeMethod evaluates a method call on a datetime dictionary
-func evalDatetimeMethod(dict *Dictionary, method string, args []Object, env *Environment) Object {
+// evalDatetimeMethod evaluates a method call on a datetime
+func evalDatetimeMethod(dt *Datetime, method string, args []Object, env *Environment) Object {
 	switch method {
 	case "toDict":
-		// toDict() - returns the raw dictionary representation for debugging
+		// toDict() - returns the fields as a dictionary
 		if len(args) != 0 {
 			return newError("wrong number of arguments to `toDict`. got=%d, want=0", len(args))
 		}
-		return dict
+		return fieldsToDict(dt, env)
 
 	case "format":
 		// format(style?, locale?)
@@ -579,7 +1270,7 @@ func evalDatetimeMethod(dict *Dictionary, method string, args []Object, env *Env
 		}
 
 		style := "long"
-		localeStr := "en-US"
+		localeStr := DefaultLocale
 
 		if len(args) >= 1 {
 			styleArg, ok := args[0].(*String)
@@ -598,25 +1289,40 @@ func evalDatetimeMethod(dict *Dictionary, method string, args []Object, env *Env
 		}
 
 		// Delegate to the formatDate builtin logic
-		return formatDateWithStyleAndLocale(dict, style, localeStr, env)
+		return formatDateWithStyleAndLocale(dt, style, localeStr, env)
 
 	case "dayOfYear":
 		if len(args) != 0 {
 			return newError("wrong number of arguments to `dayOfYear`. got=%d, want=0", len(args))
 		}
-		return evalDatetimeComputedProperty(dict, "dayOfYear", env)
+		return evalDatetimeComputedProperty(dt, "dayOfYear", env)
 
 	case "week":
 		if len(args) != 0 {
 			return newError("wrong number of arguments to `week`. got=%d, want=0", len(args))
 		}
-		return evalDatetimeComputedProperty(dict, "week", env)
+		return evalDatetimeComputedProperty(dt, "week", env)
 
 	case "timestamp":
 		if len(args) != 0 {
 			return newError("wrong number of arguments to `timestamp`. got=%d, want=0", len(args))
 		}
-		return evalDatetimeComputedProperty(dict, "timestamp", env)
+		return evalDatetimeComputedProperty(dt, "timestamp", env)
+
+	case "relative":
+		// relative({to, locale}?)
+		if len(args) > 1 {
+			return newError("wrong number of arguments to `relative`. got=%d, want=0-1", len(args))
+		}
+		var opts *Dictionary
+		if len(args) == 1 {
+			var ok bool
+			opts, ok = args[0].(*Dictionary)
+			if !ok {
+				return newError("argument to `relative` must be a dictionary, got %s", args[0].Type())
+			}
+		}
+		return formatRelativeDatetime(dt, opts, env)
 
 	default:
 		return newError("unknown method '%s' for datetime", method)
@@ -627,34 +1333,37 @@ func evalDatetimeMethod(dict *Dictionary, method string, args []Object, env *Env
 // Duration Methods
 // ============================================================================
 
-// evalDurationMethod evaluates a method call on a duration dictionary
-func evalDurationMethod(dict *Dictionary, method string, args []Object, env *Environment) Object {
+// evalDurationMethod evaluates a method call on a duration
+func evalDurationMethod(dur *Duration, method string, args []Object, env *Environment) Object {
 	switch method {
 	case "toDict":
-		// toDict() - returns the raw dictionary representation for debugging
+		// toDict() - returns the fields as a dictionary
 		if len(args) != 0 {
 			return newError("wrong number of arguments to `toDict`. got=%d, want=0", len(args))
 		}
-		return dict
+		return fieldsToDict(dur, env)
 
 	case "format":
-		// format(locale?)
+		// format(locale?) or format({style, locale, maxUnits})
 		if len(args) > 1 {
 			return newError("wrong number of arguments to `format`. got=%d, want=0-1", len(args))
 		}
 
-		// Extract months and seconds from duration
-		months, seconds, err := getDurationComponents(dict, env)
-		if err != nil {
-			return newError("invalid duration: %s", err.Error())
+		months, seconds := dur.Months, dur.Seconds()
+
+		// Options dictionary formats the duration as a list of units
+		if len(args) == 1 {
+			if opts, ok := args[0].(*Dictionary); ok {
+				return formatDurationWithOptions(months, seconds, opts)
+			}
 		}
 
-		// Get locale (default to en-US)
-		localeStr := "en-US"
+		// Get locale (default to DefaultLocale)
+		localeStr := DefaultLocale
 		if len(args) == 1 {
 			locStr, ok := args[0].(*String)
 			if !ok {
-				return newError("argument to `format` must be a string, got %s", args[0].Type())
+				return newError("argument to `format` must be a string or dictionary, got %s", args[0].Type())
 			}
 			localeStr = locStr.Value
 		}
@@ -672,41 +1381,27 @@ func evalDurationMethod(dict *Dictionary, method string, args []Object, env *Env
 // Path Methods
 // ============================================================================
 
-// evalPathMethod evaluates a method call on a path dictionary
-func evalPathMethod(dict *Dictionary, method string, args []Object, env *Environment) Object {
+// evalPathMethod evaluates a method call on a path
+func evalPathMethod(path *Path, method string, args []Object, env *Environment) Object {
 	switch method {
 	case "toDict":
-		// toDict() - returns the raw dictionary representation for debugging
+		// toDict() - returns the fields as a dictionary
 		if len(args) != 0 {
 			return newError("wrong number of arguments to `toDict`. got=%d, want=0", len(args))
 		}
-		return dict
+		return fieldsToDict(path, env)
 
 	case "isAbsolute":
 		if len(args) != 0 {
 			return newError("wrong number of arguments to `isAbsolute`. got=%d, want=0", len(args))
 		}
-		// Get the absolute property
-		if absExpr, ok := dict.Pairs["absolute"]; ok {
-			result := Eval(absExpr, env)
-			if b, ok := result.(*Boolean); ok {
-				return b
-			}
-		}
-		return FALSE
+		return nativeBoolToParsBoolean(path.Absolute)
 
 	case "isRelative":
 		if len(args) != 0 {
 			return newError("wrong number of arguments to `isRelative`. got=%d, want=0", len(args))
 		}
-		// Get the absolute property and negate it
-		if absExpr, ok := dict.Pairs["absolute"]; ok {
-			result := Eval(absExpr, env)
-			if b, ok := result.(*Boolean); ok {
-				return nativeBoolToParsBoolean(!b.Value)
-			}
-		}
-		return TRUE
+		return nativeBoolToParsBoolean(!path.Absolute)
 
 	default:
 		return newError("unknown method '%s' for path", method)
@@ -717,106 +1412,42 @@ func evalPathMethod(dict *Dictionary, method string, args []Object, env *Environ
 // URL Methods
 // ============================================================================
 
-// evalUrlMethod evaluates a method call on a URL dictionary
-func evalUrlMethod(dict *Dictionary, method string, args []Object, env *Environment) Object {
+// evalUrlMethod evaluates a method call on a URL
+func evalUrlMethod(u *Url, method string, args []Object, env *Environment) Object {
 	switch method {
 	case "toDict":
-		// toDict() - returns the raw dictionary representation for debugging
+		// toDict() - returns the fields as a dictionary
 		if len(args) != 0 {
 			return newError("wrong number of arguments to `toDict`. got=%d, want=0", len(args))
 		}
-		return dict
+		return fieldsToDict(u, env)
 
 	case "origin":
 		if len(args) != 0 {
 			return newError("wrong number of arguments to `origin`. got=%d, want=0", len(args))
 		}
-		// origin = scheme + "://" + host + (port ? ":" + port : "")
-		scheme := ""
-		host := ""
-		port := ""
-
-		if schemeExpr, ok := dict.Pairs["scheme"]; ok {
-			if s := Eval(schemeExpr, env); s != nil {
-				if str, ok := s.(*String); ok {
-					scheme = str.Value
-				}
-			}
-		}
-		if hostExpr, ok := dict.Pairs["host"]; ok {
-			if h := Eval(hostExpr, env); h != nil {
-				if str, ok := h.(*String); ok {
-					host = str.Value
-				}
-			}
-		}
-		if portExpr, ok := dict.Pairs["port"]; ok {
-			if p := Eval(portExpr, env); p != nil {
-				switch pv := p.(type) {
-				case *Integer:
-					if pv.Value > 0 {
-						port = fmt.Sprintf(":%d", pv.Value)
-					}
-				case *String:
-					if pv.Value != "" {
-						port = ":" + pv.Value
-					}
-				}
-			}
-		}
-		return &String{Value: scheme + "://" + host + port}
+		return &String{Value: u.origin()}
 
 	case "pathname":
 		if len(args) != 0 {
 			return newError("wrong number of arguments to `pathname`. got=%d, want=0", len(args))
 		}
-		// pathname = "/" + path components joined by "/"
-		if pathExpr, ok := dict.Pairs["path"]; ok {
-			if p := Eval(pathExpr, env); p != nil {
-				if arr, ok := p.(*Array); ok {
-					parts := make([]string, 0, len(arr.Elements))
-					for _, elem := range arr.Elements {
-						if s, ok := elem.(*String); ok && s.Value != "" {
-							parts = append(parts, s.Value)
-						}
-					}
-					return &String{Value: "/" + strings.Join(parts, "/")}
-				}
-			}
+		if len(u.Path) == 0 {
+			return &String{Value: "/"}
 		}
-		return &String{Value: "/"}
+		return &String{Value: u.pathname()}
 
 	case "search":
 		if len(args) != 0 {
 			return newError("wrong number of arguments to `search`. got=%d, want=0", len(args))
 		}
-		// search = query string representation
-		if queryExpr, ok := dict.Pairs["query"]; ok {
-			if q := Eval(queryExpr, env); q != nil {
-				if queryDict, ok := q.(*Dictionary); ok {
-					if len(queryDict.Pairs) == 0 {
-						return &String{Value: ""}
-					}
-					parts := make([]string, 0, len(queryDict.Pairs))
-					for k, v := range queryDict.Pairs {
-						if strings.HasPrefix(k, "__") {
-							continue
-						}
-						val := Eval(v, env)
-						parts = append(parts, k+"="+val.Inspect())
-					}
-					return &String{Value: "?" + strings.Join(parts, "&")}
-				}
-			}
-		}
-		return &String{Value: ""}
+		return &String{Value: u.search()}
 
 	case "href":
 		if len(args) != 0 {
 			return newError("wrong number of arguments to `href`. got=%d, want=0", len(args))
 		}
-		// href = full URL string representation
-		return &String{Value: urlDictToString(dict)}
+		return &String{Value: u.Inspect()}
 
 	default:
 		return newError("unknown method '%s' for url", method)
@@ -920,11 +1551,57 @@ func evalRegexMethod(dict *Dictionary, method string, args []Object, env *Enviro
 
 		return nativeBoolToParsBoolean(re.MatchString(str.Value))
 
+	case "match", "matchAll":
+		// match(string) - the first match as a dictionary, or null
+		// matchAll(string) - an array of every match
+		if len(args) != 1 {
+			return newError("wrong number of arguments to `%s`. got=%d, want=1", method, len(args))
+		}
+		str, ok := args[0].(*String)
+		if !ok {
+			return newError("argument to `%s` must be a string, got %s", method, args[0].Type())
+		}
+		re, err := compileRegexDict(dict, env)
+		if err != nil {
+			return newError("invalid regex pattern: %s", err.Error())
+		}
+
+		if method == "matchAll" {
+			return regexMatchAll(re, str.Value, env)
+		}
+		loc := re.FindStringSubmatchIndex(str.Value)
+		if loc == nil {
+			return NULL
+		}
+		return regexMatch(re, str.Value, loc, env)
+
 	default:
 		return newError("unknown method '%s' for regex", method)
 	}
 }
 
+// evalMatchMethod evaluates a method call on a regex match object
+func evalMatchMethod(dict *Dictionary, method string, args []Object) Object {
+	switch method {
+	case "toArray":
+		// toArray() - [match, ...captures], as ~ returned before match objects
+		if len(args) != 0 {
+			return newError("wrong number of arguments to `toArray`. got=%d, want=0", len(args))
+		}
+		return matchElements(dict)
+
+	case "toDict":
+		// toDict() - returns the raw dictionary representation for debugging
+		if len(args) != 0 {
+			return newError("wrong number of arguments to `toDict`. got=%d, want=0", len(args))
+		}
+		return dict
+
+	default:
+		return newError("unknown method '%s' for match", method)
+	}
+}
+
 // ============================================================================
 // File Methods
 // ============================================================================
@@ -976,6 +1653,10 @@ func evalFileMethod(dict *Dictionary, method string, args []Object, env *Environ
 			return newError("security: %s", err.Error())
 		}
 
+		if env.dryRun("create directory %s", absPath) {
+			return NULL
+		}
+
 		var err error
 		if recursive {
 			err = os.MkdirAll(absPath, 0755)
@@ -1018,6 +1699,10 @@ func evalFileMethod(dict *Dictionary, method string, args []Object, env *Environ
 			return newError("security: %s", err.Error())
 		}
 
+		if env.dryRun("remove directory %s", absPath) {
+			return NULL
+		}
+
 		var err error
 		if recursive {
 			err = os.RemoveAll(absPath)
@@ -1079,6 +1764,10 @@ func evalDirMethod(dict *Dictionary, method string, args []Object, env *Environm
 			return newError("security: %s", err.Error())
 		}
 
+		if env.dryRun("create directory %s", absPath) {
+			return NULL
+		}
+
 		var err error
 		if recursive {
 			err = os.MkdirAll(absPath, 0755)
@@ -1121,6 +1810,10 @@ func evalDirMethod(dict *Dictionary, method string, args []Object, env *Environm
 			return newError("security: %s", err.Error())
 		}
 
+		if env.dryRun("remove directory %s", absPath) {
+			return NULL
+		}
+
 		var err error
 		if recursive {
 			err = os.RemoveAll(absPath)
@@ -1205,3 +1898,142 @@ func evalResponseMethod(dict *Dictionary, method string, args []Object, env *Env
 		return newError("unknown method '%s' for response", method)
 	}
 }
+
+// ============================================================================
+// Introspection
+// ============================================================================
+
+// typeMethods lists the methods of each type, keyed by typeName.
+// Keep in sync with the eval*Method functions above.
+var typeMethods = map[string][]string{
+	"string":     {"codePointAt", "contains", "endsWith", "indexOf", "lastIndexOf", "length", "lines", "padEnd", "padStart", "raw", "repeat", "replace", "split", "startsWith", "toLower", "toUpper", "trim", "trimEnd", "trimStart"},
+	"array":      {"drop", "filter", "first", "format", "includes", "indexOf", "insert", "join", "last", "length", "map", "removeAt", "reverse", "slice", "sort", "sortBy", "take"},
+	"iterator":   {"filter", "map", "take", "toArray"},
+	"range":      {"drop", "filter", "first", "format", "includes", "indexOf", "insert", "join", "last", "length", "map", "removeAt", "reverse", "slice", "sort", "sortBy", "take", "toArray"},
+	"counter":    {"add", "value"},
+	"collector":  {"length", "push", "toArray"},
+	"atomicDict": {"add", "get", "has", "keys", "set", "size", "toDict", "update"},
+	"channel":    {"close", "isClosed", "length", "receive", "send"},
+	"stopwatch":  {"elapsed", "lap", "laps", "reset", "stop"},
+	"dict":       {"delete", "entries", "filter", "fromEntries", "has", "keys", "mapValues", "omit", "pick", "size", "values"},
+	"int":        {"currency", "format", "percent"},
+	"float":      {"currency", "format", "percent"},
+	"datetime":   {"dayOfYear", "format", "relative", "timestamp", "toDict", "week"},
+	"duration":   {"format", "toDict"},
+	"path":       {"isAbsolute", "isRelative", "toDict"},
+	"url":        {"href", "origin", "pathname", "search", "toDict"},
+	"regex":      {"format", "match", "matchAll", "test", "toDict"},
+	"match":      {"toArray", "toDict"},
+	"color":      {"alpha", "contrastRatio", "darken", "hex", "hsl", "lighten", "luminance", "mix", "rgb", "toDict"},
+	"tag":        {"addClass", "query", "removeClass", "toString", "withAttr", "withChildren"},
+	"file":       {"mkdir", "remove", "rmdir", "toDict"},
+	"dir":        {"mkdir", "rmdir", "toDict"},
+	"request":    {"toDict"},
+	"response":   {"data", "format", "response", "toDict"},
+	"db":         {"begin", "close", "commit", "createIndex", "ping", "prepare", "rollback", "search", "table", "transaction"},
+	"statement":  {"close", "exec", "query", "queryOne"},
+	"query":      {"all", "count", "delete", "first", "insert", "limit", "offset", "orderBy", "select", "toSQL", "types", "update", "where"},
+	"sftp":       {"close"},
+	"sftpfile":   {"mkdir", "remove", "rmdir"},
+}
+
+// typeName returns the name typeOf() reports for a value. Dictionaries with
+// a __type field (file, regex, color, ...) report that pseudo-type.
+func typeName(obj Object) string {
+	switch v := obj.(type) {
+	case *Integer:
+		return "int"
+	case *Float:
+		return "float"
+	case *String:
+		return "string"
+	case *Boolean:
+		return "bool"
+	case *Null:
+		return "null"
+	case *Array:
+		return "array"
+	case *Range:
+		return "range"
+	case *Dictionary:
+		if typeExpr, ok := v.Pairs["__type"]; ok {
+			if strLit, ok := typeExpr.(*ast.StringLiteral); ok && strLit.Value != "" {
+				return strLit.Value
+			}
+		}
+		return "dict"
+	case *Function, *Builtin:
+		return "function"
+	case *DBConnection:
+		return "db"
+	case *DBStatement:
+		return "statement"
+	case *DBQuery:
+		return "query"
+	case *SFTPConnection:
+		return "sftp"
+	case *SFTPFileHandle:
+		return "sftpfile"
+	case *AtomicDict:
+		return "atomicDict"
+	default:
+		return strings.ToLower(string(obj.Type()))
+	}
+}
+
+// isType reports whether a value is of the named type. Besides the names
+// typeOf() returns, "number" matches ints and floats and "dict" matches
+// every dictionary, including pseudo-types, and the values that read like
+// one (datetimes, durations, paths and URLs).
+func isType(obj Object, name string) bool {
+	actual := typeName(obj)
+	switch name {
+	case actual:
+		return true
+	case "number":
+		return actual == "int" || actual == "float"
+	case "array":
+		return actual == "range"
+	case "dict":
+		switch obj.(type) {
+		case *Dictionary, fieldValue:
+			return true
+		}
+	}
+	return false
+}
+
+// objectMethods returns the sorted names of the methods a value supports.
+// Pseudo-types and the values that read like dictionaries also support the
+// dictionary methods, and dictionaries support calling their function-valued
+// keys as methods.
+func objectMethods(obj Object) []string {
+	name := typeName(obj)
+	seen := make(map[string]bool)
+	for _, method := range typeMethods[name] {
+		seen[method] = true
+	}
+	switch obj.(type) {
+	case *Dictionary, fieldValue:
+		for _, method := range typeMethods["dict"] {
+			seen[method] = true
+		}
+	}
+	if dict, ok := obj.(*Dictionary); ok {
+		for key, expr := range dict.Pairs {
+			if strings.HasPrefix(key, "__") {
+				continue
+			}
+			if _, isFn := Eval(expr, dictionaryThisEnv(dict)).(*Function); isFn {
+				seen[key] = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for method := range seen {
+		names = append(names, method)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,385 @@
+package evaluator
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/sambeau/parsley/pkg/ast"
+)
+
+// mock(target, response) lets tests run scripts without the network, files,
+// programs or databases they use. Once a target is mocked, fetching, reading
+// or running it gives the canned response and nothing real happens:
+//
+//	mock(@https://api.example.com/users, {status: 200, body: [{name: "Ada"}]})
+//	mock(@./config.json, {debug: true})
+//	mock(COMMAND("git", ["rev-parse", "HEAD"]), {stdout: "4f2a9c1\n"})
+//	mock(db, "SELECT * FROM users", [{id: 1, name: "Ada"}])
+//
+// Mocks belong to the process rather than the script, so they also apply to
+// the modules a test imports. Hosts that run several scripts call
+// ResetMocks between them.
+
+// httpMock is a canned HTTP response
+type httpMock struct {
+	status  int
+	headers http.Header
+	body    []byte
+}
+
+// commandMock is the canned result of a command
+type commandMock struct {
+	stdout, stderr string
+	exitCode       int64
+}
+
+var (
+	mocksMu      sync.Mutex
+	urlMocks     = map[string]*httpMock{}
+	fileMocks    = map[string][]byte{}
+	commandMocks = map[string]*commandMock{}
+	sqlMocks     = map[string]Object{}
+)
+
+// ResetMocks removes every mock registered with mock()
+func ResetMocks() {
+	mocksMu.Lock()
+	defer mocksMu.Unlock()
+	urlMocks = map[string]*httpMock{}
+	fileMocks = map[string][]byte{}
+	commandMocks = map[string]*commandMock{}
+	sqlMocks = map[string]Object{}
+}
+
+// evalMock implements mock(target, response) and mock(db, sql, result)
+func evalMock(args []Object, env *Environment) Object {
+	if len(args) == 3 {
+		conn, ok := args[0].(*DBConnection)
+		if !ok {
+			return newError("first argument to `mock` with a query must be a database connection, got %s", args[0].Type())
+		}
+		query, ok := args[1].(*String)
+		if !ok {
+			return newError("second argument to `mock` must be an SQL string, got %s", args[1].Type())
+		}
+		mocksMu.Lock()
+		defer mocksMu.Unlock()
+		sqlMocks[sqlMockKey(conn, query.Value)] = args[2]
+		return NULL
+	}
+	if len(args) != 2 {
+		return newError("wrong number of arguments to `mock`. got=%d, want=2 or 3", len(args))
+	}
+
+	switch target := args[0].(type) {
+	case *Url:
+		return mockURL(target.Inspect(), args[1])
+	case *Path:
+		return mockFile(target.Inspect(), args[1], env)
+	case *Dictionary:
+		switch {
+		case isRequestDict(target):
+			return mockURL(getRequestUrlString(target, env), args[1])
+		case isFileDict(target):
+			return mockFile(getFilePathString(target, env), args[1], env)
+		case isCommandHandle(target):
+			return mockCommand(target, args[1])
+		}
+	case *String:
+		if strings.HasPrefix(target.Value, "http://") || strings.HasPrefix(target.Value, "https://") {
+			return mockURL(target.Value, args[1])
+		}
+	}
+	return newError("first argument to `mock` must be a URL, path, file handle or COMMAND, got %s", args[0].Inspect())
+}
+
+// mockURL registers a response for requests to a URL, whatever their method
+func mockURL(rawURL string, response Object) Object {
+	spec, ok := response.(*Dictionary)
+	if !ok {
+		return newError("mock response for %s must be a dictionary, got %s", rawURL, response.Type())
+	}
+	m := &httpMock{status: http.StatusOK, headers: http.Header{}}
+	for key, expr := range spec.Pairs {
+		val := Eval(expr, spec.Env)
+		switch key {
+		case "status":
+			n, ok := val.(*Integer)
+			if !ok || n.Value < 100 || n.Value > 599 {
+				return newError("mock option `status` must be an HTTP status code, got %s", val.Inspect())
+			}
+			m.status = int(n.Value)
+		case "headers":
+			headers, ok := val.(*Dictionary)
+			if !ok {
+				return newError("mock option `headers` must be a dictionary, got %s", val.Type())
+			}
+			for name, hExpr := range headers.Pairs {
+				hVal, ok := Eval(hExpr, headers.Env).(*String)
+				if !ok {
+					return newError("mock header %q must be a string", name)
+				}
+				m.headers.Set(name, hVal.Value)
+			}
+		case "body":
+			body, isJSON, errObj := mockContent(val)
+			if errObj != nil {
+				return errObj
+			}
+			m.body = body
+			if isJSON && m.headers.Get("Content-Type") == "" {
+				m.headers.Set("Content-Type", "application/json")
+			}
+		default:
+			return newError("unknown option %q for mock()", key)
+		}
+	}
+
+	mocksMu.Lock()
+	defer mocksMu.Unlock()
+	urlMocks[urlMockKey(rawURL)] = m
+	return NULL
+}
+
+// mockFile registers the content reads of a file get
+func mockFile(pathStr string, content Object, env *Environment) Object {
+	absPath, err := resolveModulePath(pathStr, env.Filename)
+	if err != nil {
+		return newError("failed to resolve path '%s': %s", pathStr, err.Error())
+	}
+	data, _, errObj := mockContent(content)
+	if errObj != nil {
+		return errObj
+	}
+
+	mocksMu.Lock()
+	defer mocksMu.Unlock()
+	fileMocks[absPath] = data
+	return NULL
+}
+
+// mockCommand registers the result of running a command. A command mocked
+// without arguments matches every run of the program.
+func mockCommand(cmdDict *Dictionary, response Object) Object {
+	spec, ok := response.(*Dictionary)
+	if !ok {
+		return newError("mock result for a command must be a dictionary, got %s", response.Type())
+	}
+	m := &commandMock{}
+	for key, expr := range spec.Pairs {
+		val := Eval(expr, spec.Env)
+		switch key {
+		case "stdout", "stderr":
+			str, ok := val.(*String)
+			if !ok {
+				return newError("mock option `%s` must be a string, got %s", key, val.Type())
+			}
+			if key == "stdout" {
+				m.stdout = str.Value
+			} else {
+				m.stderr = str.Value
+			}
+		case "exitCode":
+			n, ok := val.(*Integer)
+			if !ok {
+				return newError("mock option `exitCode` must be an integer, got %s", val.Type())
+			}
+			m.exitCode = n.Value
+		default:
+			return newError("unknown option %q for mock()", key)
+		}
+	}
+
+	binary, args := commandParts(cmdDict)
+	mocksMu.Lock()
+	defer mocksMu.Unlock()
+	commandMocks[commandMockKey(binary, args)] = m
+	return NULL
+}
+
+// mockContent encodes a mocked body or file: strings are used as they are
+// and anything else is encoded as JSON
+func mockContent(val Object) ([]byte, bool, *Error) {
+	switch v := val.(type) {
+	case *String:
+		return []byte(v.Value), false, nil
+	case *Null:
+		return nil, false, nil
+	}
+	data, err := encodeJSON(val)
+	if err != nil {
+		return nil, false, newError("failed to encode mock content: %s", err.Error())
+	}
+	return data, true, nil
+}
+
+// urlMockKey normalizes a URL so mocks match however it was written
+func urlMockKey(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return u.String()
+	}
+	return rawURL
+}
+
+// commandMockKey identifies a program and its arguments
+func commandMockKey(binary string, args []string) string {
+	return strings.Join(append([]string{binary}, args...), "\x00")
+}
+
+// sqlMockKey identifies a statement on a database, ignoring differences in
+// whitespace
+func sqlMockKey(conn *DBConnection, query string) string {
+	return conn.Driver + "\x00" + conn.DSN + "\x00" + strings.Join(strings.Fields(query), " ")
+}
+
+// commandParts reads a command handle's binary and arguments
+func commandParts(cmdDict *Dictionary) (string, []string) {
+	var binary string
+	if binaryLit, ok := cmdDict.Pairs["binary"].(*ast.StringLiteral); ok {
+		binary = binaryLit.Value
+	}
+	var args []string
+	if argsLit, ok := cmdDict.Pairs["args"].(*ast.ArrayLiteral); ok {
+		for _, argExpr := range argsLit.Elements {
+			if argLit, ok := argExpr.(*ast.StringLiteral); ok {
+				args = append(args, argLit.Value)
+			}
+		}
+	}
+	return binary, args
+}
+
+// sendRequest sends an HTTP request, or answers it from a mock or a
+// replayed recording
+func sendRequest(client *http.Client, req *http.Request) (*http.Response, error) {
+	mocksMu.Lock()
+	m := urlMocks[urlMockKey(req.URL.String())]
+	mocksMu.Unlock()
+	if m != nil {
+		return cannedResponse(req, m.status, m.headers, m.body), nil
+	}
+
+	key := req.Method + " " + req.URL.String()
+	if in, err := replay("http", key); err != nil || in != nil {
+		if err != nil {
+			return nil, err
+		}
+		header := http.Header{}
+		for name, value := range in.Headers {
+			header.Set(name, value)
+		}
+		return cannedResponse(req, in.Status, header, []byte(in.Body)), nil
+	}
+
+	resp, err := client.Do(req)
+	if err != nil || !isRecording() {
+		return resp, err
+	}
+	return recordResponse(key, resp)
+}
+
+// cannedResponse builds the response to a mocked or replayed request
+func cannedResponse(req *http.Request, status int, header http.Header, body []byte) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Header:        header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// mockedFile returns the mocked content of a file
+func mockedFile(absPath string) ([]byte, bool) {
+	mocksMu.Lock()
+	defer mocksMu.Unlock()
+	data, ok := fileMocks[absPath]
+	return data, ok
+}
+
+// mockedCommand returns the mocked result of running a command handle
+func mockedCommand(cmdDict *Dictionary) (*Dictionary, bool) {
+	binary, args := commandParts(cmdDict)
+	mocksMu.Lock()
+	m, ok := commandMocks[commandMockKey(binary, args)]
+	if !ok {
+		m, ok = commandMocks[commandMockKey(binary, nil)]
+	}
+	mocksMu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	return commandResultDict(m.stdout, m.stderr, m.exitCode), true
+}
+
+// commandResultDict creates the result of a mocked or replayed command
+func commandResultDict(stdout, stderr string, exitCode int64) *Dictionary {
+	result := createResultDict(stdout, stderr, nil)
+	result.Pairs["exitCode"] = createLiteralExpression(&Integer{Value: exitCode})
+	return result
+}
+
+// mockedRows returns up to limit rows (-1 for all) mocked for a query: an
+// array of rows, a single row, or null for none
+func mockedRows(conn *DBConnection, query string, limit int) ([]Object, bool) {
+	mocksMu.Lock()
+	val, ok := sqlMocks[sqlMockKey(conn, query)]
+	mocksMu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	var rows []Object
+	switch v := val.(type) {
+	case *Array:
+		rows = v.Elements
+	case *Null:
+	default:
+		rows = []Object{v}
+	}
+	if limit >= 0 && len(rows) > limit {
+		rows = rows[:limit]
+	}
+	return append([]Object{}, rows...), true
+}
+
+// mockedExec returns the result mocked for a statement, taken from the
+// affected and lastId fields of its dictionary
+func mockedExec(conn *DBConnection, query string) (sql.Result, bool) {
+	mocksMu.Lock()
+	val, ok := sqlMocks[sqlMockKey(conn, query)]
+	mocksMu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	result := mockResult{}
+	if dict, ok := val.(*Dictionary); ok {
+		for key, expr := range dict.Pairs {
+			n, ok := Eval(expr, dict.Env).(*Integer)
+			if !ok {
+				continue
+			}
+			switch key {
+			case "affected":
+				result.affected = n.Value
+			case "lastId":
+				result.lastId = n.Value
+			}
+		}
+	}
+	return result, true
+}
+
+// mockResult is the result of a mocked statement
+type mockResult struct {
+	affected, lastId int64
+}
+
+func (r mockResult) LastInsertId() (int64, error) { return r.lastId, nil }
+func (r mockResult) RowsAffected() (int64, error) { return r.affected, nil }
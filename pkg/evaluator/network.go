@@ -0,0 +1,135 @@
+package evaluator
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"time"
+)
+
+// resolve(), ping() and portOpen() gather reachability data for health
+// checks and status pages without running system tools:
+//
+//	resolve("example.com")         // ["93.184.215.14", "2606:2800:21f:cb07:6820:80da:af6b:8b2c"]
+//	ping("example.com")            // 23.4, milliseconds to open a TCP connection
+//	portOpen("db.internal", 5432)  // true
+//
+// Failures aren't errors, so one bad host doesn't stop a report: a name that
+// doesn't resolve gives null, and an unreachable host gives null from ping()
+// and false from portOpen().
+
+// defaultNetworkTimeout is how long ping() and portOpen() wait to connect
+const defaultNetworkTimeout = 5 * time.Second
+
+// evalResolve looks up a host's IP addresses
+func evalResolve(hostObj Object) Object {
+	host, _, errObj := networkHost("resolve", hostObj)
+	if errObj != nil {
+		return errObj
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), defaultNetworkTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return NULL
+	}
+	elements := make([]Object, len(addrs))
+	for i, addr := range addrs {
+		elements[i] = &String{Value: addr}
+	}
+	return &Array{Elements: elements}
+}
+
+// evalPing times opening a TCP connection to a host, by default on port
+// 443 (or the port of a URL), returning milliseconds
+func evalPing(hostObj Object, opts *Dictionary) Object {
+	host, port, errObj := networkHost("ping", hostObj)
+	if errObj != nil {
+		return errObj
+	}
+	if port == 0 {
+		port = 443
+	}
+	timeout := defaultNetworkTimeout
+	if opts != nil {
+		if portExpr, ok := opts.Pairs["port"]; ok {
+			p, ok := Eval(portExpr, opts.Env).(*Integer)
+			if !ok || p.Value < 1 || p.Value > 65535 {
+				return newError("`port` option for `ping` must be a port number")
+			}
+			port = p.Value
+		}
+		if timeout, errObj = networkTimeout("ping", opts); errObj != nil {
+			return errObj
+		}
+	}
+
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.FormatInt(port, 10)), timeout)
+	if err != nil {
+		return NULL
+	}
+	elapsed := time.Since(start)
+	conn.Close()
+	return &Float{Value: float64(elapsed.Microseconds()) / 1000}
+}
+
+// evalPortOpen reports whether a TCP port accepts connections
+func evalPortOpen(hostObj, portObj Object, opts *Dictionary) Object {
+	host, _, errObj := networkHost("portOpen", hostObj)
+	if errObj != nil {
+		return errObj
+	}
+	port, ok := portObj.(*Integer)
+	if !ok || port.Value < 1 || port.Value > 65535 {
+		return newError("second argument to `portOpen` must be a port number, got %s", portObj.Inspect())
+	}
+	timeout := defaultNetworkTimeout
+	if opts != nil {
+		if timeout, errObj = networkTimeout("portOpen", opts); errObj != nil {
+			return errObj
+		}
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.FormatInt(port.Value, 10)), timeout)
+	if err != nil {
+		return FALSE
+	}
+	conn.Close()
+	return TRUE
+}
+
+// networkHost reads a host name, or the host and port (0 if it has none) of
+// a URL
+func networkHost(fnName string, obj Object) (string, int64, *Error) {
+	switch v := obj.(type) {
+	case *String:
+		if v.Value == "" {
+			return "", 0, newError("host for `%s` must not be empty", fnName)
+		}
+		return v.Value, 0, nil
+	case *Url:
+		port := v.Port
+		if port == 0 && v.Scheme == "http" {
+			port = 80
+		}
+		return v.Host, port, nil
+	}
+	return "", 0, newError("first argument to `%s` must be a host name or URL, got %s", fnName, obj.Type())
+}
+
+// networkTimeout reads the timeout option of ping() or portOpen()
+func networkTimeout(fnName string, opts *Dictionary) (time.Duration, *Error) {
+	timeoutExpr, ok := opts.Pairs["timeout"]
+	if !ok {
+		return defaultNetworkTimeout, nil
+	}
+	dur, ok := Eval(timeoutExpr, opts.Env).(*Duration)
+	if !ok {
+		return 0, newError("`timeout` option for `%s` must be a duration", fnName)
+	}
+	if dur.Months != 0 || dur.Seconds() <= 0 {
+		return 0, newError("`timeout` option for `%s` must be a positive duration without months or years", fnName)
+	}
+	return time.Duration(dur.Seconds()) * time.Second, nil
+}
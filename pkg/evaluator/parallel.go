@@ -0,0 +1,175 @@
+package evaluator
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sambeau/parsley/pkg/ast"
+)
+
+// parallel(array, fn) is for(array) fn with the calls running at the same
+// time, for loops that spend their time waiting on the network or the disk:
+//
+//	let pages = parallel(urls, fn(u) { let p <=/= JSON(url(u)); p })
+//	let sizes = parallel(files, fn(i, f) { [i, f.size] }, {concurrency: 4})
+//
+// Results come back in the order of the array, with nulls dropped as they
+// are by for. Up to concurrency calls (the number of CPUs by default) run at
+// once. If a call fails, no more are started and the error from the earliest
+// element is returned, the same error for would have stopped at.
+//
+// Environments aren't safe to share between goroutines, so each call may
+// only assign to variables it declared itself: assigning to one outside the
+// function is an error, and so is import(). Calls should return their
+// results instead.
+
+// parallelIteration marks the environments created by one call of a
+// parallel() function. stopped is closed when a call fails, so calls waiting
+// on a channel give up instead of waiting forever; interrupted records that
+// this call did, so its error isn't mistaken for the one that stopped it.
+type parallelIteration struct {
+	index       int
+	stopped     <-chan struct{}
+	interrupted bool
+}
+
+// evalParallel implements parallel(array, fn, options?)
+func evalParallel(args []Object, env *Environment) Object {
+	if len(args) < 2 || len(args) > 3 {
+		return newError("wrong number of arguments to `parallel`. got=%d, want=2 or 3", len(args))
+	}
+
+	var elements []Object
+	switch arr := collectIterator(args[0]).(type) {
+	case *Error:
+		return arr
+	case *Array:
+		elements = arr.Elements
+	default:
+		return newError("first argument to `parallel` must be an array or iterator, got %s", args[0].Type())
+	}
+
+	fn := args[1]
+	switch f := fn.(type) {
+	case *Function:
+		if paramCount := f.ParamCount(); paramCount != 1 && paramCount != 2 {
+			return newError("function passed to `parallel` must take 1 or 2 parameters, got %d", paramCount)
+		}
+	case *Builtin:
+	default:
+		return newError("second argument to `parallel` must be a function, got %s", fn.Type())
+	}
+
+	concurrency := runtime.NumCPU()
+	if len(args) == 3 {
+		opts, ok := args[2].(*Dictionary)
+		if !ok {
+			return newError("third argument to `parallel` must be a dictionary, got %s", args[2].Type())
+		}
+		if expr, ok := opts.Pairs["concurrency"]; ok {
+			n, ok := Eval(expr, opts.Env).(*Integer)
+			if !ok || n.Value < 1 {
+				return newError("`concurrency` option for `parallel` must be a positive integer")
+			}
+			concurrency = int(n.Value)
+		}
+	}
+	if concurrency > len(elements) {
+		concurrency = len(elements)
+	}
+
+	results := make([]Object, len(elements))
+	interrupted := make([]bool, len(elements))
+	var next int64 = -1
+	var failed atomic.Bool
+	var stopOnce sync.Once
+	stopped := make(chan struct{})
+	var wg sync.WaitGroup
+	parallelCallsChange(concurrency, 0)
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer parallelCallsChange(-1, 0)
+			for !failed.Load() {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= len(elements) {
+					return
+				}
+				it := &parallelIteration{index: i, stopped: stopped}
+				results[i] = callParallel(fn, it, elements[i], env)
+				interrupted[i] = it.interrupted
+				if isError(results[i]) {
+					failed.Store(true)
+					stopOnce.Do(func() { close(stopped) })
+				}
+			}
+		}()
+	}
+	if env.parallel != nil {
+		// This call waits for the calls it started, like a channel wait
+		parallelCallsChange(0, 1)
+		defer parallelCallsChange(0, -1)
+	}
+	wg.Wait()
+
+	// Elements are started in order, so every element before a failed one
+	// has run and the first error is the one for would have returned. Calls
+	// stopped waiting on a channel by that error are passed over.
+	var firstErr Object
+	collected := []Object{}
+	for i, result := range results {
+		if isError(result) {
+			if !interrupted[i] {
+				return result
+			}
+			if firstErr == nil {
+				firstErr = result
+			}
+			continue
+		}
+		if result != nil && result != NULL {
+			collected = append(collected, result)
+		}
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+	return &Array{Elements: collected}
+}
+
+// callParallel calls a parallel() function for one element
+func callParallel(fn Object, it *parallelIteration, elem Object, env *Environment) Object {
+	f, ok := fn.(*Function)
+	if !ok {
+		return applyFunctionWithEnv(fn, []Object{elem}, env)
+	}
+
+	args := []Object{elem}
+	if f.ParamCount() == 2 {
+		args = []Object{&Integer{Value: int64(it.index)}, elem}
+	}
+	extendedEnv := extendFunctionEnv(f, args)
+	extendedEnv.call.caller = env
+	extendedEnv.parallel = it
+	evaluated := Eval(f.Body, extendedEnv)
+	if errObj, ok := evaluated.(*Error); ok {
+		return errorInFile(errObj, extendedEnv.Filename, env.Filename)
+	}
+	return unwrapReturnValue(evaluated)
+}
+
+// checkParallelAssign returns an error if an assignment inside a parallel()
+// function would change a variable the function didn't declare
+func checkParallelAssign(env *Environment, ident *ast.Identifier) *Error {
+	for scope := env; scope != nil; scope = scope.outer {
+		if _, ok := scope.store[ident.Value]; ok {
+			if scope.parallel != env.parallel {
+				return newErrorWithPos(ident.Token, "cannot assign to %s inside parallel() (return values from the function instead)", ident.Value)
+			}
+			return nil
+		}
+	}
+	return nil
+}
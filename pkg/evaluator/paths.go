@@ -0,0 +1,122 @@
+package evaluator
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Parsley writes paths with forward slashes on every platform and converts
+// them to the platform's form when they reach the file system. A Windows
+// path can start with a volume, a drive or a UNC share, which takes the
+// place of the empty root component of an absolute path:
+//
+//	path("C:\\Users\\ada").components          // ["C:", "Users", "ada"]
+//	path("\\\\server\\share\\docs").components // ["//server/share", "docs"]
+//
+// Paths starting with // are UNC paths only on Windows; elsewhere they are
+// the root, as they are to the operating system.
+
+// pathsIgnoreCase is set where file systems ignore case in names, so
+// security checks compare paths the same way
+var pathsIgnoreCase = runtime.GOOS == "windows"
+
+// splitVolume splits a path into the volume it starts with, in
+// forward-slash form, and the rest. The volume is a drive letter ("C:"), a
+// UNC share ("//server/share") or "" for none.
+func splitVolume(pathStr string) (string, string) {
+	if len(pathStr) >= 2 && pathStr[1] == ':' && isASCIILetter(pathStr[0]) {
+		return pathStr[:2], pathStr[2:]
+	}
+	isUNC := strings.HasPrefix(pathStr, `\\`) ||
+		(runtime.GOOS == "windows" && len(pathStr) >= 2 && isPathSeparator(pathStr[0]) && isPathSeparator(pathStr[1]))
+	if !isUNC {
+		return "", pathStr
+	}
+
+	// \\server\share: the volume ends after the second name
+	var names []string
+	i := 0
+	for len(names) < 2 {
+		for i < len(pathStr) && isPathSeparator(pathStr[i]) {
+			i++
+		}
+		start := i
+		for i < len(pathStr) && !isPathSeparator(pathStr[i]) {
+			i++
+		}
+		if start == i {
+			return "", pathStr
+		}
+		names = append(names, pathStr[start:i])
+	}
+	return "//" + names[0] + "/" + names[1], pathStr[i:]
+}
+
+// isDriveVolume reports whether a path component is a drive letter volume
+func isDriveVolume(component string) bool {
+	return len(component) == 2 && component[1] == ':' && isASCIILetter(component[0])
+}
+
+// isVolumeComponent reports whether a path component is a drive or UNC
+// share volume
+func isVolumeComponent(component string) bool {
+	return isDriveVolume(component) || strings.HasPrefix(component, "//")
+}
+
+// joinPathComponents renders path components with forward slashes. An
+// absolute path's first component is "" (the root) or a volume.
+func joinPathComponents(parts []string) string {
+	switch {
+	case len(parts) == 0:
+		return "."
+	case len(parts) == 1 && parts[0] == "":
+		return "/"
+	case len(parts) == 1 && isDriveVolume(parts[0]):
+		return parts[0] + "/"
+	}
+	return strings.Join(parts, "/")
+}
+
+// isAbsolutePathString reports whether the file system takes a path as
+// absolute, or rooted at the current drive on Windows
+func isAbsolutePathString(pathStr string) bool {
+	return strings.HasPrefix(pathStr, "/") || filepath.IsAbs(filepath.FromSlash(pathStr))
+}
+
+// ExpandHome replaces a leading ~ with the user's home directory
+func ExpandHome(pathStr string) string {
+	if pathStr != "~" && !strings.HasPrefix(pathStr, "~/") && !strings.HasPrefix(pathStr, "~"+string(filepath.Separator)) {
+		return pathStr
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return pathStr
+	}
+	return filepath.Join(home, pathStr[1:])
+}
+
+// pathWithin reports whether a path is dir or inside it. Both are absolute
+// and clean.
+func pathWithin(path, dir string) bool {
+	if pathsIgnoreCase {
+		path, dir = strings.ToLower(path), strings.ToLower(dir)
+	}
+	if path == dir {
+		return true
+	}
+	// A root like / or C:\ already ends with a separator
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
+	}
+	return strings.HasPrefix(path, dir)
+}
+
+func isPathSeparator(c byte) bool {
+	return c == '/' || c == '\\'
+}
+
+func isASCIILetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
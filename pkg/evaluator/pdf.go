@@ -0,0 +1,308 @@
+package evaluator
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// writePDF(html, path, options?) prints HTML to a PDF file with an installed
+// browser engine: Chromium or Chrome in headless mode, or wkhtmltopdf. The
+// renderer is an external program, so it needs execute permission as well as
+// write permission for the PDF.
+
+// pdfRenderers are the programs writePDF looks for on the PATH, in order
+var pdfRenderers = []string{
+	"chromium", "chromium-browser", "google-chrome", "google-chrome-stable", "chrome", "wkhtmltopdf",
+}
+
+// pdfPageSizes maps the page sizes writePDF accepts to their CSS names
+var pdfPageSizes = map[string]string{
+	"a3": "A3", "a4": "A4", "a5": "A5", "b4": "B4", "b5": "B5",
+	"letter": "Letter", "legal": "Legal", "tabloid": "Tabloid",
+}
+
+// pdfLengthRegex matches a CSS length with an absolute unit
+var pdfLengthRegex = regexp.MustCompile(`^\d+(\.\d+)?(mm|cm|in|pt|px)$|^0$`)
+
+// pdfTimeout is how long the renderer may run
+const pdfTimeout = 2 * time.Minute
+
+// pdfOptions are writePDF's page settings
+type pdfOptions struct {
+	pageSize  string
+	landscape bool
+	// margins are top, right, bottom, left; empty uses the renderer's default
+	margins  [4]string
+	renderer string
+}
+
+func parsePDFOptions(opts *Dictionary) (pdfOptions, *Error) {
+	po := pdfOptions{pageSize: "A4"}
+	for key, expr := range opts.Pairs {
+		val := Eval(expr, opts.Env)
+		if isError(val) {
+			return po, val.(*Error)
+		}
+		switch key {
+		case "pageSize":
+			str, ok := val.(*String)
+			if !ok || pdfPageSizes[strings.ToLower(str.Value)] == "" {
+				return po, newError("`pageSize` option for `writePDF` must be one of \"A3\", \"A4\", \"A5\", \"B4\", \"B5\", \"Letter\", \"Legal\" or \"Tabloid\"")
+			}
+			po.pageSize = pdfPageSizes[strings.ToLower(str.Value)]
+		case "landscape":
+			b, ok := val.(*Boolean)
+			if !ok {
+				return po, newError("`landscape` option for `writePDF` must be a boolean")
+			}
+			po.landscape = b.Value
+		case "margins":
+			margins, errObj := parsePDFMargins(val)
+			if errObj != nil {
+				return po, errObj
+			}
+			po.margins = margins
+		case "renderer":
+			str, ok := val.(*String)
+			if !ok || str.Value == "" {
+				return po, newError("`renderer` option for `writePDF` must be a program name or path")
+			}
+			po.renderer = str.Value
+		default:
+			return po, newError("unknown option %q for `writePDF`", key)
+		}
+	}
+	return po, nil
+}
+
+// parsePDFMargins reads a margin for every side ("20mm") or a dictionary of
+// top, right, bottom and left margins
+func parsePDFMargins(val Object) ([4]string, *Error) {
+	var margins [4]string
+	checkLength := func(obj Object) (string, *Error) {
+		str, ok := obj.(*String)
+		if !ok || !pdfLengthRegex.MatchString(str.Value) {
+			return "", newError("margins for `writePDF` must be lengths such as \"20mm\", \"2cm\" or \"0.5in\"")
+		}
+		return str.Value, nil
+	}
+
+	switch v := val.(type) {
+	case *String:
+		m, errObj := checkLength(v)
+		if errObj != nil {
+			return margins, errObj
+		}
+		margins = [4]string{m, m, m, m}
+	case *Dictionary:
+		side := map[string]int{"top": 0, "right": 1, "bottom": 2, "left": 3}
+		for key, expr := range v.Pairs {
+			i, ok := side[key]
+			if !ok {
+				return margins, newError("unknown margin %q for `writePDF` (use top, right, bottom and left)", key)
+			}
+			m, errObj := checkLength(Eval(expr, v.Env))
+			if errObj != nil {
+				return margins, errObj
+			}
+			margins[i] = m
+		}
+	default:
+		return margins, newError("`margins` option for `writePDF` must be a length or a dictionary, got %s", val.Type())
+	}
+	return margins, nil
+}
+
+// findPDFRenderer returns the path of the renderer to use
+func findPDFRenderer(name string) (string, *Error) {
+	if name != "" {
+		if strings.Contains(name, "/") {
+			return name, nil
+		}
+		path, err := exec.LookPath(name)
+		if err != nil {
+			return "", newError("PDF renderer not found: %s", name)
+		}
+		return path, nil
+	}
+	for _, candidate := range pdfRenderers {
+		if path, err := exec.LookPath(candidate); err == nil {
+			return path, nil
+		}
+	}
+	return "", newError("`writePDF` needs Chromium, Chrome or wkhtmltopdf installed (or a `renderer` option)")
+}
+
+// pdfPageStyle returns the tags added to the HTML: a <base> so relative
+// images and stylesheets load from baseDir, and the @page size and margins
+func pdfPageStyle(opts pdfOptions, baseDir string) string {
+	size := opts.pageSize
+	if opts.landscape {
+		size += " landscape"
+	}
+	style := "@page { size: " + size
+	if opts.margins != [4]string{} {
+		margins := opts.margins
+		for i := range margins {
+			if margins[i] == "" {
+				margins[i] = "0"
+			}
+		}
+		style += "; margin: " + strings.Join(margins[:], " ")
+	}
+	style += " }"
+
+	base := "file://" + filepath.ToSlash(baseDir) + "/"
+	return `<base href="` + escapeAttrValue(base) + `"><style>` + style + `</style>`
+}
+
+// escapeAttrValue escapes a string for a double-quoted attribute
+func escapeAttrValue(s string) string {
+	return strings.NewReplacer("&", "&amp;", `"`, "&quot;", "<", "&lt;").Replace(s)
+}
+
+// pdfHeadRegex matches a document's <head> start tag
+var pdfHeadRegex = regexp.MustCompile(`(?i)<head(\s[^>]*)?>`)
+
+// injectPDFHead puts tags at the start of the document's <head>, or before
+// the content if it has none, keeping any doctype first
+func injectPDFHead(src, tags string) string {
+	if loc := pdfHeadRegex.FindStringIndex(src); loc != nil {
+		return src[:loc[1]] + tags + src[loc[1]:]
+	}
+	trimmed := strings.TrimLeft(src, " \t\r\n")
+	if strings.HasPrefix(strings.ToLower(trimmed), "<!doctype") {
+		if end := strings.IndexByte(src, '>'); end >= 0 {
+			return src[:end+1] + tags + src[end+1:]
+		}
+	}
+	return tags + src
+}
+
+// pdfRendererArgs returns the command-line arguments to print input to output
+func pdfRendererArgs(renderer string, opts pdfOptions, input, output string) []string {
+	if strings.Contains(filepath.Base(renderer), "wkhtmltopdf") {
+		args := []string{"--quiet", "--enable-local-file-access", "--page-size", opts.pageSize}
+		if opts.landscape {
+			args = append(args, "--orientation", "Landscape")
+		}
+		for i, flag := range []string{"-T", "-R", "-B", "-L"} {
+			if opts.margins[i] != "" {
+				args = append(args, flag, opts.margins[i])
+			}
+		}
+		return append(args, input, output)
+	}
+	// Chromium takes the page size and margins from the @page style
+	return []string{
+		"--headless", "--disable-gpu", "--no-pdf-header-footer", "--print-to-pdf-no-header",
+		"--print-to-pdf=" + output, "file://" + filepath.ToSlash(input),
+	}
+}
+
+// evalWritePDF implements writePDF(html, path, options?)
+func evalWritePDF(args []Object, env *Environment) Object {
+	if len(args) < 2 || len(args) > 3 {
+		return newError("wrong number of arguments to `writePDF`. got=%d, want=2-3", len(args))
+	}
+
+	src, errObj := htmlContent(args[0], "writePDF")
+	if errObj != nil {
+		return errObj
+	}
+
+	var pathStr string
+	switch arg := args[1].(type) {
+	case *String:
+		pathStr = arg.Value
+	case *Path:
+		pathStr = arg.Inspect()
+	default:
+		return newError("second argument to `writePDF` must be a path or string, got %s", args[1].Type())
+	}
+
+	opts := pdfOptions{pageSize: "A4"}
+	if len(args) == 3 {
+		optDict, ok := args[2].(*Dictionary)
+		if !ok {
+			return newError("third argument to `writePDF` must be a dictionary, got %s", args[2].Type())
+		}
+		if opts, errObj = parsePDFOptions(optDict); errObj != nil {
+			return errObj
+		}
+	}
+
+	absPath, err := resolveModulePath(pathStr, env.Filename)
+	if err != nil {
+		return newError("failed to resolve path '%s': %s", pathStr, err.Error())
+	}
+	if err := env.checkPathAccess(absPath, "write"); err != nil {
+		return newError("security: %s", err.Error())
+	}
+
+	renderer, errObj := findPDFRenderer(opts.renderer)
+	if errObj != nil {
+		return errObj
+	}
+	if err := env.checkPathAccess(renderer, "execute"); err != nil {
+		return newError("security: %s", err.Error())
+	}
+	if env.dryRun("run %s to write %s", filepath.Base(renderer), absPath) {
+		return NULL
+	}
+
+	// Relative URLs in the HTML are relative to the script, as for file paths
+	baseDir := "."
+	if env.Filename != "" {
+		baseDir = filepath.Dir(env.Filename)
+	}
+	if abs, err := filepath.Abs(baseDir); err == nil {
+		baseDir = abs
+	}
+
+	tmp, err := os.CreateTemp("", "parsley-*.html")
+	if err != nil {
+		return newError("writePDF: %s", err.Error())
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(injectPDFHead(src, pdfPageStyle(opts, baseDir)))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return newError("writePDF: %s", err.Error())
+	}
+
+	// Remove any old PDF so a renderer that fails quietly can't leave it looking new
+	if err := os.Remove(absPath); err != nil && !os.IsNotExist(err) {
+		return newError("failed to replace '%s': %s", pathStr, err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pdfTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, renderer, pdfRendererArgs(renderer, opts, tmp.Name(), absPath)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	start := time.Now()
+	err = cmd.Run()
+	recordCommand(start)
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return newError("writePDF: %s failed: %s", filepath.Base(renderer), msg)
+		}
+		return newError("writePDF: %s failed: %s", filepath.Base(renderer), err.Error())
+	}
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return newError("writePDF: %s did not write '%s'", filepath.Base(renderer), pathStr)
+	}
+	recordFileWrite(int(info.Size()))
+
+	return NULL
+}
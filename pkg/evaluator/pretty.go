@@ -0,0 +1,249 @@
+package evaluator
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Pretty prints values for people: the REPL, toDebug(), log() and
+// logLine(). Dictionaries show their values rather than the expressions
+// behind them, and anything too wide for a line is spread over several:
+//
+//	{
+//	  name: "Ada",
+//	  born: @1815-12-10,
+//	  papers: [{title: "Sketch of the Analytical Engine", year: 1843}]
+//	}
+//
+// Pseudo-types print as their literals where they have one (@./path,
+// @https://url, @2024-01-15, /regex/), containers nested deeper than the
+// depth limit print as {...} or [...], and a value that contains itself
+// prints as <cycle>.
+
+// PrettyOptions control how Pretty lays values out
+type PrettyOptions struct {
+	Width  int    // Longest line before a value is split over several
+	Depth  int    // Containers nested deeper than this print as {...} or [...]
+	Indent string // Indent for each level of nesting
+	Color  bool   // Color values with ANSI codes
+}
+
+// DefaultPrettyOptions are used by toDebug(), log() and logLine()
+var DefaultPrettyOptions = PrettyOptions{Width: 80, Depth: 8, Indent: "  "}
+
+// ANSI styles for Pretty
+const (
+	prettyReset   = "\x1b[0m"
+	prettyString  = "\x1b[32m"
+	prettyNumber  = "\x1b[33m"
+	prettyKeyword = "\x1b[35m"
+	prettyTyped   = "\x1b[34m"
+	prettyKey     = "\x1b[36m"
+	prettyDim     = "\x1b[2m"
+)
+
+// prettyIdentRegex matches dictionary keys that don't need quoting
+var prettyIdentRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Pretty formats a value for reading
+func Pretty(obj Object, opts PrettyOptions) string {
+	if opts.Indent == "" {
+		opts.Indent = "  "
+	}
+	p := &prettyPrinter{opts: opts, open: map[Object]bool{}, evaluated: map[*Dictionary][]prettyEntry{}}
+	return p.format(obj, "", 0, 0)
+}
+
+// prettyPrinter formats one value, keeping track of the containers it is
+// inside to catch cycles
+type prettyPrinter struct {
+	opts PrettyOptions
+	open map[Object]bool
+	// evaluated holds dictionaries' values, so each is evaluated once
+	evaluated map[*Dictionary][]prettyEntry
+}
+
+// prettyEntry is an element of an array or a key and value of a dictionary
+type prettyEntry struct {
+	key   string
+	value Object
+}
+
+// format formats obj at the given indent and depth. used is how much of the
+// line is already taken, e.g. by a dictionary key.
+func (p *prettyPrinter) format(obj Object, indent string, used, depth int) string {
+	entries, isDict, ok := p.entries(obj)
+	if !ok || len(entries) == 0 || (p.opts.Depth > 0 && depth >= p.opts.Depth) || p.open[obj] {
+		return p.flat(obj, depth, p.opts.Color)
+	}
+	if p.opts.Width <= 0 || len(indent)+used+len(p.flat(obj, depth, false)) <= p.opts.Width {
+		return p.flat(obj, depth, p.opts.Color)
+	}
+
+	p.open[obj] = true
+	defer delete(p.open, obj)
+
+	inner := indent + p.opts.Indent
+	var out strings.Builder
+	out.WriteString(p.opening(isDict))
+	for i, e := range entries {
+		out.WriteString("\n" + inner)
+		prefix := 0
+		if isDict {
+			key := p.key(e.key)
+			out.WriteString(p.style(prettyKey, key) + ": ")
+			prefix = len(key) + 2
+		}
+		out.WriteString(p.format(e.value, inner, prefix, depth+1))
+		if i < len(entries)-1 {
+			out.WriteString(",")
+		}
+	}
+	out.WriteString("\n" + indent + p.closing(isDict))
+	return out.String()
+}
+
+// flat formats obj on one line
+func (p *prettyPrinter) flat(obj Object, depth int, color bool) string {
+	style := func(code, s string) string {
+		if !color {
+			return s
+		}
+		return code + s + prettyReset
+	}
+
+	switch v := obj.(type) {
+	case nil:
+		return style(prettyKeyword, "null")
+	case *Integer:
+		return style(prettyNumber, strconv.FormatInt(v.Value, 10))
+	case *Float:
+		return style(prettyNumber, fmt.Sprintf("%g", v.Value))
+	case *Boolean:
+		return style(prettyKeyword, strconv.FormatBool(v.Value))
+	case *Null:
+		return style(prettyKeyword, "null")
+	case *String:
+		return style(prettyString, strconv.Quote(v.Value))
+	case *Function:
+		params := make([]string, len(v.Params))
+		for i, param := range v.Params {
+			params[i] = param.String()
+		}
+		return style(prettyTyped, "fn("+strings.Join(params, ", ")+")")
+	case fieldValue:
+		return style(prettyTyped, v.literal())
+	case *Dictionary:
+		if s, ok := prettyPseudoType(v); ok {
+			return style(prettyTyped, s)
+		}
+	}
+
+	entries, isDict, ok := p.entries(obj)
+	if !ok {
+		return style(prettyTyped, obj.Inspect())
+	}
+	if p.open[obj] {
+		return style(prettyDim, "<cycle>")
+	}
+	if len(entries) > 0 && p.opts.Depth > 0 && depth >= p.opts.Depth {
+		return p.opening(isDict) + style(prettyDim, "...") + p.closing(isDict)
+	}
+
+	p.open[obj] = true
+	defer delete(p.open, obj)
+
+	parts := make([]string, len(entries))
+	for i, e := range entries {
+		parts[i] = p.flat(e.value, depth+1, color)
+		if isDict {
+			parts[i] = style(prettyKey, p.key(e.key)) + ": " + parts[i]
+		}
+	}
+	return p.opening(isDict) + strings.Join(parts, ", ") + p.closing(isDict)
+}
+
+// entries returns the elements of an array or the sorted keys and values of
+// a plain dictionary. ok is false for anything else.
+func (p *prettyPrinter) entries(obj Object) (entries []prettyEntry, isDict bool, ok bool) {
+	switch v := obj.(type) {
+	case *Array:
+		for _, elem := range v.Elements {
+			entries = append(entries, prettyEntry{value: elem})
+		}
+		return entries, false, true
+	case *Range:
+		return p.entries(v.toArray())
+	case *Dictionary:
+		if _, typed := prettyPseudoType(v); typed {
+			return nil, true, false
+		}
+		if entries, ok := p.evaluated[v]; ok {
+			return entries, true, true
+		}
+		keys := make([]string, 0, len(v.Pairs))
+		for key := range v.Pairs {
+			if !strings.HasPrefix(key, "__") {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			entries = append(entries, prettyEntry{key: key, value: Eval(v.Pairs[key], v.Env)})
+		}
+		p.evaluated[v] = entries
+		return entries, true, true
+	}
+	return nil, false, false
+}
+
+// prettyPseudoType formats a pseudo-type dictionary as its literal, or
+// returns false for a plain dictionary
+func prettyPseudoType(d *Dictionary) (string, bool) {
+	name := typeName(d)
+	switch name {
+	case "dict":
+		return "", false
+	case "regex":
+		return objectToPrintString(d), true
+	}
+	// Pseudo-types without a print form show their fields like a dictionary
+	s := objectToPrintString(d)
+	if s == d.Inspect() {
+		return "", false
+	}
+	return "<" + name + " " + s + ">", true
+}
+
+// key formats a dictionary key, quoting it if it isn't an identifier
+func (p *prettyPrinter) key(key string) string {
+	if prettyIdentRegex.MatchString(key) {
+		return key
+	}
+	return strconv.Quote(key)
+}
+
+func (p *prettyPrinter) opening(isDict bool) string {
+	if isDict {
+		return "{"
+	}
+	return "["
+}
+
+func (p *prettyPrinter) closing(isDict bool) string {
+	if isDict {
+		return "}"
+	}
+	return "]"
+}
+
+// style wraps s in an ANSI style if color is on
+func (p *prettyPrinter) style(code, s string) string {
+	if !p.opts.Color {
+		return s
+	}
+	return code + s + prettyReset
+}
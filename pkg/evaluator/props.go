@@ -0,0 +1,152 @@
+package evaluator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sambeau/parsley/pkg/ast"
+	"github.com/sambeau/parsley/pkg/lexer"
+)
+
+// A props statement at the top of a component declares the props it expects:
+//
+//	let Card = fn(p) {
+//	    props {title: string, items: array = [], footer}
+//	    <div class="card"><h2>{title}</h2>...</div>
+//	}
+//
+// Each prop is bound as a variable in the function body. Props without a
+// default are required, so <Card/> fails with an error naming the component
+// and the line of the tag, rather than with a null deep inside the template.
+// Props passed as null count as missing. Undeclared props are allowed, so
+// attributes like class can still be passed through.
+
+// functionCall records how the running function was called
+type functionCall struct {
+	fn   *Function
+	args []Object
+	// tag is the component name when the function was called as a tag, and
+	// site is the tag's token
+	tag  string
+	site lexer.Token
+	// caller is the environment the call was made from, when known (see
+	// provide.go)
+	caller *Environment
+}
+
+// currentCall returns the call of the function whose body env belongs to, or
+// nil outside a function
+func (e *Environment) currentCall() *functionCall {
+	for env := e; env != nil; env = env.outer {
+		if env.call != nil {
+			return env.call
+		}
+	}
+	return nil
+}
+
+// applyComponent calls a function for a custom tag in env, recording the tag
+// so props errors can point at it
+func applyComponent(fn Object, name string, tok lexer.Token, props Object, env *Environment) Object {
+	function, ok := fn.(*Function)
+	if !ok {
+		return applyFunction(fn, []Object{props})
+	}
+	extendedEnv := extendFunctionEnv(function, []Object{props})
+	extendedEnv.call.tag = name
+	extendedEnv.call.site = tok
+	extendedEnv.call.caller = env
+	evaluated := Eval(function.Body, extendedEnv)
+	return unwrapReturnValue(evaluated)
+}
+
+// propTypes are the types a prop can be declared with, besides the names
+// typeOf() returns for pseudo-types
+var propTypes = map[string]bool{
+	"any": true, "string": true, "int": true, "float": true, "number": true, "bool": true,
+	"array": true, "dict": true, "function": true,
+}
+
+// isPropType reports whether name can be used as a prop type
+func isPropType(name string) bool {
+	if propTypes[name] {
+		return true
+	}
+	_, ok := typeMethods[name]
+	return ok
+}
+
+// propTypeNames lists the prop types for error messages
+func propTypeNames() string {
+	names := []string{}
+	for name := range propTypes {
+		names = append(names, name)
+	}
+	for name := range typeMethods {
+		if !propTypes[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// evalPropsStatement binds the declared props from the first argument of the
+// running function, applying defaults and checking types
+func evalPropsStatement(node *ast.PropsStatement, env *Environment) Object {
+	call := env.currentCall()
+	if call == nil {
+		return newErrorWithPos(node.Token, "props can only be declared inside a function")
+	}
+
+	// Errors about the values passed point at the tag that passed them
+	errorAt := func(format string, a ...interface{}) *Error {
+		if call.tag != "" {
+			return newErrorWithPos(call.site, "<%s>: %s", call.tag, fmt.Sprintf(format, a...))
+		}
+		return newErrorWithPos(node.Token, format, a...)
+	}
+
+	var passed *Dictionary
+	if len(call.args) > 0 && call.args[0] != NULL {
+		dict, ok := call.args[0].(*Dictionary)
+		if !ok {
+			return errorAt("props must be passed as a dictionary, got %s", call.args[0].Type())
+		}
+		passed = dict
+	}
+
+	for _, prop := range node.Props {
+		name := prop.Name.Value
+		if prop.Type != "" && !isPropType(prop.Type) {
+			return newErrorWithPos(prop.Token, "unknown type %q for prop `%s` (use one of %s)", prop.Type, name, propTypeNames())
+		}
+
+		var val Object = NULL
+		if passed != nil {
+			if expr, ok := passed.Pairs[name]; ok {
+				val = Eval(expr, passed.Env)
+				if isError(val) {
+					return val
+				}
+			}
+		}
+
+		if val == NULL {
+			if prop.Default == nil {
+				return errorAt("missing required prop `%s`", name)
+			}
+			val = Eval(prop.Default, env)
+			if isError(val) {
+				return val
+			}
+		} else if prop.Type != "" && prop.Type != "any" && !isType(val, prop.Type) {
+			return errorAt("prop `%s` must be %s, got %s", name, prop.Type, typeName(val))
+		}
+
+		env.SetLet(name, val)
+	}
+
+	return NULL
+}
@@ -0,0 +1,131 @@
+package evaluator
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/sambeau/parsley/pkg/ast"
+)
+
+// provide(key, value) makes a value available to every function and
+// component called from the current one, however deeply nested, and
+// inject(key, default?) reads it back:
+//
+//	let Footer = fn() { <footer>{inject("site").name}</footer> }
+//	let Page = fn(p) { <main>{p.contents}<Footer/></main> }
+//	let Layout = fn(p) { provide("site", p.site); <Page>{p.contents}</Page> }
+//
+// Values provided inside a function last until it returns; at the top level
+// they're visible to the whole program. inject() looks in the current
+// function, then the function that called it and so on up to the top level,
+// so the nearest provider wins. Functions called without a known caller (like
+// map() callbacks) continue through the scope they were defined in.
+// provided() lists what inject() can see, for debugging and the REPL.
+
+// provideScope returns the environment provide() stores values in: the
+// running function's, or the top-level environment
+func (e *Environment) provideScope() *Environment {
+	env := e
+	for env.outer != nil && env.call == nil {
+		env = env.outer
+	}
+	return env
+}
+
+// eachProvider calls fn for each environment inject() looks in, nearest
+// first, until fn returns false
+func (e *Environment) eachProvider(fn func(env *Environment) bool) {
+	for env := e; env != nil; {
+		if len(env.provided) > 0 && !fn(env) {
+			return
+		}
+		if env.call != nil && env.call.caller != nil {
+			env = env.call.caller
+		} else {
+			env = env.outer
+		}
+	}
+}
+
+// providerName describes where a value was provided, for provided()
+func (e *Environment) providerName() string {
+	switch {
+	case e.call == nil:
+		return "top level"
+	case e.call.tag != "":
+		return fmt.Sprintf("<%s> on line %d", e.call.tag, e.call.site.Line)
+	case e.call.fn != nil:
+		return fmt.Sprintf("fn on line %d", e.call.fn.Body.Token.Line)
+	}
+	return "fn"
+}
+
+// evalProvide implements provide(), inject() and provided()
+func evalProvide(name string, args []Object, env *Environment) Object {
+	switch name {
+	case "provide":
+		if len(args) != 2 {
+			return newError("wrong number of arguments to `provide`. got=%d, want=2", len(args))
+		}
+		key, ok := args[0].(*String)
+		if !ok {
+			return newError("first argument to `provide` must be a string, got %s", args[0].Type())
+		}
+		scope := env.provideScope()
+		if scope.provided == nil {
+			scope.provided = make(map[string]Object)
+		}
+		scope.provided[key.Value] = args[1]
+		return NULL
+
+	case "inject":
+		if len(args) < 1 || len(args) > 2 {
+			return newError("wrong number of arguments to `inject`. got=%d, want=1-2", len(args))
+		}
+		key, ok := args[0].(*String)
+		if !ok {
+			return newError("first argument to `inject` must be a string, got %s", args[0].Type())
+		}
+		var val Object
+		env.eachProvider(func(p *Environment) bool {
+			val = p.provided[key.Value]
+			return val == nil
+		})
+		if val != nil {
+			return val
+		}
+		if len(args) == 2 {
+			return args[1]
+		}
+		return newError("inject: nothing provided for %q (call provide(%q, value) in a calling function, or pass a default)", key.Value, key.Value)
+
+	default: // provided
+		if len(args) != 0 {
+			return newError("wrong number of arguments to `provided`. got=%d, want=0", len(args))
+		}
+		seen := map[string]bool{}
+		elements := []Object{}
+		env.eachProvider(func(p *Environment) bool {
+			keys := make([]string, 0, len(p.provided))
+			for key := range p.provided {
+				if !seen[key] {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				seen[key] = true
+				elements = append(elements, &Dictionary{
+					Pairs: map[string]ast.Expression{
+						"key":   createLiteralExpression(&String{Value: key}),
+						"value": createLiteralExpression(p.provided[key]),
+						"from":  createLiteralExpression(&String{Value: p.providerName()}),
+					},
+					Env: env,
+				})
+			}
+			return true
+		})
+		return &Array{Elements: elements}
+	}
+}
@@ -0,0 +1,235 @@
+package evaluator
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/sambeau/parsley/pkg/ast"
+	"github.com/sambeau/parsley/pkg/lexer"
+)
+
+// Ranges (1..10, 1..10 by 2, range(1, 10, 2)) are lazy. A Range holds its
+// bounds and step, and for loops, indexing, slicing, the in operator and the
+// methods below work from those, so a range of a billion numbers costs
+// nothing until its elements are used. A range becomes an array only when it
+// is converted: by toArray(), by an operator such as ++ or ==, by an array
+// method the range doesn't have itself, or by a builtin that takes an array.
+
+// Range is an inclusive range of integers
+type Range struct {
+	start, end int64
+	step       int64 // negative for descending ranges
+}
+
+func (r *Range) Type() ObjectType { return RANGE_OBJ }
+
+// Inspect lists the elements, as an array would
+func (r *Range) Inspect() string {
+	var out strings.Builder
+	out.WriteString("[")
+	for i := int64(0); i < r.length(); i++ {
+		if i > 0 {
+			out.WriteString(", ")
+		}
+		out.WriteString(strconv.FormatInt(r.start+i*r.step, 10))
+	}
+	out.WriteString("]")
+	return out.String()
+}
+
+// newRange validates a range's bounds and step. The step is a size (default
+// 1) and the direction comes from the bounds, so 10..1 by 2 counts down. A
+// negative step counts down too, and can only be used with bounds that do.
+func newRange(tok lexer.Token, start, end, step Object) (*Range, *Error) {
+	s, ok := start.(*Integer)
+	if !ok {
+		return nil, newErrorWithPos(tok, "range start must be an integer, got %s", start.Type())
+	}
+	e, ok := end.(*Integer)
+	if !ok {
+		return nil, newErrorWithPos(tok, "range end must be an integer, got %s", end.Type())
+	}
+
+	size := int64(1)
+	if step != nil {
+		st, ok := step.(*Integer)
+		if !ok {
+			return nil, newErrorWithPos(tok, "range step must be an integer, got %s", step.Type())
+		}
+		if st.Value == 0 {
+			return nil, newErrorWithPos(tok, "range step can't be zero")
+		}
+		if st.Value < 0 && s.Value < e.Value {
+			return nil, newErrorWithPos(tok, "range step %d counts down, but %d..%d counts up", st.Value, s.Value, e.Value)
+		}
+		size = st.Value
+		if size < 0 {
+			size = -size
+		}
+	}
+
+	if s.Value > e.Value {
+		size = -size
+	}
+	return &Range{start: s.Value, end: e.Value, step: size}, nil
+}
+
+// evalRange evaluates a range expression's bounds and step
+func evalRange(node *ast.RangeExpression, env *Environment) (*Range, Object) {
+	start := Eval(node.Start, env)
+	if isError(start) {
+		return nil, start
+	}
+	end := Eval(node.End, env)
+	if isError(end) {
+		return nil, end
+	}
+	var step Object
+	if node.Step != nil {
+		step = Eval(node.Step, env)
+		if isError(step) {
+			return nil, step
+		}
+	}
+	r, err := newRange(node.Token, start, end, step)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Range) length() int64 {
+	return (r.end-r.start)/r.step + 1
+}
+
+func (r *Range) at(i int64) Object {
+	return &Integer{Value: r.start + i*r.step}
+}
+
+func (r *Range) last() int64 {
+	return r.start + (r.length()-1)*r.step
+}
+
+func (r *Range) each(visit func(Object) Object) Object {
+	n := r.length()
+	for i := int64(0); i < n; i++ {
+		if result := visit(r.at(i)); result != nil {
+			return result
+		}
+	}
+	return nil
+}
+
+func (r *Range) contains(n int64) bool {
+	offset := n - r.start
+	if offset%r.step != 0 {
+		return false
+	}
+	i := offset / r.step
+	return i >= 0 && i < r.length()
+}
+
+func (r *Range) toArray() *Array {
+	elements := make([]Object, r.length())
+	for i := range elements {
+		elements[i] = r.at(int64(i))
+	}
+	return &Array{Elements: elements}
+}
+
+// rangeAsArray returns obj, or the elements of a range as an array
+func rangeAsArray(obj Object) Object {
+	if r, ok := obj.(*Range); ok {
+		return r.toArray()
+	}
+	return obj
+}
+
+// rangesAsArrays converts the ranges among a builtin's arguments to arrays
+func rangesAsArrays(args []Object) []Object {
+	for i, arg := range args {
+		if r, ok := arg.(*Range); ok {
+			converted := make([]Object, len(args))
+			copy(converted, args)
+			converted[i] = r.toArray()
+			for j := i + 1; j < len(args); j++ {
+				converted[j] = rangeAsArray(args[j])
+			}
+			return converted
+		}
+	}
+	return args
+}
+
+// evalRangeMethod calls a method on a range. Methods that don't need the
+// elements all at once work from the bounds; the rest are array methods
+// called on the range's elements.
+func evalRangeMethod(r *Range, method string, args []Object, env *Environment) Object {
+	switch method {
+	case "length", "first", "last", "reverse", "toArray":
+		if len(args) != 0 {
+			return newError("wrong number of arguments to `%s`. got=%d, want=0", method, len(args))
+		}
+		switch method {
+		case "length":
+			return &Integer{Value: r.length()}
+		case "first":
+			return r.at(0)
+		case "last":
+			return &Integer{Value: r.last()}
+		case "reverse":
+			return &Range{start: r.last(), end: r.start, step: -r.step}
+		default:
+			return r.toArray()
+		}
+
+	case "includes":
+		if len(args) != 1 {
+			return newError("wrong number of arguments to `includes`. got=%d, want=1", len(args))
+		}
+		n, ok := args[0].(*Integer)
+		return nativeBoolToParsBoolean(ok && r.contains(n.Value))
+
+	case "map", "filter":
+		if len(args) != 1 {
+			return newError("wrong number of arguments to `%s`. got=%d, want=1", method, len(args))
+		}
+		fn, ok := args[0].(*Function)
+		if !ok {
+			return newError("argument to '%s' must be a function, got %s", method, args[0].Type())
+		}
+		if method == "map" {
+			return mapWithFunction(r.each, fn, env)
+		}
+		return filterWithFunction(r.each, fn, env)
+
+	default:
+		return evalArrayMethod(r.toArray(), method, args, env)
+	}
+}
+
+// evalRangeIndexExpression indexes a range, counting from the end for
+// negative indexes
+func evalRangeIndexExpression(tok lexer.Token, r *Range, index *Integer) Object {
+	idx := index.Value
+	if idx < 0 {
+		idx = r.length() + idx
+	}
+	if idx < 0 || idx >= r.length() {
+		return newErrorWithPos(tok, "index out of range: %d", index.Value)
+	}
+	return r.at(idx)
+}
+
+// evalRangeSliceExpression slices a range as an array would be, giving a
+// smaller range
+func evalRangeSliceExpression(r *Range, start, end Object) Object {
+	startIdx, endIdx, errObj := sliceBounds(r.length(), start, end)
+	if errObj != nil {
+		return errObj
+	}
+	if startIdx == endIdx {
+		return &Array{Elements: []Object{}}
+	}
+	return &Range{start: r.start + startIdx*r.step, end: r.start + (endIdx-1)*r.step, step: r.step}
+}
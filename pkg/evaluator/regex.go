@@ -0,0 +1,177 @@
+package evaluator
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sambeau/parsley/pkg/ast"
+)
+
+// stripVerboseRegex removes the whitespace and # comments from a pattern
+// written with the x (verbose) flag. Whitespace and # are kept inside
+// character classes, and can be matched elsewhere with \ and \#.
+func stripVerboseRegex(pattern string) string {
+	var out strings.Builder
+	inClass := false
+	for i := 0; i < len(pattern); i++ {
+		ch := pattern[i]
+		switch {
+		case ch == '\\' && i+1 < len(pattern):
+			i++
+			if pattern[i] == ' ' {
+				// Go's regexp doesn't allow an escaped space
+				out.WriteByte(' ')
+			} else {
+				out.WriteByte(ch)
+				out.WriteByte(pattern[i])
+			}
+		case inClass:
+			if ch == ']' {
+				inClass = false
+			}
+			out.WriteByte(ch)
+		case ch == '[':
+			inClass = true
+			out.WriteByte(ch)
+			// A ] straight after [ or [^ is part of the class
+			if i+1 < len(pattern) && pattern[i+1] == '^' {
+				i++
+				out.WriteByte('^')
+			}
+			if i+1 < len(pattern) && pattern[i+1] == ']' {
+				i++
+				out.WriteByte(']')
+			}
+		case ch == '#':
+			for i+1 < len(pattern) && pattern[i+1] != '\n' {
+				i++
+			}
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+		default:
+			out.WriteByte(ch)
+		}
+	}
+	return out.String()
+}
+
+// compileRegexDict compiles the pattern and flags of a regex dictionary
+func compileRegexDict(dict *Dictionary, env *Environment) (*regexp.Regexp, error) {
+	var pattern, flags string
+	if patternExpr, ok := dict.Pairs["pattern"]; ok {
+		if str, ok := Eval(patternExpr, env).(*String); ok {
+			pattern = str.Value
+		}
+	}
+	if flagsExpr, ok := dict.Pairs["flags"]; ok {
+		if str, ok := Eval(flagsExpr, env).(*String); ok {
+			flags = str.Value
+		}
+	}
+	return compileRegex(pattern, flags)
+}
+
+// regexMatch returns a match object describing one match of re in text.
+// Match objects are dictionaries with __type "match":
+//
+//	{match: "2024-01", start: 4, end: 11, before: "due ", after: "",
+//	 captures: ["2024", "01"], groups: {year: "2024", month: "01"}}
+//
+// Indexes are character offsets, like string indexing, not byte offsets.
+// Groups that didn't take part in the match are null. Indexing and
+// destructuring treat a match as the array [match, ...captures], as ~
+// returned before match objects.
+func regexMatch(re *regexp.Regexp, text string, loc []int, env *Environment) *Dictionary {
+	names := re.SubexpNames()
+	captures := make([]Object, 0, len(names)-1)
+	groups := make(map[string]ast.Expression)
+	for g := 1; g < len(names); g++ {
+		var value Object = NULL
+		if loc[2*g] >= 0 {
+			value = &String{Value: text[loc[2*g]:loc[2*g+1]]}
+		}
+		captures = append(captures, value)
+		if names[g] != "" {
+			groups[names[g]] = objectToExpression(value)
+		}
+	}
+
+	start := utf8.RuneCountInString(text[:loc[0]])
+	end := start + utf8.RuneCountInString(text[loc[0]:loc[1]])
+	pairs := map[string]ast.Expression{
+		"__type":   objectToExpression(&String{Value: "match"}),
+		"match":    objectToExpression(&String{Value: text[loc[0]:loc[1]]}),
+		"start":    objectToExpression(&Integer{Value: int64(start)}),
+		"end":      objectToExpression(&Integer{Value: int64(end)}),
+		"before":   objectToExpression(&String{Value: text[:loc[0]]}),
+		"after":    objectToExpression(&String{Value: text[loc[1]:]}),
+		"captures": objectToExpression(&Array{Elements: captures}),
+		"groups":   objectToExpression(&Dictionary{Pairs: groups, Env: env}),
+	}
+	return &Dictionary{Pairs: pairs, Env: env}
+}
+
+// matchElements returns a match object as the array [match, ...captures]
+func matchElements(dict *Dictionary) *Array {
+	elements := []Object{}
+	if expr, ok := dict.Pairs["match"]; ok {
+		elements = append(elements, Eval(expr, dict.Env))
+	}
+	if expr, ok := dict.Pairs["captures"]; ok {
+		if captures, ok := Eval(expr, dict.Env).(*Array); ok {
+			elements = append(elements, captures.Elements...)
+		}
+	}
+	return &Array{Elements: elements}
+}
+
+// matchDictToString returns the text a match object matched
+func matchDictToString(dict *Dictionary) string {
+	if expr, ok := dict.Pairs["match"]; ok {
+		if str, ok := Eval(expr, dict.Env).(*String); ok {
+			return str.Value
+		}
+	}
+	return ""
+}
+
+// regexMatchAll returns a match dictionary for every match of re in text
+func regexMatchAll(re *regexp.Regexp, text string, env *Environment) *Array {
+	locs := re.FindAllStringSubmatchIndex(text, -1)
+	elements := make([]Object, len(locs))
+	for i, loc := range locs {
+		elements[i] = regexMatch(re, text, loc, env)
+	}
+	return &Array{Elements: elements}
+}
+
+// regexReplace replaces every match of re in text. A string replacement can
+// refer to groups as $1 or ${name}; a function replacement is called with
+// each match's dictionary and returns the text to use.
+func regexReplace(re *regexp.Regexp, text string, replacement Object, env *Environment) Object {
+	switch r := replacement.(type) {
+	case *String:
+		return &String{Value: re.ReplaceAllString(text, r.Value)}
+	case *Function, *Builtin:
+	default:
+		return newError("third argument to `replace` must be a string or function, got %s", replacement.Type())
+	}
+
+	var out strings.Builder
+	last := 0
+	for _, loc := range re.FindAllStringSubmatchIndex(text, -1) {
+		result := applyFunction(replacement, []Object{regexMatch(re, text, loc, env)})
+		if isError(result) {
+			return result
+		}
+		out.WriteString(text[last:loc[0]])
+		if str, ok := result.(*String); ok {
+			out.WriteString(str.Value)
+		} else {
+			out.WriteString(result.Inspect())
+		}
+		last = loc[1]
+	}
+	out.WriteString(text[last:])
+	return &String{Value: out.String()}
+}
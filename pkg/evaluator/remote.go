@@ -0,0 +1,337 @@
+package evaluator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sambeau/parsley/pkg/ast"
+	"github.com/sambeau/parsley/pkg/lexer"
+	"github.com/sambeau/parsley/pkg/parser"
+)
+
+// Modules can be imported by URL:
+//
+//	let {slugify} = import(@https://example.com/lib/strings.pars)
+//
+// A remote module is downloaded once and kept in ~/.parsley/cache under the
+// SHA-256 hash of its contents. The first import records the hash in
+// parsley.lock (Environment.LockFile); after that the cached copy is used
+// without going to the network, and a download that doesn't match the
+// recorded hash is an error, so a module can't change under a project that
+// uses it. Relative imports inside a remote module are fetched from the same
+// server. `pars mod download` fetches a project's remote modules ahead of
+// time, for CI or working offline.
+
+// LockFileName is the name of the file that records remote module hashes
+const LockFileName = "parsley.lock"
+
+// remoteModuleTimeout is how long a module download may take
+const remoteModuleTimeout = 30 * time.Second
+
+// lockFileHeader starts every lock file pars writes
+const lockFileHeader = "# Hashes of the remote modules this project imports, written by pars.\n# Commit this file so everyone runs the same code.\n"
+
+// isRemoteModulePath reports whether an import path is a URL
+func isRemoteModulePath(p string) bool {
+	return strings.HasPrefix(p, "https://") || strings.HasPrefix(p, "http://")
+}
+
+// resolveModuleURL resolves a relative import in the remote module at base
+func resolveModuleURL(base, pathStr string) (string, error) {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(filepath.ToSlash(pathStr))
+	if err != nil {
+		return "", err
+	}
+	return baseURL.ResolveReference(ref).String(), nil
+}
+
+// ModuleCacheDir returns the directory remote modules are cached in
+func ModuleCacheDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".parsley", "cache"), nil
+}
+
+// moduleHash returns the hash a module is locked and cached by
+func moduleHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// cachedModulePath returns where the module at rawURL with the given hash is
+// cached. The URL's extension is kept, so data files are still recognised.
+func cachedModulePath(cacheDir, hash, rawURL string) string {
+	ext := ".pars"
+	if u, err := url.Parse(rawURL); err == nil && path.Ext(u.Path) != "" {
+		ext = path.Ext(u.Path)
+	}
+	return filepath.Join(cacheDir, "sha256", strings.TrimPrefix(hash, "sha256:")+ext)
+}
+
+// ReadLockFile reads the module URLs and hashes in a lock file. A missing
+// lock file has none.
+func ReadLockFile(lockFile string) (map[string]string, error) {
+	sums := map[string]string{}
+	data, err := os.ReadFile(lockFile)
+	if os.IsNotExist(err) {
+		return sums, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || !strings.HasPrefix(fields[1], "sha256:") {
+			return nil, fmt.Errorf("%s:%d: expected a URL and a sha256: hash", lockFile, i+1)
+		}
+		sums[fields[0]] = fields[1]
+	}
+	return sums, nil
+}
+
+// WriteLockFile writes module URLs and hashes to a lock file, sorted by URL
+func WriteLockFile(lockFile string, sums map[string]string) error {
+	urls := make([]string, 0, len(sums))
+	for u := range sums {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+
+	var b strings.Builder
+	b.WriteString(lockFileHeader)
+	for _, u := range urls {
+		fmt.Fprintf(&b, "%s %s\n", u, sums[u])
+	}
+	return writeFileAtomic(lockFile, []byte(b.String()), 0644)
+}
+
+// fetchModule returns the source of the module at rawURL and the file it's
+// cached in. With a locked hash, the cached copy is used if there is one, and
+// a download must match it; without one, any download is accepted.
+func fetchModule(rawURL, locked string) (content []byte, cachePath string, hash string, err error) {
+	cacheDir, err := ModuleCacheDir()
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	if locked != "" {
+		cachePath = cachedModulePath(cacheDir, locked, rawURL)
+		if data, err := os.ReadFile(cachePath); err == nil && moduleHash(data) == locked {
+			recordFileRead(len(data))
+			return data, cachePath, locked, nil
+		}
+	}
+
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, "", "", err
+	}
+	start := time.Now()
+	resp, err := sendRequest(&http.Client{Timeout: remoteModuleTimeout}, req)
+	if err != nil {
+		recordHTTPRequest(start, 0)
+		return nil, "", "", err
+	}
+	defer resp.Body.Close()
+	content, err = io.ReadAll(resp.Body)
+	recordHTTPRequest(start, len(content))
+	if err != nil {
+		return nil, "", "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", "", fmt.Errorf("server returned %s", resp.Status)
+	}
+
+	hash = moduleHash(content)
+	if locked != "" && hash != locked {
+		return nil, "", "", fmt.Errorf("download doesn't match %s: got %s, want %s (if the module was meant to change, remove its line from the lock file)", LockFileName, hash, locked)
+	}
+
+	cachePath = cachedModulePath(cacheDir, hash, rawURL)
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return nil, "", "", err
+	}
+	if err := writeFileAtomic(cachePath, content, 0644); err != nil {
+		return nil, "", "", err
+	}
+	recordFileWrite(len(content))
+	return content, cachePath, hash, nil
+}
+
+// importRemote implements import() for a module URL
+func importRemote(rawURL string, env *Environment) Object {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return newError("invalid module URL: %s", rawURL)
+	}
+
+	// A module that is still loading was imported circularly
+	if load, ok := moduleCache.loading[rawURL]; ok {
+		return load.circularImport(rawURL)
+	}
+	if cached, ok := moduleCache.modules[rawURL]; ok {
+		return cached
+	}
+
+	// Remote modules run from the cache, so that's what needs permission
+	cacheDir, err := ModuleCacheDir()
+	if err != nil {
+		return newError("failed to import %s: %s", rawURL, err.Error())
+	}
+	operation := "execute"
+	if dataModuleFormat(u.Path) != "" {
+		operation = "read"
+	}
+	if err := env.checkPathAccess(filepath.Join(cacheDir, "sha256"), operation); err != nil {
+		return newError("security: %s", err.Error())
+	}
+
+	locked := map[string]string{}
+	if env.LockFile != "" {
+		if locked, err = ReadLockFile(env.LockFile); err != nil {
+			return newError("failed to read %s: %s", env.LockFile, err.Error())
+		}
+	}
+	content, cachePath, hash, err := fetchModule(rawURL, locked[rawURL])
+	if err != nil {
+		return newError("failed to import %s: %s", rawURL, err.Error())
+	}
+	if env.LockFile != "" && locked[rawURL] == "" {
+		locked[rawURL] = hash
+		if err := WriteLockFile(env.LockFile, locked); err != nil {
+			return newError("failed to write %s: %s", env.LockFile, err.Error())
+		}
+	}
+
+	return evalModule(rawURL, cachePath, rawURL, content, env)
+}
+
+// DownloadedModule is a remote module fetched by DownloadModules
+type DownloadedModule struct {
+	URL  string
+	Hash string
+	Path string // the cached copy
+}
+
+// DownloadModules fetches remote modules, and the remote modules they
+// import, into the module cache, checking them against lockFile and adding
+// any that aren't in it yet
+func DownloadModules(urls []string, lockFile string) ([]DownloadedModule, error) {
+	locked, err := ReadLockFile(lockFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var downloaded []DownloadedModule
+	seen := map[string]bool{}
+	queue := append([]string{}, urls...)
+	for len(queue) > 0 {
+		rawURL := queue[0]
+		queue = queue[1:]
+		if seen[rawURL] {
+			continue
+		}
+		seen[rawURL] = true
+
+		content, cachePath, hash, err := fetchModule(rawURL, locked[rawURL])
+		if err != nil {
+			return downloaded, fmt.Errorf("%s: %w", rawURL, err)
+		}
+		locked[rawURL] = hash
+		downloaded = append(downloaded, DownloadedModule{URL: rawURL, Hash: hash, Path: cachePath})
+
+		if dataModuleFormat(cachePath) == "" {
+			p := parser.New(lexer.New(string(content)))
+			program := p.ParseProgram()
+			if len(p.Errors()) > 0 {
+				return downloaded, fmt.Errorf("%s: %s", rawURL, p.Errors()[0])
+			}
+			queue = append(queue, RemoteImports(program, rawURL)...)
+		}
+	}
+
+	if err := WriteLockFile(lockFile, locked); err != nil {
+		return downloaded, err
+	}
+	return downloaded, nil
+}
+
+// RemoteImports lists the module URLs a program imports with a literal
+// path. In a remote module (base is its URL), relative imports are remote
+// too.
+func RemoteImports(program *ast.Program, base string) []string {
+	var urls []string
+	add := func(arg ast.Expression) {
+		var p string
+		switch lit := arg.(type) {
+		case *ast.UrlLiteral:
+			p = lit.Value
+		case *ast.StringLiteral:
+			p = lit.Value
+		case *ast.PathLiteral:
+			p = lit.Value
+		default:
+			return
+		}
+		switch {
+		case isRemoteModulePath(p):
+			urls = append(urls, p)
+		case base != "" && isExplicitModulePath(p) && !filepath.IsAbs(p):
+			if u, err := resolveModuleURL(base, p); err == nil {
+				urls = append(urls, u)
+			}
+		}
+	}
+
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface:
+			if v.IsNil() {
+				return
+			}
+			if v.Kind() == reflect.Ptr && v.CanInterface() {
+				switch node := v.Interface().(type) {
+				case *ast.CallExpression:
+					if ident, ok := node.Function.(*ast.Identifier); ok && ident.Value == "import" && len(node.Arguments) == 1 {
+						add(node.Arguments[0])
+					}
+				case *ast.ImportStatement:
+					add(node.Path)
+				}
+			}
+			walk(v.Elem())
+		case reflect.Struct:
+			for i := 0; i < v.NumField(); i++ {
+				walk(v.Field(i))
+			}
+		case reflect.Slice:
+			for i := 0; i < v.Len(); i++ {
+				walk(v.Index(i))
+			}
+		}
+	}
+	walk(reflect.ValueOf(program))
+	return urls
+}
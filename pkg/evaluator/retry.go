@@ -0,0 +1,118 @@
+package evaluator
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// retry(options) { ... } runs its block again when it fails or returns
+// false or null, waiting longer between each try, for fetches and transfers
+// that fail now and then:
+//
+//	let page = retry({times: 5, backoff: @2s, jitter: true}) {
+//	    let {data, status} <=/= text(url(u))
+//	    if (status == 200) { data }
+//	}
+//
+// The first retry waits backoff, and each after it twice as long as the one
+// before. jitter waits a random time between half and all of that, so
+// scripts retrying together spread out. A block with a parameter is given
+// the try's number, from 1. Once every try has failed, retry returns the
+// last error, or the last false or null.
+
+// defaultRetryTimes and defaultRetryBackoff are used when retry's options
+// don't say
+const (
+	defaultRetryTimes   = 3
+	defaultRetryBackoff = time.Second
+)
+
+// evalRetry implements retry(options?) { ... } and retry(options?, fn)
+func evalRetry(args []Object, env *Environment) Object {
+	if len(args) < 1 || len(args) > 2 {
+		return newError("wrong number of arguments to `retry`. got=%d, want=1 or 2", len(args))
+	}
+
+	fn := args[len(args)-1]
+	switch f := fn.(type) {
+	case *Function:
+		if f.ParamCount() > 1 {
+			return newError("function passed to `retry` must take 0 or 1 parameters, got %d", f.ParamCount())
+		}
+	case *Builtin:
+	default:
+		return newError("last argument to `retry` must be a block or function, got %s", fn.Type())
+	}
+
+	times, backoff, jitter := defaultRetryTimes, defaultRetryBackoff, false
+	if len(args) == 2 {
+		opts, ok := args[0].(*Dictionary)
+		if !ok {
+			return newError("options to `retry` must be a dictionary, got %s", args[0].Type())
+		}
+		if expr, ok := opts.Pairs["times"]; ok {
+			n, ok := Eval(expr, opts.Env).(*Integer)
+			if !ok || n.Value < 1 {
+				return newError("`times` option for `retry` must be a positive integer")
+			}
+			times = int(n.Value)
+		}
+		if expr, ok := opts.Pairs["backoff"]; ok {
+			dur, ok := Eval(expr, opts.Env).(*Duration)
+			if !ok {
+				return newError("`backoff` option for `retry` must be a duration")
+			}
+			d, err := dur.toGo()
+			if err != nil || d < 0 {
+				return newError("`backoff` option for `retry` must be a positive duration without months or years")
+			}
+			backoff = d
+		}
+		if expr, ok := opts.Pairs["jitter"]; ok {
+			b, ok := Eval(expr, opts.Env).(*Boolean)
+			if !ok {
+				return newError("`jitter` option for `retry` must be a boolean")
+			}
+			jitter = b.Value
+		}
+	}
+
+	wait := backoff
+	var result Object
+	for try := 1; try <= times; try++ {
+		if try > 1 {
+			if jitter {
+				time.Sleep(wait/2 + time.Duration(rand.Int64N(int64(wait/2)+1)))
+			} else {
+				time.Sleep(wait)
+			}
+			wait *= 2
+		}
+
+		var callArgs []Object
+		if f, ok := fn.(*Function); ok && f.ParamCount() == 1 {
+			callArgs = []Object{&Integer{Value: int64(try)}}
+		}
+		result = applyFunctionWithEnv(fn, callArgs, env)
+		if result == nil {
+			result = NULL
+		}
+		if errObj, ok := result.(*Error); ok {
+			if errObj.stop {
+				return errObj
+			}
+			continue
+		}
+		if isTruthy(result) {
+			return result
+		}
+	}
+
+	if errObj, ok := result.(*Error); ok && times > 1 {
+		gaveUp := *errObj
+		gaveUp.Message = fmt.Sprintf("gave up after %d tries: %s", times, errObj.Message)
+		return &gaveUp
+	}
+	return result
+}
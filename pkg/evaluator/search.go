@@ -0,0 +1,330 @@
+package evaluator
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// db.createIndex(table, columns) and db.search(table, query) give SQLite
+// databases full-text search with FTS5:
+//
+//	db.createIndex("posts", ["title", "body"])
+//	for (post in db.search("posts", "static sites")) { ... }
+//
+// The index is an external-content FTS5 table named <table>_fts, kept in
+// step with the table by triggers, so it stores no second copy of the text.
+
+// sqlIdentifierRegex matches the table and column names search accepts
+var sqlIdentifierRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Markers FTS5 puts around matches in snippets, replaced after the snippet
+// is escaped
+const (
+	snippetOpen  = "\x02"
+	snippetClose = "\x03"
+)
+
+// searchOptions are db.search's options
+type searchOptions struct {
+	limit, offset, words int
+	open, close          string
+	raw, prefix          bool
+}
+
+// ftsTableName returns the name of the FTS5 index for a table
+func ftsTableName(table string) string {
+	return table + "_fts"
+}
+
+// quoteIdentifiers quotes names for SQL, each with an optional prefix such
+// as new.
+func quoteIdentifiers(names []string, prefix string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = prefix + `"` + name + `"`
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// dbCreateIndex implements db.createIndex(table, columns, {tokenize}). It
+// creates the index and fills it from the table's rows, or does nothing if
+// an index with the same columns and tokenizer already exists.
+func dbCreateIndex(conn *DBConnection, args []Object, env *Environment) Object {
+	if conn.Driver != "sqlite" {
+		return newError("createIndex() requires a SQLite connection, got %s", conn.Driver)
+	}
+	if len(args) < 2 || len(args) > 3 {
+		return newError("createIndex() takes a table name, an array of columns and optional options, got=%d arguments", len(args))
+	}
+	table, ok := args[0].(*String)
+	if !ok || !sqlIdentifierRegex.MatchString(table.Value) {
+		return newError("createIndex() table must be a table name, got %s", args[0].Inspect())
+	}
+	arr, ok := args[1].(*Array)
+	if !ok || len(arr.Elements) == 0 {
+		return newError("createIndex() columns must be a non-empty array of column names")
+	}
+	columns := make([]string, len(arr.Elements))
+	for i, elem := range arr.Elements {
+		col, ok := elem.(*String)
+		if !ok || !sqlIdentifierRegex.MatchString(col.Value) {
+			return newError("createIndex() columns must be column names, got %s at index %d", elem.Inspect(), i)
+		}
+		columns[i] = col.Value
+	}
+
+	tokenize := ""
+	if len(args) == 3 {
+		opts, ok := args[2].(*Dictionary)
+		if !ok {
+			return newError("createIndex() options must be a dictionary, got %s", args[2].Type())
+		}
+		for key, expr := range opts.Pairs {
+			val := Eval(expr, opts.Env)
+			switch key {
+			case "tokenize":
+				str, ok := val.(*String)
+				if !ok {
+					return newError("createIndex() option `tokenize` must be a string, got %s", val.Type())
+				}
+				tokenize = str.Value
+			default:
+				return newError("unknown option %q for createIndex()", key)
+			}
+		}
+	}
+
+	fts := ftsTableName(table.Value)
+	schema := fmt.Sprintf(`CREATE VIRTUAL TABLE "%s" USING fts5(%s, content='%s'`,
+		fts, quoteIdentifiers(columns, ""), table.Value)
+	if tokenize != "" {
+		schema += ", tokenize='" + strings.ReplaceAll(tokenize, "'", "''") + "'"
+	}
+	schema += ")"
+
+	// An index with the same definition is already kept up to date
+	var existing string
+	start := time.Now()
+	err := conn.querier().QueryRow(`SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?`, fts).Scan(&existing)
+	recordSQLQuery(start)
+	if err == nil && existing == schema {
+		return NULL
+	}
+	if err != nil && err != sql.ErrNoRows {
+		conn.LastError = err.Error()
+		return newError("createIndex() failed: %s", err.Error())
+	}
+
+	cols, newCols, oldCols := quoteIdentifiers(columns, ""), quoteIdentifiers(columns, "new."), quoteIdentifiers(columns, "old.")
+	statements := []string{
+		fmt.Sprintf(`DROP TRIGGER IF EXISTS "%s_insert"`, fts),
+		fmt.Sprintf(`DROP TRIGGER IF EXISTS "%s_delete"`, fts),
+		fmt.Sprintf(`DROP TRIGGER IF EXISTS "%s_update"`, fts),
+		fmt.Sprintf(`DROP TABLE IF EXISTS "%s"`, fts),
+		schema,
+		fmt.Sprintf(`INSERT INTO "%s"("%s") VALUES('rebuild')`, fts, fts),
+		fmt.Sprintf(`CREATE TRIGGER "%s_insert" AFTER INSERT ON "%s" BEGIN
+	INSERT INTO "%s"(rowid, %s) VALUES (new.rowid, %s);
+END`, fts, table.Value, fts, cols, newCols),
+		fmt.Sprintf(`CREATE TRIGGER "%s_delete" AFTER DELETE ON "%s" BEGIN
+	INSERT INTO "%s"("%s", rowid, %s) VALUES ('delete', old.rowid, %s);
+END`, fts, table.Value, fts, fts, cols, oldCols),
+		fmt.Sprintf(`CREATE TRIGGER "%s_update" AFTER UPDATE ON "%s" BEGIN
+	INSERT INTO "%s"("%s", rowid, %s) VALUES ('delete', old.rowid, %s);
+	INSERT INTO "%s"(rowid, %s) VALUES (new.rowid, %s);
+END`, fts, table.Value, fts, fts, cols, oldCols, fts, cols, newCols),
+	}
+
+	if env.dryRun("create full-text index on %s (%s)", table.Value, strings.Join(columns, ", ")) {
+		return NULL
+	}
+
+	// The index is built in a transaction of its own, or a savepoint in the
+	// script's
+	if errObj := beginTransaction(conn, env); errObj != nil {
+		return newError("createIndex() failed: %s", errObj.Message)
+	}
+	for _, stmt := range statements {
+		start := time.Now()
+		_, err := conn.Tx.Exec(stmt)
+		recordSQLQuery(start)
+		if err != nil {
+			endTransaction(conn, false)
+			conn.LastError = err.Error()
+			return newError("createIndex() failed: %s", err.Error())
+		}
+	}
+	if errObj := endTransaction(conn, true); errObj != nil {
+		return newError("createIndex() failed: %s", errObj.Message)
+	}
+	return NULL
+}
+
+// defaultSearchOptions returns db.search's defaults: 20 results with
+// snippets of about 12 words
+func defaultSearchOptions() searchOptions {
+	return searchOptions{limit: 20, words: 12, open: "<mark>", close: "</mark>"}
+}
+
+// parseSearchOptions reads db.search's options on top of the defaults
+func parseSearchOptions(dict *Dictionary, opts searchOptions) (searchOptions, *Error) {
+	for key, expr := range dict.Pairs {
+		val := Eval(expr, dict.Env)
+		switch key {
+		case "limit", "offset", "words":
+			n, ok := val.(*Integer)
+			if !ok || n.Value < 0 {
+				return opts, newError("search() option `%s` must be a non-negative integer", key)
+			}
+			switch key {
+			case "limit":
+				opts.limit = int(n.Value)
+			case "offset":
+				opts.offset = int(n.Value)
+			case "words":
+				if n.Value < 1 || n.Value > 64 {
+					return opts, newError("search() option `words` must be between 1 and 64")
+				}
+				opts.words = int(n.Value)
+			}
+		case "raw", "prefix":
+			b, ok := val.(*Boolean)
+			if !ok {
+				return opts, newError("search() option `%s` must be a boolean, got %s", key, val.Type())
+			}
+			if key == "raw" {
+				opts.raw = b.Value
+			} else {
+				opts.prefix = b.Value
+			}
+		case "highlight":
+			arr, ok := val.(*Array)
+			if !ok || len(arr.Elements) != 2 {
+				return opts, newError("search() option `highlight` must be an array of two strings")
+			}
+			start, ok1 := arr.Elements[0].(*String)
+			end, ok2 := arr.Elements[1].(*String)
+			if !ok1 || !ok2 {
+				return opts, newError("search() option `highlight` must be an array of two strings")
+			}
+			opts.open, opts.close = start.Value, end.Value
+		default:
+			return opts, newError("unknown option %q for search()", key)
+		}
+	}
+	return opts, nil
+}
+
+// ftsMatchQuery turns search box text into an FTS5 query matching rows that
+// contain every word. Each word is quoted, so punctuation and FTS5 keywords
+// like OR are searched for rather than interpreted.
+func ftsMatchQuery(query string, prefix bool) string {
+	words := strings.Fields(query)
+	for i, word := range words {
+		words[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"`
+		if prefix {
+			words[i] += "*"
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// dbSearch implements db.search(table, query, options). It returns the
+// matching rows, best match first, each with a score (higher is better) and
+// an HTML snippet of the matching text with the matches highlighted.
+func dbSearch(conn *DBConnection, args []Object, env *Environment) Object {
+	if conn.Driver != "sqlite" {
+		return newError("search() requires a SQLite connection, got %s", conn.Driver)
+	}
+	if len(args) < 2 || len(args) > 3 {
+		return newError("search() takes a table name, a query and optional options, got=%d arguments", len(args))
+	}
+	table, ok := args[0].(*String)
+	if !ok || !sqlIdentifierRegex.MatchString(table.Value) {
+		return newError("search() table must be a table name, got %s", args[0].Inspect())
+	}
+	query, ok := args[1].(*String)
+	if !ok {
+		return newError("search() query must be a string, got %s", args[1].Type())
+	}
+	opts := defaultSearchOptions()
+	if len(args) == 3 {
+		dict, ok := args[2].(*Dictionary)
+		if !ok {
+			return newError("search() options must be a dictionary, got %s", args[2].Type())
+		}
+		var errObj *Error
+		if opts, errObj = parseSearchOptions(dict, opts); errObj != nil {
+			return errObj
+		}
+	}
+
+	match := query.Value
+	if !opts.raw {
+		match = ftsMatchQuery(match, opts.prefix)
+	}
+	if strings.TrimSpace(match) == "" {
+		return &Array{Elements: []Object{}}
+	}
+
+	fts := ftsTableName(table.Value)
+	stmt := fmt.Sprintf(`SELECT "%s".*, -bm25("%s") AS score, snippet("%s", -1, ?, ?, '…', ?) AS snippet
+FROM "%s" JOIN "%s" ON "%s".rowid = "%s".rowid
+WHERE "%s" MATCH ?
+ORDER BY bm25("%s")
+LIMIT ? OFFSET ?`, table.Value, fts, fts, fts, table.Value, table.Value, fts, fts, fts)
+
+	start := time.Now()
+	rows, err := conn.querier().Query(stmt, snippetOpen, snippetClose, opts.words, match, opts.limit, opts.offset)
+	recordSQLQuery(start)
+	if err != nil {
+		conn.LastError = err.Error()
+		if strings.Contains(err.Error(), "no such table: "+fts) {
+			return newError("search() found no index for %s; create one with db.createIndex(%q, [columns])", table.Value, table.Value)
+		}
+		return newError("search failed: %s", err.Error())
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		conn.LastError = err.Error()
+		return newError("failed to get columns: %s", err.Error())
+	}
+	kinds := columnKinds(rows, columns, nil)
+
+	results := []Object{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		valuePtrs := make([]interface{}, len(columns))
+		for i := range values {
+			valuePtrs[i] = &values[i]
+		}
+		if err := rows.Scan(valuePtrs...); err != nil {
+			conn.LastError = err.Error()
+			return newError("failed to scan row: %s", err.Error())
+		}
+
+		// The snippet is the row's own text, so escape it before adding the
+		// highlight tags
+		snippet := values[len(values)-1]
+		if b, ok := snippet.([]byte); ok {
+			snippet = string(b)
+		}
+		if s, ok := snippet.(string); ok {
+			s = html.EscapeString(s)
+			s = strings.ReplaceAll(s, snippetOpen, opts.open)
+			values[len(values)-1] = strings.ReplaceAll(s, snippetClose, opts.close)
+		}
+		results = append(results, rowToDict(columns, kinds, values, env))
+	}
+	if err := rows.Err(); err != nil {
+		conn.LastError = err.Error()
+		return newError("search failed: %s", err.Error())
+	}
+	return &Array{Elements: results}
+}
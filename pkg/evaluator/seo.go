@@ -0,0 +1,135 @@
+package evaluator
+
+import (
+	"encoding/json"
+	"html"
+	"net/url"
+	"strings"
+)
+
+// seo({title, description, image, url, ...}) renders the <title>, description,
+// canonical link, Open Graph and Twitter card tags for a page, and
+// jsonld(data) renders schema.org structured data as a script tag. Both
+// return HTML strings for the page's <head>.
+
+// seoOptionNames are the keys seo accepts
+var seoOptionNames = map[string]bool{
+	"title": true, "description": true, "image": true, "imageAlt": true,
+	"url": true, "type": true, "siteName": true, "locale": true, "twitter": true,
+}
+
+// buildSEOTags renders the head tags for seo's options. Missing options leave
+// their tags out; the rest fall back to related options where they can.
+func buildSEOTags(opts *Dictionary) (string, *Error) {
+	values := map[string]string{}
+	for key, expr := range opts.Pairs {
+		if !seoOptionNames[key] {
+			return "", newError("unknown option %q for `seo`", key)
+		}
+		val := Eval(expr, opts.Env)
+		if isError(val) {
+			return "", val.(*Error)
+		}
+		values[key] = strings.TrimSpace(objectToTemplateString(val))
+	}
+
+	title := values["title"]
+	if title == "" {
+		title = values["siteName"]
+	}
+	if title == "" {
+		return "", newError("`seo` needs a `title` or `siteName`")
+	}
+	pageType := values["type"]
+	if pageType == "" {
+		pageType = "website"
+	}
+
+	// Open Graph needs an absolute image URL, so resolve it against the page
+	image := values["image"]
+	if image != "" && values["url"] != "" {
+		if base, err := url.Parse(values["url"]); err == nil {
+			if ref, err := url.Parse(image); err == nil {
+				image = base.ResolveReference(ref).String()
+			}
+		}
+	}
+
+	card := "summary"
+	if image != "" {
+		card = "summary_large_image"
+	}
+	twitter := values["twitter"]
+	if twitter != "" && !strings.HasPrefix(twitter, "@") {
+		twitter = "@" + twitter
+	}
+
+	var out strings.Builder
+	out.WriteString("<title>" + html.EscapeString(title) + "</title>")
+	meta := func(attr, name, content string) {
+		if content != "" {
+			out.WriteString("\n<meta " + attr + `="` + name + `" content="` + html.EscapeString(content) + `" />`)
+		}
+	}
+	meta("name", "description", values["description"])
+	if values["url"] != "" {
+		out.WriteString("\n" + `<link rel="canonical" href="` + html.EscapeString(values["url"]) + `" />`)
+	}
+	meta("property", "og:title", title)
+	meta("property", "og:description", values["description"])
+	meta("property", "og:type", pageType)
+	meta("property", "og:url", values["url"])
+	meta("property", "og:image", image)
+	meta("property", "og:image:alt", values["imageAlt"])
+	meta("property", "og:site_name", values["siteName"])
+	meta("property", "og:locale", strings.ReplaceAll(values["locale"], "-", "_"))
+	meta("name", "twitter:card", card)
+	meta("name", "twitter:site", twitter)
+	meta("name", "twitter:title", title)
+	meta("name", "twitter:description", values["description"])
+	meta("name", "twitter:image", image)
+	meta("name", "twitter:image:alt", values["imageAlt"])
+	return out.String(), nil
+}
+
+// buildJSONLD renders data as a JSON-LD script tag. Parsley keys can't start
+// with @, so type, id and context are written as @type, @id and @context, and
+// a missing @context defaults to schema.org.
+func buildJSONLD(data *Dictionary) (string, *Error) {
+	value := jsonldKeys(objectToGo(data))
+	if doc, ok := value.(map[string]interface{}); ok {
+		if _, ok := doc["@context"]; !ok {
+			doc["@context"] = "https://schema.org"
+		}
+	}
+
+	// Marshal escapes <, > and &, so the JSON can't end the script early
+	jsonBytes, err := json.Marshal(value)
+	if err != nil {
+		return "", newError("jsonld error: %s", err.Error())
+	}
+	return `<script type="application/ld+json">` + string(jsonBytes) + "</script>", nil
+}
+
+// jsonldKeys renames type, id and context keys to their JSON-LD @ forms,
+// throughout nested dictionaries and arrays
+func jsonldKeys(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			switch key {
+			case "type", "id", "context":
+				key = "@" + key
+			}
+			result[key] = jsonldKeys(val)
+		}
+		return result
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = jsonldKeys(elem)
+		}
+		return v
+	}
+	return value
+}
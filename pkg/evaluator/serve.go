@@ -0,0 +1,299 @@
+package evaluator
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// serve(handler, {port, host}) runs a web server that calls handler with
+// each request and sends back what it returns:
+//
+//	serve(fn(req) {
+//	    if (req.path == "/") { <h1>Hello, {req.query.name ?? "world"}</h1> }
+//	}, {port: 3000})
+//
+// The request is a dictionary of method, path, query, headers (with
+// lowercase names) and body. Strings and tags are sent as HTML, other
+// dictionaries and arrays as JSON, and null as a 404. A dictionary with a
+// status and nothing but headers and body sets the response itself:
+//
+//	{status: 302, headers: {location: "/login"}}
+//
+// The request's strings are marked untrusted, and so are strings made from
+// them with +, template strings, string methods and join. A tag escapes an
+// untrusted string put into its contents or attributes, as does a handler
+// returning one, so <p>{req.query.name}</p> can't inject markup. raw() gives
+// the string unmarked, for values the handler has checked itself.
+//
+// Environments aren't safe to share between goroutines, so requests are
+// handled one at a time. pars serve runs a script whose result is a
+// handler, reloading it when the script or its modules change.
+
+const (
+	defaultServeHost = "127.0.0.1"
+	defaultServePort = 8080
+	// maxRequestBody is the most of a request body handlers are given
+	maxRequestBody = 10 << 20
+)
+
+// ServeLog receives a line for each request served and for handler errors
+var ServeLog io.Writer = os.Stderr
+
+// evalServe implements serve(handler, options?)
+func evalServe(args []Object, env *Environment) Object {
+	if len(args) < 1 || len(args) > 2 {
+		return newError("wrong number of arguments to `serve`. got=%d, want=1 or 2", len(args))
+	}
+	handler, err := ServeHandler(args[0], env)
+	if err != nil {
+		return newError("%s", err.Error())
+	}
+
+	host, port := defaultServeHost, int64(defaultServePort)
+	if len(args) == 2 {
+		opts, ok := args[1].(*Dictionary)
+		if !ok {
+			return newError("second argument to `serve` must be a dictionary, got %s", args[1].Type())
+		}
+		if expr, ok := opts.Pairs["port"]; ok {
+			p, ok := Eval(expr, opts.Env).(*Integer)
+			if !ok || p.Value < 1 || p.Value > 65535 {
+				return newError("`port` option for `serve` must be a port number")
+			}
+			port = p.Value
+		}
+		if expr, ok := opts.Pairs["host"]; ok {
+			h, ok := Eval(expr, opts.Env).(*String)
+			if !ok {
+				return newError("`host` option for `serve` must be a string")
+			}
+			host = h.Value
+		}
+	}
+
+	if err := Serve(net.JoinHostPort(host, strconv.FormatInt(port, 10)), handler); err != nil {
+		return newError("serve: %s", err.Error())
+	}
+	return NULL
+}
+
+// Serve listens on addr and serves requests with handler, logging each one
+// to ServeLog. It only returns if the server fails.
+func Serve(addr string, handler http.Handler) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(ServeLog, "Serving on http://%s\n", listener.Addr())
+	return http.Serve(listener, logRequests(handler))
+}
+
+// ServeHandler returns an http.Handler that calls a Parsley function, taking
+// the request or nothing, for each request
+func ServeHandler(handler Object, env *Environment) (http.Handler, error) {
+	switch f := handler.(type) {
+	case *Function:
+		if f.ParamCount() > 1 {
+			return nil, fmt.Errorf("handler passed to `serve` must take 0 or 1 parameters, got %d", f.ParamCount())
+		}
+	case *Builtin:
+	default:
+		return nil, fmt.Errorf("handler passed to `serve` must be a function, got %s", handler.Type())
+	}
+
+	var mu sync.Mutex
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBody))
+		if err != nil {
+			http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		var args []Object
+		if f, ok := handler.(*Function); !ok || f.ParamCount() == 1 {
+			args = []Object{serveRequestToDict(r, body)}
+		}
+
+		mu.Lock()
+		result := applyFunctionWithEnv(handler, args, env)
+		mu.Unlock()
+
+		if errObj, ok := result.(*Error); ok {
+			fmt.Fprintf(ServeLog, "%s %s: %s\n", r.Method, r.URL.Path, errObj.Inspect())
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		writeServeResponse(w, result)
+	}), nil
+}
+
+// serveRequestToDict converts a request into the dictionary handlers are
+// given
+func serveRequestToDict(r *http.Request, body []byte) *Dictionary {
+	query := make(map[string]Object)
+	for name, values := range r.URL.Query() {
+		if len(values) == 1 {
+			query[name] = &String{Value: values[0], Untrusted: true}
+			continue
+		}
+		elements := make([]Object, len(values))
+		for i, v := range values {
+			elements[i] = &String{Value: v, Untrusted: true}
+		}
+		query[name] = &Array{Elements: elements}
+	}
+
+	headers := make(map[string]Object)
+	for name, values := range r.Header {
+		headers[strings.ToLower(name)] = &String{Value: strings.Join(values, ", "), Untrusted: true}
+	}
+
+	return NewDictionaryFromObjects(map[string]Object{
+		"method":  &String{Value: r.Method},
+		"path":    &String{Value: r.URL.Path, Untrusted: true},
+		"query":   NewDictionaryFromObjects(query),
+		"headers": NewDictionaryFromObjects(headers),
+		"body":    &String{Value: string(body), Untrusted: true},
+	})
+}
+
+// isUntrusted reports whether obj is an untrusted string, or an array
+// holding one
+func isUntrusted(obj Object) bool {
+	switch obj := obj.(type) {
+	case *String:
+		return obj.Untrusted
+	case *Array:
+		for _, elem := range obj.Elements {
+			if isUntrusted(elem) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// markUntrusted marks the strings a method on an untrusted string returns
+func markUntrusted(obj Object) Object {
+	switch obj := obj.(type) {
+	case *String:
+		return &String{Value: obj.Value, Untrusted: true}
+	case *Array:
+		elements := make([]Object, len(obj.Elements))
+		for i, elem := range obj.Elements {
+			elements[i] = markUntrusted(elem)
+		}
+		return &Array{Elements: elements}
+	}
+	return obj
+}
+
+// tagString converts a value put into a tag to text, escaping untrusted
+// strings
+func tagString(obj Object) string {
+	switch obj := obj.(type) {
+	case *String:
+		if obj.Untrusted {
+			return html.EscapeString(obj.Value)
+		}
+	case *Array:
+		var result strings.Builder
+		for _, elem := range obj.Elements {
+			result.WriteString(tagString(elem))
+		}
+		return result.String()
+	}
+	return objectToTemplateString(obj)
+}
+
+// writeServeResponse sends a handler's result as the response
+func writeServeResponse(w http.ResponseWriter, result Object) {
+	status := http.StatusOK
+	body := result
+	if dict, ok := result.(*Dictionary); ok && isServeResponseDict(dict) {
+		body = NULL
+		if expr, ok := dict.Pairs["body"]; ok {
+			body = Eval(expr, dict.Env)
+		}
+		if s, ok := Eval(dict.Pairs["status"], dict.Env).(*Integer); ok && s.Value >= 100 && s.Value <= 999 {
+			status = int(s.Value)
+		}
+		if expr, ok := dict.Pairs["headers"]; ok {
+			if headers, ok := Eval(expr, dict.Env).(*Dictionary); ok {
+				for name, valueExpr := range headers.Pairs {
+					w.Header().Set(name, objectToPrintString(Eval(valueExpr, headers.Env)))
+				}
+			}
+		}
+	} else if result == nil || result == NULL {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	var data []byte
+	contentType := "text/html; charset=utf-8"
+	switch b := body.(type) {
+	case nil, *Null:
+	case *String:
+		data = []byte(tagString(b))
+	case *Dictionary, *Array:
+		encoded, err := ObjectToData(b, "json")
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			fmt.Fprintf(ServeLog, "serve: can't write the response as JSON: %s\n", err)
+			return
+		}
+		data, contentType = encoded, "application/json"
+	default:
+		data, contentType = []byte(objectToPrintString(b)), "text/plain; charset=utf-8"
+	}
+
+	if len(data) > 0 && w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// isServeResponseDict reports whether a handler's dictionary result
+// describes the response, rather than being JSON to send
+func isServeResponseDict(dict *Dictionary) bool {
+	if _, ok := dict.Pairs["status"]; !ok {
+		return false
+	}
+	for key := range dict.Pairs {
+		if key != "status" && key != "headers" && key != "body" {
+			return false
+		}
+	}
+	return true
+}
+
+// statusRecorder remembers the status of a response for the request log
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests writes a line to ServeLog for each request
+func logRequests(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		handler.ServeHTTP(rec, r)
+		fmt.Fprintf(ServeLog, "%s %s %d %s\n", r.Method, r.URL.RequestURI(), rec.status, time.Since(start).Round(time.Millisecond))
+	})
+}
@@ -0,0 +1,366 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// evalSFTP implements SFTP(url, options), connecting to an SFTP server or
+// returning the cached connection to it
+func evalSFTP(args []Object, env *Environment) Object {
+	if len(args) < 1 || len(args) > 2 {
+		return newError("wrong number of arguments to `SFTP`. got=%d, want=1 or 2", len(args))
+	}
+
+	// First arg: URL (can be dictionary or string)
+	var urlStr string
+	switch arg := args[0].(type) {
+	case *Url:
+		if arg.Scheme != "sftp" {
+			return newError("SFTP requires sftp:// URL scheme, got %s://", arg.Scheme)
+		}
+		urlStr = arg.Inspect()
+	case *String:
+		urlStr = arg.Value
+	default:
+		return newError("first argument to SFTP must be a URL, got %s", args[0].Type())
+	}
+
+	// Optional second arg: options dictionary
+	var options map[string]Object
+	if len(args) == 2 {
+		dict, ok := args[1].(*Dictionary)
+		if !ok {
+			return newError("second argument to SFTP must be a dictionary, got %s", args[1].Type())
+		}
+		options = make(map[string]Object)
+		for key := range dict.Pairs {
+			options[key] = Eval(dict.Pairs[key], dict.Env)
+		}
+	}
+
+	// Parse SFTP URL
+	if !strings.HasPrefix(urlStr, "sftp://") {
+		return newError("SFTP URL must start with sftp://")
+	}
+
+	// Parse URL components
+	parsedURL := urlStr[7:] // Remove "sftp://"
+	var user, password, host string
+	port := 22
+
+	// Extract user@host:port
+	atIndex := strings.Index(parsedURL, "@")
+	if atIndex >= 0 {
+		userPass := parsedURL[:atIndex]
+		parsedURL = parsedURL[atIndex+1:]
+
+		// Check for password in user:pass format
+		colonIndex := strings.Index(userPass, ":")
+		if colonIndex >= 0 {
+			user = userPass[:colonIndex]
+			password = userPass[colonIndex+1:]
+		} else {
+			user = userPass
+		}
+	}
+
+	// Extract host and port
+	slashIndex := strings.Index(parsedURL, "/")
+	hostPort := parsedURL
+	if slashIndex >= 0 {
+		hostPort = parsedURL[:slashIndex]
+	}
+
+	hasPort := false
+	colonIndex := strings.LastIndex(hostPort, ":")
+	if colonIndex >= 0 {
+		host = hostPort[:colonIndex]
+		portStr := hostPort[colonIndex+1:]
+		if p, err := strconv.Atoi(portStr); err == nil {
+			port = p
+			hasPort = true
+		}
+	} else {
+		host = hostPort
+	}
+
+	// Host aliases and defaults from ~/.ssh/config; the URL wins
+	hostConfig := sshHostConfig(host, env)
+	if hostConfig.hostName != "" {
+		host = hostConfig.hostName
+	}
+	if user == "" {
+		user = hostConfig.user
+	}
+	if user == "" {
+		user = "anonymous"
+	}
+	if !hasPort && hostConfig.port != 0 {
+		port = hostConfig.port
+	}
+
+	// Check cache
+	cacheKey := fmt.Sprintf("sftp:%s@%s:%d", user, host, port)
+	sftpConnectionsMu.RLock()
+	conn, exists := sftpConnections[cacheKey]
+	sftpConnectionsMu.RUnlock()
+
+	if exists && conn.Connected {
+		return conn
+	}
+
+	// Create new SFTP connection
+	var authMethods []ssh.AuthMethod
+
+	// Check for SSH key authentication
+	if keyFileObj, ok := options["keyFile"]; ok {
+		var keyPath string
+		if keyPathObj, ok := keyFileObj.(*Path); ok {
+			keyPath = keyPathObj.Inspect()
+		} else if keyStr, ok := keyFileObj.(*String); ok {
+			keyPath = keyStr.Value
+		}
+
+		if keyPath != "" {
+			signer, errObj := loadSSHKey(keyPath, options, env)
+			if errObj != nil {
+				return errObj
+			}
+			authMethods = append(authMethods, ssh.PublicKeys(signer))
+		}
+	} else {
+		// Like ssh, skip configured keys that are missing or can't be used
+		for _, keyPath := range hostConfig.identityFiles {
+			if signer, errObj := loadSSHKey(keyPath, options, env); errObj == nil {
+				authMethods = append(authMethods, ssh.PublicKeys(signer))
+			}
+		}
+	}
+
+	// Keys held by ssh-agent
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if agentConn, err := net.Dial("unix", sock); err == nil {
+			defer agentConn.Close()
+			authMethods = append(authMethods, ssh.PublicKeysCallback(agent.NewClient(agentConn).Signers))
+		}
+	}
+
+	// Check for password from options
+	if passwordObj, ok := options["password"]; ok {
+		if passwordStr, ok := passwordObj.(*String); ok {
+			password = passwordStr.Value
+		}
+	}
+
+	// Add password auth if password provided
+	if password != "" {
+		authMethods = append(authMethods, ssh.Password(password))
+	}
+
+	if len(authMethods) == 0 {
+		return newError("SFTP requires authentication: provide keyFile or password in options, or run ssh-agent")
+	}
+
+	// Verify the server's host key against known_hosts unless told not to
+	knownHostsPath := hostConfig.knownHostsFile
+	if knownHostsObj, ok := options["knownHostsFile"]; ok {
+		if khPath, ok := knownHostsObj.(*Path); ok {
+			knownHostsPath = khPath.Inspect()
+		} else if khStr, ok := knownHostsObj.(*String); ok {
+			knownHostsPath = khStr.Value
+		}
+	}
+	if knownHostsPath == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			knownHostsPath = filepath.Join(home, ".ssh", "known_hosts")
+		}
+	}
+
+	var hostKeyCallback ssh.HostKeyCallback
+	if insecure, ok := options["insecure"].(*Boolean); ok && insecure.Value {
+		hostKeyCallback = ssh.InsecureIgnoreHostKey()
+	} else {
+		if err := env.checkPathAccess(knownHostsPath, "read"); err != nil {
+			return newError("security: %s", err.Error())
+		}
+		callback, err := knownhosts.New(knownHostsPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return newError("no known_hosts file at %s to verify %s: add the server with ssh-keyscan, set knownHostsFile, or pass {insecure: true} to skip verification", knownHostsPath, host)
+			}
+			return newError("failed to load known_hosts: %s", err.Error())
+		}
+		hostKeyCallback = callback
+	}
+
+	// Configure SSH client
+	config := &ssh.ClientConfig{
+		User:            user,
+		Auth:            authMethods,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         30 * time.Second,
+	}
+
+	// Check for timeout
+	if timeoutObj, ok := options["timeout"]; ok {
+		if timeout, ok := timeoutObj.(*Duration); ok {
+			config.Timeout = time.Duration(timeout.Seconds()) * time.Second
+		}
+	}
+
+	// Connect to SSH server
+	sshClient, err := ssh.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)), config)
+	if err != nil {
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) {
+			if len(keyErr.Want) == 0 {
+				return newError("host key for %s is not in %s: add it with ssh-keyscan or pass {insecure: true} to skip verification", host, knownHostsPath)
+			}
+			return newError("host key for %s doesn't match the one in %s: the server's key has changed or someone is intercepting the connection", host, knownHostsPath)
+		}
+		return newError("failed to connect to SSH server: %s", err.Error())
+	}
+
+	// Create SFTP client
+	sftpClient, err := sftp.NewClient(sshClient)
+	if err != nil {
+		sshClient.Close()
+		return newError("failed to create SFTP client: %s", err.Error())
+	}
+
+	// Create connection object
+	newConn := &SFTPConnection{
+		Client:    sftpClient,
+		SSHClient: sshClient,
+		Host:      host,
+		Port:      port,
+		User:      user,
+		Connected: true,
+		LastError: "",
+	}
+
+	// Cache connection
+	sftpConnectionsMu.Lock()
+	sftpConnections[cacheKey] = newConn
+	sftpConnectionsMu.Unlock()
+
+	return newConn
+}
+
+// loadSSHKey reads a private key, decrypting it with the passphrase option
+// if there is one
+func loadSSHKey(keyPath string, options map[string]Object, env *Environment) (ssh.Signer, *Error) {
+	if err := env.checkPathAccess(keyPath, "read"); err != nil {
+		return nil, newError("security: %s", err.Error())
+	}
+	keyData, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, newError("failed to read SSH key file: %s", err.Error())
+	}
+
+	var signer ssh.Signer
+	if passphraseStr, ok := options["passphrase"].(*String); ok {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(keyData, []byte(passphraseStr.Value))
+	} else {
+		signer, err = ssh.ParsePrivateKey(keyData)
+	}
+	if err != nil {
+		return nil, newError("failed to parse SSH key: %s", err.Error())
+	}
+	return signer, nil
+}
+
+// sshConfig holds the ~/.ssh/config settings SFTP uses for a host
+type sshConfig struct {
+	hostName       string
+	user           string
+	port           int
+	identityFiles  []string
+	knownHostsFile string
+}
+
+// sshHostConfig reads the settings for a host from ~/.ssh/config. As in ssh,
+// the first value found for a setting wins, so specific Host blocks go
+// before general ones.
+func sshHostConfig(host string, env *Environment) sshConfig {
+	var cfg sshConfig
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return cfg
+	}
+	configPath := filepath.Join(home, ".ssh", "config")
+	if env.checkPathAccess(configPath, "read") != nil {
+		return cfg
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return cfg
+	}
+
+	matches := true // Settings before the first Host apply to every host
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ' ' || r == '\t' || r == '='
+		})
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		value := strings.Trim(fields[1], `"`)
+
+		switch strings.ToLower(fields[0]) {
+		case "host":
+			matches = sshHostMatches(host, fields[1:])
+		case "match":
+			matches = false // Match blocks aren't supported
+		case "hostname":
+			if matches && cfg.hostName == "" {
+				cfg.hostName = value
+			}
+		case "user":
+			if matches && cfg.user == "" {
+				cfg.user = value
+			}
+		case "port":
+			if p, err := strconv.Atoi(value); matches && err == nil && cfg.port == 0 {
+				cfg.port = p
+			}
+		case "identityfile":
+			if matches {
+				cfg.identityFiles = append(cfg.identityFiles, ExpandHome(value))
+			}
+		case "userknownhostsfile":
+			if matches && cfg.knownHostsFile == "" {
+				cfg.knownHostsFile = ExpandHome(value)
+			}
+		}
+	}
+	return cfg
+}
+
+// sshHostMatches reports whether a host matches a Host line's patterns. A
+// matching pattern starting with ! rules the host out.
+func sshHostMatches(host string, patterns []string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		if ok, _ := filepath.Match(strings.TrimPrefix(pattern, "!"), host); ok {
+			if negated {
+				return false
+			}
+			matched = true
+		}
+	}
+	return matched
+}
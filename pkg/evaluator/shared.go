@@ -0,0 +1,335 @@
+package evaluator
+
+import (
+	"sort"
+	"sync"
+)
+
+// counter(), collector() and atomicDict() make values that the calls of a
+// parallel() function can all change, for totals and results that don't fit
+// returning a value from each call:
+//
+//	let bytes = counter()
+//	let broken = collector()
+//	parallel(urls, fn(u) {
+//	    let {data, status} <=/= text(url(u))
+//	    bytes.add((data ?? "").length())
+//	    if (status != 200) { broken.push(u) }
+//	})
+//
+// Each locks itself for every method call, so its methods can be called from
+// any number of calls at once.
+
+// Counter is an integer that can be added to from parallel() calls
+type Counter struct {
+	mu    sync.Mutex
+	value int64
+}
+
+func (c *Counter) Type() ObjectType { return COUNTER_OBJ }
+func (c *Counter) Inspect() string  { return "<counter>" }
+
+// Collector is an append-only list that can be pushed to from parallel()
+// calls
+type Collector struct {
+	mu       sync.Mutex
+	elements []Object
+}
+
+func (c *Collector) Type() ObjectType { return COLLECTOR_OBJ }
+func (c *Collector) Inspect() string  { return "<collector>" }
+
+// AtomicDict is a dictionary that can be read and changed from parallel()
+// calls. version counts its changes, so update() can tell when another call
+// changed it while its function ran.
+type AtomicDict struct {
+	mu      sync.Mutex
+	values  map[string]Object
+	version int64
+}
+
+func (d *AtomicDict) Type() ObjectType { return ATOMIC_DICT_OBJ }
+func (d *AtomicDict) Inspect() string  { return "<atomicDict>" }
+
+// newCounter implements counter(start?)
+func newCounter(args []Object) Object {
+	if len(args) > 1 {
+		return newError("wrong number of arguments to `counter`. got=%d, want=0 or 1", len(args))
+	}
+	c := &Counter{}
+	if len(args) == 1 {
+		start, ok := args[0].(*Integer)
+		if !ok {
+			return newError("argument to `counter` must be an integer, got %s", args[0].Type())
+		}
+		c.value = start.Value
+	}
+	return c
+}
+
+// evalCounterMethod evaluates a method call on a Counter
+func evalCounterMethod(c *Counter, method string, args []Object) Object {
+	switch method {
+	case "add":
+		if len(args) > 1 {
+			return newError("wrong number of arguments to `add`. got=%d, want=0 or 1", len(args))
+		}
+		n := int64(1)
+		if len(args) == 1 {
+			i, ok := args[0].(*Integer)
+			if !ok {
+				return newError("argument to `add` must be an integer, got %s", args[0].Type())
+			}
+			n = i.Value
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.value += n
+		return &Integer{Value: c.value}
+
+	case "value":
+		if len(args) != 0 {
+			return newError("wrong number of arguments to `value`. got=%d, want=0", len(args))
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return &Integer{Value: c.value}
+
+	default:
+		return newError("unknown method '%s' for counter", method)
+	}
+}
+
+// evalCollectorMethod evaluates a method call on a Collector. push returns
+// null, so a parallel() function ending with it adds nothing to the results.
+func evalCollectorMethod(c *Collector, method string, args []Object) Object {
+	switch method {
+	case "push":
+		if len(args) != 1 {
+			return newError("wrong number of arguments to `push`. got=%d, want=1", len(args))
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.elements = append(c.elements, args[0])
+		return NULL
+
+	case "toArray":
+		if len(args) != 0 {
+			return newError("wrong number of arguments to `toArray`. got=%d, want=0", len(args))
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		elements := make([]Object, len(c.elements))
+		copy(elements, c.elements)
+		return &Array{Elements: elements}
+
+	case "length":
+		if len(args) != 0 {
+			return newError("wrong number of arguments to `length`. got=%d, want=0", len(args))
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return &Integer{Value: int64(len(c.elements))}
+
+	default:
+		return newError("unknown method '%s' for collector", method)
+	}
+}
+
+// newAtomicDict implements atomicDict(dict?)
+func newAtomicDict(args []Object) Object {
+	if len(args) > 1 {
+		return newError("wrong number of arguments to `atomicDict`. got=%d, want=0 or 1", len(args))
+	}
+	d := &AtomicDict{values: make(map[string]Object)}
+	if len(args) == 1 {
+		dict, ok := args[0].(*Dictionary)
+		if !ok {
+			return newError("argument to `atomicDict` must be a dictionary, got %s", args[0].Type())
+		}
+		for key, expr := range dict.Pairs {
+			value := Eval(expr, dict.Env)
+			if isError(value) {
+				return value
+			}
+			d.values[key] = value
+		}
+	}
+	return d
+}
+
+// evalAtomicDictMethod evaluates a method call on an AtomicDict
+func evalAtomicDictMethod(d *AtomicDict, method string, args []Object, env *Environment) Object {
+	switch method {
+	case "get":
+		if len(args) < 1 || len(args) > 2 {
+			return newError("wrong number of arguments to `get`. got=%d, want=1 or 2", len(args))
+		}
+		key, ok := args[0].(*String)
+		if !ok {
+			return newError("first argument to `get` must be a string, got %s", args[0].Type())
+		}
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if value, ok := d.values[key.Value]; ok {
+			return value
+		}
+		if len(args) == 2 {
+			return args[1]
+		}
+		return NULL
+
+	case "set":
+		if len(args) != 2 {
+			return newError("wrong number of arguments to `set`. got=%d, want=2", len(args))
+		}
+		key, ok := args[0].(*String)
+		if !ok {
+			return newError("first argument to `set` must be a string, got %s", args[0].Type())
+		}
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.values[key.Value] = args[1]
+		d.version++
+		return NULL
+
+	case "add":
+		if len(args) < 1 || len(args) > 2 {
+			return newError("wrong number of arguments to `add`. got=%d, want=1 or 2", len(args))
+		}
+		key, ok := args[0].(*String)
+		if !ok {
+			return newError("first argument to `add` must be a string, got %s", args[0].Type())
+		}
+		n := int64(1)
+		if len(args) == 2 {
+			i, ok := args[1].(*Integer)
+			if !ok {
+				return newError("second argument to `add` must be an integer, got %s", args[1].Type())
+			}
+			n = i.Value
+		}
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		total := n
+		switch current := d.values[key.Value].(type) {
+		case nil, *Null:
+		case *Integer:
+			total += current.Value
+		default:
+			return newError("cannot add to %s: its value is %s, not an integer", key.Value, current.Type())
+		}
+		d.values[key.Value] = &Integer{Value: total}
+		d.version++
+		return &Integer{Value: total}
+
+	case "update":
+		if len(args) < 2 || len(args) > 3 {
+			return newError("wrong number of arguments to `update`. got=%d, want=2 or 3", len(args))
+		}
+		key, ok := args[0].(*String)
+		if !ok {
+			return newError("first argument to `update` must be a string, got %s", args[0].Type())
+		}
+		fn := args[1]
+		switch f := fn.(type) {
+		case *Function:
+			if f.ParamCount() != 1 {
+				return newError("function passed to `update` must take 1 parameter, got %d", f.ParamCount())
+			}
+		case *Builtin:
+		default:
+			return newError("second argument to `update` must be a function, got %s", fn.Type())
+		}
+		return d.update(key.Value, fn, args[2:], env)
+
+	case "has":
+		if len(args) != 1 {
+			return newError("wrong number of arguments to `has`. got=%d, want=1", len(args))
+		}
+		key, ok := args[0].(*String)
+		if !ok {
+			return newError("argument to `has` must be a string, got %s", args[0].Type())
+		}
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		_, exists := d.values[key.Value]
+		return nativeBoolToParsBoolean(exists)
+
+	case "keys":
+		if len(args) != 0 {
+			return newError("wrong number of arguments to `keys`. got=%d, want=0", len(args))
+		}
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		keys := make([]string, 0, len(d.values))
+		for key := range d.values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		elements := make([]Object, len(keys))
+		for i, key := range keys {
+			elements[i] = &String{Value: key}
+		}
+		return &Array{Elements: elements}
+
+	case "size":
+		if len(args) != 0 {
+			return newError("wrong number of arguments to `size`. got=%d, want=0", len(args))
+		}
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return &Integer{Value: int64(len(d.values))}
+
+	case "toDict":
+		if len(args) != 0 {
+			return newError("wrong number of arguments to `toDict`. got=%d, want=0", len(args))
+		}
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		values := make(map[string]Object, len(d.values))
+		for key, value := range d.values {
+			values[key] = value
+		}
+		return NewDictionaryFromObjects(values)
+
+	default:
+		return newError("unknown method '%s' for atomicDict", method)
+	}
+}
+
+// update replaces a key's value with fn(value), or fn(initial) if the key
+// isn't set. fn runs without the lock held, so it may use the dictionary
+// itself; if another call changes the dictionary meanwhile, fn is called
+// again with the new value.
+func (d *AtomicDict) update(key string, fn Object, initial []Object, env *Environment) Object {
+	for {
+		d.mu.Lock()
+		current, ok := d.values[key]
+		version := d.version
+		d.mu.Unlock()
+		if !ok {
+			current = NULL
+			if len(initial) == 1 {
+				current = initial[0]
+			}
+		}
+
+		result := applyFunctionWithEnv(fn, []Object{current}, env)
+		if isError(result) {
+			return result
+		}
+		if result == nil {
+			result = NULL
+		}
+
+		d.mu.Lock()
+		if d.version == version {
+			d.values[key] = result
+			d.version++
+			d.mu.Unlock()
+			return result
+		}
+		d.mu.Unlock()
+	}
+}
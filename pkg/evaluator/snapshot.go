@@ -0,0 +1,181 @@
+package evaluator
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// snapshot(source, path, options?) caches the result of a query or fetch in a
+// JSON file, so builds can run offline and give the same output each time:
+//
+//	let posts = snapshot(db.table("posts"), @./data/posts.json, {ttl: @1d})
+//
+// The source is only run when the snapshot is missing, older than its ttl or
+// refresh is true. If running it fails and there is an old snapshot, the old
+// snapshot is used.
+
+// snapshotOptions holds the options for snapshot()
+type snapshotOptions struct {
+	ttl     *Duration // nil means the snapshot never expires
+	refresh bool
+}
+
+// evalSnapshot implements snapshot(source, path, options?)
+func evalSnapshot(args []Object, env *Environment) Object {
+	if len(args) < 2 || len(args) > 3 {
+		return newError("wrong number of arguments to `snapshot`. got=%d, want=2-3", len(args))
+	}
+
+	var pathStr string
+	switch arg := args[1].(type) {
+	case *String:
+		pathStr = arg.Value
+	case *Path:
+		pathStr = arg.Inspect()
+	default:
+		return newError("second argument to `snapshot` must be a path or string, got %s", args[1].Type())
+	}
+
+	var opts snapshotOptions
+	if len(args) == 3 {
+		optDict, ok := args[2].(*Dictionary)
+		if !ok {
+			return newError("third argument to `snapshot` must be a dictionary, got %s", args[2].Type())
+		}
+		var errObj *Error
+		if opts, errObj = parseSnapshotOptions(optDict); errObj != nil {
+			return errObj
+		}
+	}
+
+	absPath, err := resolveModulePath(pathStr, env.Filename)
+	if err != nil {
+		return newError("failed to resolve path '%s': %s", pathStr, err.Error())
+	}
+	if err := env.checkPathAccess(absPath, "read"); err != nil {
+		return newError("security: %s", err.Error())
+	}
+
+	info, statErr := os.Stat(absPath)
+	exists := statErr == nil
+	if exists && !opts.refresh {
+		if snapshotFresh(info.ModTime(), opts.ttl) {
+			return readSnapshot(absPath, pathStr)
+		}
+	}
+
+	if err := env.checkPathAccess(absPath, "write"); err != nil {
+		return newError("security: %s", err.Error())
+	}
+
+	result := runSnapshotSource(args[0], env)
+	if isError(result) {
+		if exists {
+			// Offline or failing: keep using the old snapshot
+			return readSnapshot(absPath, pathStr)
+		}
+		return result
+	}
+
+	if env.dryRun("write snapshot %s", absPath) {
+		return result
+	}
+	if errObj := writeSnapshot(absPath, pathStr, result); errObj != nil {
+		return errObj
+	}
+	// Read it back, so a fresh result is the same as a cached one
+	return readSnapshot(absPath, pathStr)
+}
+
+// parseSnapshotOptions reads the {ttl, refresh} options for snapshot()
+func parseSnapshotOptions(dict *Dictionary) (snapshotOptions, *Error) {
+	var opts snapshotOptions
+	for key, expr := range dict.Pairs {
+		val := Eval(expr, dict.Env)
+		switch key {
+		case "ttl":
+			d, ok := val.(*Duration)
+			if !ok {
+				return opts, newError("`ttl` option for snapshot() must be a duration, got %s", val.Type())
+			}
+			opts.ttl = d
+		case "refresh":
+			b, ok := val.(*Boolean)
+			if !ok {
+				return opts, newError("`refresh` option for snapshot() must be a boolean, got %s", val.Type())
+			}
+			opts.refresh = b.Value
+		default:
+			return opts, newError("unknown option %q for snapshot()", key)
+		}
+	}
+	return opts, nil
+}
+
+// snapshotFresh reports whether a snapshot written at modTime is within its ttl
+func snapshotFresh(modTime time.Time, ttl *Duration) bool {
+	if ttl == nil {
+		return true
+	}
+	expires := modTime.AddDate(0, int(ttl.Months), 0).Add(time.Duration(ttl.Millis) * time.Millisecond)
+	return time.Now().Before(expires)
+}
+
+// runSnapshotSource runs a query or fetch and returns its result
+func runSnapshotSource(source Object, env *Environment) Object {
+	switch src := source.(type) {
+	case *Function, *Builtin:
+		return applyFunctionWithEnv(src, []Object{}, env)
+	case *DBQuery:
+		return evalDBQueryMethod(src, "all", []Object{}, env)
+	case *Url:
+		return runSnapshotSource(urlToRequestDict(src, "text", nil, env), env)
+	case *Dictionary:
+		if !isRequestDict(src) {
+			break
+		}
+		info := fetchUrlContentFull(src, env)
+		if info.Error != "" {
+			return newError("snapshot: fetch failed: %s", info.Error)
+		}
+		if info.StatusCode >= 400 {
+			return newError("snapshot: fetch failed: %s returned %d %s", info.FinalURL, info.StatusCode, info.StatusText)
+		}
+		return info.Content
+	}
+	return newError("first argument to `snapshot` must be a query, request or function, got %s", source.Type())
+}
+
+// readSnapshot reads a snapshot file written by writeSnapshot
+func readSnapshot(absPath, pathStr string) Object {
+	data, err := os.ReadFile(absPath)
+	if err != nil {
+		return newError("failed to read snapshot '%s': %s", pathStr, err.Error())
+	}
+	recordFileRead(len(data))
+	result, errObj := parseJSON(string(data))
+	if errObj != nil {
+		return newError("snapshot '%s': %s", pathStr, errObj.Message)
+	}
+	return reviveTypedValues(result)
+}
+
+// writeSnapshot writes a result to a snapshot file, creating its directory.
+// The file is replaced in one step, so an interrupted build can't leave half
+// a snapshot.
+func writeSnapshot(absPath, pathStr string, result Object) *Error {
+	data, err := encodeJSON(result)
+	if err != nil {
+		return newError("failed to encode snapshot '%s': %s", pathStr, err.Error())
+	}
+	if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
+		return newError("failed to write snapshot '%s': %s", pathStr, err.Error())
+	}
+	data = append(data, '\n')
+	if err := writeFileAtomic(absPath, data, 0644); err != nil {
+		return newError("failed to write snapshot '%s': %s", pathStr, err.Error())
+	}
+	recordFileWrite(len(data))
+	return nil
+}
@@ -0,0 +1,249 @@
+package evaluator
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/text/encoding"
+)
+
+// stream(file) reads a file a piece at a time, as an iterator, so files
+// too big to read whole can be processed:
+//
+//	for (line in stream(@./access.log)) {
+//	    if (line.contains(" 500 ")) { line }
+//	}
+//	stream(CSV(@./orders.csv)).filter(fn(o) { o.country == "NZ" })
+//
+// Text and lines handles give the file's lines, without their line endings.
+// CSV handles give rows as reading them would, but only the current row is
+// in memory. Each time the iterator is consumed the file is read again from
+// the start.
+
+// streamSource is what a stream() iterator reads
+type streamSource struct {
+	path    string // Absolute path, or "-" for stdin
+	format  string
+	enc     encoding.Encoding
+	noBOM   bool
+	csvOpts csvOptions
+}
+
+// evalStream implements stream(file)
+func evalStream(args []Object, env *Environment) Object {
+	if len(args) < 1 || len(args) > 2 {
+		return newError("wrong number of arguments to `stream`. got=%d, want=1 or 2", len(args))
+	}
+
+	fileDict, ok := args[0].(*Dictionary)
+	switch {
+	case ok && isFileDict(fileDict):
+		if len(args) == 2 {
+			return newError("options for `stream` go on the file handle, e.g. stream(CSV(path, options))")
+		}
+	case args[0].Type() == PATH_OBJ, args[0].Type() == STRING_OBJ:
+		handle := getBuiltins()["file"].Fn(args...)
+		if isError(handle) {
+			return handle
+		}
+		fileDict = handle.(*Dictionary)
+	default:
+		return newError("first argument to `stream` must be a file handle, path or string, got %s", args[0].Type())
+	}
+
+	src, errObj := newStreamSource(fileDict, env)
+	if errObj != nil {
+		return errObj
+	}
+	return &Iterator{each: src.each}
+}
+
+// newStreamSource checks a file handle can be streamed and resolves its path
+func newStreamSource(fileDict *Dictionary, env *Environment) (*streamSource, *Error) {
+	src := &streamSource{}
+
+	if stdioExpr, ok := fileDict.Pairs["__stdio"]; ok {
+		if stdio, ok := Eval(stdioExpr, env).(*String); !ok || (stdio.Value != "stdin" && stdio.Value != "stdio") {
+			return nil, newError("cannot stream from %s", Eval(stdioExpr, env).Inspect())
+		}
+		src.path = "-"
+	} else {
+		pathStr := getFilePathString(fileDict, env)
+		if pathStr == "" {
+			return nil, newError("file handle has no valid path")
+		}
+		absPath, err := resolveModulePath(pathStr, env.Filename)
+		if err != nil {
+			return nil, newError("failed to resolve path '%s': %s", pathStr, err.Error())
+		}
+		if err := env.checkPathAccess(absPath, "read"); err != nil {
+			return nil, newError("security: %s", err.Error())
+		}
+		src.path = absPath
+	}
+
+	format, ok := Eval(fileDict.Pairs["format"], env).(*String)
+	if !ok {
+		return nil, newError("file handle has no format specified")
+	}
+	src.format = format.Value
+	switch src.format {
+	case "text", "lines":
+	case "csv", "csv-noheader":
+		src.csvOpts = defaultCSVOptions(src.format == "csv")
+		if fileOpts := fileOptions(fileDict, env); fileOpts != nil {
+			opts, optErr := parseCSVOptions(fileOpts, src.csvOpts)
+			if optErr != nil {
+				return nil, optErr
+			}
+			if opts.report {
+				return nil, newError("CSV option `report` can't be used with `stream`; use ragged: \"skip\" to skip malformed rows")
+			}
+			src.csvOpts = opts
+		}
+	default:
+		return nil, newError("`stream` reads text, lines and CSV files, got format %s", src.format)
+	}
+
+	enc, encErr := fileTextEncoding(fileDict, env)
+	if encErr != nil {
+		return nil, encErr
+	}
+	src.enc = enc
+	if opt := fileOption(fileDict, "stripBOM", env); opt != nil {
+		strip, ok := opt.(*Boolean)
+		if !ok {
+			return nil, newError("`stripBOM` option must be a boolean, got %s", opt.Type())
+		}
+		src.noBOM = strip.Value
+	}
+	return src, nil
+}
+
+// each opens the file and passes each line or row to visit
+func (src *streamSource) each(visit func(Object) Object) Object {
+	var r io.Reader
+	if src.path == "-" {
+		r = os.Stdin
+	} else if mocked, ok := mockedFile(src.path); ok {
+		r = bytes.NewReader(mocked)
+	} else {
+		f, err := os.Open(src.path)
+		if err != nil {
+			return newError("failed to read file '%s': %s", src.path, err.Error())
+		}
+		defer f.Close()
+		cr := &countingReader{r: f}
+		defer func() { recordFileRead(cr.n) }()
+		r = cr
+	}
+
+	if src.enc != nil {
+		r = src.enc.NewDecoder().Reader(r)
+	}
+	br := bufio.NewReaderSize(r, 64*1024)
+	if src.noBOM {
+		if start, _ := br.Peek(len(utf8BOM)); bytes.Equal(start, utf8BOM) {
+			br.Discard(len(utf8BOM))
+		}
+	}
+
+	if src.format == "text" || src.format == "lines" {
+		return streamFileLines(br, visit)
+	}
+	return streamCSVRows(br, src.csvOpts, visit)
+}
+
+// streamFileLines passes each line to visit, without its line ending
+func streamFileLines(br *bufio.Reader, visit func(Object) Object) Object {
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return newError("failed to read lines: %s", err.Error())
+		}
+		if line == "" && err == io.EOF {
+			return nil
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if result := visit(&String{Value: line}); result != nil {
+			return result
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// streamCSVRows passes each CSV row to visit, handling the options as
+// parseCSV does
+func streamCSVRows(br *bufio.Reader, opts csvOptions, visit func(Object) Object) Object {
+	for i := 0; i < opts.skipRows; i++ {
+		if _, err := br.ReadString('\n'); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return newError("failed to read CSV: %s", err.Error())
+		}
+	}
+
+	reader := csv.NewReader(br)
+	reader.Comma = opts.delimiter
+	reader.Comment = opts.comment
+	reader.LazyQuotes = opts.lazyQuotes
+	reader.TrimLeadingSpace = opts.trim
+	reader.FieldsPerRecord = -1 // Ragged rows are handled below
+	reader.ReuseRecord = true
+
+	var headers []string
+	width := -1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return newError("failed to parse CSV: line %d: %s", parseErr.StartLine+opts.skipRows, parseErr.Err.Error())
+			}
+			return newError("failed to read CSV: %s", err.Error())
+		}
+
+		if opts.trim {
+			for i, field := range record {
+				record[i] = strings.TrimSpace(field)
+			}
+		}
+
+		if width < 0 {
+			width = len(record)
+		} else if len(record) != width {
+			switch opts.ragged {
+			case "pad":
+				fitted := make([]string, width)
+				copy(fitted, record)
+				record = fitted
+			case "skip":
+				continue
+			default:
+				line, _ := reader.FieldPos(0)
+				message := fmt.Sprintf("expected %d fields, got %d", width, len(record))
+				return newError("failed to parse CSV: line %d: %s", line+opts.skipRows, message)
+			}
+		}
+
+		if opts.header && headers == nil {
+			headers = append([]string{}, record...)
+			continue
+		}
+		if result := visit(csvRecordToRow(headers, record)); result != nil {
+			return result
+		}
+	}
+}
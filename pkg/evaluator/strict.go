@@ -0,0 +1,116 @@
+package evaluator
+
+import (
+	"github.com/sambeau/parsley/pkg/ast"
+	"github.com/sambeau/parsley/pkg/lexer"
+)
+
+// Strict mode turns conveniences that can hide mistakes into errors:
+//
+//   - assigning to a variable that was never declared with let
+//   - reading a dictionary key that doesn't exist (except on the left of ??)
+//   - + between a string and a number
+//   - a module's let bindings being importable without export
+//
+// It's enabled for a whole run with Environment.Strict (pars --strict), which
+// imported modules inherit, or for a single file by starting it with the
+// pragma "use strict".
+
+// strictPragma is the string statement that turns on strict mode for a file
+const strictPragma = "use strict"
+
+// isStrict reports whether code evaluated in env runs in strict mode
+func (e *Environment) isStrict() bool {
+	return e.Strict || e.strictFile
+}
+
+// hasStrictPragma reports whether a program starts with "use strict"
+func hasStrictPragma(program *ast.Program) bool {
+	if len(program.Statements) == 0 {
+		return false
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		return false
+	}
+	str, ok := stmt.Expression.(*ast.StringLiteral)
+	return ok && str.Value == strictPragma
+}
+
+// checkDeclared returns an error in strict mode if an assignment would
+// create a variable rather than update one, and inside parallel() if it
+// would update one outside the function
+func checkDeclared(env *Environment, name *ast.Identifier, names []*ast.Identifier, pattern *ast.DictDestructuringPattern) *Error {
+	strict := env.isStrict()
+	if !strict && env.parallel == nil {
+		return nil
+	}
+
+	check := func(ident *ast.Identifier) *Error {
+		if ident == nil || ident.Value == "_" {
+			return nil
+		}
+		if env.parallel != nil {
+			if err := checkParallelAssign(env, ident); err != nil {
+				return err
+			}
+		}
+		if !strict {
+			return nil
+		}
+		if _, ok := env.Get(ident.Value); !ok {
+			return newErrorWithPos(ident.Token, "assignment to undeclared variable: %s (declare it with let)", ident.Value)
+		}
+		return nil
+	}
+
+	if err := check(name); err != nil {
+		return err
+	}
+	for _, ident := range names {
+		if err := check(ident); err != nil {
+			return err
+		}
+	}
+	if pattern != nil {
+		return checkDeclaredPattern(pattern, check)
+	}
+	return nil
+}
+
+func checkDeclaredPattern(pattern *ast.DictDestructuringPattern, check func(*ast.Identifier) *Error) *Error {
+	for _, key := range pattern.Keys {
+		var err *Error
+		if nested, ok := key.Nested.(*ast.DictDestructuringPattern); ok {
+			err = checkDeclaredPattern(nested, check)
+		} else if key.Alias != nil {
+			err = check(key.Alias)
+		} else {
+			err = check(key.Key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return check(pattern.Rest)
+}
+
+// missingKeyError is the strict mode error for reading a key a dictionary doesn't have
+func missingKeyError(tok lexer.Token, key string) *Error {
+	return newErrorWithPos(tok, "key not found: %s (use ?? or has() for optional keys)", key)
+}
+
+// checkStrictConcat returns an error in strict mode for + between a string
+// and a number, which otherwise converts the number to a string
+func checkStrictConcat(env *Environment, tok lexer.Token, left, right Object) *Error {
+	if !env.isStrict() {
+		return nil
+	}
+	isNumber := func(obj Object) bool {
+		return obj.Type() == INTEGER_OBJ || obj.Type() == FLOAT_OBJ
+	}
+	if (left.Type() == STRING_OBJ && isNumber(right)) || (isNumber(left) && right.Type() == STRING_OBJ) {
+		return newErrorWithPos(tok, "cannot add %s and %s in strict mode (convert with toString() or toNumber())", left.Type(), right.Type())
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package evaluator
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/sambeau/parsley/pkg/ast"
+	"github.com/sambeau/parsley/pkg/lexer"
+	"github.com/sambeau/parsley/pkg/parser"
+)
+
+// The if and for attributes render a tag conditionally or once per item,
+// without wrapping it in an if or for expression:
+//
+//	<li if={item.visible}>{item.name}</li>
+//	<li for={item in items}>{item.name}</li>
+//	<li for={i, item in items} if={item.visible}>{i}: {item.name}</li>
+//
+// Both take an expression in braces and are removed from the rendered tag.
+// With both, the condition is checked for each item. A for={...} that isn't a
+// loop, like <label for={inputId}>, is left as an ordinary attribute. They
+// work on components too, so a component can't take a prop called if.
+
+// tagDirectives are the if and for expressions of a tag, as source
+type tagDirectives struct {
+	cond, loop string
+}
+
+// loopDirectiveRegex matches the start of a for={...} loop: item in, or
+// i, item in
+var loopDirectiveRegex = regexp.MustCompile(`^[A-Za-z_]\w*(\s*,\s*[A-Za-z_]\w*)?\s+in\s`)
+
+// extractTagDirectives removes the if={...} and for={...} attributes from a
+// tag's props
+func extractTagDirectives(props string) (string, tagDirectives) {
+	var d tagDirectives
+	props, d.cond = extractTagAttribute(props, "if")
+	if rest, loop := extractTagAttribute(props, "for"); loopDirectiveRegex.MatchString(loop) {
+		props, d.loop = rest, loop
+	}
+	return props, d
+}
+
+// extractTagAttribute removes name={expr} from props, returning the rest and
+// the expression. Quoted values and other {...} values are skipped over.
+func extractTagAttribute(props, name string) (string, string) {
+	prefix := name + "={"
+	i := 0
+	for i < len(props) {
+		switch props[i] {
+		case '"', '\'':
+			i = skipQuoted(props, i)
+			continue
+		case '{':
+			i = skipBraces(props, i)
+			continue
+		}
+		atStart := i == 0 || props[i-1] == ' ' || props[i-1] == '\t' || props[i-1] == '\n' || props[i-1] == '\r'
+		if atStart && strings.HasPrefix(props[i:], prefix) {
+			open := i + len(prefix) - 1
+			end := skipBraces(props, open)
+			if end > len(props) || props[end-1] != '}' {
+				return props, ""
+			}
+			// Remove the space before the attribute, or after it if it's first
+			start, rest := i, end
+			for start > 0 && strings.ContainsRune(" \t\r\n", rune(props[start-1])) {
+				start--
+			}
+			if i == 0 {
+				for rest < len(props) && strings.ContainsRune(" \t\r\n", rune(props[rest])) {
+					rest++
+				}
+			}
+			return props[:start] + props[rest:], strings.TrimSpace(props[open+1 : end-1])
+		}
+		i++
+	}
+	return props, ""
+}
+
+// skipQuoted returns the index just past the quoted string starting at i
+func skipQuoted(s string, i int) int {
+	quote := s[i]
+	i++
+	for i < len(s) && s[i] != quote {
+		if s[i] == '\\' {
+			i++
+		}
+		i++
+	}
+	return i + 1
+}
+
+// skipBraces returns the index just past the {...} starting at i, skipping
+// quoted strings inside
+func skipBraces(s string, i int) int {
+	depth := 0
+	for i < len(s) {
+		switch s[i] {
+		case '"':
+			i = skipQuoted(s, i)
+			continue
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+		i++
+	}
+	return i + 1
+}
+
+// parseDirective parses a directive's expression
+func parseDirective(src, name, tagName string) (ast.Expression, *Error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, newError("error parsing %s={...} on <%s>: %s", name, tagName, p.Errors()[0])
+	}
+	if len(program.Statements) != 1 {
+		return nil, newError("%s={...} on <%s> must be a single expression", name, tagName)
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		return nil, newError("%s={...} on <%s> must be an expression", name, tagName)
+	}
+	return stmt.Expression, nil
+}
+
+// evalTagDirectives renders tag, a tag node without its if and for
+// attributes, as the directives say
+func evalTagDirectives(tag ast.Expression, tagName string, d tagDirectives, env *Environment) Object {
+	body := tag
+	if d.cond != "" {
+		cond, errObj := parseDirective(d.cond, "if", tagName)
+		if errObj != nil {
+			return errObj
+		}
+		if d.loop == "" {
+			test := Eval(cond, env)
+			if isError(test) {
+				return test
+			}
+			if !isTruthy(test) {
+				return &String{Value: ""}
+			}
+			return Eval(tag, env)
+		}
+		body = &ast.IfExpression{
+			Condition:   cond,
+			Consequence: &ast.BlockStatement{Statements: []ast.Statement{&ast.ExpressionStatement{Expression: tag}}},
+		}
+	}
+
+	// for={item in items} becomes for (item in items) { <tag> }
+	loop, errObj := parseDirective("for ("+d.loop+") {}", "for", tagName)
+	if errObj != nil {
+		return errObj
+	}
+	forExpr, ok := loop.(*ast.ForExpression)
+	if !ok || forExpr.Body == nil {
+		return newError("for={...} on <%s> must look like {item in items} or {i, item in items}", tagName)
+	}
+	forExpr.Body.(*ast.FunctionLiteral).Body.Statements = []ast.Statement{&ast.ExpressionStatement{Expression: body}}
+
+	result := Eval(forExpr, env)
+	if isError(result) {
+		return result
+	}
+	return &String{Value: objectToTemplateString(result)}
+}
@@ -0,0 +1,348 @@
+package evaluator
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/sambeau/parsley/pkg/ast"
+)
+
+// Tag dictionaries made by tag(name, attrs, contents) can be rebuilt with
+// methods that return modified copies, and searched with CSS-style
+// selectors, so components can post-process the tags they're given:
+//
+//	let doc = tag("article", {}, [tag("h2", {}, "Intro"), tag("p", {}, "...")])
+//	doc.query("h2").map(fn(h) { h.contents })
+//	doc.withChildren(doc.contents.map(fn(c) { c.addClass("item") }))
+
+// tagParts returns a tag dictionary's name, attributes and contents
+func tagParts(dict *Dictionary) (string, *Dictionary, Object) {
+	var name string
+	if expr, ok := dict.Pairs["name"]; ok {
+		if str, ok := Eval(expr, dict.Env).(*String); ok {
+			name = str.Value
+		}
+	}
+	attrs := &Dictionary{Pairs: map[string]ast.Expression{}, Env: NewEnvironment()}
+	if expr, ok := dict.Pairs["attrs"]; ok {
+		if d, ok := Eval(expr, dict.Env).(*Dictionary); ok {
+			attrs = d
+		}
+	}
+	var contents Object = NULL
+	if expr, ok := dict.Pairs["contents"]; ok {
+		contents = Eval(expr, dict.Env)
+	}
+	return name, attrs, contents
+}
+
+// newTagDict makes a tag dictionary, as the tag builtin does
+func newTagDict(name string, attrs map[string]ast.Expression, contents Object) *Dictionary {
+	pairs := make(map[string]ast.Expression)
+	pairs["__type"] = createLiteralExpression(&String{Value: "tag"})
+	pairs["name"] = createLiteralExpression(&String{Value: name})
+	pairs["attrs"] = createLiteralExpression(&Dictionary{Pairs: attrs, Env: NewEnvironment()})
+	pairs["contents"] = createLiteralExpression(contents)
+	return &Dictionary{Pairs: pairs, Env: NewEnvironment()}
+}
+
+// tagAttr returns an attribute's value as a string, and whether it's set
+func tagAttr(attrs *Dictionary, name string) (string, bool) {
+	expr, ok := attrs.Pairs[name]
+	if !ok {
+		return "", false
+	}
+	val := Eval(expr, attrs.Env)
+	if val == NULL {
+		return "", false
+	}
+	return objectToPrintString(val), true
+}
+
+// copyAttrs returns a copy of a tag's attribute expressions
+func copyAttrs(attrs *Dictionary) map[string]ast.Expression {
+	pairs := make(map[string]ast.Expression, len(attrs.Pairs))
+	for key, expr := range attrs.Pairs {
+		pairs[key] = objectToExpression(Eval(expr, attrs.Env))
+	}
+	return pairs
+}
+
+// evalTagMethod evaluates a method call on a tag dictionary. Tags are never
+// changed in place; the with/add/remove methods return new tags.
+func evalTagMethod(dict *Dictionary, method string, args []Object) Object {
+	name, attrs, contents := tagParts(dict)
+
+	switch method {
+	case "toString":
+		if len(args) != 0 {
+			return newError("wrong number of arguments to `toString`. got=%d, want=0", len(args))
+		}
+		return &String{Value: tagDictToString(dict)}
+
+	case "withAttr":
+		// withAttr(name, value) - null removes the attribute
+		if len(args) != 2 {
+			return newError("wrong number of arguments to `withAttr`. got=%d, want=2", len(args))
+		}
+		attrName, ok := args[0].(*String)
+		if !ok {
+			return newError("first argument to `withAttr` must be a string, got %s", args[0].Type())
+		}
+		pairs := copyAttrs(attrs)
+		if args[1] == NULL {
+			delete(pairs, attrName.Value)
+		} else {
+			pairs[attrName.Value] = objectToExpression(args[1])
+		}
+		return newTagDict(name, pairs, contents)
+
+	case "addClass", "removeClass":
+		// addClass("a b") adds each class that's missing; removeClass("a b")
+		// removes them, dropping the class attribute if none are left
+		if len(args) != 1 {
+			return newError("wrong number of arguments to `%s`. got=%d, want=1", method, len(args))
+		}
+		arg, ok := args[0].(*String)
+		if !ok {
+			return newError("argument to `%s` must be a string, got %s", method, args[0].Type())
+		}
+		current, _ := tagAttr(attrs, "class")
+		classes := strings.Fields(current)
+		for _, class := range strings.Fields(arg.Value) {
+			i := indexOfString(classes, class)
+			if method == "addClass" && i < 0 {
+				classes = append(classes, class)
+			}
+			if method == "removeClass" && i >= 0 {
+				classes = append(classes[:i], classes[i+1:]...)
+			}
+		}
+		pairs := copyAttrs(attrs)
+		if len(classes) == 0 {
+			delete(pairs, "class")
+		} else {
+			pairs["class"] = objectToExpression(&String{Value: strings.Join(classes, " ")})
+		}
+		return newTagDict(name, pairs, contents)
+
+	case "withChildren":
+		// withChildren(contents) - a string, an array of strings and tags, or null
+		if len(args) != 1 {
+			return newError("wrong number of arguments to `withChildren`. got=%d, want=1", len(args))
+		}
+		switch c := args[0].(type) {
+		case *String, *Array, *Null:
+		case *Dictionary:
+			if !isTagDict(c) {
+				return newError("argument to `withChildren` must be a string, array, tag or null, got %s", args[0].Type())
+			}
+			args[0] = &Array{Elements: []Object{c}}
+		default:
+			return newError("argument to `withChildren` must be a string, array, tag or null, got %s", args[0].Type())
+		}
+		return newTagDict(name, copyAttrs(attrs), args[0])
+
+	case "query":
+		// query(selector) - the tags inside this one that match, in document order
+		if len(args) != 1 {
+			return newError("wrong number of arguments to `query`. got=%d, want=1", len(args))
+		}
+		selStr, ok := args[0].(*String)
+		if !ok {
+			return newError("argument to `query` must be a string, got %s", args[0].Type())
+		}
+		sel, errObj := parseSelector(selStr.Value)
+		if errObj != nil {
+			return errObj
+		}
+		matches := []Object{}
+		walkTags(contents, []*Dictionary{dict}, func(tag *Dictionary, ancestors []*Dictionary) {
+			if sel.matches(tag, ancestors) {
+				matches = append(matches, tag)
+			}
+		})
+		return &Array{Elements: matches}
+
+	default:
+		return newError("unknown method '%s' for tag", method)
+	}
+}
+
+func indexOfString(list []string, s string) int {
+	for i, item := range list {
+		if item == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// walkTags visits every tag dictionary in a tag's contents, depth first,
+// with the tags enclosing it (outermost first)
+func walkTags(contents Object, ancestors []*Dictionary, visit func(*Dictionary, []*Dictionary)) {
+	switch c := contents.(type) {
+	case *Array:
+		for _, elem := range c.Elements {
+			walkTags(elem, ancestors, visit)
+		}
+	case *Dictionary:
+		if !isTagDict(c) {
+			return
+		}
+		visit(c, ancestors)
+		_, _, children := tagParts(c)
+		walkTags(children, append(ancestors[:len(ancestors):len(ancestors)], c), visit)
+	}
+}
+
+// compoundSelector is one part of a selector, such as a.button[href]
+type compoundSelector struct {
+	name    string // "" matches any tag
+	id      string
+	classes []string
+	attrs   []attrSelector
+}
+
+type attrSelector struct {
+	name, value string
+	hasValue    bool
+}
+
+// selector is a list of compound selectors separated by descendant
+// combinators (whitespace): "nav a.active"
+type selector []compoundSelector
+
+// parseSelector parses the supported subset of CSS selectors: tag names,
+// *, .class, #id, [attr] and [attr=value], combined with descendant spaces
+func parseSelector(input string) (selector, *Error) {
+	var sel selector
+	for _, part := range strings.Fields(input) {
+		var c compoundSelector
+		rest := part
+		readName := func() string {
+			end := strings.IndexAny(rest, ".#[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			rest = rest[end:]
+			return name
+		}
+
+		c.name = readName()
+		if c.name == "*" {
+			c.name = ""
+		} else if c.name != "" && !isSelectorName(c.name) {
+			return nil, newError("invalid selector %q", input)
+		}
+		for rest != "" {
+			switch rest[0] {
+			case '.', '#':
+				kind := rest[0]
+				rest = rest[1:]
+				name := readName()
+				if !isSelectorName(name) {
+					return nil, newError("invalid selector %q", input)
+				}
+				if kind == '.' {
+					c.classes = append(c.classes, name)
+				} else {
+					c.id = name
+				}
+			case '[':
+				end := strings.IndexByte(rest, ']')
+				if end < 0 {
+					return nil, newError("invalid selector %q: missing ]", input)
+				}
+				var a attrSelector
+				a.name, a.value, a.hasValue = strings.Cut(rest[1:end], "=")
+				a.value = strings.Trim(a.value, `"'`)
+				if a.name == "" {
+					return nil, newError("invalid selector %q", input)
+				}
+				c.attrs = append(c.attrs, a)
+				rest = rest[end+1:]
+			default:
+				return nil, newError("invalid selector %q", input)
+			}
+		}
+		sel = append(sel, c)
+	}
+	if len(sel) == 0 {
+		return nil, newError("invalid selector %q", input)
+	}
+	return sel, nil
+}
+
+// isSelectorName reports whether s can be a tag, class or id name in a
+// selector
+func isSelectorName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' && r != ':' {
+			return false
+		}
+	}
+	return true
+}
+
+func (c compoundSelector) matches(tag *Dictionary) bool {
+	name, attrs, _ := tagParts(tag)
+	if c.name != "" && !strings.EqualFold(c.name, name) {
+		return false
+	}
+	if c.id != "" {
+		if id, _ := tagAttr(attrs, "id"); id != c.id {
+			return false
+		}
+	}
+	if len(c.classes) > 0 {
+		class, _ := tagAttr(attrs, "class")
+		have := strings.Fields(class)
+		for _, want := range c.classes {
+			if indexOfString(have, want) < 0 {
+				return false
+			}
+		}
+	}
+	for _, a := range c.attrs {
+		val, ok := tagAttr(attrs, a.name)
+		if !ok || (a.hasValue && val != a.value) {
+			return false
+		}
+	}
+	return true
+}
+
+// matches reports whether tag matches the selector. The last compound must
+// match the tag itself and the earlier ones its ancestors, in order.
+func (s selector) matches(tag *Dictionary, ancestors []*Dictionary) bool {
+	if !s[len(s)-1].matches(tag) {
+		return false
+	}
+	i := len(ancestors) - 1
+	for j := len(s) - 2; j >= 0; j-- {
+		for i >= 0 && !s[j].matches(ancestors[i]) {
+			i--
+		}
+		if i < 0 {
+			return false
+		}
+		i--
+	}
+	return true
+}
+
+// sortedAttrNames returns a tag's attribute names in a stable order
+func sortedAttrNames(attrs *Dictionary) []string {
+	names := make([]string, 0, len(attrs.Pairs))
+	for name := range attrs.Pairs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
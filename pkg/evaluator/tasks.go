@@ -0,0 +1,280 @@
+package evaluator
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Task is a named unit of work defined with task() in a parsfile
+type Task struct {
+	Name        string
+	Description string
+	Deps        []string // Tasks that must run first
+	Inputs      []string // Files (or globs) the task reads, resolved to absolute paths
+	Outputs     []string // Files the task produces, resolved to absolute paths
+	Fn          *Function
+}
+
+// TaskRegistry collects the tasks defined by a parsfile.
+// Set Environment.Tasks to a registry to enable task().
+type TaskRegistry struct {
+	tasks map[string]*Task
+	order []string
+}
+
+// TaskRunOptions controls how tasks are run
+type TaskRunOptions struct {
+	// Force runs tasks even when their outputs are up to date
+	Force bool
+	// Log receives progress messages (nil for none)
+	Log io.Writer
+}
+
+// NewTaskRegistry creates an empty task registry
+func NewTaskRegistry() *TaskRegistry {
+	return &TaskRegistry{tasks: make(map[string]*Task)}
+}
+
+// Get returns the task with the given name
+func (r *TaskRegistry) Get(name string) (*Task, bool) {
+	t, ok := r.tasks[name]
+	return t, ok
+}
+
+// Tasks returns all tasks in the order they were defined
+func (r *TaskRegistry) Tasks() []*Task {
+	tasks := make([]*Task, len(r.order))
+	for i, name := range r.order {
+		tasks[i] = r.tasks[name]
+	}
+	return tasks
+}
+
+// Plan returns the tasks needed to run the targets, dependencies first.
+// Each task appears once, even when several tasks depend on it.
+func (r *TaskRegistry) Plan(targets ...string) ([]*Task, error) {
+	var plan []*Task
+	done := make(map[string]bool)
+	visiting := make(map[string]bool)
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		if done[name] {
+			return nil
+		}
+		path = append(path, name)
+		if visiting[name] {
+			return fmt.Errorf("task dependency cycle: %s", strings.Join(path, " -> "))
+		}
+		t, ok := r.tasks[name]
+		if !ok {
+			if len(path) > 1 {
+				return fmt.Errorf("task %q (needed by %q) is not defined", name, path[len(path)-2])
+			}
+			return fmt.Errorf("task %q is not defined", name)
+		}
+		visiting[name] = true
+		for _, dep := range t.Deps {
+			if err := visit(dep, path); err != nil {
+				return err
+			}
+		}
+		visiting[name] = false
+		done[name] = true
+		plan = append(plan, t)
+		return nil
+	}
+
+	for _, target := range targets {
+		if err := visit(target, nil); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// Run runs the targets and their dependencies in dependency order.
+// A task with outputs is skipped when every output exists and is newer than
+// all of its inputs, unless one of its dependencies ran in this run.
+func (r *TaskRegistry) Run(targets []string, opts TaskRunOptions) error {
+	plan, err := r.Plan(targets...)
+	if err != nil {
+		return err
+	}
+
+	ran := make(map[string]bool)
+	for _, t := range plan {
+		depRan := false
+		for _, dep := range t.Deps {
+			if ran[dep] {
+				depRan = true
+			}
+		}
+
+		if !opts.Force && !depRan && t.upToDate() {
+			logTask(opts.Log, "%s is up to date", t.Name)
+			continue
+		}
+
+		logTask(opts.Log, "running %s", t.Name)
+		start := time.Now()
+		result := applyFunction(t.Fn, []Object{})
+		if errObj, ok := result.(*Error); ok {
+			return fmt.Errorf("task %q failed: %s", t.Name, errObj.Inspect())
+		}
+		logTask(opts.Log, "finished %s in %s", t.Name, time.Since(start).Round(time.Millisecond))
+		ran[t.Name] = true
+	}
+	return nil
+}
+
+// upToDate reports whether all outputs exist and are newer than every input
+func (t *Task) upToDate() bool {
+	if len(t.Outputs) == 0 {
+		return false
+	}
+
+	var oldestOutput time.Time
+	for _, out := range t.Outputs {
+		info, err := os.Stat(out)
+		if err != nil {
+			return false
+		}
+		if oldestOutput.IsZero() || info.ModTime().Before(oldestOutput) {
+			oldestOutput = info.ModTime()
+		}
+	}
+
+	for _, pattern := range t.Inputs {
+		matches, err := filepath.Glob(pattern)
+		if err != nil || len(matches) == 0 {
+			return false
+		}
+		for _, in := range matches {
+			info, err := os.Stat(in)
+			if err != nil || info.ModTime().After(oldestOutput) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func logTask(w io.Writer, format string, a ...interface{}) {
+	if w != nil {
+		fmt.Fprintf(w, "pars: "+format+"\n", a...)
+	}
+}
+
+// evalTask implements task(name, options?) { ... } and task(name, options?, fn),
+// adding the task to the environment's registry
+func evalTask(args []Object, env *Environment) Object {
+	if env.Tasks == nil {
+		return newError("`task` can only be used in a parsfile run with `pars run`")
+	}
+	if len(args) < 2 || len(args) > 3 {
+		return newError("wrong number of arguments to `task`. got=%d, want=2-3", len(args))
+	}
+
+	name, ok := args[0].(*String)
+	if !ok || name.Value == "" {
+		return newError("first argument to `task` must be a non-empty string, got %s", args[0].Type())
+	}
+	if _, exists := env.Tasks.tasks[name.Value]; exists {
+		return newError("task %q is already defined", name.Value)
+	}
+
+	fn, ok := args[len(args)-1].(*Function)
+	if !ok {
+		return newError("last argument to `task` must be a function or block, got %s", args[len(args)-1].Type())
+	}
+
+	t := &Task{Name: name.Value, Fn: fn}
+	if len(args) == 3 {
+		opts, ok := args[1].(*Dictionary)
+		if !ok {
+			return newError("options to `task` must be a dictionary, got %s", args[1].Type())
+		}
+		if errObj := parseTaskOptions(t, opts, env); errObj != nil {
+			return errObj
+		}
+	}
+
+	env.Tasks.tasks[t.Name] = t
+	env.Tasks.order = append(env.Tasks.order, t.Name)
+	return NULL
+}
+
+// parseTaskOptions reads {deps, inputs, outputs, description} into a task
+func parseTaskOptions(t *Task, opts *Dictionary, env *Environment) *Error {
+	keys := make([]string, 0, len(opts.Pairs))
+	for key := range opts.Pairs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		val := Eval(opts.Pairs[key], opts.Env)
+		if isError(val) {
+			return val.(*Error)
+		}
+		switch key {
+		case "description":
+			str, ok := val.(*String)
+			if !ok {
+				return newError("task %q: `description` must be a string, got %s", t.Name, val.Type())
+			}
+			t.Description = str.Value
+		case "deps":
+			deps, errObj := taskStringList(t.Name, key, val)
+			if errObj != nil {
+				return errObj
+			}
+			t.Deps = deps
+		case "inputs", "outputs":
+			paths, errObj := taskStringList(t.Name, key, val)
+			if errObj != nil {
+				return errObj
+			}
+			for i, p := range paths {
+				abs, err := resolveModulePath(p, env.Filename)
+				if err != nil {
+					return newError("task %q: invalid path '%s': %s", t.Name, p, err.Error())
+				}
+				paths[i] = abs
+			}
+			if key == "inputs" {
+				t.Inputs = paths
+			} else {
+				t.Outputs = paths
+			}
+		}
+	}
+	return nil
+}
+
+// taskStringList accepts a string, path or an array of them
+func taskStringList(taskName, key string, val Object) ([]string, *Error) {
+	elements := []Object{val}
+	if arr, ok := val.(*Array); ok {
+		elements = arr.Elements
+	}
+
+	list := make([]string, len(elements))
+	for i, elem := range elements {
+		switch v := elem.(type) {
+		case *String:
+			list[i] = v.Value
+		case *Path:
+			list[i] = v.Inspect()
+		default:
+			return nil, newError("task %q: `%s` must contain strings or paths, got %s", taskName, key, elem.Type())
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,141 @@
+package evaluator
+
+import (
+	"sync"
+	"time"
+)
+
+// timeIt(fn), stopwatch() and sleep(duration) measure and pace a script
+// without reading now() twice and subtracting:
+//
+//	let {result, duration} = timeIt(fn() { build(pages) })
+//	log("built {result.length()} pages in {duration}")
+//
+//	let sw = stopwatch()
+//	let rows = db <=??=> "SELECT * FROM posts"
+//	log("query: {sw.lap()}")
+//	for (p in rows) { render(p); sleep(@50ms) }
+//	log("render: {sw.lap()}, total: {sw.elapsed()}")
+//
+// Durations they return are in whole milliseconds.
+
+// Stopwatch measures time since it was started, split into laps
+type Stopwatch struct {
+	mu      sync.Mutex
+	start   time.Time
+	lapAt   time.Time
+	laps    []time.Duration
+	stopped bool
+	stopAt  time.Time
+}
+
+func (s *Stopwatch) Type() ObjectType { return STOPWATCH_OBJ }
+func (s *Stopwatch) Inspect() string  { return "<stopwatch>" }
+
+// now returns the current time, or the time the stopwatch was stopped
+func (s *Stopwatch) now() time.Time {
+	if s.stopped {
+		return s.stopAt
+	}
+	return time.Now()
+}
+
+// newStopwatch implements stopwatch()
+func newStopwatch(args []Object) Object {
+	if len(args) != 0 {
+		return newError("wrong number of arguments to `stopwatch`. got=%d, want=0", len(args))
+	}
+	now := time.Now()
+	return &Stopwatch{start: now, lapAt: now}
+}
+
+// evalStopwatchMethod evaluates a method call on a Stopwatch
+func evalStopwatchMethod(s *Stopwatch, method string, args []Object, env *Environment) Object {
+	if len(args) != 0 {
+		return newError("wrong number of arguments to `%s`. got=%d, want=0", method, len(args))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch method {
+	case "elapsed":
+		return goDurationToDuration(s.now().Sub(s.start))
+
+	case "lap":
+		// lap() ends the current lap and returns how long it took
+		now := s.now()
+		lap := now.Sub(s.lapAt)
+		s.lapAt = now
+		s.laps = append(s.laps, lap)
+		return goDurationToDuration(lap)
+
+	case "laps":
+		elements := make([]Object, len(s.laps))
+		for i, lap := range s.laps {
+			elements[i] = goDurationToDuration(lap)
+		}
+		return &Array{Elements: elements}
+
+	case "stop":
+		if !s.stopped {
+			s.stopped = true
+			s.stopAt = time.Now()
+		}
+		return goDurationToDuration(s.stopAt.Sub(s.start))
+
+	case "reset":
+		now := time.Now()
+		s.start, s.lapAt, s.laps, s.stopped = now, now, nil, false
+		return NULL
+
+	default:
+		return newError("unknown method '%s' for stopwatch", method)
+	}
+}
+
+// evalTimeIt implements timeIt(fn), returning {result, duration}
+func evalTimeIt(args []Object, env *Environment) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments to `timeIt`. got=%d, want=1", len(args))
+	}
+	switch fn := args[0].(type) {
+	case *Function:
+		if fn.ParamCount() != 0 {
+			return newError("function passed to `timeIt` must take no parameters, got %d", fn.ParamCount())
+		}
+	case *Builtin:
+	default:
+		return newError("argument to `timeIt` must be a block or function, got %s", args[0].Type())
+	}
+
+	start := time.Now()
+	result := applyFunctionWithEnv(args[0], nil, env)
+	elapsed := time.Since(start)
+	if result == nil {
+		result = NULL
+	}
+	if isError(result) {
+		return result
+	}
+	return NewDictionaryFromObjects(map[string]Object{
+		"result":   result,
+		"duration": goDurationToDuration(elapsed),
+	})
+}
+
+// evalSleep implements sleep(duration)
+func evalSleep(args []Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments to `sleep`. got=%d, want=1", len(args))
+	}
+	dur, ok := args[0].(*Duration)
+	if !ok {
+		return newError("argument to `sleep` must be a duration, got %s", typeName(args[0]))
+	}
+	d, err := dur.toGo()
+	if err != nil || d < 0 {
+		return newError("argument to `sleep` must be a positive duration without months or years")
+	}
+	time.Sleep(d)
+	return NULL
+}
@@ -0,0 +1,245 @@
+package evaluator
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/sambeau/parsley/pkg/ast"
+	"golang.org/x/net/html"
+)
+
+// toc(content, {min, max}) finds the headings in some HTML, gives each an id
+// so it can be linked to, and returns the HTML with the ids added along with
+// the headings as a nested list:
+//
+//	{html: "<h2 id=\"intro\">Intro</h2>...", items: [
+//	    {level: 2, text: "Intro", id: "intro", children: [...]}
+//	]}
+//
+// Only the heading start tags are rewritten; the rest of the HTML is kept
+// byte for byte. Headings that already have an id keep it.
+
+// tocHeading is a heading found by buildTOC
+type tocHeading struct {
+	level    int
+	text     string
+	id       string
+	children []*tocHeading
+}
+
+// tocOptions are the heading levels toc includes (default h2 to h3)
+type tocOptions struct {
+	min, max int
+}
+
+func parseTOCOptions(opts *Dictionary) (tocOptions, *Error) {
+	to := tocOptions{min: 2, max: 3}
+	for key, expr := range opts.Pairs {
+		var target *int
+		switch key {
+		case "min":
+			target = &to.min
+		case "max":
+			target = &to.max
+		default:
+			return to, newError("unknown option %q for `toc`", key)
+		}
+		n, ok := Eval(expr, opts.Env).(*Integer)
+		if !ok || n.Value < 1 || n.Value > 6 {
+			return to, newError("`%s` option for `toc` must be a heading level from 1 to 6", key)
+		}
+		*target = int(n.Value)
+	}
+	if to.min > to.max {
+		return to, newError("`min` option for `toc` must not be greater than `max`")
+	}
+	return to, nil
+}
+
+// htmlContent returns the HTML of an argument that takes a string, a tag
+// dictionary, or an array of them
+func htmlContent(content Object, fnName string) (string, *Error) {
+	switch c := content.(type) {
+	case *String:
+		return c.Value, nil
+	case *Dictionary:
+		if isTagDict(c) {
+			return tagDictToString(c), nil
+		}
+	case *Array:
+		var out strings.Builder
+		for _, elem := range c.Elements {
+			part, errObj := htmlContent(elem, fnName)
+			if errObj != nil {
+				return "", errObj
+			}
+			out.WriteString(part)
+		}
+		return out.String(), nil
+	}
+	return "", newError("first argument to `%s` must be HTML (a string, tag or array), got %s", fnName, content.Type())
+}
+
+// buildTOC adds ids to the headings in src between the given levels and
+// returns the new HTML and the headings nested by level
+func buildTOC(src string, opts tocOptions) (string, []*tocHeading) {
+	used := documentIDs(src)
+
+	var out strings.Builder
+	var roots, stack []*tocHeading
+
+	// A heading is held back until its end tag, when its text is known
+	var current *tocHeading
+	var startTag string
+	var inner, text strings.Builder
+
+	z := html.NewTokenizer(strings.NewReader(src))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if current != nil {
+				// Unclosed heading: keep it as it was
+				out.WriteString(startTag)
+				out.WriteString(inner.String())
+			}
+			out.Write(z.Raw())
+			break
+		}
+		raw := string(z.Raw())
+
+		if current == nil {
+			if tt == html.StartTagToken {
+				name, hasAttr := z.TagName()
+				if level := headingLevel(string(name)); level >= opts.min && level <= opts.max {
+					current = &tocHeading{level: level}
+					for hasAttr {
+						var key, val []byte
+						key, val, hasAttr = z.TagAttr()
+						if string(key) == "id" {
+							current.id = string(val)
+						}
+					}
+					startTag = raw
+					inner.Reset()
+					text.Reset()
+					continue
+				}
+			}
+			out.WriteString(raw)
+			continue
+		}
+
+		if tt == html.EndTagToken {
+			if name, _ := z.TagName(); headingLevel(string(name)) == current.level {
+				current.text = strings.Join(strings.Fields(text.String()), " ")
+				if current.id == "" {
+					current.id = uniqueSlug(used, slugify(current.text))
+					startTag = startTag[:len(startTag)-1] + ` id="` + html.EscapeString(current.id) + `">`
+				}
+				out.WriteString(startTag)
+				out.WriteString(inner.String())
+				out.WriteString(raw)
+
+				// Nest under the closest earlier heading of a higher level
+				for len(stack) > 0 && stack[len(stack)-1].level >= current.level {
+					stack = stack[:len(stack)-1]
+				}
+				if len(stack) == 0 {
+					roots = append(roots, current)
+				} else {
+					parent := stack[len(stack)-1]
+					parent.children = append(parent.children, current)
+				}
+				stack = append(stack, current)
+				current = nil
+				continue
+			}
+		}
+		if tt == html.TextToken {
+			text.Write(z.Text())
+		}
+		inner.WriteString(raw)
+	}
+	return out.String(), roots
+}
+
+// documentIDs returns the ids already used in src, so generated ids don't
+// clash with them
+func documentIDs(src string) map[string]bool {
+	ids := map[string]bool{}
+	z := html.NewTokenizer(strings.NewReader(src))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return ids
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		_, hasAttr := z.TagName()
+		for hasAttr {
+			var key, val []byte
+			key, val, hasAttr = z.TagAttr()
+			if string(key) == "id" {
+				ids[string(val)] = true
+			}
+		}
+	}
+}
+
+// headingLevel returns n for an hn tag name, or 0
+func headingLevel(name string) int {
+	if len(name) == 2 && name[0] == 'h' && name[1] >= '1' && name[1] <= '6' {
+		return int(name[1] - '0')
+	}
+	return 0
+}
+
+// slugify makes an id from heading text: lowercase letters and digits, with
+// runs of anything else replaced by a hyphen
+func slugify(text string) string {
+	var out strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if hyphen && out.Len() > 0 {
+				out.WriteByte('-')
+			}
+			hyphen = false
+			out.WriteRune(r)
+		case unicode.IsSpace(r) || r == '-' || r == '_':
+			hyphen = true
+		}
+	}
+	return out.String()
+}
+
+// uniqueSlug returns slug, or slug-2, slug-3... if it's already used, and
+// marks it as used
+func uniqueSlug(used map[string]bool, slug string) string {
+	if slug == "" {
+		slug = "section"
+	}
+	candidate := slug
+	for n := 2; used[candidate]; n++ {
+		candidate = fmt.Sprintf("%s-%d", slug, n)
+	}
+	used[candidate] = true
+	return candidate
+}
+
+// tocItems converts headings to an array of dictionaries
+func tocItems(headings []*tocHeading, env *Environment) *Array {
+	items := make([]Object, len(headings))
+	for i, h := range headings {
+		items[i] = &Dictionary{Pairs: map[string]ast.Expression{
+			"level":    objectToExpression(&Integer{Value: int64(h.level)}),
+			"text":     objectToExpression(&String{Value: h.text}),
+			"id":       objectToExpression(&String{Value: h.id}),
+			"children": objectToExpression(tocItems(h.children, env)),
+		}, Env: env}
+	}
+	return &Array{Elements: items}
+}
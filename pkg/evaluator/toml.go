@@ -0,0 +1,300 @@
+package evaluator
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sambeau/parsley/pkg/toml"
+)
+
+// TOML(path) handles read TOML documents as dictionaries, the way JSON and
+// YAML handles do:
+//
+//	[package]
+//	name = "parsley"
+//	released = 2024-03-01
+//
+//	[[bin]]
+//	name = "pars"
+//
+// reads as
+//
+//	{package: {name: "parsley", released: @2024-03-01}, bin: [{name: "pars"}]}
+//
+// Dates, times and datetimes become datetimes. Writing reverses this: keys
+// are written in order, plain values before tables, and arrays of
+// dictionaries as arrays of tables. TOML has no null, so null values in
+// dictionaries are left out.
+
+// parseTOML parses a TOML document into a dictionary
+func parseTOML(content string) (Object, *Error) {
+	doc, err := toml.Parse(content)
+	if err != nil {
+		return nil, newError("failed to parse TOML: %s", err.Error())
+	}
+	return tomlToObject(doc), nil
+}
+
+// tomlToObject converts a parsed TOML value into a Parsley object
+func tomlToObject(value interface{}) Object {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		pairs := make(map[string]Object, len(v))
+		for key, val := range v {
+			pairs[key] = tomlToObject(val)
+		}
+		return NewDictionaryFromObjects(pairs)
+	case []interface{}:
+		elements := make([]Object, len(v))
+		for i, elem := range v {
+			elements[i] = tomlToObject(elem)
+		}
+		return &Array{Elements: elements}
+	case toml.Datetime:
+		if v.Kind == "time" {
+			return newDatetime(v.Time, "time_seconds")
+		}
+		return newDatetime(v.Time, v.Kind)
+	case string:
+		return &String{Value: v}
+	case int64:
+		return &Integer{Value: v}
+	case float64:
+		return &Float{Value: v}
+	case bool:
+		return nativeBoolToParsBoolean(v)
+	default:
+		return NULL
+	}
+}
+
+// tomlLiteral is a value written into TOML as it is, such as a datetime
+type tomlLiteral string
+
+// encodeTOML encodes a dictionary as a TOML document
+func encodeTOML(value Object) ([]byte, error) {
+	root, ok := tomlGoValue(value).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("TOML format requires a dictionary, got %s", value.Type())
+	}
+	var sb strings.Builder
+	if err := writeTOMLTable(&sb, nil, root, false); err != nil {
+		return nil, err
+	}
+	return []byte(strings.TrimPrefix(sb.String(), "\n")), nil
+}
+
+// tomlGoValue converts an object for encodeTOML as objectToGo does, but
+// keeping datetimes as TOML datetimes
+func tomlGoValue(obj Object) interface{} {
+	switch v := rangeAsArray(obj).(type) {
+	case *Array:
+		result := make([]interface{}, len(v.Elements))
+		for i, elem := range v.Elements {
+			result[i] = tomlGoValue(elem)
+		}
+		return result
+	case *Datetime:
+		s := v.Inspect()
+		if v.Kind == "time" {
+			s += ":00" // TOML times have seconds
+		}
+		return tomlLiteral(s)
+	case *Dictionary:
+		if _, ok := typedScalar(v); ok {
+			return objectToGo(v)
+		}
+		result := make(map[string]interface{})
+		for key, expr := range v.Pairs {
+			if strings.HasPrefix(key, "_") {
+				continue
+			}
+			result[key] = tomlGoValue(Eval(expr, dictionaryThisEnv(v)))
+		}
+		return result
+	default:
+		return objectToGo(obj)
+	}
+}
+
+// writeTOMLTable writes a table's values, then its tables and arrays of
+// tables under headers. header is whether the table itself needs a header
+// line, which only tables with values of their own, or none at all, do.
+func writeTOMLTable(sb *strings.Builder, path []string, table map[string]interface{}, header bool) error {
+	keys := make([]string, 0, len(table))
+	for key := range table {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var values, tables, tableArrays []string
+	for _, key := range keys {
+		switch v := table[key].(type) {
+		case nil:
+		case map[string]interface{}:
+			tables = append(tables, key)
+		case []interface{}:
+			if isTOMLTableArray(v) {
+				tableArrays = append(tableArrays, key)
+			} else {
+				values = append(values, key)
+			}
+		default:
+			values = append(values, key)
+		}
+	}
+
+	if header && (len(values) > 0 || len(tables)+len(tableArrays) == 0) {
+		sb.WriteString("\n[" + tomlKeyPath(path) + "]\n")
+	}
+	for _, key := range values {
+		text, err := tomlInlineValue(table[key])
+		if err != nil {
+			return fmt.Errorf("%s: %s", tomlKeyPath(append(path, key)), err.Error())
+		}
+		sb.WriteString(tomlKey(key) + " = " + text + "\n")
+	}
+	for _, key := range tables {
+		if err := writeTOMLTable(sb, append(path[:len(path):len(path)], key), table[key].(map[string]interface{}), true); err != nil {
+			return err
+		}
+	}
+	for _, key := range tableArrays {
+		subPath := append(path[:len(path):len(path)], key)
+		for _, elem := range table[key].([]interface{}) {
+			sb.WriteString("\n[[" + tomlKeyPath(subPath) + "]]\n")
+			if err := writeTOMLTable(sb, subPath, elem.(map[string]interface{}), false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isTOMLTableArray reports whether an array is written as an array of
+// tables: one that isn't empty and holds only dictionaries
+func isTOMLTableArray(arr []interface{}) bool {
+	if len(arr) == 0 {
+		return false
+	}
+	for _, elem := range arr {
+		if _, ok := elem.(map[string]interface{}); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// tomlInlineValue returns a value as TOML on one line
+func tomlInlineValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", fmt.Errorf("TOML has no null value")
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "nan", nil
+		case math.IsInf(v, 1):
+			return "inf", nil
+		case math.IsInf(v, -1):
+			return "-inf", nil
+		}
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		return s, nil
+	case string:
+		return tomlQuote(v), nil
+	case tomlLiteral:
+		return string(v), nil
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, elem := range v {
+			text, err := tomlInlineValue(elem)
+			if err != nil {
+				return "", err
+			}
+			parts[i] = text
+		}
+		return "[" + strings.Join(parts, ", ") + "]", nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key, val := range v {
+			if val != nil {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		parts := make([]string, len(keys))
+		for i, key := range keys {
+			text, err := tomlInlineValue(v[key])
+			if err != nil {
+				return "", err
+			}
+			parts[i] = tomlKey(key) + " = " + text
+		}
+		if len(parts) == 0 {
+			return "{}", nil
+		}
+		return "{ " + strings.Join(parts, ", ") + " }", nil
+	default:
+		return tomlQuote(fmt.Sprint(v)), nil
+	}
+}
+
+// tomlKey returns a key, quoted unless it's a bare key
+func tomlKey(key string) string {
+	if toml.IsBareKey(key) {
+		return key
+	}
+	return tomlQuote(key)
+}
+
+// tomlKeyPath returns the dotted key of a table
+func tomlKeyPath(path []string) string {
+	parts := make([]string, len(path))
+	for i, key := range path {
+		parts[i] = tomlKey(key)
+	}
+	return strings.Join(parts, ".")
+}
+
+// tomlQuote returns a string as a TOML basic string
+func tomlQuote(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\b':
+			sb.WriteString(`\b`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\f':
+			sb.WriteString(`\f`)
+		case '\r':
+			sb.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7F {
+				fmt.Fprintf(&sb, `\u%04X`, r)
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
@@ -0,0 +1,345 @@
+package evaluator
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// toText(content, {width}) renders HTML as readable plain text, e.g. for the
+// text/plain part of an email: paragraphs are wrapped to width, headings are
+// underlined, lists are indented under their bullets or numbers, and links
+// become numbered references listed at the end.
+
+// lineBreak marks a <br> in the pending inline text
+const lineBreak = '\u2028'
+
+// textRenderer converts a parsed HTML tree to lines of text
+type textRenderer struct {
+	width int
+	lines []string
+	// inline is the text of the block being built, flushed as wrapped lines
+	inline strings.Builder
+	// indent prefixes each line; marker replaces it on the next line written,
+	// for list bullets
+	indent, marker string
+	// blank puts a blank line before the next lines written
+	blank bool
+	// listDepth is how many lists the renderer is inside
+	listDepth int
+
+	links    []string
+	linkNums map[string]int
+}
+
+func parseToTextOptions(opts *Dictionary) (int, *Error) {
+	width := 72
+	for key, expr := range opts.Pairs {
+		if key != "width" {
+			return 0, newError("unknown option %q for `toText`", key)
+		}
+		n, ok := Eval(expr, opts.Env).(*Integer)
+		if !ok || n.Value < 0 {
+			return 0, newError("`width` option for `toText` must be a non-negative integer (0 for no wrapping)")
+		}
+		width = int(n.Value)
+	}
+	return width, nil
+}
+
+// htmlToText renders src as plain text, wrapping lines at width (0 for no
+// wrapping)
+func htmlToText(src string, width int) string {
+	nodes, err := html.ParseFragment(strings.NewReader(src), &html.Node{
+		Type: html.ElementNode, Data: "body", DataAtom: atom.Body,
+	})
+	if err != nil {
+		return src
+	}
+
+	r := &textRenderer{width: width, linkNums: map[string]int{}}
+	for _, n := range nodes {
+		r.render(n)
+	}
+	r.flush()
+
+	if len(r.links) > 0 {
+		r.blank = true
+		for i, link := range r.links {
+			r.write([]string{"[" + strconv.Itoa(i+1) + "] " + link})
+		}
+	}
+	return strings.Join(r.lines, "\n")
+}
+
+// write adds lines with the current indent or list marker
+func (r *textRenderer) write(lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	if r.blank && len(r.lines) > 0 {
+		r.lines = append(r.lines, "")
+	}
+	r.blank = false
+	for _, line := range lines {
+		prefix := r.indent
+		if r.marker != "" {
+			prefix, r.marker = r.marker, ""
+		}
+		r.lines = append(r.lines, strings.TrimRight(prefix+line, " "))
+	}
+}
+
+// flush writes the pending inline text as wrapped lines
+func (r *textRenderer) flush() {
+	text := r.inline.String()
+	r.inline.Reset()
+
+	var lines []string
+	for _, part := range strings.Split(text, string(lineBreak)) {
+		lines = append(lines, wrapText(strings.Join(strings.Fields(part), " "), r.width-utf8.RuneCountInString(r.indent))...)
+	}
+	// Drop empty lines left by whitespace between blocks
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	r.write(lines)
+}
+
+// startBlock ends the current block, with a blank line before the next if
+// spaced is set
+func (r *textRenderer) startBlock(spaced bool) {
+	r.flush()
+	if spaced {
+		r.blank = true
+	}
+}
+
+func (r *textRenderer) renderChildren(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		r.render(c)
+	}
+}
+
+func (r *textRenderer) render(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		r.inline.WriteString(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		r.renderChildren(n)
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Head, atom.Title, atom.Script, atom.Style, atom.Template, atom.Noscript:
+		// Not visible text
+
+	case atom.Br:
+		r.inline.WriteRune(lineBreak)
+
+	case atom.Hr:
+		r.startBlock(true)
+		r.write([]string{strings.Repeat("-", ruleWidth(r.width))})
+		r.blank = true
+
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		r.startBlock(true)
+		r.renderChildren(n)
+		text := strings.Join(strings.Fields(r.inline.String()), " ")
+		r.flush()
+		if n.DataAtom == atom.H1 || n.DataAtom == atom.H2 {
+			rule := "="
+			if n.DataAtom == atom.H2 {
+				rule = "-"
+			}
+			length := utf8.RuneCountInString(text)
+			if r.width > 0 && length > r.width {
+				length = r.width
+			}
+			r.write([]string{strings.Repeat(rule, length)})
+		}
+		r.blank = true
+
+	case atom.Ul, atom.Ol:
+		// Nested lists stay tight under their item
+		r.startBlock(r.listDepth == 0)
+		r.listDepth++
+		num := 1
+		if start, err := strconv.Atoi(attrValue(n, "start")); err == nil {
+			num = start
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode || c.DataAtom != atom.Li {
+				r.render(c)
+				continue
+			}
+			marker := "- "
+			if n.DataAtom == atom.Ol {
+				marker = strconv.Itoa(num) + ". "
+				num++
+			}
+			r.flush()
+			outer := r.indent
+			r.marker = outer + marker
+			r.indent = outer + strings.Repeat(" ", len(marker))
+			r.renderChildren(c)
+			r.flush()
+			if r.marker != "" {
+				// An empty item still shows its bullet
+				r.lines = append(r.lines, strings.TrimRight(r.marker, " "))
+				r.marker = ""
+			}
+			r.indent = outer
+		}
+		r.listDepth--
+		r.startBlock(r.listDepth == 0)
+
+	case atom.Blockquote:
+		r.startBlock(true)
+		outer := r.indent
+		r.indent = outer + "> "
+		r.renderChildren(n)
+		r.flush()
+		r.indent = outer
+		r.blank = true
+
+	case atom.Pre:
+		r.startBlock(true)
+		text := strings.TrimSuffix(strings.TrimPrefix(textContent(n), "\n"), "\n")
+		outer := r.indent
+		r.indent = outer + "    "
+		r.write(strings.Split(text, "\n"))
+		r.indent = outer
+		r.blank = true
+
+	case atom.Tr:
+		r.flush()
+		first := true
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && (c.DataAtom == atom.Td || c.DataAtom == atom.Th) {
+				if !first {
+					r.inline.WriteString(" | ")
+				}
+				first = false
+			}
+			r.render(c)
+		}
+		r.flush()
+
+	case atom.A:
+		start := r.inline.Len()
+		r.renderChildren(n)
+		href := strings.TrimSpace(attrValue(n, "href"))
+		label := strings.TrimSpace(r.inline.String()[start:])
+		if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(href, "javascript:") || href == label {
+			break
+		}
+		if label == strings.TrimPrefix(href, "mailto:") {
+			break
+		}
+		num, ok := r.linkNums[href]
+		if !ok {
+			r.links = append(r.links, href)
+			num = len(r.links)
+			r.linkNums[href] = num
+		}
+		r.inline.WriteString(" [" + strconv.Itoa(num) + "]")
+
+	case atom.Img:
+		if alt := strings.TrimSpace(attrValue(n, "alt")); alt != "" {
+			r.inline.WriteString("[" + alt + "]")
+		}
+
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Header, atom.Footer,
+		atom.Main, atom.Nav, atom.Aside, atom.Figure, atom.Figcaption, atom.Address,
+		atom.Details, atom.Summary, atom.Form, atom.Fieldset, atom.Table, atom.Dl:
+		r.startBlock(true)
+		r.renderChildren(n)
+		r.startBlock(true)
+
+	case atom.Dt, atom.Dd, atom.Li, atom.Caption, atom.Legend:
+		r.flush()
+		if n.DataAtom == atom.Dd {
+			outer := r.indent
+			r.indent = outer + "    "
+			r.renderChildren(n)
+			r.flush()
+			r.indent = outer
+			break
+		}
+		r.renderChildren(n)
+		r.flush()
+
+	default:
+		r.renderChildren(n)
+	}
+}
+
+// wrapText breaks text into lines of at most width characters at spaces. A
+// width of 0 or less doesn't wrap. Words longer than the width get a line of
+// their own.
+func wrapText(text string, width int) []string {
+	if width <= 0 {
+		return []string{text}
+	}
+	if width < 20 {
+		width = 20
+	}
+
+	var lines []string
+	var line strings.Builder
+	lineLen := 0
+	for _, word := range strings.Fields(text) {
+		wordLen := utf8.RuneCountInString(word)
+		if lineLen > 0 && lineLen+1+wordLen > width {
+			lines = append(lines, line.String())
+			line.Reset()
+			lineLen = 0
+		}
+		if lineLen > 0 {
+			line.WriteByte(' ')
+			lineLen++
+		}
+		line.WriteString(word)
+		lineLen += wordLen
+	}
+	return append(lines, line.String())
+}
+
+// ruleWidth is the length of an <hr> line
+func ruleWidth(width int) int {
+	if width <= 0 || width > 72 {
+		return 72
+	}
+	return width
+}
+
+// attrValue returns the value of an attribute of n, or ""
+func attrValue(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// textContent returns all the text inside n
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var out strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		out.WriteString(textContent(c))
+	}
+	return out.String()
+}
@@ -0,0 +1,183 @@
+package evaluator
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// db.begin(), db.commit() and db.rollback() run the queries between them in
+// one database transaction. begin() inside a transaction starts a savepoint,
+// so a part of the work can be rolled back on its own:
+//
+//	db.begin()
+//	let _ = db <=!=> ["INSERT INTO orders (total) VALUES (?)", [total]]
+//	db.begin()
+//	let r = attempt(fn() { db <=!=> ["UPDATE stock SET n = n - 1 WHERE id = ?", [id]] })
+//	if (r.error) { db.rollback() } else { db.commit() }
+//	db.commit()
+//
+// db.transaction(fn) does the same around a function, rolling back if it
+// fails. Transactions still open when the script ends, including when it
+// stops with an error, are rolled back.
+
+// dbQuerier runs queries on a database or in a transaction
+type dbQuerier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// querier returns the connection's transaction, if one is open, or else its
+// database
+func (dbc *DBConnection) querier() dbQuerier {
+	if dbc.Tx != nil {
+		return dbc.Tx
+	}
+	return dbc.DB
+}
+
+// stmt returns a prepared statement to run in the connection's
+// transaction, if one is open
+func (dbc *DBConnection) stmt(stmt *sql.Stmt) *sql.Stmt {
+	if dbc.Tx != nil {
+		return dbc.Tx.Stmt(stmt)
+	}
+	return stmt
+}
+
+// savepointName names the savepoint for a nesting depth
+func savepointName(depth int) string {
+	return fmt.Sprintf("parsley_sp_%d", depth)
+}
+
+// beginTransaction starts a transaction, or a savepoint inside the open one
+func beginTransaction(conn *DBConnection, env *Environment) *Error {
+	if conn.Tx != nil {
+		conn.savepoints++
+		if _, err := conn.Tx.Exec("SAVEPOINT " + savepointName(conn.savepoints)); err != nil {
+			conn.savepoints--
+			conn.LastError = err.Error()
+			return newError("failed to start savepoint: %s", err.Error())
+		}
+		return nil
+	}
+
+	tx, err := conn.DB.Begin()
+	if err != nil {
+		conn.LastError = err.Error()
+		return newError("failed to begin transaction: %s", err.Error())
+	}
+	conn.Tx = tx
+	conn.InTransaction = true
+	trackTransaction(conn, env)
+	return nil
+}
+
+// endTransaction commits or rolls back the innermost savepoint, or the
+// transaction once there are none
+func endTransaction(conn *DBConnection, commit bool) *Error {
+	if conn.Tx == nil {
+		return newError("no transaction in progress")
+	}
+
+	if conn.savepoints > 0 {
+		name := savepointName(conn.savepoints)
+		conn.savepoints--
+		if !commit {
+			if _, err := conn.Tx.Exec("ROLLBACK TO SAVEPOINT " + name); err != nil {
+				conn.LastError = err.Error()
+				return newError("failed to roll back savepoint: %s", err.Error())
+			}
+		}
+		if _, err := conn.Tx.Exec("RELEASE SAVEPOINT " + name); err != nil {
+			conn.LastError = err.Error()
+			return newError("failed to release savepoint: %s", err.Error())
+		}
+		return nil
+	}
+
+	tx := conn.Tx
+	conn.Tx = nil
+	conn.InTransaction = false
+	if commit {
+		if err := tx.Commit(); err != nil {
+			conn.LastError = err.Error()
+			return newError("failed to commit transaction: %s", err.Error())
+		}
+		return nil
+	}
+	if err := tx.Rollback(); err != nil {
+		conn.LastError = err.Error()
+		return newError("failed to roll back transaction: %s", err.Error())
+	}
+	return nil
+}
+
+// evalTransaction implements db.transaction(fn), which runs fn in a
+// transaction (or a savepoint, inside one) and commits if it succeeds
+func evalTransaction(conn *DBConnection, args []Object, env *Environment) Object {
+	if len(args) != 1 {
+		return newError("transaction() takes 1 argument, got=%d", len(args))
+	}
+	switch fn := args[0].(type) {
+	case *Function:
+		if fn.ParamCount() > 1 {
+			return newError("function passed to transaction() must take 0 or 1 parameters, got %d", fn.ParamCount())
+		}
+	case *Builtin:
+	default:
+		return newError("transaction() argument must be a function, got %s", args[0].Type())
+	}
+
+	if errObj := beginTransaction(conn, env); errObj != nil {
+		return errObj
+	}
+	var callArgs []Object
+	if fn, ok := args[0].(*Function); ok && fn.ParamCount() == 1 {
+		callArgs = []Object{conn}
+	}
+	result := applyFunctionWithEnv(args[0], callArgs, env)
+	if result == nil {
+		result = NULL
+	}
+	if isError(result) {
+		endTransaction(conn, false)
+		return result
+	}
+	if errObj := endTransaction(conn, true); errObj != nil {
+		return errObj
+	}
+	return result
+}
+
+// trackTransaction records a transaction on the script's outermost
+// environment, so it can be rolled back if the script ends with it open
+func trackTransaction(conn *DBConnection, env *Environment) {
+	root := env
+	for root.outer != nil {
+		root = root.outer
+	}
+	for _, c := range root.transactions {
+		if c == conn {
+			return
+		}
+	}
+	root.transactions = append(root.transactions, conn)
+}
+
+// EndScript rolls back the transactions a script left open. Hosts call it
+// with the script's environment once it has finished.
+func EndScript(env *Environment) {
+	rollbackOpenTransactions(env)
+}
+
+// rollbackOpenTransactions rolls back the transactions a script left open
+func rollbackOpenTransactions(env *Environment) {
+	for _, conn := range env.transactions {
+		if conn.Tx != nil {
+			conn.savepoints = 0
+			endTransaction(conn, false)
+		}
+	}
+	env.transactions = nil
+}
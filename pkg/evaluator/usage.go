@@ -0,0 +1,127 @@
+package evaluator
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Usage counts the work a run does outside the evaluator: files, HTTP
+// requests, SQL statements and commands. Nothing is sent anywhere; pars
+// --summary prints the counts at the end of a run.
+type Usage struct {
+	FilesRead    int64
+	BytesRead    int64
+	FilesWritten int64
+	BytesWritten int64
+	// BytesOutput is what was written to stdout and stderr with ==>
+	BytesOutput  int64
+	HTTPRequests int64
+	HTTPBytes    int64 // Response bytes received
+	HTTPTime     time.Duration
+	SQLQueries   int64
+	SQLTime      time.Duration
+	Commands     int64
+	CommandTime  time.Duration
+}
+
+var (
+	usageMu sync.Mutex
+	usage   Usage
+)
+
+// CurrentUsage returns the counts since the process started or ResetUsage
+// was called
+func CurrentUsage() Usage {
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	return usage
+}
+
+// ResetUsage sets the usage counts back to zero, e.g. between runs in watch
+// mode
+func ResetUsage() {
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	usage = Usage{}
+}
+
+// recordUsage updates the usage counts
+func recordUsage(update func(u *Usage)) {
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	update(&usage)
+}
+
+func recordFileRead(n int) {
+	recordUsage(func(u *Usage) {
+		u.FilesRead++
+		u.BytesRead += int64(n)
+	})
+}
+
+func recordFileWrite(n int) {
+	recordUsage(func(u *Usage) {
+		u.FilesWritten++
+		u.BytesWritten += int64(n)
+	})
+}
+
+func recordOutput(n int) {
+	recordUsage(func(u *Usage) { u.BytesOutput += int64(n) })
+}
+
+// recordHTTPRequest records a request that started at start and received n
+// bytes
+func recordHTTPRequest(start time.Time, n int) {
+	elapsed := time.Since(start)
+	recordUsage(func(u *Usage) {
+		u.HTTPRequests++
+		u.HTTPBytes += int64(n)
+		u.HTTPTime += elapsed
+	})
+}
+
+// recordSQLQuery records a statement that started at start
+func recordSQLQuery(start time.Time) {
+	elapsed := time.Since(start)
+	recordUsage(func(u *Usage) {
+		u.SQLQueries++
+		u.SQLTime += elapsed
+	})
+}
+
+// recordCommand records a command that started at start
+func recordCommand(start time.Time) {
+	elapsed := time.Since(start)
+	recordUsage(func(u *Usage) {
+		u.Commands++
+		u.CommandTime += elapsed
+	})
+}
+
+// countingWriter counts the bytes written through it, for writes that stream
+// their data
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += n
+	return n, err
+}
+
+// countingReader counts the bytes read through it, for reads that stream
+// their data
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
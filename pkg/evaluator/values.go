@@ -0,0 +1,541 @@
+package evaluator
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sambeau/parsley/pkg/ast"
+)
+
+// Datetimes, durations, paths and URLs are values of their own. Their fields
+// are plain Go values, so reading d.year doesn't evaluate anything, but they
+// still read like the dictionaries they used to be: d.year, d["year"],
+// let {year, month} = d and d.keys() all work, and d.toDict() returns the
+// fields as a dictionary.
+
+// fieldValue is a value whose fields can be read like dictionary keys
+type fieldValue interface {
+	Object
+	field(key string) (Object, bool)
+	fieldNames() []string
+	literal() string // the value as it's written in Parsley, such as @1h30m
+}
+
+// fieldsToDict returns a dictionary of a value's fields
+func fieldsToDict(v fieldValue, env *Environment) *Dictionary {
+	pairs := make(map[string]ast.Expression)
+	for _, key := range v.fieldNames() {
+		val, _ := v.field(key)
+		pairs[key] = objectToExpression(val)
+	}
+	return &Dictionary{Pairs: pairs, Env: env}
+}
+
+// asDictionary returns obj as a dictionary, converting a fieldValue to a
+// dictionary of its fields
+func asDictionary(obj Object, env *Environment) (*Dictionary, bool) {
+	switch v := obj.(type) {
+	case *Dictionary:
+		return v, true
+	case fieldValue:
+		return fieldsToDict(v, env), true
+	}
+	return nil, false
+}
+
+// evalFieldValueMethod evaluates a method call on a datetime, duration, path
+// or URL. Methods it doesn't have are dictionary methods on its fields.
+func evalFieldValueMethod(v fieldValue, method string, args []Object, env *Environment) Object {
+	var result Object
+	switch v := v.(type) {
+	case *Datetime:
+		result = evalDatetimeMethod(v, method, args, env)
+	case *Duration:
+		result = evalDurationMethod(v, method, args, env)
+	case *Path:
+		result = evalPathMethod(v, method, args, env)
+	case *Url:
+		result = evalUrlMethod(v, method, args, env)
+	}
+	if errObj, ok := result.(*Error); ok && strings.Contains(errObj.Message, "unknown method") {
+		if dictResult := evalDictionaryMethod(fieldsToDict(v, env), method, args, env); dictResult != nil {
+			return dictResult
+		}
+	}
+	return result
+}
+
+// evalFieldValueProperty returns a computed property or field of a datetime,
+// duration, path or URL, or nil if it has none by that name
+func evalFieldValueProperty(v fieldValue, key string, env *Environment) Object {
+	var computed Object
+	switch v := v.(type) {
+	case *Datetime:
+		computed = evalDatetimeComputedProperty(v, key, env)
+	case *Path:
+		computed = evalPathComputedProperty(v, key)
+	case *Url:
+		computed = evalUrlComputedProperty(v, key)
+	}
+	if computed != nil {
+		return computed
+	}
+	if val, ok := v.field(key); ok {
+		return val
+	}
+	// They used to be dictionaries tagged with __type
+	if key == "__type" {
+		return &String{Value: strings.ToLower(string(v.Type()))}
+	}
+	return nil
+}
+
+// stringsToArray returns an array of strings
+func stringsToArray(values []string) *Array {
+	elements := make([]Object, len(values))
+	for i, s := range values {
+		elements[i] = &String{Value: s}
+	}
+	return &Array{Elements: elements}
+}
+
+// ============================================================================
+// Datetime
+// ============================================================================
+
+// Datetime is a date and time (@2024-12-25T14:30:00), a date (@2024-12-25)
+// or a time of day (@14:30)
+type Datetime struct {
+	Time time.Time
+	Kind string // "datetime", "date", "time", or "time_seconds" for a time with seconds
+}
+
+// newDatetime returns a datetime of the given kind
+func newDatetime(t time.Time, kind string) *Datetime {
+	return &Datetime{Time: t, Kind: kind}
+}
+
+func (d *Datetime) Type() ObjectType { return DATETIME_OBJ }
+
+// Inspect returns the datetime in ISO 8601 form, as much of it as its kind has
+func (d *Datetime) Inspect() string {
+	t := d.Time
+	switch d.Kind {
+	case "time":
+		return fmt.Sprintf("%02d:%02d", t.Hour(), t.Minute())
+	case "time_seconds":
+		return fmt.Sprintf("%02d:%02d:%02d", t.Hour(), t.Minute(), t.Second())
+	case "date":
+		return fmt.Sprintf("%04d-%02d-%02d", t.Year(), t.Month(), t.Day())
+	default:
+		return t.Format(time.RFC3339)
+	}
+}
+
+func (d *Datetime) literal() string { return "@" + d.Inspect() }
+
+var datetimeFieldNames = []string{"day", "hour", "iso", "kind", "minute", "month", "second", "unix", "weekday", "year"}
+
+func (d *Datetime) fieldNames() []string { return datetimeFieldNames }
+
+func (d *Datetime) field(key string) (Object, bool) {
+	t := d.Time
+	switch key {
+	case "kind":
+		return &String{Value: d.Kind}, true
+	case "year":
+		return &Integer{Value: int64(t.Year())}, true
+	case "month":
+		return &Integer{Value: int64(t.Month())}, true
+	case "day":
+		return &Integer{Value: int64(t.Day())}, true
+	case "hour":
+		return &Integer{Value: int64(t.Hour())}, true
+	case "minute":
+		return &Integer{Value: int64(t.Minute())}, true
+	case "second":
+		return &Integer{Value: int64(t.Second())}, true
+	case "unix":
+		return &Integer{Value: t.Unix()}, true
+	case "weekday":
+		return &String{Value: t.Weekday().String()}, true
+	case "iso":
+		return &String{Value: t.Format(time.RFC3339)}, true
+	}
+	return nil, false
+}
+
+// ============================================================================
+// Duration
+// ============================================================================
+
+// Duration is a length of time (@1h30m). Months are kept apart from the
+// rest because they have no fixed length.
+type Duration struct {
+	Months int64
+	Millis int64
+}
+
+// newDuration returns a duration of months and milliseconds
+func newDuration(months, millis int64) *Duration {
+	return &Duration{Months: months, Millis: millis}
+}
+
+// goDurationToDuration converts a time.Duration, to the millisecond
+func goDurationToDuration(d time.Duration) *Duration {
+	return newDuration(0, d.Milliseconds())
+}
+
+// Seconds returns the whole seconds in the duration, not counting months
+func (d *Duration) Seconds() int64 { return d.Millis / 1000 }
+
+// toGo converts a duration without months to a time.Duration
+func (d *Duration) toGo() (time.Duration, error) {
+	if d.Months != 0 {
+		return 0, fmt.Errorf("duration has months or years, which have no fixed length")
+	}
+	return time.Duration(d.Millis) * time.Millisecond, nil
+}
+
+func (d *Duration) Type() ObjectType { return DURATION_OBJ }
+
+// Inspect returns the duration in words, such as "1 hour 30 minutes"
+func (d *Duration) Inspect() string {
+	months, seconds, millis := d.Months, d.Millis/1000, d.Millis%1000
+	if months == 0 && seconds == 0 && millis == 0 {
+		return "0 seconds"
+	}
+
+	isNegative := months < 0 || seconds < 0 || millis < 0
+	if months < 0 {
+		months = -months
+	}
+	if seconds < 0 {
+		seconds = -seconds
+	}
+	if millis < 0 {
+		millis = -millis
+	}
+
+	var parts []string
+	add := func(n int64, unit string) {
+		switch {
+		case n == 1:
+			parts = append(parts, "1 "+unit)
+		case n > 1:
+			parts = append(parts, fmt.Sprintf("%d %ss", n, unit))
+		}
+	}
+	add(months/12, "year")
+	add(months%12, "month")
+	add(seconds/86400, "day")
+	add(seconds%86400/3600, "hour")
+	add(seconds%3600/60, "minute")
+	add(seconds%60, "second")
+	add(millis, "millisecond")
+
+	result := strings.Join(parts, " ")
+	if isNegative {
+		return "-" + result
+	}
+	return result
+}
+
+// literal returns the duration as a literal, such as @1h30m
+func (d *Duration) literal() string {
+	months, millis := d.Months, d.Millis
+	sign := ""
+	if months < 0 || millis < 0 {
+		sign = "-"
+		months, millis = -months, -millis
+	}
+
+	var b strings.Builder
+	for _, u := range []struct {
+		n    int64
+		unit string
+	}{
+		{months / 12, "y"}, {months % 12, "mo"},
+		{millis / 86400000, "d"}, {millis % 86400000 / 3600000, "h"},
+		{millis % 3600000 / 60000, "m"}, {millis % 60000 / 1000, "s"},
+		{millis % 1000, "ms"},
+	} {
+		if u.n != 0 {
+			b.WriteString(strconv.FormatInt(u.n, 10) + u.unit)
+		}
+	}
+	if b.Len() == 0 {
+		return "@0s"
+	}
+	return "@" + sign + b.String()
+}
+
+// iso returns the duration in ISO 8601 form (e.g., "P1DT2H30M")
+func (d *Duration) iso() string {
+	months, millis := d.Months, d.Millis
+	if months == 0 && millis == 0 {
+		return "PT0S"
+	}
+
+	sign := ""
+	if months < 0 || millis < 0 {
+		sign = "-"
+		months, millis = -months, -millis
+	}
+	seconds, ms := millis/1000, millis%1000
+
+	var b strings.Builder
+	b.WriteString(sign + "P")
+	if y := months / 12; y > 0 {
+		fmt.Fprintf(&b, "%dY", y)
+	}
+	if m := months % 12; m > 0 {
+		fmt.Fprintf(&b, "%dM", m)
+	}
+	if d := seconds / 86400; d > 0 {
+		fmt.Fprintf(&b, "%dD", d)
+	}
+	seconds %= 86400
+	if seconds > 0 || ms > 0 {
+		b.WriteString("T")
+		if h := seconds / 3600; h > 0 {
+			fmt.Fprintf(&b, "%dH", h)
+		}
+		if m := seconds % 3600 / 60; m > 0 {
+			fmt.Fprintf(&b, "%dM", m)
+		}
+		if s := seconds % 60; ms > 0 {
+			fmt.Fprintf(&b, "%d.%03dS", s, ms)
+		} else if s > 0 {
+			fmt.Fprintf(&b, "%dS", s)
+		}
+	}
+	return b.String()
+}
+
+func (d *Duration) fieldNames() []string {
+	names := []string{"months", "seconds"}
+	if d.Millis%1000 != 0 {
+		names = append(names, "milliseconds")
+	}
+	if d.Months == 0 {
+		names = append(names, "totalSeconds")
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (d *Duration) field(key string) (Object, bool) {
+	switch key {
+	case "months":
+		return &Integer{Value: d.Months}, true
+	case "seconds":
+		return &Integer{Value: d.Seconds()}, true
+	case "totalSeconds":
+		if d.Months == 0 {
+			return &Integer{Value: d.Seconds()}, true
+		}
+	case "milliseconds":
+		if ms := d.Millis % 1000; ms != 0 {
+			return &Integer{Value: ms}, true
+		}
+	}
+	return nil, false
+}
+
+// ============================================================================
+// Path
+// ============================================================================
+
+// Path is a file system path (@./images/logo.png). An absolute path's first
+// component is "" or a volume.
+type Path struct {
+	Components []string
+	Absolute   bool
+	Stdio      string // "stdin", "stdout" or "stderr" for @-, otherwise ""
+}
+
+// newPath returns a path of cleaned components
+func newPath(components []string, isAbsolute bool) *Path {
+	return &Path{Components: components, Absolute: isAbsolute}
+}
+
+// newStdioPath returns the path @- for stdin, stdout or stderr
+func newStdioPath(stream string) *Path {
+	return &Path{Components: []string{"-"}, Stdio: stream}
+}
+
+func (p *Path) Type() ObjectType { return PATH_OBJ }
+
+// Inspect returns the path as a string with forward slashes
+func (p *Path) Inspect() string { return joinPathComponents(p.Components) }
+
+func (p *Path) literal() string { return "@" + p.Inspect() }
+
+// basename returns the path's last component, or "" for an empty path
+func (p *Path) basename() string {
+	if len(p.Components) == 0 {
+		return ""
+	}
+	return p.Components[len(p.Components)-1]
+}
+
+func (p *Path) fieldNames() []string {
+	if p.Stdio != "" {
+		return []string{"absolute", "components", "name", "path"}
+	}
+	return []string{"absolute", "components"}
+}
+
+func (p *Path) field(key string) (Object, bool) {
+	switch key {
+	case "components":
+		return stringsToArray(p.Components), true
+	case "absolute":
+		return nativeBoolToParsBoolean(p.Absolute), true
+	case "path":
+		if p.Stdio != "" {
+			return &String{Value: "-"}, true
+		}
+	case "name":
+		if p.Stdio != "" {
+			return &String{Value: p.Stdio}, true
+		}
+	}
+	return nil, false
+}
+
+// ============================================================================
+// Url
+// ============================================================================
+
+// Url is a URL (@https://example.com/docs?page=2). The path's components
+// start with "" when it begins with a slash.
+type Url struct {
+	Scheme   string
+	Username string
+	Password string
+	Host     string
+	Port     int64 // 0 for the scheme's default
+	Path     []string
+	Query    map[string]string
+	Fragment string
+}
+
+func (u *Url) Type() ObjectType { return URL_OBJ }
+
+// Inspect returns the URL as a string, with its query parameters sorted
+func (u *Url) Inspect() string {
+	var result strings.Builder
+	result.WriteString(u.Scheme + "://")
+	if u.Username != "" {
+		result.WriteString(u.Username)
+		if u.Password != "" {
+			result.WriteString(":" + u.Password)
+		}
+		result.WriteString("@")
+	}
+	result.WriteString(u.hostPort())
+	result.WriteString(u.pathname())
+	result.WriteString(u.search())
+	if u.Fragment != "" {
+		result.WriteString("#" + u.Fragment)
+	}
+	return result.String()
+}
+
+func (u *Url) literal() string { return "@" + u.Inspect() }
+
+// hostPort returns host[:port]
+func (u *Url) hostPort() string {
+	if u.Port != 0 {
+		return u.Host + ":" + strconv.FormatInt(u.Port, 10)
+	}
+	return u.Host
+}
+
+// origin returns scheme://host[:port]
+func (u *Url) origin() string {
+	return u.Scheme + "://" + u.hostPort()
+}
+
+// pathname returns the URL's path, "" if it has none
+func (u *Url) pathname() string {
+	var parts []string
+	for _, part := range u.Path {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(u.Path) == 0 {
+		return ""
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+// requestString returns the URL a request is sent to, without credentials
+// or fragment
+func (u *Url) requestString() string {
+	return u.origin() + u.pathname() + u.search()
+}
+
+// queryKeys returns the query parameter names, sorted
+func (u *Url) queryKeys() []string {
+	keys := make([]string, 0, len(u.Query))
+	for key := range u.Query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// search returns the query string with a leading ?, or "" if there is none
+func (u *Url) search() string {
+	if len(u.Query) == 0 {
+		return ""
+	}
+	parts := make([]string, len(u.Query))
+	for i, key := range u.queryKeys() {
+		parts[i] = key + "=" + u.Query[key]
+	}
+	return "?" + strings.Join(parts, "&")
+}
+
+var urlFieldNames = []string{"fragment", "host", "password", "path", "port", "query", "scheme", "username"}
+
+func (u *Url) fieldNames() []string { return urlFieldNames }
+
+func (u *Url) field(key string) (Object, bool) {
+	optional := func(s string) Object {
+		if s == "" {
+			return NULL
+		}
+		return &String{Value: s}
+	}
+	switch key {
+	case "scheme":
+		return &String{Value: u.Scheme}, true
+	case "host":
+		return &String{Value: u.Host}, true
+	case "port":
+		return &Integer{Value: u.Port}, true
+	case "path":
+		return stringsToArray(u.Path), true
+	case "query":
+		pairs := make(map[string]ast.Expression, len(u.Query))
+		for k, v := range u.Query {
+			pairs[k] = objectToExpression(&String{Value: v})
+		}
+		return &Dictionary{Pairs: pairs}, true
+	case "username":
+		return optional(u.Username), true
+	case "password":
+		return optional(u.Password), true
+	case "fragment":
+		return optional(u.Fragment), true
+	}
+	return nil, false
+}
@@ -0,0 +1,224 @@
+package evaluator
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// walk() goes through a directory tree reading one directory at a time, so
+// large trees are never loaded whole:
+//
+//	for (f in walk(@./content)) { f.name }
+//	walk(@./site, {maxDepth: 2}, fn(entry) {
+//	    if (entry.name == "node_modules") { "skip" } else { entry.path }
+//	})
+//
+// Without a function walk() returns an iterator of file and directory
+// handles, each directory before its contents. With one it calls the
+// function for each entry, which can take the depth as a second argument,
+// and returns its results as for does; returning "skip" from a directory
+// keeps walk() out of it. Symlinked directories are listed but only entered
+// with followSymlinks, and never twice on the same branch. Directories the
+// security policy doesn't let the script read are left out.
+
+// walkOptions holds the options for walk()
+type walkOptions struct {
+	maxDepth       int // 0 for no limit
+	followSymlinks bool
+}
+
+// evalWalk implements walk(dir, options?, fn?)
+func evalWalk(args []Object, env *Environment) Object {
+	if len(args) < 1 || len(args) > 3 {
+		return newError("wrong number of arguments to `walk`. got=%d, want=1 to 3", len(args))
+	}
+
+	var root string
+	switch arg := args[0].(type) {
+	case *Path:
+		root = arg.Inspect()
+	case *Dictionary:
+		if !isDirDict(arg) {
+			return newError("first argument to `walk` must be a path or directory, got dictionary")
+		}
+		root = getFilePathString(arg, env)
+	case *String:
+		root = arg.Value
+	default:
+		return newError("first argument to `walk` must be a path or directory, got %s", args[0].Type())
+	}
+	root = ExpandHome(root)
+
+	var opts walkOptions
+	var fn Object
+	for _, arg := range args[1:] {
+		switch a := arg.(type) {
+		case *Dictionary:
+			if fn != nil {
+				return newError("options for `walk` must come before the function")
+			}
+			if errObj := parseWalkOptions(a, &opts); errObj != nil {
+				return errObj
+			}
+		case *Function:
+			if paramCount := a.ParamCount(); paramCount != 1 && paramCount != 2 {
+				return newError("function passed to `walk` must take 1 or 2 parameters, got %d", paramCount)
+			}
+			fn = a
+		case *Builtin:
+			fn = a
+		default:
+			return newError("arguments to `walk` after the directory must be options or a function, got %s", arg.Type())
+		}
+	}
+
+	if err := env.checkPathAccess(root, "read"); err != nil {
+		return newError("security: %s", err.Error())
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return newError("failed to read directory '%s': %s", root, err.Error())
+	}
+	if !info.IsDir() {
+		return newError("first argument to `walk` must be a directory, got file '%s'", root)
+	}
+
+	w := &walker{opts: opts, env: env}
+	if fn == nil {
+		return &Iterator{each: func(visit func(Object) Object) Object {
+			return w.walkDir(root, 1, nil, func(entry Object, depth int) (Object, bool) {
+				return visit(entry), true
+			})
+		}}
+	}
+
+	results := []Object{}
+	errObj := w.walkDir(root, 1, nil, func(entry Object, depth int) (Object, bool) {
+		args := []Object{entry}
+		if f, ok := fn.(*Function); ok && f.ParamCount() == 2 {
+			args = append(args, &Integer{Value: int64(depth)})
+		}
+		result := applyFunctionWithEnv(fn, args, env)
+		if isError(result) {
+			return result, false
+		}
+		if str, ok := result.(*String); ok && str.Value == "skip" {
+			return nil, false
+		}
+		if result != nil && result != NULL {
+			results = append(results, result)
+		}
+		return nil, true
+	})
+	if errObj != nil {
+		return errObj
+	}
+	return &Array{Elements: results}
+}
+
+// parseWalkOptions reads the options dictionary passed to walk()
+func parseWalkOptions(dict *Dictionary, opts *walkOptions) *Error {
+	if expr, ok := dict.Pairs["maxDepth"]; ok {
+		n, ok := Eval(expr, dict.Env).(*Integer)
+		if !ok || n.Value < 1 {
+			return newError("`maxDepth` option for `walk` must be a positive integer")
+		}
+		opts.maxDepth = int(n.Value)
+	}
+	if expr, ok := dict.Pairs["followSymlinks"]; ok {
+		b, ok := Eval(expr, dict.Env).(*Boolean)
+		if !ok {
+			return newError("`followSymlinks` option for `walk` must be a boolean")
+		}
+		opts.followSymlinks = b.Value
+	}
+	return nil
+}
+
+// walker goes through a directory tree for walk()
+type walker struct {
+	opts walkOptions
+	env  *Environment
+}
+
+// walkDir visits the entries of a directory at depth, then the contents of
+// each subdirectory visit allows into. visit returns a non-nil object to
+// stop the walk. ancestors holds the real paths of the directories above,
+// to avoid symlink loops.
+func (w *walker) walkDir(dirPath string, depth int, ancestors []string, visit func(entry Object, depth int) (Object, bool)) Object {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return newError("failed to read directory '%s': %s", dirPath, err.Error())
+	}
+	if realPath, ok := realDirPath(dirPath); ok {
+		ancestors = append(ancestors, realPath)
+	}
+
+	for _, entry := range entries {
+		entryPath := filepath.Join(dirPath, entry.Name())
+		info, err := os.Stat(entryPath)
+		if err != nil {
+			// A broken symlink is still an entry
+			info, err = os.Lstat(entryPath)
+			if err != nil {
+				continue
+			}
+		}
+		isDir := info.IsDir()
+		if isDir && w.env.checkPathAccess(entryPath, "read") != nil {
+			continue
+		}
+
+		components, isAbsolute := parsePathString(entryPath)
+		path := newPath(components, isAbsolute)
+		var handle *Dictionary
+		if isDir {
+			handle = dirToDict(path, w.env)
+		} else {
+			handle = fileToDict(path, inferFormatFromExtension(entryPath), nil, w.env)
+		}
+
+		stop, descend := visit(handle, depth)
+		if stop != nil {
+			return stop
+		}
+		if !isDir || !descend || (w.opts.maxDepth > 0 && depth >= w.opts.maxDepth) {
+			continue
+		}
+		if entry.Type()&os.ModeSymlink != 0 {
+			if !w.opts.followSymlinks || w.onBranch(entryPath, ancestors) {
+				continue
+			}
+		}
+		if stop := w.walkDir(entryPath, depth+1, ancestors, visit); stop != nil {
+			return stop
+		}
+	}
+	return nil
+}
+
+// onBranch reports whether entering a symlinked directory would lead back
+// to one of the directories above it
+func (w *walker) onBranch(dirPath string, ancestors []string) bool {
+	realPath, ok := realDirPath(dirPath)
+	if !ok {
+		return true
+	}
+	for _, ancestor := range ancestors {
+		if pathWithin(ancestor, realPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// realDirPath returns the absolute path of a directory with symlinks
+// resolved
+func realDirPath(dirPath string) (string, bool) {
+	realPath, err := filepath.EvalSymlinks(dirPath)
+	if err != nil {
+		return "", false
+	}
+	realPath, err = filepath.Abs(realPath)
+	return realPath, err == nil
+}
@@ -0,0 +1,374 @@
+package evaluator
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// XML(path) handles read a document as a dictionary with the root element
+// as its one key:
+//
+//	<feed><title>News</title><entry id="1">First</entry><entry id="2">Second</entry></feed>
+//
+// reads as
+//
+//	{feed: {title: "News", entry: [{attrs: {id: "1"}, text: "First"}, {attrs: {id: "2"}, text: "Second"}]}}
+//
+// An element with only text is a string. Otherwise it's a dictionary of its
+// children, with its attributes as a dictionary under attrs and its text
+// under text (the attrsKey and textKey options rename them). A child that
+// appears more than once is an array; the arrays option makes the named
+// elements arrays even when there's only one. Names keep their namespace
+// prefixes (atom:link) and namespace declarations are attributes like any
+// other (xmlns, xmlns:atom). Writing reverses this, with children in key
+// order.
+
+// xmlOptions holds the options of XML handles
+type xmlOptions struct {
+	attrsKey string
+	textKey  string
+	arrays   map[string]bool // Elements that are always read as arrays
+	root     string          // Root element to write the value as, instead of its one key
+	indent   int
+}
+
+// defaultXMLOptions returns the options XML handles use unless told otherwise
+func defaultXMLOptions() xmlOptions {
+	return xmlOptions{attrsKey: "attrs", textKey: "text", indent: 2}
+}
+
+// parseXMLOptions reads XML options from a dictionary on top of the defaults
+func parseXMLOptions(dict *Dictionary) (xmlOptions, *Error) {
+	opts := defaultXMLOptions()
+	if dict == nil {
+		return opts, nil
+	}
+	for key, expr := range dict.Pairs {
+		val := Eval(expr, dict.Env)
+		switch key {
+		case "attrsKey", "textKey", "root":
+			str, ok := val.(*String)
+			if !ok || str.Value == "" {
+				return opts, newError("XML option `%s` must be a non-empty string", key)
+			}
+			switch key {
+			case "attrsKey":
+				opts.attrsKey = str.Value
+			case "textKey":
+				opts.textKey = str.Value
+			case "root":
+				if !isXMLName(str.Value) {
+					return opts, newError("XML option `root` must be an element name, got %q", str.Value)
+				}
+				opts.root = str.Value
+			}
+		case "arrays":
+			arr, ok := val.(*Array)
+			if !ok {
+				return opts, newError("XML option `arrays` must be an array of element names, got %s", val.Type())
+			}
+			opts.arrays = make(map[string]bool)
+			for _, elem := range arr.Elements {
+				str, ok := elem.(*String)
+				if !ok {
+					return opts, newError("XML option `arrays` must be an array of element names, got %s", elem.Type())
+				}
+				opts.arrays[str.Value] = true
+			}
+		case "indent":
+			n, ok := val.(*Integer)
+			if !ok || n.Value < 0 || n.Value > 9 {
+				return opts, newError("XML option `indent` must be an integer between 0 and 9")
+			}
+			opts.indent = int(n.Value)
+		}
+	}
+	return opts, nil
+}
+
+// xmlElement collects an element's content while it's being parsed
+type xmlElement struct {
+	name     string
+	attrs    map[string]Object
+	children map[string][]Object
+	order    []string // Child names in the order they first appeared
+	text     strings.Builder
+}
+
+// parseXML parses an XML document into a dictionary with the root element as
+// its one key. Names are read raw, with their prefixes, so the document can
+// be written back with the same namespaces.
+func parseXML(data []byte, opts xmlOptions) (Object, *Error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		// Documents are decoded to UTF-8 by the handle's encoding option
+		return input, nil
+	}
+
+	var stack []*xmlElement
+	var root Object
+	for {
+		tok, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, newError("failed to parse XML: %s", err.Error())
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if root != nil {
+				return nil, newError("failed to parse XML: more than one root element")
+			}
+			elem := &xmlElement{name: xmlName(t.Name), attrs: make(map[string]Object), children: make(map[string][]Object)}
+			for _, attr := range t.Attr {
+				elem.attrs[xmlName(attr.Name)] = &String{Value: attr.Value}
+			}
+			stack = append(stack, elem)
+
+		case xml.EndElement:
+			// Raw tokens aren't checked for matching start and end elements
+			if len(stack) == 0 || stack[len(stack)-1].name != xmlName(t.Name) {
+				return nil, newError("failed to parse XML: unexpected end element </%s>", xmlName(t.Name))
+			}
+			elem := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			value := elem.value(opts)
+			if len(stack) == 0 {
+				root = NewDictionaryFromObjects(map[string]Object{elem.name: value})
+				continue
+			}
+			parent := stack[len(stack)-1]
+			if _, seen := parent.children[elem.name]; !seen {
+				parent.order = append(parent.order, elem.name)
+			}
+			parent.children[elem.name] = append(parent.children[elem.name], value)
+
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			} else if len(bytes.TrimSpace(t)) > 0 {
+				return nil, newError("failed to parse XML: text outside the root element")
+			}
+		}
+	}
+
+	if len(stack) > 0 {
+		return nil, newError("failed to parse XML: element <%s> is not closed", stack[len(stack)-1].name)
+	}
+	if root == nil {
+		return nil, newError("failed to parse XML: no root element")
+	}
+	return root, nil
+}
+
+// xmlName returns a raw name as written, with its prefix
+func xmlName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+// value returns a parsed element as a string, or a dictionary if it has
+// attributes or children
+func (elem *xmlElement) value(opts xmlOptions) Object {
+	text := strings.TrimSpace(elem.text.String())
+	if len(elem.attrs) == 0 && len(elem.children) == 0 {
+		return &String{Value: text}
+	}
+
+	pairs := make(map[string]Object)
+	if len(elem.attrs) > 0 {
+		pairs[opts.attrsKey] = NewDictionaryFromObjects(elem.attrs)
+	}
+	for _, name := range elem.order {
+		values := elem.children[name]
+		if len(values) == 1 && !opts.arrays[name] {
+			pairs[name] = values[0]
+		} else {
+			pairs[name] = &Array{Elements: values}
+		}
+	}
+	if text != "" {
+		pairs[opts.textKey] = &String{Value: text}
+	}
+	return NewDictionaryFromObjects(pairs)
+}
+
+// encodeXML encodes a dictionary with one key, the root element, as an XML
+// document, or any value as the content of the root option's element
+func encodeXML(value Object, opts xmlOptions) ([]byte, error) {
+	root, content := opts.root, objectToGo(value)
+	if root == "" {
+		dict, ok := content.(map[string]interface{})
+		if !ok || len(dict) != 1 {
+			return nil, fmt.Errorf("XML format requires a dictionary with one key, the root element, or the `root` option")
+		}
+		for name, v := range dict {
+			root, content = name, v
+		}
+	}
+	if _, isArray := content.([]interface{}); isArray {
+		return nil, fmt.Errorf("XML root element %s cannot be an array", root)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	if err := writeXMLElement(&buf, root, content, 0, opts); err != nil {
+		return nil, err
+	}
+	if opts.indent == 0 {
+		buf.WriteString("\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// writeXMLElement writes an element, or one for each element of an array
+func writeXMLElement(buf *bytes.Buffer, name string, value interface{}, depth int, opts xmlOptions) error {
+	if !isXMLName(name) {
+		return fmt.Errorf("cannot write %q as an XML element name", name)
+	}
+
+	if arr, ok := value.([]interface{}); ok {
+		for _, elem := range arr {
+			if _, nested := elem.([]interface{}); nested {
+				return fmt.Errorf("XML element %s cannot contain an array directly", name)
+			}
+			if err := writeXMLElement(buf, name, elem, depth, opts); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	pad := ""
+	if opts.indent > 0 {
+		pad = strings.Repeat(" ", depth*opts.indent)
+	}
+	buf.WriteString(pad + "<" + name)
+
+	dict, isDict := value.(map[string]interface{})
+	if !isDict {
+		if value == nil {
+			buf.WriteString("/>")
+		} else {
+			buf.WriteString(">")
+			xml.EscapeText(buf, []byte(fmt.Sprint(value)))
+			buf.WriteString("</" + name + ">")
+		}
+		if opts.indent > 0 {
+			buf.WriteString("\n")
+		}
+		return nil
+	}
+
+	var attrs map[string]interface{}
+	var children []string
+	text, hasText := "", false
+	for key, v := range dict {
+		switch key {
+		case opts.textKey:
+			var err error
+			if text, err = xmlScalar(key, v); err != nil {
+				return err
+			}
+			hasText = true
+		case opts.attrsKey:
+			var ok bool
+			if attrs, ok = v.(map[string]interface{}); !ok && v != nil {
+				return fmt.Errorf("XML %s of %s must be a dictionary", key, name)
+			}
+		default:
+			children = append(children, key)
+		}
+	}
+	sort.Strings(children)
+
+	attrNames := make([]string, 0, len(attrs))
+	for attrName := range attrs {
+		attrNames = append(attrNames, attrName)
+	}
+	sort.Strings(attrNames)
+	for _, attrName := range attrNames {
+		if !isXMLName(attrName) {
+			return fmt.Errorf("cannot write %q as an XML attribute name", attrName)
+		}
+		attrValue, err := xmlScalar("attribute "+attrName, attrs[attrName])
+		if err != nil {
+			return err
+		}
+		buf.WriteString(" " + attrName + `="`)
+		xml.EscapeText(buf, []byte(attrValue))
+		buf.WriteString(`"`)
+	}
+
+	switch {
+	case len(children) == 0 && !hasText:
+		buf.WriteString("/>")
+	case len(children) == 0:
+		buf.WriteString(">")
+		xml.EscapeText(buf, []byte(text))
+		buf.WriteString("</" + name + ">")
+	default:
+		buf.WriteString(">")
+		if opts.indent > 0 {
+			buf.WriteString("\n")
+		}
+		if hasText {
+			if opts.indent > 0 {
+				buf.WriteString(strings.Repeat(" ", (depth+1)*opts.indent))
+			}
+			xml.EscapeText(buf, []byte(text))
+			if opts.indent > 0 {
+				buf.WriteString("\n")
+			}
+		}
+		for _, key := range children {
+			if err := writeXMLElement(buf, key, dict[key], depth+1, opts); err != nil {
+				return err
+			}
+		}
+		buf.WriteString(pad + "</" + name + ">")
+	}
+	if opts.indent > 0 {
+		buf.WriteString("\n")
+	}
+	return nil
+}
+
+// xmlScalar returns the text of a value written as element text or an
+// attribute, which can't be a dictionary or array
+func xmlScalar(key string, value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case map[string]interface{}, []interface{}:
+		return "", fmt.Errorf("XML %s must be text, not a dictionary or array", key)
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+// isXMLName reports whether name can be used as an element or attribute name
+func isXMLName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_' || r == ':' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r > 0x7F:
+		case i > 0 && (r == '-' || r == '.' || r >= '0' && r <= '9'):
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,68 @@
+// Package filelock provides advisory, cross-process file locks for Parsley
+// Locks are held on a lock file (created if missing) and are released when
+// Unlock is called or the process exits.
+package filelock
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// ErrTimeout is returned when a lock could not be acquired before the timeout
+var ErrTimeout = errors.New("timed out waiting for lock")
+
+// pollInterval is how often a non-blocking lock attempt is retried while waiting
+const pollInterval = 50 * time.Millisecond
+
+// Lock is an exclusive lock held on a file
+type Lock struct {
+	file *os.File
+}
+
+// Acquire takes an exclusive lock on path, creating the file if needed.
+// A zero timeout waits indefinitely; a negative timeout tries exactly once.
+func Acquire(path string, timeout time.Duration) (*Lock, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if timeout == 0 {
+		if err := lockFile(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &Lock{file: f}, nil
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if locked {
+			return &Lock{file: f}, nil
+		}
+		if timeout < 0 || time.Now().After(deadline) {
+			f.Close()
+			return nil, ErrTimeout
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// Unlock releases the lock. The lock file itself is left in place.
+func (l *Lock) Unlock() error {
+	if l.file == nil {
+		return nil
+	}
+	err := unlockFile(l.file)
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	l.file = nil
+	return err
+}
@@ -0,0 +1,22 @@
+//go:build !unix
+
+package filelock
+
+import (
+	"errors"
+	"os"
+)
+
+var errUnsupported = errors.New("file locking is not supported on this platform")
+
+func lockFile(f *os.File) error {
+	return errUnsupported
+}
+
+func tryLockFile(f *os.File) (bool, error) {
+	return false, errUnsupported
+}
+
+func unlockFile(f *os.File) error {
+	return errUnsupported
+}
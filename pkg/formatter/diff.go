@@ -0,0 +1,162 @@
+package formatter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxDiffCells limits the size of the table DiffLines builds for the changed
+// middle of the input; bigger changes are shown as a block replacement
+const maxDiffCells = 4_000_000
+
+// diffLine is one line of a diff: ' ' kept, '-' removed or '+' added
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// DiffLines returns a concise line diff between two outputs: hunks headed by
+// the line numbers they cover, with context unchanged lines around each
+// change. It returns "" if the outputs are the same.
+//
+//	@@ -12,3 +12,3 @@
+//	   <li>a</li>
+//	-  <li>b</li>
+//	+  <li>c</li>
+func DiffLines(old, new string, context int) string {
+	if old == new {
+		return ""
+	}
+	a, b := splitLines(old), splitLines(new)
+
+	// Trim the common prefix and suffix, so only the changed middle is
+	// compared line by line
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var lines []diffLine
+	for _, s := range a[:prefix] {
+		lines = append(lines, diffLine{' ', s})
+	}
+	lines = append(lines, diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, s := range a[len(a)-suffix:] {
+		lines = append(lines, diffLine{' ', s})
+	}
+
+	return formatHunks(lines, context)
+}
+
+// splitLines splits s into lines, ignoring a trailing newline
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffMiddle diffs two runs of lines using their longest common subsequence
+func diffMiddle(a, b []string) []diffLine {
+	var lines []diffLine
+	if len(a)*len(b) > maxDiffCells {
+		for _, s := range a {
+			lines = append(lines, diffLine{'-', s})
+		}
+		for _, s := range b {
+			lines = append(lines, diffLine{'+', s})
+		}
+		return lines
+	}
+
+	// lcs[i][j] is the length of the LCS of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	return lines
+}
+
+// formatHunks writes the changed lines of a diff with context lines around
+// them, grouping nearby changes into one hunk
+func formatHunks(lines []diffLine, context int) string {
+	var out strings.Builder
+	for start := 0; start < len(lines); {
+		// Find the next change
+		first := start
+		for first < len(lines) && lines[first].op == ' ' {
+			first++
+		}
+		if first == len(lines) {
+			break
+		}
+
+		// Extend the hunk while changes are within 2*context lines of each other
+		last := first
+		for k := first; k < len(lines); k++ {
+			if lines[k].op != ' ' {
+				last = k
+			} else if k-last > 2*context {
+				break
+			}
+		}
+		from := max(first-context, start)
+		to := min(last+context+1, len(lines))
+
+		// Line numbers in the old and new outputs where the hunk starts
+		oldLine, newLine := 1, 1
+		for _, l := range lines[:from] {
+			if l.op != '+' {
+				oldLine++
+			}
+			if l.op != '-' {
+				newLine++
+			}
+		}
+		oldCount, newCount := 0, 0
+		for _, l := range lines[from:to] {
+			if l.op != '+' {
+				oldCount++
+			}
+			if l.op != '-' {
+				newCount++
+			}
+		}
+
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", oldLine, oldCount, newLine, newCount)
+		for _, l := range lines[from:to] {
+			fmt.Fprintf(&out, "%c  %s\n", l.op, l.text)
+		}
+		start = to
+	}
+	return out.String()
+}
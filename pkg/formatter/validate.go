@@ -0,0 +1,184 @@
+package formatter
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Problem is a well-formedness problem found by ValidateHTML
+type Problem struct {
+	// Line is the 1-based line of the input the problem was found on
+	Line    int
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("line %d: %s", p.Line, p.Message)
+}
+
+// openElement is an element ValidateHTML has seen the start tag of
+type openElement struct {
+	name string
+	line int
+}
+
+// ValidateHTML checks generated HTML for the mistakes browsers silently
+// repair: unclosed and stray tags, duplicate ids and invalid nesting such as
+// a <div> inside a <p>. It returns the problems in the order they occur.
+//
+// End tags that HTML allows to be left out (</li>, </p>, </td>...) are not
+// required.
+func ValidateHTML(input string) []Problem {
+	var problems []Problem
+	var stack []openElement
+	ids := map[string]int{}
+	line := 1
+
+	report := func(line int, format string, a ...interface{}) {
+		problems = append(problems, Problem{Line: line, Message: fmt.Sprintf(format, a...)})
+	}
+
+	z := html.NewTokenizer(strings.NewReader(input))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		tokenLine := line
+		line += strings.Count(string(z.Raw()), "\n")
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			nameBytes, hasAttr := z.TagName()
+			name := string(nameBytes)
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				if string(key) != "id" {
+					continue
+				}
+				id := string(val)
+				if first, ok := ids[id]; ok {
+					report(tokenLine, "duplicate id %q (first used on line %d)", id, first)
+				} else {
+					ids[id] = tokenLine
+				}
+			}
+
+			// A new list item or table cell ends an unclosed previous one
+			for len(stack) > 0 && closesImplicitly(name, stack[len(stack)-1].name) {
+				stack = stack[:len(stack)-1]
+			}
+			if msg := nestingProblem(stack, name); msg != "" {
+				report(tokenLine, "%s", msg)
+			}
+			if tt == html.StartTagToken && !isVoidElement(name) {
+				stack = append(stack, openElement{name: name, line: tokenLine})
+			}
+
+		case html.EndTagToken:
+			nameBytes, _ := z.TagName()
+			name := string(nameBytes)
+			match := -1
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i].name == name {
+					match = i
+					break
+				}
+			}
+			if match < 0 {
+				if !isVoidElement(name) {
+					report(tokenLine, "unexpected </%s> with no open <%s>", name, name)
+				}
+				break
+			}
+			for _, el := range stack[match+1:] {
+				if !hasOptionalEndTag(el.name) {
+					report(el.line, "<%s> is not closed before </%s> on line %d", el.name, name, tokenLine)
+				}
+			}
+			stack = stack[:match]
+		}
+	}
+
+	for _, el := range stack {
+		if !hasOptionalEndTag(el.name) {
+			report(el.line, "<%s> is never closed", el.name)
+		}
+	}
+	return problems
+}
+
+// nestingProblem describes why a name element can't be opened inside the
+// open elements, or returns ""
+func nestingProblem(stack []openElement, name string) string {
+	if len(stack) == 0 {
+		if name == "li" {
+			return "<li> outside of <ul>, <ol> or <menu>"
+		}
+		return ""
+	}
+	parent := stack[len(stack)-1].name
+
+	if name == "li" && parent != "ul" && parent != "ol" && parent != "menu" && parent != "template" {
+		return fmt.Sprintf("<li> inside <%s>, not <ul>, <ol> or <menu>", parent)
+	}
+	if parent == "p" && closesParagraph(name) {
+		return fmt.Sprintf("<%s> inside <p> (browsers close the <p> first)", name)
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		ancestor := stack[i].name
+		switch {
+		case (name == "a" || name == "button") && (ancestor == "a" || ancestor == "button"):
+			return fmt.Sprintf("<%s> inside <%s> (interactive elements can't be nested)", name, ancestor)
+		case name == "form" && ancestor == "form":
+			return "<form> inside <form>"
+		}
+	}
+	return ""
+}
+
+// closesParagraph returns true for elements that end an open <p>
+func closesParagraph(tag string) bool {
+	blockElements := map[string]bool{
+		"address": true, "article": true, "aside": true, "blockquote": true,
+		"details": true, "dialog": true, "div": true, "dl": true, "fieldset": true,
+		"figcaption": true, "figure": true, "footer": true, "form": true,
+		"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+		"header": true, "hgroup": true, "hr": true, "main": true, "menu": true,
+		"nav": true, "ol": true, "p": true, "pre": true, "section": true,
+		"table": true, "ul": true,
+	}
+	return blockElements[tag]
+}
+
+// closesImplicitly returns true if opening a name element ends an open
+// element whose end tag was left out. An unclosed <p> isn't ended this way,
+// so that a <div> inside one is still reported.
+func closesImplicitly(name, open string) bool {
+	switch name {
+	case "li", "option":
+		return open == name
+	case "dt", "dd":
+		return open == "dt" || open == "dd"
+	case "td", "th":
+		return open == "td" || open == "th"
+	case "tr":
+		return open == "tr" || open == "td" || open == "th"
+	}
+	return false
+}
+
+// hasOptionalEndTag returns true if HTML allows the element's end tag to be
+// left out
+func hasOptionalEndTag(tag string) bool {
+	optionalElements := map[string]bool{
+		"html": true, "head": true, "body": true, "li": true, "dt": true,
+		"dd": true, "p": true, "rt": true, "rp": true, "optgroup": true,
+		"option": true, "colgroup": true, "caption": true, "thead": true,
+		"tbody": true, "tfoot": true, "tr": true, "td": true, "th": true,
+	}
+	return optionalElements[tag]
+}
@@ -0,0 +1,225 @@
+// Package holidays provides public holiday calendars for Parsley
+// Calendars are described by simple rules (fixed dates, nth weekdays and
+// offsets from Easter) stored as JSON, so user-supplied calendars use the
+// same format as the embedded data.
+package holidays
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:embed data/holidays.json
+var embeddedData []byte
+
+// Rule describes how to find a holiday in a given year
+type Rule struct {
+	// Name of the holiday (e.g., "Labor Day")
+	Name string `json:"name"`
+	// Month (1-12) for fixed-date and weekday rules
+	Month int `json:"month,omitempty"`
+	// Day of month for fixed-date rules, or the anchor day for weekday rules
+	Day int `json:"day,omitempty"`
+	// Weekday name for weekday rules (e.g., "monday")
+	Weekday string `json:"weekday,omitempty"`
+	// Nth occurrence of Weekday: 1 = first, 2 = second, -1 = last.
+	// With Day set, counts forwards from (or backwards to) that day instead of the month boundary.
+	Nth int `json:"nth,omitempty"`
+	// Easter is an offset in days from Easter Sunday (e.g., -2 for Good Friday)
+	Easter *int `json:"easter,omitempty"`
+	// From and To restrict the rule to a range of years (inclusive, 0 = unbounded)
+	From int `json:"from,omitempty"`
+	To   int `json:"to,omitempty"`
+}
+
+// Calendar is a named set of holiday rules
+type Calendar struct {
+	Name  string `json:"name"`
+	Rules []Rule `json:"holidays"`
+}
+
+// Holiday is a holiday occurring on a specific date
+type Holiday struct {
+	Name string
+	Date time.Time
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// builtinCalendars holds the embedded calendars keyed by upper-case country code
+var builtinCalendars = mustParseCalendars(embeddedData)
+
+func mustParseCalendars(data []byte) map[string]*Calendar {
+	calendars, err := ParseCalendars(data)
+	if err != nil {
+		panic(fmt.Sprintf("holidays: invalid embedded data: %s", err))
+	}
+	return calendars
+}
+
+// ParseCalendars parses a JSON object mapping country codes to calendars
+func ParseCalendars(data []byte) (map[string]*Calendar, error) {
+	var raw map[string]*Calendar
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	calendars := make(map[string]*Calendar, len(raw))
+	for code, cal := range raw {
+		if err := cal.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", code, err)
+		}
+		calendars[strings.ToUpper(code)] = cal
+	}
+	return calendars, nil
+}
+
+// ParseCalendar parses a single calendar ({"name": ..., "holidays": [...]}) from JSON
+func ParseCalendar(data []byte) (*Calendar, error) {
+	var cal Calendar
+	if err := json.Unmarshal(data, &cal); err != nil {
+		return nil, err
+	}
+	if err := cal.Validate(); err != nil {
+		return nil, err
+	}
+	return &cal, nil
+}
+
+// Lookup returns the embedded calendar for a country code (e.g., "US", "de")
+func Lookup(code string) (*Calendar, bool) {
+	cal, ok := builtinCalendars[strings.ToUpper(code)]
+	return cal, ok
+}
+
+// Countries returns the codes of all embedded calendars, sorted
+func Countries() []string {
+	codes := make([]string, 0, len(builtinCalendars))
+	for code := range builtinCalendars {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// Validate checks that every rule in the calendar can be evaluated
+func (c *Calendar) Validate() error {
+	if len(c.Rules) == 0 {
+		return fmt.Errorf("calendar has no holidays")
+	}
+	for _, r := range c.Rules {
+		if r.Name == "" {
+			return fmt.Errorf("holiday is missing a name")
+		}
+		if r.Easter != nil {
+			continue
+		}
+		if r.Month < 1 || r.Month > 12 {
+			return fmt.Errorf("%s: month must be between 1 and 12", r.Name)
+		}
+		if r.Weekday == "" {
+			if r.Day < 1 || r.Day > 31 {
+				return fmt.Errorf("%s: day must be between 1 and 31", r.Name)
+			}
+			continue
+		}
+		if _, ok := weekdays[strings.ToLower(r.Weekday)]; !ok {
+			return fmt.Errorf("%s: unknown weekday %q", r.Name, r.Weekday)
+		}
+		if r.Nth == 0 || r.Nth < -5 || r.Nth > 5 {
+			return fmt.Errorf("%s: nth must be between 1 and 5 or -1 and -5", r.Name)
+		}
+	}
+	return nil
+}
+
+// Holidays returns the holidays for a year, sorted by date
+func (c *Calendar) Holidays(year int) []Holiday {
+	var result []Holiday
+	for _, r := range c.Rules {
+		if (r.From != 0 && year < r.From) || (r.To != 0 && year > r.To) {
+			continue
+		}
+		result = append(result, Holiday{Name: r.Name, Date: r.dateIn(year)})
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Date.Before(result[j].Date)
+	})
+	return result
+}
+
+// Find returns the holiday falling on the same calendar day as t, if any
+func (c *Calendar) Find(t time.Time) (Holiday, bool) {
+	for _, h := range c.Holidays(t.Year()) {
+		if h.Date.Month() == t.Month() && h.Date.Day() == t.Day() {
+			return h, true
+		}
+	}
+	return Holiday{}, false
+}
+
+// dateIn computes the rule's date in the given year (UTC midnight)
+func (r Rule) dateIn(year int) time.Time {
+	if r.Easter != nil {
+		return Easter(year).AddDate(0, 0, *r.Easter)
+	}
+
+	month := time.Month(r.Month)
+	if r.Weekday == "" {
+		return time.Date(year, month, r.Day, 0, 0, 0, 0, time.UTC)
+	}
+
+	weekday := weekdays[strings.ToLower(r.Weekday)]
+	if r.Nth > 0 {
+		// Count forwards from the anchor day (default: the 1st)
+		anchor := r.Day
+		if anchor == 0 {
+			anchor = 1
+		}
+		d := time.Date(year, month, anchor, 0, 0, 0, 0, time.UTC)
+		offset := (int(weekday) - int(d.Weekday()) + 7) % 7
+		return d.AddDate(0, 0, offset+(r.Nth-1)*7)
+	}
+
+	// Count backwards from the anchor day (default: the last day of the month)
+	var d time.Time
+	if r.Day != 0 {
+		d = time.Date(year, month, r.Day, 0, 0, 0, 0, time.UTC)
+	} else {
+		d = time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC)
+	}
+	offset := (int(d.Weekday()) - int(weekday) + 7) % 7
+	return d.AddDate(0, 0, -offset+(r.Nth+1)*7)
+}
+
+// Easter returns the date of Western (Gregorian) Easter Sunday for a year
+// using the anonymous Gregorian algorithm (Meeus/Jones/Butcher)
+func Easter(year int) time.Time {
+	a := year % 19
+	b := year / 100
+	c := year % 100
+	d := b / 4
+	e := b % 4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i := c / 4
+	k := c % 4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
@@ -2,6 +2,7 @@ package lexer
 
 import (
 	"fmt"
+	"strings"
 	"unicode"
 	"unicode/utf8"
 )
@@ -81,6 +82,7 @@ const (
 	RBRACKET  // ]
 	PLUSPLUS  // ++
 	RANGE     // ..
+	ARROW     // =>
 
 	// Keywords
 	FUNCTION // "fn"
@@ -229,6 +231,8 @@ func (tt TokenType) String() string {
 		return "PLUSPLUS"
 	case RANGE:
 		return "RANGE"
+	case ARROW:
+		return "ARROW"
 	case FUNCTION:
 		return "FUNCTION"
 	case LET:
@@ -321,6 +325,20 @@ func NewWithFilename(input string, filename string) *Lexer {
 	return l
 }
 
+// NewAt creates a lexer for input that starts at line and column of a larger
+// source, such as an expression cut out of a template, so its tokens have
+// their positions in that source
+func NewAt(input string, line, column int) *Lexer {
+	l := &Lexer{
+		filename: "<input>",
+		input:    input,
+		line:     line,
+		column:   column - 1,
+	}
+	l.readChar()
+	return l
+}
+
 // LexerState holds the state of a lexer for save/restore
 type LexerState struct {
 	position      int
@@ -426,6 +444,10 @@ func (l *Lexer) NextToken() Token {
 			} else {
 				tok = Token{Type: EQ, Literal: string(ch) + string(l.ch), Line: line, Column: col}
 			}
+		} else if l.peekChar() == '>' {
+			ch := l.ch
+			l.readChar()
+			tok = Token{Type: ARROW, Literal: string(ch) + string(l.ch), Line: l.line, Column: l.column - 1}
 		} else {
 			tok = newToken(ASSIGN, l.ch, l.line, l.column)
 		}
@@ -438,7 +460,15 @@ func (l *Lexer) NextToken() Token {
 			tok = newToken(PLUS, l.ch, l.line, l.column)
 		}
 	case '-':
-		tok = newToken(MINUS, l.ch, l.line, l.column)
+		if l.peekChar() == '}' && l.position > 0 && isTrimSpace(l.input[l.position-1]) {
+			// " -}" closes an interpolation that trims the whitespace after it.
+			// A '-' before '}' is never valid otherwise, so it's a plain '}'
+			// outside tag contents.
+			tok = Token{Type: RBRACE, Literal: "-}", Line: l.line, Column: l.column}
+			l.readChar()
+		} else {
+			tok = newToken(MINUS, l.ch, l.line, l.column)
+		}
 	case '!':
 		if l.peekChar() == '=' {
 			ch := l.ch
@@ -689,7 +719,11 @@ func (l *Lexer) NextToken() Token {
 		line := l.line
 		column := l.column
 		tok.Type = STRING
-		tok.Literal = l.readString()
+		if l.peekChar() == '"' && l.peekCharN(2) == '"' {
+			tok.Literal = l.readBlockString()
+		} else {
+			tok.Literal = l.readString()
+		}
 		tok.Line = line
 		tok.Column = column
 	case '`':
@@ -740,7 +774,14 @@ func (l *Lexer) NextToken() Token {
 		tok.Line = l.line
 		tok.Column = l.column
 	default:
-		if isLetter(l.ch) {
+		if l.ch == 'r' && l.peekChar() == '"' {
+			// Raw string: r"..."
+			tok.Type = STRING
+			tok.Line = l.line
+			tok.Column = l.column
+			l.readChar() // skip r
+			tok.Literal = l.readRawString()
+		} else if isLetter(l.ch) {
 			// Save position before reading
 			line := l.line
 			column := l.column
@@ -838,6 +879,48 @@ func (l *Lexer) readString() string {
 	return string(result)
 }
 
+// readRawString reads a raw string (r"..."), which has no escapes: every
+// character up to the closing quote is kept as written
+func (l *Lexer) readRawString() string {
+	l.readChar() // skip opening quote
+	start := l.position
+	for l.ch != '"' && l.ch != 0 {
+		l.readChar()
+	}
+	return l.input[start:l.position]
+}
+
+// readBlockString reads a triple-quoted block string ("""..."""). Like raw
+// strings there are no escapes. A newline straight after the opening quotes
+// is dropped, and if the closing quotes are on a line of their own, that line
+// is dropped and its indentation is removed from every line, so blocks can
+// be indented with the surrounding code.
+func (l *Lexer) readBlockString() string {
+	l.readChar()
+	l.readChar()
+	l.readChar() // skip opening quotes
+	start := l.position
+	for l.ch != 0 && !(l.ch == '"' && l.peekChar() == '"' && l.peekCharN(2) == '"') {
+		l.readChar()
+	}
+	content := l.input[start:l.position]
+	if l.ch != 0 {
+		l.readChar()
+		l.readChar() // leave the last closing quote for NextToken to skip
+	}
+
+	content = strings.TrimPrefix(strings.TrimPrefix(content, "\r"), "\n")
+	if i := strings.LastIndex(content, "\n"); i >= 0 && strings.TrimLeft(content[i+1:], " \t") == "" {
+		indent := content[i+1:]
+		lines := strings.Split(strings.TrimSuffix(content[:i], "\r"), "\n")
+		for j, line := range lines {
+			lines[j] = strings.TrimPrefix(line, indent)
+		}
+		content = strings.Join(lines, "\n")
+	}
+	return content
+}
+
 // readTemplate reads a template literal (backtick string)
 func (l *Lexer) readTemplate() string {
 	var result []byte
@@ -1362,8 +1445,13 @@ func (l *Lexer) nextTagContentToken() Token {
 			tok.Column = column
 			return tok
 		}
-		// Normal mode: interpolation - temporarily exit tag content mode
+		// Normal mode: interpolation - temporarily exit tag content mode.
+		// "{- " opens an interpolation that trims the whitespace before it.
 		tok = newToken(LBRACE, l.ch, l.line, l.column)
+		if l.peekChar() == '-' && isTrimSpace(l.peekCharN(2)) {
+			tok.Literal = "{-"
+			l.readChar()
+		}
 		l.readChar()
 		l.inTagContent = false
 		return tok
@@ -1420,6 +1508,12 @@ func (l *Lexer) readRawTagText() string {
 	return string(result)
 }
 
+// isTrimSpace reports whether ch can follow "{-" or precede "-}" in a
+// whitespace-trimming interpolation
+func isTrimSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
+}
+
 // extractTagName extracts the tag name from tag content (e.g., "div class=\"foo\"" -> "div")
 func extractTagName(tagContent string) string {
 	var name []byte
@@ -1485,8 +1579,11 @@ func (l *Lexer) readRegex() (string, string) {
 	var pattern []byte
 	l.readChar() // skip opening /
 
+	// Verbose (x flag) patterns may span lines; others end at a newline
+	multiline := l.isVerboseRegex()
+
 	// Read pattern until we find unescaped /
-	for l.ch != '/' && l.ch != 0 && l.ch != '\n' {
+	for l.ch != '/' && l.ch != 0 && (l.ch != '\n' || multiline) {
 		if l.ch == '\\' {
 			pattern = append(pattern, l.ch)
 			l.readChar()
@@ -1681,13 +1778,14 @@ func (l *Lexer) readDurationLiteral() string {
 			l.readChar()
 		}
 
-		// Read unit (could be single letter or "mo" for months)
+		// Read unit (could be single letter, "mo" for months or "ms" for
+		// milliseconds)
 		if !isLetter(l.ch) {
 			break
 		}
 
-		// Check for "mo" (months)
-		if l.ch == 'm' && l.peekChar() == 'o' {
+		// Check for "mo" (months) and "ms" (milliseconds)
+		if l.ch == 'm' && (l.peekChar() == 'o' || l.peekChar() == 's') {
 			duration = append(duration, l.ch)
 			l.readChar()
 			duration = append(duration, l.ch)
@@ -1931,6 +2029,25 @@ func (l *Lexer) readUrlLiteral() string {
 	return string(url)
 }
 
+// isVerboseRegex reports whether the regex starting at the current position
+// is closed by a / followed by flags that include x
+func (l *Lexer) isVerboseRegex() bool {
+	for i := l.position; i < len(l.input); i++ {
+		switch l.input[i] {
+		case '\\':
+			i++
+		case '/':
+			for j := i + 1; j < len(l.input) && isLetter(l.input[j]); j++ {
+				if l.input[j] == 'x' {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return false
+}
+
 // shouldTreatAsRegex determines if / should be regex or division
 // Regex context: after operators, keywords, commas, open parens/brackets
 // But NOT after complete expressions like identifiers, numbers, close parens
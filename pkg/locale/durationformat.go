@@ -0,0 +1,374 @@
+// Package locale provides localization support for Parsley
+// This file implements CLDR-based duration (unit) formatting
+package locale
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/feature/plural"
+	"golang.org/x/text/language"
+)
+
+// DurationStyle represents the style of duration formatting
+type DurationStyle string
+
+const (
+	DurationStyleLong   DurationStyle = "long"   // "1 hour, 30 minutes"
+	DurationStyleNarrow DurationStyle = "narrow" // "1h 30m"
+)
+
+// durationUnits lists the units used when breaking a duration into parts,
+// from largest to smallest. Weeks are deliberately omitted to match the
+// way durations are printed elsewhere ("8 days", not "1 week 1 day").
+var durationUnits = []RelativeTimeUnit{UnitYear, UnitMonth, UnitDay, UnitHour, UnitMinute, UnitSecond}
+
+// LocaleDurationUnits holds the unit patterns for a locale
+type LocaleDurationUnits struct {
+	// Long patterns by plural form (e.g., "{0} hour", "{0} hours")
+	Long map[RelativeTimeUnit]map[plural.Form]string
+	// Narrow patterns (e.g., "{0}h")
+	Narrow map[RelativeTimeUnit]string
+	// NarrowSeparator joins narrow parts (long parts use the locale's unit list pattern)
+	NarrowSeparator string
+}
+
+// durationUnitLocales maps locale codes to their duration unit patterns
+var durationUnitLocales = map[string]*LocaleDurationUnits{
+	"en": englishDurationUnits(),
+	"de": germanDurationUnits(),
+	"fr": frenchDurationUnits(),
+	"es": spanishDurationUnits(),
+	"it": italianDurationUnits(),
+	"pt": portugueseDurationUnits(),
+	"nl": dutchDurationUnits(),
+	"ru": russianDurationUnits(),
+	"ja": japaneseDurationUnits(),
+	"zh": chineseDurationUnits(),
+	"ko": koreanDurationUnits(),
+}
+
+// FormatDuration formats months and seconds as a list of localized units
+// style is "long" or "narrow" (defaults to "long")
+// maxUnits limits the output to the largest N non-zero units (0 = no limit)
+// locale is the BCP 47 locale tag (e.g., "en-US", "de-DE")
+func FormatDuration(months, seconds int64, style DurationStyle, maxUnits int, locale string) string {
+	localeData := durationUnitLocales[normalizeLocale(locale)]
+	if localeData == nil {
+		localeData = durationUnitLocales["en"]
+	}
+
+	negative := months < 0 || seconds < 0
+	if months < 0 {
+		months = -months
+	}
+	if seconds < 0 {
+		seconds = -seconds
+	}
+
+	values := map[RelativeTimeUnit]int64{
+		UnitYear:   months / 12,
+		UnitMonth:  months % 12,
+		UnitDay:    seconds / 86400,
+		UnitHour:   (seconds % 86400) / 3600,
+		UnitMinute: (seconds % 3600) / 60,
+		UnitSecond: seconds % 60,
+	}
+
+	var parts []string
+	for _, unit := range durationUnits {
+		if values[unit] == 0 {
+			continue
+		}
+		if maxUnits > 0 && len(parts) >= maxUnits {
+			break
+		}
+		parts = append(parts, formatDurationUnit(values[unit], unit, style, localeData, locale))
+	}
+
+	// Zero durations are shown in the smallest unit ("0 seconds")
+	if len(parts) == 0 {
+		parts = append(parts, formatDurationUnit(0, UnitSecond, style, localeData, locale))
+	}
+
+	var result string
+	if style == DurationStyleNarrow {
+		result = strings.Join(parts, localeData.NarrowSeparator)
+	} else {
+		result = FormatList(parts, ListStyleUnit, locale)
+	}
+
+	if negative {
+		return "-" + result
+	}
+	return result
+}
+
+// formatDurationUnit formats a single value and unit using the locale's patterns
+func formatDurationUnit(value int64, unit RelativeTimeUnit, style DurationStyle, localeData *LocaleDurationUnits, locale string) string {
+	var pattern string
+	if style == DurationStyleNarrow {
+		pattern = localeData.Narrow[unit]
+	} else {
+		forms := localeData.Long[unit]
+		form := plural.Cardinal.MatchPlural(language.Make(locale), int(value), 0, 0, 0, 0)
+		pattern = forms[form]
+		if pattern == "" {
+			pattern = forms[plural.Other]
+		}
+	}
+
+	if pattern == "" {
+		return fmt.Sprintf("%d %s", value, unit)
+	}
+	return strings.Replace(pattern, "{0}", fmt.Sprintf("%d", value), 1)
+}
+
+// ========================================
+// Locale-specific duration unit data
+// Generated from CLDR data
+// ========================================
+
+func englishDurationUnits() *LocaleDurationUnits {
+	return &LocaleDurationUnits{
+		Long: map[RelativeTimeUnit]map[plural.Form]string{
+			UnitYear:   {plural.One: "{0} year", plural.Other: "{0} years"},
+			UnitMonth:  {plural.One: "{0} month", plural.Other: "{0} months"},
+			UnitDay:    {plural.One: "{0} day", plural.Other: "{0} days"},
+			UnitHour:   {plural.One: "{0} hour", plural.Other: "{0} hours"},
+			UnitMinute: {plural.One: "{0} minute", plural.Other: "{0} minutes"},
+			UnitSecond: {plural.One: "{0} second", plural.Other: "{0} seconds"},
+		},
+		// English narrow units follow Parsley's duration literal syntax so that
+		// the output can be fed back into parseDuration() or written as @1h30m
+		Narrow: map[RelativeTimeUnit]string{
+			UnitYear:   "{0}y",
+			UnitMonth:  "{0}mo",
+			UnitDay:    "{0}d",
+			UnitHour:   "{0}h",
+			UnitMinute: "{0}m",
+			UnitSecond: "{0}s",
+		},
+		NarrowSeparator: " ",
+	}
+}
+
+func germanDurationUnits() *LocaleDurationUnits {
+	return &LocaleDurationUnits{
+		Long: map[RelativeTimeUnit]map[plural.Form]string{
+			UnitYear:   {plural.One: "{0} Jahr", plural.Other: "{0} Jahre"},
+			UnitMonth:  {plural.One: "{0} Monat", plural.Other: "{0} Monate"},
+			UnitDay:    {plural.One: "{0} Tag", plural.Other: "{0} Tage"},
+			UnitHour:   {plural.One: "{0} Stunde", plural.Other: "{0} Stunden"},
+			UnitMinute: {plural.One: "{0} Minute", plural.Other: "{0} Minuten"},
+			UnitSecond: {plural.One: "{0} Sekunde", plural.Other: "{0} Sekunden"},
+		},
+		Narrow: map[RelativeTimeUnit]string{
+			UnitYear:   "{0} J",
+			UnitMonth:  "{0} M",
+			UnitDay:    "{0} T",
+			UnitHour:   "{0} Std.",
+			UnitMinute: "{0} Min.",
+			UnitSecond: "{0} Sek.",
+		},
+		NarrowSeparator: " ",
+	}
+}
+
+func frenchDurationUnits() *LocaleDurationUnits {
+	return &LocaleDurationUnits{
+		Long: map[RelativeTimeUnit]map[plural.Form]string{
+			UnitYear:   {plural.One: "{0} an", plural.Other: "{0} ans"},
+			UnitMonth:  {plural.One: "{0} mois", plural.Other: "{0} mois"},
+			UnitDay:    {plural.One: "{0} jour", plural.Other: "{0} jours"},
+			UnitHour:   {plural.One: "{0} heure", plural.Other: "{0} heures"},
+			UnitMinute: {plural.One: "{0} minute", plural.Other: "{0} minutes"},
+			UnitSecond: {plural.One: "{0} seconde", plural.Other: "{0} secondes"},
+		},
+		Narrow: map[RelativeTimeUnit]string{
+			UnitYear:   "{0}a",
+			UnitMonth:  "{0}m.",
+			UnitDay:    "{0}j",
+			UnitHour:   "{0}h",
+			UnitMinute: "{0}min",
+			UnitSecond: "{0}s",
+		},
+		NarrowSeparator: " ",
+	}
+}
+
+func spanishDurationUnits() *LocaleDurationUnits {
+	return &LocaleDurationUnits{
+		Long: map[RelativeTimeUnit]map[plural.Form]string{
+			UnitYear:   {plural.One: "{0} año", plural.Other: "{0} años"},
+			UnitMonth:  {plural.One: "{0} mes", plural.Other: "{0} meses"},
+			UnitDay:    {plural.One: "{0} día", plural.Other: "{0} días"},
+			UnitHour:   {plural.One: "{0} hora", plural.Other: "{0} horas"},
+			UnitMinute: {plural.One: "{0} minuto", plural.Other: "{0} minutos"},
+			UnitSecond: {plural.One: "{0} segundo", plural.Other: "{0} segundos"},
+		},
+		Narrow: map[RelativeTimeUnit]string{
+			UnitYear:   "{0}a",
+			UnitMonth:  "{0}m",
+			UnitDay:    "{0}d",
+			UnitHour:   "{0}h",
+			UnitMinute: "{0}min",
+			UnitSecond: "{0}s",
+		},
+		NarrowSeparator: " ",
+	}
+}
+
+func italianDurationUnits() *LocaleDurationUnits {
+	return &LocaleDurationUnits{
+		Long: map[RelativeTimeUnit]map[plural.Form]string{
+			UnitYear:   {plural.One: "{0} anno", plural.Other: "{0} anni"},
+			UnitMonth:  {plural.One: "{0} mese", plural.Other: "{0} mesi"},
+			UnitDay:    {plural.One: "{0} giorno", plural.Other: "{0} giorni"},
+			UnitHour:   {plural.One: "{0} ora", plural.Other: "{0} ore"},
+			UnitMinute: {plural.One: "{0} minuto", plural.Other: "{0} minuti"},
+			UnitSecond: {plural.One: "{0} secondo", plural.Other: "{0} secondi"},
+		},
+		Narrow: map[RelativeTimeUnit]string{
+			UnitYear:   "{0}a",
+			UnitMonth:  "{0}m",
+			UnitDay:    "{0}g",
+			UnitHour:   "{0}h",
+			UnitMinute: "{0}min",
+			UnitSecond: "{0}s",
+		},
+		NarrowSeparator: " ",
+	}
+}
+
+func portugueseDurationUnits() *LocaleDurationUnits {
+	return &LocaleDurationUnits{
+		Long: map[RelativeTimeUnit]map[plural.Form]string{
+			UnitYear:   {plural.One: "{0} ano", plural.Other: "{0} anos"},
+			UnitMonth:  {plural.One: "{0} mês", plural.Other: "{0} meses"},
+			UnitDay:    {plural.One: "{0} dia", plural.Other: "{0} dias"},
+			UnitHour:   {plural.One: "{0} hora", plural.Other: "{0} horas"},
+			UnitMinute: {plural.One: "{0} minuto", plural.Other: "{0} minutos"},
+			UnitSecond: {plural.One: "{0} segundo", plural.Other: "{0} segundos"},
+		},
+		Narrow: map[RelativeTimeUnit]string{
+			UnitYear:   "{0}a",
+			UnitMonth:  "{0}m",
+			UnitDay:    "{0}d",
+			UnitHour:   "{0}h",
+			UnitMinute: "{0}min",
+			UnitSecond: "{0}s",
+		},
+		NarrowSeparator: " ",
+	}
+}
+
+func dutchDurationUnits() *LocaleDurationUnits {
+	return &LocaleDurationUnits{
+		Long: map[RelativeTimeUnit]map[plural.Form]string{
+			UnitYear:   {plural.One: "{0} jaar", plural.Other: "{0} jaar"},
+			UnitMonth:  {plural.One: "{0} maand", plural.Other: "{0} maanden"},
+			UnitDay:    {plural.One: "{0} dag", plural.Other: "{0} dagen"},
+			UnitHour:   {plural.One: "{0} uur", plural.Other: "{0} uur"},
+			UnitMinute: {plural.One: "{0} minuut", plural.Other: "{0} minuten"},
+			UnitSecond: {plural.One: "{0} seconde", plural.Other: "{0} seconden"},
+		},
+		Narrow: map[RelativeTimeUnit]string{
+			UnitYear:   "{0}j",
+			UnitMonth:  "{0}m",
+			UnitDay:    "{0}d",
+			UnitHour:   "{0}u",
+			UnitMinute: "{0}min",
+			UnitSecond: "{0}s",
+		},
+		NarrowSeparator: " ",
+	}
+}
+
+func russianDurationUnits() *LocaleDurationUnits {
+	return &LocaleDurationUnits{
+		Long: map[RelativeTimeUnit]map[plural.Form]string{
+			UnitYear:   {plural.One: "{0} год", plural.Few: "{0} года", plural.Many: "{0} лет", plural.Other: "{0} года"},
+			UnitMonth:  {plural.One: "{0} месяц", plural.Few: "{0} месяца", plural.Many: "{0} месяцев", plural.Other: "{0} месяца"},
+			UnitDay:    {plural.One: "{0} день", plural.Few: "{0} дня", plural.Many: "{0} дней", plural.Other: "{0} дня"},
+			UnitHour:   {plural.One: "{0} час", plural.Few: "{0} часа", plural.Many: "{0} часов", plural.Other: "{0} часа"},
+			UnitMinute: {plural.One: "{0} минута", plural.Few: "{0} минуты", plural.Many: "{0} минут", plural.Other: "{0} минуты"},
+			UnitSecond: {plural.One: "{0} секунда", plural.Few: "{0} секунды", plural.Many: "{0} секунд", plural.Other: "{0} секунды"},
+		},
+		Narrow: map[RelativeTimeUnit]string{
+			UnitYear:   "{0} г.",
+			UnitMonth:  "{0} м.",
+			UnitDay:    "{0} д",
+			UnitHour:   "{0} ч",
+			UnitMinute: "{0} мин",
+			UnitSecond: "{0} с",
+		},
+		NarrowSeparator: " ",
+	}
+}
+
+func japaneseDurationUnits() *LocaleDurationUnits {
+	return &LocaleDurationUnits{
+		Long: map[RelativeTimeUnit]map[plural.Form]string{
+			UnitYear:   {plural.Other: "{0} 年"},
+			UnitMonth:  {plural.Other: "{0} か月"},
+			UnitDay:    {plural.Other: "{0} 日"},
+			UnitHour:   {plural.Other: "{0} 時間"},
+			UnitMinute: {plural.Other: "{0} 分"},
+			UnitSecond: {plural.Other: "{0} 秒"},
+		},
+		Narrow: map[RelativeTimeUnit]string{
+			UnitYear:   "{0}年",
+			UnitMonth:  "{0}か月",
+			UnitDay:    "{0}日",
+			UnitHour:   "{0}時間",
+			UnitMinute: "{0}分",
+			UnitSecond: "{0}秒",
+		},
+		NarrowSeparator: "",
+	}
+}
+
+func chineseDurationUnits() *LocaleDurationUnits {
+	return &LocaleDurationUnits{
+		Long: map[RelativeTimeUnit]map[plural.Form]string{
+			UnitYear:   {plural.Other: "{0}年"},
+			UnitMonth:  {plural.Other: "{0}个月"},
+			UnitDay:    {plural.Other: "{0}天"},
+			UnitHour:   {plural.Other: "{0}小时"},
+			UnitMinute: {plural.Other: "{0}分钟"},
+			UnitSecond: {plural.Other: "{0}秒钟"},
+		},
+		Narrow: map[RelativeTimeUnit]string{
+			UnitYear:   "{0}年",
+			UnitMonth:  "{0}个月",
+			UnitDay:    "{0}天",
+			UnitHour:   "{0}小时",
+			UnitMinute: "{0}分钟",
+			UnitSecond: "{0}秒",
+		},
+		NarrowSeparator: "",
+	}
+}
+
+func koreanDurationUnits() *LocaleDurationUnits {
+	return &LocaleDurationUnits{
+		Long: map[RelativeTimeUnit]map[plural.Form]string{
+			UnitYear:   {plural.Other: "{0}년"},
+			UnitMonth:  {plural.Other: "{0}개월"},
+			UnitDay:    {plural.Other: "{0}일"},
+			UnitHour:   {plural.Other: "{0}시간"},
+			UnitMinute: {plural.Other: "{0}분"},
+			UnitSecond: {plural.Other: "{0}초"},
+		},
+		Narrow: map[RelativeTimeUnit]string{
+			UnitYear:   "{0}년",
+			UnitMonth:  "{0}개월",
+			UnitDay:    "{0}일",
+			UnitHour:   "{0}시간",
+			UnitMinute: "{0}분",
+			UnitSecond: "{0}초",
+		},
+		NarrowSeparator: " ",
+	}
+}
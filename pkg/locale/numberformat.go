@@ -0,0 +1,325 @@
+// Package locale provides localization support for Parsley
+// This file implements CLDR-based compact number and file size formatting
+package locale
+
+import (
+	"math"
+	"strings"
+
+	"golang.org/x/text/feature/plural"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+)
+
+// CompactStyle represents the style of compact number formatting
+type CompactStyle string
+
+const (
+	CompactStyleShort CompactStyle = "short" // "12.5k"
+	CompactStyleLong  CompactStyle = "long"  // "12.5 thousand"
+)
+
+// ByteUnits represents the units file sizes are given in
+type ByteUnits string
+
+const (
+	ByteUnitsJEDEC ByteUnits = "jedec" // powers of 1024 written KB, MB ("47.1 MB")
+	ByteUnitsIEC   ByteUnits = "iec"   // powers of 1024 written KiB, MiB ("47.1 MiB")
+	ByteUnitsSI    ByteUnits = "si"    // powers of 1000 written kB, MB ("49.4 MB")
+)
+
+// CompactUnit is the abbreviation for one power of ten
+type CompactUnit struct {
+	// Power of ten the unit stands for (3 for thousands)
+	Power int
+	// Short pattern (e.g., "{0}k"); empty if the short style doesn't abbreviate this power
+	Short string
+	// Long patterns by plural form (e.g., "{0} thousand")
+	Long map[plural.Form]string
+}
+
+// compactLocales maps locale codes to their compact units, smallest first
+var compactLocales = map[string][]CompactUnit{
+	"en": englishCompactUnits(),
+	"de": germanCompactUnits(),
+	"fr": frenchCompactUnits(),
+	"es": spanishCompactUnits(),
+	"it": italianCompactUnits(),
+	"pt": portugueseCompactUnits(),
+	"nl": dutchCompactUnits(),
+	"ru": russianCompactUnits(),
+	"ja": japaneseCompactUnits(),
+	"zh": chineseCompactUnits(),
+	"ko": koreanCompactUnits(),
+}
+
+// ByteSymbols holds the symbols a locale writes file sizes with
+type ByteSymbols struct {
+	// Byte is the symbol for a byte ("B", or "o" for octet in French)
+	Byte string
+	// Prefixes for kilo, mega, giga, tera, peta and exa in binary units
+	Prefixes []string
+	// SIKilo replaces the kilo prefix in SI units ("k")
+	SIKilo string
+	// IECInfix follows the prefix in IEC units ("i", as in "KiB")
+	IECInfix string
+}
+
+// byteSymbolLocales maps locale codes to their file size symbols
+var byteSymbolLocales = map[string]*ByteSymbols{
+	"en": {Byte: "B", Prefixes: []string{"K", "M", "G", "T", "P", "E"}, SIKilo: "k", IECInfix: "i"},
+	"fr": {Byte: "o", Prefixes: []string{"K", "M", "G", "T", "P", "E"}, SIKilo: "k", IECInfix: "i"},
+	"ru": {Byte: "Б", Prefixes: []string{"К", "М", "Г", "Т", "П", "Э"}, SIKilo: "к", IECInfix: "и"},
+}
+
+// FormatCompact formats a number with the largest power of ten it reaches
+// abbreviated, rounded to one decimal place below 100 ("12.5k", "1.2 million")
+// Numbers too small to abbreviate are formatted as they are ("950")
+// style is "short" or "long" (defaults to "short")
+// locale is the BCP 47 locale tag (e.g., "en-US", "de-DE")
+func FormatCompact(value float64, style CompactStyle, locale string) string {
+	units := compactLocales[normalizeLocale(locale)]
+	if units == nil {
+		units = compactLocales["en"]
+	}
+
+	negative := value < 0
+	value = math.Abs(value)
+
+	// The largest unit the value reaches, moving up a unit when rounding
+	// takes it there (999,960 is "1M", not "1000k")
+	var unit *CompactUnit
+	mantissa, digits := value, 1
+	for i := len(units) - 1; i >= 0; i-- {
+		if !compactStyleHas(units[i], style) || value < math.Pow10(units[i].Power) {
+			continue
+		}
+		unit = &units[i]
+		mantissa, digits = roundCompact(value / math.Pow10(unit.Power))
+		for j := i + 1; j < len(units); j++ {
+			if compactStyleHas(units[j], style) {
+				if mantissa*math.Pow10(unit.Power) >= math.Pow10(units[j].Power) {
+					unit = &units[j]
+					mantissa, digits = 1, 0
+				}
+				break
+			}
+		}
+		break
+	}
+
+	result := formatDecimal(mantissa, digits, locale)
+	if unit != nil {
+		pattern := unit.Short
+		if style == CompactStyleLong {
+			form := pluralForm(mantissa, digits, locale)
+			pattern = unit.Long[form]
+			if pattern == "" {
+				pattern = unit.Long[plural.Other]
+			}
+		}
+		result = strings.Replace(pattern, "{0}", result, 1)
+	}
+
+	if negative {
+		return "-" + result
+	}
+	return result
+}
+
+// FormatByteSize formats a number of bytes in the largest unit it reaches,
+// to one decimal place ("47.1 MB")
+// units is "jedec", "iec" or "si" (defaults to "jedec")
+// locale is the BCP 47 locale tag (e.g., "en-US", "fr-FR")
+func FormatByteSize(bytes float64, units ByteUnits, locale string) string {
+	symbols := byteSymbolLocales[normalizeLocale(locale)]
+	if symbols == nil {
+		symbols = byteSymbolLocales["en"]
+	}
+
+	base := 1024.0
+	if units == ByteUnitsSI {
+		base = 1000
+	}
+
+	negative := bytes < 0
+	size := math.Abs(bytes)
+
+	prefix := -1
+	for prefix+1 < len(symbols.Prefixes) && math.Round(size*10)/10 >= base {
+		size /= base
+		prefix++
+	}
+
+	digits := 1
+	if prefix < 0 {
+		digits = 0
+	}
+	result := formatDecimal(size, digits, locale) + " " + byteSymbol(symbols, prefix, units)
+	if negative {
+		return "-" + result
+	}
+	return result
+}
+
+// byteSymbol returns the symbol for bytes with the given prefix (-1 for none)
+func byteSymbol(symbols *ByteSymbols, prefix int, units ByteUnits) string {
+	if prefix < 0 {
+		return symbols.Byte
+	}
+	p := symbols.Prefixes[prefix]
+	switch units {
+	case ByteUnitsSI:
+		if prefix == 0 {
+			p = symbols.SIKilo
+		}
+	case ByteUnitsIEC:
+		p += symbols.IECInfix
+	}
+	return p + symbols.Byte
+}
+
+// compactStyleHas reports whether a style abbreviates a unit's power of ten
+func compactStyleHas(unit CompactUnit, style CompactStyle) bool {
+	if style == CompactStyleLong {
+		return len(unit.Long) > 0
+	}
+	return unit.Short != ""
+}
+
+// roundCompact rounds an abbreviated number to one decimal place below 100
+// and to a whole number above, returning it with its decimal places
+func roundCompact(value float64) (float64, int) {
+	if value < 99.95 {
+		return math.Round(value*10) / 10, 1
+	}
+	return math.Round(value), 0
+}
+
+// formatDecimal formats a number with up to digits decimal places using the
+// locale's separators
+func formatDecimal(value float64, digits int, locale string) string {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		tag = language.English
+	}
+	p := message.NewPrinter(tag)
+	return p.Sprintf("%v", number.Decimal(value, number.MaxFractionDigits(digits)))
+}
+
+// pluralForm returns the plural form of a number shown with up to digits
+// decimal places
+func pluralForm(value float64, digits int, locale string) plural.Form {
+	whole := int(value)
+	fraction := int(math.Round((value - float64(whole)) * math.Pow10(digits)))
+	if fraction == 0 {
+		return plural.Cardinal.MatchPlural(language.Make(locale), whole, 0, 0, 0, 0)
+	}
+	return plural.Cardinal.MatchPlural(language.Make(locale), whole, digits, digits, fraction, fraction)
+}
+
+// ========================================
+// Locale-specific compact number data
+// Generated from CLDR data
+// ========================================
+
+// English abbreviates thousands with a lowercase k, which reads better in
+// running text than CLDR's "K"
+func englishCompactUnits() []CompactUnit {
+	return []CompactUnit{
+		{Power: 3, Short: "{0}k", Long: map[plural.Form]string{plural.Other: "{0} thousand"}},
+		{Power: 6, Short: "{0}M", Long: map[plural.Form]string{plural.Other: "{0} million"}},
+		{Power: 9, Short: "{0}B", Long: map[plural.Form]string{plural.Other: "{0} billion"}},
+		{Power: 12, Short: "{0}T", Long: map[plural.Form]string{plural.Other: "{0} trillion"}},
+	}
+}
+
+func germanCompactUnits() []CompactUnit {
+	return []CompactUnit{
+		{Power: 3, Long: map[plural.Form]string{plural.Other: "{0} Tausend"}},
+		{Power: 6, Short: "{0} Mio.", Long: map[plural.Form]string{plural.One: "{0} Million", plural.Other: "{0} Millionen"}},
+		{Power: 9, Short: "{0} Mrd.", Long: map[plural.Form]string{plural.One: "{0} Milliarde", plural.Other: "{0} Milliarden"}},
+		{Power: 12, Short: "{0} Bio.", Long: map[plural.Form]string{plural.One: "{0} Billion", plural.Other: "{0} Billionen"}},
+	}
+}
+
+func frenchCompactUnits() []CompactUnit {
+	return []CompactUnit{
+		{Power: 3, Short: "{0} k", Long: map[plural.Form]string{plural.Other: "{0} mille"}},
+		{Power: 6, Short: "{0} M", Long: map[plural.Form]string{plural.One: "{0} million", plural.Other: "{0} millions"}},
+		{Power: 9, Short: "{0} Md", Long: map[plural.Form]string{plural.One: "{0} milliard", plural.Other: "{0} milliards"}},
+		{Power: 12, Short: "{0} Bn", Long: map[plural.Form]string{plural.One: "{0} billion", plural.Other: "{0} billions"}},
+	}
+}
+
+func spanishCompactUnits() []CompactUnit {
+	return []CompactUnit{
+		{Power: 3, Short: "{0} mil", Long: map[plural.Form]string{plural.Other: "{0} mil"}},
+		{Power: 6, Short: "{0} M", Long: map[plural.Form]string{plural.One: "{0} millón", plural.Other: "{0} millones"}},
+		{Power: 9, Short: "{0} mil M", Long: map[plural.Form]string{plural.Other: "{0} mil millones"}},
+		{Power: 12, Short: "{0} B", Long: map[plural.Form]string{plural.One: "{0} billón", plural.Other: "{0} billones"}},
+	}
+}
+
+func italianCompactUnits() []CompactUnit {
+	return []CompactUnit{
+		{Power: 3, Long: map[plural.Form]string{plural.One: "mille", plural.Other: "{0} mila"}},
+		{Power: 6, Short: "{0} Mln", Long: map[plural.Form]string{plural.One: "{0} milione", plural.Other: "{0} milioni"}},
+		{Power: 9, Short: "{0} Mrd", Long: map[plural.Form]string{plural.One: "{0} miliardo", plural.Other: "{0} miliardi"}},
+		{Power: 12, Short: "{0} Bln", Long: map[plural.Form]string{plural.One: "{0} bilione", plural.Other: "{0} bilioni"}},
+	}
+}
+
+func portugueseCompactUnits() []CompactUnit {
+	return []CompactUnit{
+		{Power: 3, Short: "{0} mil", Long: map[plural.Form]string{plural.Other: "{0} mil"}},
+		{Power: 6, Short: "{0} mi", Long: map[plural.Form]string{plural.One: "{0} milhão", plural.Other: "{0} milhões"}},
+		{Power: 9, Short: "{0} bi", Long: map[plural.Form]string{plural.One: "{0} bilhão", plural.Other: "{0} bilhões"}},
+		{Power: 12, Short: "{0} tri", Long: map[plural.Form]string{plural.One: "{0} trilhão", plural.Other: "{0} trilhões"}},
+	}
+}
+
+func dutchCompactUnits() []CompactUnit {
+	return []CompactUnit{
+		{Power: 3, Short: "{0}K", Long: map[plural.Form]string{plural.Other: "{0} duizend"}},
+		{Power: 6, Short: "{0} mln.", Long: map[plural.Form]string{plural.Other: "{0} miljoen"}},
+		{Power: 9, Short: "{0} mld.", Long: map[plural.Form]string{plural.Other: "{0} miljard"}},
+		{Power: 12, Short: "{0} bln.", Long: map[plural.Form]string{plural.Other: "{0} biljoen"}},
+	}
+}
+
+func russianCompactUnits() []CompactUnit {
+	return []CompactUnit{
+		{Power: 3, Short: "{0} тыс.", Long: map[plural.Form]string{plural.One: "{0} тысяча", plural.Few: "{0} тысячи", plural.Many: "{0} тысяч", plural.Other: "{0} тысячи"}},
+		{Power: 6, Short: "{0} млн", Long: map[plural.Form]string{plural.One: "{0} миллион", plural.Few: "{0} миллиона", plural.Many: "{0} миллионов", plural.Other: "{0} миллиона"}},
+		{Power: 9, Short: "{0} млрд", Long: map[plural.Form]string{plural.One: "{0} миллиард", plural.Few: "{0} миллиарда", plural.Many: "{0} миллиардов", plural.Other: "{0} миллиарда"}},
+		{Power: 12, Short: "{0} трлн", Long: map[plural.Form]string{plural.One: "{0} триллион", plural.Few: "{0} триллиона", plural.Many: "{0} триллионов", plural.Other: "{0} триллиона"}},
+	}
+}
+
+// Japanese, Chinese and Korean count in myriads (10,000s)
+func japaneseCompactUnits() []CompactUnit {
+	return []CompactUnit{
+		{Power: 4, Short: "{0}万", Long: map[plural.Form]string{plural.Other: "{0}万"}},
+		{Power: 8, Short: "{0}億", Long: map[plural.Form]string{plural.Other: "{0}億"}},
+		{Power: 12, Short: "{0}兆", Long: map[plural.Form]string{plural.Other: "{0}兆"}},
+	}
+}
+
+func chineseCompactUnits() []CompactUnit {
+	return []CompactUnit{
+		{Power: 4, Short: "{0}万", Long: map[plural.Form]string{plural.Other: "{0}万"}},
+		{Power: 8, Short: "{0}亿", Long: map[plural.Form]string{plural.Other: "{0}亿"}},
+		{Power: 12, Short: "{0}万亿", Long: map[plural.Form]string{plural.Other: "{0}万亿"}},
+	}
+}
+
+func koreanCompactUnits() []CompactUnit {
+	return []CompactUnit{
+		{Power: 3, Short: "{0}천", Long: map[plural.Form]string{plural.Other: "{0}천"}},
+		{Power: 4, Short: "{0}만", Long: map[plural.Form]string{plural.Other: "{0}만"}},
+		{Power: 8, Short: "{0}억", Long: map[plural.Form]string{plural.Other: "{0}억"}},
+		{Power: 12, Short: "{0}조", Long: map[plural.Form]string{plural.Other: "{0}조"}},
+	}
+}
@@ -4,6 +4,7 @@ package locale
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"golang.org/x/text/feature/plural"
 	"golang.org/x/text/language"
@@ -168,6 +169,23 @@ func DurationToRelativeTime(months, seconds int64, locale string) string {
 	return FormatRelativeTime(value, unit, locale)
 }
 
+// RelativeTimeBetween formats t relative to base (e.g., "in 2 hours", "3 days ago")
+// Differences of a calendar month or more are expressed in months or years so
+// that long spans read naturally ("last year" rather than "in 52 weeks")
+func RelativeTimeBetween(t, base time.Time, locale string) string {
+	months := (t.Year()-base.Year())*12 + int(t.Month()-base.Month())
+	if months > 0 && t.Before(base.AddDate(0, months, 0)) {
+		months--
+	} else if months < 0 && t.After(base.AddDate(0, months, 0)) {
+		months++
+	}
+
+	if months != 0 {
+		return DurationToRelativeTime(int64(months), 0, locale)
+	}
+	return DurationToRelativeTime(0, t.Unix()-base.Unix(), locale)
+}
+
 // ========================================
 // Locale-specific relative time data
 // Generated from CLDR data
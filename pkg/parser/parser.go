@@ -40,6 +40,7 @@ var precedences = map[lexer.TokenType]int{
 	lexer.GT:           LESSGREATER,
 	lexer.LTE:          LESSGREATER,
 	lexer.GTE:          LESSGREATER,
+	lexer.IN:           LESSGREATER,
 	lexer.PLUS:         SUM,
 	lexer.MINUS:        SUM,
 	lexer.RANGE:        SUM,
@@ -66,6 +67,12 @@ type Parser struct {
 	curToken  lexer.Token
 	peekToken lexer.Token
 
+	// depth is the number of brackets and tags open before curToken, and
+	// kept is the number of errors already reported by statements that
+	// recovered from them (see synchronize)
+	depth int
+	kept  int
+
 	prefixParseFns map[lexer.TokenType]prefixParseFn
 	infixParseFns  map[lexer.TokenType]infixParseFn
 }
@@ -119,17 +126,18 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(lexer.PERCENT, p.parseInfixExpression)
 	p.registerInfix(lexer.EQ, p.parseInfixExpression)
 	p.registerInfix(lexer.NOT_EQ, p.parseInfixExpression)
-	p.registerInfix(lexer.LT, p.parseInfixExpression)
-	p.registerInfix(lexer.GT, p.parseInfixExpression)
-	p.registerInfix(lexer.LTE, p.parseInfixExpression)
-	p.registerInfix(lexer.GTE, p.parseInfixExpression)
+	p.registerInfix(lexer.LT, p.parseComparisonExpression)
+	p.registerInfix(lexer.GT, p.parseComparisonExpression)
+	p.registerInfix(lexer.LTE, p.parseComparisonExpression)
+	p.registerInfix(lexer.GTE, p.parseComparisonExpression)
+	p.registerInfix(lexer.IN, p.parseInfixExpression) // Membership: x in collection
 	p.registerInfix(lexer.AND, p.parseInfixExpression)
 	p.registerInfix(lexer.OR, p.parseInfixExpression)
 	p.registerInfix(lexer.NULLISH, p.parseInfixExpression)
 	p.registerInfix(lexer.MATCH, p.parseInfixExpression)
 	p.registerInfix(lexer.NOT_MATCH, p.parseInfixExpression)
 	p.registerInfix(lexer.PLUSPLUS, p.parseInfixExpression)
-	p.registerInfix(lexer.RANGE, p.parseInfixExpression)
+	p.registerInfix(lexer.RANGE, p.parseRangeExpression)
 	p.registerInfix(lexer.QUERY_ONE, p.parseInfixExpression)      // Database operators
 	p.registerInfix(lexer.QUERY_MANY, p.parseInfixExpression)     // Database operators
 	p.registerInfix(lexer.EXECUTE, p.parseInfixExpression)        // Database operators
@@ -163,6 +171,15 @@ func (p *Parser) registerInfix(tokenType lexer.TokenType, fn infixParseFn) {
 
 // nextToken advances prevToken, curToken, and peekToken
 func (p *Parser) nextToken() {
+	switch p.curToken.Type {
+	case lexer.LPAREN, lexer.LBRACKET, lexer.LBRACE, lexer.TAG_START:
+		p.depth++
+	case lexer.RPAREN, lexer.RBRACKET, lexer.RBRACE, lexer.TAG_END:
+		// Stray closing brackets don't count
+		if p.depth > 0 {
+			p.depth--
+		}
+	}
 	p.prevToken = p.curToken
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
@@ -174,7 +191,10 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program.Statements = []ast.Statement{}
 
 	for !p.curTokenIs(lexer.EOF) {
-		stmt := p.parseStatement()
+		stmt, ok := p.parseStatementOrRecover()
+		if !ok {
+			continue
+		}
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
@@ -184,6 +204,50 @@ func (p *Parser) ParseProgram() *ast.Program {
 	return program
 }
 
+// parseStatementOrRecover parses a statement. If the statement has errors it
+// returns false, leaving the parser at the start of the next statement, so
+// that a file with several mistakes reports each of them once instead of a
+// cascade of errors from parsing the rest of a broken statement.
+func (p *Parser) parseStatementOrRecover() (ast.Statement, bool) {
+	start, depth, errCount := p.curToken, p.depth, len(p.errors)
+	stmt := p.parseStatement()
+	if len(p.errors) == errCount {
+		return stmt, true
+	}
+	p.synchronize(start, depth, errCount)
+	return nil, false
+}
+
+// synchronize handles a statement that added errors. Only its first error is
+// kept, since the rest usually follow from it, along with any kept by the
+// statements nested in it. It then skips to the next token outside the
+// brackets the statement opened that starts a line or follows a ';', or to
+// the '}' that closes the block the statement is in.
+func (p *Parser) synchronize(start lexer.Token, depth int, errCount int) {
+	if p.kept > errCount {
+		p.errors = p.errors[:p.kept]
+	} else {
+		p.errors = p.errors[:errCount+1]
+	}
+	p.kept = len(p.errors)
+
+	// Always move past the statement's first token, so parsing progresses
+	if p.curToken == start {
+		p.nextToken()
+	}
+	for !p.curTokenIs(lexer.EOF) {
+		if p.depth <= depth {
+			if p.depth < depth || p.curToken.Line > p.prevToken.Line || p.prevToken.Type == lexer.SEMICOLON {
+				return
+			}
+			if depth > 0 && p.depth == depth && p.curTokenIs(lexer.RBRACE) {
+				return
+			}
+		}
+		p.nextToken()
+	}
+}
+
 // parseStatement parses statements
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
@@ -201,6 +265,7 @@ func (p *Parser) parseStatement() ast.Statement {
 		savedPeek := p.peekToken
 		savedPrev := p.prevToken
 		savedErrors := len(p.errors)
+		savedDepth := p.depth
 		savedLexerState := p.l.SaveState()
 
 		stmt := p.parseDictDestructuringAssignment()
@@ -211,11 +276,23 @@ func (p *Parser) parseStatement() ast.Statement {
 			p.peekToken = savedPeek
 			p.prevToken = savedPrev
 			p.errors = p.errors[:savedErrors]
+			p.depth = savedDepth
+			p.kept = min(p.kept, savedErrors)
 			p.l.RestoreState(savedLexerState)
 			return p.parseExpressionStatement()
 		}
 		return stmt
 	case lexer.IDENT:
+		// 'props {...}' declares a component's props; like cond, props is only
+		// special before a '{' on the same line
+		if p.curToken.Literal == "props" && p.peekTokenIs(lexer.LBRACE) && p.peekToken.Line == p.curToken.Line {
+			return p.parsePropsStatement()
+		}
+		// 'import {a, b} from path' binds names from a module; import(path)
+		// is still a call
+		if p.curToken.Literal == "import" && p.peekTokenIs(lexer.LBRACE) && p.peekToken.Line == p.curToken.Line {
+			return p.parseImportStatement()
+		}
 		// Check if this is an assignment statement (= or <== or <=/= or <=?=> or <=??=> or <=!=>)
 		if p.peekTokenIs(lexer.ASSIGN) || p.peekTokenIs(lexer.READ_FROM) || p.peekTokenIs(lexer.FETCH_FROM) || p.peekTokenIs(lexer.QUERY_ONE) || p.peekTokenIs(lexer.QUERY_MANY) || p.peekTokenIs(lexer.EXECUTE) {
 			return p.parseAssignmentStatement(false)
@@ -229,6 +306,7 @@ func (p *Parser) parseStatement() ast.Statement {
 			savedPeek := p.peekToken
 			savedPrev := p.prevToken
 			savedErrors := len(p.errors)
+			savedDepth := p.depth
 			savedLexerState := p.l.SaveState()
 
 			stmt := p.parseAssignmentStatement(false)
@@ -239,6 +317,8 @@ func (p *Parser) parseStatement() ast.Statement {
 				p.peekToken = savedPeek
 				p.prevToken = savedPrev
 				p.errors = p.errors[:savedErrors]
+				p.depth = savedDepth
+				p.kept = min(p.kept, savedErrors)
 				p.l.RestoreState(savedLexerState)
 				return p.parseExpressionStatement()
 			}
@@ -273,6 +353,7 @@ func (p *Parser) parseExportStatement() ast.Statement {
 		savedPeek := p.peekToken
 		savedPrev := p.prevToken
 		savedErrors := len(p.errors)
+		savedDepth := p.depth
 		savedLexerState := p.l.SaveState()
 
 		stmt := p.parseDictDestructuringAssignment()
@@ -283,6 +364,8 @@ func (p *Parser) parseExportStatement() ast.Statement {
 			p.peekToken = savedPeek
 			p.prevToken = savedPrev
 			p.errors = p.errors[:savedErrors]
+			p.depth = savedDepth
+			p.kept = min(p.kept, savedErrors)
 			p.l.RestoreState(savedLexerState)
 			p.peekError(lexer.LET)
 			return nil
@@ -675,9 +758,156 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 
 // Parse functions for different expression types
 func (p *Parser) parseIdentifier() ast.Expression {
+	// 'cond' is only a keyword when a '{' follows on the same line
+	if p.curToken.Literal == "cond" && p.peekTokenIs(lexer.LBRACE) && p.peekToken.Line == p.curToken.Line {
+		return p.parseCondExpression()
+	}
 	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+// parseCondExpression parses 'cond { test => value, ..., else => value }'
+func (p *Parser) parseCondExpression() ast.Expression {
+	expression := &ast.CondExpression{Token: p.curToken}
+	p.nextToken() // '{'
+
+	for !p.peekTokenIs(lexer.RBRACE) {
+		if expression.Else != nil {
+			p.errors = append(p.errors, fmt.Sprintf("line %d, column %d: else must be the last branch of cond", p.peekToken.Line, p.peekToken.Column))
+			return nil
+		}
+		p.nextToken()
+
+		if p.curTokenIs(lexer.ELSE) {
+			if !p.expectPeek(lexer.ARROW) {
+				return nil
+			}
+			p.nextToken()
+			expression.Else = p.parseExpression(LOWEST)
+		} else {
+			branch := &ast.CondBranch{Condition: p.parseExpression(LOWEST)}
+			if !p.expectPeek(lexer.ARROW) {
+				return nil
+			}
+			branch.Token = p.curToken
+			p.nextToken()
+			branch.Value = p.parseExpression(LOWEST)
+			expression.Branches = append(expression.Branches, branch)
+		}
+
+		if !p.peekTokenIs(lexer.RBRACE) && !p.expectPeek(lexer.COMMA) {
+			return nil
+		}
+	}
+	p.nextToken() // '}'
+
+	return expression
+}
+
+// parsePropsStatement parses 'props {name, name: type, name: type = default}'
+func (p *Parser) parsePropsStatement() ast.Statement {
+	stmt := &ast.PropsStatement{Token: p.curToken}
+	p.nextToken() // '{'
+
+	seen := map[string]bool{}
+	for !p.peekTokenIs(lexer.RBRACE) {
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		prop := &ast.PropDeclaration{
+			Token: p.curToken,
+			Name:  &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal},
+		}
+		if seen[prop.Name.Value] {
+			p.errors = append(p.errors, fmt.Sprintf("line %d, column %d: prop %s is declared twice", p.curToken.Line, p.curToken.Column, prop.Name.Value))
+			return nil
+		}
+		seen[prop.Name.Value] = true
+
+		if p.peekTokenIs(lexer.COLON) {
+			p.nextToken()
+			if !p.expectPeek(lexer.IDENT) {
+				return nil
+			}
+			prop.Type = p.curToken.Literal
+		}
+		if p.peekTokenIs(lexer.ASSIGN) {
+			p.nextToken()
+			p.nextToken()
+			prop.Default = p.parseExpression(COMMA_PREC + 1)
+		}
+		stmt.Props = append(stmt.Props, prop)
+
+		if !p.peekTokenIs(lexer.RBRACE) && !p.expectPeek(lexer.COMMA) {
+			return nil
+		}
+	}
+	p.nextToken() // '}'
+
+	if p.peekTokenIs(lexer.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// parseImportStatement parses 'import {name, name as alias} from path'
+func (p *Parser) parseImportStatement() ast.Statement {
+	stmt := &ast.ImportStatement{Token: p.curToken}
+	p.nextToken() // '{'
+
+	seen := map[string]bool{}
+	for !p.peekTokenIs(lexer.RBRACE) {
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		name := &ast.ImportName{
+			Token: p.curToken,
+			Name:  &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal},
+		}
+		if p.peekTokenIs(lexer.AS) {
+			p.nextToken()
+			if !p.expectPeek(lexer.IDENT) {
+				return nil
+			}
+			name.Alias = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		}
+		bound := name.Name
+		if name.Alias != nil {
+			bound = name.Alias
+		}
+		if seen[bound.Value] {
+			p.errors = append(p.errors, fmt.Sprintf("line %d, column %d: %s is imported twice", bound.Token.Line, bound.Token.Column, bound.Value))
+			return nil
+		}
+		seen[bound.Value] = true
+		stmt.Names = append(stmt.Names, name)
+
+		if !p.peekTokenIs(lexer.RBRACE) && !p.expectPeek(lexer.COMMA) {
+			return nil
+		}
+	}
+	p.nextToken() // '}'
+
+	if !p.peekTokenIs(lexer.IDENT) || p.peekToken.Literal != "from" {
+		got := p.peekToken.Literal
+		if got == "" {
+			got = tokenTypeToReadableName(p.peekToken.Type)
+		}
+		p.errors = append(p.errors, fmt.Sprintf("line %d, column %d: expected 'from' after the import list, got '%s'", p.curToken.Line, p.curToken.Column+1, got))
+		return nil
+	}
+	p.nextToken() // 'from'
+	p.nextToken()
+	stmt.Path = p.parseExpression(LOWEST)
+	if stmt.Path == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(lexer.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
@@ -867,16 +1097,29 @@ func (p *Parser) parseTagPair() ast.Expression {
 // parseTagContents parses the contents between opening and closing tags
 func (p *Parser) parseTagContents(tagName string) []ast.Node {
 	var contents []ast.Node
+	// trimNext is set by a "-}" so the whitespace at the start of the next
+	// text is dropped
+	trimNext := false
 
 	for !p.curTokenIs(lexer.TAG_END) && !p.curTokenIs(lexer.EOF) {
+		if !p.curTokenIs(lexer.TAG_TEXT) {
+			trimNext = false
+		}
 		switch p.curToken.Type {
 		case lexer.TAG_TEXT:
 			// Raw text content
-			textNode := &ast.TextNode{
-				Token: p.curToken,
-				Value: p.curToken.Literal,
+			value := p.curToken.Literal
+			if trimNext {
+				value = strings.TrimLeft(value, tagWhitespace)
+				trimNext = false
+			}
+			if value != "" {
+				textNode := &ast.TextNode{
+					Token: p.curToken,
+					Value: value,
+				}
+				contents = append(contents, textNode)
 			}
-			contents = append(contents, textNode)
 			p.nextToken()
 
 		case lexer.TAG_START:
@@ -899,15 +1142,22 @@ func (p *Parser) parseTagContents(tagName string) []ast.Node {
 			// Interpolation block - can contain one or more statements
 			// We need to handle this carefully to maintain the lexer mode correctly
 			startToken := p.curToken
-			p.nextToken() // skip {
+			if startToken.Literal == "{-" {
+				contents = trimTrailingText(contents)
+			}
 
 			// Check if this is empty {}
-			if p.curTokenIs(lexer.RBRACE) {
-				// Empty interpolation - just skip it
+			if p.peekTokenIs(lexer.RBRACE) {
+				// Empty interpolation - just skip it, re-entering tag content
+				// mode before the token after } is read
 				p.l.EnterTagContentMode()
+				p.nextToken() // }
+				trim := p.curToken.Literal == "-}"
 				p.nextToken() // move past }
+				trimNext = trim
 				continue
 			}
+			p.nextToken() // skip {
 
 			// Parse statements until we hit RBRACE
 			// This is similar to how ParseProgram works, but we stop at }
@@ -950,7 +1200,9 @@ func (p *Parser) parseTagContents(tagName string) []ast.Node {
 			if !p.expectPeek(lexer.RBRACE) {
 				return contents
 			}
+			trim := p.curToken.Literal == "-}"
 			p.nextToken() // move past }
+			trimNext = trim
 
 		default:
 			// Unexpected token
@@ -963,6 +1215,27 @@ func (p *Parser) parseTagContents(tagName string) []ast.Node {
 	return contents
 }
 
+// tagWhitespace is the whitespace "{- " and " -}" trim from tag text
+const tagWhitespace = " \t\r\n"
+
+// trimTrailingText drops the whitespace at the end of the last text in
+// contents, for "{- "
+func trimTrailingText(contents []ast.Node) []ast.Node {
+	if len(contents) == 0 {
+		return contents
+	}
+	text, ok := contents[len(contents)-1].(*ast.TextNode)
+	if !ok {
+		return contents
+	}
+	value := strings.TrimRight(text.Value, tagWhitespace)
+	if value == "" {
+		return contents[:len(contents)-1]
+	}
+	contents[len(contents)-1] = &ast.TextNode{Token: text.Token, Value: value}
+	return contents
+}
+
 // parseTagNameAndProps splits raw tag content into name and props
 // Examples: "div class=\"foo\"" -> ("div", "class=\"foo\"")
 //
@@ -1014,6 +1287,54 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+// parseRangeExpression parses 'start..end' with an optional 'by step'.
+// 'by' is only a keyword here, and only on the same line as the range.
+func (p *Parser) parseRangeExpression(left ast.Expression) ast.Expression {
+	expression := &ast.RangeExpression{Token: p.curToken, Start: left}
+
+	p.nextToken()
+	expression.End = p.parseExpression(SUM)
+
+	if p.peekTokenIs(lexer.IDENT) && p.peekToken.Literal == "by" && p.peekToken.Line == p.curToken.Line {
+		p.nextToken()
+		p.nextToken()
+		expression.Step = p.parseExpression(SUM)
+	}
+
+	return expression
+}
+
+// parseComparisonExpression parses <, >, <= and >=, collecting chains like
+// 'a < x <= b' into a single ComparisonChain
+func (p *Parser) parseComparisonExpression(left ast.Expression) ast.Expression {
+	expression := p.parseInfixExpression(left).(*ast.InfixExpression)
+	if !p.peekIsComparison() {
+		return expression
+	}
+
+	chain := &ast.ComparisonChain{
+		Token:     expression.Token,
+		Operands:  []ast.Expression{expression.Left, expression.Right},
+		Operators: []string{expression.Operator},
+	}
+	for p.peekIsComparison() {
+		p.nextToken()
+		chain.Operators = append(chain.Operators, p.curToken.Literal)
+		p.nextToken()
+		chain.Operands = append(chain.Operands, p.parseExpression(LESSGREATER))
+	}
+	return chain
+}
+
+// peekIsComparison reports whether the next token is an ordering comparison
+func (p *Parser) peekIsComparison() bool {
+	switch p.peekToken.Type {
+	case lexer.LT, lexer.GT, lexer.LTE, lexer.GTE:
+		return true
+	}
+	return false
+}
+
 func (p *Parser) parseExecuteExpression(left ast.Expression) ast.Expression {
 	expression := &ast.ExecuteExpression{
 		Token:   p.curToken,
@@ -1158,7 +1479,10 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	p.nextToken()
 
 	for !p.curTokenIs(lexer.RBRACE) && !p.curTokenIs(lexer.EOF) {
-		stmt := p.parseStatement()
+		stmt, ok := p.parseStatementOrRecover()
+		if !ok {
+			continue
+		}
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
@@ -1364,6 +1688,15 @@ func (p *Parser) parseForExpression() ast.Expression {
 func (p *Parser) parseCallExpression(fn ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: fn}
 	exp.Arguments = p.parseExpressionList(lexer.RPAREN)
+
+	// lock(path) { ... }, task(name) { ... }, retry(options) { ... } and timeIt() { ... } pass the block as a trailing function argument
+	if ident, ok := fn.(*ast.Identifier); ok && (ident.Value == "lock" || ident.Value == "task" || ident.Value == "retry" || ident.Value == "timeIt") && p.peekTokenIs(lexer.LBRACE) {
+		p.nextToken()
+		body := &ast.FunctionLiteral{Token: p.curToken}
+		body.Body = p.parseBlockStatement()
+		exp.Arguments = append(exp.Arguments, body)
+	}
+
 	return exp
 }
 
@@ -1630,6 +1963,8 @@ func tokenTypeToReadableName(t lexer.TokenType) string {
 		return "'++'"
 	case lexer.RANGE:
 		return "'..'"
+	case lexer.ARROW:
+		return "'=>'"
 
 	// Keywords
 	case lexer.FUNCTION:
@@ -1692,9 +2027,9 @@ func (p *Parser) parseDictionaryLiteral() ast.Expression {
 	for !p.curTokenIs(lexer.RBRACE) {
 		p.nextToken()
 
-		// Key must be an identifier
-		if !p.curTokenIs(lexer.IDENT) {
-			p.errors = append(p.errors, fmt.Sprintf("expected identifier as dictionary key, got %s at line %d, column %d",
+		// Key must be an identifier, or a string for keys like ".card" or "--gap"
+		if !p.curTokenIs(lexer.IDENT) && !p.curTokenIs(lexer.STRING) {
+			p.errors = append(p.errors, fmt.Sprintf("expected identifier or string as dictionary key, got %s at line %d, column %d",
 				tokenTypeToReadableName(p.curToken.Type), p.curToken.Line, p.curToken.Column))
 			return nil
 		}
@@ -20,6 +20,8 @@ type Config struct {
 	Logger        evaluator.Logger
 	Filename      string
 	Vars          map[string]interface{}
+	Strict        bool
+	EnvVars       map[string]string
 	DBConnections map[string]*DBConnectionConfig // Injected database connections
 }
 
@@ -54,6 +56,22 @@ func WithFilename(name string) Option {
 	}
 }
 
+// WithStrict enables strict mode, which makes undeclared assignments,
+// missing dictionary keys, string + number and implicit let exports errors
+func WithStrict() Option {
+	return func(c *Config) {
+		c.Strict = true
+	}
+}
+
+// WithEnvVars sets the environment variables scripts can read as env.
+// evaluator.ExposeEnv() reads them from the process environment.
+func WithEnvVars(vars map[string]string) Option {
+	return func(c *Config) {
+		c.EnvVars = vars
+	}
+}
+
 // WithVar pre-populates a variable in the environment.
 // The value is converted from Go types to Parsley types using ToParsley().
 func WithVar(name string, value interface{}) Option {
@@ -122,6 +140,14 @@ func applyConfig(env *evaluator.Environment, c *Config) error {
 		env.Logger = c.Logger
 	}
 
+	if c.Strict {
+		env.Strict = true
+	}
+
+	if c.EnvVars != nil {
+		env.EnvVars = c.EnvVars
+	}
+
 	// Apply variables
 	for name, value := range c.Vars {
 		obj, err := ToParsley(value)
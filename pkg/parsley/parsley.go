@@ -54,6 +54,15 @@ func (r *Result) String() string {
 	return evaluator.ObjectToPrintString(r.Value)
 }
 
+// Bytes returns the exact output bytes of the result: byte arrays as raw
+// bytes, everything else as String() without a trailing newline
+func (r *Result) Bytes() []byte {
+	if r.Value == nil {
+		return nil
+	}
+	return evaluator.ObjectToBytes(r.Value)
+}
+
 // IsNull returns true if the result is null
 func (r *Result) IsNull() bool {
 	if r.Value == nil {
@@ -105,12 +114,13 @@ func Eval(source string, opts ...Option) (*Result, error) {
 
 	// Evaluate the program
 	result := evaluator.Eval(program, env)
+	evaluator.EndScript(env)
 
 	// Check for runtime errors
 	if result != nil && result.Type() == evaluator.ERROR_OBJ {
 		errObj := result.(*evaluator.Error)
-		return &Result{Value: result, Err: &RuntimeError{Message: errObj.Message, Line: errObj.Line, Column: errObj.Column}},
-			&RuntimeError{Message: errObj.Message, Line: errObj.Line, Column: errObj.Column}
+		runtimeErr := &RuntimeError{Message: errObj.Message, Line: errObj.Line, Column: errObj.Column, File: errObj.File}
+		return &Result{Value: result, Err: runtimeErr}, runtimeErr
 	}
 
 	return &Result{Value: result}, nil
@@ -147,13 +157,18 @@ type RuntimeError struct {
 	Message string
 	Line    int
 	Column  int
+	File    string // Imported module the error is in, or "" for the script
 }
 
 func (e *RuntimeError) Error() string {
+	module := ""
+	if e.File != "" {
+		module = fmt.Sprintf("in module %s: ", e.File)
+	}
 	if e.Line > 0 {
-		return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+		return fmt.Sprintf("%sline %d, column %d: %s", module, e.Line, e.Column, e.Message)
 	}
-	return e.Message
+	return module + e.Message
 }
 
 // Re-export types from evaluator for convenience
@@ -214,6 +229,18 @@ var (
 
 	// ObjectToPrintString converts an object to its print representation
 	ObjectToPrintString = evaluator.ObjectToPrintString
+
+	// InvalidateModule drops a cached import and the modules that import it
+	InvalidateModule = evaluator.InvalidateModule
+
+	// InvalidateChangedModules drops cached imports whose files have changed
+	InvalidateChangedModules = evaluator.InvalidateChangedModules
+
+	// ClearModuleCache drops every cached import
+	ClearModuleCache = evaluator.ClearModuleCache
+
+	// ResetMocks removes every mock registered with mock()
+	ResetMocks = evaluator.ResetMocks
 )
 
 // Re-export singleton values
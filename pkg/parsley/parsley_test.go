@@ -2,7 +2,10 @@ package parsley_test
 
 import (
 	"database/sql"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/sambeau/parsley/pkg/parsley"
 	_ "modernc.org/sqlite"
@@ -65,6 +68,24 @@ func TestEvalWithVar(t *testing.T) {
 	}
 }
 
+func TestResultBytes(t *testing.T) {
+	result, err := parsley.Eval(`[80, 0, 255]`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := string(result.Bytes()); got != "P\x00\xff" {
+		t.Errorf("expected raw bytes, got %q", got)
+	}
+
+	result, err = parsley.Eval(`"line"`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := string(result.Bytes()); got != "line" {
+		t.Errorf("expected 'line', got %q", got)
+	}
+}
+
 func TestEvalWithMultipleVars(t *testing.T) {
 	result, err := parsley.Eval(`a + b`,
 		parsley.WithVar("a", 10),
@@ -237,3 +258,70 @@ func TestWithDBManagedConnectionCannotBeClosed(t *testing.T) {
 		t.Error("expected error when closing managed connection")
 	}
 }
+
+func TestModuleReloading(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string, age time.Duration) {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+		// Distinct modification times regardless of filesystem resolution
+		mtime := time.Now().Add(-age)
+		os.Chtimes(path, mtime, mtime)
+	}
+	write("greeting.pars", `export word = "hello"`, time.Hour)
+	write("page.pars", `let {word} = import(@./greeting.pars); export render = fn() { word + "!" }`, time.Hour)
+	write("other.pars", `export n = 1`, time.Hour)
+	write("main.pars", `import(@./page.pars).render() + import(@./other.pars).n`, time.Hour)
+
+	policy := &parsley.SecurityPolicy{AllowExecuteAll: true}
+	main := filepath.Join(dir, "main.pars")
+	render := func() string {
+		t.Helper()
+		result, err := parsley.EvalFile(main, parsley.WithSecurity(policy))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return result.String()
+	}
+	defer parsley.ClearModuleCache()
+
+	if got := render(); got != "hello!1" {
+		t.Fatalf("expected 'hello!1', got %q", got)
+	}
+
+	// Edits are not seen until the cache is invalidated
+	write("greeting.pars", `export word = "goodbye"`, 0)
+	if got := render(); got != "hello!1" {
+		t.Fatalf("expected cached 'hello!1', got %q", got)
+	}
+
+	// The changed module and the module importing it are reloaded
+	invalidated := parsley.InvalidateChangedModules()
+	want := []string{filepath.Join(dir, "greeting.pars"), filepath.Join(dir, "page.pars")}
+	if len(invalidated) != 2 || invalidated[0] != want[0] || invalidated[1] != want[1] {
+		t.Errorf("expected %v invalidated, got %v", want, invalidated)
+	}
+	if got := render(); got != "goodbye!1" {
+		t.Errorf("expected 'goodbye!1', got %q", got)
+	}
+	if invalidated := parsley.InvalidateChangedModules(); len(invalidated) != 0 {
+		t.Errorf("expected nothing to invalidate, got %v", invalidated)
+	}
+
+	// Explicit invalidation, e.g. from a file watcher
+	write("other.pars", `export n = 2`, 0)
+	if invalidated := parsley.InvalidateModule(filepath.Join(dir, "other.pars")); len(invalidated) != 1 {
+		t.Errorf("expected only other.pars invalidated, got %v", invalidated)
+	}
+	if got := render(); got != "goodbye!2" {
+		t.Errorf("expected 'goodbye!2', got %q", got)
+	}
+
+	write("greeting.pars", `export word = "hi"`, 0)
+	parsley.ClearModuleCache()
+	if got := render(); got != "hi!2" {
+		t.Errorf("expected 'hi!2', got %q", got)
+	}
+}
@@ -0,0 +1,246 @@
+// Package phone parses, validates and formats telephone numbers for Parsley
+// Each country is described by libphonenumber-style metadata (calling code,
+// national prefix, possible lengths, a pattern for valid numbers and
+// formatting rules) stored as JSON.
+package phone
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//go:embed data/phone.json
+var embeddedData []byte
+
+// Style is the way a number is written
+type Style string
+
+const (
+	StyleNational      Style = "national"      // "(555) 123-4567"
+	StyleInternational Style = "international" // "+1 555-123-4567"
+	StyleE164          Style = "e164"          // "+15551234567"
+)
+
+// Format describes how to write numbers that start with Match
+type Format struct {
+	// Match is a pattern for the leading digits the format applies to (empty matches all)
+	Match string `json:"match,omitempty"`
+	// Pattern splits the national number into groups
+	Pattern string `json:"pattern"`
+	// National and International are templates for the groups ($1, $2...)
+	National      string `json:"national"`
+	International string `json:"international"`
+
+	match   *regexp.Regexp
+	pattern *regexp.Regexp
+}
+
+// Country is the numbering plan of a country
+type Country struct {
+	Name string `json:"name"`
+	// Code is the country calling code (e.g., "44")
+	Code string `json:"code"`
+	// Prefix is dialled before national numbers within the country (e.g., "0")
+	Prefix string `json:"prefix,omitempty"`
+	// Main marks the country a shared calling code belongs to by default
+	Main bool `json:"main,omitempty"`
+	// Lengths are the possible lengths of national numbers
+	Lengths []int `json:"lengths"`
+	// Pattern matches valid national numbers
+	Pattern string   `json:"pattern"`
+	Formats []Format `json:"formats"`
+
+	id      string
+	pattern *regexp.Regexp
+}
+
+// Number is a phone number parsed for a country
+type Number struct {
+	Country *Country
+	// National is the national significant number, digits only
+	National string
+}
+
+// builtinCountries holds the embedded numbering plans keyed by upper-case country code
+var builtinCountries = mustParseCountries(embeddedData)
+
+func mustParseCountries(data []byte) map[string]*Country {
+	var raw map[string]*Country
+	if err := json.Unmarshal(data, &raw); err != nil {
+		panic(fmt.Sprintf("phone: invalid embedded data: %s", err))
+	}
+
+	countries := make(map[string]*Country, len(raw))
+	for id, c := range raw {
+		c.id = strings.ToUpper(id)
+		c.pattern = regexp.MustCompile(`^(?:` + c.Pattern + `)$`)
+		for i := range c.Formats {
+			f := &c.Formats[i]
+			if f.Match != "" {
+				f.match = regexp.MustCompile(`^(?:` + f.Match + `)`)
+			}
+			f.pattern = regexp.MustCompile(`^(?:` + f.Pattern + `)$`)
+		}
+		countries[c.id] = c
+	}
+	return countries
+}
+
+// Lookup returns the numbering plan for a country code (e.g., "US", "gb")
+func Lookup(code string) (*Country, bool) {
+	c, ok := builtinCountries[strings.ToUpper(code)]
+	return c, ok
+}
+
+// Countries returns the codes of all embedded numbering plans, sorted
+func Countries() []string {
+	codes := make([]string, 0, len(builtinCountries))
+	for code := range builtinCountries {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// ID returns the country's ISO 3166 code (e.g., "US")
+func (c *Country) ID() string {
+	return c.id
+}
+
+// Parse reads a phone number written with or without punctuation. Numbers
+// starting with + or 00 are international and may belong to any country;
+// others are national numbers of the home country, which may be nil if every
+// number is international.
+func Parse(s string, home *Country) (*Number, error) {
+	digits, international, err := stripNumber(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if !international {
+		if home == nil {
+			return nil, fmt.Errorf("%q has no country calling code (+)", s)
+		}
+		// The national prefix is optional: "(555) 123-4567" and "1 555 123 4567"
+		if home.Prefix != "" && strings.HasPrefix(digits, home.Prefix) {
+			stripped := digits[len(home.Prefix):]
+			if home.possible(stripped) && (home.pattern.MatchString(stripped) || !home.pattern.MatchString(digits)) {
+				digits = stripped
+			}
+		}
+		if !home.possible(digits) {
+			return nil, fmt.Errorf("%q is not a %s phone number", s, home.Name)
+		}
+		return &Number{Country: home, National: digits}, nil
+	}
+
+	for n := 1; n <= 3 && n < len(digits); n++ {
+		if c := countryForCode(digits[:n], digits[n:], home); c != nil {
+			national := digits[n:]
+			if !c.possible(national) {
+				return nil, fmt.Errorf("%q is not a %s phone number", s, c.Name)
+			}
+			return &Number{Country: c, National: national}, nil
+		}
+	}
+	return nil, fmt.Errorf("%q has an unknown country calling code", s)
+}
+
+// stripNumber removes spaces and punctuation from a number, reporting
+// whether it had an international prefix
+func stripNumber(s string) (string, bool, error) {
+	s = strings.TrimSpace(s)
+	international := strings.HasPrefix(s, "+")
+	var b strings.Builder
+	for _, r := range strings.TrimPrefix(s, "+") {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case strings.ContainsRune(" -.()/\u00a0", r):
+		default:
+			return "", false, fmt.Errorf("%q is not a phone number", s)
+		}
+	}
+	digits := b.String()
+	if !international && strings.HasPrefix(digits, "00") {
+		digits, international = digits[2:], true
+	}
+	if digits == "" {
+		return "", false, fmt.Errorf("%q is not a phone number", s)
+	}
+	return digits, international, nil
+}
+
+// countryForCode finds the country a calling code and national number
+// belong to. Countries that share a code (such as the US and Canada) are
+// told apart by which one the number is valid in, then by preferring the
+// home country, then the main country for the code.
+func countryForCode(code, national string, home *Country) *Country {
+	var candidates []*Country
+	for _, id := range Countries() {
+		if c := builtinCountries[id]; c.Code == code {
+			candidates = append(candidates, c)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	if home != nil && home.Code == code && home.pattern.MatchString(national) {
+		return home
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Main && !candidates[j].Main })
+	for _, c := range candidates {
+		if c.pattern.MatchString(national) {
+			return c
+		}
+	}
+	if home != nil && home.Code == code {
+		return home
+	}
+	return candidates[0]
+}
+
+// possible reports whether a national number has one of the country's lengths
+func (c *Country) possible(national string) bool {
+	for _, n := range c.Lengths {
+		if len(national) == n {
+			return true
+		}
+	}
+	return false
+}
+
+// Valid reports whether the number is in use in its country's numbering plan
+func (n *Number) Valid() bool {
+	return n.Country.pattern.MatchString(n.National)
+}
+
+// Format writes the number in the given style
+func (n *Number) Format(style Style) string {
+	if style == StyleE164 {
+		return "+" + n.Country.Code + n.National
+	}
+
+	for _, f := range n.Country.Formats {
+		if f.match != nil && !f.match.MatchString(n.National) {
+			continue
+		}
+		if !f.pattern.MatchString(n.National) {
+			continue
+		}
+		if style == StyleNational {
+			return f.pattern.ReplaceAllString(n.National, f.National)
+		}
+		return "+" + n.Country.Code + " " + f.pattern.ReplaceAllString(n.National, f.International)
+	}
+
+	// Numbers no format covers are written as digits
+	if style == StyleNational {
+		return n.Country.Prefix + n.National
+	}
+	return "+" + n.Country.Code + " " + n.National
+}
@@ -0,0 +1,85 @@
+// Package postal validates and formats postal codes for Parsley
+// Each country's codes are described by patterns stored as JSON, matched
+// against the code with spaces and hyphens removed.
+package postal
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//go:embed data/postal.json
+var embeddedData []byte
+
+// Format is one shape of postal code and how to write it
+type Format struct {
+	// Pattern matches the code without spaces or hyphens, in groups
+	Pattern string `json:"pattern"`
+	// Format is a template for the groups ($1, $2...)
+	Format string `json:"format"`
+
+	pattern *regexp.Regexp
+}
+
+// Country holds the postal code formats of a country
+type Country struct {
+	Name    string   `json:"name"`
+	Formats []Format `json:"formats"`
+}
+
+// builtinCountries holds the embedded postal code formats keyed by upper-case country code
+var builtinCountries = mustParseCountries(embeddedData)
+
+func mustParseCountries(data []byte) map[string]*Country {
+	var raw map[string]*Country
+	if err := json.Unmarshal(data, &raw); err != nil {
+		panic(fmt.Sprintf("postal: invalid embedded data: %s", err))
+	}
+
+	countries := make(map[string]*Country, len(raw))
+	for code, c := range raw {
+		for i := range c.Formats {
+			c.Formats[i].pattern = regexp.MustCompile(`^(?:` + c.Formats[i].Pattern + `)$`)
+		}
+		countries[strings.ToUpper(code)] = c
+	}
+	return countries
+}
+
+// Lookup returns the postal code formats for a country code (e.g., "GB", "us")
+func Lookup(code string) (*Country, bool) {
+	c, ok := builtinCountries[strings.ToUpper(code)]
+	return c, ok
+}
+
+// Countries returns the codes of all embedded countries, sorted
+func Countries() []string {
+	codes := make([]string, 0, len(builtinCountries))
+	for code := range builtinCountries {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// Format writes a postal code the way the country's post office does
+// ("sw1a1aa" is "SW1A 1AA"), reporting false if it isn't a valid code
+func (c *Country) Format(code string) (string, bool) {
+	compact := strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code)))
+	for _, f := range c.Formats {
+		if f.pattern.MatchString(compact) {
+			return f.pattern.ReplaceAllString(compact, f.Format), true
+		}
+	}
+	return "", false
+}
+
+// Valid reports whether a postal code is valid in the country
+func (c *Country) Valid(code string) bool {
+	_, ok := c.Format(code)
+	return ok
+}
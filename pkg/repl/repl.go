@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/peterh/liner"
+	"github.com/sambeau/parsley/pkg/diagnostics"
 	"github.com/sambeau/parsley/pkg/evaluator"
 	"github.com/sambeau/parsley/pkg/lexer"
 	"github.com/sambeau/parsley/pkg/parser"
@@ -23,22 +24,28 @@ const PARSER_LOGO = `
 // Parsley keywords and builtins for tab completion
 var completionWords = []string{
 	// Keywords
-	"let", "if", "else", "for", "in", "fn", "return", "export", "import",
+	"let", "if", "else", "cond", "props", "for", "in", "fn", "return", "export", "import", "from",
 	// Builtins - I/O
 	"log", "logLine", "file", "dir", "JSON", "CSV", "MD", "SVG", "HTML",
 	"text", "lines", "bytes", "SFTP", "Fetch", "SQL",
 	// Builtins - Collections
 	"len", "keys", "values", "type", "sort", "reverse", "join",
+	"windows", "partition", "splitWhen", "get",
 	// Builtins - Strings
 	"split", "trim", "upper", "lower", "contains", "startsWith", "endsWith",
-	"replace", "match", "test",
+	"replace", "match", "test", "trimStart", "trimEnd", "indexOf", "lastIndexOf",
+	"padStart", "padEnd", "repeat", "codePointAt",
 	// Builtins - Math
-	"abs", "floor", "ceil", "round", "sqrt", "pow", "sin", "cos", "tan",
-	"min", "max", "sum",
+	"abs", "floor", "ceil", "round", "idiv", "sqrt", "pow", "sin", "cos", "tan",
+	"min", "max", "sum", "humanSize", "humanCount", "approx",
 	// Builtins - DateTime
 	"now", "date", "time", "duration", "format", "parse",
+	// Builtins - Introspection
+	"typeOf", "isA", "methods", "arity", "repr", "parse", "eval",
 	// Builtins - Other
-	"range", "glob", "toString",
+	"range", "iter", "glob", "toc", "toText", "validateHTML", "seo", "jsonld", "writePDF", "snapshot", "provide", "inject", "provided", "toString",
+	"formatPhone", "validatePhone", "formatPostalCode", "validatePostalCode",
+	"isEmail", "normalizeEmail", "obfuscateEmail",
 	// Common values
 	"true", "false", "null",
 }
@@ -73,6 +80,12 @@ func Start(in io.Reader, out io.Writer, version string) {
 
 	env := evaluator.NewEnvironment()
 
+	// Results are pretty-printed, in color on a terminal
+	prettyOptions := evaluator.DefaultPrettyOptions
+	if f, ok := out.(*os.File); ok {
+		prettyOptions.Color = diagnostics.ColorEnabled(f)
+	}
+
 	fmt.Fprintf(out, "%s", PARSER_LOGO)
 	fmt.Fprintln(out, "v", version)
 	fmt.Fprintln(out, "")
@@ -153,8 +166,14 @@ func Start(in io.Reader, out io.Writer, version string) {
 		}
 
 		evaluated := evaluator.Eval(program, env)
-		if evaluated != nil {
-			io.WriteString(out, evaluated.Inspect())
+		if errObj, ok := evaluated.(*evaluator.Error); ok {
+			io.WriteString(out, errObj.Inspect())
+			io.WriteString(out, "\n")
+			if errObj.Hint != "" {
+				io.WriteString(out, "help: "+errObj.Hint+"\n")
+			}
+		} else if evaluated != nil {
+			io.WriteString(out, evaluator.Pretty(evaluated, prettyOptions))
 			io.WriteString(out, "\n")
 		}
 
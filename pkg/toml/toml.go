@@ -0,0 +1,701 @@
+// Package toml parses TOML documents. It's used for parsley.toml workspace
+// files and by the TOML() file handles and parseTOML() builtin.
+package toml
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Datetime is a TOML date, time or datetime. Kind is "datetime", "date" or
+// "time". Datetimes with an offset are in UTC; the others have no zone.
+type Datetime struct {
+	Time time.Time
+	Kind string
+}
+
+// Parse parses a TOML document. Tables are map[string]interface{}, arrays
+// and arrays of tables are []interface{}, and other values are string,
+// int64, float64, bool or Datetime.
+func Parse(data string) (map[string]interface{}, error) {
+	p := &parser{src: strings.TrimPrefix(data, "\uFEFF"), line: 1, root: newTable()}
+	p.current = p.root
+	if err := p.parse(); err != nil {
+		return nil, fmt.Errorf("line %d: %s", p.line, err.Error())
+	}
+	return plain(p.root).(map[string]interface{}), nil
+}
+
+// plain converts parsed tables to maps and arrays of tables to arrays
+func plain(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *table:
+		values := make(map[string]interface{}, len(v.values))
+		for key, val := range v.values {
+			values[key] = plain(val)
+		}
+		return values
+	case *tableArray:
+		tables := make([]interface{}, len(v.tables))
+		for i, t := range v.tables {
+			tables[i] = plain(t)
+		}
+		return tables
+	case []interface{}:
+		elements := make([]interface{}, len(v))
+		for i, elem := range v {
+			elements[i] = plain(elem)
+		}
+		return elements
+	default:
+		return value
+	}
+}
+
+// table is a table while a document is being parsed. Tables made by a
+// [header] can't be made again, tables made by dotted keys can't be given a
+// header, and inline tables can't be added to at all.
+type table struct {
+	values map[string]interface{}
+	header bool // Defined by a [header]
+	dotted bool // Defined by a dotted key
+	inline bool // Defined by an inline {table}
+}
+
+// tableArray is an array of tables made by [[header]]s
+type tableArray struct {
+	tables []*table
+}
+
+func newTable() *table {
+	return &table{values: make(map[string]interface{})}
+}
+
+// parser parses a TOML document
+type parser struct {
+	src     string
+	pos     int
+	line    int
+	root    *table
+	current *table
+}
+
+func (p *parser) eof() bool { return p.pos >= len(p.src) }
+
+func (p *parser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *parser) hasPrefix(s string) bool { return strings.HasPrefix(p.src[p.pos:], s) }
+
+// skipSpace skips spaces and tabs
+func (p *parser) skipSpace() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.pos++
+	}
+}
+
+// skipComment skips a comment up to the end of the line
+func (p *parser) skipComment() {
+	if p.peek() == '#' {
+		for !p.eof() && p.peek() != '\n' {
+			p.pos++
+		}
+	}
+}
+
+// skipBlank skips whitespace, comments and newlines
+func (p *parser) skipBlank() {
+	for {
+		p.skipSpace()
+		p.skipComment()
+		switch {
+		case p.peek() == '\n':
+			p.pos++
+			p.line++
+		case p.hasPrefix("\r\n"):
+			p.pos += 2
+			p.line++
+		default:
+			return
+		}
+	}
+}
+
+// endLine expects nothing but a comment before the end of the line
+func (p *parser) endLine() error {
+	p.skipSpace()
+	p.skipComment()
+	switch {
+	case p.eof():
+	case p.peek() == '\n':
+		p.pos++
+		p.line++
+	case p.hasPrefix("\r\n"):
+		p.pos += 2
+		p.line++
+	default:
+		return fmt.Errorf("unexpected %q after value", p.peek())
+	}
+	return nil
+}
+
+// parse parses the whole document
+func (p *parser) parse() error {
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return nil
+		}
+		var err error
+		switch {
+		case p.hasPrefix("[["):
+			err = p.parseTableArrayHeader()
+		case p.peek() == '[':
+			err = p.parseTableHeader()
+		default:
+			err = p.parseKeyValue(p.current)
+		}
+		if err != nil {
+			return err
+		}
+		if err := p.endLine(); err != nil {
+			return err
+		}
+	}
+}
+
+// parseKey parses a key, returning the parts of a dotted key
+func (p *parser) parseKey() ([]string, error) {
+	var parts []string
+	for {
+		p.skipSpace()
+		var part string
+		switch c := p.peek(); {
+		case c == '"':
+			s, err := p.parseBasicString()
+			if err != nil {
+				return nil, err
+			}
+			part = s
+		case c == '\'':
+			s, err := p.parseLiteralString()
+			if err != nil {
+				return nil, err
+			}
+			part = s
+		default:
+			start := p.pos
+			for !p.eof() && isBareKeyChar(p.peek()) {
+				p.pos++
+			}
+			if p.pos == start {
+				if p.eof() || p.peek() == '\n' || p.peek() == '\r' {
+					return nil, fmt.Errorf("expected a key")
+				}
+				return nil, fmt.Errorf("unexpected %q in key", p.peek())
+			}
+			part = p.src[start:p.pos]
+		}
+		parts = append(parts, part)
+		p.skipSpace()
+		if p.peek() != '.' {
+			return parts, nil
+		}
+		p.pos++
+	}
+}
+
+// IsBareKey reports whether key can be written without quotes
+func IsBareKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if !isBareKeyChar(key[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// isBareKeyChar reports whether c can appear in an unquoted key
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// parseTableHeader parses a [table] header and makes it the current table
+func (p *parser) parseTableHeader() error {
+	p.pos++
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	if p.peek() != ']' {
+		return fmt.Errorf("expected ] to end table header")
+	}
+	p.pos++
+
+	parent, err := p.descend(p.root, keys[:len(keys)-1], true)
+	if err != nil {
+		return err
+	}
+	name := keys[len(keys)-1]
+	switch existing := parent.values[name].(type) {
+	case nil:
+		t := newTable()
+		t.header = true
+		parent.values[name] = t
+		p.current = t
+	case *table:
+		if existing.header || existing.dotted || existing.inline {
+			return fmt.Errorf("table %s is defined more than once", strings.Join(keys, "."))
+		}
+		existing.header = true
+		p.current = existing
+	default:
+		return fmt.Errorf("key %s is already defined and isn't a table", strings.Join(keys, "."))
+	}
+	return nil
+}
+
+// parseTableArrayHeader parses an [[array]] header, adding a table to the
+// array and making it the current table
+func (p *parser) parseTableArrayHeader() error {
+	p.pos += 2
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	if !p.hasPrefix("]]") {
+		return fmt.Errorf("expected ]] to end array of tables header")
+	}
+	p.pos += 2
+
+	parent, err := p.descend(p.root, keys[:len(keys)-1], true)
+	if err != nil {
+		return err
+	}
+	name := keys[len(keys)-1]
+	t := newTable()
+	t.header = true
+	switch existing := parent.values[name].(type) {
+	case nil:
+		parent.values[name] = &tableArray{tables: []*table{t}}
+	case *tableArray:
+		existing.tables = append(existing.tables, t)
+	default:
+		return fmt.Errorf("key %s is already defined and isn't an array of tables", strings.Join(keys, "."))
+	}
+	p.current = t
+	return nil
+}
+
+// descend finds the table the keys lead to from t, making any that
+// don't exist. In headers, arrays of tables lead to their last table; in
+// dotted keys, the tables passed through can't have been defined by headers.
+func (p *parser) descend(t *table, keys []string, inHeader bool) (*table, error) {
+	for i, key := range keys {
+		switch existing := t.values[key].(type) {
+		case nil:
+			next := newTable()
+			next.dotted = !inHeader
+			t.values[key] = next
+			t = next
+		case *table:
+			if existing.inline || (!inHeader && existing.header) {
+				return nil, fmt.Errorf("table %s can't be added to here", strings.Join(keys[:i+1], "."))
+			}
+			if !inHeader && !existing.dotted {
+				existing.dotted = true
+			}
+			t = existing
+		case *tableArray:
+			if !inHeader {
+				return nil, fmt.Errorf("key %s is an array of tables", strings.Join(keys[:i+1], "."))
+			}
+			t = existing.tables[len(existing.tables)-1]
+		default:
+			return nil, fmt.Errorf("key %s is already defined and isn't a table", strings.Join(keys[:i+1], "."))
+		}
+	}
+	return t, nil
+}
+
+// parseKeyValue parses key = value into t
+func (p *parser) parseKeyValue(t *table) error {
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	if p.peek() != '=' {
+		return fmt.Errorf("expected = after key %s", strings.Join(keys, "."))
+	}
+	p.pos++
+	p.skipSpace()
+	value, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+
+	parent, err := p.descend(t, keys[:len(keys)-1], false)
+	if err != nil {
+		return err
+	}
+	name := keys[len(keys)-1]
+	if _, exists := parent.values[name]; exists {
+		return fmt.Errorf("key %s is defined more than once", strings.Join(keys, "."))
+	}
+	parent.values[name] = value
+	return nil
+}
+
+// parseValue parses any value
+func (p *parser) parseValue() (interface{}, error) {
+	switch c := p.peek(); {
+	case p.eof() || c == '\n' || c == '\r':
+		return nil, fmt.Errorf("expected a value")
+	case p.hasPrefix(`"""`):
+		return p.parseMultilineString(`"""`)
+	case c == '"':
+		return p.parseBasicString()
+	case p.hasPrefix("'''"):
+		return p.parseMultilineString("'''")
+	case c == '\'':
+		return p.parseLiteralString()
+	case c == '[':
+		return p.parseArray()
+	case c == '{':
+		return p.parseInlineTable()
+	case p.hasPrefix("true") && !p.bareCharAt(p.pos+4):
+		p.pos += 4
+		return true, nil
+	case p.hasPrefix("false") && !p.bareCharAt(p.pos+5):
+		p.pos += 5
+		return false, nil
+	default:
+		return p.parseNumberOrDatetime()
+	}
+}
+
+// bareCharAt reports whether the character at i continues a bare word
+func (p *parser) bareCharAt(i int) bool {
+	return i < len(p.src) && isBareKeyChar(p.src[i])
+}
+
+// parseBasicString parses a "string" with escapes
+func (p *parser) parseBasicString() (string, error) {
+	p.pos++
+	var sb strings.Builder
+	for {
+		if p.eof() || p.peek() == '\n' || p.peek() == '\r' {
+			return "", fmt.Errorf("unterminated string")
+		}
+		c := p.peek()
+		switch c {
+		case '"':
+			p.pos++
+			return sb.String(), nil
+		case '\\':
+			if err := p.parseEscape(&sb); err != nil {
+				return "", err
+			}
+		default:
+			sb.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+// parseLiteralString parses a 'string' without escapes
+func (p *parser) parseLiteralString() (string, error) {
+	p.pos++
+	start := p.pos
+	for {
+		if p.eof() || p.peek() == '\n' || p.peek() == '\r' {
+			return "", fmt.Errorf("unterminated string")
+		}
+		if p.peek() == '\'' {
+			s := p.src[start:p.pos]
+			p.pos++
+			return s, nil
+		}
+		p.pos++
+	}
+}
+
+// parseMultilineString parses a multi-line string between three double or
+// single quotes. A newline straight after the opening quotes is dropped, and
+// between double quotes a backslash at the end of a line joins it to the
+// next non-blank text.
+func (p *parser) parseMultilineString(quotes string) (string, error) {
+	p.pos += 3
+	if p.hasPrefix("\r\n") {
+		p.pos += 2
+		p.line++
+	} else if p.peek() == '\n' {
+		p.pos++
+		p.line++
+	}
+
+	var sb strings.Builder
+	for {
+		if p.eof() {
+			return "", fmt.Errorf("unterminated multi-line string")
+		}
+		if p.hasPrefix(quotes) {
+			// Up to two more quotes can end the string's content
+			n := 3
+			for n < 5 && p.pos+n < len(p.src) && p.src[p.pos+n] == quotes[0] {
+				n++
+			}
+			sb.WriteString(strings.Repeat(quotes[:1], n-3))
+			p.pos += n
+			return sb.String(), nil
+		}
+		c := p.peek()
+		switch {
+		case c == '\n':
+			sb.WriteByte(c)
+			p.pos++
+			p.line++
+		case c == '\\' && quotes == `"""`:
+			// A backslash followed by only whitespace to the end of the line
+			rest := p.pos + 1
+			for rest < len(p.src) && (p.src[rest] == ' ' || p.src[rest] == '\t') {
+				rest++
+			}
+			if rest < len(p.src) && (p.src[rest] == '\n' || p.src[rest] == '\r') {
+				p.pos = rest
+				for !p.eof() && strings.ContainsRune(" \t\r\n", rune(p.peek())) {
+					if p.peek() == '\n' {
+						p.line++
+					}
+					p.pos++
+				}
+				continue
+			}
+			if err := p.parseEscape(&sb); err != nil {
+				return "", err
+			}
+		default:
+			sb.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+// parseEscape parses a backslash escape in a basic string
+func (p *parser) parseEscape(sb *strings.Builder) error {
+	p.pos++
+	if p.eof() {
+		return fmt.Errorf("unterminated string")
+	}
+	c := p.peek()
+	p.pos++
+	switch c {
+	case 'b':
+		sb.WriteByte('\b')
+	case 't':
+		sb.WriteByte('\t')
+	case 'n':
+		sb.WriteByte('\n')
+	case 'f':
+		sb.WriteByte('\f')
+	case 'r':
+		sb.WriteByte('\r')
+	case 'e':
+		sb.WriteByte(0x1B)
+	case '"':
+		sb.WriteByte('"')
+	case '\\':
+		sb.WriteByte('\\')
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		if p.pos+n > len(p.src) {
+			return fmt.Errorf("invalid unicode escape")
+		}
+		code, err := strconv.ParseUint(p.src[p.pos:p.pos+n], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return fmt.Errorf("invalid unicode escape \\%c%s", c, p.src[p.pos:p.pos+n])
+		}
+		sb.WriteRune(rune(code))
+		p.pos += n
+	default:
+		return fmt.Errorf("invalid escape \\%c", c)
+	}
+	return nil
+}
+
+// parseArray parses an [array], which may span lines
+func (p *parser) parseArray() (interface{}, error) {
+	p.pos++
+	elements := []interface{}{}
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return nil, fmt.Errorf("unterminated array")
+		}
+		if p.peek() == ']' {
+			p.pos++
+			return elements, nil
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, value)
+		p.skipBlank()
+		if p.eof() {
+			return nil, fmt.Errorf("unterminated array")
+		}
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+			p.pos++
+			return elements, nil
+		default:
+			return nil, fmt.Errorf("expected , or ] in array")
+		}
+	}
+}
+
+// parseInlineTable parses an {inline = "table"}
+func (p *parser) parseInlineTable() (interface{}, error) {
+	p.pos++
+	t := newTable()
+	p.skipSpace()
+	if p.peek() == '}' {
+		p.pos++
+		t.inline = true
+		return t, nil
+	}
+	for {
+		if err := p.parseKeyValue(t); err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			markInline(t)
+			return t, nil
+		default:
+			return nil, fmt.Errorf("expected , or } in inline table")
+		}
+	}
+}
+
+// markInline marks an inline table and the tables its dotted keys made
+// as complete
+func markInline(t *table) {
+	t.inline = true
+	for _, value := range t.values {
+		if sub, ok := value.(*table); ok {
+			markInline(sub)
+		}
+	}
+}
+
+var (
+	intPattern   = regexp.MustCompile(`^[+-]?(0|[1-9](_?[0-9])*)$`)
+	hexPattern   = regexp.MustCompile(`^0x[0-9A-Fa-f](_?[0-9A-Fa-f])*$`)
+	octPattern   = regexp.MustCompile(`^0o[0-7](_?[0-7])*$`)
+	binPattern   = regexp.MustCompile(`^0b[01](_?[01])*$`)
+	floatPattern = regexp.MustCompile(`^[+-]?(0|[1-9](_?[0-9])*)(\.[0-9](_?[0-9])*)?([eE][+-]?[0-9](_?[0-9])*)?$`)
+	datePattern  = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+)
+
+// parseNumberOrDatetime parses an integer, float, date, time or datetime
+func (p *parser) parseNumberOrDatetime() (interface{}, error) {
+	start := p.pos
+	for !p.eof() && (isBareKeyChar(p.peek()) || strings.IndexByte("+.:", p.peek()) >= 0) {
+		p.pos++
+	}
+	token := p.src[start:p.pos]
+	// A date may be separated from its time by a space
+	if datePattern.MatchString(token) && p.peek() == ' ' && p.pos+3 < len(p.src) &&
+		isDigit(p.src[p.pos+1]) && isDigit(p.src[p.pos+2]) && p.src[p.pos+3] == ':' {
+		p.pos++
+		for !p.eof() && (isBareKeyChar(p.peek()) || strings.IndexByte("+.:", p.peek()) >= 0) {
+			p.pos++
+		}
+		token = p.src[start:p.pos]
+	}
+	if token == "" {
+		return nil, fmt.Errorf("unexpected %q", p.peek())
+	}
+
+	switch strings.TrimLeft(token, "+-") {
+	case "inf":
+		if token[0] == '-' {
+			return math.Inf(-1), nil
+		}
+		return math.Inf(1), nil
+	case "nan":
+		return math.NaN(), nil
+	}
+
+	switch {
+	case intPattern.MatchString(token):
+		n, err := strconv.ParseInt(strings.ReplaceAll(token, "_", ""), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("integer %s is out of range", token)
+		}
+		return n, nil
+	case hexPattern.MatchString(token), octPattern.MatchString(token), binPattern.MatchString(token):
+		base := map[byte]int{'x': 16, 'o': 8, 'b': 2}[token[1]]
+		n, err := strconv.ParseInt(strings.ReplaceAll(token[2:], "_", ""), base, 64)
+		if err != nil {
+			return nil, fmt.Errorf("integer %s is out of range", token)
+		}
+		return n, nil
+	case floatPattern.MatchString(token):
+		f, err := strconv.ParseFloat(strings.ReplaceAll(token, "_", ""), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float %s", token)
+		}
+		return f, nil
+	case strings.ContainsAny(token, "-:"):
+		return parseDatetime(token)
+	}
+	return nil, fmt.Errorf("invalid value %s", token)
+}
+
+// parseDatetime parses a date, a time, or a datetime with or without an
+// offset. Datetimes with an offset are converted to UTC.
+func parseDatetime(token string) (interface{}, error) {
+	s := strings.ToUpper(strings.Replace(token, " ", "T", 1))
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return Datetime{Time: t.UTC(), Kind: "datetime"}, nil
+	}
+	layouts := []struct{ layout, kind string }{
+		{"2006-01-02T15:04:05.999999999", "datetime"},
+		{"2006-01-02T15:04", "datetime"},
+		{"2006-01-02", "date"},
+		{"15:04:05.999999999", "time"},
+		{"15:04", "time"},
+	}
+	for _, l := range layouts {
+		if t, err := time.Parse(l.layout, s); err == nil {
+			return Datetime{Time: t, Kind: l.kind}, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid value %s", token)
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
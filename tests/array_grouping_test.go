@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+func TestArrayGrouping(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// windows(arr, n)
+		{`windows([1, 2, 3, 4], 2)`, "[[1, 2], [2, 3], [3, 4]]"},
+		{`windows([1, 2, 3], 3)`, "[[1, 2, 3]]"},
+		{`windows([1, 2], 3)`, "[]"},
+		{`windows([], 1)`, "[]"},
+
+		// partition(arr, fn)
+		{`partition([1, 2, 3, 4, 5], fn(x) { x % 2 == 1 })`, "[[1, 3, 5], [2, 4]]"},
+		{`partition([1, 2], fn(x) { x > 5 })`, "[[], [1, 2]]"},
+		{`let [small, big] = partition([5, 50, 8, 80], fn(x) { x < 10 }); big`, "[50, 80]"},
+
+		// splitWhen(arr, fn(prev, curr))
+		{`splitWhen([1, 2, 4, 5, 7], fn(a, b) { b - a > 1 })`, "[[1, 2], [4, 5], [7]]"},
+		{`splitWhen([1, 2, 3], fn(a, b) { false })`, "[[1, 2, 3]]"},
+		{`splitWhen([1, 2, 3], fn(a, b) { true })`, "[[1], [2], [3]]"},
+		{`splitWhen([], fn(a, b) { true })`, "[]"},
+		{`let posts = [{day: "mon", id: 1}, {day: "mon", id: 2}, {day: "tue", id: 3}];
+splitWhen(posts, fn(a, b) { a.day != b.day }).map(fn(group) { group.length() })`, "[2, 1]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Type() == evaluator.ERROR_OBJ {
+				t.Fatalf("Evaluation error: %s", result.Inspect())
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestArrayGroupingErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		errorContains string
+	}{
+		{`windows([1, 2], 0)`, "must be a positive integer"},
+		{`windows("ab", 1)`, "first argument to `windows` must be an array"},
+		{`partition([1], 1)`, "second argument to `partition` must be a function"},
+		{`partition([1], fn(x) { x - "a" })`, "type mismatch"},
+		{`splitWhen([1, 2], fn(x) { x })`, "must take 2 parameters (previous, current)"},
+		{`splitWhen([1, 2], fn(a, b) { a - "b" })`, "type mismatch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Type() != evaluator.ERROR_OBJ {
+				t.Fatalf("expected error, got %s", result.Inspect())
+			}
+			if !strings.Contains(result.Inspect(), tt.errorContains) {
+				t.Errorf("expected error containing %q, got %q", tt.errorContains, result.Inspect())
+			}
+		})
+	}
+}
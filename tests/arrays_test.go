@@ -67,10 +67,7 @@ func TestArrayAssignment(t *testing.T) {
 				t.Fatalf("Parser errors: %v", p.Errors())
 			}
 
-			var result evaluator.Object
-			for _, stmt := range program.Statements {
-				result = evaluator.Eval(stmt, env)
-			}
+			result := evaluator.Eval(program, env)
 
 			if result == nil {
 				t.Fatalf("Eval returned nil")
@@ -105,10 +102,7 @@ func TestForFunctionMapping(t *testing.T) {
 				t.Fatalf("Parser errors: %v", p.Errors())
 			}
 
-			var result evaluator.Object
-			for _, stmt := range program.Statements {
-				result = evaluator.Eval(stmt, env)
-			}
+			result := evaluator.Eval(program, env)
 
 			if result == nil {
 				t.Fatalf("Eval returned nil")
@@ -142,10 +136,7 @@ func TestForFunctionFiltering(t *testing.T) {
 				t.Fatalf("Parser errors: %v", p.Errors())
 			}
 
-			var result evaluator.Object
-			for _, stmt := range program.Statements {
-				result = evaluator.Eval(stmt, env)
-			}
+			result := evaluator.Eval(program, env)
 
 			if result == nil {
 				t.Fatalf("Eval returned nil")
@@ -178,10 +169,7 @@ func TestForWithArrayVariable(t *testing.T) {
 				t.Fatalf("Parser errors: %v", p.Errors())
 			}
 
-			var result evaluator.Object
-			for _, stmt := range program.Statements {
-				result = evaluator.Eval(stmt, env)
-			}
+			result := evaluator.Eval(program, env)
 
 			if result == nil {
 				t.Fatalf("Eval returned nil")
@@ -214,10 +202,7 @@ func TestForWithComplexExpressions(t *testing.T) {
 				t.Fatalf("Parser errors: %v", p.Errors())
 			}
 
-			var result evaluator.Object
-			for _, stmt := range program.Statements {
-				result = evaluator.Eval(stmt, env)
-			}
+			result := evaluator.Eval(program, env)
 
 			if result == nil {
 				t.Fatalf("Eval returned nil")
@@ -251,10 +236,7 @@ func TestArrayPrecedence(t *testing.T) {
 				t.Fatalf("Parser errors: %v", p.Errors())
 			}
 
-			var result evaluator.Object
-			for _, stmt := range program.Statements {
-				result = evaluator.Eval(stmt, env)
-			}
+			result := evaluator.Eval(program, env)
 
 			if result == nil {
 				t.Fatalf("Eval returned nil")
@@ -328,10 +310,7 @@ func TestBracketArrayDestructuring(t *testing.T) {
 				t.Fatalf("Parser errors: %v", p.Errors())
 			}
 
-			var result evaluator.Object
-			for _, stmt := range program.Statements {
-				result = evaluator.Eval(stmt, env)
-			}
+			result := evaluator.Eval(program, env)
 
 			if result == nil {
 				t.Fatalf("Eval returned nil")
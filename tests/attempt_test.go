@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+func TestAttempt(t *testing.T) {
+	dir := filepath.ToSlash(t.TempDir())
+	os.WriteFile(filepath.Join(dir, "settings.json"), []byte(`{"theme": "dark"}`), 0644)
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"success", `let r = attempt(fn() { 1 + 2 }); [r.ok, r.value, r.error]`, `[true, 3, null]`},
+		{"failure", `let r = attempt(fn() { 10 / 0 }); [r.ok, r.value, r.error]`, `[false, null, division by zero]`},
+		{"null result", `attempt(fn() { null }).value`, `null`},
+		{"destructuring", `let {ok, value} = attempt(fn() { let s <== JSON("` + dir + `/settings.json"); s }); if (ok) { value.theme }`, `dark`},
+		{"missing file", `let {ok, error} = attempt(fn() { let s <== JSON("` + dir + `/missing.json"); s }); [ok, error.contains("missing.json")]`, `[false, true]`},
+		{"nested", `attempt(fn() { let inner = attempt(fn() { 1 / 0 }); if (inner.ok) { "no" } else { "recovered" } }).value`, `recovered`},
+		{"carries on", `let r = attempt(fn() { [1, 2][5] }); r.ok; "after"`, `after`},
+		{"closure", `let x = 1; attempt(fn() { x = 2 }); x`, `2`},
+		{"builtin", `attempt(now).ok`, `true`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestAttemptDoesNotCatchGeneratorStop(t *testing.T) {
+	result := testEvalHelper(`
+		let produced = 0
+		let gen = iter(fn(yield) {
+			for (i in [1, 2, 3, 4, 5]) {
+				attempt(fn() { yield(i) })
+				produced = produced + 1
+			}
+		})
+		let taken = gen.take(2).toArray();
+		[taken, produced]
+	`)
+	if result.Inspect() != "[[1, 2], 1]" {
+		t.Errorf("expected the generator to stop after its second element, got %s", result.Inspect())
+	}
+}
+
+func TestAttemptErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`attempt()`, "wrong number of arguments"},
+		{`attempt(fn() { 1 }, 2)`, "wrong number of arguments"},
+		{`attempt(5)`, "must be a function"},
+		{`attempt(fn(x) { x })`, "must take no parameters"},
+		{`attempt(1 / 0)`, "division by zero"},
+	}
+
+	for _, tt := range tests {
+		result := testEvalHelper(tt.input)
+		errObj, ok := result.(*evaluator.Error)
+		if !ok || !strings.Contains(errObj.Message, tt.expected) {
+			t.Errorf("%s: expected error containing %q, got %s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/bundle"
+)
+
+func writeBundleTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBundleCollect(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeBundleTestFiles(t, tmpDir, map[string]string{
+		"site/main.pars":      `let util = import(@./lib/util.pars)` + "\n" + `<p>{util.title}</p>`,
+		"site/lib/util.pars":  `let data = JSON(@../../data/site.json)` + "\n" + `export title = "x"; let out = @./missing.json`,
+		"data/site.json":      `{"title": "Site"}`,
+		"site/assets/a.css":   `p {}`,
+		"site/assets/img.svg": `<svg/>`,
+		"site/unused.txt":     `not referenced`,
+	})
+
+	root, files, err := bundle.Collect(filepath.Join(tmpDir, "site/main.pars"), []string{filepath.Join(tmpDir, "site/assets")})
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	if root != tmpDir {
+		t.Errorf("expected root %q, got %q", tmpDir, root)
+	}
+
+	var rel []string
+	for _, f := range files {
+		r, _ := filepath.Rel(root, f)
+		rel = append(rel, filepath.ToSlash(r))
+	}
+	expected := []string{"site/main.pars", "data/site.json", "site/assets/a.css", "site/assets/img.svg", "site/lib/util.pars"}
+	if !reflect.DeepEqual(rel, expected) {
+		t.Errorf("expected files %v, got %v", expected, rel)
+	}
+
+	entry, err := bundle.EntryName(root, filepath.Join(tmpDir, "site/main.pars"))
+	if err != nil || entry != "site/main.pars" {
+		t.Errorf("expected entry site/main.pars, got %q (%v)", entry, err)
+	}
+}
+
+func TestBundleWriteAndExtract(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeBundleTestFiles(t, tmpDir, map[string]string{
+		"main.pars":      `let data = JSON(@./data.json)` + "\n" + `data.title`,
+		"data.json":      `{"title": "Report"}`,
+		"second.pars":    `"second"`,
+		"plain-exe.bin":  "#!not really an executable\n",
+		"other/note.txt": "unused",
+	})
+	exe, _ := os.ReadFile(filepath.Join(tmpDir, "plain-exe.bin"))
+
+	// Plain executables have no bundle
+	if b, err := bundle.Open(filepath.Join(tmpDir, "plain-exe.bin")); b != nil || err != nil {
+		t.Fatalf("expected no bundle, got %v, %v", b, err)
+	}
+
+	root, files, err := bundle.Collect(filepath.Join(tmpDir, "main.pars"), nil)
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	manifest := bundle.Manifest{Entry: "main.pars", Version: "test", AllowWriteAll: true, Pretty: true}
+	var buf bytes.Buffer
+	if err := bundle.Write(&buf, exe, manifest, root, files); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), exe) {
+		t.Fatal("bundle doesn't start with the executable")
+	}
+	bundled := filepath.Join(tmpDir, "report")
+	if err := os.WriteFile(bundled, buf.Bytes(), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := bundle.Open(bundled)
+	if err != nil || b == nil {
+		t.Fatalf("Open: %v, %v", b, err)
+	}
+	if !reflect.DeepEqual(b.Manifest, manifest) {
+		t.Errorf("expected manifest %+v, got %+v", manifest, b.Manifest)
+	}
+	if got := strings.Join(b.Files(), ","); got != "main.pars,data.json" {
+		t.Errorf("unexpected files %q", got)
+	}
+
+	cache := filepath.Join(tmpDir, "cache")
+	entry, err := b.Extract(cache)
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	if entry != filepath.Join(cache, b.Hash, "main.pars") {
+		t.Errorf("unexpected entry %q", entry)
+	}
+	data, err := os.ReadFile(filepath.Join(cache, b.Hash, "data.json"))
+	if err != nil || string(data) != `{"title": "Report"}` {
+		t.Errorf("unexpected extracted data %q (%v)", data, err)
+	}
+
+	// Extracting again reuses the files
+	if again, err := b.Extract(cache); err != nil || again != entry {
+		t.Errorf("second Extract: %q, %v", again, err)
+	}
+
+	// Bundling from a bundled executable replaces its bundle
+	buf.Reset()
+	second := bundle.Manifest{Entry: "second.pars", Version: "test"}
+	previous, err := os.ReadFile(bundled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bundle.Write(&buf, previous, second, root, []string{filepath.Join(tmpDir, "second.pars")}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), exe) || bytes.Contains(buf.Bytes(), []byte(`{"title": "Report"}`)) {
+		t.Fatal("rebundled executable should be the executable and the new bundle only")
+	}
+	if err := os.WriteFile(bundled, buf.Bytes(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	b, err = bundle.Open(bundled)
+	if err != nil || b == nil {
+		t.Fatalf("Open: %v, %v", b, err)
+	}
+	if got := strings.Join(b.Files(), ","); got != "second.pars" {
+		t.Errorf("unexpected files after rebundling %q", got)
+	}
+}
+
+// TestBundleRunImportsOwnModules builds pars, bundles a script that imports
+// a module beside it with writes allowed, and runs the bundle, which can
+// import its own modules without -x
+func TestBundleRunImportsOwnModules(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds pars")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go not found")
+	}
+	tmpDir := t.TempDir()
+	pars := filepath.Join(tmpDir, "pars")
+	build := exec.Command(goTool, "build", "-o", pars, "../cmd/pars")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("building pars: %v\n%s", err, out)
+	}
+
+	writeBundleTestFiles(t, tmpDir, map[string]string{
+		"report.pars":   `let util = import(@./lib/util.pars)` + "\n" + `util.title`,
+		"lib/util.pars": `export title = "Report"`,
+		"outside.pars":  `let util = import(@` + filepath.ToSlash(filepath.Join(tmpDir, "lib/util.pars")) + `)` + "\n" + `util.title`,
+	})
+	cacheEnv := append(os.Environ(), "XDG_CACHE_HOME="+filepath.Join(tmpDir, "cache"), "HOME="+tmpDir)
+
+	run := func(script string) (string, error) {
+		bundled := filepath.Join(tmpDir, strings.TrimSuffix(script, ".pars"))
+		cmd := exec.Command(pars, "-w", "bundle", script, "-o", bundled)
+		cmd.Dir = tmpDir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("bundling %s: %v\n%s", script, err, out)
+		}
+		cmd = exec.Command(bundled)
+		cmd.Env = cacheEnv
+		out, err := cmd.CombinedOutput()
+		return strings.TrimSpace(string(out)), err
+	}
+
+	if out, err := run("report.pars"); err != nil || out != "Report" {
+		t.Errorf("expected the bundle to import its own module and print Report, got %q (%v)", out, err)
+	}
+	if out, err := run("outside.pars"); err == nil || !strings.Contains(out, "script execution not allowed") {
+		t.Errorf("expected importing a module outside the bundle to need -x, got %q (%v)", out, err)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+	"github.com/sambeau/parsley/pkg/lexer"
+	"github.com/sambeau/parsley/pkg/parser"
+)
+
+func evalCassetteTest(input string) evaluator.Object {
+	program := parser.New(lexer.New(input)).ParseProgram()
+	env := evaluator.NewEnvironment()
+	env.Security = &evaluator.SecurityPolicy{AllowExecuteAll: true}
+	return evaluator.Eval(program, env)
+}
+
+func TestRecordReplay(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name": "Ada"}`))
+	}))
+
+	input := `let {data} <=/= JSON(url("` + server.URL + `/users/1"))
+let db = SQLITE(":memory:")
+let made = db <=!=> "CREATE TABLE replayed (a INTEGER)"
+let added = db <=!=> "INSERT INTO replayed VALUES (7)"
+let row = db <=?=> "SELECT a FROM replayed"
+let out = COMMAND("echo", ["hi"]) <=#=> null;
+[data.name, added.affected, row.a, out.stdout.trim()]`
+	expected := "[Ada, 1, 7, hi]"
+
+	cassette := &evaluator.Cassette{}
+	evaluator.RecordTo(cassette)
+	result := evalCassetteTest(input)
+	evaluator.RecordTo(nil)
+	server.Close()
+	if result.Inspect() != expected {
+		t.Fatalf("recording: expected %s, got %s", expected, result.Inspect())
+	}
+	if len(cassette.Interactions) != 5 {
+		t.Fatalf("expected 5 interactions, got %d", len(cassette.Interactions))
+	}
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	if err := cassette.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := evaluator.LoadCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The server is gone, so the replay can only answer from the cassette
+	evaluator.ReplayFrom(loaded)
+	defer evaluator.ReplayFrom(nil)
+	result = evalCassetteTest(input)
+	if result.Inspect() != expected {
+		t.Errorf("replay: expected %s, got %s", expected, result.Inspect())
+	}
+	if requests != 1 {
+		t.Errorf("expected 1 request to the server, got %d", requests)
+	}
+}
+
+func TestReplayMissingInteraction(t *testing.T) {
+	evaluator.ReplayFrom(&evaluator.Cassette{})
+	defer evaluator.ReplayFrom(nil)
+
+	result := evalCassetteTest(`let db = SQLITE(":memory:")
+let rows = db <=??=> "SELECT 1"`)
+	if result.Type() != evaluator.ERROR_OBJ || !strings.Contains(result.Inspect(), "replay: no recorded sql for SELECT 1") {
+		t.Errorf("expected a replay error, got %s", result.Inspect())
+	}
+}
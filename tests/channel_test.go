@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+func TestChannels(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"send and receive", `let c = channel(2); c.send(1); c.send("a"); [c.length(), c.receive(), c.receive(), c.length()]`, "[2, 1, a, 0]"},
+		{"closed channel drains", `let c = channel(1); c.send(1); c.close(); [c.isClosed(), c.receive(), c.receive()]`, "[true, 1, null]"},
+		{"for over closed channel", `let c = channel(3); c.send(1); c.send(2); c.close(); for (x in c) { x * 10 }`, "[10, 20]"},
+		{"select takes a ready channel", `let a = channel(1); let b = channel(1); b.send("b"); let r = select([a, b]); [r.index, r.value, r.ok]`, "[1, b, true]"},
+		{"select on closed channel", `let a = channel(); a.close(); let r = select([a]); [r.index, r.value, r.ok]`, "[0, null, false]"},
+		{"select timeout", `select([channel()], {timeout: @0s})`, "null"},
+		{"typeOf", `typeOf(channel())`, "channel"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestChannelsInParallel(t *testing.T) {
+	result := testEvalHelper(`
+		let numbers = channel()
+		let squares = channel(4)
+		let total = counter()
+		let produce = fn() {
+			for (i in 1..100) { numbers.send(i) }
+			numbers.close()
+		}
+		let square = fn() {
+			for (n in numbers) { squares.send(n * n) }
+			squares.close()
+		}
+		let sum = fn() { for (s in squares) { total.add(s) } }
+		parallel([produce, square, sum], fn(task) { task() }, {concurrency: 3});
+		total.value()
+	`)
+	if result.Inspect() != "338350" {
+		t.Errorf("expected the pipeline to pass every value through, got %s", result.Inspect())
+	}
+
+	result = testEvalHelper(`
+		let a = channel()
+		let b = channel()
+		let send = fn() { a.send(1); b.send(2); a.close(); b.close() }
+		let take = fn() {
+			let got = []
+			let open = 2
+			for (_ in 1..10) {
+				if (open > 0) {
+					let r = select([a, b])
+					if (r.ok) { got = got ++ [r.value] } else { open = open - 1 }
+				}
+			}
+			got
+		}
+		parallel([send, take], fn(task) { task() }, {concurrency: 2})
+	`)
+	if result.Inspect() != "[[1, 2]]" {
+		t.Errorf("expected select to receive from both channels, got %s", result.Inspect())
+	}
+}
+
+func TestChannelErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`channel(-1)`, "non-negative integer"},
+		{`channel(1, 2)`, "wrong number of arguments"},
+		{`channel().receive()`, "would wait forever outside parallel()"},
+		{`channel().send(1)`, "would wait forever outside parallel()"},
+		{`select([channel()])`, "would wait forever outside parallel()"},
+		{`select([1])`, "must be an array of channels"},
+		{`select([channel()], {timeout: 5})`, "must be a duration"},
+		{`let c = channel(1); c.close(); c.send(1)`, "closed channel"},
+		{`let c = channel(); c.close(); c.close()`, "already closed"},
+		{`channel().peek()`, "unknown method 'peek' for channel"},
+		{`let c = channel(); parallel([1, 2], fn(i) { c.receive() }, {concurrency: 2})`, "deadlock"},
+		{`let c = channel(); parallel([1], fn(i) { c.send(i); c.receive() })`, "deadlock"},
+		{`let c = channel(); parallel([1, 2], fn(i) { if (i == 1) { c.receive() } else { 1 / 0 } }, {concurrency: 2})`, "division by zero"},
+	}
+
+	for _, tt := range tests {
+		result := testEvalHelper(tt.input)
+		errObj, ok := result.(*evaluator.Error)
+		if !ok || !strings.Contains(errObj.Message, tt.expected) {
+			t.Errorf("%s: expected error containing %q, got %s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
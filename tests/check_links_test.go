@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+// writeSite writes files into dir, creating directories as needed
+func writeSite(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCheckLinks(t *testing.T) {
+	good := filepath.ToSlash(t.TempDir())
+	writeSite(t, good, map[string]string{
+		"index.html":      `<a href="/about">About</a> <a href="blog/">Blog</a> <a href="#top" id="top">Top</a> <a href="mailto:me@example.com">Mail</a> <a href="https://example.com/">Out</a>`,
+		"about.html":      `<link rel="stylesheet" href="css/site.css"><img src="img/a.png" srcset="img/a.png 1x, img/a@2x.png 2x">`,
+		"blog/index.html": `<h2 id="intro">Intro</h2><a href="../about.html?ref=blog">About</a> <a href="/blog/#intro">Intro</a>`,
+		"css/site.css":    `body {}`,
+		"img/a.png":       ``,
+		"img/a@2x.png":    ``,
+	})
+
+	bad := filepath.ToSlash(t.TempDir())
+	writeSite(t, bad, map[string]string{
+		"index.html":      `<a href="/missing">x</a> <a href="#nope">x</a> <a href="../../etc/passwd">x</a> <a href="blog/#nope">x</a>`,
+		"blog/index.html": `<img src="logo.png"> <a href="https://example.com/blog/">ok</a>`,
+		"sitemap.xml":     `<urlset><url><loc>https://example.com/</loc></url><url><loc>https://example.com/gone</loc></url></urlset>`,
+	})
+
+	tests := []struct {
+		name     string
+		code     string
+		expected string
+	}{
+		{"clean site", `let r = checkLinks(path("` + good + `")); [r.ok, r.pages, r.links, r.broken]`, "[true, 3, 11, []]"},
+		{"directory handle", `checkLinks(dir("` + good + `")).ok`, "true"},
+		{"broken links", `checkLinks("` + bad + `").broken.map(fn(b) { b.page + " " + b.link + " " + b.reason })`,
+			"[blog/index.html logo.png not found, index.html /missing not found, index.html #nope no #nope on index.html, index.html ../../etc/passwd outside the site, index.html blog/#nope no #nope on blog/index.html, sitemap.xml https://example.com/gone not found]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+
+	errTests := []struct {
+		code        string
+		errContains string
+	}{
+		{`checkLinks("` + bad + `", {onBroken: "error"})`, "6 broken links in"},
+		{`checkLinks("` + bad + `", {onBroken: "error"})`, "index.html: /missing (not found)"},
+		{`checkLinks("` + good + `/index.html")`, "must be a directory"},
+		{`checkLinks(5)`, "must be a path or directory"},
+		{`checkLinks("` + good + `", {external: "yes"})`, "must be a boolean"},
+		{`checkLinks("` + good + `", {onBroken: "warn"})`, "must be \"result\" or \"error\""},
+		{`checkLinks("` + good + `", {depth: 2})`, "unknown option `depth`"},
+	}
+
+	for _, tt := range errTests {
+		t.Run(tt.code, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if !strings.Contains(result.Inspect(), tt.errContains) {
+				t.Errorf("expected error containing %q, got %s", tt.errContains, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestCheckLinksExternal(t *testing.T) {
+	// /nohead only answers GET, like some servers
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+		case "/nohead":
+			if r.Method == "HEAD" {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dir := filepath.ToSlash(t.TempDir())
+	writeSite(t, dir, map[string]string{
+		"index.html": `<a href="` + server.URL + `/ok">a</a> <a href="` + server.URL + `/nohead">b</a> <a href="` + server.URL + `/gone#x">c</a>`,
+	})
+
+	code := `checkLinks("` + dir + `", {external: true, timeout: @5s}).broken.map(fn(b) { b.link + " " + b.reason })`
+	expected := "[" + server.URL + "/gone#x HTTP 404]"
+	if result := testEvalHelper(code); result.Inspect() != expected {
+		t.Errorf("expected %s, got %s", expected, result.Inspect())
+	}
+
+	code = `checkLinks("` + dir + `").ok`
+	if result := testEvalHelper(code); result.Inspect() != "true" {
+		t.Errorf("external links should be skipped by default, got %s", result.Inspect())
+	}
+}
+
+func TestCheckLinksConcurrencyAndCache(t *testing.T) {
+	var mu sync.Mutex
+	requests := map[string]int{}
+	var times []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		times = append(times, time.Now())
+		mu.Unlock()
+		if r.URL.Path == "/gone" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dir := filepath.ToSlash(t.TempDir())
+	cache := dir + "/cache/links.json"
+	writeSite(t, dir+"/site", map[string]string{
+		"index.html": `<a href="` + server.URL + `/a">a</a> <a href="` + server.URL + `/b">b</a> <a href="` + server.URL + `/gone">c</a>`,
+		"about.html": `<a href="` + server.URL + `/a#top">a</a>`,
+	})
+
+	policy := &evaluator.SecurityPolicy{AllowWrite: []string{dir}}
+	code := `let r = checkLinks("` + dir + `/site", {external: true, concurrency: 2, hostDelay: @30ms, cache: "` + cache + `"}); [r.ok, r.external, r.cached, r.broken.length()]`
+	if result := evalWithPolicy(t, code, policy); result.Inspect() != "[false, 3, 0, 1]" {
+		t.Fatalf("first run: got %s", result.Inspect())
+	}
+	if requests["/a"] != 1 {
+		t.Errorf("expected /a to be checked once, got %d requests", requests["/a"])
+	}
+	for i := 1; i < len(times); i++ {
+		if gap := times[i].Sub(times[i-1]); gap < 25*time.Millisecond {
+			t.Errorf("requests to one host %s apart, want at least 30ms", gap)
+		}
+	}
+
+	data, err := os.ReadFile(cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cached map[string]string
+	if err := json.Unmarshal(data, &cached); err != nil {
+		t.Fatal(err)
+	}
+	if len(cached) != 2 {
+		t.Errorf("expected only the links that worked to be cached, got %v", cached)
+	}
+
+	// The second run only checks the broken link again
+	if result := evalWithPolicy(t, code, policy); result.Inspect() != "[false, 3, 2, 1]" {
+		t.Errorf("second run: got %s", result.Inspect())
+	}
+	if requests["/a"] != 1 || requests["/gone"] != 2 {
+		t.Errorf("unexpected requests on second run: %v", requests)
+	}
+
+	// With a ttl of zero nothing is trusted
+	code = `checkLinks("` + dir + `/site", {external: true, cache: "` + cache + `", ttl: @0s}).cached`
+	if result := evalWithPolicy(t, code, policy); result.Inspect() != "0" {
+		t.Errorf("expected nothing cached with ttl @0s, got %s", result.Inspect())
+	}
+
+	errTests := []struct {
+		code        string
+		errContains string
+	}{
+		{`checkLinks("` + dir + `/site", {concurrency: 0})`, "must be a positive integer"},
+		{`checkLinks("` + dir + `/site", {hostDelay: 5})`, "must be a duration"},
+		{`checkLinks("` + dir + `/site", {cache: 5})`, "must be a path or string"},
+	}
+	for _, tt := range errTests {
+		t.Run(tt.code, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if !strings.Contains(result.Inspect(), tt.errContains) {
+				t.Errorf("expected error containing %q, got %s", tt.errContains, result.Inspect())
+			}
+		})
+	}
+}
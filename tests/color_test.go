@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestColor(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		expected string
+	}{
+		{"hex", `toString(color("#3366ff"))`, "#3366ff"},
+		{"short hex", `toString(color("#36F"))`, "#3366ff"},
+		{"hex with alpha", `color("#3366ff80").a`, "0.502"},
+		{"channels", `let c = color("#3366ff"); [c.r, c.g, c.b, c.a]`, "[51, 102, 255, 1]"},
+		{"rgb", `toString(color("rgb(51, 102, 255)"))`, "#3366ff"},
+		{"rgb with slash alpha", `toString(color("rgb(51 102 255 / 50%)"))`, "#3366ff80"},
+		{"hsl", `toString(color("hsl(225, 100%, 60%)"))`, "#3366ff"},
+		{"named", `toString(color("Navy"))`, "#000080"},
+		{"from channels", `toString(color(255, 128, 0))`, "#ff8000"},
+		{"from dictionary", `toString(color({r: 10, g: 20, b: 30, a: 0.5}))`, "#0a141e80"},
+		{"type", `typeOf(color("red"))`, "color"},
+		{"template", "let c = color(\"#3366ff\"); `border: 1px solid {c}`", "border: 1px solid #3366ff"},
+		{"hex output", `color("#3366FF").hex()`, "#3366ff"},
+		{"rgb output", `color("#3366ff").rgb()`, "rgb(51, 102, 255)"},
+		{"rgba output", `color("#3366ff").alpha(0.5).rgb()`, "rgba(51, 102, 255, 0.5)"},
+		{"hsl output", `color("#3366ff").hsl()`, "hsl(225, 100%, 60%)"},
+		{"lighten", `toString(color("#3366ff").lighten(0.2))`, "#99b3ff"},
+		{"darken", `toString(color("#3366ff").darken(0.2))`, "#0033cc"},
+		{"darken to black", `toString(color("#3366ff").darken(1))`, "#000000"},
+		{"lighten keeps alpha", `color("#3366ff").alpha(0.5).lighten(0.1).a`, "0.5"},
+		{"original unchanged", `let c = color("#3366ff"); let _ = c.darken(0.2); toString(c)`, "#3366ff"},
+		{"mix", `toString(color("black").mix("white"))`, "#808080"},
+		{"mix weight", `toString(color("#000000").mix(color("#ffffff"), 0.25))`, "#404040"},
+		{"luminance", `color("white").luminance()`, "1"},
+		{"contrast ratio", `color("black").contrastRatio("white")`, "21"},
+		{"contrast ratio is symmetric", `color("white").contrastRatio(color("#3366ff"))`, "4.68"},
+		{"dictionary methods", `color("red").keys().sort()`, "[a, b, g, r]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestColorErrors(t *testing.T) {
+	tests := []struct {
+		code        string
+		errContains string
+	}{
+		{`color()`, "wrong number of arguments"},
+		{`color(5)`, "must be a string or dictionary"},
+		{`color("#12345")`, "3, 4, 6 or 8 digits"},
+		{`color("#ggg")`, "invalid hex digits"},
+		{`color("chartreuse-ish")`, "expected a hex"},
+		{`color("rgb(1, 2)")`, "takes 3 or 4 values"},
+		{`color(300, 0, 0)`, "from 0 to 255"},
+		{`color({r: 1, g: 2})`, "missing `b` channel"},
+		{`color("red").lighten(2)`, "from 0 to 1"},
+		{`color("red").mix(5)`, "must be a color"},
+		{`color("red").contrastRatio("nope")`, "expected a hex"},
+		{`color("red").shade()`, "unknown method"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if !strings.Contains(result.Inspect(), tt.errContains) {
+				t.Errorf("expected error containing %q, got %s", tt.errContains, result.Inspect())
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+	"github.com/sambeau/parsley/pkg/lexer"
+	"github.com/sambeau/parsley/pkg/parser"
+)
+
+func TestCondExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`cond { true => 1, else => 2 }`, "1"},
+		{`cond { false => 1, else => 2 }`, "2"},
+		{`let n = 15; cond { n > 20 => "big", n > 10 => "medium", n > 0 => "small" }`, "medium"},
+		{`let n = -1; cond { n > 20 => "big", n > 0 => "small" }`, "null"},
+		{`cond { else => "only" }`, "only"},
+		{`cond { }`, "null"},
+
+		// Multi-line with a trailing comma
+		{`let score = 85
+let grade = cond {
+    score >= 90 => "A",
+    score >= 80 => "B",
+    else => "F",
+}
+grade`, "B"},
+
+		// Only the chosen branch is evaluated
+		{`let x = 1; cond { x == 1 => "one", x / 0 => "never" }`, "one"},
+		{`cond { true => "ok", else => 1 / 0 }`, "ok"},
+
+		// Truthiness, as for if
+		{`cond { null => 1, false => 2, 0 => 3 }`, "3"},
+
+		// Values are any expression
+		{`let f = fn(x) { cond { x < 0 => -x, else => x } }; f(-3) + f(4)`, "7"},
+		{`cond { true => [1, 2].map(fn(x) { x * 2 }) }`, "[2, 4]"},
+
+		// In tag attributes
+		{`let active = true; <li class={cond { active => "on", else => "off" }}>x</li>`, `<li class=on>x</li>`},
+
+		// cond is still an ordinary name
+		{`let cond = 3; cond + 1`, "4"},
+		{`let cond = {a: 1}; cond.a`, "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Type() == evaluator.ERROR_OBJ {
+				t.Fatalf("Evaluation error: %s", result.Inspect())
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestCondParseErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		errorContains string
+	}{
+		{`cond { true 1 }`, "expected '=>'"},
+		{`cond { true => 1 false => 2 }`, "expected ','"},
+		{`cond { else => 1, true => 2 }`, "else must be the last branch of cond"},
+		{`cond { else 1 }`, "expected '=>'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			p := parser.New(lexer.New(tt.input))
+			p.ParseProgram()
+			errs := p.Errors()
+			if len(errs) == 0 {
+				t.Fatalf("expected parse error containing %q", tt.errorContains)
+			}
+			if !strings.Contains(errs[0], tt.errorContains) {
+				t.Errorf("expected error containing %q, got %q", tt.errorContains, errs[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/config"
+	"github.com/sambeau/parsley/pkg/evaluator"
+	"github.com/sambeau/parsley/pkg/lexer"
+	"github.com/sambeau/parsley/pkg/parser"
+)
+
+func TestConfigParse(t *testing.T) {
+	dir := filepath.FromSlash("/work/site")
+	cfg, err := config.Parse(`
+# Workspace defaults
+locale = "en-GB"
+strict = true
+env = ["API_HOST", "DATA_DIR"]
+
+[security]
+no_read = false
+restrict_read = ["/etc"]
+allow_write = ["dist", 'tmp']   # literal string
+allow_execute_all = true
+
+[modules]
+paths = [
+    "lib",
+    "/opt/parsley/modules",
+]
+
+[output]
+dir = "dist"
+ext = "txt"
+pretty = true
+validate = true
+
+[build]
+default_task = "site"
+`, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Locale != "en-GB" || !cfg.Strict {
+		t.Errorf("Locale = %q, Strict = %v, want en-GB and true", cfg.Locale, cfg.Strict)
+	}
+	if !reflect.DeepEqual(cfg.Env, []string{"API_HOST", "DATA_DIR"}) {
+		t.Errorf("Env = %v, want [API_HOST DATA_DIR]", cfg.Env)
+	}
+	if !cfg.Security.AllowExecuteAll || cfg.Security.NoRead || cfg.Security.AllowWriteAll {
+		t.Errorf("unexpected security flags: %+v", cfg.Security)
+	}
+	wantWrite := []string{filepath.Join(dir, "dist"), filepath.Join(dir, "tmp")}
+	if !reflect.DeepEqual(cfg.Security.AllowWrite, wantWrite) {
+		t.Errorf("AllowWrite = %v, want %v", cfg.Security.AllowWrite, wantWrite)
+	}
+	wantPaths := []string{filepath.Join(dir, "lib"), filepath.FromSlash("/opt/parsley/modules")}
+	if !reflect.DeepEqual(cfg.Modules.Paths, wantPaths) {
+		t.Errorf("Modules.Paths = %v, want %v", cfg.Modules.Paths, wantPaths)
+	}
+	if cfg.Output.Dir != filepath.Join(dir, "dist") || cfg.Output.Ext != ".txt" || !cfg.Output.Pretty || cfg.Output.Raw || !cfg.Output.Validate {
+		t.Errorf("unexpected output settings: %+v", cfg.Output)
+	}
+	if cfg.Build.Parsfile != filepath.Join(dir, "parsfile.pars") || cfg.Build.DefaultTask != "site" {
+		t.Errorf("unexpected build settings: %+v", cfg.Build)
+	}
+}
+
+// TestConfigFullTOML tests that parsley.toml accepts the TOML that TOML()
+// handles read, such as dotted keys and inline tables
+func TestConfigFullTOML(t *testing.T) {
+	cfg, err := config.Parse(`
+output.dir = "dist"
+output.pretty = true
+modules = { paths = ["lib"] }
+build.default_task = """site"""
+`, "/work")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Output.Dir != filepath.Join("/work", "dist") || !cfg.Output.Pretty {
+		t.Errorf("unexpected output settings: %+v", cfg.Output)
+	}
+	if !reflect.DeepEqual(cfg.Modules.Paths, []string{filepath.Join("/work", "lib")}) {
+		t.Errorf("Modules.Paths = %v, want [/work/lib]", cfg.Modules.Paths)
+	}
+	if cfg.Build.DefaultTask != "site" {
+		t.Errorf("DefaultTask = %q, want site", cfg.Build.DefaultTask)
+	}
+}
+
+func TestConfigDefaults(t *testing.T) {
+	cfg, err := config.Parse("", "/work")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Locale != "" || cfg.Output.Dir != "" || cfg.Output.Ext != ".html" {
+		t.Errorf("unexpected defaults: %+v", cfg)
+	}
+	if cfg.Build.DefaultTask != "default" {
+		t.Errorf("DefaultTask = %q, want default", cfg.Build.DefaultTask)
+	}
+}
+
+func TestConfigParseErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		data          string
+		errorContains string
+	}{
+		{"unknown top-level key", `color = "red"`, `unknown setting "color"`},
+		{"unknown table key", "[output]\nformat = \"html\"", `unknown setting "output.format"`},
+		{"unknown table", "[server]\nport = 80", `unknown setting "server"`},
+		{"wrong type", "[output]\npretty = \"yes\"", "output.pretty must be true or false"},
+		{"paths not an array", "[modules]\npaths = \"lib\"", "modules.paths must be an array of strings"},
+		{"setting used as table", "locale = \"en\"\n[locale]", "line 2: key locale is already defined and isn't a table"},
+		{"duplicate key", "locale = \"en\"\nlocale = \"fr\"", "line 2: key locale is defined more than once"},
+		{"unterminated string", `locale = "en`, "line 1: unterminated string"},
+		{"unterminated array", "[modules]\npaths = [\"lib\"", "line 2: unterminated array"},
+		{"trailing text", `locale = "en" fr`, "line 1: unexpected 'f' after value"},
+		{"dotted key into a setting", "locale = \"en\"\nlocale.region = \"GB\"", "line 2: key locale is already defined and isn't a table"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := config.Parse(tt.data, "/work")
+			if err == nil {
+				t.Fatalf("expected error containing %q", tt.errorContains)
+			}
+			if !strings.Contains(err.Error(), tt.errorContains) {
+				t.Errorf("expected error containing %q, got %q", tt.errorContains, err.Error())
+			}
+		})
+	}
+}
+
+func TestConfigFind(t *testing.T) {
+	root, err := os.MkdirTemp("", "parsley_config_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	nested := filepath.Join(root, "site", "pages", "blog")
+	os.MkdirAll(nested, 0755)
+
+	// No config anywhere above the temp dir (barring a stray one in /tmp)
+	if path, err := config.Find(nested); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if path != "" && strings.HasPrefix(path, root) {
+		t.Errorf("found unexpected config %q", path)
+	}
+
+	configPath := filepath.Join(root, "site", config.FileName)
+	os.WriteFile(configPath, []byte("[modules]\npaths = [\"lib\"]\n"), 0644)
+
+	path, err := config.Find(nested)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if path != configPath {
+		t.Fatalf("Find = %q, want %q", path, configPath)
+	}
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Path != configPath || cfg.Modules.Paths[0] != filepath.Join(root, "site", "lib") {
+		t.Errorf("paths not resolved against config dir: %+v", cfg)
+	}
+
+	// Errors name the file
+	os.WriteFile(configPath, []byte("locale = 1\n"), 0644)
+	if _, err := config.Load(configPath); err == nil || !strings.Contains(err.Error(), configPath) {
+		t.Errorf("expected error naming %s, got %v", configPath, err)
+	}
+}
+
+func TestModulePaths(t *testing.T) {
+	root, err := os.MkdirTemp("", "parsley_modpaths_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	lib := filepath.Join(root, "lib")
+	src := filepath.Join(root, "src")
+	os.MkdirAll(lib, 0755)
+	os.MkdirAll(src, 0755)
+	os.WriteFile(filepath.Join(lib, "greet.pars"), []byte(`export hello = fn(n) { "hello " + n }`), 0644)
+	os.WriteFile(filepath.Join(src, "local.pars"), []byte(`export name = "local"`), 0644)
+
+	eval := func(code string, paths []string) evaluator.Object {
+		filename := filepath.Join(src, "main.pars")
+		l := lexer.NewWithFilename(code, filename)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		if len(p.Errors()) > 0 {
+			t.Fatalf("parser errors: %v", p.Errors())
+		}
+		env := evaluator.NewEnvironment()
+		env.Filename = filename
+		env.Security = &evaluator.SecurityPolicy{AllowExecuteAll: true}
+		env.ModulePaths = paths
+		return evaluator.Eval(program, env)
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		paths    []string
+		expected string
+		wantErr  bool
+	}{
+		{"found on module path", `let {hello} = import("greet.pars"); hello("world")`, []string{lib}, "hello world", false},
+		{"relative import wins", `let {name} = import("local.pars"); name`, []string{lib}, "local", false},
+		{"not found without module paths", `import("greet.pars")`, nil, "greet.pars", true},
+		{"explicit relative path skips module paths", `import("./greet.pars")`, []string{lib}, "greet.pars", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := eval(tt.code, tt.paths)
+			if tt.wantErr {
+				if result.Type() != evaluator.ERROR_OBJ {
+					t.Fatalf("expected error, got %s", result.Inspect())
+				}
+				if !strings.Contains(result.Inspect(), tt.expected) {
+					t.Errorf("expected error mentioning %q, got %q", tt.expected, result.Inspect())
+				}
+				return
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestDefaultLocale(t *testing.T) {
+	saved := evaluator.DefaultLocale
+	defer func() { evaluator.DefaultLocale = saved }()
+
+	evaluator.DefaultLocale = "de-DE"
+	result := testEvalHelper(`1234567.5.format()`)
+	if result.Inspect() != "1.234.567,5" {
+		t.Errorf("expected German formatting, got %q", result.Inspect())
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+func TestFormatPhone(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// A number of the home country is written nationally
+		{`formatPhone("+15551234567", "US")`, "(555) 123-4567"},
+		{`formatPhone("1-555-123-4567", "US")`, "(555) 123-4567"},
+		{`formatPhone("020 7946 0018", "GB")`, "020 7946 0018"},
+		{`formatPhone("+44 121 496 0000", "GB")`, "0121 496 0000"},
+		{`formatPhone("07700900123", "GB")`, "07700 900123"},
+		{`formatPhone("0123456789", "FR")`, "01 23 45 67 89"},
+		{`formatPhone("030 123456", "DE")`, "030 123456"},
+		{`formatPhone("0151 23456789", "DE")`, "0151 23456789"},
+		{`formatPhone("0212345678", "AU")`, "(02) 1234 5678"},
+		{`formatPhone("09012345678", "JP")`, "090-1234-5678"},
+		{`formatPhone("612345678", "ES")`, "612 34 56 78"},
+
+		// Any other number is written internationally
+		{`formatPhone("+15551234567")`, "+1 555-123-4567"},
+		{`formatPhone("+15551234567", "GB")`, "+1 555-123-4567"},
+		{`formatPhone("0044 20 7946 0018", "US")`, "+44 20 7946 0018"},
+		{`formatPhone("+33 6 12 34 56 78")`, "+33 6 12 34 56 78"},
+
+		// Unless the format option says otherwise
+		{`formatPhone("555.123.4567", "US", {format: "e164"})`, "+15551234567"},
+		{`formatPhone("020 7946 0018", "GB", {format: "international"})`, "+44 20 7946 0018"},
+		{`formatPhone("+442079460018", {format: "national"})`, "020 7946 0018"},
+
+		// Numbers that can't be read are null
+		{`formatPhone("call me", "US")`, "null"},
+		{`formatPhone("123", "US")`, "null"},
+		{`formatPhone("5551234567")`, "null"},
+		{`formatPhone("+999 1234", "US")`, "null"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalChecked(t, tt.input)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestValidatePhoneAndPostalCode(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`validatePhone("(212) 555-0100", "US")`, true},
+		{`validatePhone("+1 416 555 0199")`, true},
+		{`validatePhone("+44 20 7946 0018")`, true},
+		{`validatePhone("+15551234567")`, false}, // exchanges can't start with 1
+		{`validatePhone("020 7946 001", "GB")`, false},
+		{`validatePhone("020 7946 0018")`, false},
+		{`validatePhone("not a number", "FR")`, false},
+
+		{`validatePostalCode("90210", "US")`, true},
+		{`validatePostalCode("90210-1234", "US")`, true},
+		{`validatePostalCode("9021", "US")`, false},
+		{`validatePostalCode("EC1A 1BB", "gb")`, true},
+		{`validatePostalCode("EC1A1BBX", "GB")`, false},
+		{`validatePostalCode("K1A 0B1", "CA")`, true},
+		{`validatePostalCode("D1A 0B1", "CA")`, false},
+		{`validatePostalCode("10115", "DE")`, true},
+		{`validatePostalCode("1011", "DE")`, false},
+		{`validatePostalCode("53001", "ES")`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalChecked(t, tt.input)
+			b, ok := result.(*evaluator.Boolean)
+			if !ok {
+				t.Fatalf("expected Boolean, got %T (%s)", result, result.Inspect())
+			}
+			if b.Value != tt.expected {
+				t.Errorf("expected %t, got %t", tt.expected, b.Value)
+			}
+		})
+	}
+}
+
+func TestFormatPostalCode(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`formatPostalCode("sw1a1aa", "GB")`, "SW1A 1AA"},
+		{`formatPostalCode("123456789", "US")`, "12345-6789"},
+		{`formatPostalCode("k1a0b1", "CA")`, "K1A 0B1"},
+		{`formatPostalCode("1012ab", "NL")`, "1012 AB"},
+		{`formatPostalCode("1000001", "JP")`, "100-0001"},
+		{`formatPostalCode("d02x285", "IE")`, "D02 X285"},
+		{`formatPostalCode("1234", "US")`, "null"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalChecked(t, tt.input)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestContactErrors(t *testing.T) {
+	tests := []struct {
+		input       string
+		errContains string
+	}{
+		{`formatPhone(5551234567, "US")`, "must be a string"},
+		{`formatPhone("5551234567", "XX")`, "unknown country \"XX\""},
+		{`formatPhone("5551234567", "US", {format: "dots"})`, "invalid format"},
+		{`validatePhone("5551234567", 1)`, "must be a string"},
+		{`formatPostalCode("12345")`, "wrong number of arguments"},
+		{`validatePostalCode("12345", "ZZ")`, "unknown country"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalChecked(t, tt.input)
+			err, ok := result.(*evaluator.Error)
+			if !ok {
+				t.Fatalf("expected Error, got %T (%s)", result, result.Inspect())
+			}
+			if !strings.Contains(err.Message, tt.errContains) {
+				t.Errorf("expected error to contain '%s', got '%s'", tt.errContains, err.Message)
+			}
+		})
+	}
+}
+
+func TestEmail(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`isEmail("ada@example.com")`, "true"},
+		{`isEmail("ada.lovelace+news@example.co.uk")`, "true"},
+		{`isEmail("\"ada lovelace\"@example.com")`, "true"},
+		{`isEmail("josé@exämple.de")`, "true"},
+		{`isEmail("ada@localhost")`, "false"},
+		{`isEmail("ada..lovelace@example.com")`, "false"},
+		{`isEmail("ada lovelace@example.com")`, "false"},
+		{`isEmail("ada@-example.com")`, "false"},
+		{`isEmail("ada@example.123")`, "false"},
+		{`isEmail("@example.com")`, "false"},
+		{`isEmail(42)`, "false"},
+
+		{`normalizeEmail(" Ada.Lovelace+news@GoogleMail.com ")`, "adalovelace@gmail.com"},
+		{`normalizeEmail("Ada+news@Example.COM")`, "ada+news@example.com"},
+		{`normalizeEmail("Ada+news@Example.COM", {removeTags: true})`, "ada@example.com"},
+		{`normalizeEmail("\"Ada\"@Example.com")`, "\"Ada\"@example.com"},
+		{`normalizeEmail("not an address")`, "null"},
+
+		{`obfuscateEmail("a@b.com", {link: false})`, "&#97;&#x40;&#98;&#x2e;&#99;&#x6f;&#109;"},
+		{`obfuscateEmail("a@b.co")`, `<a href="&#109;&#x61;&#105;&#x6c;&#116;&#x6f;&#58;&#x61;&#64;&#x62;&#46;&#x63;&#111;">&#97;&#x40;&#98;&#x2e;&#99;&#x6f;</a>`},
+		{`obfuscateEmail("a@b.co", {text: "Email us", link: false})`, "Email us"},
+		{`obfuscateEmail("a@b.co", {style: "js", link: false})`, `<script>document.currentScript.insertAdjacentHTML("beforebegin",String.fromCodePoint(97,64,98,46,99,111))</script><noscript>a [at] b [dot] co</noscript>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalChecked(t, tt.input)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+
+	t.Run("js link", func(t *testing.T) {
+		result := testEvalChecked(t, `obfuscateEmail("a@b.co", {style: "js"})`)
+		if !strings.Contains(result.Inspect(), "fromCodePoint(60,97,32,104,114,101,102") || strings.Contains(result.Inspect(), "a@b.co") {
+			t.Errorf("expected a script building the link, got %s", result.Inspect())
+		}
+	})
+
+	errTests := []struct {
+		input       string
+		errContains string
+	}{
+		{`obfuscateEmail("nope")`, "is not an email address"},
+		{`obfuscateEmail("a@b.com", {style: "rot13"})`, "must be 'entities' or 'js'"},
+		{`normalizeEmail("a@b.com", {removeTags: "yes"})`, "must be a boolean"},
+	}
+	for _, tt := range errTests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalChecked(t, tt.input)
+			err, ok := result.(*evaluator.Error)
+			if !ok {
+				t.Fatalf("expected Error, got %T (%s)", result, result.Inspect())
+			}
+			if !strings.Contains(err.Message, tt.errContains) {
+				t.Errorf("expected error to contain '%s', got '%s'", tt.errContains, err.Message)
+			}
+		})
+	}
+}
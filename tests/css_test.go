@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCSS(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		expected string
+	}{
+		{"rule", `css({".card": {padding: "1rem", zIndex: 2}})`, ".card {\n  padding: 1rem;\n  z-index: 2;\n}\n"},
+		{"custom properties", `css({":root": {"--brand": color("#3366ff")}})`, ":root {\n  --brand: #3366ff;\n}\n"},
+		{"vendor prefix", `css({a: {WebkitTransition: "none"}})`, "a {\n  -webkit-transition: none;\n}\n"},
+		{"arrays join with commas", `css({body: {fontFamily: ["Inter", "sans-serif"]}})`, "body {\n  font-family: Inter, sans-serif;\n}\n"},
+		{"null and false are left out", `css({a: {color: null, display: false, margin: 0}})`, "a {\n  margin: 0;\n}\n"},
+		{"nested selector", `css({nav: {a: {color: "red"}}})`, "nav a {\n  color: red;\n}\n"},
+		{"parent reference", `css({".btn": {color: "red", "&:hover": {color: "blue"}}})`, ".btn {\n  color: red;\n}\n.btn:hover {\n  color: blue;\n}\n"},
+		{"selector lists", `css({"h1, h2": {"& a, & b": {margin: 0}}})`, "h1 a, h1 b, h2 a, h2 b {\n  margin: 0;\n}\n"},
+		{"media query", `css({"@media print": {nav: {display: "none"}}})`, "@media print {\n  nav {\n    display: none;\n  }\n}\n"},
+		{"nested media query", `css({".card": {padding: "1rem", "@media (max-width: 600px)": {padding: 0}}})`, ".card {\n  padding: 1rem;\n}\n@media (max-width: 600px) {\n  .card {\n    padding: 0;\n  }\n}\n"},
+		{"declarations in an at-rule", `css({"@font-face": {fontFamily: "Inter"}})`, "@font-face {\n  font-family: Inter;\n}\n"},
+		{"array keeps order", `css([{b: {margin: 0}}, {a: {margin: 0}}])`, "b {\n  margin: 0;\n}\na {\n  margin: 0;\n}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestTokens(t *testing.T) {
+	dir := filepath.ToSlash(t.TempDir())
+	os.WriteFile(filepath.Join(dir, "tokens.yaml"), []byte("color:\n  brand: \"#3366ff\"\n  text:\n    $value: \"{color.brand}\"\n    $type: color\nspace:\n  sm: 4px\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "tokens.txt"), []byte("brand: red\n"), 0644)
+
+	tests := []struct {
+		name     string
+		code     string
+		expected string
+	}{
+		{"css variables", `tokens({color: {brand: "#3366ff"}, space: {sm: "4px"}}).css`, ":root {\n  --color-brand: #3366ff;\n  --space-sm: 4px;\n}\n"},
+		{"aliases stay live in css", `tokens({brand: "red", linkColor: "{brand}"}).css`, ":root {\n  --brand: red;\n  --link-color: var(--brand);\n}\n"},
+		{"values resolve aliases", `tokens({brand: "red", link: "{brand}"}).values.link`, "red"},
+		{"design token format", `tokens({brand: {"$value": "red", "$type": "color"}}).values.brand`, "red"},
+		{"vars", `tokens({color: {brand: "red"}}).vars.color.brand`, "var(--color-brand)"},
+		{"vars in css()", `let t = tokens({brand: "red"}); css({a: {color: t.vars.brand}})`, "a {\n  color: var(--brand);\n}\n"},
+		{"json snapshot", `tokens({space: {sm: 4}}).json`, "{\n  \"space\": {\n    \"sm\": 4\n  }\n}"},
+		{"prefix and selector", `tokens({brand: "red"}, {prefix: "ds", selector: ".dark"}).css`, ".dark {\n  --ds-brand: red;\n}\n"},
+		{"colors", `tokens({brand: color("#3366ff").darken(0.1)}).css`, ":root {\n  --brand: #0040ff;\n}\n"},
+		{"yaml file", `tokens(path("` + dir + `/tokens.yaml")).css`, ":root {\n  --color-brand: #3366ff;\n  --color-text: var(--color-brand);\n  --space-sm: 4px;\n}\n"},
+		{"file handle", `tokens(YAML("` + dir + `/tokens.yaml")).values.color.text`, "#3366ff"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+
+	errTests := []struct {
+		code        string
+		errContains string
+	}{
+		{`css("a {}")`, "must be a dictionary or an array of dictionaries"},
+		{`css({color: "red"})`, "is not inside a selector"},
+		{`tokens(5)`, "must be a path, file or dictionary"},
+		{`tokens({a: "{b}"})`, "unknown token {b}"},
+		{`tokens({a: "{b}", b: "{a}"})`, "refers to itself"},
+		{`tokens({a: 1}, {prefix: 2})`, "must be a string"},
+		{`tokens(path("` + dir + `/tokens.txt"))`, "is not a .json, .yaml or .yml file"},
+	}
+
+	for _, tt := range errTests {
+		t.Run(tt.code, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if !strings.Contains(result.Inspect(), tt.errContains) {
+				t.Errorf("expected error containing %q, got %s", tt.errContains, result.Inspect())
+			}
+		})
+	}
+}
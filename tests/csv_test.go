@@ -0,0 +1,310 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseCSVDialectOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		expected string
+	}{
+		{
+			name:     "semicolon delimiter",
+			code:     `parseCSV("a;b\n1;2", {header: true, delimiter: ";"})[0].b`,
+			expected: "2",
+		},
+		{
+			name:     "tab delimiter",
+			code:     `parseCSV("a\tb\n1\t2", {delimiter: "\t"})[1]`,
+			expected: "[1, 2]",
+		},
+		{
+			name:     "comment lines are ignored",
+			code:     `parseCSV("# exported\na,b\n# note\n1,2", {header: true, comment: "#"}).length()`,
+			expected: "1",
+		},
+		{
+			name:     "trim whitespace",
+			code:     `let r = parseCSV("name , city\n  Ann ,  Leeds  ", {header: true, trim: true}); r[0].name + "|" + r[0].city`,
+			expected: "Ann|Leeds",
+		},
+		{
+			name:     "lazy quotes",
+			code:     `parseCSV("a,b\n1,say \"hi\"", {header: true, lazyQuotes: true})[0].b`,
+			expected: `say "hi"`,
+		},
+		{
+			name:     "skip preamble rows",
+			code:     `parseCSV("Report\nGenerated today\na,b\n1,2", {header: true, skipRows: 2})[0].a`,
+			expected: "1",
+		},
+		{
+			name:     "pad ragged rows",
+			code:     `parseCSV("a,b,c\n1\n1,2,3,4", {ragged: "pad"})`,
+			expected: "[[a, b, c], [1, , ], [1, 2, 3]]",
+		},
+		{
+			name:     "skip ragged rows",
+			code:     `parseCSV("a,b\n1,2\n3\n4,5", {header: true, ragged: "skip"}).length()`,
+			expected: "2",
+		},
+		{
+			name:     "report ragged rows",
+			code:     `let r = parseCSV("a,b\n1,2\n3\n4,5", {header: true, report: true}); [r.rows.length(), r.errors[0].line, r.errors[0].message]`,
+			expected: "[2, 3, expected 2 fields, got 1 (skipped)]",
+		},
+		{
+			name:     "report padded rows",
+			code:     `let r = parseCSV("a,b\n1", {ragged: "pad", report: true}); [r.rows, r.errors[0].message]`,
+			expected: "[[[a, b], [1, ]], expected 2 fields, got 1 (padded)]",
+		},
+		{
+			name:     "report malformed quotes",
+			code:     `let r = parseCSV("a,b\n1,x\"y\n3,4", {header: true, report: true}); [r.rows.length(), r.errors[0].line]`,
+			expected: "[1, 2]",
+		},
+		{
+			name:     "report line numbers include skipped rows",
+			code:     `parseCSV("title\na,b\n1", {skipRows: 1, report: true}).errors[0].line`,
+			expected: "3",
+		},
+		{
+			name:     "report with no errors",
+			code:     `parseCSV("a,b\n1,2", {report: true}).errors`,
+			expected: "[]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestParseCSVOptionErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		code          string
+		errorContains string
+	}{
+		{
+			name:          "ragged rows are an error by default",
+			code:          `parseCSV("a,b\n1,2\n3")`,
+			errorContains: "line 3: expected 2 fields, got 1",
+		},
+		{
+			name:          "bare quotes are an error by default",
+			code:          `parseCSV("a,b\n1,x\"y")`,
+			errorContains: "failed to parse CSV: line 2",
+		},
+		{
+			name:          "multi-character delimiter",
+			code:          `parseCSV("a", {delimiter: "::"})`,
+			errorContains: "`delimiter` must be a single character",
+		},
+		{
+			name:          "quote delimiter",
+			code:          `parseCSV("a", {delimiter: "\""})`,
+			errorContains: "`delimiter` cannot be",
+		},
+		{
+			name:          "comment same as delimiter",
+			code:          `parseCSV("a", {delimiter: ";", comment: ";"})`,
+			errorContains: "must differ",
+		},
+		{
+			name:          "negative skipRows",
+			code:          `parseCSV("a", {skipRows: -1})`,
+			errorContains: "`skipRows` must be a non-negative integer",
+		},
+		{
+			name:          "unknown ragged mode",
+			code:          `parseCSV("a", {ragged: "ignore"})`,
+			errorContains: "`ragged` must be",
+		},
+		{
+			name:          "non-boolean trim",
+			code:          `parseCSV("a", {trim: "yes"})`,
+			errorContains: "`trim` must be a boolean",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if result.Type() != "ERROR" {
+				t.Fatalf("expected error, got %s", result.Inspect())
+			}
+			if !strings.Contains(result.Inspect(), tt.errorContains) {
+				t.Errorf("expected error containing %q, got %q", tt.errorContains, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestCSVFileDialectOptions(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "parsley_csv_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	export := filepath.Join(tmpDir, "export.csv")
+	data := "Sales export\nname;total\n# test row\nAnn;10\nBob\n"
+	if err := os.WriteFile(export, []byte(data), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	out := filepath.Join(tmpDir, "out.csv")
+
+	tests := []struct {
+		name     string
+		code     string
+		expected string
+	}{
+		{
+			name:     "read with file options",
+			code:     `let rows <== CSV("` + export + `", {delimiter: ";", comment: "#", skipRows: 1, ragged: "pad"}); [rows.length(), rows[0].total, rows[1].name]`,
+			expected: "[2, 10, Bob]",
+		},
+		{
+			name:     "read without header",
+			code:     `let rows <== CSV("` + export + `", {header: false, delimiter: ";", comment: "#", skipRows: 1, ragged: "skip"}); rows[0]`,
+			expected: "[name, total]",
+		},
+		{
+			name:     "write with delimiter",
+			code:     `[{a: 1, b: 2}] ==> CSV("` + out + `", {delimiter: ";"}); let rows <== CSV("` + out + `", {delimiter: ";"}); rows[0].b`,
+			expected: "2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalWriteOp(tt.code)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+
+	written, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(written) != "a;b\n1;2\n" {
+		t.Errorf("expected semicolon-delimited output, got %q", written)
+	}
+}
+
+func TestStringifyCSV(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		expected string
+	}{
+		{
+			name:     "array of arrays",
+			code:     `stringifyCSV([["a", "b"], [1, 2]])`,
+			expected: "a,b\n1,2\n",
+		},
+		{
+			name:     "dictionaries get a sorted header row",
+			code:     `stringifyCSV([{name: "Ann", age: 30}, {name: "Bob", age: 25}])`,
+			expected: "age,name\n30,Ann\n25,Bob\n",
+		},
+		{
+			name:     "explicit column order",
+			code:     `stringifyCSV([{name: "Ann", age: 30, id: 1}], {columns: ["name", "age"]})`,
+			expected: "name,age\nAnn,30\n",
+		},
+		{
+			name:     "missing keys and null are empty",
+			code:     `stringifyCSV([{a: 1}, {b: 2, a: null}])`,
+			expected: "a,b\n1,\n,2\n",
+		},
+		{
+			name:     "without header",
+			code:     `stringifyCSV([{a: 1, b: 2}], {header: false})`,
+			expected: "1,2\n",
+		},
+		{
+			name:     "columns as header for array rows",
+			code:     `stringifyCSV([[1, 2]], {columns: ["x", "y"]})`,
+			expected: "x,y\n1,2\n",
+		},
+		{
+			name:     "quotes delimiters, quotes and newlines",
+			code:     `stringifyCSV([{a: "x,y", b: "say \"hi\"", c: "two\nlines"}])`,
+			expected: "a,b,c\n\"x,y\",\"say \"\"hi\"\"\",\"two\nlines\"\n",
+		},
+		{
+			name:     "custom delimiter",
+			code:     `stringifyCSV([{a: "1;2", b: "3"}], {delimiter: ";"})`,
+			expected: "a;b\n\"1;2\";3\n",
+		},
+		{
+			name:     "typed values as strings",
+			code:     `stringifyCSV([{when: @2024-03-15}])`,
+			expected: "when\n2024-03-15\n",
+		},
+		{
+			name:     "round trip",
+			code:     `let csv = stringifyCSV([{note: "a, \"b\"\nc"}]); parseCSV(csv, {header: true})[0].note`,
+			expected: "a, \"b\"\nc",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestStringifyCSVErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		code          string
+		errorContains string
+	}{
+		{
+			name:          "scalar rows",
+			code:          `stringifyCSV([1, 2])`,
+			errorContains: "expects array of arrays or dictionaries",
+		},
+		{
+			name:          "mixed rows",
+			code:          `stringifyCSV([{a: 1}, [2]])`,
+			errorContains: "rows must all be dictionaries",
+		},
+		{
+			name:          "non-string columns",
+			code:          `stringifyCSV([{a: 1}], {columns: ["a", 2]})`,
+			errorContains: "`columns` must be an array of strings",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if result.Type() != "ERROR" {
+				t.Fatalf("expected error, got %s", result.Inspect())
+			}
+			if !strings.Contains(result.Inspect(), tt.errorContains) {
+				t.Errorf("expected error containing %q, got %q", tt.errorContains, result.Inspect())
+			}
+		})
+	}
+}
@@ -57,10 +57,8 @@ func TestDatabaseTransactions(t *testing.T) {
 				if !ok {
 					t.Fatalf("Expected Array, got %T", result)
 				}
-				// Note: actual SQL transaction support not implemented,
-				// so rollback just clears the flag but doesn't revert changes
-				if len(arr.Elements) != 1 {
-					t.Logf("Note: Got %d rows (SQL transactions not fully implemented, rollback doesn't revert)", len(arr.Elements))
+				if len(arr.Elements) != 0 {
+					t.Errorf("Expected rollback to remove the row, got %d rows", len(arr.Elements))
 				}
 			},
 		},
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+const paramsSetup = `
+	let db = SQLITE(":memory:")
+	let _ = db <=!=> "DROP TABLE IF EXISTS param_users"
+	let _ = db <=!=> "CREATE TABLE param_users (id INTEGER PRIMARY KEY, name TEXT, age INTEGER)"
+	let _ = db <=!=> ["INSERT INTO param_users (name, age) VALUES (?, ?)", ["Ann", 31]]
+	let _ = db <=!=> ["INSERT INTO param_users (name, age) VALUES (?, ?)", ["Bob", 25]]
+	let _ = db <=!=> {sql: "INSERT INTO param_users (name, age) VALUES (:name, :age)", params: {name: "Cy", age: 40}}
+`
+
+func TestQueryParams(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"array params", `let rows = db <=??=> ["SELECT name FROM param_users WHERE age > ? ORDER BY age", [30]]; rows.map(fn(r) { r.name })`, "[Ann, Cy]"},
+		{"named params", `let row = db <=?=> {sql: "SELECT age FROM param_users WHERE name = :name", params: {name: "Bob"}}; row.age`, "25"},
+		{"named params in array form", `let row = db <=?=> ["SELECT name FROM param_users WHERE age = :age", {age: 40}]; row.name`, "Cy"},
+		{"positional params in dictionary form", `let rows = db <=??=> {sql: "SELECT id FROM param_users WHERE age < ?", params: [30]}; rows.length()`, "1"},
+		{"exec with params", `let r = db <=!=> ["UPDATE param_users SET age = age + 1 WHERE name = ?", ["Ann"]]; r.affected`, "1"},
+		{"same query, new values", `let a = db <=?=> ["SELECT name FROM param_users WHERE id = ?", [1]]; let b = db <=?=> ["SELECT name FROM param_users WHERE id = ?", [2]]; [a.name, b.name]`, "[Ann, Bob]"},
+		{"values can't change the query", `let _ = db <=!=> ["INSERT INTO param_users (name) VALUES (?)", ["x'); DROP TABLE param_users; --"]]; let rows = db <=??=> "SELECT id FROM param_users"; rows.length()`, "4"},
+		{"no params", `let rows = db <=??=> ["SELECT id FROM param_users", []]; rows.length()`, "3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(paramsSetup + tt.input)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestQueryParamsErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let r = db <=?=> ["SELECT 1"]`, "must be [sql, params]"},
+		{`let r = db <=?=> [1, []]`, "must be a string"},
+		{`let r = db <=?=> ["SELECT ?", 5]`, "must be an array or dictionary"},
+		{`let r = db <=?=> {sql: "SELECT ?", params: "x"}`, "must be an array or dictionary"},
+		{`let r = db <=?=> ["SELECT * FROM missing WHERE id = ?", [1]]`, "no such table"},
+	}
+
+	for _, tt := range tests {
+		result := testEvalHelper(paramsSetup + tt.input)
+		errObj, ok := result.(*evaluator.Error)
+		if !ok || !strings.Contains(errObj.Message, tt.expected) {
+			t.Errorf("%s: expected error containing %q, got %s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
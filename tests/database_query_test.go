@@ -0,0 +1,115 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+const querySetup = `let db = SQLITE(":memory:")
+let _ = db <=!=> "DROP TABLE IF EXISTS q_users"
+let _ = db <=!=> "CREATE TABLE q_users (id INTEGER PRIMARY KEY, name TEXT, active INTEGER, age INTEGER, email TEXT)"
+let _ = db <=!=> "INSERT INTO q_users (name, active, age, email) VALUES ('Ann', 1, 30, 'ann@example.com'), ('Bob', 0, 25, NULL), ('Cy', 1, 40, 'cy@example.com')"
+`
+
+func TestPreparedStatements(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"query", `let s = db.prepare("SELECT name FROM q_users WHERE age > ? ORDER BY id")
+s.query(26).map(fn(r) { r.name })`, "[Ann, Cy]"},
+		{"reused", `let s = db.prepare("SELECT name FROM q_users WHERE id = ?");
+[s.queryOne(1).name, s.queryOne(2).name]`, "[Ann, Bob]"},
+		{"no row", `db.prepare("SELECT * FROM q_users WHERE id = ?").queryOne(99)`, "null"},
+		{"array of params", `db.prepare("SELECT name FROM q_users WHERE age BETWEEN ? AND ?").query([26, 35]).map(fn(r) { r.name })`, "[Ann]"},
+		{"named params", `db.prepare("SELECT name FROM q_users WHERE age = :age").queryOne({age: 40}).name`, "Cy"},
+		{"exec", `let ins = db.prepare("INSERT INTO q_users (name, active, age) VALUES (?, ?, ?)");
+[ins.exec("Di", true, 22).lastId, ins.exec("Ed", false, 50).lastId]`, "[4, 5]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(querySetup + tt.input)
+			if result.Type() == evaluator.ERROR_OBJ {
+				t.Fatalf("Evaluation error: %s", result.Inspect())
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestQueryBuilder(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"where, orderBy and limit", `db.table("q_users").where({active: true}).orderBy("name").limit(10).all().map(fn(r) { r.name })`, "[Ann, Cy]"},
+		{"descending", `db.table("q_users").orderBy("-age").first().name`, "Cy"},
+		{"select", `db.table("q_users").select("name").where({id: 2}).first().keys()`, "[name]"},
+		{"null", `db.table("q_users").where({email: null}).first().name`, "Bob"},
+		{"in", `db.table("q_users").where({id: [1, 3]}).count()`, "2"},
+		{"empty in", `db.table("q_users").where({id: []}).count()`, "0"},
+		{"condition", `db.table("q_users").where("age > ?", 26).where({active: true}).count()`, "2"},
+		{"offset", `db.table("q_users").orderBy("id").offset(1).all().map(fn(r) { r.id })`, "[2, 3]"},
+		{"values are parameters", `db.table("q_users").where({name: "x' OR '1'='1"}).count()`, "0"},
+		{"queries are not changed", `let base = db.table("q_users")
+let active = base.where({active: true});
+[base.count(), active.count()]`, "[3, 2]"},
+		{"toSQL", `db.table("q_users").where({active: true, age: 30}).orderBy("-name").limit(5).toSQL().sql`,
+			`SELECT * FROM "q_users" WHERE "active" = ? AND "age" = ? ORDER BY "name" DESC LIMIT 5`},
+		{"toSQL params", `db.table("q_users").where({active: true, age: 30}).toSQL().params`, "[true, 30]"},
+		{"query operator", `let rows = db <=??=> db.table("q_users").where({active: false})
+rows.map(fn(r) { r.name })`, "[Bob]"},
+		{"insert", `db.table("q_users").insert({name: "Di", active: true, age: 22}).lastId`, "4"},
+		{"update", `let _ = db.table("q_users").where({id: 2}).update({age: 26, email: "bob@example.com"})
+db.table("q_users").where({id: 2}).first().email`, "bob@example.com"},
+		{"delete", `db.table("q_users").where({active: false}).delete().affected`, "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(querySetup + tt.input)
+			if result.Type() == evaluator.ERROR_OBJ {
+				t.Fatalf("Evaluation error: %s", result.Inspect())
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestQueryBuilderErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		errorContains string
+	}{
+		{`db.table("q_users; DROP TABLE q_users")`, "table() argument must be a table name"},
+		{`db.table("q_users").orderBy("name; DROP TABLE q_users")`, "orderBy() arguments must be column names"},
+		{`db.table("q_users").where("age > ? AND id < ?", 1)`, "2 ? placeholders but 1 values"},
+		{`db.table("q_users").limit(-1)`, "limit() argument must be a non-negative integer"},
+		{`db.table("q_users").delete()`, "delete() on q_users has no where() condition"},
+		{`db.table("q_users").update({age: 1})`, "update() on q_users has no where() condition"},
+		// SQLite only reports syntax errors when a statement is first run
+		{`db.prepare("SELEC name").query()`, `near "SELEC": syntax error`},
+		{`let s = db.prepare("SELECT 1"); s.close(); s.query()`, "statement is closed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalHelper(querySetup + tt.input)
+			if result.Type() != evaluator.ERROR_OBJ {
+				t.Fatalf("expected error, got %s", result.Inspect())
+			}
+			if !strings.Contains(result.Inspect(), tt.errorContains) {
+				t.Errorf("expected error containing %q, got %q", tt.errorContains, result.Inspect())
+			}
+		})
+	}
+}
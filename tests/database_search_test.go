@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+const searchSetup = `let db = SQLITE(":memory:")
+let _ = db <=!=> "DROP TABLE IF EXISTS search_posts"
+let _ = db <=!=> "DROP TABLE IF EXISTS search_posts_fts"
+let _ = db <=!=> "CREATE TABLE search_posts (id INTEGER PRIMARY KEY, title TEXT, body TEXT)"
+let _ = db <=!=> "INSERT INTO search_posts (title, body) VALUES ('Static sites', 'Build static sites with templates')"
+let _ = db <=!=> "INSERT INTO search_posts (title, body) VALUES ('Databases', 'Query SQLite from a template')"
+db.createIndex("search_posts", ["title", "body"])
+let _ = db <=!=> "INSERT INTO search_posts (title, body) VALUES ('More', 'A <b>site</b> about sites')"
+`
+
+func TestDatabaseSearch(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"rows added before and after the index", `db.search("search_posts", "sites").map(fn(r) { r.id }).sort()`, "[1, 3]"},
+		{"every word must match", `db.search("search_posts", "static templates").map(fn(r) { r.id })`, "[1]"},
+		{"best match first", `db.search("search_posts", "static")[0].id`, "1"},
+		{"score", `db.search("search_posts", "static")[0].score > 0`, "true"},
+		{"escaped snippet", `db.search("search_posts", "about")[0].snippet`, "A &lt;b&gt;site&lt;/b&gt; <mark>about</mark> sites"},
+		{"highlight", `db.search("search_posts", "about", {highlight: ["[", "]"]})[0].snippet`, "A &lt;b&gt;site&lt;/b&gt; [about] sites"},
+		{"punctuation is searched for", `db.search("search_posts", "static-sites").map(fn(r) { r.id })`, "[1]"},
+		{"keywords are words", `db.search("search_posts", "sites OR").map(fn(r) { r.id })`, "[]"},
+		{"prefix", `db.search("search_posts", "data", {prefix: true}).map(fn(r) { r.title })`, "[Databases]"},
+		{"raw", `db.search("search_posts", "static OR sqlite", {raw: true}).map(fn(r) { r.id }).sort()`, "[1, 2]"},
+		{"limit", `len(db.search("search_posts", "sites", {limit: 1}))`, "1"},
+		{"empty query", `db.search("search_posts", "  ")`, "[]"},
+		{"updates and deletes", `let _ = db <=!=> "UPDATE search_posts SET body = 'Nothing here' WHERE id = 3"
+let _ = db <=!=> "DELETE FROM search_posts WHERE id = 1"
+db.search("search_posts", "sites")`, "[]"},
+		{"createIndex again", `db.createIndex("search_posts", ["title", "body"])
+db.search("search_posts", "sites").map(fn(r) { r.id }).sort()`, "[1, 3]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(searchSetup + tt.input)
+			if result.Type() == evaluator.ERROR_OBJ {
+				t.Fatalf("Evaluation error: %s", result.Inspect())
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestDatabaseSearchErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		errorContains string
+	}{
+		{`db.search("missing_posts", "x")`, "found no index for missing_posts"},
+		{`db.createIndex("search_posts; DROP", ["title"])`, "table must be a table name"},
+		{`db.createIndex("search_posts", [])`, "non-empty array of column names"},
+		{`db.createIndex("search_posts", ["nope"])`, "createIndex() failed"},
+		{`db.search("search_posts", "x", {limit: "ten"})`, "option `limit` must be a non-negative integer"},
+		{`db.search("search_posts", "x", {sort: true})`, "unknown option \"sort\" for search()"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalHelper(searchSetup + tt.input)
+			if result.Type() != evaluator.ERROR_OBJ {
+				t.Fatalf("expected error, got %s", result.Inspect())
+			}
+			if !strings.Contains(result.Inspect(), tt.errorContains) {
+				t.Errorf("expected error containing %q, got %q", tt.errorContains, result.Inspect())
+			}
+		})
+	}
+}
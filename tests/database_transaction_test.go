@@ -0,0 +1,112 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+	"github.com/sambeau/parsley/pkg/lexer"
+	"github.com/sambeau/parsley/pkg/parser"
+)
+
+const transactionSetup = `
+	let db = SQLITE(":memory:")
+	let _ = db <=!=> "DROP TABLE IF EXISTS tx_items"
+	let _ = db <=!=> "CREATE TABLE tx_items (name TEXT)"
+	let names = fn() { (db <=??=> "SELECT name FROM tx_items ORDER BY name").map(fn(r) { r.name }) }
+`
+
+func TestTransactions(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"commit", `db.begin(); let _ = db <=!=> ["INSERT INTO tx_items VALUES (?)", ["a"]]; db.commit(); names()`, "[a]"},
+		{"rollback", `db.begin(); let _ = db <=!=> ["INSERT INTO tx_items VALUES (?)", ["a"]]; db.rollback(); names()`, "[]"},
+		{"queries see the transaction's changes", `db.begin(); let _ = db <=!=> "INSERT INTO tx_items VALUES ('a')"; let n = names(); db.rollback(); n`, "[a]"},
+		{"inTransaction", `let a = db.inTransaction; db.begin(); let b = db.inTransaction; db.commit(); [a, b, db.inTransaction]`, "[false, true, false]"},
+		{"savepoint rollback", `
+			db.begin()
+			let _ = db <=!=> "INSERT INTO tx_items VALUES ('a')"
+			db.begin()
+			let _ = db <=!=> "INSERT INTO tx_items VALUES ('b')"
+			db.rollback()
+			let _ = db <=!=> "INSERT INTO tx_items VALUES ('c')"
+			db.commit()
+			names()
+		`, "[a, c]"},
+		{"savepoint commit, outer rollback", `
+			db.begin()
+			db.begin()
+			let _ = db <=!=> "INSERT INTO tx_items VALUES ('a')"
+			db.commit()
+			db.rollback()
+			names()
+		`, "[]"},
+		{"prepared statement in a transaction", `let ins = db.prepare("INSERT INTO tx_items VALUES (?)"); db.begin(); ins.exec("a"); db.rollback(); ins.exec("b"); names()`, "[b]"},
+		{"query builder in a transaction", `db.begin(); let _ = db <=!=> "INSERT INTO tx_items VALUES ('a')"; let n = db.table("tx_items").count(); db.rollback(); n`, "1"},
+		{"transaction commits", `let r = db.transaction(fn() { let _ = db <=!=> "INSERT INTO tx_items VALUES ('a')"; "done" }); [r, names()]`, "[done, [a]]"},
+		{"transaction passes the connection", `db.transaction(fn(tx) { let _ = tx <=!=> "INSERT INTO tx_items VALUES ('a')" }); names()`, "[a]"},
+		{"transaction rolls back on error", `let r = attempt(fn() { db.transaction(fn() { let _ = db <=!=> "INSERT INTO tx_items VALUES ('a')"; 1 / 0 }) }); [r.error, db.inTransaction, names()]`, "[division by zero, false, []]"},
+		{"nested transaction rolls back its part", `
+			db.transaction(fn() {
+				let _ = db <=!=> "INSERT INTO tx_items VALUES ('a')"
+				attempt(fn() { db.transaction(fn() { let _ = db <=!=> "INSERT INTO tx_items VALUES ('b')"; 1 / 0 }) })
+			})
+			names()
+		`, "[a]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(transactionSetup + tt.input)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestTransactionRolledBackWhenScriptFails(t *testing.T) {
+	dsn := filepath.ToSlash(filepath.Join(t.TempDir(), "tx.db"))
+	run := func(input string) evaluator.Object {
+		program := parser.New(lexer.New(`let db = SQLITE("` + dsn + `");` + "\n" + input)).ParseProgram()
+		env := evaluator.NewEnvironment()
+		result := evaluator.Eval(program, env)
+		evaluator.EndScript(env)
+		return result
+	}
+
+	run(`let _ = db <=!=> "CREATE TABLE items (name TEXT)"`)
+	run(`db.begin(); let _ = db <=!=> "INSERT INTO items VALUES ('failed')"; 1 / 0`)
+	run(`db.begin(); let _ = db <=!=> "INSERT INTO items VALUES ('forgotten')"`)
+	run(`db.begin(); let _ = db <=!=> "INSERT INTO items VALUES ('kept')"; db.commit()`)
+
+	result := run(`(db <=??=> "SELECT name FROM items").map(fn(r) { r.name })`)
+	if result.Inspect() != "[kept]" {
+		t.Errorf("expected only the committed row, got %s", result.Inspect())
+	}
+}
+
+func TestTransactionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`db.commit()`, "no transaction in progress"},
+		{`db.rollback()`, "no transaction in progress"},
+		{`db.transaction(1)`, "must be a function"},
+		{`db.transaction(fn(a, b) { a })`, "0 or 1 parameters"},
+		{`db.nope`, "unknown property for database connection"},
+	}
+
+	for _, tt := range tests {
+		result := testEvalHelper(transactionSetup + tt.input)
+		errObj, ok := result.(*evaluator.Error)
+		if !ok || !strings.Contains(errObj.Message, tt.expected) {
+			t.Errorf("%s: expected error containing %q, got %s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+const typesSetup = `let db = SQLITE(":memory:")
+let _ = db <=!=> "DROP TABLE IF EXISTS t_orders"
+let _ = db <=!=> "CREATE TABLE t_orders (id INTEGER PRIMARY KEY, paid BOOLEAN, total DECIMAL(10,2), placed DATETIME, due DATE, code VARCHAR(10), qty INT, note TEXT)"
+let _ = db <=!=> "INSERT INTO t_orders (paid, total, placed, due, code, qty, note) VALUES (1, '19.99', '2024-03-05 14:30:00', '2024-04-01', '007', '3', NULL)"
+let row = db <=?=> "SELECT * FROM t_orders";
+`
+
+func TestDatabaseColumnTypes(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		// Declared types
+		{"boolean", `row.paid`, "true"},
+		{"decimal", `row.total`, "19.99"},
+		{"datetime", `[row.placed.kind, row.placed.year, row.placed.month, row.placed.day, row.placed.hour, row.placed.minute]`, "[datetime, 2024, 3, 5, 14, 30]"},
+		{"date", `[row.due.kind, row.due.month, row.due.day]`, "[date, 4, 1]"},
+		{"varchar", `row.code`, "007"},
+		{"int", `row.qty + 1`, "4"},
+		{"null", `row.note`, "null"},
+		{"expressions keep the driver's type", `(db <=?=> "SELECT COUNT(*) AS n, 1.5 AS f FROM t_orders").n`, "1"},
+
+		// Overrides
+		{"query dictionary", `(db <=?=> {sql: "SELECT code FROM t_orders", types: {code: "int"}}).code`, "7"},
+		{"prepare", `db.prepare("SELECT paid FROM t_orders", {types: {paid: "raw"}}).queryOne().paid`, "1"},
+		{"table", `db.table("t_orders").types({total: "string"}).first().total`, "19.99"},
+		{"table string", `typeOf(db.table("t_orders").types({qty: "string"}).first().qty)`, "string"},
+		{"date from datetime", `let r = db.table("t_orders").types({placed: "date"}).first(); [r.placed.kind, r.placed.hour]`, "[date, 0]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(typesSetup + tt.input)
+			if result.Type() == evaluator.ERROR_OBJ {
+				t.Fatalf("Evaluation error: %s", result.Inspect())
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestDatabaseColumnTypeErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		errorContains string
+	}{
+		{`db.table("t_orders").types({total: "money"})`, "type for column `total` must be"},
+		{`db.prepare("SELECT 1", {types: "int"})`, "query types must be a dictionary"},
+		{`db.prepare("SELECT 1", {cache: true})`, "unknown option \"cache\" for prepare()"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalHelper(typesSetup + tt.input)
+			if result.Type() != evaluator.ERROR_OBJ {
+				t.Fatalf("expected error, got %s", result.Inspect())
+			}
+			if !strings.Contains(result.Inspect(), tt.errorContains) {
+				t.Errorf("expected error containing %q, got %q", tt.errorContains, result.Inspect())
+			}
+		})
+	}
+}
@@ -684,3 +684,84 @@ func TestDatetimeIntersectionErrors(t *testing.T) {
 		})
 	}
 }
+
+// TestRelativeDatetime tests relative time formatting of datetimes
+func TestRelativeDatetime(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		expected string
+	}{
+		{
+			name:     "hours in the future",
+			code:     `relative(@2024-03-15T14:00:00, {to: @2024-03-15T12:00:00})`,
+			expected: "in 2 hours",
+		},
+		{
+			name:     "days in the past",
+			code:     `relative(@2024-03-12, {to: @2024-03-15})`,
+			expected: "3 days ago",
+		},
+		{
+			name:     "named day",
+			code:     `relative(@2024-03-14, {to: @2024-03-15})`,
+			expected: "yesterday",
+		},
+		{
+			name:     "calendar months",
+			code:     `relative(@2024-01-20, {to: @2024-03-15})`,
+			expected: "last month",
+		},
+		{
+			name:     "years",
+			code:     `relative(@2021-03-15, {to: @2024-03-15})`,
+			expected: "3 years ago",
+		},
+		{
+			name:     "just now",
+			code:     `relative(@2024-03-15, {to: @2024-03-15})`,
+			expected: "now",
+		},
+		{
+			name:     "localized",
+			code:     `relative(@2024-03-18, {to: @2024-03-15, locale: "de-DE"})`,
+			expected: "in 3 Tagen",
+		},
+		{
+			name:     "method form",
+			code:     `@2024-03-15T12:05:00.relative({to: @2024-03-15T12:00:00})`,
+			expected: "in 5 minutes",
+		},
+		{
+			name:     "defaults to now",
+			code:     `relative(now() - @3d)`,
+			expected: "3 days ago",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, hasErr := testDatetimeCode(tt.code)
+			if hasErr {
+				t.Fatalf("Unexpected error: %v", result)
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+
+	errorTests := []string{
+		`relative("2024-03-15")`,
+		`relative(@2024-03-15, "de-DE")`,
+		`relative(@2024-03-15, {to: "yesterday"})`,
+	}
+
+	for _, code := range errorTests {
+		t.Run(code, func(t *testing.T) {
+			if result, hasErr := testDatetimeCode(code); !hasErr {
+				t.Errorf("Expected error but got success: %v", result)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/diagnostics"
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+func TestSuggest(t *testing.T) {
+	candidates := []string{"formatDate", "format", "len", "toUpper", "toLower", "postTitle"}
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"formatdate", "formatDate"},
+		{"fromatDate", "formatDate"},
+		{"toUpperr", "toUpper"},
+		{"postTitel", "postTitle"},
+		{"lne", ""},
+		{"zzqqxx", ""},
+		{"len", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diagnostics.Suggest(tt.name, candidates); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDiagnosticsPrint(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		diag     diagnostics.Diagnostic
+		expected string
+	}{
+		{
+			name:   "underline and hint",
+			source: "let x = 1\nlet y = formatdate(x)\n",
+			diag: diagnostics.Diagnostic{Message: "identifier not found: formatdate", Line: 2, Column: 9, Length: 10,
+				Hint: "did you mean `formatDate`?"},
+			expected: "  line 2, column 9: identifier not found: formatdate\n" +
+				"    let y = formatdate(x)\n" +
+				"            ^~~~~~~~~~\n" +
+				"    help: did you mean `formatDate`?\n",
+		},
+		{
+			name:   "span over lines",
+			source: "  abc\n  defg",
+			diag:   diagnostics.Diagnostic{Message: "bad", Line: 1, Column: 5, Length: 6},
+			expected: "  line 1, column 5: bad\n" +
+				"    abc\n" +
+				"      ^\n" +
+				"    defg\n" +
+				"    ~~\n",
+		},
+		{
+			name:   "note",
+			source: "let len = 5\nlen([1])",
+			diag: diagnostics.Diagnostic{Message: "not a function: INTEGER", Line: 2, Column: 1, Length: 3,
+				Notes: []diagnostics.Note{{Message: "`len` is declared here", Line: 1, Column: 5}}},
+			expected: "  line 2, column 1: not a function: INTEGER\n" +
+				"    len([1])\n" +
+				"    ^~~\n" +
+				"    note: line 1, column 5: `len` is declared here\n" +
+				"    let len = 5\n" +
+				"        ^\n",
+		},
+		{
+			name:   "imported from",
+			source: "export x = y",
+			diag: diagnostics.Diagnostic{Message: "identifier not found: y", Line: 1, Column: 12,
+				Imports: []diagnostics.Location{{File: "lib/a.pars", Line: 3, Column: 9}, {File: "main.pars"}}},
+			expected: "  line 1, column 12: identifier not found: y\n" +
+				"    export x = y\n" +
+				"               ^\n" +
+				"  imported from 'lib/a.pars', line 3, column 9\n" +
+				"  imported from 'main.pars'\n",
+		},
+		{
+			name:     "parser message",
+			source:   "let = 1",
+			diag:     diagnostics.FromMessage("line 1, column 5: expected identifier"),
+			expected: "  line 1, column 5: expected identifier\n    let = 1\n        ^\n",
+		},
+		{
+			name:     "no position",
+			source:   "x",
+			diag:     diagnostics.FromMessage("something failed"),
+			expected: "  something failed\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			diagnostics.Printer{}.Print(&buf, "page.pars", tt.source, []diagnostics.Diagnostic{tt.diag})
+			expected := "Error in 'page.pars':\n" + tt.expected
+			if buf.String() != expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestDiagnosticsColor(t *testing.T) {
+	var buf bytes.Buffer
+	diag := diagnostics.Diagnostic{Message: "oops", Line: 1, Column: 1, Length: 1, Hint: "try again"}
+	diagnostics.Printer{Color: true}.Print(&buf, "page.pars", "x", []diagnostics.Diagnostic{diag})
+	for _, want := range []string{"\x1b[1;31mError\x1b[0m", "\x1b[1moops\x1b[0m", "\x1b[1;31m^\x1b[0m", "\x1b[32mhelp:\x1b[0m"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected output to contain %q, got %q", want, buf.String())
+		}
+	}
+}
+
+func TestErrorHints(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		hint  string
+	}{
+		{"builtin", `formatdate(@2024-01-01)`, "did you mean `formatDate`?"},
+		{"variable", `let postTitle = "x"; postTitel`, "did you mean `postTitle`?"},
+		{"nothing close", `zzqqxx`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errObj, ok := testEvalHelper(tt.input).(*evaluator.Error)
+			if !ok {
+				t.Fatalf("expected an error")
+			}
+			if errObj.Hint != tt.hint {
+				t.Errorf("expected hint %q, got %q", tt.hint, errObj.Hint)
+			}
+		})
+	}
+}
+
+func TestShadowedBuiltinNote(t *testing.T) {
+	errObj, ok := testEvalHelper("let len = 5\nlen([1])").(*evaluator.Error)
+	if !ok {
+		t.Fatalf("expected an error")
+	}
+	if errObj.Line != 2 || errObj.Length != 3 {
+		t.Errorf("expected the error at the call on line 2, got line %d, length %d", errObj.Line, errObj.Length)
+	}
+	if len(errObj.Notes) != 1 || errObj.Notes[0].Line != 1 ||
+		errObj.Notes[0].Message != "`len` is declared here, hiding the builtin `len`" {
+		t.Errorf("unexpected notes %+v", errObj.Notes)
+	}
+}
@@ -432,3 +432,94 @@ func TestDeleteKeywordNoLongerReserved(t *testing.T) {
 		})
 	}
 }
+
+func TestStringDictKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"string key", `let d = {".card": 1, "--gap": "4px"}; [d[".card"], d["--gap"]]`, `[1, 4px]`},
+		{"mixed with identifiers", `let d = {a: 1, "b c": 2}; d.a + d["b c"]`, `3`},
+		{"keys", `{"x-y": 1}.keys()`, `[x-y]`},
+		{"number key", `{1: "one"}`, `expected identifier or string as dictionary key`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := evalInput(tt.input)
+			if !strings.Contains(result.Inspect(), tt.expected) {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+// TestToDictValueTypes tests that toDict accepts any value type
+func TestToDictValueTypes(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "primitive values",
+			input:    `toDict([["a", 1], ["b", "two"], ["c", true]])`,
+			expected: `{a: 1, b: two, c: true}`,
+		},
+		{
+			name:     "array values",
+			input:    `let d = toDict([["xs", [1, 2]], ["ys", [3]]]); d.xs ++ d.ys`,
+			expected: `[1, 2, 3]`,
+		},
+		{
+			name:     "nested dictionary values",
+			input:    `toDict([["user", {name: "Ann", tags: ["x"]}]]).user.name`,
+			expected: `Ann`,
+		},
+		{
+			name:     "function values",
+			input:    `toDict([["double", fn(x) { x * 2 }]]).double(21)`,
+			expected: `42`,
+		},
+		{
+			name:     "null values",
+			input:    `toDict([["a", null]]).has("a")`,
+			expected: `true`,
+		},
+		{
+			name:     "datetime values keep their type",
+			input:    `toDict([["when", @2024-03-01]]).when.month`,
+			expected: `3`,
+		},
+		{
+			name:     "round trip through toArray",
+			input:    `let d = {a: {b: {c: 1}}, xs: [1, 2]}; let r = toDict(toArray(d)); r.a.b.c + r.xs[1]`,
+			expected: `3`,
+		},
+		{
+			name:     "nested dictionaries from parsed JSON",
+			input:    `let data = parseJSON("{\"a\": {\"b\": [1, {\"c\": 2}]}}"); toDict(toArray(data)).a.b[1].c`,
+			expected: `2`,
+		},
+		{
+			name:     "invalid pair",
+			input:    `toDict([["a"]])`,
+			expected: "ERROR: `toDict` expects [key, value] pairs, got [a] at index 0",
+		},
+		{
+			name:     "non-string key",
+			input:    `toDict([[1, 2]])`,
+			expected: "ERROR: `toDict` keys must be strings, got INTEGER at index 0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := evalInput(tt.input)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDictionaryTransformMethods(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		expected string
+	}{
+		{
+			name:     "size",
+			code:     `{a: 1, b: 2, c: 3}.size()`,
+			expected: "3",
+		},
+		{
+			name:     "size of empty dictionary",
+			code:     `{}.size()`,
+			expected: "0",
+		},
+		{
+			name:     "entries sorted by key",
+			code:     `{b: 2, a: 1}.entries()`,
+			expected: "[[a, 1], [b, 2]]",
+		},
+		{
+			name:     "entries evaluate this",
+			code:     `let d = {x: 2, double: this.x * 2}; d.entries()`,
+			expected: "[[double, 4], [x, 2]]",
+		},
+		{
+			name:     "mapValues with value",
+			code:     `{a: 1, b: 2}.mapValues(fn(v) { v * 10 }).entries()`,
+			expected: "[[a, 10], [b, 20]]",
+		},
+		{
+			name:     "mapValues with value and key",
+			code:     `{a: 1, b: 2}.mapValues(fn(v, k) { k + v }).entries()`,
+			expected: "[[a, a1], [b, b2]]",
+		},
+		{
+			name:     "mapValues keeps nulls",
+			code:     `{a: 1, b: 2}.mapValues(fn(v) { null }).size()`,
+			expected: "2",
+		},
+		{
+			name:     "mapValues preserves datetimes",
+			code:     `let d = {start: @2024-01-15}.mapValues(fn(v) { v + @1d }); d.start.day`,
+			expected: "16",
+		},
+		{
+			name:     "mapValues preserves nested dictionaries",
+			code:     `{a: 1}.mapValues(fn(v) { {n: v} }).a.n`,
+			expected: "1",
+		},
+		{
+			name:     "filter by value",
+			code:     `{a: 1, b: 2, c: 3}.filter(fn(v) { v > 1 }).keys().sort()`,
+			expected: "[b, c]",
+		},
+		{
+			name:     "filter by key",
+			code:     `{a: 1, b: 2, c: 3}.filter(fn(v, k) { k != "b" }).entries()`,
+			expected: "[[a, 1], [c, 3]]",
+		},
+		{
+			name:     "pick",
+			code:     `{a: 1, b: 2, c: 3}.pick(["a", "c", "z"]).entries()`,
+			expected: "[[a, 1], [c, 3]]",
+		},
+		{
+			name:     "omit",
+			code:     `{a: 1, b: 2, c: 3}.omit(["a", "c"]).entries()`,
+			expected: "[[b, 2]]",
+		},
+		{
+			name:     "pick does not modify receiver",
+			code:     `let d = {a: 1, b: 2}; let p = d.pick(["a"]); d.size()`,
+			expected: "2",
+		},
+		{
+			name:     "fromEntries builtin",
+			code:     `fromEntries([["a", 1], ["b", [1, 2]]]).b`,
+			expected: "[1, 2]",
+		},
+		{
+			name:     "fromEntries method merges into receiver",
+			code:     `{a: 1, b: 2}.fromEntries([["b", 20], ["c", 30]]).entries()`,
+			expected: "[[a, 1], [b, 20], [c, 30]]",
+		},
+		{
+			name:     "entries round trip",
+			code:     `let d = {when: @2024-06-01, tags: ["x"]}; fromEntries(d.entries()).when.month`,
+			expected: "6",
+		},
+		{
+			name:     "chaining",
+			code:     `{a: 1, b: 2, c: 3}.omit(["c"]).mapValues(fn(v) { v * v }).filter(fn(v) { v > 1 }).entries()`,
+			expected: "[[b, 4]]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestDictionaryTransformMethodErrors(t *testing.T) {
+	tests := []struct {
+		code        string
+		errContains string
+	}{
+		{`{a: 1}.size(1)`, "wrong number of arguments to `size`"},
+		{`{a: 1}.mapValues(1)`, "must be a function"},
+		{`{a: 1}.filter("x")`, "must be a function"},
+		{`{a: 1}.pick("a")`, "must be an array of strings"},
+		{`{a: 1}.omit([1])`, "must be an array of strings"},
+		{`fromEntries([["a"]])`, "expects [key, value] pairs"},
+		{`fromEntries([[1, 2]])`, "keys must be strings"},
+		{`fromEntries("a")`, "must be an array"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if !strings.Contains(result.Inspect(), tt.errContains) {
+				t.Errorf("expected error containing %q, got %s", tt.errContains, result.Inspect())
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/formatter"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		old      string
+		new      string
+		context  int
+		expected string
+	}{
+		{"unchanged", "<p>a</p>\n<p>b</p>\n", "<p>a</p>\n<p>b</p>\n", 2, ""},
+		{"trailing newline", "a\n", "a", 2, ""},
+		{"changed line", "a\nb\nc\nd\ne\n", "a\nb\nX\nd\ne\n", 1,
+			"@@ -2,3 +2,3 @@\n   b\n-  c\n+  X\n   d\n"},
+		{"added line", "a\nb", "a\nb\nc", 1,
+			"@@ -2,1 +2,2 @@\n   b\n+  c\n"},
+		{"separate hunks", "1\n2\n3\n4\n5\n6\n7\n8\n9\n10", "1\ntwo\n3\n4\n5\n6\n7\n8\nnine\n10", 1,
+			"@@ -1,3 +1,3 @@\n   1\n-  2\n+  two\n   3\n" +
+				"@@ -8,3 +8,3 @@\n   8\n-  9\n+  nine\n   10\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := formatter.DiffLines(tt.old, tt.new, tt.context)
+			if result != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, result)
+			}
+		})
+	}
+}
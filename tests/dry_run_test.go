@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+	"github.com/sambeau/parsley/pkg/lexer"
+	"github.com/sambeau/parsley/pkg/parser"
+)
+
+func TestDryRun(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "in.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var log bytes.Buffer
+	saved := evaluator.DryRunLog
+	evaluator.DryRunLog = &log
+	defer func() { evaluator.DryRunLog = saved }()
+
+	input := `let s <== text(@./in.txt)
+s ==> text(@./out.txt)
+dir(@./new).mkdir()
+file(@./in.txt).remove()
+let db = SQLITE(":memory:")
+let created = db <=!=> "CREATE TABLE t (a INTEGER)"
+let stmt = db.prepare("UPDATE t SET a = ?")
+let updated = stmt.exec(2);
+[s, created.affected, updated.affected]`
+
+	program := parser.New(lexer.New(input)).ParseProgram()
+	env := evaluator.NewEnvironment()
+	env.Filename = filepath.Join(dir, "main.pars")
+	env.Security = &evaluator.SecurityPolicy{AllowWriteAll: true, DryRun: true}
+
+	result := evaluator.Eval(program, env)
+	if result.Inspect() != "[hello, 0, 0]" {
+		t.Fatalf("unexpected result: %s", result.Inspect())
+	}
+
+	for _, name := range []string{"out.txt", "new"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s not to be created", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "in.txt")); err != nil {
+		t.Errorf("expected in.txt not to be deleted: %v", err)
+	}
+
+	expected := []string{
+		"dry run: write 5 bytes to " + filepath.Join(dir, "out.txt"),
+		"dry run: create directory " + filepath.Join(dir, "new"),
+		"dry run: delete " + filepath.Join(dir, "in.txt"),
+		"dry run: execute SQL: CREATE TABLE t (a INTEGER)",
+		"dry run: execute SQL: UPDATE t SET a = ? [2]",
+	}
+	if got := strings.Split(strings.TrimSpace(log.String()), "\n"); strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected log:\n%s\ngot:\n%s", strings.Join(expected, "\n"), log.String())
+	}
+}
+
+func TestDryRunStillChecksPermissions(t *testing.T) {
+	var log bytes.Buffer
+	saved := evaluator.DryRunLog
+	evaluator.DryRunLog = &log
+	defer func() { evaluator.DryRunLog = saved }()
+
+	program := parser.New(lexer.New(`"x" ==> text(@./out.txt)`)).ParseProgram()
+	env := evaluator.NewEnvironment()
+	env.Filename = filepath.Join(t.TempDir(), "main.pars")
+	env.Security = &evaluator.SecurityPolicy{DryRun: true}
+
+	result := evaluator.Eval(program, env)
+	if result.Type() != evaluator.ERROR_OBJ || !strings.Contains(result.Inspect(), "file write not allowed") {
+		t.Errorf("expected a write permission error, got %s", result.Inspect())
+	}
+	if log.Len() != 0 {
+		t.Errorf("expected nothing logged, got %q", log.String())
+	}
+}
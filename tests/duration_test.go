@@ -344,3 +344,170 @@ func TestDurationErrors(t *testing.T) {
 		})
 	}
 }
+
+func TestDurationUnitFormatting(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		expected string
+	}{
+		{
+			name:     "long style is the default",
+			code:     `format(@1h30m, {})`,
+			expected: "1 hour, 30 minutes",
+		},
+		{
+			name:     "narrow style",
+			code:     `format(@1d2h30m, {style: "narrow"})`,
+			expected: "1d 2h 30m",
+		},
+		{
+			name:     "maxUnits keeps largest units",
+			code:     `format(@1d2h30m, {maxUnits: 2})`,
+			expected: "1 day, 2 hours",
+		},
+		{
+			name:     "months and years",
+			code:     `format(@1y2mo, {style: "long"})`,
+			expected: "1 year, 2 months",
+		},
+		{
+			name:     "negative duration",
+			code:     `format(@-2h, {style: "narrow"})`,
+			expected: "-2h",
+		},
+		{
+			name:     "zero duration",
+			code:     `format(@1h - @1h, {})`,
+			expected: "0 seconds",
+		},
+		{
+			name:     "german locale",
+			code:     `format(@2h1m, {locale: "de-DE"})`,
+			expected: "2 Stunden, 1 Minute",
+		},
+		{
+			name:     "method form",
+			code:     `@3d4h.format({style: "narrow", maxUnits: 1})`,
+			expected: "3d",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, hasErr := testDurationCode(tt.code)
+			if hasErr {
+				t.Fatalf("testDurationCode() unexpected error: %v", result)
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		expected string
+	}{
+		{
+			name:     "compact syntax",
+			code:     `parseDuration("1h30m").seconds`,
+			expected: "5400",
+		},
+		{
+			name:     "spaces between units",
+			code:     `parseDuration("1h 30m").seconds`,
+			expected: "5400",
+		},
+		{
+			name:     "negative with spaces",
+			code:     `parseDuration("-1d 12h").seconds`,
+			expected: "-129600",
+		},
+		{
+			name:     "ISO 8601 time",
+			code:     `parseDuration("PT1H30M").seconds`,
+			expected: "5400",
+		},
+		{
+			name:     "ISO 8601 date and time",
+			code:     `let d = parseDuration("P1Y2M3DT4H"); [d.months, d.seconds]`,
+			expected: "[14, 273600]",
+		},
+		{
+			name:     "ISO 8601 weeks",
+			code:     `parseDuration("P2W").seconds`,
+			expected: "1209600",
+		},
+		{
+			name:     "round trip through narrow format",
+			code:     `let d = @2d3h15m; parseDuration(d.format({style: "narrow"})) == d`,
+			expected: "true",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, hasErr := testDurationCode(tt.code)
+			if hasErr {
+				t.Fatalf("testDurationCode() unexpected error: %v", result)
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+
+	errorTests := []string{
+		`parseDuration("")`,
+		`parseDuration("1x")`,
+		`parseDuration("PT")`,
+		`parseDuration("P1H")`,
+		`parseDuration(42)`,
+		`format(@1h, {style: "wide"})`,
+		`format(@1h, {maxUnits: 0})`,
+	}
+
+	for _, code := range errorTests {
+		t.Run(code, func(t *testing.T) {
+			result, hasErr := testDurationCode(code)
+			if !hasErr {
+				t.Errorf("Expected error but got result: %s", result.Inspect())
+			}
+		})
+	}
+}
+
+func TestDurationMilliseconds(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		expected string
+	}{
+		{"literal", `let d = @500ms; [d.seconds, d.milliseconds]`, "[0, 500]"},
+		{"with seconds", `let d = @1s250ms; [d.seconds, d.milliseconds]`, "[1, 250]"},
+		{"minutes are still minutes", `@5m.seconds`, "300"},
+		{"add carries into seconds", `let d = @1s250ms + @750ms; [d.seconds, d.milliseconds == null]`, "[2, true]"},
+		{"negative", `let d = @-1s500ms; [d.seconds, d.milliseconds]`, "[-1, -500]"},
+		{"compare", `[@250ms < @1s, @1000ms == @1s]`, "[true, true]"},
+		{"divide keeps the remainder", `let d = @1s / 4; d.milliseconds`, "250"},
+		{"string", `toString(@1m1s5ms)`, "1 minute 1 second 5 milliseconds"},
+		{"parseDuration", `parseDuration("2s 5ms").milliseconds`, "5"},
+		{"ISO round trip", `let j = stringifyJSON({d: @1s250ms}); [j, parseDuration("PT1.25S") == @1s250ms]`, `[{"d":"PT1.250S"}, true]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, hasErr := testDurationCode(tt.code)
+			if hasErr {
+				t.Fatalf("testDurationCode() unexpected error: %v", result)
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
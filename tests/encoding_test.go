@@ -0,0 +1,273 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTextEncodings(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "parsley_encoding_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	files := map[string][]byte{
+		// "café" in latin-1
+		"latin1.txt": {'c', 'a', 'f', 0xE9},
+		// "€5" in windows-1252
+		"cp1252.txt": {0x80, '5'},
+		// "日本" in Shift JIS
+		"sjis.txt": {0x93, 0xFA, 0x96, 0x7B},
+		// "hi" in UTF-16LE with BOM
+		"utf16.txt": {0xFF, 0xFE, 'h', 0, 'i', 0},
+		// A legacy CSV export
+		"export.csv": []byte("name,city\nJos\xe9,M\xe1laga\n"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), data, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	path := func(name string) string { return filepath.Join(tmpDir, name) }
+
+	tests := []struct {
+		name     string
+		code     string
+		expected string
+	}{
+		{
+			name:     "read latin-1",
+			code:     `let s <== text("` + path("latin1.txt") + `", {encoding: "latin1"}); s`,
+			expected: "café",
+		},
+		{
+			name:     "read windows-1252",
+			code:     `let s <== text("` + path("cp1252.txt") + `", {encoding: "windows-1252"}); s`,
+			expected: "€5",
+		},
+		{
+			name:     "read shift-jis",
+			code:     `let s <== text("` + path("sjis.txt") + `", {encoding: "shift-jis"}); s`,
+			expected: "日本",
+		},
+		{
+			name:     "read utf-16 with BOM",
+			code:     `let s <== text("` + path("utf16.txt") + `", {encoding: "utf-16"}); s`,
+			expected: "hi",
+		},
+		{
+			name:     "read latin-1 CSV",
+			code:     `let rows <== CSV("` + path("export.csv") + `", {encoding: "iso-8859-1"}); rows[0].name + " " + rows[0].city`,
+			expected: "José Málaga",
+		},
+		{
+			name:     "encoding names are case-insensitive",
+			code:     `let s <== text("` + path("latin1.txt") + `", {encoding: "Latin1"}); s`,
+			expected: "café",
+		},
+		{
+			name:     "utf-8 is a no-op",
+			code:     `"naïve" ==> text("` + path("u8.txt") + `", {encoding: "UTF-8"}); let s <== text("` + path("u8.txt") + `"); s`,
+			expected: "naïve",
+		},
+		{
+			name:     "write and read back shift-jis",
+			code:     `"東京" ==> text("` + path("out-sjis.txt") + `", {encoding: "sjis"}); let s <== text("` + path("out-sjis.txt") + `", {encoding: "sjis"}); s`,
+			expected: "東京",
+		},
+		{
+			name:     "write utf-16be lines",
+			code:     `let f = lines("` + path("out16.txt") + `", {encoding: "utf-16be"}); ["a", "b"] ==> f; let ls <== f; ls`,
+			expected: "[a, b]",
+		},
+		{
+			name:     "other WHATWG labels",
+			code:     `"€" ==> text("` + path("out15.txt") + `", {encoding: "iso-8859-15"}); let s <== text("` + path("out15.txt") + `", {encoding: "iso-8859-15"}); s`,
+			expected: "€",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalWriteOp(tt.code)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+
+	// Written bytes use the target encoding
+	testEvalWriteOp(`"café" ==> text("` + path("out-latin1.txt") + `", {encoding: "latin1"})`)
+	data, err := os.ReadFile(path("out-latin1.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(data) != "caf\xe9" {
+		t.Errorf("expected latin-1 bytes, got %q", data)
+	}
+}
+
+func TestTextEncodingErrors(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "parsley_encoding_err_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	target := filepath.Join(tmpDir, "out.txt")
+	os.WriteFile(target, []byte("x"), 0644)
+
+	tests := []struct {
+		name          string
+		code          string
+		errorContains string
+	}{
+		{
+			name:          "unknown encoding on read",
+			code:          `let s <== text("` + target + `", {encoding: "klingon"}); s`,
+			errorContains: "unsupported encoding: klingon",
+		},
+		{
+			name:          "unknown encoding on write",
+			code:          `"x" ==> text("` + target + `", {encoding: "klingon"})`,
+			errorContains: "unsupported encoding: klingon",
+		},
+		{
+			name:          "non-string encoding",
+			code:          `"x" ==> text("` + target + `", {encoding: 1})`,
+			errorContains: "`encoding` option must be a string",
+		},
+		{
+			name:          "character not representable",
+			code:          `"日本" ==> text("` + target + `", {encoding: "latin1"})`,
+			errorContains: "failed to encode text as latin1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalWriteOp(tt.code)
+			if !strings.Contains(result.Inspect(), tt.errorContains) {
+				t.Errorf("expected error containing %q, got %q", tt.errorContains, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestBOMAndNewlineOptions(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "parsley_newline_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	path := func(name string) string { return filepath.Join(tmpDir, name) }
+
+	// An Excel-style CSV export: UTF-8 BOM and CRLF line endings
+	os.WriteFile(path("excel.csv"), []byte("\xef\xbb\xbfname,qty\r\nApple,3\r\nPear,5\r\n"), 0644)
+	os.WriteFile(path("mixed.txt"), []byte("a\r\nb\rc\n"), 0644)
+	os.WriteFile(path("bom16.txt"), []byte{0xFF, 0xFE, 'o', 0, 'k', 0, '\r', 0, '\n', 0}, 0644)
+
+	tests := []struct {
+		name     string
+		code     string
+		expected string
+	}{
+		{
+			name:     "BOM is kept by default",
+			code:     `let rows <== CSV("` + path("excel.csv") + `"); rows[0].has("name")`,
+			expected: "false",
+		},
+		{
+			name:     "stripBOM fixes the first header",
+			code:     `let rows <== CSV("` + path("excel.csv") + `", {stripBOM: true}); rows[1].name`,
+			expected: "Pear",
+		},
+		{
+			name:     "normalize CRLF and CR to LF",
+			code:     `let s <== text("` + path("mixed.txt") + `", {newline: "lf"}); s.split("\n")`,
+			expected: "[a, b, c, ]",
+		},
+		{
+			name:     "UTF-16 BOM handled by encoding with newline normalization",
+			code:     `let s <== text("` + path("bom16.txt") + `", {encoding: "utf-16", newline: "lf"}); s == "ok\n"`,
+			expected: "true",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalWriteOp(tt.code)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+
+	writes := []struct {
+		name     string
+		code     string
+		file     string
+		expected string
+	}{
+		{
+			name:     "write CRLF line endings",
+			code:     `["a", "b"] ==> lines("` + path("crlf.txt") + `", {newline: "crlf"})`,
+			file:     "crlf.txt",
+			expected: "a\r\nb",
+		},
+		{
+			name:     "write CSV with BOM and CRLF for Excel",
+			code:     `[{name: "Zoë"}] ==> CSV("` + path("out.csv") + `", {bom: true, newline: "crlf"})`,
+			file:     "out.csv",
+			expected: "\xef\xbb\xbfname\r\nZoë\r\n",
+		},
+		{
+			name:     "write LF from mixed input",
+			code:     `let s <== text("` + path("mixed.txt") + `"); s ==> text("` + path("lf.txt") + `", {newline: "lf"})`,
+			file:     "lf.txt",
+			expected: "a\nb\nc\n",
+		},
+		{
+			name:     "BOM written once when appending",
+			code:     `let f = text("` + path("log.txt") + `", {bom: true, append: true}); "a" ==> f; "b" ==> f`,
+			file:     "log.txt",
+			expected: "\xef\xbb\xbfab",
+		},
+	}
+
+	for _, tt := range writes {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalWriteOp(tt.code)
+			if result != nil && result.Type() == "ERROR" {
+				t.Fatalf("Evaluation error: %s", result.Inspect())
+			}
+			data, err := os.ReadFile(path(tt.file))
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+			if string(data) != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, data)
+			}
+		})
+	}
+
+	errors := []struct {
+		code          string
+		errorContains string
+	}{
+		{`"x" ==> text("` + path("e.txt") + `", {newline: "cr"})`, "must be \"lf\" or \"crlf\""},
+		{`"x" ==> text("` + path("e.txt") + `", {bom: "yes"})`, "`bom` option must be a boolean"},
+		{`let s <== text("` + path("mixed.txt") + `", {stripBOM: 1}); s`, "`stripBOM` option must be a boolean"},
+	}
+
+	for _, tt := range errors {
+		t.Run(tt.code, func(t *testing.T) {
+			result := testEvalWriteOp(tt.code)
+			if !strings.Contains(result.Inspect(), tt.errorContains) {
+				t.Errorf("expected error containing %q, got %q", tt.errorContains, result.Inspect())
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+	"github.com/sambeau/parsley/pkg/lexer"
+	"github.com/sambeau/parsley/pkg/parser"
+)
+
+func evalWithEnvVars(input string, vars map[string]string) evaluator.Object {
+	program := parser.New(lexer.New(input)).ParseProgram()
+	env := evaluator.NewEnvironment()
+	env.EnvVars = vars
+	return evaluator.Eval(program, env)
+}
+
+func TestEnvVars(t *testing.T) {
+	vars := map[string]string{"API_HOST": "api.example.com", "DATA_DIR": "/srv/data"}
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"URL template", `toString(@(https://{env.API_HOST}/v1/users))`, "https://api.example.com/v1/users"},
+		{"path template", `toString(@({env.DATA_DIR}/users.json))`, "/srv/data/users.json"},
+		{"in functions", `let host = fn() { env.API_HOST }; host()`, "api.example.com"},
+		{"shadowed", `let env = {API_HOST: "localhost"}; env.API_HOST`, "localhost"},
+		{"eval", `eval("env.API_HOST")`, "api.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := evalWithEnvVars(tt.input, vars)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestEnvVarsNotExposed(t *testing.T) {
+	tests := []struct {
+		input string
+		vars  map[string]string
+	}{
+		{`env.HOME`, nil},
+		{`@(https://{env.API_HOST}/v1)`, map[string]string{"DATA_DIR": "/srv/data"}},
+		{`eval("env.API_HOST", {sandbox: true})`, map[string]string{"API_HOST": "api.example.com"}},
+	}
+
+	for _, tt := range tests {
+		result := evalWithEnvVars(tt.input, tt.vars)
+		errObj, ok := result.(*evaluator.Error)
+		if !ok || !strings.Contains(errObj.Message, "not set or not exposed") {
+			t.Errorf("%s: expected not exposed error, got %s", tt.input, result.Inspect())
+		}
+	}
+}
+
+func TestExposeEnv(t *testing.T) {
+	t.Setenv("PARSLEY_TEST_HOST", "staging.example.com")
+	vars := evaluator.ExposeEnv([]string{"PARSLEY_TEST_HOST", "PARSLEY_TEST_UNSET"})
+	if len(vars) != 1 || vars["PARSLEY_TEST_HOST"] != "staging.example.com" {
+		t.Errorf("unexpected exposed variables: %v", vars)
+	}
+}
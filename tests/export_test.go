@@ -190,6 +190,14 @@ export let [a, b] = [1, 2]
 			mainCode:       `let mod = import("%s"); mod.a + mod.b`,
 			expectedOutput: "3",
 		},
+		{
+			name: "let dictionary destructuring - backward compat",
+			moduleCode: `
+let {a, b as c} = {a: 1, b: 2}
+`,
+			mainCode:       `let mod = import("%s"); mod.a + mod.c`,
+			expectedOutput: "3",
+		},
 	}
 
 	for _, tt := range tests {
@@ -234,6 +242,10 @@ func TestExportStatementString(t *testing.T) {
 			input:    "export x = 10",
 			expected: "export x = 10;",
 		},
+		{
+			input:    "import {add, PI as pi} from @./math.pars",
+			expected: "import {add, PI as pi} from @./math.pars",
+		},
 	}
 
 	for _, tt := range tests {
@@ -252,6 +264,100 @@ func TestExportStatementString(t *testing.T) {
 	}
 }
 
+// TestNamedImports tests import {a, b} from path
+func TestNamedImports(t *testing.T) {
+	tmpDir := t.TempDir()
+	modules := map[string]string{
+		"math.pars": `
+export let PI = 3.14159
+export add = fn(a, b) { a + b }
+let multiply = fn(a, b) { a * b }
+helper = fn(x) { x * 2 }
+`,
+		"strict.pars": `"use strict"
+export let visible = 1
+let hidden = 2
+`,
+		"list.json": `[1, 2]`,
+		"site.json": `{"title": "Home"}`,
+	}
+	for name, code := range modules {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(code), 0644); err != nil {
+			t.Fatalf("Failed to write module file: %v", err)
+		}
+	}
+	mainFile := filepath.Join(tmpDir, "main.pars")
+
+	tests := []struct {
+		name     string
+		code     string
+		expected string
+	}{
+		{"names", `import {add, PI} from @./math.pars; add(PI, 1)`, "4.14159"},
+		{"alias", `import {add as plus} from @./math.pars; plus(1, 2)`, "3"},
+		{"string path", `import {add} from "./math.pars"; add(2, 2)`, "4"},
+		{"let - backward compat", `import {multiply} from @./math.pars; multiply(2, 3)`, "6"},
+		{"strict module export", `import {visible} from @./strict.pars; visible`, "1"},
+		{"data file", `import {title} from @./site.json; title`, "Home"},
+		{"imports are not re-exported", `import {add} from @./math.pars; let mod = import(@./math.pars); mod.keys().sort()`, "[PI, add, multiply]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := evalExport(tt.code, mainFile)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+
+	errTests := []struct {
+		name        string
+		code        string
+		errContains string
+		hint        string
+	}{
+		{"private name", `import {helper} from @./math.pars`, "helper is not exported by ./math.pars", "declare it with `export`"},
+		{"let in strict module", `import {hidden} from @./strict.pars`, "hidden is not exported by ./strict.pars", "export let"},
+		{"unknown name", `import {multiplied} from @./math.pars`, "./math.pars has no export named multiplied", "did you mean `multiply`?"},
+		{"not a dictionary", `import {x} from @./list.json`, "imports as array", ""},
+		{"missing module", `import {x} from @./nope.pars`, "failed to read module file", ""},
+	}
+
+	for _, tt := range errTests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := evalExport(tt.code, mainFile)
+			errObj, ok := result.(*evaluator.Error)
+			if !ok {
+				t.Fatalf("expected error, got %s (%s)", result.Type(), result.Inspect())
+			}
+			if !strings.Contains(errObj.Message, tt.errContains) {
+				t.Errorf("expected error containing %q, got %q", tt.errContains, errObj.Message)
+			}
+			if !strings.Contains(errObj.Hint, tt.hint) {
+				t.Errorf("expected hint containing %q, got %q", tt.hint, errObj.Hint)
+			}
+		})
+	}
+
+	parseErrors := []struct {
+		code        string
+		errContains string
+	}{
+		{`import {a, a} from @./math.pars`, "a is imported twice"},
+		{`import {a} @./math.pars`, "expected 'from' after the import list"},
+	}
+	for _, tt := range parseErrors {
+		t.Run(tt.code, func(t *testing.T) {
+			p := parser.New(lexer.New(tt.code))
+			p.ParseProgram()
+			if len(p.Errors()) == 0 || !strings.Contains(p.Errors()[0], tt.errContains) {
+				t.Errorf("expected parse error containing %q, got %v", tt.errContains, p.Errors())
+			}
+		})
+	}
+}
+
 // TestBareAssignmentNotExported tests that bare assignments are NOT exported
 func TestBareAssignmentNotExported(t *testing.T) {
 	// Create a temporary directory for module files
@@ -1,10 +1,16 @@
 package main
 
 import (
+	"encoding/pem"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/sambeau/parsley/pkg/evaluator"
 )
@@ -24,38 +30,32 @@ func TestUrlBuiltin(t *testing.T) {
 			name:  "basic URL parsing",
 			input: `url("https://example.com")`,
 			check: func(obj evaluator.Object) bool {
-				dict, ok := obj.(*evaluator.Dictionary)
-				if !ok {
-					return false
-				}
-				// Check it has URL fields
-				_, hasScheme := dict.Pairs["scheme"]
-				_, hasHost := dict.Pairs["host"]
-				return hasScheme && hasHost
+				u, ok := obj.(*evaluator.Url)
+				return ok && u.Scheme == "https" && u.Host == "example.com"
 			},
 		},
 		{
 			name:  "URL with path",
 			input: `url("https://example.com/api/users")`,
 			check: func(obj evaluator.Object) bool {
-				dict, ok := obj.(*evaluator.Dictionary)
-				return ok && dict != nil
+				u, ok := obj.(*evaluator.Url)
+				return ok && u.Inspect() == "https://example.com/api/users"
 			},
 		},
 		{
 			name:  "URL with query params",
 			input: `url("https://example.com/search?q=test&page=1")`,
 			check: func(obj evaluator.Object) bool {
-				dict, ok := obj.(*evaluator.Dictionary)
-				return ok && dict != nil
+				u, ok := obj.(*evaluator.Url)
+				return ok && u.Query["q"] == "test" && u.Query["page"] == "1"
 			},
 		},
 		{
 			name:  "URL with port",
 			input: `url("https://example.com:8080/api")`,
 			check: func(obj evaluator.Object) bool {
-				dict, ok := obj.(*evaluator.Dictionary)
-				return ok && dict != nil
+				u, ok := obj.(*evaluator.Url)
+				return ok && u.Port == 8080
 			},
 		},
 		{
@@ -396,3 +396,170 @@ func TestFetchLinesFormat(t *testing.T) {
 		}
 	})
 }
+
+// ============================================================================
+// Proxy and TLS Option Tests
+// ============================================================================
+
+func TestFetchProxyAndTLS(t *testing.T) {
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secure"))
+	}))
+	defer tlsServer.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsServer.Certificate().Raw})
+	os.WriteFile(caFile, caPEM, 0644)
+
+	// A proxy gets the full URL of the request it forwards
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("proxied " + r.URL.String()))
+	}))
+	defer proxy.Close()
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "untrusted certificate",
+			input:    `let {data, error} <=/= text(url("` + tlsServer.URL + `")); error`,
+			expected: "certificate",
+		},
+		{
+			name:     "custom CA",
+			input:    `let {data, error} <=/= text(url("` + tlsServer.URL + `"), {caCert: "` + caFile + `"}); data`,
+			expected: "secure",
+		},
+		{
+			name:     "insecureTLS",
+			input:    `let {data, error} <=/= text(url("` + tlsServer.URL + `"), {insecureTLS: true}); data`,
+			expected: "secure",
+		},
+		{
+			name:     "proxy",
+			input:    `let {data, error} <=/= text(@http://internal.example/status, {proxy: "` + proxy.URL + `"}); data`,
+			expected: "proxied http://internal.example/status",
+		},
+		{
+			name:     "invalid proxy",
+			input:    `let {data, error} <=/= text(@http://internal.example/status, {proxy: "not a url"}); error`,
+			expected: "invalid proxy URL",
+		},
+		{
+			name:     "client certificate without key",
+			input:    `let {data, error} <=/= text(url("` + tlsServer.URL + `"), {clientCert: "` + caFile + `"}); error`,
+			expected: "clientCert and clientKey must be given together",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if !strings.Contains(result.Inspect(), tt.expected) {
+				t.Errorf("expected %q in %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestFetchRetries(t *testing.T) {
+	// /flaky/<name> fails twice, then echoes the request body
+	var mu sync.Mutex
+	seen := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/flaky/"):
+			mu.Lock()
+			seen[r.URL.Path]++
+			n := seen[r.URL.Path]
+			mu.Unlock()
+			if n <= 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			body, _ := io.ReadAll(r.Body)
+			w.Write([]byte("ok " + string(body)))
+		case r.URL.Path == "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case r.URL.Path == "/slow":
+			time.Sleep(300 * time.Millisecond)
+			w.Write([]byte("slow"))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "retries until success",
+			input:    `let {data, attempts} <=/= text(url("` + server.URL + `/flaky/a"), {retries: 3, backoff: @1ms}); [data, attempts]`,
+			expected: "[ok , 3]",
+		},
+		{
+			name:     "response metadata",
+			input:    `let r <=/= text(url("` + server.URL + `/flaky/b"), {retries: 2, backoff: @1ms}); [r.response().status, r.response().attempts]`,
+			expected: "[200, 3]",
+		},
+		{
+			name:     "gives up after retries",
+			input:    `let {data, status, attempts} <=/= text(url("` + server.URL + `/down"), {retries: 2, backoff: @1ms}); [status, attempts]`,
+			expected: "[500, 3]",
+		},
+		{
+			name:     "no retries by default",
+			input:    `let {data, status, attempts} <=/= text(url("` + server.URL + `/flaky/c")); [status, attempts]`,
+			expected: "[503, 1]",
+		},
+		{
+			name:     "client errors aren't retried",
+			input:    `let {data, status, attempts} <=/= text(url("` + server.URL + `/missing"), {retries: 3, backoff: @1ms}); [status, attempts]`,
+			expected: "[404, 1]",
+		},
+		{
+			name:     "body is sent again",
+			input:    `let {data} <=/= text(url("` + server.URL + `/flaky/d"), {method: "POST", body: "hello", retries: 2, backoff: @1ms}); data`,
+			expected: "ok hello",
+		},
+		{
+			name:     "duration timeout",
+			input:    `let {error, attempts} <=/= text(url("` + server.URL + `/slow"), {timeout: @100ms, retries: 1, backoff: @1ms}); [error.contains("fetch failed"), attempts]`,
+			expected: "[true, 2]",
+		},
+		{
+			name:     "millisecond timeout",
+			input:    `let {data} <=/= text(url("` + server.URL + `/slow"), {timeout: 5000}); data`,
+			expected: "slow",
+		},
+		{
+			name:     "invalid retries",
+			input:    `let {error} <=/= text(url("` + server.URL + `/down"), {retries: -1}); error`,
+			expected: "`retries` option must be a non-negative integer",
+		},
+		{
+			name:     "invalid backoff",
+			input:    `let {error} <=/= text(url("` + server.URL + `/down"), {backoff: 5}); error`,
+			expected: "`backoff` option must be a duration",
+		},
+		{
+			name:     "invalid timeout",
+			input:    `let {error} <=/= text(url("` + server.URL + `/down"), {timeout: "soon"}); error`,
+			expected: "`timeout` option must be a positive duration or a number of milliseconds",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
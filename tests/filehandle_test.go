@@ -4,7 +4,9 @@ package main
 
 import (
 	"os"
+	"os/user"
 	"path/filepath"
+	"runtime"
 	"testing"
 
 	"github.com/sambeau/parsley/pkg/evaluator"
@@ -163,6 +165,64 @@ func TestFileModifiedDatetime(t *testing.T) {
 	}
 }
 
+// Test file handle metadata properties
+func TestFileMetadataProperties(t *testing.T) {
+	tmpDir := t.TempDir()
+	page := filepath.Join(tmpDir, "index.html")
+	os.WriteFile(page, []byte("<html></html>"), 0640)
+	os.Chmod(page, 0640)
+	image := filepath.Join(tmpDir, "logo")
+	os.WriteFile(image, []byte("\x89PNG\r\n\x1a\n0000"), 0755)
+	os.Chmod(image, 0755)
+	link := filepath.Join(tmpDir, "home.html")
+	hasSymlinks := os.Symlink("index.html", link) == nil
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"mime from extension", `file(@` + page + `).mime`, "text/html"},
+		{"mime from content", `file(@` + image + `).mime`, "image/png"},
+		{"mime of directory", `dir(@` + tmpDir + `).mime`, "inode/directory"},
+		{"isSymlink false", `file(@` + page + `).isSymlink`, "false"},
+		{"target of file", `file(@` + page + `).target`, "null"},
+		{"created of missing file", `file(@` + filepath.Join(tmpDir, "missing.txt") + `).created`, "null"},
+		{"owner of missing file", `file(@` + filepath.Join(tmpDir, "missing.txt") + `).owner`, "null"},
+	}
+	if runtime.GOOS != "windows" {
+		tests = append(tests,
+			struct{ name, input, expected string }{"permissionsOctal", `file(@` + page + `).permissionsOctal`, "0640"},
+			struct{ name, input, expected string }{"permissionsOctal executable", `file(@` + image + `).permissionsOctal`, "0755"},
+		)
+		if u, err := user.Current(); err == nil {
+			tests = append(tests, struct{ name, input, expected string }{"owner", `file(@` + page + `).owner`, u.Username})
+		}
+	}
+	if hasSymlinks {
+		tests = append(tests,
+			struct{ name, input, expected string }{"isSymlink true", `file(@` + link + `).isSymlink`, "true"},
+			struct{ name, input, expected string }{"target", `file(@` + link + `).target.string`, "index.html"},
+			struct{ name, input, expected string }{"symlink mime", `file(@` + link + `).mime`, "text/html"},
+		)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalFileHandle(tt.input)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected '%s', got '%s'", tt.expected, result.Inspect())
+			}
+		})
+	}
+
+	// Creation times are only recorded by some systems and file systems
+	result := testEvalFileHandle(`let f = file(@` + page + `); if (f.created) { f.created <= f.modified } else { true }`)
+	if result.Inspect() != "true" {
+		t.Errorf("expected created to be null or no later than modified, got %s", result.Inspect())
+	}
+}
+
 // Test file handle path property
 func TestFilePathProperty(t *testing.T) {
 	// Test that path returns a path dictionary
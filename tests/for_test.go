@@ -30,10 +30,7 @@ func TestForSimpleSyntax(t *testing.T) {
 				t.Fatalf("Parser errors: %v", p.Errors())
 			}
 
-			var result evaluator.Object
-			for _, stmt := range program.Statements {
-				result = evaluator.Eval(stmt, env)
-			}
+			result := evaluator.Eval(program, env)
 
 			if result == nil {
 				t.Fatalf("Eval returned nil")
@@ -150,10 +147,7 @@ func TestForEquivalenceWithMap(t *testing.T) {
 				t.Fatalf("Parser errors (for): %v", p1.Errors())
 			}
 
-			var result1 evaluator.Object
-			for _, stmt := range program1.Statements {
-				result1 = evaluator.Eval(stmt, env1)
-			}
+			result1 := evaluator.Eval(program1, env1)
 
 			// Test map syntax
 			l2 := lexer.New(tt.mapSyntax)
@@ -165,10 +159,7 @@ func TestForEquivalenceWithMap(t *testing.T) {
 				t.Fatalf("Parser errors (map): %v", p2.Errors())
 			}
 
-			var result2 evaluator.Object
-			for _, stmt := range program2.Statements {
-				result2 = evaluator.Eval(stmt, env2)
-			}
+			result2 := evaluator.Eval(program2, env2)
 
 			if result1.Inspect() != tt.expected {
 				t.Errorf("For syntax: expected %q, got %q", tt.expected, result1.Inspect())
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+// TestFragmentErrorPositions tests that errors in {...} expressions inside
+// templates and tags point at the expression's place in the file
+func TestFragmentErrorPositions(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		line    int
+		column  int
+		message string
+	}{
+		{"template", "let x = 1\nlet s = `Hello, {nmae}!`", 2, 18, "identifier not found: nmae"},
+		{"template over lines", "let s = `a\n  b {oops}`", 2, 6, "identifier not found: oops"},
+		{"path template", "let p = @(./{folder}/x)", 1, 14, "identifier not found: folder"},
+		{"tag", "let x = 1\n<div class={klass}/>", 2, 13, "identifier not found: klass"},
+		{"tag pair", "<p title={ttl}>hi</p>", 1, 11, "identifier not found: ttl"},
+		{"syntax error", "let x = 1\n`{1 +}`", 2, 0, "error parsing template expression:"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errObj, ok := testEvalHelper(tt.input).(*evaluator.Error)
+			if !ok {
+				t.Fatalf("expected an error")
+			}
+			if !strings.HasPrefix(errObj.Message, tt.message) {
+				t.Errorf("expected message %q, got %q", tt.message, errObj.Message)
+			}
+			if errObj.Line != tt.line {
+				t.Errorf("expected line %d, got %d", tt.line, errObj.Line)
+			}
+			if tt.column > 0 && errObj.Column != tt.column {
+				t.Errorf("expected column %d, got %d", tt.column, errObj.Column)
+			}
+		})
+	}
+}
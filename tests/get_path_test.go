@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+const getPathData = `let data = {
+    user: {name: "Ann", address: {city: "Paris"}, tags: ["a", "b"]},
+    items: [{name: "first"}, {name: "second"}],
+    empty: null
+};
+`
+
+func TestGetPath(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`get(data, "user.address.city", "Unknown")`, "Paris"},
+		{`get(data, "user.address.zip", "Unknown")`, "Unknown"},
+		{`get(data, "user.address.zip")`, "null"},
+		{`get(data, "user.name")`, "Ann"},
+
+		// Numeric segments index arrays
+		{`get(data, "user.tags.1")`, "b"},
+		{`get(data, "items.0.name")`, "first"},
+		{`get(data, "items.-1.name")`, "second"},
+		{`get(data, "items.5.name", "none")`, "none"},
+		{`get(data, "items.x", "none")`, "none"},
+
+		// Array paths
+		{`get(data, ["user", "address", "city"])`, "Paris"},
+		{`get(data, ["items", 1, "name"])`, "second"},
+		{`let years = fromEntries([["2024", "leap"]]); get(years, [2024])`, "leap"},
+
+		// Null values and dead ends give the default
+		{`get(data, "empty", "default")`, "default"},
+		{`get(data, "empty.deeper", "default")`, "default"},
+		{`get(data, "user.name.first", "default")`, "default"},
+		{`get(null, "a.b", "default")`, "default"},
+		{`get(data, "user.tags", [])`, "[a, b]"},
+
+		// Falsy but present values are kept
+		{`get({a: false}, "a", true)`, "false"},
+		{`get({a: 0}, "a", 1)`, "0"},
+
+		// An empty path is the value itself
+		{`get(data, "", null).user.name`, "Ann"},
+		{`get(data, [], null).user.name`, "Ann"},
+
+		// Paths from config
+		{`let key = "user.address.city"; get(data, key, "?")`, "Paris"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalHelper(getPathData + tt.input)
+			if result.Type() == evaluator.ERROR_OBJ {
+				t.Fatalf("Evaluation error: %s", result.Inspect())
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestGetPathErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		errorContains string
+	}{
+		{`get({a: 1})`, "wrong number of arguments to `get`"},
+		{`get({a: 1}, 1)`, "second argument to `get` must be a string or array"},
+		{`get({a: 1}, ["a", true])`, "path elements for `get` must be strings or integers"},
+		{`get({a: 1 - "x"}, "a")`, "type mismatch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Type() != evaluator.ERROR_OBJ {
+				t.Fatalf("expected error, got %s", result.Inspect())
+			}
+			if !strings.Contains(result.Inspect(), tt.errorContains) {
+				t.Errorf("expected error containing %q, got %q", tt.errorContains, result.Inspect())
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHolidays(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		expected string
+	}{
+		{
+			name:     "US federal holidays count",
+			code:     `len(holidays("US", 2025))`,
+			expected: "11",
+		},
+		{
+			name:     "Juneteenth only from 2021",
+			code:     `len(holidays("US", 2020))`,
+			expected: "10",
+		},
+		{
+			name:     "nth weekday rule (Thanksgiving)",
+			code:     `holidays("US", 2025).filter(fn(d) { d.month == 11 && d.weekday == "Thursday" })[0].day`,
+			expected: "27",
+		},
+		{
+			name:     "last weekday rule (Memorial Day)",
+			code:     `holidays("US", 2024).filter(fn(d) { d.month == 5 })[0].day`,
+			expected: "27",
+		},
+		{
+			name:     "anchored weekday rule (Victoria Day)",
+			code:     `holidays("CA", 2025).filter(fn(d) { d.month == 5 })[0].day`,
+			expected: "19",
+		},
+		{
+			name:     "Easter-relative rule (Good Friday)",
+			code:     `toString(holidays("GB", 2024)[1])`,
+			expected: "2024-03-29",
+		},
+		{
+			name:     "results are date kind",
+			code:     `holidays("DE", 2025)[0].kind`,
+			expected: "date",
+		},
+		{
+			name:     "names option",
+			code:     `holidays("US", 2025, {names: true})[0].name`,
+			expected: "New Year's Day",
+		},
+		{
+			name:     "country code is case-insensitive",
+			code:     `len(holidays("de", 2025))`,
+			expected: "9",
+		},
+		{
+			name:     "custom calendar dictionary",
+			code:     `let cal = {name: "ACME", holidays: [{name: "Founders Day", month: 3, day: 14}, {name: "Easter Sunday", easter: 0}]}; holidays(cal, 2025).map(fn(d) { toString(d) })`,
+			expected: "[2025-03-14, 2025-04-20]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestIsHolidayAndWorkday(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{`isHoliday(@2025-07-04, "US")`, "true"},
+		{`isHoliday(@2025-07-04T15:30:00, "US")`, "true"},
+		{`isHoliday(@2025-07-05, "US")`, "false"},
+		{`isHoliday(@2025-10-03, "DE")`, "true"},
+		{`isHoliday(@2025-05-29, "FR")`, "true"},
+		{`isWorkday(@2025-07-04, "US")`, "false"},
+		{`isWorkday(@2025-07-07, "US")`, "true"},
+		{`isWorkday(@2025-07-05)`, "false"},
+		{`isWorkday(@2025-07-04)`, "true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestHolidayErrors(t *testing.T) {
+	tests := []struct {
+		code        string
+		errContains string
+	}{
+		{`holidays("XX", 2025)`, "unknown country"},
+		{`holidays("US", "2025")`, "must be an integer"},
+		{`holidays({name: "Bad", holidays: [{name: "Nope", month: 13, day: 1}]}, 2025)`, "month must be between 1 and 12"},
+		{`holidays({name: "Bad", holidays: [{name: "Nope", month: 1, weekday: "funday", nth: 1}]}, 2025)`, "unknown weekday"},
+		{`isHoliday("2025-07-04", "US")`, "must be a datetime"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if !strings.Contains(result.Inspect(), tt.errContains) {
+				t.Errorf("expected error containing %q, got %s", tt.errContains, result.Inspect())
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+	"github.com/sambeau/parsley/pkg/lexer"
+	"github.com/sambeau/parsley/pkg/parser"
+)
+
+func TestHumanize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// File sizes
+		{`humanSize(49382133)`, "47.1 MB"},
+		{`humanSize(512)`, "512 B"},
+		{`humanSize(1536)`, "1.5 KB"},
+		{`humanSize(1048575)`, "1 MB"},
+		{`humanSize(49382133, {units: "si"})`, "49.4 MB"},
+		{`humanSize(1500, {units: "si"})`, "1.5 kB"},
+		{`humanSize(49382133, {units: "iec"})`, "47.1 MiB"},
+		{`humanSize(49382133, "de-DE")`, "47,1 MB"},
+		{`humanSize(49382133, {locale: "fr-FR"})`, "47,1 Mo"},
+		{`humanSize(-2048)`, "-2 KB"},
+
+		// Counts
+		{`humanCount(12500)`, "12.5k"},
+		{`humanCount(950)`, "950"},
+		{`humanCount(1234567)`, "1.2M"},
+		{`humanCount(125000)`, "125k"},
+		{`humanCount(999960)`, "1M"},
+		{`humanCount(-12500)`, "-12.5k"},
+		{`humanCount(3000000000)`, "3B"},
+		{`humanCount(12500, "de-DE")`, "12.500"},
+		{`humanCount(1500000, "de-DE")`, "1,5 Mio."},
+		{`humanCount(12500, "ja-JP")`, "1.3万"},
+
+		// Approximations
+		{`approx(12500)`, "12.5 thousand"},
+		{`approx(2300000)`, "2.3 million"},
+		{`approx(1000000, "de-DE")`, "1 Million"},
+		{`approx(1500000, "de-DE")`, "1,5 Millionen"},
+		{`approx(2000000, "ru-RU")`, "2 миллиона"},
+		{`approx(5000000, "ru-RU")`, "5 миллионов"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			p := parser.New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			result := evaluator.Eval(program, evaluator.NewEnvironment())
+
+			str, ok := result.(*evaluator.String)
+			if !ok {
+				t.Fatalf("expected String, got %T (%+v)", result, result)
+			}
+			if str.Value != tt.expected {
+				t.Errorf("expected '%s', got '%s'", tt.expected, str.Value)
+			}
+		})
+	}
+}
+
+func TestHumanizeErrors(t *testing.T) {
+	tests := []struct {
+		input       string
+		errContains string
+	}{
+		{`humanSize("big")`, "must be an integer or float"},
+		{`humanSize(1, 2)`, "must be a string or dictionary"},
+		{`humanSize(1, {units: "metric"})`, "invalid units"},
+		{`humanCount()`, "wrong number of arguments"},
+		{`approx(1, {locale: 1})`, "`locale` option"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			p := parser.New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			result := evaluator.Eval(program, evaluator.NewEnvironment())
+
+			err, ok := result.(*evaluator.Error)
+			if !ok {
+				t.Fatalf("expected Error, got %T (%+v)", result, result)
+			}
+			if !strings.Contains(err.Message, tt.errContains) {
+				t.Errorf("expected error to contain '%s', got '%s'", tt.errContains, err.Message)
+			}
+		})
+	}
+}
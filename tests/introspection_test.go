@@ -0,0 +1,140 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTypeOf(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{`typeOf(42)`, "int"},
+		{`typeOf(3.5)`, "float"},
+		{`typeOf("hi")`, "string"},
+		{`typeOf(true)`, "bool"},
+		{`typeOf(null)`, "null"},
+		{`typeOf([1, 2])`, "array"},
+		{`typeOf({a: 1})`, "dict"},
+		{`typeOf(fn(x) { x })`, "function"},
+		{`typeOf(len)`, "function"},
+		{`typeOf(@2024-03-15)`, "datetime"},
+		{`typeOf(@1h30m)`, "duration"},
+		{`typeOf(@./src/main.pars)`, "path"},
+		{`typeOf(@https://example.com)`, "url"},
+		{`typeOf(/\d+/)`, "regex"},
+		{`typeOf(file(@./data.json))`, "file"},
+		{`typeOf(dir(@./src))`, "dir"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestIsA(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{`isA(@2024-03-15, "datetime")`, "true"},
+		{`isA(@2024-03-15, "duration")`, "false"},
+		{`isA(@2024-03-15, "dict")`, "true"},
+		{`isA({a: 1}, "dict")`, "true"},
+		{`isA({a: 1}, "datetime")`, "false"},
+		{`isA(1, "number")`, "true"},
+		{`isA(1.5, "number")`, "true"},
+		{`isA("1", "number")`, "false"},
+		{`isA(1, "int")`, "true"},
+		{`isA(1, "float")`, "false"},
+		{`isA(toUpper, "function")`, "true"},
+		{`isA(null, "null")`, "true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestMethodsAndArity(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{`methods("hi")`, "[codePointAt, contains, endsWith, indexOf, lastIndexOf, length, lines, padEnd, padStart, raw, repeat, replace, split, startsWith, toLower, toUpper, trim, trimEnd, trimStart]"},
+		{`methods(1)`, "[currency, format, percent]"},
+		{`methods(null)`, "[]"},
+		{`methods(@1h)`, "[delete, entries, filter, format, fromEntries, has, keys, mapValues, omit, pick, size, toDict, values]"},
+		{`methods(@2024-03-15).filter(fn(m) { m == "format" || m == "keys" })`, "[format, keys]"},
+		{`let counter = {n: 1, inc: fn() { this.n + 1 }}; methods(counter).filter(fn(m) { m == "inc" || m == "n" })`, "[inc]"},
+		{`arity(fn(a, b) { a + b })`, "2"},
+		{`arity(fn() { 1 })`, "0"},
+		{`arity(fn({a, b}, [c, d]) { a })`, "2"},
+		{`arity(len)`, "null"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+// TestMethodsAreCallable checks that every method methods() lists is
+// dispatched for that type (rather than reported as unknown)
+func TestMethodsAreCallable(t *testing.T) {
+	values := []string{
+		`"hi"`, `[1, 2]`, `{a: 1}`, `1`, `1.5`, `@2024-03-15`, `@1h`,
+		`@./src/main.pars`, `@https://example.com/a?b=1`, `/\d+/`,
+	}
+
+	for _, value := range values {
+		names := testEvalHelper(`methods(` + value + `).join(",")`).Inspect()
+		for _, name := range strings.Split(names, ",") {
+			t.Run(value+"."+name, func(t *testing.T) {
+				result := testEvalHelper(`let v = ` + value + `; v.` + name + `()`)
+				if strings.Contains(result.Inspect(), "unknown method") {
+					t.Errorf("methods() lists %s, but calling it failed: %s", name, result.Inspect())
+				}
+			})
+		}
+	}
+}
+
+func TestIntrospectionErrors(t *testing.T) {
+	tests := []struct {
+		code          string
+		errorContains string
+	}{
+		{`typeOf()`, "wrong number of arguments to `typeOf`"},
+		{`isA(1, 2)`, "second argument to `isA` must be a type name string"},
+		{`methods(1, 2)`, "wrong number of arguments to `methods`"},
+		{`arity(1)`, "argument to `arity` must be a function"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if result.Type() != "ERROR" {
+				t.Fatalf("expected error, got %s", result.Inspect())
+			}
+			if !strings.Contains(result.Inspect(), tt.errorContains) {
+				t.Errorf("expected error containing %q, got %q", tt.errorContains, result.Inspect())
+			}
+		})
+	}
+}
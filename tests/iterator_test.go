@@ -0,0 +1,142 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+// naturals is an endless iterator, so tests fail (by hanging) if anything
+// tries to generate it all
+const naturals = `let nat = iter(fn(yield) {
+    let loop = fn(n) { yield(n); loop(n + 1) }
+    loop(1)
+});
+`
+
+func TestIterators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let it = iter(fn(yield) { yield(1); yield(2); yield(3) }); it.toArray()`, "[1, 2, 3]"},
+		{`iter(fn(yield) { null }).toArray()`, "[]"},
+		{`let it = iter(fn(yield) { for (x in ["a", "b"]) { yield(x) } }); for (x in it) { x + "!" }`, "[a!, b!]"},
+		{`let it = iter(fn(yield) { yield("a"); yield("b") }); for (i, x in it) { i + x }`, "[0a, 1b]"},
+		{`typeOf(iter(fn(yield) { null }))`, "iterator"},
+		{`methods(iter(fn(yield) { null }))`, "[filter, map, take, toArray]"},
+
+		// Iterators can be consumed more than once
+		{`let it = iter(fn(yield) { yield(1); yield(2) }); it.toArray() ++ it.toArray()`, "[1, 2, 1, 2]"},
+
+		// Lazy methods
+		{naturals + `nat.take(3).toArray()`, "[1, 2, 3]"},
+		{naturals + `nat.map(fn(x) { x * x }).take(4).toArray()`, "[1, 4, 9, 16]"},
+		{naturals + `nat.filter(fn(x) { x % 5 == 0 }).take(2).toArray()`, "[5, 10]"},
+		{naturals + `nat.map(fn(x) { if (x % 2 == 0) { x } }).take(2).toArray()`, "[2, 4]"},
+		{naturals + `nat.take(2).take(5).toArray()`, "[1, 2]"},
+		{naturals + `nat.take(0).toArray()`, "[]"},
+		{naturals + `for (x in nat.take(3)) { x * 10 }`, "[10, 20, 30]"},
+
+		// Paginated fetching: the generator stops as soon as enough is taken
+		{`let fetched = 0;
+let pages = [[1, 2], [3, 4], [5, 6]];
+let items = iter(fn(yield) {
+    for (page in pages) {
+        fetched = fetched + 1
+        for (item in page) { yield(item) }
+    }
+});
+let first = items.take(3).toArray();
+[first, fetched]`, "[[1, 2, 3], 2]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Type() == evaluator.ERROR_OBJ {
+				t.Fatalf("Evaluation error: %s", result.Inspect())
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestIteratorErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		errorContains string
+	}{
+		{`iter(1)`, "argument to `iter` must be a function"},
+		{`iter(fn(a, b) { a })`, "must take 1 parameter (yield)"},
+		{`iter(fn(yield) { yield(1); yield(1 - "a") }).toArray()`, "type mismatch"},
+		{`let it = iter(fn(yield) { yield(1); yield(2) }); for (x in it) { x - "a" }`, "type mismatch"},
+		{`iter(fn(yield) { yield(1, 2) }).toArray()`, "wrong number of arguments to `yield`"},
+		{`let saved = null; let it = iter(fn(yield) { saved = yield }); it.toArray(); saved(1)`, "yield called after its iterator finished"},
+		{`iter(fn(yield) { null }).take(-1)`, "non-negative integer"},
+		{`iter(fn(yield) { null }).map(1)`, "must be a function"},
+		{`iter(fn(yield) { null }).length()`, "unknown method 'length' for iterator"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Type() != evaluator.ERROR_OBJ {
+				t.Fatalf("expected error, got %s", result.Inspect())
+			}
+			if !strings.Contains(result.Inspect(), tt.errorContains) {
+				t.Errorf("expected error containing %q, got %q", tt.errorContains, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestIteratorWrites(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "parsley_iterator_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := func(name string) string { return filepath.Join(tmpDir, name) }
+	gen := `let rows = iter(fn(yield) { for (i in 1..3) { yield("row " + i) } }); `
+
+	tests := []struct {
+		name     string
+		code     string
+		file     string
+		expected string
+	}{
+		{"lines", gen + `rows ==> lines("` + path("a.txt") + `")`, "a.txt", "row 1\nrow 2\nrow 3"},
+		{"lines with options", gen + `rows ==> lines("` + path("b.txt") + `", {newline: "crlf", atomic: true})`, "b.txt", "row 1\r\nrow 2\r\nrow 3"},
+		{"append terminates lines", gen + `rows.take(2) ==>> lines("` + path("c.txt") + `"); rows.take(1) ==>> lines("` + path("c.txt") + `")`, "c.txt", "row 1\nrow 2\nrow 1\n"},
+		{"other formats collect", gen + `rows.take(2) ==> JSON("` + path("d.json") + `")`, "d.json", "[\n  \"row 1\",\n  \"row 2\"\n]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalWriteOp(tt.code)
+			if result != nil && result.Type() == evaluator.ERROR_OBJ {
+				t.Fatalf("Evaluation error: %s", result.Inspect())
+			}
+			content, err := os.ReadFile(path(tt.file))
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+			if string(content) != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, string(content))
+			}
+		})
+	}
+
+	// A generator error stops the write
+	result := testEvalWriteOp(`iter(fn(yield) { yield("ok"); yield(1 - "a") }) ==> lines("` + path("e.txt") + `")`)
+	if result.Type() != evaluator.ERROR_OBJ || !strings.Contains(result.Inspect(), "type mismatch") {
+		t.Errorf("expected type mismatch error, got %s", result.Inspect())
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStringifyJSONOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		expected string
+	}{
+		{
+			name:     "compact with sorted keys",
+			code:     `stringifyJSON({b: 2, a: 1, c: [1, 2]})`,
+			expected: `{"a":1,"b":2,"c":[1,2]}`,
+		},
+		{
+			name:     "pretty defaults to two spaces",
+			code:     `stringifyJSON({b: 2, a: 1}, {pretty: true})`,
+			expected: "{\n  \"a\": 1,\n  \"b\": 2\n}",
+		},
+		{
+			name:     "indent implies pretty",
+			code:     `stringifyJSON({a: [1]}, {indent: 4})`,
+			expected: "{\n    \"a\": [\n        1\n    ]\n}",
+		},
+		{
+			name:     "string indent",
+			code:     `stringifyJSON({a: 1}, {indent: "\t"})`,
+			expected: "{\n\t\"a\": 1\n}",
+		},
+		{
+			name:     "pretty false overrides indent",
+			code:     `stringifyJSON({a: 1}, {pretty: false, indent: 4})`,
+			expected: `{"a":1}`,
+		},
+		{
+			name:     "sortKeys accepted",
+			code:     `stringifyJSON({z: 1, y: 2}, {sortKeys: true})`,
+			expected: `{"y":2,"z":1}`,
+		},
+		{
+			name:     "date",
+			code:     `stringifyJSON({when: @2024-03-15})`,
+			expected: `{"when":"2024-03-15"}`,
+		},
+		{
+			name:     "datetime",
+			code:     `stringifyJSON([@2024-03-15T10:30:00])`,
+			expected: `["2024-03-15T10:30:00Z"]`,
+		},
+		{
+			name:     "datetime keeps its offset",
+			code:     `stringifyJSON([@2024-03-15T10:30:00-05:00])`,
+			expected: `["2024-03-15T10:30:00-05:00"]`,
+		},
+		{
+			name:     "duration as ISO 8601",
+			code:     `stringifyJSON({d: @1d2h30m, m: @1y2mo, z: @0s})`,
+			expected: `{"d":"P1DT2H30M","m":"P1Y2M","z":"PT0S"}`,
+		},
+		{
+			name:     "path",
+			code:     `stringifyJSON({p: @./data/config.json})`,
+			expected: `{"p":"./data/config.json"}`,
+		},
+		{
+			name:     "url",
+			code:     `stringifyJSON({u: @https://example.com/api?x=1})`,
+			expected: `{"u":"https://example.com/api?x=1"}`,
+		},
+		{
+			name:     "regex",
+			code:     `stringifyJSON(/\d+/i)`,
+			expected: `"/\\d+/i"`,
+		},
+		{
+			name:     "computed values use this",
+			code:     `stringifyJSON({w: 2, h: 3, area: this.w * this.h})`,
+			expected: `{"area":6,"h":3,"w":2}`,
+		},
+		{
+			name:     "duration round trips through parseDuration",
+			code:     `let s = stringifyJSON({d: @3d4h}); parseDuration(parseJSON(s).d).seconds`,
+			expected: "273600",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestStringifyJSONOptionErrors(t *testing.T) {
+	tests := []struct {
+		code        string
+		errContains string
+	}{
+		{`stringifyJSON({}, true)`, "options must be a dictionary"},
+		{`stringifyJSON({}, {pretty: "yes"})`, "`pretty` option"},
+		{`stringifyJSON({}, {indent: 11})`, "between 0 and 10"},
+		{`stringifyJSON({}, {indent: [1]})`, "integer or string"},
+		{`stringifyJSON({}, {sortKeys: 1})`, "`sortKeys` option"},
+		{`stringifyJSON()`, "expects 1-2 arguments"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if !strings.Contains(result.Inspect(), tt.errContains) {
+				t.Errorf("expected error containing %q, got %s", tt.errContains, result.Inspect())
+			}
+		})
+	}
+}
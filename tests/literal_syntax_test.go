@@ -204,3 +204,36 @@ func TestAtPrefixDisambiguation(t *testing.T) {
 		}
 	}
 }
+
+// Test raw string (r"...") and block string ("""...""") syntax
+func TestRawStrings(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"no escapes", `r"\d+\.\d+\n"`, `\d+\.\d+\n`},
+		{"windows path", `r"C:\temp\new"`, `C:\temp\new`},
+		{"braces", `r"{name}"`, `{name}`},
+		{"r is still a name", `let r = "x"; r + r"y"`, "xy"},
+		{"regex from raw string", `if (regex(r"^\w+$").test("abc")) "match" else "no match"`, "match"},
+		{"block string", `"""{"a": "b"}"""`, `{"a": "b"}`},
+		{"block string keeps quotes and backslashes", `"""say "hi" \n"""`, `say "hi" \n`},
+		{"indented block string", "let js = \"\"\"\n    if (a) {\n      f({x: 1});\n    }\n    \"\"\"\njs", "if (a) {\n  f({x: 1});\n}"},
+		{"block string without closing line", "\"\"\"\n  one\n  two\"\"\"", "  one\n  two"},
+		{"empty string still works", `"" + "x"`, "x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalLiteral(tt.input)
+			str, ok := result.(*evaluator.String)
+			if !ok {
+				t.Fatalf("expected String, got %T (%s)", result, result.Inspect())
+			}
+			if str.Value != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, str.Value)
+			}
+		})
+	}
+}
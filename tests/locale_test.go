@@ -297,34 +297,12 @@ func TestNegativeDurationLiterals(t *testing.T) {
 			env := evaluator.NewEnvironment()
 			result := evaluator.Eval(program, env)
 
-			dict, ok := result.(*evaluator.Dictionary)
+			dur, ok := result.(*evaluator.Duration)
 			if !ok {
-				t.Fatalf("expected Dictionary, got %T (%+v)", result, result)
+				t.Fatalf("expected Duration, got %T (%+v)", result, result)
 			}
-
-			// Check __type
-			typeExpr, ok := dict.Pairs["__type"]
-			if !ok {
-				t.Fatal("expected __type field")
-			}
-			typeObj := evaluator.Eval(typeExpr, env)
-			typeStr, ok := typeObj.(*evaluator.String)
-			if !ok || typeStr.Value != "duration" {
-				t.Fatalf("expected __type='duration', got %v", typeObj)
-			}
-
-			// Check seconds
-			secondsExpr, ok := dict.Pairs["seconds"]
-			if !ok {
-				t.Fatal("expected seconds field")
-			}
-			secondsObj := evaluator.Eval(secondsExpr, env)
-			secondsInt, ok := secondsObj.(*evaluator.Integer)
-			if !ok {
-				t.Fatalf("expected Integer for seconds, got %T", secondsObj)
-			}
-			if secondsInt.Value != tt.expectedSeconds {
-				t.Errorf("expected seconds=%d, got %d", tt.expectedSeconds, secondsInt.Value)
+			if dur.Seconds() != tt.expectedSeconds {
+				t.Errorf("expected seconds=%d, got %d", tt.expectedSeconds, dur.Seconds())
 			}
 		})
 	}
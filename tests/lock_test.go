@@ -0,0 +1,152 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+	"github.com/sambeau/parsley/pkg/filelock"
+	"github.com/sambeau/parsley/pkg/lexer"
+	"github.com/sambeau/parsley/pkg/parser"
+)
+
+func TestLock(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "parsley_lock_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	lockPath := filepath.Join(tmpDir, "build.lock")
+	counter := filepath.Join(tmpDir, "counter.txt")
+
+	tests := []struct {
+		name     string
+		code     string
+		expected string
+	}{
+		{
+			name:     "lock block returns its value",
+			code:     `lock("` + lockPath + `") { 1 + 2 }`,
+			expected: "3",
+		},
+		{
+			name:     "lock block sees enclosing scope",
+			code:     `let x = 10; lock("` + lockPath + `") { x * 2 }`,
+			expected: "20",
+		},
+		{
+			name:     "withLock with function",
+			code:     `withLock("` + lockPath + `", fn() { "done" })`,
+			expected: "done",
+		},
+		{
+			name:     "lock is released after block",
+			code:     `lock("` + lockPath + `") { 1 }; lock("` + lockPath + `", {timeout: @0s}) { "again" }`,
+			expected: "again",
+		},
+		{
+			name:     "critical section writes file",
+			code:     `lock("` + lockPath + `") { "1" ==> text("` + counter + `") }; let n <== text("` + counter + `"); n`,
+			expected: "1",
+		},
+		{
+			name:     "path literal",
+			code:     `let p = @(` + lockPath + `); withLock(p, fn() { "ok" }, {timeout: @1s})`,
+			expected: "ok",
+		},
+		{
+			name:     "user-defined lock is not overridden",
+			code:     `let lock = fn(x) { "mine: " + x }; lock("a")`,
+			expected: "mine: a",
+		},
+		{
+			name:     "errors propagate",
+			code:     `lock("` + lockPath + `") { undefinedThing }`,
+			expected: "identifier not found: undefinedThing",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalWriteOp(tt.code)
+			if !strings.Contains(result.Inspect(), tt.expected) {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+
+	if _, err := os.Stat(lockPath); err != nil {
+		t.Errorf("expected lock file to be created: %v", err)
+	}
+}
+
+func TestLockTimeout(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "parsley_lock_timeout_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	lockPath := filepath.Join(tmpDir, "state.lock")
+
+	// Hold the lock as another script would
+	held, err := filelock.Acquire(lockPath, 0)
+	if err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+
+	start := time.Now()
+	result := testEvalWriteOp(`lock("` + lockPath + `", {timeout: @1s}) { "ran" }`)
+	if !strings.Contains(result.Inspect(), "timed out waiting for lock") {
+		t.Errorf("expected timeout error, got %q", result.Inspect())
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("expected to wait for the timeout, waited %v", elapsed)
+	}
+
+	// Waiting callers proceed once the holder releases the lock
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		held.Unlock()
+	}()
+	result = testEvalWriteOp(`lock("` + lockPath + `") { "ran" }`)
+	if result.Inspect() != "ran" {
+		t.Errorf("expected block to run after release, got %q", result.Inspect())
+	}
+}
+
+func TestLockErrors(t *testing.T) {
+	tests := []struct {
+		code          string
+		errorContains string
+	}{
+		{`withLock("/tmp/x.lock")`, "wrong number of arguments"},
+		{`withLock(1, fn() { 1 })`, "must be a path or string"},
+		{`withLock("/tmp/x.lock", 1)`, "must be a function"},
+		{`withLock("/tmp/x.lock", fn() { 1 }, {timeout: 5})`, "must be a duration"},
+		{`withLock("/tmp/x.lock", fn() { 1 }, {timeout: @1mo})`, "without months"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			result := testEvalWriteOp(tt.code)
+			if !strings.Contains(result.Inspect(), tt.errorContains) {
+				t.Errorf("expected error containing %q, got %q", tt.errorContains, result.Inspect())
+			}
+		})
+	}
+
+	// Lock files are subject to the write policy
+	l := lexer.New(`lock("/tmp/parsley-denied.lock") { 1 }`)
+	p := parser.New(l)
+	env := evaluator.NewEnvironment()
+	env.Security = &evaluator.SecurityPolicy{}
+	result := evaluator.Eval(p.ParseProgram(), env)
+	if !strings.Contains(result.Inspect(), "security") {
+		t.Errorf("expected security error, got %q", result.Inspect())
+	}
+}
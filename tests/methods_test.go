@@ -46,6 +46,49 @@ func TestStringMethods(t *testing.T) {
 		{`"hello".length()`, int64(5)},
 		{`"".length()`, int64(0)},
 		{`"日本語".length()`, int64(3)}, // Unicode rune count
+
+		// trimStart(), trimEnd()
+		{`"  hello  ".trimStart()`, "hello  "},
+		{`"  hello  ".trimEnd()`, "  hello"},
+		{"\"\u00a0\thi\n\".trimStart()", "hi\n"},
+
+		// startsWith(), endsWith(), contains()
+		{`"héllo".startsWith("hé")`, true},
+		{`"héllo".startsWith("llo")`, false},
+		{`"héllo".endsWith("llo")`, true},
+		{`"héllo".contains("él")`, true},
+		{`"héllo".contains("")`, true},
+		{`"héllo".contains("x")`, false},
+
+		// indexOf(), lastIndexOf() count characters, not bytes
+		{`"héllo".indexOf("l")`, int64(2)},
+		{`"héllo".lastIndexOf("l")`, int64(3)},
+		{`"日本語".indexOf("語")`, int64(2)},
+		{`"héllo".indexOf("x")`, int64(-1)},
+		{`"héllo".lastIndexOf("x")`, int64(-1)},
+
+		// padStart(), padEnd()
+		{`"7".padStart(3, "0")`, "007"},
+		{`"7".padStart(3)`, "  7"},
+		{`"ab".padEnd(5, "xy")`, "abxyx"},
+		{`"日本".padStart(4, "・")`, "・・日本"},
+		{`"long".padStart(2)`, "long"},
+		{`"ab".padEnd(4, "")`, "ab"},
+
+		// repeat()
+		{`"ab".repeat(3)`, "ababab"},
+		{`"ab".repeat(0)`, ""},
+
+		// lines()
+		{`"a\nb\nc".lines()`, []string{"a", "b", "c"}},
+		{"\"a\r\nb\r\n\".lines()", []string{"a", "b"}},
+		{`"a\n\nb\n".lines()`, []string{"a", "", "b"}},
+		{`"".lines()`, []string{}},
+
+		// codePointAt()
+		{`"abc".codePointAt(0)`, int64(97)},
+		{`"é😀".codePointAt(1)`, int64(0x1F600)},
+		{`"abc".codePointAt(-1)`, int64(99)},
 	}
 
 	for _, tt := range tests {
@@ -65,6 +108,14 @@ func TestStringMethods(t *testing.T) {
 				if str.Value != expected {
 					t.Errorf("expected %q, got %q", expected, str.Value)
 				}
+			case bool:
+				b, ok := result.(*evaluator.Boolean)
+				if !ok {
+					t.Fatalf("expected Boolean, got %T (%+v)", result, result)
+				}
+				if b.Value != expected {
+					t.Errorf("expected %t, got %t", expected, b.Value)
+				}
 			case int64:
 				num, ok := result.(*evaluator.Integer)
 				if !ok {
@@ -95,6 +146,33 @@ func TestStringMethods(t *testing.T) {
 	}
 }
 
+func TestStringMethodErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		errorContains string
+	}{
+		{`"abc".startsWith(1)`, "argument to `startsWith` must be a string"},
+		{`"abc".indexOf()`, "wrong number of arguments to `indexOf`"},
+		{`"abc".padStart("3")`, "first argument to `padStart` must be an integer"},
+		{`"abc".padEnd(5, 0)`, "second argument to `padEnd` must be a string"},
+		{`"abc".repeat(-1)`, "non-negative integer"},
+		{`"abc".codePointAt(3)`, "index out of range: 3"},
+		{`"abc".codePointAt(-4)`, "index out of range: -4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Type() != evaluator.ERROR_OBJ {
+				t.Fatalf("expected error, got %s", result.Inspect())
+			}
+			if !strings.Contains(result.Inspect(), tt.errorContains) {
+				t.Errorf("expected error containing %q, got %q", tt.errorContains, result.Inspect())
+			}
+		})
+	}
+}
+
 // ============================================================================
 // Array Method Tests
 // ============================================================================
@@ -127,6 +205,39 @@ func TestArrayMethods(t *testing.T) {
 		// format()
 		{`["apple", "banana", "cherry"].format()`, "apple, banana, and cherry"},
 		{`["a", "b"].format("or")`, "a or b"},
+
+		// slice()
+		{`[1, 2, 3, 4, 5].slice(-2)`, []int64{4, 5}},
+		{`[1, 2, 3, 4, 5].slice(1, -1)`, []int64{2, 3, 4}},
+		{`[1, 2, 3].slice(0, 10)`, []int64{1, 2, 3}},
+
+		// first(), last(), take(), drop()
+		{`[1, 2, 3].first()`, int64(1)},
+		{`[1, 2, 3].last()`, int64(3)},
+		{`[1, 2, 3].take(2)`, []int64{1, 2}},
+		{`[1, 2, 3].take(5)`, []int64{1, 2, 3}},
+		{`[1, 2, 3].drop(1)`, []int64{2, 3}},
+		{`[1, 2, 3].drop(5)`, []int64{}},
+
+		// insert(), removeAt() return copies
+		{`[1, 2, 3].insert(0, 0)`, []int64{0, 1, 2, 3}},
+		{`[1, 2, 3].insert(3, 4)`, []int64{1, 2, 3, 4}},
+		{`[1, 2, 3].insert(-1, 9)`, []int64{1, 2, 9, 3}},
+		{`[1, 2, 3].removeAt(1)`, []int64{1, 3}},
+		{`[1, 2, 3].removeAt(-1)`, []int64{1, 2}},
+		{`let a = [1, 2, 3]; a.insert(0, 0); a.removeAt(0); a`, []int64{1, 2, 3}},
+
+		// indexOf()
+		{`["a", "b", "a"].indexOf("a")`, int64(0)},
+		{`[1, 2, 3].indexOf(3)`, int64(2)},
+		{`[1, 2, 3].indexOf(4)`, int64(-1)},
+
+		// join() with a final separator
+		{`["a", "b", "c"].join(", ", {last: " and "})`, "a, b and c"},
+		{`["a", "b"].join(", ", {last: " or "})`, "a or b"},
+		{`["a"].join(", ", {last: " and "})`, "a"},
+		{`[].join(", ", {last: " and "})`, ""},
+		{`[1, 2, 3].join("-")`, "1-2-3"},
 	}
 
 	for _, tt := range tests {
@@ -193,6 +304,57 @@ func TestArrayMethods(t *testing.T) {
 	}
 }
 
+func TestArrayMethodsNullAndBool(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`[].first()`, "null"},
+		{`[].last()`, "null"},
+		{`[1, 2, 3].includes(2)`, "true"},
+		{`[1, 2, 3].includes("2")`, "false"},
+		{`[[1], {a: 1}].includes("x")`, "false"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestArrayMethodErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		errorContains string
+	}{
+		{`[1, 2].insert(3, 0)`, "index out of range: 3"},
+		{`[1, 2].insert(-3, 0)`, "index out of range: -3"},
+		{`[1, 2].removeAt(2)`, "index out of range: 2"},
+		{`[].removeAt(0)`, "index out of range: 0"},
+		{`[1, 2].insert("0", 0)`, "first argument to `insert` must be an integer"},
+		{`[1, 2].take(-1)`, "non-negative integer"},
+		{`[1, 2].slice(-5)`, "slice start index out of range: -5"},
+		{`[1, 2].join(", ", {first: "x"})`, "unknown option \"first\" for `join`"},
+		{`[1, 2].join(", ", {last: 1})`, "option `last` for `join` must be a string"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Type() != evaluator.ERROR_OBJ {
+				t.Fatalf("expected error, got %s", result.Inspect())
+			}
+			if !strings.Contains(result.Inspect(), tt.errorContains) {
+				t.Errorf("expected error containing %q, got %q", tt.errorContains, result.Inspect())
+			}
+		})
+	}
+}
+
 // ============================================================================
 // Dictionary Method Tests
 // ============================================================================
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+	"github.com/sambeau/parsley/pkg/lexer"
+	"github.com/sambeau/parsley/pkg/parser"
+)
+
+func evalMockTest(t *testing.T, input string) evaluator.Object {
+	t.Helper()
+	evaluator.ResetMocks()
+	t.Cleanup(evaluator.ResetMocks)
+
+	program := parser.New(lexer.New(input)).ParseProgram()
+	env := evaluator.NewEnvironment()
+	env.Filename = filepath.Join(t.TempDir(), "main.pars")
+	return evaluator.Eval(program, env)
+}
+
+func TestMock(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name: "URL",
+			input: `mock(@https://api.example.com/users, {status: 200, body: [{name: "Ada"}]})
+let {data, status} <=/= JSON(@https://api.example.com/users);
+[status, data[0].name]`,
+			expected: "[200, Ada]",
+		},
+		{
+			name: "URL error status",
+			input: `mock("https://api.example.com/missing", {status: 404, body: "not found"})
+let {data, status, error} <=/= text(@https://api.example.com/missing);
+[status, data]`,
+			expected: "[404, not found]",
+		},
+		{
+			name: "file",
+			input: `mock(@./config.json, {debug: true})
+let config <== JSON(@./config.json)
+config.debug`,
+			expected: "true",
+		},
+		{
+			name: "file text",
+			input: `mock(text(@./notes.txt), "hello")
+let notes <== text(@./notes.txt)
+notes`,
+			expected: "hello",
+		},
+		{
+			name: "command",
+			input: `mock(COMMAND("git", ["rev-parse", "HEAD"]), {stdout: "4f2a9c1\n"})
+let result = COMMAND("git", ["rev-parse", "HEAD"]) <=#=> null;
+[result.stdout.trim(), result.exitCode]`,
+			expected: "[4f2a9c1, 0]",
+		},
+		{
+			name: "command with any arguments",
+			input: `mock(COMMAND("deploy-tool"), {stderr: "denied", exitCode: 3})
+let result = COMMAND("deploy-tool", ["--prod"]) <=#=> null;
+[result.stderr, result.exitCode]`,
+			expected: "[denied, 3]",
+		},
+		{
+			name: "SQL query",
+			input: `let db = SQLITE(":memory:")
+mock(db, "SELECT * FROM users", [{id: 1, name: "Ada"}, {id: 2, name: "Grace"}])
+let users = db <=??=> "SELECT *  FROM users"
+let first = db <=?=> "SELECT * FROM users";
+[users.length(), first.name]`,
+			expected: "[2, Ada]",
+		},
+		{
+			name: "SQL statement",
+			input: `let db = SQLITE(":memory:")
+mock(db, "DELETE FROM users", {affected: 4})
+let result = db <=!=> "DELETE FROM users"
+result.affected`,
+			expected: "4",
+		},
+		{
+			name: "prepared statement",
+			input: `let db = SQLITE(":memory:")
+mock(db, "SELECT name FROM users WHERE id = ?", {name: "Ada"})
+let stmt = db.prepare("SELECT 1 AS name")
+let other = stmt.queryOne()
+let user = db.prepare("SELECT name FROM users WHERE id = ?")
+user.queryOne(1).name + " " + other.name`,
+			expected: "Ada 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := evalMockTest(t, tt.input)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestMockErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`mock(42, {})`, "must be a URL, path, file handle or COMMAND"},
+		{`mock(@https://example.com, "hi")`, "must be a dictionary"},
+		{`mock(@https://example.com, {code: 200})`, `unknown option "code" for mock()`},
+		{`mock("x", "SELECT 1", [])`, "must be a database connection"},
+	}
+
+	for _, tt := range tests {
+		result := evalMockTest(t, tt.input)
+		if result.Type() != evaluator.ERROR_OBJ || !strings.Contains(result.Inspect(), tt.expected) {
+			t.Errorf("%s: expected error containing %q, got %s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
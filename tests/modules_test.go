@@ -1,6 +1,8 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -194,3 +196,229 @@ func TestModuleClosures(t *testing.T) {
 		t.Errorf("expected 42, got %d", integer.Value)
 	}
 }
+
+func TestDataModuleImport(t *testing.T) {
+	dir, err := os.MkdirTemp("", "parsley_data_import_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"site.yaml":   "title: My Site\nnav:\n  - Home\n  - About\n",
+		"config.yml":  "debug: true\n",
+		"data.json":   `{"items": [1, 2, 3], "owner": {"name": "Ann"}}`,
+		"people.csv":  "name,age\nAnn,30\nBob,25\n",
+		"broken.json": `{"items": [1, 2`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	filename := filepath.Join(dir, "main.pars")
+
+	tests := []struct {
+		name     string
+		code     string
+		expected string
+	}{
+		{"yaml", `let site = import(@./site.yaml); site.title + ": " + site.nav[1]`, "My Site: About"},
+		{"yml extension", `import(@./config.yml).debug`, "true"},
+		{"json with destructuring", `let {items, owner} = import("./data.json"); [items.length(), owner.name]`, "[3, Ann]"},
+		{"csv rows with header", `let people = import(@./people.csv); people[1].name + " " + people[1].age`, "Bob 25"},
+		{"cached like code modules", `import(@./data.json) == import(@./data.json)`, "true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := evalModule(tt.code, filename)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+
+	t.Run("parse errors name the file", func(t *testing.T) {
+		result := evalModule(`import(@./broken.json)`, filename)
+		if result.Type() != evaluator.ERROR_OBJ {
+			t.Fatalf("expected error, got %s", result.Inspect())
+		}
+		if !strings.Contains(result.Inspect(), "broken.json") || !strings.Contains(result.Inspect(), "failed to parse JSON") {
+			t.Errorf("unexpected error: %s", result.Inspect())
+		}
+	})
+
+	t.Run("data imports need read access, not execute", func(t *testing.T) {
+		l := lexer.New(`import(@./site.yaml).title`)
+		program := parser.New(l).ParseProgram()
+		env := evaluator.NewEnvironment()
+		env.Filename = filename
+		env.Security = &evaluator.SecurityPolicy{RestrictRead: []string{dir}}
+		result := evaluator.Eval(program, env)
+		if result.Type() != evaluator.ERROR_OBJ || !strings.Contains(result.Inspect(), "read restricted") {
+			t.Errorf("expected read restriction error, got %s", result.Inspect())
+		}
+
+		env = evaluator.NewEnvironment()
+		env.Filename = filename
+		env.Security = &evaluator.SecurityPolicy{}
+		if result := evaluator.Eval(program, env); result.Inspect() != "My Site" {
+			t.Errorf("expected data import without execute permission, got %s", result.Inspect())
+		}
+	})
+}
+
+func TestCircularModuleImport(t *testing.T) {
+	dir, err := os.MkdirTemp("", "parsley_circular_import_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		// Mutually recursive modules that only use each other inside functions
+		"even.pars": `let odd = import(@./odd.pars)
+export isEven = fn(n) { if (n == 0) { true } else { odd.isOdd(n - 1) } }`,
+		"odd.pars": `let even = import(@./even.pars)
+export isOdd = fn(n) { if (n == 0) { false } else { even.isEven(n - 1) } }`,
+		// A value defined before the cycle is usable straight away
+		"header.pars": `export title = "Home"
+let {Nav} = import(@./nav.pars)
+export Header = fn() { "<h1>" + title + "</h1>" + Nav() }`,
+		"nav.pars": `let {title} = import(@./header.pars)
+export Nav = fn() { "<nav>" + title + "</nav>" }`,
+		// Using a name before it is defined reports the cycle
+		"a.pars": `let {b} = import(@./b.pars)
+export a = 1`,
+		"b.pars": `let {a} = import(@./c.pars)
+export b = a + 1`,
+		"c.pars": `let {a} = import(@./a.pars)
+export a2 = a`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	filename := filepath.Join(dir, "main.pars")
+
+	t.Run("mutual references in functions", func(t *testing.T) {
+		result := evalModule(`let even = import(@./even.pars); [even.isEven(10), even.isEven(7)]`, filename)
+		if result.Inspect() != "[true, false]" {
+			t.Errorf("expected [true, false], got %s", result.Inspect())
+		}
+	})
+
+	t.Run("circular import sees the completed module", func(t *testing.T) {
+		result := evalModule(`let odd = import(@./odd.pars); odd.even.isEven(4) && odd.even == import(@./even.pars)`, filename)
+		if result.Inspect() != "true" {
+			t.Errorf("expected true, got %s", result.Inspect())
+		}
+	})
+
+	t.Run("names defined before the cycle", func(t *testing.T) {
+		result := evalModule(`let {Header} = import(@./header.pars); Header()`, filename)
+		if result.Inspect() != "<h1>Home</h1><nav>Home</nav>" {
+			t.Errorf("unexpected result: %s", result.Inspect())
+		}
+	})
+
+	t.Run("error shows the import cycle", func(t *testing.T) {
+		result := evalModule(`import(@./a.pars)`, filename)
+		if result.Type() != evaluator.ERROR_OBJ {
+			t.Fatalf("expected error, got %s", result.Inspect())
+		}
+		cycle := strings.Join([]string{
+			filepath.Join(dir, "a.pars"),
+			filepath.Join(dir, "b.pars"),
+			filepath.Join(dir, "c.pars"),
+			filepath.Join(dir, "a.pars"),
+		}, " -> ")
+		if !strings.Contains(result.Inspect(), "import cycle: "+cycle) {
+			t.Errorf("expected error showing cycle %q, got %s", cycle, result.Inspect())
+		}
+	})
+}
+
+func TestModuleErrorFile(t *testing.T) {
+	dir, err := os.MkdirTemp("", "parsley_module_error_file_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"util.pars":   "export a = 1\nexport title = titel",
+		"page.pars":   "let x = 1\nlet u = import(@./util.pars)",
+		"fns.pars":    "export greet = fn(name) {\n  \"Hi \" + nmae\n}",
+		"broken.pars": "let = 1\nlet y = 2",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	filename := filepath.Join(dir, "main.pars")
+
+	evalError := func(t *testing.T, code string) *evaluator.Error {
+		errObj, ok := evalModule(code, filename).(*evaluator.Error)
+		if !ok {
+			t.Fatalf("expected an error")
+		}
+		return errObj
+	}
+
+	t.Run("error in nested import", func(t *testing.T) {
+		errObj := evalError(t, "\nimport(@./page.pars)")
+		if errObj.File != filepath.Join(dir, "util.pars") || errObj.Line != 2 || errObj.Column != 16 {
+			t.Errorf("expected error at util.pars:2:16, got %s:%d:%d", errObj.File, errObj.Line, errObj.Column)
+		}
+		if len(errObj.Imports) != 2 {
+			t.Fatalf("expected 2 imports, got %+v", errObj.Imports)
+		}
+		if imp := errObj.Imports[0]; imp.File != filepath.Join(dir, "page.pars") || imp.Line != 2 {
+			t.Errorf("expected innermost import from page.pars line 2, got %+v", imp)
+		}
+		if imp := errObj.Imports[1]; imp.File != filename || imp.Line != 2 {
+			t.Errorf("expected outer import from main.pars line 2, got %+v", imp)
+		}
+	})
+
+	t.Run("error in imported function", func(t *testing.T) {
+		errObj := evalError(t, `let {greet} = import(@./fns.pars); greet("Ann")`)
+		if errObj.File != filepath.Join(dir, "fns.pars") || errObj.Line != 2 {
+			t.Errorf("expected error at fns.pars line 2, got %s:%d", errObj.File, errObj.Line)
+		}
+	})
+
+	t.Run("error in imported function called as a method", func(t *testing.T) {
+		errObj := evalError(t, `let fns = import(@./fns.pars); fns.greet("Ann")`)
+		if errObj.File != filepath.Join(dir, "fns.pars") || errObj.Line != 2 {
+			t.Errorf("expected error at fns.pars line 2, got %s:%d", errObj.File, errObj.Line)
+		}
+	})
+
+	t.Run("error in imported function called back by a builtin", func(t *testing.T) {
+		errObj := evalError(t, `let fns = import(@./fns.pars); partition(["Ann"], fns.greet)`)
+		if errObj.File != filepath.Join(dir, "fns.pars") || errObj.Line != 2 {
+			t.Errorf("expected error at fns.pars line 2, got %s:%d", errObj.File, errObj.Line)
+		}
+	})
+
+	t.Run("parse error in module", func(t *testing.T) {
+		errObj := evalError(t, `import(@./broken.pars)`)
+		if errObj.File != filepath.Join(dir, "broken.pars") || errObj.Line != 1 {
+			t.Errorf("expected error at broken.pars line 1, got %s:%d", errObj.File, errObj.Line)
+		}
+	})
+
+	t.Run("errors in the script have no file", func(t *testing.T) {
+		if errObj := evalError(t, `oops`); errObj.File != "" || len(errObj.Imports) != 0 {
+			t.Errorf("expected no module, got %q %+v", errObj.File, errObj.Imports)
+		}
+		if errObj := evalError(t, "partition([1],\n  fn(x) { oops })"); errObj.File != "" || errObj.Line != 2 {
+			t.Errorf("expected no module and line 2, got %q line %d", errObj.File, errObj.Line)
+		}
+	})
+}
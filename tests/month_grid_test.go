@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMonthGrid(t *testing.T) {
+	days := `.map(fn(w) { w.map(fn(d) { if (d.inMonth) { d.day } else { 0 } }) })`
+	tests := []struct {
+		name     string
+		code     string
+		expected string
+	}{
+		{"weeks start on sunday", `monthGrid(@2025-03-15)[0].map(fn(d) { if (d.inMonth) { d.day } else { 0 } })`, "[0, 0, 0, 0, 0, 0, 1]"},
+		{"monday start", `monthGrid(@2025-03-01, {weekStart: "monday"})` + days, "[[0, 0, 0, 0, 0, 1, 2], [3, 4, 5, 6, 7, 8, 9], [10, 11, 12, 13, 14, 15, 16], [17, 18, 19, 20, 21, 22, 23], [24, 25, 26, 27, 28, 29, 30], [31, 0, 0, 0, 0, 0, 0]]"},
+		{"four-week month", `monthGrid(@2026-02-01).length()`, "4"},
+		{"fixed weeks", `monthGrid(@2026-02-01, {fixedWeeks: true}).length()`, "6"},
+		{"padding days", `let d = monthGrid(@2025-03-01, {weekStart: "Monday"})[0][0]; [toString(d.date), d.day, d.weekday, d.inMonth]`, "[2025-02-24, 24, Monday, false]"},
+		{"weekends", `monthGrid(@2025-03-01)[1].map(fn(d) { d.isWeekend })`, "[true, false, false, false, false, false, true]"},
+		{"dates are date kind", `monthGrid(@2025-03-01T12:30:00)[1][0].date.kind`, "date"},
+		{"today", `let n = 0; for (w in monthGrid(now())) { for (d in w) { if (d.isToday) { n = n + 1 } } }; n`, "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestMonthGridErrors(t *testing.T) {
+	tests := []struct {
+		code        string
+		errContains string
+	}{
+		{`monthGrid()`, "wrong number of arguments"},
+		{`monthGrid("2025-03")`, "must be a datetime"},
+		{`monthGrid(@2025-03-01, "monday")`, "must be a dictionary"},
+		{`monthGrid(@2025-03-01, {weekStart: "funday"})`, "unknown weekday"},
+		{`monthGrid(@2025-03-01, {fixedWeeks: "yes"})`, "must be a boolean"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if !strings.Contains(result.Inspect(), tt.errContains) {
+				t.Errorf("expected error containing %q, got %s", tt.errContains, result.Inspect())
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+func TestNetworkBuiltins(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("can't listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+
+	// Find a port nothing listens on
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedPort := strconv.Itoa(closed.Addr().(*net.TCPAddr).Port)
+	closed.Close()
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"resolve localhost", `resolve("localhost").filter(fn(a) { a == "127.0.0.1" || a == "::1" }).length() > 0`, "true"},
+		{"resolve IP", `resolve("127.0.0.1")`, "[127.0.0.1]"},
+		{"resolve unknown", `resolve("no-such-host.invalid")`, "null"},
+		{"port open", `portOpen("127.0.0.1", ` + port + `)`, "true"},
+		{"port closed", `portOpen("127.0.0.1", ` + closedPort + `, {timeout: @1s})`, "false"},
+		{"port from URL", `portOpen(url("http://127.0.0.1/"), ` + port + `)`, "true"},
+		{"ping", `ping("127.0.0.1", {port: ` + port + `}) >= 0`, "true"},
+		{"ping URL", `ping(url("http://127.0.0.1:` + port + `/")) >= 0`, "true"},
+		{"ping unreachable", `ping("127.0.0.1", {port: ` + closedPort + `})`, "null"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestNetworkBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`resolve(42)`, "must be a host name or URL"},
+		{`portOpen("localhost", 70000)`, "must be a port number"},
+		{`ping("localhost", {port: 0})`, "must be a port number"},
+		{`ping("localhost", {timeout: 5})`, "must be a duration"},
+	}
+
+	for _, tt := range tests {
+		result := testEvalHelper(tt.input)
+		errObj, ok := result.(*evaluator.Error)
+		if !ok || !strings.Contains(errObj.Message, tt.expected) {
+			t.Errorf("%s: expected error containing %q, got %s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
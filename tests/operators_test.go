@@ -1,6 +1,7 @@
 package main
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/sambeau/parsley/pkg/evaluator"
@@ -164,3 +165,158 @@ func TestComparisonOperators(t *testing.T) {
 		t.Logf("✓ Input: %s, Result: %s", tt.input, result.Inspect())
 	}
 }
+
+func TestDivisionOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// Exact integer division stays an integer
+		{"6 / 2", "3"},
+		{"typeOf(6 / 2)", "int"},
+		{"-6 / 3", "-2"},
+
+		// Otherwise the result is a float
+		{"5 / 2", "2.5"},
+		{"typeOf(5 / 2)", "float"},
+		{"-7 / 2", "-3.5"},
+		{"1 / 4 * 100", "25"},
+		{"5.0 / 2", "2.5"},
+
+		// Integer division truncates toward zero
+		{"idiv(5, 2)", "2"},
+		{"idiv(-7, 2)", "-3"},
+		{"idiv(-7, 2) * 2 + -7 % 2", "-7"},
+
+		// Number conversions accept numbers
+		{"toInt(2.7)", "2"},
+		{"toInt(7)", "7"},
+		{"toInt(\"42\")", "42"},
+		{"typeOf(toFloat(3))", "float"},
+		{"toFloat(2.5)", "2.5"},
+		{"toNumber(3)", "3"},
+		{"toNumber(\"3.5\")", "3.5"},
+	}
+
+	for _, tt := range tests {
+		result := testEvalHelper(tt.input)
+		if result.Inspect() != tt.expected {
+			t.Errorf("For input %q: expected %s, got %s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
+
+func TestDivisionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 / 0", "division by zero"},
+		{"idiv(5, 0)", "division by zero"},
+		{"idiv(5.0, 2)", "first argument to `idiv` must be an integer"},
+		{"idiv(5)", "wrong number of arguments to `idiv`"},
+		{"toInt(true)", "argument to `toInt` must be a string or number"},
+		{"toFloat([1])", "argument to `toFloat` must be a string or number"},
+	}
+
+	for _, tt := range tests {
+		result := testEvalHelper(tt.input)
+		if result.Type() != evaluator.ERROR_OBJ || !strings.Contains(result.Inspect(), tt.expected) {
+			t.Errorf("For input %q: expected error containing %q, got %s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
+
+func TestInOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// Arrays compare elements with ==
+		{`2 in [1, 2, 3]`, "true"},
+		{`5 in [1, 2, 3]`, "false"},
+		{`1.0 in [1, 2]`, "true"},
+		{`"b" in ["a", "b"]`, "true"},
+		{`3 in 1..10`, "true"},
+		{`11 in 1..10`, "false"},
+
+		// Dictionaries check keys
+		{`"a" in {a: 1}`, "true"},
+		{`"b" in {a: 1}`, "false"},
+		{`"a" in {a: null}`, "true"},
+
+		// Strings check substrings
+		{`"ell" in "hello"`, "true"},
+		{`"xyz" in "hello"`, "false"},
+
+		// Nothing is in null
+		{`1 in null`, "false"},
+
+		// Precedence: ranges bind tighter, logic looser
+		{`let d = {k: [1]}; "k" in d && 1 in d.k`, "true"},
+		{`!(2 in [1, 2])`, "false"},
+		{`for (x in [1, 2, 3]) { if (x in [1, 3]) { x } }`, "[1, 3]"},
+	}
+
+	for _, tt := range tests {
+		result := testEvalHelper(tt.input)
+		if result.Inspect() != tt.expected {
+			t.Errorf("For input %q: expected %s, got %s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
+
+func TestInOperatorErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`1 in 5`, "right operand of in must be an array, dictionary or string, got INTEGER"},
+		{`1 in {a: 1}`, "left operand of in must be a string to look up a dictionary key"},
+		{`1 in "123"`, "left operand of in must be a string to search a string"},
+	}
+
+	for _, tt := range tests {
+		result := testEvalHelper(tt.input)
+		if result.Type() != evaluator.ERROR_OBJ || !strings.Contains(result.Inspect(), tt.expected) {
+			t.Errorf("For input %q: expected error containing %q, got %s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
+
+func TestChainedComparisons(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let x = 5; 0 <= x < 10`, "true"},
+		{`let x = 10; 0 <= x < 10`, "false"},
+		{`let x = -1; 0 <= x < 10`, "false"},
+		{`1 < 2 < 3 < 4`, "true"},
+		{`1 < 2 < 2`, "false"},
+		{`3 > 2 >= 2`, "true"},
+		{`1 < 3 > 2`, "true"},
+		{`1.5 < 2 < 2.5`, "true"},
+
+		// The middle operand is evaluated once
+		{`let n = 0; let f = fn() { n = n + 1; 5 }; let r = 1 < f() < 10; n`, "1"},
+		// Evaluation stops at the first false comparison
+		{`let n = 0; let f = fn() { n = n + 1; 5 }; let r = 9 < 1 < f(); n`, "0"},
+
+		// Bucketing in templates
+		{`let bucket = fn(v) { if (v < 50) { "low" } else if (50 <= v < 80) { "mid" } else { "high" } }; [bucket(10), bucket(50), bucket(90)].join(",")`, "low,mid,high"},
+	}
+
+	for _, tt := range tests {
+		result := testEvalHelper(tt.input)
+		if result.Inspect() != tt.expected {
+			t.Errorf("For input %q: expected %s, got %s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	// Parentheses group, so a boolean is compared with a number
+	result := testEvalHelper(`(1 < 2) < 3`)
+	if result.Type() != evaluator.ERROR_OBJ {
+		t.Errorf("expected (1 < 2) < 3 to be a type error, got %s", result.Inspect())
+	}
+}
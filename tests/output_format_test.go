@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+	"github.com/sambeau/parsley/pkg/lexer"
+	"github.com/sambeau/parsley/pkg/parser"
+)
+
+func TestObjectToData(t *testing.T) {
+	input := `[{name: "Ada", age: 36}, {name: "Grace", age: 85}]`
+	result := evaluator.Eval(parser.New(lexer.New(input)).ParseProgram(), evaluator.NewEnvironment())
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{"json", "[\n  {\n    \"age\": 36,\n    \"name\": \"Ada\"\n  },\n  {\n    \"age\": 85,\n    \"name\": \"Grace\"\n  }\n]\n"},
+		{"yaml", "- age: 36\n  name: Ada\n- age: 85\n  name: Grace\n"},
+		{"csv", "age,name\n36,Ada\n85,Grace\n"},
+	}
+
+	for _, tt := range tests {
+		data, err := evaluator.ObjectToData(result, tt.format)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.format, err)
+			continue
+		}
+		if string(data) != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.format, tt.expected, string(data))
+		}
+	}
+}
+
+func TestObjectToDataErrors(t *testing.T) {
+	dict := evaluator.Eval(parser.New(lexer.New(`{a: 1}`)).ParseProgram(), evaluator.NewEnvironment())
+
+	if _, err := evaluator.ObjectToData(dict, "csv"); err == nil || !strings.Contains(err.Error(), "requires an array") {
+		t.Errorf("expected a CSV array error, got %v", err)
+	}
+	if _, err := evaluator.ObjectToData(dict, "xml"); err == nil || !strings.Contains(err.Error(), "unknown output format") {
+		t.Errorf("expected an unknown format error, got %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+func TestParallel(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`parallel([1, 2, 3, 4, 5], fn(x) { x * x })`, "[1, 4, 9, 16, 25]"},
+		{`parallel(1..100, fn(x) { x }, {concurrency: 7}).length()`, "100"},
+		{`parallel(1..6, fn(x) { if (x % 2 == 0) { x } })`, "[2, 4, 6]"},
+		{`parallel(["a", "b"], fn(i, s) { s + i })`, "[a0, b1]"},
+		{`parallel([], fn(x) { x })`, "[]"},
+		{`parallel(["a", "b"], toUpper)`, "[A, B]"},
+		{`parallel([1, 2], fn(x) { let n = x; for (i in 1..3) { n = n + i }; n })`, "[7, 8]"},
+		{`let base = 10; parallel([1, 2], fn(x) { base + x })`, "[11, 12]"},
+		{`let wrap = fn(x) { [x] }; parallel([1, 2], fn(x) { wrap(x) })`, "[[1], [2]]"},
+		{`parallel(iter(fn(yield) { yield(1); yield(2) }), fn(x) { x + 1 })`, "[2, 3]"},
+	}
+
+	for _, tt := range tests {
+		result := testEvalHelper(tt.input)
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
+
+func TestParallelErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`parallel([1])`, "wrong number of arguments"},
+		{`parallel(5, fn(x) { x })`, "must be an array or iterator"},
+		{`parallel([1], 5)`, "must be a function"},
+		{`parallel([1], fn(a, b, c) { a })`, "must take 1 or 2 parameters"},
+		{`parallel([1], fn(x) { x }, {concurrency: 0})`, "must be a positive integer"},
+		{`parallel(1..20, fn(x) { if (x == 5 || x == 15) { x / 0 } else { x } })`, "division by zero"},
+		{`let total = 0; parallel([1, 2], fn(x) { total = total + x })`, "cannot assign to total inside parallel()"},
+		{`let total = 0; let add = fn(x) { total = total + x }; parallel([1, 2], fn(x) { add(x) })`, "cannot assign to total inside parallel()"},
+		{`parallel([1], fn(x) { import(@./lib.pars) })`, "cannot import inside parallel()"},
+	}
+
+	for _, tt := range tests {
+		result := testEvalHelper(tt.input)
+		errObj, ok := result.(*evaluator.Error)
+		if !ok || !strings.Contains(errObj.Message, tt.expected) {
+			t.Errorf("%s: expected error containing %q, got %s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
+
+// TestParallelConcurrency tests that requests run at the same time, up to
+// the concurrency option, and come back in order
+func TestParallelConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		w.Write([]byte(strings.TrimPrefix(r.URL.Path, "/")))
+	}))
+	defer server.Close()
+
+	input := `parallel(1..8, fn(n) {
+		let {data} <=/= text(url("` + server.URL + `/" + n))
+		data
+	}, {concurrency: 4}).join(",")`
+	result := testEvalHelper(input)
+	if result.Inspect() != "1,2,3,4,5,6,7,8" {
+		t.Fatalf("expected pages in order, got %s", result.Inspect())
+	}
+	if maxInFlight < 2 || maxInFlight > 4 {
+		t.Errorf("expected between 2 and 4 requests at once, got %d", maxInFlight)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/lexer"
+	"github.com/sambeau/parsley/pkg/parser"
+)
+
+// TestParserRecovery tests that each broken statement is reported once, and
+// parsing carries on with the statements after it
+func TestParserRecovery(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		lines      []int
+		statements int
+	}{
+		{
+			name: "one error per line",
+			input: "let a = 1 +\n" +
+				"let b = 2\n" +
+				"let c = fn(x) { x + }\n" +
+				"let d = 4\n" +
+				"let = 5\n" +
+				"let g = 7\n",
+			lines:      []int{1, 3, 5},
+			statements: 3,
+		},
+		{
+			name:       "statements separated by semicolons",
+			input:      "let x = ; let y = 2; let z = )",
+			lines:      []int{1, 1},
+			statements: 1,
+		},
+		{
+			name:       "error in a function body",
+			input:      "let f = fn() {\n  let = 1\n  let ok = 2\n  ok +\n}\nlet h = )\n",
+			lines:      []int{2, 4, 6},
+			statements: 0,
+		},
+		{
+			name:       "no errors",
+			input:      "let a = 1\nlet f = fn(x) { x * 2 }\nf(a)",
+			lines:      nil,
+			statements: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parser.New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			errors := p.Errors()
+
+			if len(errors) != len(tt.lines) {
+				t.Fatalf("expected %d errors, got %d: %s", len(tt.lines), len(errors), strings.Join(errors, "; "))
+			}
+			for i, line := range tt.lines {
+				prefix := fmt.Sprintf("line %d,", line)
+				if !strings.HasPrefix(errors[i], prefix) {
+					t.Errorf("expected error %d on line %d, got %q", i+1, line, errors[i])
+				}
+			}
+			if len(program.Statements) != tt.statements {
+				t.Errorf("expected %d statements, got %d", tt.statements, len(program.Statements))
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+// TestWindowsPaths tests that drive letters and UNC shares are kept as a
+// path's volume on every platform
+func TestWindowsPaths(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`path("C:\\Users\\ada\\x.txt").components`, `[C:, Users, ada, x.txt]`},
+		{`path("C:\\Users\\ada\\x.txt").string`, `C:/Users/ada/x.txt`},
+		{`path("C:\\Users\\ada\\x.txt").absolute`, `true`},
+		{`path("C:\\Users\\ada\\x.txt").volume`, `C:`},
+		{`path("C:\\Users\\ada\\x.txt").dir`, `C:/Users/ada`},
+		{`path("C:\\Users").parent.string`, `C:/`},
+		{`path("C:\\").string`, `C:/`},
+		{`path("C:\\x").dir`, `C:/`},
+		{`path("c:/a/../../b").string`, `c:/b`},
+		{`path("\\\\srv\\share\\docs\\a.txt").components`, `[//srv/share, docs, a.txt]`},
+		{`path("\\\\srv\\share\\docs\\a.txt").string`, `//srv/share/docs/a.txt`},
+		{`path("\\\\srv\\share\\docs\\a.txt").volume`, `//srv/share`},
+		{`path("\\\\srv\\share\\docs").parent.string`, `//srv/share`},
+		{`path("\\\\srv\\share\\..\\..").string`, `//srv/share`},
+		{`path("/usr/local").volume`, ``},
+		{`path("/usr").parent.string`, `/`},
+		{`path("1:/x").absolute`, `false`},
+		{`path("docs\\guide.md").components`, `[docs, guide.md]`},
+	}
+
+	for _, tt := range tests {
+		result := evalPathCleaningTest(t, tt.input)
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
+
+// TestHomeExpansion tests that ~ means the home directory wherever a path
+// reaches the file system
+func TestHomeExpansion(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	policy := &evaluator.SecurityPolicy{AllowWrite: []string{home}}
+	result := evalWithPolicy(t, `"hello" ==> text(@~/note.txt); let s <== text(@~/note.txt); [s, files("~/*.txt").length()]`, policy)
+	if result.Inspect() != "[hello, 1]" {
+		t.Fatalf("expected [hello, 1], got %s", result.Inspect())
+	}
+	if data, err := os.ReadFile(filepath.Join(home, "note.txt")); err != nil || string(data) != "hello" {
+		t.Errorf("expected note.txt in the home directory, got %q (%v)", data, err)
+	}
+
+	if got := evaluator.ExpandHome("~"); got != home {
+		t.Errorf("expected ~ to expand to %s, got %s", home, got)
+	}
+	if got := evaluator.ExpandHome("~user/x"); got != "~user/x" {
+		t.Errorf("expected ~user/x to be left alone, got %s", got)
+	}
+}
+
+// TestSecurityRootAllowed tests that allowing a root directory allows
+// everything under it
+func TestSecurityRootAllowed(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.VolumeName(dir) + string(filepath.Separator)
+	target := filepath.ToSlash(filepath.Join(dir, "out.txt"))
+
+	result := evalWithPolicy(t, `"x" ==> text("`+target+`")`, &evaluator.SecurityPolicy{AllowWrite: []string{root}})
+	if errObj, ok := result.(*evaluator.Error); ok {
+		t.Fatalf("expected write under %s to be allowed, got %s", root, errObj.Message)
+	}
+
+	// Case only matters where the file system cares about it
+	upper := strings.ToUpper(dir)
+	if upper == dir {
+		return
+	}
+	result = evalWithPolicy(t, `"x" ==> text("`+target+`")`, &evaluator.SecurityPolicy{AllowWrite: []string{upper}})
+	_, denied := result.(*evaluator.Error)
+	if runtime.GOOS == "windows" && denied {
+		t.Errorf("expected paths to be compared ignoring case on Windows")
+	}
+	if runtime.GOOS != "windows" && !denied {
+		t.Errorf("expected paths to be compared with case")
+	}
+}
@@ -36,12 +36,12 @@ func TestPathParsing(t *testing.T) {
 		{
 			name:     "absolute unix path",
 			input:    `path("/usr/local/bin")`,
-			expected: `{__type: path, absolute: true, components: , usr, local, bin}`,
+			expected: `/usr/local/bin`,
 		},
 		{
 			name:     "relative path",
 			input:    `path("./config/app.json")`,
-			expected: `{__type: path, absolute: false, components: ., config, app.json}`,
+			expected: `./config/app.json`,
 		},
 		{
 			name:     "path_components_access",
@@ -303,6 +303,11 @@ func TestUrlToString(t *testing.T) {
 			input:    `let u = url("https://user@example.com:8080/api?limit=10#top"); toString(u)`,
 			expected: `https://user@example.com:8080/api?limit=10#top`,
 		},
+		{
+			name:     "URL query keys in stable order",
+			input:    `let u = url("https://example.com/search?q=go&page=2&limit=10&sort=new"); toString(u) + " " + u.search`,
+			expected: `https://example.com/search?limit=10&page=2&q=go&sort=new ?limit=10&page=2&q=go&sort=new`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+	"github.com/sambeau/parsley/pkg/lexer"
+	"github.com/sambeau/parsley/pkg/parser"
+)
+
+// Fake renderers record their arguments and write the HTML they were given
+// after a PDF header, so tests can see what would have been printed
+const fakeChromium = `#!/bin/sh
+printf '%s\n' "$@" > "$(dirname "$0")/args.txt"
+for a; do
+    case "$a" in
+        --print-to-pdf=*) out="${a#--print-to-pdf=}" ;;
+        file://*) in="${a#file://}" ;;
+    esac
+done
+{ printf '%%PDF-fake\n'; cat "$in"; } > "$out"
+`
+
+const fakeWkhtmltopdf = `#!/bin/sh
+printf '%s\n' "$@" > "$(dirname "$0")/args.txt"
+for a; do in="$out"; out="$a"; done
+{ printf '%%PDF-fake\n'; cat "$in"; } > "$out"
+`
+
+const failingRenderer = `#!/bin/sh
+echo "cannot open display" >&2
+exit 1
+`
+
+// testEvalPDF evaluates input under a security policy
+func testEvalPDF(input string, policy *evaluator.SecurityPolicy) evaluator.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := evaluator.NewEnvironment()
+	env.Security = policy
+	return evaluator.Eval(program, env)
+}
+
+func writeFakeRenderer(t *testing.T, dir, name, script string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestWritePDF(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake renderers are shell scripts")
+	}
+	allowAll := &evaluator.SecurityPolicy{AllowWriteAll: true, AllowExecuteAll: true}
+
+	tests := []struct {
+		name     string
+		renderer string
+		script   string
+		input    string
+		contains []string
+		args     []string
+	}{
+		{
+			name:     "chromium with defaults",
+			renderer: "chromium",
+			script:   fakeChromium,
+			input:    `writePDF("<p>Report</p>", OUT, {renderer: RENDERER})`,
+			contains: []string{"%PDF-fake", "<style>@page { size: A4 }</style><p>Report</p>"},
+			args:     []string{"--headless"},
+		},
+		{
+			name:     "chromium page settings go in the head",
+			renderer: "chromium",
+			script:   fakeChromium,
+			input:    `writePDF("<!DOCTYPE html><html><head><title>R</title></head><body>Hi</body></html>", OUT, {renderer: RENDERER, pageSize: "letter", landscape: true, margins: {top: "1in", bottom: "2cm"}})`,
+			contains: []string{`<head><base href="file://`, "<style>@page { size: Letter landscape; margin: 1in 0 2cm 0 }</style><title>R</title>"},
+		},
+		{
+			name:     "wkhtmltopdf flags",
+			renderer: "wkhtmltopdf",
+			script:   fakeWkhtmltopdf,
+			input:    `writePDF([tag("h1", {}, "Title"), "<p>Body</p>"], OUT, {renderer: RENDERER, pageSize: "A5", landscape: true, margins: "20mm"})`,
+			contains: []string{"%PDF-fake", "<h1>Title</h1><p>Body</p>"},
+			args:     []string{"--page-size\nA5\n--orientation\nLandscape\n-T\n20mm\n-R\n20mm\n-B\n20mm\n-L\n20mm\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			renderer := writeFakeRenderer(t, dir, tt.renderer, tt.script)
+			out := filepath.Join(dir, "report.pdf")
+
+			input := strings.NewReplacer("OUT", `"`+out+`"`, "RENDERER", `"`+renderer+`"`).Replace(tt.input)
+			result := testEvalPDF(input, allowAll)
+			if result.Type() == evaluator.ERROR_OBJ {
+				t.Fatalf("Evaluation error: %s", result.Inspect())
+			}
+
+			pdf, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatalf("PDF not written: %v", err)
+			}
+			for _, want := range tt.contains {
+				if !strings.Contains(string(pdf), want) {
+					t.Errorf("expected output to contain %q, got %q", want, pdf)
+				}
+			}
+			args, _ := os.ReadFile(filepath.Join(dir, "args.txt"))
+			for _, want := range tt.args {
+				if !strings.Contains(string(args), want) {
+					t.Errorf("expected renderer args to contain %q, got %q", want, args)
+				}
+			}
+		})
+	}
+}
+
+func TestWritePDFErrors(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake renderers are shell scripts")
+	}
+	dir := t.TempDir()
+	renderer := writeFakeRenderer(t, dir, "chromium", fakeChromium)
+	failing := writeFakeRenderer(t, dir, "failing", failingRenderer)
+	out := filepath.Join(dir, "out.pdf")
+	allowAll := &evaluator.SecurityPolicy{AllowWriteAll: true, AllowExecuteAll: true}
+
+	tests := []struct {
+		input         string
+		policy        *evaluator.SecurityPolicy
+		errorContains string
+	}{
+		{`writePDF("<p>x</p>")`, allowAll, "wrong number of arguments to `writePDF`"},
+		{`writePDF(1, OUT)`, allowAll, "first argument to `writePDF` must be HTML"},
+		{`writePDF("<p>x</p>", 1)`, allowAll, "second argument to `writePDF` must be a path or string"},
+		{`writePDF("<p>x</p>", OUT, {pageSize: "A0"})`, allowAll, "`pageSize` option for `writePDF` must be one of"},
+		{`writePDF("<p>x</p>", OUT, {margins: "20"})`, allowAll, "margins for `writePDF` must be lengths"},
+		{`writePDF("<p>x</p>", OUT, {margins: {inner: "1cm"}})`, allowAll, "unknown margin \"inner\" for `writePDF`"},
+		{`writePDF("<p>x</p>", OUT, {scale: 2})`, allowAll, "unknown option \"scale\" for `writePDF`"},
+		{`writePDF("<p>x</p>", OUT, {renderer: "no-such-renderer-xyz"})`, allowAll, "PDF renderer not found: no-such-renderer-xyz"},
+		{`writePDF("<p>x</p>", OUT, {renderer: FAILING})`, allowAll, "writePDF: failing failed: cannot open display"},
+
+		// The renderer needs execute permission and the PDF needs write permission
+		{`writePDF("<p>x</p>", OUT, {renderer: RENDERER})`, &evaluator.SecurityPolicy{AllowWriteAll: true}, "security: script execution not allowed"},
+		{`writePDF("<p>x</p>", OUT, {renderer: RENDERER})`, &evaluator.SecurityPolicy{AllowExecuteAll: true}, "security: file write not allowed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			input := strings.NewReplacer("OUT", `"`+out+`"`, "RENDERER", `"`+renderer+`"`, "FAILING", `"`+failing+`"`).Replace(tt.input)
+			result := testEvalPDF(input, tt.policy)
+			if result.Type() != evaluator.ERROR_OBJ {
+				t.Fatalf("expected error, got %s", result.Inspect())
+			}
+			if !strings.Contains(result.Inspect(), tt.errorContains) {
+				t.Errorf("expected error containing %q, got %q", tt.errorContains, result.Inspect())
+			}
+		})
+	}
+}
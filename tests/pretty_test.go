@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/ast"
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+func TestPretty(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		opts     evaluator.PrettyOptions
+		expected string
+	}{
+		{
+			name:     "values not expressions",
+			input:    `let x = 2; {b: x * 3, a: "hi", c: [true, null]}`,
+			opts:     evaluator.DefaultPrettyOptions,
+			expected: `{a: "hi", b: 6, c: [true, null]}`,
+		},
+		{
+			name:     "pseudo-types",
+			input:    `[@2024-01-15, @./data.json, @https://example.com/a, /a+/i]`,
+			opts:     evaluator.DefaultPrettyOptions,
+			expected: `[@2024-01-15, @./data.json, @https://example.com/a, /a+/i]`,
+		},
+		{
+			name:  "wraps wide values",
+			input: `{name: "Ada Lovelace", tags: ["mathematician", "writer"], notes: {year: 1843}}`,
+			opts:  evaluator.PrettyOptions{Width: 40, Depth: 8},
+			expected: `{
+  name: "Ada Lovelace",
+  notes: {year: 1843},
+  tags: ["mathematician", "writer"]
+}`,
+		},
+		{
+			name:     "depth limit",
+			input:    `[1, [2, [3, [4]]]]`,
+			opts:     evaluator.PrettyOptions{Width: 80, Depth: 2},
+			expected: `[1, [2, [...]]]`,
+		},
+		{
+			name:     "color",
+			input:    `{a: "x", b: 1}`,
+			opts:     evaluator.PrettyOptions{Width: 80, Color: true},
+			expected: "{\x1b[36ma\x1b[0m: \x1b[32m\"x\"\x1b[0m, \x1b[36mb\x1b[0m: \x1b[33m1\x1b[0m}",
+		},
+		{
+			name:     "functions",
+			input:    `{f: fn(a, b) { a + b }}`,
+			opts:     evaluator.DefaultPrettyOptions,
+			expected: `{f: fn(a, b)}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := evaluator.Pretty(testEvalHelper(tt.input), tt.opts)
+			if got != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestPrettyCycle(t *testing.T) {
+	dict := &evaluator.Dictionary{Pairs: map[string]ast.Expression{}, Env: evaluator.NewEnvironment()}
+	dict.Pairs["name"] = &ast.ObjectLiteralExpression{Obj: &evaluator.String{Value: "loop"}}
+	dict.Pairs["self"] = &ast.ObjectLiteralExpression{Obj: dict}
+
+	got := evaluator.Pretty(dict, evaluator.DefaultPrettyOptions)
+	if got != `{name: "loop", self: <cycle>}` {
+		t.Errorf("unexpected output: %s", got)
+	}
+}
+
+func TestToDebugPretty(t *testing.T) {
+	result := testEvalHelper(`toDebug({a: 1 + 1}, "s")`)
+	if result.Inspect() != `{a: 2}, "s"` {
+		t.Errorf("unexpected toDebug output: %s", result.Inspect())
+	}
+}
@@ -205,6 +205,170 @@ func TestProcessExecutionResult(t *testing.T) {
 	}
 }
 
+// TestCommandOnFailure tests the onFailure option
+func TestCommandOnFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "result by default",
+			input:    `let r = COMMAND("sh", ["-c", "exit 3"]) <=#=> null; r.exitCode`,
+			expected: "3",
+		},
+		{
+			name:     "error includes command line and stderr",
+			input:    `COMMAND("sh", ["-c", "echo oops >&2; exit 2"], {onFailure: "error"}) <=#=> null`,
+			expected: "ERROR: command `sh -c \"echo oops >&2; exit 2\"` failed with exit code 2: oops",
+		},
+		{
+			name:     "error without stderr",
+			input:    `COMMAND("false", [], {onFailure: "error"}) <=#=> null`,
+			expected: "ERROR: command `false` failed with exit code 1",
+		},
+		{
+			name:     "error when the command is missing",
+			input:    `COMMAND("no-such-command-xyz", ["a"], {onFailure: "error"}) <=#=> null`,
+			expected: "ERROR: command `no-such-command-xyz a` failed: command not found: no-such-command-xyz",
+		},
+		{
+			name:     "success returns the result",
+			input:    `(COMMAND("echo", ["hi"], {onFailure: "error"}) <=#=> null).stdout`,
+			expected: "hi\n",
+		},
+		{
+			name:     "null on failure",
+			input:    `let r = COMMAND("false", [], {onFailure: "null"}) <=#=> null; r ?? "failed"`,
+			expected: "failed",
+		},
+		{
+			name:     "null mode returns result on success",
+			input:    `(COMMAND("true", [], {onFailure: "null"}) <=#=> null).exitCode`,
+			expected: "0",
+		},
+		{
+			name:     "invalid mode",
+			input:    `COMMAND("true", [], {onFailure: "ignore"}) <=#=> null`,
+			expected: "ERROR: COMMAND option `onFailure` must be \"result\", \"error\" or \"null\"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalProcess(tt.input)
+			if result.Inspect() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+// TestShTemplate tests sh() command templates
+func TestShTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "values dictionary",
+			input:    `(sh("printf '%s|' {input} -resize {w}x{h}", {input: "my photo.jpg", w: 100, h: 50}) <=#=> null).stdout`,
+			expected: "my photo.jpg|-resize|100x50|",
+		},
+		{
+			name:     "values from scope",
+			input:    `let name = "a b"; (sh("printf '%s|' {name}") <=#=> null).stdout`,
+			expected: "a b|",
+		},
+		{
+			name:     "metacharacters are not interpreted",
+			input:    `let f = "x; rm -rf / && echo $HOME"; (sh("printf '%s|' {f}") <=#=> null).stdout`,
+			expected: "x; rm -rf / && echo $HOME|",
+		},
+		{
+			name:     "quoting rules",
+			input:    `(sh("printf '%s|' 'single {x}' \"double {x}\" back\\ slash \"\\{x}\"", {x: 1}) <=#=> null).stdout`,
+			expected: "single {x}|double 1|back slash|{x}|",
+		},
+		{
+			name:     "arrays expand to one argument per element",
+			input:    `(sh("printf '%s|' {files}", {files: ["a b", "c"]}) <=#=> null).stdout`,
+			expected: "a b|c|",
+		},
+		{
+			name:     "dotted placeholders",
+			input:    `let img = {size: {w: 640}}; (sh("printf '%s|' w={img.size.w}") <=#=> null).stdout`,
+			expected: "w=640|",
+		},
+		{
+			name:     "paths as arguments",
+			input:    `(sh("printf '%s|' {p}", {p: @./out/file.txt}) <=#=> null).stdout`,
+			expected: "./out/file.txt|",
+		},
+		{
+			name:     "empty string stays an argument",
+			input:    `(sh("printf '%s|' {e} x", {e: ""}) <=#=> null).stdout`,
+			expected: "|x|",
+		},
+		{
+			name:     "options are passed to the command",
+			input:    `sh("false", null, {onFailure: "error"}) <=#=> null`,
+			expected: "ERROR: command `false` failed with exit code 1",
+		},
+		{
+			name:     "returns a command handle",
+			input:    `let c = sh("ls -la {d}", {d: "/tmp"}); [c.binary, c.args]`,
+			expected: "[ls, [-la, /tmp]]",
+		},
+		{
+			name:     "sh can be shadowed",
+			input:    `let sh = fn(x) { x + "!" }; sh("hi")`,
+			expected: "hi!",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalProcess(tt.input)
+			if result.Inspect() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+// TestShTemplateErrors tests sh() template errors
+func TestShTemplateErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		errorContains string
+	}{
+		{"undefined placeholder", `sh("echo {missing}")`, "placeholder {missing} is not defined"},
+		{"unterminated quote", `sh("echo 'oops")`, "unterminated single quote"},
+		{"unterminated double quote", `sh("echo \"oops")`, "unterminated double quote"},
+		{"unterminated placeholder", `sh("echo {x")`, "unterminated placeholder"},
+		{"empty template", `sh("   ")`, "has no command"},
+		{"dictionary value", `sh("echo {d}", {d: {a: 1}})`, "must be a string, number, path or array"},
+		{"array inside a word", `sh("echo x{a}", {a: [1]})`, "arrays must be a whole unquoted word"},
+		{"nested array", `sh("echo {a}", {a: [[1]]})`, "arrays must be a whole unquoted word"},
+		{"bad values", `sh("echo", 1)`, "second argument to `sh` must be a dictionary"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalProcess(tt.input)
+			if result.Type() != evaluator.ERROR_OBJ {
+				t.Fatalf("Expected error, got %s", result.Inspect())
+			}
+			if !strings.Contains(result.Inspect(), tt.errorContains) {
+				t.Errorf("Expected error containing %q, got %q", tt.errorContains, result.Inspect())
+			}
+		})
+	}
+}
+
 // TestJSONFormatBuiltins tests parseJSON and stringifyJSON
 func TestJSONFormatBuiltins(t *testing.T) {
 	tests := []struct {
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+	"github.com/sambeau/parsley/pkg/lexer"
+	"github.com/sambeau/parsley/pkg/parser"
+)
+
+const propsCard = `let Card = fn(p) {
+    props {title: string, items: array = [], note = "none"}
+    <div><h2>{title}</h2>{len(items)} {note}</div>
+}
+`
+
+func TestPropsDeclaration(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// Passed props, and defaults for the rest
+		{propsCard + `<Card title="Hi" items={[1, 2]} note="ok"/>`, "<div><h2>Hi</h2>2 ok</div>"},
+		{propsCard + `<Card title="Hi"/>`, "<div><h2>Hi</h2>0 none</div>"},
+
+		// null counts as missing
+		{propsCard + `<Card title="Hi" note={null}/>`, "<div><h2>Hi</h2>0 none</div>"},
+
+		// Undeclared props are allowed
+		{propsCard + `<Card title="Hi" class="wide"/>`, "<div><h2>Hi</h2>0 none</div>"},
+
+		// Tag pairs pass their contents as a prop
+		{`let Box = fn(p) { props {label: string, contents}; <section>{label}: {contents}</section> }
+<Box label="Note">Body</Box>`, "<section>Note: Body</section>"},
+
+		// Defaults can use earlier props
+		{`let Rect = fn(p) { props {w: int = 10, h: int = w}; w * h }; <Rect w={3}/>`, "9"},
+
+		// Pseudo-types, number and any
+		{`let When = fn(p) { props {at: datetime}; at.year }; <When at={@2024-03-15}/>`, "2024"},
+		{`let N = fn(p) { props {n: number, x: any}; n }; <N n={1.5} x={[1]}/>`, "1.5"},
+
+		// Ordinary calls
+		{`let double = fn(opts) { props {n: int}; n * 2 }; double({n: 4})`, "8"},
+		{`let greet = fn(opts) { props {name = "world"}; "hello " + name }; greet()`, "hello world"},
+
+		// props is still an ordinary name
+		{`let props = {a: 1}; props.a`, "1"},
+		{`let C = fn(props) { props.title }; <C title="T"/>`, "T"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Type() == evaluator.ERROR_OBJ {
+				t.Fatalf("Evaluation error: %s", result.Inspect())
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestPropsErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		errorContains string
+	}{
+		// Errors name the component and point at the tag
+		{propsCard + `<Card/>`, "line 5, column 1: <Card>: missing required prop `title`"},
+		{propsCard + `
+<div>
+    <Card items={[]}></Card>
+</div>`, "line 7, column 5: <Card>: missing required prop `title`"},
+		{propsCard + `<Card title={null}/>`, "<Card>: missing required prop `title`"},
+		{propsCard + `<Card title="Hi" items="a, b"/>`, "<Card>: prop `items` must be array, got string"},
+		{propsCard + `<Card title={1}/>`, "<Card>: prop `title` must be string, got int"},
+
+		{`let double = fn(opts) { props {n: int}; n * 2 }; double({})`, "missing required prop `n`"},
+		{`let double = fn(opts) { props {n: int}; n * 2 }; double(4)`, "props must be passed as a dictionary, got INTEGER"},
+		{`let C = fn(p) { props {title: strng}; title }; <C title="T"/>`, "unknown type \"strng\" for prop `title`"},
+		{`props {title}`, "props can only be declared inside a function"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Type() != evaluator.ERROR_OBJ {
+				t.Fatalf("expected error, got %s", result.Inspect())
+			}
+			if !strings.Contains(result.Inspect(), tt.errorContains) {
+				t.Errorf("expected error containing %q, got %q", tt.errorContains, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestPropsParseErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		errorContains string
+	}{
+		{`fn(p) { props {title: } }`, "expected identifier, got '}'"},
+		{`fn(p) { props {title title} }`, "expected ',', got 'title'"},
+		{`fn(p) { props {a, b, a} }`, "prop a is declared twice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			p := parser.New(lexer.New(tt.input))
+			p.ParseProgram()
+			errs := p.Errors()
+			if len(errs) == 0 {
+				t.Fatalf("expected parse error containing %q", tt.errorContains)
+			}
+			if !strings.Contains(errs[0], tt.errorContains) {
+				t.Errorf("expected error containing %q, got %q", tt.errorContains, errs[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+const provideLayout = `let Footer = fn() { <footer>{inject("site").name}</footer> }
+let Page = fn(p) { <main>{p.contents}<Footer/></main> }
+let Layout = fn(p) {
+    provide("site", p.site)
+    <Page>{p.title}</Page>
+}
+`
+
+func TestProvideInject(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// Through components that don't pass the value on
+		{provideLayout + `let site = {name: "Example"}
+<Layout site={site} title="Home"/>`, "<main>Home<footer>Example</footer></main>"},
+
+		// Through ordinary function calls
+		{`let inner = fn() { inject("n") * 2 }
+let middle = fn() { inner() }
+let outer = fn() { provide("n", 21); middle() }
+outer()`, "42"},
+
+		// The nearest provider wins
+		{`let show = fn() { inject("theme") }
+let dark = fn() { provide("theme", "dark"); show() }
+provide("theme", "light")
+let themes = [show(), dark(), show()]
+themes`, "[light, dark, light]"},
+
+		// Values last until the providing function returns
+		{`let setup = fn() { provide("x", 1) }
+setup()
+inject("x", "none")`, "none"},
+
+		// Callbacks see what the function they're in can see
+		{`let item = fn(i) { inject("prefix") + i }
+let list = fn() { provide("prefix", "#"); [1, 2].map(fn(i) { item(i) }) }
+list()`, "[#1, #2]"},
+
+		// Defaults, and provide() renders nothing
+		{`inject("missing", 5)`, "5"},
+		{`let C = fn() { provide("a", 1); <p>ok</p> }; <C/>`, "<p>ok</p>"},
+
+		// Ordinary names can still be provide/inject
+		{`let inject = fn(x) { x + 1 }; inject(1)`, "2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Type() == evaluator.ERROR_OBJ {
+				t.Fatalf("Evaluation error: %s", result.Inspect())
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestProvided(t *testing.T) {
+	input := `provide("site", "Example")
+provide("theme", "light")
+let Inner = fn() { provided() }
+let Outer = fn() {
+    provide("theme", "dark")
+    <Inner/>
+}
+let rows = <Outer/>
+rows.map(fn(r) { r.key + "=" + r.value + " from " + r.from })`
+	result := testEvalHelper(input)
+	if result.Type() == evaluator.ERROR_OBJ {
+		t.Fatalf("Evaluation error: %s", result.Inspect())
+	}
+	expected := "[theme=dark from <Outer> on line 8, site=Example from top level]"
+	if result.Inspect() != expected {
+		t.Errorf("expected %q, got %q", expected, result.Inspect())
+	}
+}
+
+func TestProvideErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		errorContains string
+	}{
+		{`inject("site")`, "inject: nothing provided for \"site\""},
+		{`let f = fn() { inject("site") }; let g = fn() { provide("site", 1) }; g(); f()`, "nothing provided for \"site\""},
+		{`provide("site")`, "wrong number of arguments to `provide`"},
+		{`provide(1, 2)`, "first argument to `provide` must be a string"},
+		{`inject()`, "wrong number of arguments to `inject`"},
+		{`provided(1)`, "wrong number of arguments to `provided`"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Type() != evaluator.ERROR_OBJ {
+				t.Fatalf("expected error, got %s", result.Inspect())
+			}
+			if !strings.Contains(result.Inspect(), tt.errorContains) {
+				t.Errorf("expected error containing %q, got %q", tt.errorContains, result.Inspect())
+			}
+		})
+	}
+}
@@ -34,6 +34,18 @@ func TestRangeOperator(t *testing.T) {
 		{"0..0", "[0]"},
 		{"-1..-1", "[-1]"},
 
+		// Steps
+		{"1..10 by 2", "[1, 3, 5, 7, 9]"},
+		{"0..10 by 5", "[0, 5, 10]"},
+		{"10..1 by 3", "[10, 7, 4, 1]"},
+		{"-6..6 by 4", "[-6, -2, 2, 6]"},
+		{"1..3 by 10", "[1]"},
+		{"10..1 by -1", "[10, 9, 8, 7, 6, 5, 4, 3, 2, 1]"},
+		{"5..-5 by -5", "[5, 0, -5]"},
+		{"3..3 by -1", "[3]"},
+		{"let n = 2; 0..n * 3 by n", "[0, 2, 4, 6]"},
+		{"let by = 3; 1..by", "[1, 2, 3]"},
+
 		// Large ranges
 		{"1..100", "[1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34, 35, 36, 37, 38, 39, 40, 41, 42, 43, 44, 45, 46, 47, 48, 49, 50, 51, 52, 53, 54, 55, 56, 57, 58, 59, 60, 61, 62, 63, 64, 65, 66, 67, 68, 69, 70, 71, 72, 73, 74, 75, 76, 77, 78, 79, 80, 81, 82, 83, 84, 85, 86, 87, 88, 89, 90, 91, 92, 93, 94, 95, 96, 97, 98, 99, 100]"},
 	}
@@ -95,6 +107,32 @@ func TestRangeInExpressions(t *testing.T) {
 		{"(1..5) || (4..8)", "[1, 2, 3, 4, 5, 6, 7, 8]"},
 		{"(1..5) - (2..3)", "[1, 4, 5]"},
 
+		// Consumed without generating the whole range
+		{"(1..1000000000).length()", "1000000000"},
+		{"(1..1000000000 by 3).length()", "333333334"},
+		{"500000000 in 1..1000000000", "true"},
+		{"0 in 1..1000000000", "false"},
+		{"7 in 1..10 by 3", "true"},
+		{"8 in 1..10 by 3", "false"},
+		{"4 in 10..1 by 3", "true"},
+		{"\"3\" in 1..5", "false"},
+		{"for (i in 1..10 by 3) { i }", "[1, 4, 7, 10]"},
+		{"for (i, x in 10..0 by 5) { i + x }", "[10, 6, 2]"},
+		{"(1..100000).filter(fn(x) { x % 25000 == 0 })", "[25000, 50000, 75000, 100000]"},
+		{"(0..9 by 3).map(fn(x) { x / 3 })", "[0, 1, 2, 3]"},
+		{"let r = 1..1000000000; r.length()", "1000000000"},
+		{"let r = 1..1000000000; r[5]", "6"},
+		{"let r = range(1, 1000000000); r[-1]", "1000000000"},
+		{"(1..1000000000)[10:13]", "[11, 12, 13]"},
+		{"(1..1000000000).reverse().first()", "1000000000"},
+		{"let r = range(1, 1000000000, 2); r.includes(999999999)", "true"},
+		{"let r = 1..1000000000; 1000000000 in r", "true"},
+		{"let r = range(1, 1000000000); for (x in r[0:3]) { x * 2 }", "[2, 4, 6]"},
+		{"typeOf(1..3)", "range"},
+		{"typeOf((1..3).toArray())", "array"},
+		{"isA(1..3, \"array\")", "true"},
+		{"let [a, b] = 1..2; a + b", "3"},
+
 		// In function arguments
 		{"len(1..10)", "10"},
 		{"(1..5).join(\", \")", "1, 2, 3, 4, 5"},
@@ -128,6 +166,29 @@ func TestRangeInExpressions(t *testing.T) {
 	}
 }
 
+func TestRangeBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"range(1, 5)", "[1, 2, 3, 4, 5]"},
+		{"range(5, 1)", "[5, 4, 3, 2, 1]"},
+		{"range(0, 10, 5)", "[0, 5, 10]"},
+		{"range(10, 1, 3)", "[10, 7, 4, 1]"},
+		{"range(-4, 4, 4)", "[-4, 0, 4]"},
+		{"range(10, 1, -3)", "[10, 7, 4, 1]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
 func TestRangeErrors(t *testing.T) {
 	tests := []struct {
 		input       string
@@ -138,6 +199,14 @@ func TestRangeErrors(t *testing.T) {
 		{"\"a\"..\"z\"", "range start must be an integer"},
 		{"1..[5]", "range end must be an integer"},
 		{"true..false", "range start must be an integer"},
+		{"1..10 by 0", "range step can't be zero"},
+		{"1..10 by -2", "range step -2 counts down, but 1..10 counts up"},
+		{"1..10 by 1.5", "range step must be an integer"},
+		{"range(1)", "wrong number of arguments to `range`"},
+		{"range(1, \"5\")", "range end must be an integer"},
+		{"range(1, 5, 0)", "range step can't be zero"},
+		{"range(1, 5, -1)", "counts down"},
+		{"(1..1000000000)[1000000000]", "index out of range: 1000000000"},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+	"github.com/sambeau/parsley/pkg/lexer"
+	"github.com/sambeau/parsley/pkg/parser"
+)
+
+func TestParseBuiltin(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{`parse("1 + 2").type`, "Program"},
+		{`parse("1 + 2").statements[0].expression.type`, "InfixExpression"},
+		{`parse("1 + 2").statements[0].expression.operator`, "+"},
+		{`parse("1 + 2").statements[0].expression.right.value`, "2"},
+		{`parse("let x = 5").statements[0].name.value`, "x"},
+		{`parse("export let x = 5").statements[0].exported`, "true"},
+		{`parse("foo(1, 2)").statements[0].expression.arguments.length()`, "2"},
+		{`parse("\n\n  x").statements[0].line`, "3"},
+		{`parse("\n\n  x").statements[0].column`, "3"},
+		{`parse("{a: 1}").statements[0].expression.pairs.a.type`, "IntegerLiteral"},
+		{`parse("fn(a, b) { a }").statements[0].expression.params.map(fn(p) { p.ident.value })`, "[a, b]"},
+		{`parse("@2024-01-15").statements[0].expression.type`, "DatetimeLiteral"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestEvalBuiltin(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{`eval("1 + 2")`, "3"},
+		{`eval("let x = 2\nx * 21")`, "42"},
+		{`eval("a + b", {env: {a: 1, b: 41}})`, "42"},
+		{`eval(parse("[1, 2, 3].map(fn(x) { x * 2 })"))`, "[2, 4, 6]"},
+		{`eval("fn(x) { x * 2 }")(21)`, "42"},
+		{`eval(parse("1 + 2").statements[0])`, "3"},
+		{`eval(parse("1 + 2").statements[0].expression)`, "3"},
+		{`eval({type: "InfixExpression", operator: "*", left: {type: "IntegerLiteral", value: 6}, right: {type: "IntegerLiteral", value: 7}})`, "42"},
+		{`eval({type: "CallExpression", function: {type: "Identifier", value: "toUpper"}, arguments: [{type: "StringLiteral", value: "hi"}]})`, "HI"},
+		{`eval("<p>{name}</p>", {env: {name: "Ann"}})`, "<p>Ann</p>"},
+		{`let tree = parse("1 + 2"); eval({type: "InfixExpression", operator: "-", left: tree.statements[0].expression, right: {type: "IntegerLiteral", value: 1}})`, "2"},
+		{`let eval = fn(x) { "shadowed" }; eval("1")`, "shadowed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+// TestParseEvalRoundTrip checks that evaluating parse(src) gives the same
+// result as evaluating src, covering the AST node types
+func TestParseEvalRoundTrip(t *testing.T) {
+	sources := []string{
+		`let x = 5; let y = x * 2; y - 1`,
+		`let [a, b] = [1, 2]; a + b`,
+		`let {a, ...rest} = {a: 1, b: 2, d: 3}; [a, rest.d]`,
+		`let f = fn(a, {b}, [c, d]) { a + b + c + d }; f(1, {b: 2}, [3, 4])`,
+		`if (1 < 2) { "yes" } else { "no" }`,
+		`for (i, x in ["a", "b"]) { x + i }`,
+		`for (x in [1, 2, 3]) { if (x > 1) { x } }`,
+		`let d = {a: 1, b: {c: [1, 2]}}; d.b.c[1]`,
+		`[1, 2, 3, 4][1:3]`,
+		`!true`,
+		`-5 + 2.5`,
+		"`sum {1 + 1}`",
+		`/a+/.test("caaat")`,
+		`@2024-03-15.year`,
+		`@1h30m.format()`,
+		`@./src/main.pars.basename`,
+		`@https://example.com/a.path`,
+		`let n = "x"; @(./files/{n}.txt).basename`,
+		`<div class="a"><p>Hello</p>text</div>`,
+		`<br/>`,
+		`let Item = fn({name}) { <li>{name}</li> }; <ul><Item name="a"/></ul>`,
+		`let x = 1; x = x + 1; x`,
+		`let f = fn(n) { if (n <= 1) { return 1 }; n * f(n - 1) }; f(5)`,
+		`null ?? "default"`,
+		`"a,b".split(",")`,
+	}
+
+	for _, src := range sources {
+		t.Run(src, func(t *testing.T) {
+			direct := testEvalHelper(src)
+			if direct.Type() == evaluator.ERROR_OBJ {
+				t.Fatalf("source failed to evaluate: %s", direct.Inspect())
+			}
+			quoted := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(src)
+			roundTrip := testEvalHelper(`eval(parse("` + quoted + `"))`)
+			if roundTrip.Inspect() != direct.Inspect() {
+				t.Errorf("expected %q, got %q", direct.Inspect(), roundTrip.Inspect())
+			}
+		})
+	}
+}
+
+func TestEvalSandbox(t *testing.T) {
+	dir, err := os.MkdirTemp("", "parsley_eval_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "in.txt")
+	os.WriteFile(input, []byte("secret"), 0644)
+	output := filepath.Join(dir, "out.txt")
+
+	run := func(code string) evaluator.Object {
+		p := parser.New(lexer.New(code))
+		program := p.ParseProgram()
+		if len(p.Errors()) > 0 {
+			t.Fatalf("parser errors: %v", p.Errors())
+		}
+		env := evaluator.NewEnvironment()
+		env.Security = &evaluator.SecurityPolicy{AllowWriteAll: true, AllowExecuteAll: true}
+		return evaluator.Eval(program, env)
+	}
+
+	tests := []struct {
+		name          string
+		code          string
+		expected      string
+		errorContains string
+	}{
+		{"inherits the caller's policy", `eval("let s <== text(@` + input + `); s")`, "secret", ""},
+		{"caller scope is not visible", `let s = 1; eval("s")`, "", "identifier not found: s"},
+		{"sandbox denies reads", `eval("let s <== text(@` + input + `); s", {sandbox: true})`, "", "file read access denied"},
+		{"sandbox denies writes", `eval("\"x\" ==> text(@` + output + `)", {sandbox: true})`, "", "file write not allowed"},
+		{"sandbox denies imports", `eval("import(@./lib.pars)", {sandbox: true})`, "", "security"},
+		{"read: false", `eval("let s <== text(@` + input + `); s", {read: false})`, "", "file read access denied"},
+		{"write: false allows reads", `eval("let s <== text(@` + input + `); s", {write: false})`, "secret", ""},
+		{"options cannot grant access", `eval("let s <== text(@` + input + `); s", {sandbox: false, read: true})`, "secret", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := run(tt.code)
+			if tt.errorContains != "" {
+				if result.Type() != evaluator.ERROR_OBJ || !strings.Contains(result.Inspect(), tt.errorContains) {
+					t.Errorf("expected error containing %q, got %s", tt.errorContains, result.Inspect())
+				}
+				return
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+
+	if _, err := os.Stat(output); err == nil {
+		t.Errorf("sandboxed eval wrote %s", output)
+	}
+}
+
+func TestParseEvalErrors(t *testing.T) {
+	tests := []struct {
+		code          string
+		errorContains string
+	}{
+		{`parse("1 +")`, "parse error: line 1"},
+		{`parse(1)`, "argument to `parse` must be a string"},
+		{`eval("1 +")`, "in eval: parse error"},
+		{`eval("x")`, "in eval: line 1, column 1: identifier not found: x"},
+		{`eval(1)`, "first argument to `eval` must be a string or AST dictionary"},
+		{`eval({type: "Bogus"})`, `unknown AST node type "Bogus"`},
+		{`eval({value: 1})`, "AST node is missing its `type`"},
+		{`eval({type: "InfixExpression", operator: 1})`, "InfixExpression.operator: expected string"},
+		{`eval("1", {color: "red"})`, "unknown option `color` for `eval`"},
+		{`eval("1", {sandbox: "yes"})`, "`sandbox` option to `eval` must be a boolean"},
+		{`eval("1", {env: [1]})`, "`env` option to `eval` must be a dictionary"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if result.Type() != "ERROR" {
+				t.Fatalf("expected error, got %s", result.Inspect())
+			}
+			if !strings.Contains(result.Inspect(), tt.errorContains) {
+				t.Errorf("expected error containing %q, got %q", tt.errorContains, result.Inspect())
+			}
+		})
+	}
+}
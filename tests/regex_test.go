@@ -1,6 +1,7 @@
 package main
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/sambeau/parsley/pkg/evaluator"
@@ -29,12 +30,12 @@ func TestRegexMatch(t *testing.T) {
 		input    string
 		expected string
 	}{
-		{`"hello 123" ~ /\d+/`, `["123"]`},
+		{`("hello 123" ~ /\d+/).toArray()`, `["123"]`},
 		{`"no numbers" ~ /\d+/`, `null`},
-		{`"user@example.com" ~ /(\w+)@([\w.]+)/`, `["user@example.com", "user", "example.com"]`},
-		{`"2024-01-15" ~ /(\d+)-(\d+)-(\d+)/`, `["2024-01-15", "2024", "01", "15"]`},
-		{`"Test" ~ /test/`, `null`},      // case-sensitive
-		{`"Test" ~ /test/i`, `["Test"]`}, // case-insensitive with flag
+		{`("user@example.com" ~ /(\w+)@([\w.]+)/).toArray()`, `["user@example.com", "user", "example.com"]`},
+		{`("2024-01-15" ~ /(\d+)-(\d+)-(\d+)/).toArray()`, `["2024-01-15", "2024", "01", "15"]`},
+		{`"Test" ~ /test/`, `null`},                  // case-sensitive
+		{`("Test" ~ /test/i).toArray()`, `["Test"]`}, // case-insensitive with flag
 	}
 
 	for _, tt := range tests {
@@ -91,7 +92,7 @@ func TestRegexBuiltin(t *testing.T) {
 	}{
 		{`let rx = regex("\\d+"); rx.pattern`, `"\d+"`},
 		{`let rx = regex("test", "i"); rx.flags`, `"i"`},
-		{`let rx = regex("\\w+"); "hello" ~ rx`, `["hello"]`},
+		{`let rx = regex("\\w+"); ("hello" ~ rx).toArray()`, `["hello"]`},
 	}
 
 	for _, tt := range tests {
@@ -140,11 +141,11 @@ func TestRegexFlags(t *testing.T) {
 		expected string
 	}{
 		// Case-insensitive flag
-		{`"Hello" ~ /hello/i`, `["Hello"]`},
+		{`("Hello" ~ /hello/i).toArray()`, `["Hello"]`},
 		{`"Hello" ~ /hello/`, `null`},
 
 		// Multi-line flag - test simpler pattern
-		{`"test" ~ /test/m`, `["test"]`},
+		{`("test" ~ /test/m).toArray()`, `["test"]`},
 	}
 
 	for _, tt := range tests {
@@ -183,14 +184,14 @@ func TestRegexComplexPatterns(t *testing.T) {
 		expected string
 	}{
 		// Email validation
-		{`"valid@email.com" ~ /^[\w.+-]+@[\w.-]+\.[a-zA-Z]{2,}$/`, `["valid@email.com"]`},
+		{`("valid@email.com" ~ /^[\w.+-]+@[\w.-]+\.[a-zA-Z]{2,}$/).toArray()`, `["valid@email.com"]`},
 		{`"invalid@" ~ /^[\w.+-]+@[\w.-]+\.[a-zA-Z]{2,}$/`, `null`},
 
 		// URL parsing
-		{`"https://example.com" ~ /^(https?):\/\/([^\/]+)/`, `["https://example.com", "https", "example.com"]`},
+		{`("https://example.com" ~ /^(https?):\/\/([^\/]+)/).toArray()`, `["https://example.com", "https", "example.com"]`},
 
 		// Phone number
-		{`"(123) 456-7890" ~ /\((\d{3})\) (\d{3})-(\d{4})/`, `["(123) 456-7890", "123", "456", "7890"]`},
+		{`("(123) 456-7890" ~ /\((\d{3})\) (\d{3})-(\d{4})/).toArray()`, `["(123) 456-7890", "123", "456", "7890"]`},
 	}
 
 	for _, tt := range tests {
@@ -240,3 +241,143 @@ func testExpectedObject(t *testing.T, input string, obj evaluator.Object, expect
 		t.Errorf("For input '%s': expected %s, got %s", input, expected, actual)
 	}
 }
+
+func TestRegexVerboseFlag(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`("2024-01-15" ~ /(\d{4}) - (\d{2})  # year and month/x).toArray()`, `["2024-01", "2024", "01"]`},
+		{`("a b" ~ /a\ b/x).toArray()`, `["a b"]`},
+		{`("a#b" ~ /a [#] b/x).toArray()`, `["a#b"]`},
+		{`("a#b" ~ /a \# b/x).toArray()`, `["a#b"]`},
+		{`("AB" ~ /a b/xi).toArray()`, `["AB"]`},
+		{`("ab" ~ regex("a  # first\n b  # second", "x")).toArray()`, `["ab"]`},
+
+		// Verbose literals can span lines
+		{`let date = /
+    (\d{4})   # year
+    -
+    (\d{2})   # month
+/x
+let m = "on 2024-01" ~ date
+m.toArray()`, `["2024-01", "2024", "01"]`},
+
+		// Without x, whitespace is part of the pattern
+		{`"ab" ~ /a b/`, `null`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalHelper(tt.input)
+		testExpectedObject(t, tt.input, evaluated, tt.expected)
+	}
+}
+
+func TestRegexMatchMethods(t *testing.T) {
+	date := `let date = /(?P<year>\d{4})-(?P<month>\d{2})(?:-(?P<day>\d{2}))?/; `
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{date + `date.match("due 2024-01-15").match`, `"2024-01-15"`},
+		{date + `date.match("due 2024-01-15").start`, `4`},
+		{date + `date.match("due 2024-01-15").captures`, `["2024", "01", "15"]`},
+		{date + `date.match("due 2024-01-15").groups.month`, `"01"`},
+		{date + `date.match("due 2024-01").groups.day`, `null`},
+		{date + `date.match("no date")`, `null`},
+		{`/(\w)/.match("ab").groups.keys()`, `[]`},
+		{`/b/.match("ébb").start`, `1`},
+
+		{date + `date.matchAll("2024-01-15, 1999-12").map(fn(m) { m.start })`, `[0, 12]`},
+		{date + `date.matchAll("2024-01-15, 1999-12").map(fn(m) { m.groups.year })`, `["2024", "1999"]`},
+		{date + `date.matchAll("none").length()`, `0`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalHelper(tt.input)
+		testExpectedObject(t, tt.input, evaluated, tt.expected)
+	}
+}
+
+func TestReplaceWithFunction(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`replace("a1b22c333", /\d+/, fn(m) { m.match.length() })`, `"a1b2c3"`},
+		{`replace("John Smith", /(\w+) (\w+)/, fn(m) { m.captures[1] + ", " + m.captures[0] })`, `"Smith, John"`},
+		{`replace("2024-01", /(?P<y>\d+)-(?P<m>\d+)/, fn(m) { m.groups.m + "/" + m.groups.y })`, `"01/2024"`},
+		{`replace("x", /\d/, fn(m) { "never" })`, `"x"`},
+		{`replace("John Smith", /(?P<first>\w+) (?P<last>\w+)/, "${last}, ${first}")`, `"Smith, John"`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalHelper(tt.input)
+		testExpectedObject(t, tt.input, evaluated, tt.expected)
+	}
+
+	errTests := []struct {
+		input       string
+		expectedErr string
+	}{
+		{`replace("a1", /\d/, 1)`, "must be a string or function"},
+		{`replace("a1", /\d/, fn(m) { m.match - "x" })`, "unknown operator"},
+		{`/a/.match(1)`, "argument to `match` must be a string"},
+	}
+
+	for _, tt := range errTests {
+		evaluated := testEvalHelper(tt.input)
+		errObj, ok := evaluated.(*evaluator.Error)
+		if !ok {
+			t.Errorf("Expected error for input '%s', got %s", tt.input, evaluated.Inspect())
+			continue
+		}
+		if !strings.Contains(errObj.Message, tt.expectedErr) {
+			t.Errorf("For input '%s': expected error containing %q, got %q", tt.input, tt.expectedErr, errObj.Message)
+		}
+	}
+}
+
+func TestRegexMatchObject(t *testing.T) {
+	m := `let m = "due 2024-01-15!" ~ /(?P<year>\d{4})-(\d{2})/; `
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{m + `m.match`, `"2024-01"`},
+		{m + `m.start`, `4`},
+		{m + `m.end`, `11`},
+		{m + `m.before`, `"due "`},
+		{m + `m.after`, `"-15!"`},
+		{m + `m.captures`, `["2024", "01"]`},
+		{m + `m.groups.year`, `"2024"`},
+		{m + `typeOf(m)`, `"match"`},
+		{`let m = "héllo" ~ /l+/; [m.start, m.end]`, `[2, 4]`},
+		{`let m = "xay" ~ /a/; m.before + "[" + m.match + "]" + m.after`, `"x[a]y"`},
+
+		// Matches index, destructure and iterate like [match, ...captures]
+		{m + `m[0]`, `"2024-01"`},
+		{m + `m[1]`, `"2024"`},
+		{m + `m[-1]`, `"01"`},
+		{m + `len(m)`, `3`},
+		{m + `let [full, year, month] = m; year + "/" + month`, `"2024/01"`},
+		{m + `for (x in m) { x.length() }`, `[7, 4, 2]`},
+		{m + `m.toArray()`, `["2024-01", "2024", "01"]`},
+
+		// In strings, a match is the text it matched
+		{m + "`[{m}]`", `"[2024-01]"`},
+		{m + `"got " + m`, `"got 2024-01"`},
+
+		// Truthiness is unchanged: a match object, or null
+		{`if ("abc" ~ /b/) { "yes" } else { "no" }`, `"yes"`},
+		{`if ("abc" ~ /z/) { "yes" } else { "no" }`, `"no"`},
+		{`"abc" !~ /b/`, `false`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalHelper(tt.input)
+		testExpectedObject(t, tt.input, evaluated, tt.expected)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+	"github.com/sambeau/parsley/pkg/lexer"
+	"github.com/sambeau/parsley/pkg/parser"
+)
+
+// evalWithLockFile evaluates code that may import remote modules, recording
+// their hashes in lockFile
+func evalWithLockFile(t *testing.T, code, lockFile string) evaluator.Object {
+	t.Helper()
+	env := evaluator.NewEnvironment()
+	env.Filename = filepath.Join(filepath.Dir(lockFile), "main.pars")
+	env.LockFile = lockFile
+	env.Security = &evaluator.SecurityPolicy{AllowExecuteAll: true}
+	p := parser.New(lexer.New(code))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("Parse errors: %v", p.Errors())
+	}
+	return evaluator.Eval(program, env)
+}
+
+func TestRemoteModules(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	var mu sync.Mutex
+	files := map[string]string{
+		"/lib/strings.pars": "let {double} = import(@./util.pars)\nexport shout = fn(s) { double(s.toUpper()) }\n",
+		"/lib/util.pars":    "export double = fn(s) { s + s }\n",
+		"/lib/site.json":    `{"title": "Remote"}`,
+	}
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests[r.URL.Path]++
+		body, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	lockFile := filepath.Join(dir, evaluator.LockFileName)
+
+	code := `import {shout} from @` + server.URL + `/lib/strings.pars
+let {title} = import("` + server.URL + `/lib/site.json");
+[shout("hi"), title]`
+	if result := evalWithLockFile(t, code, lockFile); result.Inspect() != "[HIHI, Remote]" {
+		t.Fatalf("expected [HIHI, Remote], got %s", result.Inspect())
+	}
+
+	// Every module is locked, including the one imported relatively
+	sums, err := evaluator.ReadLockFile(lockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sums) != 3 || !strings.HasPrefix(sums[server.URL+"/lib/util.pars"], "sha256:") {
+		t.Errorf("unexpected lock file contents: %v", sums)
+	}
+
+	// The cached copies are used after the first download
+	cacheDir, _ := evaluator.ModuleCacheDir()
+	modules, err := evaluator.DownloadModules([]string{server.URL + "/lib/strings.pars"}, lockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(modules) != 2 || !strings.HasPrefix(modules[0].Path, cacheDir) {
+		t.Errorf("unexpected downloads: %+v", modules)
+	}
+	if requests["/lib/util.pars"] != 1 {
+		t.Errorf("expected util.pars to be downloaded once, got %d requests", requests["/lib/util.pars"])
+	}
+
+	// A module that changes no longer matches the lock file
+	mu.Lock()
+	files["/lib/util.pars"] = "export double = fn(s) { s }\n"
+	mu.Unlock()
+	os.RemoveAll(cacheDir)
+	_, err = evaluator.DownloadModules([]string{server.URL + "/lib/strings.pars"}, lockFile)
+	if err == nil || !strings.Contains(err.Error(), "doesn't match parsley.lock") {
+		t.Errorf("expected a hash mismatch, got %v", err)
+	}
+
+	// So does one that was locked with another hash
+	mu.Lock()
+	files["/lib/extra.pars"] = "export x = 1\n"
+	mu.Unlock()
+	sums, _ = evaluator.ReadLockFile(lockFile)
+	sums[server.URL+"/lib/extra.pars"] = "sha256:" + strings.Repeat("0", 64)
+	if err := evaluator.WriteLockFile(lockFile, sums); err != nil {
+		t.Fatal(err)
+	}
+
+	errTests := []struct {
+		name        string
+		code        string
+		errContains string
+	}{
+		{"missing module", `import(@` + server.URL + `/lib/nope.pars)`, "server returned 404"},
+		{"changed module", `import(@` + server.URL + `/lib/extra.pars)`, "doesn't match parsley.lock"},
+	}
+	for _, tt := range errTests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := evalWithLockFile(t, tt.code, lockFile)
+			if !strings.Contains(result.Inspect(), tt.errContains) {
+				t.Errorf("expected error containing %q, got %s", tt.errContains, result.Inspect())
+			}
+		})
+	}
+
+	t.Run("needs execute permission", func(t *testing.T) {
+		env := evaluator.NewEnvironment()
+		env.Security = &evaluator.SecurityPolicy{}
+		p := parser.New(lexer.New(`import(@` + server.URL + `/lib/other.pars)`))
+		result := evaluator.Eval(p.ParseProgram(), env)
+		if !strings.Contains(result.Inspect(), "script execution not allowed") {
+			t.Errorf("expected a security error, got %s", result.Inspect())
+		}
+	})
+}
+
+func TestRemoteImports(t *testing.T) {
+	code := `import {a} from @https://example.com/lib/a.pars
+let b = import(@./b.pars)
+let c = import("https://example.com/c.json")
+let f = fn() { import(@../d.pars) }`
+
+	program := parser.New(lexer.New(code)).ParseProgram()
+	if got := strings.Join(evaluator.RemoteImports(program, ""), " "); got != "https://example.com/lib/a.pars https://example.com/c.json" {
+		t.Errorf("local script: got %s", got)
+	}
+	got := strings.Join(evaluator.RemoteImports(program, "https://example.com/lib/x/main.pars"), " ")
+	want := "https://example.com/lib/a.pars https://example.com/lib/x/b.pars https://example.com/c.json https://example.com/lib/d.pars"
+	if got != want {
+		t.Errorf("remote module: got %s, want %s", got, want)
+	}
+}
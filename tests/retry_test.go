@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"succeeds first time", `retry() { "ok" }`, "ok"},
+		{"retries null", `let n = 0; let v = retry({times: 5, backoff: @0s}) { n = n + 1; if (n == 3) { "done" } }; [v, n]`, "[done, 3]"},
+		{"retries errors", `let n = 0; retry({backoff: @0s}) { n = n + 1; if (n < 3) { 1 / 0 } else { n } }`, "3"},
+		{"try number", `retry({backoff: @0s}, fn(try) { if (try == 2) { try * 10 } })`, "20"},
+		{"function form", `retry(fn() { [] })`, "[]"},
+		{"last falsy value", `let n = 0; let v = retry({times: 4, backoff: @0s}) { n = n + 1; false }; [v, n]`, "[false, 4]"},
+		{"jitter", `retry({times: 2, backoff: @0s, jitter: true}) { 1 }`, "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	start := time.Now()
+	result := testEvalHelper(`let n = 0; retry({times: 2, backoff: @1s}) { n = n + 1; n == 2 }`)
+	if result.Inspect() != "true" {
+		t.Fatalf("expected true, got %s", result.Inspect())
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("expected retry to wait for the backoff, took %s", elapsed)
+	}
+}
+
+func TestRetryErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`retry()`, "wrong number of arguments"},
+		{`retry({times: 2}, 5)`, "must be a block or function"},
+		{`retry({times: 0}) { 1 }`, "`times` option for `retry` must be a positive integer"},
+		{`retry({backoff: 5}) { 1 }`, "`backoff` option for `retry` must be a duration"},
+		{`retry({jitter: "yes"}) { 1 }`, "`jitter` option for `retry` must be a boolean"},
+		{`retry(fn(a, b) { 1 })`, "must take 0 or 1 parameters"},
+		{`retry({times: 3, backoff: @0s}) { 1 / 0 }`, "gave up after 3 tries: division by zero"},
+		{`retry({times: 1}) { 1 / 0 }`, "division by zero"},
+	}
+
+	for _, tt := range tests {
+		result := testEvalHelper(tt.input)
+		errObj, ok := result.(*evaluator.Error)
+		if !ok || !strings.Contains(errObj.Message, tt.expected) {
+			t.Errorf("%s: expected error containing %q, got %s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
@@ -158,6 +158,39 @@ func TestSecurityReadRestricted(t *testing.T) {
 	}
 }
 
+// TestSecurityPolicyInsideFunctions tests that function bodies use the caller's policy
+func TestSecurityPolicyInsideFunctions(t *testing.T) {
+	tempDir := t.TempDir()
+	testFile := filepath.Join(tempDir, "test.txt")
+	os.WriteFile(testFile, []byte("hello"), 0644)
+
+	code := `let readIt = fn() { let content <== text("` + testFile + `"); content }; readIt()`
+
+	env := evaluator.NewEnvironment()
+	env.Security = &evaluator.SecurityPolicy{
+		RestrictRead: []string{tempDir},
+	}
+	env.Filename = "test.pars"
+
+	l := lexer.New(code)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		t.Fatalf("Parse errors: %v", p.Errors())
+	}
+
+	result := evaluator.Eval(program, env)
+
+	errObj, ok := result.(*evaluator.Error)
+	if !ok {
+		t.Fatalf("Expected error, got %s", result.Inspect())
+	}
+	if !strings.Contains(errObj.Message, "file read restricted") {
+		t.Errorf("Expected 'file read restricted' error, got: %s", errObj.Message)
+	}
+}
+
 // TestSecurityNoRead tests no-read policy
 func TestSecurityNoRead(t *testing.T) {
 	// Create temporary directory and file
@@ -331,3 +364,120 @@ func TestSecurityDirListRequiresRead(t *testing.T) {
 		t.Errorf("Expected read-related error, got: %s", errObj.Message)
 	}
 }
+
+// evalWithPolicy evaluates code under a security policy
+func evalWithPolicy(t *testing.T, code string, policy *evaluator.SecurityPolicy) evaluator.Object {
+	t.Helper()
+	env := evaluator.NewEnvironment()
+	env.Security = policy
+	env.Filename = "test.pars"
+
+	p := parser.New(lexer.New(code))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("Parse errors: %v", p.Errors())
+	}
+	return evaluator.Eval(program, env)
+}
+
+// TestSecurityTraversal tests that .. and symlinks can't escape the policy
+func TestSecurityTraversal(t *testing.T) {
+	allowed := filepath.Join(t.TempDir(), "allowed")
+	outside := t.TempDir()
+	os.Mkdir(allowed, 0755)
+	if err := os.Symlink(outside, filepath.Join(allowed, "link")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	secret := filepath.Join(outside, "secret.txt")
+	os.WriteFile(secret, []byte("secret"), 0644)
+	os.Symlink(filepath.Join(outside, "planted.txt"), filepath.Join(allowed, "dangling.txt"))
+	os.Symlink("../../"+filepath.Base(outside)+"/planted.txt", filepath.Join(allowed, "relative.txt"))
+	os.Symlink("dangling.txt", filepath.Join(allowed, "chained.txt"))
+
+	tests := []struct {
+		name     string
+		code     string
+		policy   *evaluator.SecurityPolicy
+		expected string
+	}{
+		{
+			name:     "write with ..",
+			code:     `"x" ==> text("` + allowed + `/../escaped.txt")`,
+			policy:   &evaluator.SecurityPolicy{AllowWrite: []string{allowed}},
+			expected: "file write not allowed",
+		},
+		{
+			name:     "write through symlink",
+			code:     `"x" ==> text("` + allowed + `/link/escaped.txt")`,
+			policy:   &evaluator.SecurityPolicy{AllowWrite: []string{allowed}},
+			expected: "file write not allowed",
+		},
+		{
+			name:     "write through dangling symlink",
+			code:     `"x" ==> text("` + allowed + `/dangling.txt")`,
+			policy:   &evaluator.SecurityPolicy{AllowWrite: []string{allowed}},
+			expected: "file write not allowed",
+		},
+		{
+			name:     "write through relative dangling symlink",
+			code:     `"x" ==> text("` + allowed + `/relative.txt")`,
+			policy:   &evaluator.SecurityPolicy{AllowWrite: []string{allowed}},
+			expected: "file write not allowed",
+		},
+		{
+			name:     "write through chained dangling symlinks",
+			code:     `"x" ==> text("` + allowed + `/chained.txt")`,
+			policy:   &evaluator.SecurityPolicy{AllowWrite: []string{allowed}},
+			expected: "file write not allowed",
+		},
+		{
+			name:     "read restricted file through symlink",
+			code:     `let s <== text("` + allowed + `/link/secret.txt"); s`,
+			policy:   &evaluator.SecurityPolicy{RestrictRead: []string{outside}},
+			expected: "file read restricted",
+		},
+		{
+			name:     "restricted symlink",
+			code:     `let s <== text("` + secret + `"); s`,
+			policy:   &evaluator.SecurityPolicy{RestrictRead: []string{filepath.Join(allowed, "link")}},
+			expected: "file read restricted",
+		},
+		{
+			name:     "SFTP key file",
+			code:     `SFTP("sftp://deploy@localhost", {keyFile: "` + secret + `"})`,
+			policy:   &evaluator.SecurityPolicy{RestrictRead: []string{outside}},
+			expected: "file read restricted",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := evalWithPolicy(t, tt.code, tt.policy)
+			errObj, ok := result.(*evaluator.Error)
+			if !ok || !strings.Contains(errObj.Message, tt.expected) {
+				t.Errorf("expected error containing %q, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+
+	for _, name := range []string{"escaped.txt", "planted.txt"} {
+		if _, err := os.Stat(filepath.Join(outside, name)); err == nil {
+			t.Errorf("write of %s escaped the allowed directory", name)
+		}
+	}
+}
+
+// TestSecurityWriteThroughSymlinkedRoot tests that an allowed directory
+// reached through a symlink can still be written
+func TestSecurityWriteThroughSymlinkedRoot(t *testing.T) {
+	real := t.TempDir()
+	link := filepath.Join(t.TempDir(), "site")
+	if err := os.Symlink(real, link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	result := evalWithPolicy(t, `"hello" ==> text("`+real+`/index.html")`, &evaluator.SecurityPolicy{AllowWrite: []string{link}})
+	if errObj, ok := result.(*evaluator.Error); ok {
+		t.Fatalf("Unexpected error: %s", errObj.Message)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+func TestSEO(t *testing.T) {
+	result := testEvalHelper(`seo({
+    title: "Ben & Jerry's <Blog>",
+    description: "Say \"hi\"",
+    image: "/img/cover.png",
+    imageAlt: "A cover",
+    url: "https://example.com/posts/hello",
+    type: "article",
+    siteName: "Example",
+    locale: "en-GB",
+    twitter: "example"
+})`)
+	if result.Type() == evaluator.ERROR_OBJ {
+		t.Fatalf("Evaluation error: %s", result.Inspect())
+	}
+	expected := strings.Join([]string{
+		`<title>Ben &amp; Jerry&#39;s &lt;Blog&gt;</title>`,
+		`<meta name="description" content="Say &#34;hi&#34;" />`,
+		`<link rel="canonical" href="https://example.com/posts/hello" />`,
+		`<meta property="og:title" content="Ben &amp; Jerry&#39;s &lt;Blog&gt;" />`,
+		`<meta property="og:description" content="Say &#34;hi&#34;" />`,
+		`<meta property="og:type" content="article" />`,
+		`<meta property="og:url" content="https://example.com/posts/hello" />`,
+		`<meta property="og:image" content="https://example.com/img/cover.png" />`,
+		`<meta property="og:image:alt" content="A cover" />`,
+		`<meta property="og:site_name" content="Example" />`,
+		`<meta property="og:locale" content="en_GB" />`,
+		`<meta name="twitter:card" content="summary_large_image" />`,
+		`<meta name="twitter:site" content="@example" />`,
+		`<meta name="twitter:title" content="Ben &amp; Jerry&#39;s &lt;Blog&gt;" />`,
+		`<meta name="twitter:description" content="Say &#34;hi&#34;" />`,
+		`<meta name="twitter:image" content="https://example.com/img/cover.png" />`,
+		`<meta name="twitter:image:alt" content="A cover" />`,
+	}, "\n")
+	if result.Inspect() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, result.Inspect())
+	}
+}
+
+func TestSEOFallbacks(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// Only the tags that have content
+		{`seo({title: "Home"})`, strings.Join([]string{
+			`<title>Home</title>`,
+			`<meta property="og:title" content="Home" />`,
+			`<meta property="og:type" content="website" />`,
+			`<meta name="twitter:card" content="summary" />`,
+			`<meta name="twitter:title" content="Home" />`,
+		}, "\n")},
+
+		// The site name stands in for a missing title
+		{`seo({siteName: "Example", description: null}).split("\n")[0]`, "<title>Example</title>"},
+
+		// Absolute images and URL values are used as they are
+		{`seo({title: "T", image: "https://cdn.example.com/a.png", url: "https://example.com/"}).contains("content=\"https://cdn.example.com/a.png\"")`, "true"},
+		{`seo({title: "T", url: @https://example.com/about}).contains("href=\"https://example.com/about\"")`, "true"},
+		{`seo({title: "T", twitter: "@handle"}).contains("content=\"@handle\"")`, "true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Type() == evaluator.ERROR_OBJ {
+				t.Fatalf("Evaluation error: %s", result.Inspect())
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestJSONLD(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`jsonld({type: "Article", headline: "Hi", author: {type: "Person", name: "Ann"}})`,
+			`<script type="application/ld+json">{"@context":"https://schema.org","@type":"Article","author":{"@type":"Person","name":"Ann"},"headline":"Hi"}</script>`},
+
+		// An explicit context and ids
+		{`jsonld({context: "https://schema.org/", type: "Thing", id: "#main"})`,
+			`<script type="application/ld+json">{"@context":"https://schema.org/","@id":"#main","@type":"Thing"}</script>`},
+
+		// Arrays, typed values, and text that would otherwise end the script
+		{`jsonld({type: "Event", startDate: @2024-03-15, tags: [{type: "Tag", name: "</script>"}]})`,
+			`<script type="application/ld+json">{"@context":"https://schema.org","@type":"Event","startDate":"2024-03-15","tags":[{"@type":"Tag","name":"\u003c/script\u003e"}]}</script>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Type() == evaluator.ERROR_OBJ {
+				t.Fatalf("Evaluation error: %s", result.Inspect())
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestSEOErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		errorContains string
+	}{
+		{`seo()`, "wrong number of arguments to `seo`"},
+		{`seo("title")`, "argument to `seo` must be a dictionary"},
+		{`seo({title: "T", author: "Ann"})`, "unknown option \"author\" for `seo`"},
+		{`seo({description: "No title"})`, "`seo` needs a `title` or `siteName`"},
+		{`jsonld([1])`, "argument to `jsonld` must be a dictionary"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Type() != evaluator.ERROR_OBJ {
+				t.Fatalf("expected error, got %s", result.Inspect())
+			}
+			if !strings.Contains(result.Inspect(), tt.errorContains) {
+				t.Errorf("expected error containing %q, got %q", tt.errorContains, result.Inspect())
+			}
+		})
+	}
+}
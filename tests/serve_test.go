@@ -0,0 +1,176 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+	"github.com/sambeau/parsley/pkg/lexer"
+	"github.com/sambeau/parsley/pkg/parser"
+)
+
+// startServeTest serves the handler a script returns on a test server
+func startServeTest(t *testing.T, input string) *httptest.Server {
+	t.Helper()
+	env := evaluator.NewEnvironment()
+	handlerFn := evaluator.Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+	handler, err := evaluator.ServeHandler(handlerFn, env)
+	if err != nil {
+		t.Fatalf("ServeHandler: %v", err)
+	}
+	log := evaluator.ServeLog
+	evaluator.ServeLog = io.Discard
+	server := httptest.NewServer(handler)
+	t.Cleanup(func() {
+		server.Close()
+		evaluator.ServeLog = log
+	})
+	return server
+}
+
+func TestServeHandler(t *testing.T) {
+	server := startServeTest(t, `
+		let Page = fn({title}) { <h1>{title}</h1> }
+		fn(req) {
+			if (req.path == "/") { <Page title={"Hello, " + (req.query.name ?? "world")}/> }
+			else if (req.path == "/echo") { {method: req.method, body: req.body, type: req.headers["content-type"], tags: req.query.tag} }
+			else if (req.path == "/old") { {status: 301, headers: {location: "/"}} }
+			else if (req.path == "/teapot") { {status: 418, body: "short and stout"} }
+			else if (req.path == "/fail") { 1 + "x" - 2 }
+		}
+	`)
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	tests := []struct {
+		method      string
+		path        string
+		body        string
+		status      int
+		contentType string
+		expected    string
+	}{
+		{"GET", "/?name=Ada", "", 200, "text/html; charset=utf-8", "<h1>Hello, Ada</h1>"},
+		{"POST", "/echo?tag=a&tag=b", "x=1", 200, "application/json", `"body": "x=1"`},
+		{"POST", "/echo", "", 200, "application/json", `"method": "POST"`},
+		{"POST", "/echo?tag=a&tag=b", "x=1", 200, "application/json", `"tags": [`},
+		{"POST", "/echo", "{}", 200, "application/json", `"type": "text/plain"`},
+		{"GET", "/old", "", 301, "", ""},
+		{"GET", "/teapot", "", 418, "text/html; charset=utf-8", "short and stout"},
+		{"GET", "/missing", "", 404, "text/plain; charset=utf-8", "Not Found"},
+		{"GET", "/fail", "", 500, "text/plain; charset=utf-8", "Internal Server Error"},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, server.URL+tt.path, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "text/plain")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", tt.method, tt.path, err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.path, tt.status, resp.StatusCode)
+		}
+		if got := resp.Header.Get("Content-Type"); got != tt.contentType {
+			t.Errorf("%s %s: expected content type %q, got %q", tt.method, tt.path, tt.contentType, got)
+		}
+		if !strings.Contains(string(data), tt.expected) {
+			t.Errorf("%s %s: expected body containing %q, got %q", tt.method, tt.path, tt.expected, data)
+		}
+	}
+
+	resp, err := client.Get(server.URL + "/old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("Location") != "/" {
+		t.Errorf("expected the location header to be set, got %q", resp.Header.Get("Location"))
+	}
+}
+
+func TestServeHandlerWithoutRequest(t *testing.T) {
+	server := startServeTest(t, `let hits = 0; fn() { hits = hits + 1; "hit " + hits }`)
+	for _, expected := range []string{"hit 1", "hit 2"} {
+		resp, err := http.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(data) != expected {
+			t.Errorf("expected %q, got %q", expected, data)
+		}
+	}
+}
+
+func TestServeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`serve()`, "wrong number of arguments"},
+		{`serve(5)`, "must be a function"},
+		{`serve(fn(a, b) { a })`, "must take 0 or 1 parameters"},
+		{`serve(fn(req) { req }, {port: 0})`, "must be a port number"},
+		{`serve(fn(req) { req }, {host: 5})`, "must be a string"},
+	}
+
+	for _, tt := range tests {
+		result := testEvalHelper(tt.input)
+		errObj, ok := result.(*evaluator.Error)
+		if !ok || !strings.Contains(errObj.Message, tt.expected) {
+			t.Errorf("%s: expected error containing %q, got %s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	if _, err := evaluator.ServeHandler(&evaluator.String{Value: "x"}, evaluator.NewEnvironment()); err == nil {
+		t.Errorf("expected an error for a handler that isn't a function")
+	}
+}
+
+func TestServeEscapesRequestValues(t *testing.T) {
+	server := startServeTest(t, `
+		let Page = fn({title}) { <h1>{title}</h1> }
+		fn(req) {
+			let name = req.query.name
+			if (req.path == "/tag") { <p>{name}</p> }
+			else if (req.path == "/attr") { <a title="{name}">link</a> }
+			else if (req.path == "/component") { <Page title={"Hello, " + name}/> }
+			else if (req.path == "/method") { <p>{name.toUpper()}</p> }
+			else if (req.path == "/split") { <ul>{for (n in name.split(",")) { <li>{n}</li> }}</ul> }
+			else if (req.path == "/raw") { <p>{name.raw()}</p> }
+			else if (req.path == "/string") { name }
+		}
+	`)
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/tag?name=<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>"},
+		{`/attr?name="><b>`, `<a title="&#34;&gt;&lt;b&gt;">link</a>`},
+		{"/component?name=<b>", "<h1>Hello, &lt;b&gt;</h1>"},
+		{"/method?name=<b>", "<p>&lt;B&gt;</p>"},
+		{"/split?name=<b>,<i>", "<ul><li>&lt;b&gt;</li><li>&lt;i&gt;</li></ul>"},
+		{"/raw?name=<b>", "<p><b></p>"},
+		{"/string?name=<b>", "&lt;b&gt;"},
+	}
+
+	for _, tt := range tests {
+		resp, err := http.Get(server.URL + strings.ReplaceAll(strings.ReplaceAll(tt.path, "<", "%3C"), ">", "%3E"))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.path, err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(data) != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.path, tt.expected, data)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+func TestSharedValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"counter", `let c = counter(); c.add(); c.add(5); c.value()`, "6"},
+		{"counter start", `let c = counter(10); c.add(-3)`, "7"},
+		{"collector", `let c = collector(); c.push(1); c.push("a"); [c.toArray(), c.length()]`, `[[1, a], 2]`},
+		{"push returns null", `collector().push(1)`, "null"},
+		{"atomicDict get", `let d = atomicDict({a: 1}); [d.get("a"), d.get("b"), d.get("b", 0)]`, "[1, null, 0]"},
+		{"atomicDict set", `let d = atomicDict(); d.set("b", 2); d.set("a", [1]); [d.keys(), d.size(), d.has("a"), d.has("c")]`, "[[a, b], 2, true, false]"},
+		{"atomicDict add", `let d = atomicDict(); d.add("x"); d.add("x", 4)`, "5"},
+		{"atomicDict update", `let d = atomicDict(); d.update("l", fn(l) { l ++ ["a"] }, []); d.update("l", fn(l) { l ++ ["b"] })`, "[a, b]"},
+		{"atomicDict toDict", `let d = atomicDict(); d.set("n", 1); d.toDict().n`, "1"},
+		{"typeOf", `[typeOf(counter()), typeOf(collector()), typeOf(atomicDict())]`, "[counter, collector, atomicDict]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestSharedValuesInParallel(t *testing.T) {
+	result := testEvalHelper(`
+		let total = counter()
+		let multiples = collector()
+		let tally = atomicDict()
+		parallel(1..500, fn(i) {
+			total.add(i)
+			if (i % 100 == 0) { multiples.push(i) }
+			tally.add(if (i % 2 == 0) { "even" } else { "odd" })
+			tally.update("seen", fn(n) { n + 1 }, 0)
+			null
+		}, {concurrency: 8});
+		[total.value(), sort(multiples.toArray()), tally.get("even"), tally.get("odd"), tally.get("seen")]
+	`)
+	if result.Inspect() != "[125250, [100, 200, 300, 400, 500], 250, 250, 500]" {
+		t.Errorf("expected no updates to be lost, got %s", result.Inspect())
+	}
+}
+
+func TestSharedValuesErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`counter("a")`, "must be an integer"},
+		{`counter(1, 2)`, "wrong number of arguments"},
+		{`counter().add(1.5)`, "must be an integer"},
+		{`counter().reset()`, "unknown method 'reset' for counter"},
+		{`collector(1)`, "wrong number of arguments"},
+		{`collector().push()`, "wrong number of arguments"},
+		{`atomicDict([1])`, "must be a dictionary"},
+		{`atomicDict().get(1)`, "must be a string"},
+		{`let d = atomicDict({a: "x"}); d.add("a")`, "not an integer"},
+		{`atomicDict().update("a", fn(a, b) { a })`, "must take 1 parameter"},
+		{`atomicDict().update("a", fn(a) { a / 0 }, 1)`, "division by zero"},
+	}
+
+	for _, tt := range tests {
+		result := testEvalHelper(tt.input)
+		errObj, ok := result.(*evaluator.Error)
+		if !ok || !strings.Contains(errObj.Message, tt.expected) {
+			t.Errorf("%s: expected error containing %q, got %s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
@@ -150,18 +150,14 @@ func TestSlicingInExpressions(t *testing.T) {
 			}
 
 			env := evaluator.NewEnvironment()
-			var result evaluator.Object
-
-			for _, stmt := range program.Statements {
-				result = evaluator.Eval(stmt, env)
-				if result.Type() == evaluator.ERROR_OBJ {
-					t.Fatalf("Evaluation error: %s", result.Inspect())
-				}
-			}
+			result := evaluator.Eval(program, env)
 
 			if result == nil {
 				t.Fatalf("Eval returned nil")
 			}
+			if result.Type() == evaluator.ERROR_OBJ {
+				t.Fatalf("Evaluation error: %s", result.Inspect())
+			}
 
 			if result.Inspect() != tt.expected {
 				t.Errorf("Expected %q, got %q", tt.expected, result.Inspect())
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "parsley_snapshot_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := func(name string) string {
+		return `"` + filepath.Join(tmpDir, name) + `"`
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		expected string
+	}{
+		{
+			name:     "missing snapshot runs the source",
+			code:     `snapshot(fn() { [1, 2] }, ` + path("fresh.json") + `)`,
+			expected: "[1, 2]",
+		},
+		{
+			name:     "existing snapshot is read",
+			code:     `let _ = snapshot(fn() { [1, 2] }, ` + path("cached.json") + `); snapshot(fn() { [3] }, ` + path("cached.json") + `)`,
+			expected: "[1, 2]",
+		},
+		{
+			name:     "snapshot within ttl",
+			code:     `let _ = snapshot(fn() { [1] }, ` + path("ttl.json") + `); snapshot(fn() { [2] }, ` + path("ttl.json") + `, {ttl: @1h})`,
+			expected: "[1]",
+		},
+		{
+			name:     "stale snapshot runs the source",
+			code:     `let _ = snapshot(fn() { [1] }, ` + path("stale.json") + `); snapshot(fn() { [2] }, ` + path("stale.json") + `, {ttl: @0s})`,
+			expected: "[2]",
+		},
+		{
+			name:     "refresh",
+			code:     `let _ = snapshot(fn() { [1] }, ` + path("refresh.json") + `); snapshot(fn() { [2] }, ` + path("refresh.json") + `, {refresh: true})`,
+			expected: "[2]",
+		},
+		{
+			name:     "failing source uses the old snapshot",
+			code:     `let _ = snapshot(fn() { [1] }, ` + path("offline.json") + `); snapshot(fn() { undefinedThing }, ` + path("offline.json") + `, {refresh: true})`,
+			expected: "[1]",
+		},
+		{
+			name:     "failing source without a snapshot",
+			code:     `snapshot(fn() { undefinedThing }, ` + path("none.json") + `)`,
+			expected: "identifier not found: undefinedThing",
+		},
+		{
+			name:     "typed values are revived",
+			code:     `let _ = snapshot(fn() { [@2024-03-05] }, ` + path("dates.json") + `); snapshot(fn() { [] }, ` + path("dates.json") + `)[0].year`,
+			expected: "2024",
+		},
+		{
+			name:     "directories are created",
+			code:     `snapshot(fn() { "ok" }, ` + path("data/nested/value.json") + `)`,
+			expected: "ok",
+		},
+		{
+			name: "query",
+			code: `let db = SQLITE(":memory:")
+let _ = db <=!=> "DROP TABLE IF EXISTS snap_items"
+let _ = db <=!=> "CREATE TABLE snap_items (id INTEGER PRIMARY KEY, name TEXT)"
+let _ = db <=!=> "INSERT INTO snap_items (name) VALUES ('a'), ('b')"
+snapshot(db.table("snap_items").orderBy("id"), ` + path("items.json") + `).map(fn(r) { r.name })`,
+			expected: "[a, b]",
+		},
+		{
+			name:     "user-defined snapshot is not overridden",
+			code:     `let snapshot = fn(a, b) { "mine" }; snapshot(1, 2)`,
+			expected: "mine",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalWriteOp(tt.code)
+			if !strings.Contains(result.Inspect(), tt.expected) {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+
+	data, err := os.ReadFile(filepath.Join(tmpDir, "fresh.json"))
+	if err != nil {
+		t.Fatalf("snapshot file not written: %v", err)
+	}
+	if strings.Join(strings.Fields(string(data)), "") != "[1,2]" {
+		t.Errorf("unexpected snapshot contents %q", string(data))
+	}
+}
+
+func TestSnapshotErrors(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "parsley_snapshot_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := `"` + filepath.Join(tmpDir, "data.json") + `"`
+
+	tests := []struct {
+		code          string
+		errorContains string
+	}{
+		{`snapshot(42, ` + path + `)`, "first argument to `snapshot` must be a query, request or function"},
+		{`snapshot(fn() { 1 }, 42)`, "second argument to `snapshot` must be a path or string"},
+		{`snapshot(fn() { 1 }, ` + path + `, {ttl: 60})`, "`ttl` option for snapshot() must be a duration"},
+		{`snapshot(fn() { 1 }, ` + path + `, {cache: true})`, "unknown option \"cache\" for snapshot()"},
+		{`snapshot(fn() { 1 })`, "wrong number of arguments to `snapshot`"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			result := testEvalWriteOp(tt.code)
+			if !strings.Contains(result.Inspect(), tt.errorContains) {
+				t.Errorf("expected error containing %q, got %q", tt.errorContains, result.Inspect())
+			}
+		})
+	}
+}
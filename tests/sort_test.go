@@ -0,0 +1,211 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSortOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		expected string
+	}{
+		{
+			name:     "default natural sort unchanged",
+			code:     `sort(["file10", "file2", "file1"])`,
+			expected: "[file1, file2, file10]",
+		},
+		{
+			name:     "descending",
+			code:     `sort([3, 1, 2], {desc: true})`,
+			expected: "[3, 2, 1]",
+		},
+		{
+			name:     "key function",
+			code:     `sort(["ccc", "a", "bb"], {key: fn(s) { len(s) }})`,
+			expected: "[a, bb, ccc]",
+		},
+		{
+			name:     "key function over dictionaries",
+			code:     `let people = [{name: "Bo", age: 40}, {name: "Al", age: 30}]; sort(people, {key: fn(p) { p.age }}).map(fn(p) { p.name })`,
+			expected: "[Al, Bo]",
+		},
+		{
+			name:     "natural disabled",
+			code:     `sort(["file10", "file2"], {natural: false})`,
+			expected: "[file10, file2]",
+		},
+		{
+			name:     "code point order without locale",
+			code:     `sort(["Äpple", "apa", "Bil"], {})`,
+			expected: "[Bil, apa, Äpple]",
+		},
+		{
+			name:     "english collation",
+			code:     `sort(["Äpple", "apa", "Bil"], {locale: "en"})`,
+			expected: "[apa, Äpple, Bil]",
+		},
+		{
+			name:     "swedish collation sorts ä after z",
+			code:     `sort(["ägg", "zebra", "apa"], {locale: "sv"})`,
+			expected: "[apa, zebra, ägg]",
+		},
+		{
+			name:     "german collation sorts ä with a",
+			code:     `sort(["ägg", "zebra", "apa"], {locale: "de"})`,
+			expected: "[ägg, apa, zebra]",
+		},
+		{
+			name:     "collation keeps numeric ordering",
+			code:     `sort(["Chapter 10", "Chapter 9"], {locale: "en"})`,
+			expected: "[Chapter 9, Chapter 10]",
+		},
+		{
+			name:     "descending is stable for equal keys",
+			code:     `sort(["b1", "a2", "b2", "a1"], {key: fn(s) { s[0] }, desc: true})`,
+			expected: "[b1, b2, a2, a1]",
+		},
+		{
+			name:     "method form",
+			code:     `["b", "C", "a"].sort({locale: "en", desc: true})`,
+			expected: "[C, b, a]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestSortOptionErrors(t *testing.T) {
+	tests := []struct {
+		code        string
+		errContains string
+	}{
+		{`sort([1, 2], "desc")`, "must be a dictionary"},
+		{`sort([1, 2], {key: 1})`, "must be a function"},
+		{`sort([1, 2], {key: fn(a, b) { a }})`, "exactly 1 parameter"},
+		{`sort([1, 2], {desc: "yes"})`, "must be a boolean"},
+		{`sort(["a"], {locale: "not a locale!"})`, "invalid locale"},
+		{`sort([1, 2], {key: fn(x) { x.missing }})`, "dot notation"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if !strings.Contains(result.Inspect(), tt.errContains) {
+				t.Errorf("expected error containing %q, got %s", tt.errContains, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestSortByKeys(t *testing.T) {
+	people := `let people = [
+		{first: "Ann", last: "Smith", age: 30},
+		{first: "Bob", last: "Jones", age: 25},
+		{first: "Cat", last: "Smith", age: 41},
+		{first: "Dan", last: "Jones", age: 25}
+	]; `
+
+	tests := []struct {
+		name     string
+		code     string
+		expected string
+	}{
+		{
+			name:     "single field",
+			code:     people + `sortBy(people, "age").map(fn(p) { p.first })`,
+			expected: "[Bob, Dan, Ann, Cat]",
+		},
+		{
+			name:     "descending field",
+			code:     people + `sortBy(people, "-age").map(fn(p) { p.first })`,
+			expected: "[Cat, Ann, Bob, Dan]",
+		},
+		{
+			name:     "multiple fields",
+			code:     people + `sortBy(people, ["last", "-age"]).map(fn(p) { p.first })`,
+			expected: "[Bob, Dan, Cat, Ann]",
+		},
+		{
+			name:     "field and key function",
+			code:     people + `sortBy(people, ["-last", fn(p) { len(p.first) * -1 }, "first"]).map(fn(p) { p.first })`,
+			expected: "[Ann, Cat, Bob, Dan]",
+		},
+		{
+			name:     "descending key function via dictionary",
+			code:     people + `sortBy(people, [{key: fn(p) { p.age }, desc: true}]).map(fn(p) { p.first })`,
+			expected: "[Cat, Ann, Bob, Dan]",
+		},
+		{
+			name:     "stable for equal keys",
+			code:     people + `sortBy(people, "last").map(fn(p) { p.first })`,
+			expected: "[Bob, Dan, Ann, Cat]",
+		},
+		{
+			name:     "key function on scalars",
+			code:     `sortBy(["ccc", "a", "bb"], fn(s) { len(s) })`,
+			expected: "[a, bb, ccc]",
+		},
+		{
+			name:     "natural order for string fields",
+			code:     `sortBy([{f: "img10"}, {f: "img9"}], "f").map(fn(x) { x.f })`,
+			expected: "[img9, img10]",
+		},
+		{
+			name:     "missing fields sort last",
+			code:     `sortBy([{a: 2}, {b: 1}, {a: 1}], "a").map(fn(x) { x.a ?? "none" })`,
+			expected: "[1, 2, none]",
+		},
+		{
+			name:     "method form",
+			code:     people + `people.sortBy(["last", "first"]).map(fn(p) { p.first })`,
+			expected: "[Bob, Dan, Ann, Cat]",
+		},
+		{
+			name:     "legacy comparator still works",
+			code:     `sortBy([5, 2, 8, 1], fn(a, b) { reverse(sort([a, b])) })`,
+			expected: "[8, 5, 2, 1]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestSortByKeyErrors(t *testing.T) {
+	tests := []struct {
+		code        string
+		errContains string
+	}{
+		{`sortBy([1, 2], "age")`, "elements must be dictionaries"},
+		{`sortBy([{a: 1}], [])`, "must not be empty"},
+		{`sortBy([{a: 1}], "-")`, "must not be empty"},
+		{`sortBy([{a: 1}], 42)`, "sort key must be"},
+		{`sortBy([{a: 1}], [["a"]])`, "got ARRAY"},
+		{`sortBy([{a: 1}], {desc: true})`, "must have a `key` field"},
+		{`sortBy([1], fn(a, b, c) { a })`, "exactly 1 parameter"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			result := testEvalHelper(tt.code)
+			if !strings.Contains(result.Inspect(), tt.errContains) {
+				t.Errorf("expected error containing %q, got %s", tt.errContains, result.Inspect())
+			}
+		})
+	}
+}
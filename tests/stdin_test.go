@@ -143,3 +143,36 @@ func TestStdioSeparation(t *testing.T) {
 		t.Errorf("Expected 'stderr message' on stderr, got: %s", stderr)
 	}
 }
+
+func TestBytesToStdout(t *testing.T) {
+	code := `[0, 137, 80, 78, 71, 13, 10, 255] ==> bytes(@stdout)
+let newline = [10]
+newline ==>> bytes(@-)`
+
+	stdout, _ := runWithStdin(t, code, "")
+
+	expected := "\x00\x89PNG\r\n\xff\n"
+	if stdout != expected {
+		t.Errorf("Expected %q on stdout, got: %q", expected, stdout)
+	}
+}
+
+func TestObjectToBytes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`[72, 105, 0, 255]`, "Hi\x00\xff"},
+		{`"no newline"`, "no newline"},
+		{`[1, 256]`, "1256"},
+		{`[]`, ""},
+		{`42`, "42"},
+	}
+
+	for _, tt := range tests {
+		result := testEvalHelper(tt.input)
+		if got := string(evaluator.ObjectToBytes(result)); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+// makeStreamFiles writes the files the stream tests read and returns their
+// directory in forward-slash form
+func makeStreamFiles(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"app.log":    "start\r\nrequest 500\nrequest 200\nend",
+		"ended.txt":  "one\ntwo\n",
+		"orders.csv": "id,country\n1,NZ\n2,UK\n3,NZ\n",
+		"semi.csv":   "# exported\nid;name\n1;Ada\n",
+		"ragged.csv": "a,b\n1,2\n3\n4,5\n",
+		"bom.txt":    "\uFEFFfirst\nsecond",
+		"data.json":  `{"a": 1}`,
+		"broken.csv": "a,b\n\"1,2\n",
+	}
+	for name, content := range files {
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	}
+	return filepath.ToSlash(dir)
+}
+
+func TestStream(t *testing.T) {
+	dir := makeStreamFiles(t)
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"lines", `stream(lines("` + dir + `/app.log")).toArray()`, "[start, request 500, request 200, end]"},
+		{"final newline", `stream(text("` + dir + `/ended.txt")).toArray()`, "[one, two]"},
+		{"string path", `stream("` + dir + `/ended.txt").toArray().length()`, "2"},
+		{"for", `for (line in stream(lines("` + dir + `/app.log"))) { if (line.contains("500")) { line } }`, "[request 500]"},
+		{"take", `stream(lines("` + dir + `/app.log")).take(2).toArray()`, "[start, request 500]"},
+		{"consumed twice", `let s = stream(lines("` + dir + `/ended.txt")); [s.toArray(), s.toArray()]`, "[[one, two], [one, two]]"},
+		{"csv", `stream(CSV("` + dir + `/orders.csv")).filter(fn(o) { o.country == "NZ" }).map(fn(o) { o.id }).toArray()`, "[1, 3]"},
+		{"csv path", `stream("` + dir + `/orders.csv").toArray().length()`, "3"},
+		{"csv without header", `stream(CSV("` + dir + `/orders.csv", {header: false})).take(1).toArray()`, "[[id, country]]"},
+		{"csv options", `stream(CSV("` + dir + `/semi.csv", {delimiter: ";", skipRows: 1})).toArray()[0].name`, "Ada"},
+		{"ragged pad", `stream(CSV("` + dir + `/ragged.csv", {ragged: "pad"})).map(fn(r) { r.a + ":" + r.b }).toArray()`, "[1:2, 3:, 4:5]"},
+		{"ragged skip", `stream(CSV("` + dir + `/ragged.csv", {ragged: "skip"})).map(fn(r) { r.a }).toArray()`, "[1, 4]"},
+		{"strip bom", `stream(lines("` + dir + `/bom.txt", {stripBOM: true})).toArray()[0].length()`, "5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestStreamErrors(t *testing.T) {
+	dir := makeStreamFiles(t)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`stream()`, "wrong number of arguments"},
+		{`stream(5)`, "must be a file handle, path or string"},
+		{`stream(JSON("` + dir + `/data.json"))`, "reads text, lines and CSV files, got format json"},
+		{`stream(CSV("` + dir + `/orders.csv"), {header: false})`, "options for `stream` go on the file handle"},
+		{`stream(CSV("` + dir + `/orders.csv", {report: true}))`, "`report` can't be used with `stream`"},
+		{`stream(CSV("` + dir + `/orders.csv", {delimiter: 5}))`, "must be a single character"},
+		{`stream(lines("` + dir + `/missing.txt")).toArray()`, "failed to read file"},
+		{`stream(CSV("` + dir + `/ragged.csv")).toArray()`, "line 3: expected 2 fields, got 1"},
+		{`stream(CSV("` + dir + `/broken.csv")).toArray()`, "failed to parse CSV: line 2"},
+		{`stream(@stdout)`, "cannot stream from stdout"},
+	}
+
+	for _, tt := range tests {
+		result := testEvalHelper(tt.input)
+		errObj, ok := result.(*evaluator.Error)
+		if !ok || !strings.Contains(errObj.Message, tt.expected) {
+			t.Errorf("%s: expected error containing %q, got %s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	policy := &evaluator.SecurityPolicy{RestrictRead: []string{dir}}
+	result := evalWithPolicy(t, `stream(lines("`+dir+`/app.log"))`, policy)
+	if errObj, ok := result.(*evaluator.Error); !ok || !strings.Contains(errObj.Message, "security") {
+		t.Errorf("expected a security error, got %s", result.Inspect())
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+	"github.com/sambeau/parsley/pkg/lexer"
+	"github.com/sambeau/parsley/pkg/parser"
+)
+
+func testEvalStrict(input string, strict bool) evaluator.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := evaluator.NewEnvironment()
+	env.Strict = strict
+	return evaluator.Eval(program, env)
+}
+
+func TestStrictMode(t *testing.T) {
+	tests := []struct {
+		name          string
+		code          string
+		loose         string // result without strict mode
+		strict        string // result in strict mode, if not an error
+		errorContains string // strict mode error
+	}{
+		{"undeclared assignment", `x = 5; x`, "5", "", "assignment to undeclared variable: x"},
+		{"declared assignment", `let x = 1; x = 2; x`, "2", "2", ""},
+		{"assignment in function", `let f = fn() { total = 1 }; f()`, "1", "", "assignment to undeclared variable: total"},
+		{"outer assignment in loop", `let t = 0; for (i in [1, 2, 3]) { t = t + i }; t`, "6", "6", ""},
+		{"undeclared destructuring", `let a = 1; {a, b} = {a: 2, b: 3}; a`, "2", "", "assignment to undeclared variable: b"},
+		{"let destructuring", `let [a, _] = [1, 2]; a`, "1", "1", ""},
+		{"underscore is not a variable", `let a = 0; _ = 1; a`, "0", "0", ""},
+		{"export declares", `export x = 5; x`, "5", "5", ""},
+		{"missing key", `let d = {a: 1}; d.b`, "null", "", "key not found: b"},
+		{"missing index key", `let d = {a: 1}; d["b"]`, "null", "", "key not found: b"},
+		{"present key", `let d = {a: 1}; d.a + d["a"]`, "2", "2", ""},
+		{"nullish default", `let d = {a: 1}; d.b ?? "default"`, "default", "default", ""},
+		{"nullish chain", `let d = {a: {}}; d.a.b.c ?? 3`, "3", "3", ""},
+		{"nullish right side", `let d = {a: 1}; null ?? d.b`, "null", "", "key not found: b"},
+		{"dictionary methods", `let d = {a: 1}; d.has("b")`, "false", "false", ""},
+		{"this", `let d = {a: 1, f: fn() { this.a }}; d.f()`, "1", "1", ""},
+		{"computed properties", `@2024-01-15.year`, "2024", "2024", ""},
+		{"string plus integer", `"n" + 1`, "n1", "", "cannot add STRING and INTEGER in strict mode"},
+		{"float plus string", `1.5 + "x"`, "1.5x", "", "cannot add FLOAT and STRING in strict mode"},
+		{"string plus string", `"a" + "b"`, "ab", "ab", ""},
+		{"explicit conversion", `"n" + toString(1)`, "n1", "n1", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loose := testEvalStrict(tt.code, false)
+			if loose.Inspect() != tt.loose {
+				t.Errorf("without strict mode: expected %q, got %q", tt.loose, loose.Inspect())
+			}
+
+			result := testEvalStrict(tt.code, true)
+			if tt.errorContains != "" {
+				if result.Type() != evaluator.ERROR_OBJ || !strings.Contains(result.Inspect(), tt.errorContains) {
+					t.Errorf("strict: expected error containing %q, got %s", tt.errorContains, result.Inspect())
+				}
+				return
+			}
+			if result.Inspect() != tt.strict {
+				t.Errorf("strict: expected %q, got %q", tt.strict, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestStrictPragma(t *testing.T) {
+	result := testEvalStrict("\"use strict\"\nx = 5", false)
+	if result.Type() != evaluator.ERROR_OBJ || !strings.Contains(result.Inspect(), "assignment to undeclared variable: x") {
+		t.Errorf("expected strict mode error, got %s", result.Inspect())
+	}
+
+	// Only a first statement is a pragma
+	result = testEvalStrict("let y = 1\n\"use strict\"\nx = 5\nx", false)
+	if result.Inspect() != "5" {
+		t.Errorf("expected a later \"use strict\" to be ignored, got %s", result.Inspect())
+	}
+}
+
+func TestStrictModeModules(t *testing.T) {
+	dir, err := os.MkdirTemp("", "parsley_strict_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.WriteFile(filepath.Join(dir, "loose.pars"), []byte("let secret = 1\nexport visible = 2\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "strict.pars"), []byte("\"use strict\"\nlet secret = 1\nexport let visible = 2\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "sloppy.pars"), []byte("count = 1\nexport visible = count\n"), 0644)
+
+	run := func(code string, strict bool) evaluator.Object {
+		evaluator.ClearModuleCache()
+		filename := filepath.Join(dir, "main.pars")
+		p := parser.New(lexer.NewWithFilename(code, filename))
+		program := p.ParseProgram()
+		if len(p.Errors()) > 0 {
+			t.Fatalf("parser errors: %v", p.Errors())
+		}
+		env := evaluator.NewEnvironment()
+		env.Filename = filename
+		env.Security = &evaluator.SecurityPolicy{AllowExecuteAll: true}
+		env.Strict = strict
+		return evaluator.Eval(program, env)
+	}
+	defer evaluator.ClearModuleCache()
+
+	tests := []struct {
+		name          string
+		code          string
+		strict        bool
+		expected      string
+		errorContains string
+	}{
+		{"loose module exports let", `import(@./loose.pars).keys().sort()`, false, "[secret, visible]", ""},
+		{"strict run hides let", `import(@./loose.pars).keys()`, true, "[visible]", ""},
+		{"pragma hides let", `import(@./strict.pars).keys()`, false, "[visible]", ""},
+		{"pragma doesn't reach imports", "\"use strict\"\nimport(@./sloppy.pars).visible", false, "1", ""},
+		{"strict run reaches imports", `import(@./sloppy.pars).visible`, true, "", "assignment to undeclared variable: count"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := run(tt.code, tt.strict)
+			if tt.errorContains != "" {
+				if result.Type() != evaluator.ERROR_OBJ || !strings.Contains(result.Inspect(), tt.errorContains) {
+					t.Errorf("expected error containing %q, got %s", tt.errorContains, result.Inspect())
+				}
+				return
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
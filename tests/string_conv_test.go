@@ -109,35 +109,35 @@ func TestURLString(t *testing.T) {
 }
 
 func TestPathToDict(t *testing.T) {
-	// toDict returns the dictionary itself, which when inspected shows the dict format
+	// toDict returns the path's fields as a dictionary
 	result := evalStringConvInspect(`let p = @./src/main.go
 p.toDict()`)
-	if !strings.Contains(result, "__type") || !strings.Contains(result, "path") {
-		t.Errorf("toDict should return dict with __type: path, got %q", result)
+	if !strings.Contains(result, "absolute: false") || !strings.Contains(result, "components") {
+		t.Errorf("toDict should return the path's fields, got %q", result)
 	}
 }
 
 func TestURLToDict(t *testing.T) {
 	result := evalStringConvInspect(`let u = @https://example.com
 u.toDict()`)
-	if !strings.Contains(result, "__type") || !strings.Contains(result, "url") {
-		t.Errorf("toDict should return dict with __type: url, got %q", result)
+	if !strings.Contains(result, "scheme: https") || !strings.Contains(result, "host: example.com") {
+		t.Errorf("toDict should return the URL's fields, got %q", result)
 	}
 }
 
 func TestDatetimeToDict(t *testing.T) {
 	result := evalStringConvInspect(`let d = @2024-12-25
 d.toDict()`)
-	if !strings.Contains(result, "__type") || !strings.Contains(result, "datetime") {
-		t.Errorf("toDict should return dict with __type: datetime, got %q", result)
+	if !strings.Contains(result, "year: 2024") || !strings.Contains(result, "kind: date") {
+		t.Errorf("toDict should return the datetime's fields, got %q", result)
 	}
 }
 
 func TestDurationToDict(t *testing.T) {
 	result := evalStringConvInspect(`let d = @1d
 d.toDict()`)
-	if !strings.Contains(result, "__type") || !strings.Contains(result, "duration") {
-		t.Errorf("toDict should return dict with __type: duration, got %q", result)
+	if !strings.Contains(result, "seconds: 86400") || !strings.Contains(result, "months: 0") {
+		t.Errorf("toDict should return the duration's fields, got %q", result)
 	}
 }
 
@@ -151,29 +151,29 @@ r.toDict()`)
 
 func TestReprDuration(t *testing.T) {
 	result := evalStringConv("repr(@1d)")
-	if !strings.Contains(result, "__type") || !strings.Contains(result, "duration") {
-		t.Errorf("repr should return dict string with __type: duration, got %q", result)
+	if result != "@1d" {
+		t.Errorf("repr should return the duration literal, got %q", result)
 	}
 }
 
 func TestReprPath(t *testing.T) {
 	result := evalStringConv("repr(@./src/main.go)")
-	if !strings.Contains(result, "__type") || !strings.Contains(result, "path") {
-		t.Errorf("repr should return dict string with __type: path, got %q", result)
+	if result != "@./src/main.go" {
+		t.Errorf("repr should return the path literal, got %q", result)
 	}
 }
 
 func TestReprURL(t *testing.T) {
 	result := evalStringConv("repr(@https://example.com)")
-	if !strings.Contains(result, "__type") || !strings.Contains(result, "url") {
-		t.Errorf("repr should return dict string with __type: url, got %q", result)
+	if result != "@https://example.com" {
+		t.Errorf("repr should return the URL literal, got %q", result)
 	}
 }
 
 func TestReprDatetime(t *testing.T) {
 	result := evalStringConv("repr(@2024-12-25)")
-	if !strings.Contains(result, "__type") || !strings.Contains(result, "datetime") {
-		t.Errorf("repr should return dict string with __type: datetime, got %q", result)
+	if result != "@2024-12-25" {
+		t.Errorf("repr should return the datetime literal, got %q", result)
 	}
 }
 
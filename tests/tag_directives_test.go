@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+func TestTagDirectives(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// if
+		{`let show = true; <p if={show}>Shown</p>`, "<p>Shown</p>"},
+		{`let show = false; <div><p if={show}>Hidden</p><p>Kept</p></div>`, "<div><p>Kept</p></div>"},
+		{`let user = {name: "Ann"}; <b if={user.name} class="name">{user.name}</b>`, "<b class=\"name\">Ann</b>"},
+
+		// for
+		{`let items = ["a", "b"]; <ul><li for={item in items}>{item}</li></ul>`, "<ul><li>a</li><li>b</li></ul>"},
+		{`<ol><li for={i, x in ["a", "b"]} class={"n" + i}>{x}</li></ol>`, "<ol><li class=n0>a</li><li class=n1>b</li></ol>"},
+		{`<p for={n in 1..3}>{n}</p>`, "<p>1</p><p>2</p><p>3</p>"},
+		{`let srcs = ["a.png", "b.png"]; <div><img for={s in srcs} src={s}/></div>`, "<div><img src=a.png /><img src=b.png /></div>"},
+		{`<ul><li for={x in []}>{x}</li></ul>`, "<ul></ul>"},
+
+		// for with if checks the condition for each item
+		{`let items = [{name: "a", visible: true}, {name: "b", visible: false}, {name: "c", visible: true}]
+<ul><li for={item in items} if={item.visible}>{item.name}</li></ul>`, "<ul><li>a</li><li>c</li></ul>"},
+
+		// Components
+		{`let Item = fn(p) { <li>{p.label}</li> }; <ul><Item for={l in ["x", "y"]} label={l}/></ul>`, "<ul><li>x</li><li>y</li></ul>"},
+		{`let Box = fn(p) { <div>{p.contents}</div> }; <Box if={false}>Hidden</Box>`, ""},
+
+		// Other uses of for and if are left alone
+		{`let id = "email"; <label for={id}>Email</label>`, "<label for=email>Email</label>"},
+		{`<label for="email">Email</label>`, "<label for=\"email\">Email</label>"},
+		{`<p data-if={1}>x</p>`, "<p data-if=1>x</p>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Type() == evaluator.ERROR_OBJ {
+				t.Fatalf("Evaluation error: %s", result.Inspect())
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestTagDirectiveErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		errorContains string
+	}{
+		{`<p if={1 +}>x</p>`, "error parsing if={...} on <p>"},
+		{`<p if={a = 1; b}>x</p>`, "if={...} on <p> must be a single expression"},
+		{`<li for={x in missing}>{x}</li>`, "identifier not found: missing"},
+		{`<p if={missing}>x</p>`, "identifier not found: missing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Type() != evaluator.ERROR_OBJ {
+				t.Fatalf("expected error, got %s", result.Inspect())
+			}
+			if !strings.Contains(result.Inspect(), tt.errorContains) {
+				t.Errorf("expected error containing %q, got %q", tt.errorContains, result.Inspect())
+			}
+		})
+	}
+}
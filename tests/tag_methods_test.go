@@ -0,0 +1,114 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+const tagDoc = `let doc = tag("article", {class: "post"}, [
+    tag("h2", {}, "Intro"),
+    tag("p", {}, ["Text ", tag("a", {href: "/docs", class: "button primary"}, "Docs")]),
+    tag("h2", {id: "end"}, "End")
+]);
+`
+
+func TestTagMethods(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// toString(), with attributes in name order
+		{`tag("img", {src: "a.png", alt: "A"}).toString()`, `<img alt="A" src="a.png" />`},
+		{`tag("p", {}, "Hi").toString()`, `<p>Hi</p>`},
+
+		// withAttr()
+		{`tag("a", {}, "x").withAttr("href", "/").toString()`, `<a href="/">x</a>`},
+		{`tag("a", {href: "/"}, "x").withAttr("href", "/new").toString()`, `<a href="/new">x</a>`},
+		{`tag("a", {href: "/"}, "x").withAttr("href", null).toString()`, `<a>x</a>`},
+		{`let a = tag("a", {}, "x"); a.withAttr("id", "y"); a.toString()`, `<a>x</a>`},
+
+		// addClass(), removeClass()
+		{`tag("div").addClass("card").toString()`, `<div class="card" />`},
+		{`tag("div", {class: "card"}).addClass("wide card").toString()`, `<div class="card wide" />`},
+		{`tag("div", {class: "a b c"}).removeClass("b").toString()`, `<div class="a c" />`},
+		{`tag("div", {class: "a"}).removeClass("a x").toString()`, `<div />`},
+
+		// withChildren()
+		{`tag("ul").withChildren([tag("li", {}, "one"), tag("li", {}, "two")]).toString()`, `<ul><li>one</li><li>two</li></ul>`},
+		{`tag("p", {}, "old").withChildren("new").toString()`, `<p>new</p>`},
+		{`tag("p", {}, "old").withChildren(null).toString()`, `<p />`},
+		{`tag("div").withChildren(tag("span", {}, "x")).toString()`, `<div><span>x</span></div>`},
+
+		// query()
+		{tagDoc + `doc.query("h2").length()`, "2"},
+		{tagDoc + `doc.query("h2").map(fn(h) { h.contents })`, "[Intro, End]"},
+		{tagDoc + `doc.query("a").length()`, "1"},
+		{tagDoc + `doc.query(".button").length()`, "1"},
+		{tagDoc + `doc.query("a.button.primary").length()`, "1"},
+		{tagDoc + `doc.query("a.button.secondary").length()`, "0"},
+		{tagDoc + `doc.query("#end")[0].contents`, "End"},
+		{tagDoc + `doc.query("[href]").length()`, "1"},
+		{tagDoc + `doc.query("[href=/docs]").length()`, "1"},
+		{tagDoc + `doc.query("[href='/other']").length()`, "0"},
+		{tagDoc + `doc.query("p a").length()`, "1"},
+		{tagDoc + `doc.query("article a").length()`, "1"},
+		{tagDoc + `doc.query("h2 a").length()`, "0"},
+		{tagDoc + `doc.query("*").length()`, "4"},
+		{tagDoc + `doc.query("article").length()`, "0"},
+
+		// Post-processing children: ids for a table of contents
+		{tagDoc + `let n = 0;
+let withIds = doc.withChildren(doc.contents.map(fn(c) {
+    if (c.name == "h2") { n = n + 1; c.withAttr("id", "section-" + n) } else { c }
+}));
+withIds.query("h2").map(fn(h) { h.attrs.id })`, "[section-1, section-2]"},
+
+		// Tags are still dictionaries
+		{tagDoc + `typeOf(doc)`, "tag"},
+		{tagDoc + `doc.name`, "article"},
+		{tagDoc + `doc.keys().sort()`, "[attrs, contents, name]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Type() == evaluator.ERROR_OBJ {
+				t.Fatalf("Evaluation error: %s", result.Inspect())
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestTagMethodErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		errorContains string
+	}{
+		{`tag("a").withAttr(1, 2)`, "first argument to `withAttr` must be a string"},
+		{`tag("a").addClass(1)`, "argument to `addClass` must be a string"},
+		{`tag("a").withChildren(1)`, "argument to `withChildren` must be a string, array, tag or null"},
+		{`tag("a").withChildren({a: 1})`, "argument to `withChildren` must be a string, array, tag or null"},
+		{`tag("a").query("")`, "invalid selector"},
+		{`tag("a").query("a[href")`, "missing ]"},
+		{`tag("a").query("a.")`, "invalid selector"},
+		{`tag("a").query("a > b")`, "invalid selector"},
+		{`tag("a").frobnicate()`, "unknown method"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Type() != evaluator.ERROR_OBJ {
+				t.Fatalf("expected error, got %s", result.Inspect())
+			}
+			if !strings.Contains(result.Inspect(), tt.errorContains) {
+				t.Errorf("expected error containing %q, got %q", tt.errorContains, result.Inspect())
+			}
+		})
+	}
+}
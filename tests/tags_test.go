@@ -116,10 +116,7 @@ height = 200
 			}
 
 			env := evaluator.NewEnvironment()
-			var result evaluator.Object
-			for _, stmt := range program.Statements {
-				result = evaluator.Eval(stmt, env)
-			}
+			result := evaluator.Eval(program, env)
 
 			if result == nil {
 				t.Fatalf("Eval returned nil")
@@ -191,10 +188,7 @@ dogAge = 7
 			}
 
 			env := evaluator.NewEnvironment()
-			var result evaluator.Object
-			for _, stmt := range program.Statements {
-				result = evaluator.Eval(stmt, env)
-			}
+			result := evaluator.Eval(program, env)
 
 			if result == nil {
 				t.Fatalf("Eval returned nil")
@@ -252,10 +246,7 @@ func TestCustomTagsWithBooleanProps(t *testing.T) {
 			}
 
 			env := evaluator.NewEnvironment()
-			var result evaluator.Object
-			for _, stmt := range program.Statements {
-				result = evaluator.Eval(stmt, env)
-			}
+			result := evaluator.Eval(program, env)
 
 			if result == nil {
 				t.Fatalf("Eval returned nil")
@@ -304,10 +295,7 @@ x`,
 			}
 
 			env := evaluator.NewEnvironment()
-			var result evaluator.Object
-			for _, stmt := range program.Statements {
-				result = evaluator.Eval(stmt, env)
-			}
+			result := evaluator.Eval(program, env)
 
 			if result == nil {
 				t.Fatalf("Eval returned nil")
@@ -353,10 +341,7 @@ func TestTagErrors(t *testing.T) {
 			}
 
 			env := evaluator.NewEnvironment()
-			var result evaluator.Object
-			for _, stmt := range program.Statements {
-				result = evaluator.Eval(stmt, env)
-			}
+			result := evaluator.Eval(program, env)
 
 			if tt.expectError {
 				if result == nil {
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+	"github.com/sambeau/parsley/pkg/lexer"
+	"github.com/sambeau/parsley/pkg/parser"
+)
+
+// loadParsfile evaluates a parsfile in dir and returns its task registry
+func loadParsfile(t *testing.T, dir, source string) *evaluator.TaskRegistry {
+	t.Helper()
+	filename := filepath.Join(dir, "parsfile.pars")
+	l := lexer.NewWithFilename(source, filename)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	env := evaluator.NewEnvironment()
+	env.Filename = filename
+	env.Security = &evaluator.SecurityPolicy{AllowWriteAll: true}
+	env.Tasks = evaluator.NewTaskRegistry()
+	if result := evaluator.Eval(program, env); result != nil && result.Type() == evaluator.ERROR_OBJ {
+		t.Fatalf("evaluation error: %s", result.Inspect())
+	}
+	return env.Tasks
+}
+
+const taskTestParsfile = `
+let record = fn(name) { name ==>> lines(@./ran.log) }
+
+task("build", {description: "Compile", inputs: ["src/*.txt"], outputs: "out/app.txt"}) {
+    record("build")
+    let src <== text(@./src/main.txt)
+    src ==> text(@./out/app.txt)
+}
+
+task("test", {deps: ["build"]}) {
+    record("test")
+}
+
+task("lint") {
+    record("lint")
+}
+
+task("deploy", {deps: ["build", "test", "lint"], description: "Ship it"}) {
+    record("deploy")
+}
+`
+
+func TestTaskRunner(t *testing.T) {
+	dir, err := os.MkdirTemp("", "parsley_tasks_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "src"), 0755)
+	os.MkdirAll(filepath.Join(dir, "out"), 0755)
+	srcFile := filepath.Join(dir, "src", "main.txt")
+	os.WriteFile(srcFile, []byte("v1"), 0644)
+	logFile := filepath.Join(dir, "ran.log")
+
+	ranTasks := func() string {
+		data, _ := os.ReadFile(logFile)
+		os.Remove(logFile)
+		return strings.TrimSpace(strings.ReplaceAll(string(data), "\n", " "))
+	}
+
+	tasks := loadParsfile(t, dir, taskTestParsfile)
+
+	var names []string
+	for _, task := range tasks.Tasks() {
+		names = append(names, task.Name)
+	}
+	if got := strings.Join(names, ","); got != "build,test,lint,deploy" {
+		t.Errorf("expected tasks in definition order, got %s", got)
+	}
+	if deploy, _ := tasks.Get("deploy"); deploy.Description != "Ship it" {
+		t.Errorf("expected description, got %q", deploy.Description)
+	}
+
+	// Dependencies run first, each once
+	var log bytes.Buffer
+	if err := tasks.Run([]string{"deploy"}, evaluator.TaskRunOptions{Log: &log}); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if got := ranTasks(); got != "build test lint deploy" {
+		t.Errorf("expected dependency order, got %q", got)
+	}
+	if !strings.Contains(log.String(), "pars: running build") {
+		t.Errorf("expected progress log, got %q", log.String())
+	}
+
+	// Outputs newer than inputs: build is cached
+	log.Reset()
+	if err := tasks.Run([]string{"build"}, evaluator.TaskRunOptions{Log: &log}); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if got := ranTasks(); got != "" {
+		t.Errorf("expected build to be up to date, ran %q", got)
+	}
+	if !strings.Contains(log.String(), "build is up to date") {
+		t.Errorf("expected up to date message, got %q", log.String())
+	}
+
+	// Force ignores the cache
+	if err := tasks.Run([]string{"build"}, evaluator.TaskRunOptions{Force: true}); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if got := ranTasks(); got != "build" {
+		t.Errorf("expected forced build, got %q", got)
+	}
+
+	// A changed input makes the task run again
+	future := time.Now().Add(time.Hour)
+	os.Chtimes(srcFile, future, future)
+	if err := tasks.Run([]string{"test"}, evaluator.TaskRunOptions{}); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if got := ranTasks(); got != "build test" {
+		t.Errorf("expected rebuild after input change, got %q", got)
+	}
+}
+
+func TestTaskRunnerErrors(t *testing.T) {
+	dir, err := os.MkdirTemp("", "parsley_tasks_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tasks := loadParsfile(t, dir, `
+task("a", {deps: ["b"]}) { 1 }
+task("b", {deps: ["c"]}) { 1 }
+task("c", {deps: ["a"]}) { 1 }
+task("d", {deps: ["missing"]}) { 1 }
+task("fails") { 1 + "x" ; undefinedThing }
+`)
+
+	tests := []struct {
+		target        string
+		errorContains string
+	}{
+		{"a", "task dependency cycle: a -> b -> c -> a"},
+		{"d", `task "missing" (needed by "d") is not defined`},
+		{"nope", `task "nope" is not defined`},
+		{"fails", `task "fails" failed`},
+	}
+	for _, tt := range tests {
+		err := tasks.Run([]string{tt.target}, evaluator.TaskRunOptions{})
+		if err == nil || !strings.Contains(err.Error(), tt.errorContains) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.target, tt.errorContains, err)
+		}
+	}
+}
+
+func TestTaskDefinitionErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		errorContains string
+	}{
+		{"outside a parsfile", `task("a") { 1 }`, "can only be used in a parsfile"},
+		{"missing block", `task("a", {deps: []})`, "last argument to `task` must be a function or block"},
+		{"bad deps", `task("a", {deps: [1]}) { 1 }`, "`deps` must contain strings or paths"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := lexer.New(tt.input)
+			p := parser.New(l)
+			program := p.ParseProgram()
+			env := evaluator.NewEnvironment()
+			if tt.name != "outside a parsfile" {
+				env.Tasks = evaluator.NewTaskRegistry()
+			}
+			result := evaluator.Eval(program, env)
+			if result == nil || result.Type() != evaluator.ERROR_OBJ {
+				t.Fatalf("expected error, got %v", result)
+			}
+			if !strings.Contains(result.Inspect(), tt.errorContains) {
+				t.Errorf("expected error containing %q, got %q", tt.errorContains, result.Inspect())
+			}
+		})
+	}
+
+	// Duplicate names are rejected
+	env := evaluator.NewEnvironment()
+	env.Tasks = evaluator.NewTaskRegistry()
+	l := lexer.New(`task("a") { 1 }; task("a") { 2 }`)
+	result := evaluator.Eval(parser.New(l).ParseProgram(), env)
+	if result == nil || !strings.Contains(result.Inspect(), `task "a" is already defined`) {
+		t.Errorf("expected duplicate task error, got %v", result)
+	}
+}
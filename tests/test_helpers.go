@@ -1,6 +1,8 @@
 package main
 
 import (
+	"testing"
+
 	"github.com/sambeau/parsley/pkg/evaluator"
 	"github.com/sambeau/parsley/pkg/lexer"
 	"github.com/sambeau/parsley/pkg/parser"
@@ -15,3 +17,15 @@ func testEvalHelper(input string) evaluator.Object {
 	env := evaluator.NewEnvironment()
 	return evaluator.Eval(program, env)
 }
+
+// testEvalChecked is testEvalHelper for inputs that must parse: it fails the
+// test on parse errors instead of evaluating what was parsed
+func testEvalChecked(t *testing.T, input string) evaluator.Object {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("Parse errors: %v", p.Errors())
+	}
+	return evaluator.Eval(program, evaluator.NewEnvironment())
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+func TestTiming(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"timeIt returns the result", `timeIt(fn() { 6 * 7 }).result`, "42"},
+		{"timeIt measures", `let t = timeIt(fn() { sleep(@60ms) }); [t.result, t.duration >= @60ms]`, "[null, true]"},
+		{"timeIt block", `let t = timeIt() { "done" }; t.result`, "done"},
+		{"sleep returns null", `sleep(@1ms)`, "null"},
+		{"stopwatch laps", `let sw = stopwatch(); sleep(@30ms); let a = sw.lap(); sleep(@10ms); let b = sw.lap(); [a >= @30ms, b >= @10ms, b < a, sw.laps().length()]`, "[true, true, true, 2]"},
+		{"stopwatch elapsed", `let sw = stopwatch(); sleep(@20ms); sw.elapsed() >= @20ms`, "true"},
+		{"stopped stopwatch", `let sw = stopwatch(); let s = sw.stop(); sleep(@10ms); sw.elapsed() == s`, "true"},
+		{"reset", `let sw = stopwatch(); sw.lap(); sw.reset(); sw.laps()`, "[]"},
+		{"typeOf", `typeOf(stopwatch())`, "stopwatch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestSleepWaits(t *testing.T) {
+	start := time.Now()
+	testEvalHelper(`sleep(@150ms)`)
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("expected sleep to wait 150ms, waited %s", elapsed)
+	}
+}
+
+func TestTimingErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`sleep(5)`, "must be a duration"},
+		{`sleep(@1mo)`, "without months or years"},
+		{`sleep(@-1s)`, "positive duration"},
+		{`sleep()`, "wrong number of arguments"},
+		{`timeIt(1)`, "must be a block or function"},
+		{`timeIt(fn(x) { x })`, "must take no parameters"},
+		{`timeIt(fn() { 1 / 0 })`, "division by zero"},
+		{`stopwatch(1)`, "wrong number of arguments"},
+		{`stopwatch().pause()`, "unknown method 'pause' for stopwatch"},
+	}
+
+	for _, tt := range tests {
+		result := testEvalHelper(tt.input)
+		errObj, ok := result.(*evaluator.Error)
+		if !ok || !strings.Contains(errObj.Message, tt.expected) {
+			t.Errorf("%s: expected error containing %q, got %s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+func TestToText(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// An email body: headings, wrapped paragraphs, links as references,
+		// nested and numbered lists, and line breaks
+		{`toText("<h1>Welcome</h1><p>Hello <b>Ann</b>, thanks for signing up. Read the <a href=\"https://example.com/guide\">guide</a> or <a href=\"https://example.com\">https://example.com</a>.</p><ul><li>One</li><li>Two<ul><li>Nested</li></ul></li></ul><ol start=\"3\"><li>Three</li><li>Four</li></ol><p>Bye<br>Team</p>", {width: 40})`,
+			strings.Join([]string{
+				"Welcome",
+				"=======",
+				"",
+				"Hello Ann, thanks for signing up. Read",
+				"the guide [1] or https://example.com.",
+				"",
+				"- One",
+				"- Two",
+				"  - Nested",
+				"",
+				"3. Three",
+				"4. Four",
+				"",
+				"Bye",
+				"Team",
+				"",
+				"[1] https://example.com/guide",
+			}, "\n")},
+
+		// Wrapped lines keep the list and quote indents
+		{`toText("<ul><li>Item text that is long enough to wrap onto a second line.</li></ul>", {width: 30})`,
+			"- Item text that is long\n  enough to wrap onto a second\n  line."},
+		{`toText("<blockquote>A long quoted paragraph that needs wrapping inside the quote marks.</blockquote>", {width: 30})`,
+			"> A long quoted paragraph that\n> needs wrapping inside the\n> quote marks."},
+
+		// Width 0 doesn't wrap
+		{`len(toText("<p>" + "word ".repeat(30) + "</p>", {width: 0}).lines())`, "1"},
+
+		// Repeated links share a reference; anchors and links showing their address don't get one
+		{`toText("<p><a href=\"/a\">A</a> <a href=\"/a\">again</a> <a href=\"#top\">top</a> <a href=\"mailto:me@example.com\">me@example.com</a></p>")`,
+			"A [1] again [1] top me@example.com\n\n[1] /a"},
+
+		// Headings, rules, preformatted text and hidden elements
+		{`toText("<h2>Section</h2><h3>Sub</h3><hr><pre>  x = 1\n  y = 2\n</pre><script>alert(1)</script><style>p {}</style>", {width: 20})`,
+			"Section\n-------\n\nSub\n\n--------------------\n\n      x = 1\n      y = 2"},
+
+		// Tables, definition lists and images
+		{`toText("<table><tr><th>Name</th><th>Qty</th></tr><tr><td>Tea</td><td>2</td></tr></table>")`, "Name | Qty\nTea | 2"},
+		{`toText("<dl><dt>Term</dt><dd>Meaning</dd></dl>")`, "Term\n    Meaning"},
+		{`toText("<p><img src=\"a.png\" alt=\"Logo\"> Acme</p>")`, "[Logo] Acme"},
+
+		// Entities are decoded; whitespace is collapsed
+		{`toText("<p>Fish  &amp;\n  chips</p>")`, "Fish & chips"},
+
+		// Tags and arrays of tags
+		{`toText(tag("p", {}, "From a tag"))`, "From a tag"},
+		{`toText([tag("p", {}, "One"), "<p>Two</p>"])`, "One\n\nTwo"},
+		{`toText("")`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Type() == evaluator.ERROR_OBJ {
+				t.Fatalf("Evaluation error: %s", result.Inspect())
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestToTextErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		errorContains string
+	}{
+		{`toText()`, "wrong number of arguments to `toText`"},
+		{`toText(1)`, "first argument to `toText` must be HTML"},
+		{`toText("<p>x</p>", 72)`, "second argument to `toText` must be a dictionary"},
+		{`toText("<p>x</p>", {width: -1})`, "`width` option for `toText` must be a non-negative integer"},
+		{`toText("<p>x</p>", {wrap: 72})`, "unknown option \"wrap\" for `toText`"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Type() != evaluator.ERROR_OBJ {
+				t.Fatalf("expected error, got %s", result.Inspect())
+			}
+			if !strings.Contains(result.Inspect(), tt.errorContains) {
+				t.Errorf("expected error containing %q, got %q", tt.errorContains, result.Inspect())
+			}
+		})
+	}
+}
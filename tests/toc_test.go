@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+const tocDoc = `let doc = "<h1>Guide</h1><h2>Getting Started</h2><p>Hi</p><h3>Install &amp; Run</h3><h2 id=\"faq\">FAQ</h2><h3>Why?</h3><h4>Deep</h4><h2>Getting Started</h2>";
+`
+
+func TestTOC(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// Ids are added to h2 and h3 by default, keeping the rest of the HTML
+		{`toc(doc).html`, `<h1>Guide</h1><h2 id="getting-started">Getting Started</h2><p>Hi</p><h3 id="install-run">Install &amp; Run</h3><h2 id="faq">FAQ</h2><h3 id="why">Why?</h3><h4>Deep</h4><h2 id="getting-started-2">Getting Started</h2>`},
+
+		// Headings nest by level
+		{`toc(doc).items.map(fn(i) { i.id })`, "[getting-started, faq, getting-started-2]"},
+		{`toc(doc).items[0].children[0].text`, "Install & Run"},
+		{`toc(doc).items[0].children[0].level`, "3"},
+		{`toc(doc).items[1].children.map(fn(i) { i.text })`, "[Why?]"},
+		{`len(toc(doc).items[2].children)`, "0"},
+
+		// Levels
+		{`toc(doc, {min: 1, max: 1}).items.map(fn(i) { i.id })`, "[guide]"},
+		{`toc(doc, {min: 1}).items[0].children.map(fn(i) { i.id })`, "[getting-started, faq, getting-started-2]"},
+		{`toc(doc, {max: 4}).items[1].children[0].children[0].id`, "deep"},
+
+		// A level skipped in the document nests under the nearest heading
+		{`toc("<h2>A</h2><h4>B</h4>", {max: 4}).items[0].children[0].id`, "b"},
+		{`toc("<h3>A</h3><h2>B</h2>").items.map(fn(i) { i.id })`, "[a, b]"},
+
+		// Generated ids don't clash with ids elsewhere in the document
+		{`toc("<div id=\"intro\"></div><h2>Intro</h2>").html`, `<div id="intro"></div><h2 id="intro-2">Intro</h2>`},
+		{`toc("<h2>Intro</h2><h2 id=\"intro\">Later</h2>").items.map(fn(i) { i.id })`, "[intro-2, intro]"},
+
+		// Text inside nested tags, and headings with no usable text
+		{`toc("<h2 class=\"x\"><em>Fast</em>  paths</h2>").html`, `<h2 class="x" id="fast-paths"><em>Fast</em>  paths</h2>`},
+		{`toc("<h2>Café Menü</h2>").items[0].id`, "café-menü"},
+		{`toc("<h2>!!!</h2><h2></h2>").items.map(fn(i) { i.id })`, "[section, section-2]"},
+
+		// Tags and arrays of tags
+		{`toc(tag("h2", {}, "From Tag")).html`, `<h2 id="from-tag">From Tag</h2>`},
+		{`toc([tag("h2", {}, "One"), "<h2>Two</h2>"]).items.map(fn(i) { i.id })`, "[one, two]"},
+
+		// Unclosed headings are left alone
+		{`toc("<h2>Open").html`, "<h2>Open"},
+		{`len(toc("<p>No headings</p>").items)`, "0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalHelper(tocDoc + tt.input)
+			if result.Type() == evaluator.ERROR_OBJ {
+				t.Fatalf("Evaluation error: %s", result.Inspect())
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestTOCErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		errorContains string
+	}{
+		{`toc()`, "wrong number of arguments to `toc`"},
+		{`toc(1)`, "first argument to `toc` must be HTML"},
+		{`toc("<h2>A</h2>", "x")`, "second argument to `toc` must be a dictionary"},
+		{`toc("<h2>A</h2>", {depth: 2})`, "unknown option \"depth\" for `toc`"},
+		{`toc("<h2>A</h2>", {min: 0})`, "`min` option for `toc` must be a heading level from 1 to 6"},
+		{`toc("<h2>A</h2>", {min: 4, max: 2})`, "`min` option for `toc` must not be greater than `max`"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Type() != evaluator.ERROR_OBJ {
+				t.Fatalf("expected error, got %s", result.Inspect())
+			}
+			if !strings.Contains(result.Inspect(), tt.errorContains) {
+				t.Errorf("expected error containing %q, got %q", tt.errorContains, result.Inspect())
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+const testConfigTOML = `# Build settings
+title = "Example"
+"quoted key" = 'C:\temp'
+site."example.com" = true
+
+[package]
+name = "parsley"
+released = 2024-03-01
+updated = 2024-03-01T09:30:00+02:00
+at = 07:45:00
+
+[package.limits]
+ports = [ 8000, 8001,
+  8002, ]  # trailing comma
+ratio = 0.75
+hex = 0xff
+big = 1_000
+point = { x = 1, y = -2 }
+
+[[bin]]
+name = "pars"
+notes = """
+one \
+  line"""
+
+[[bin]]
+name = "pls"
+`
+
+func TestTOMLParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"strings", `parseTOML("a = \"x\\ty\"\nb = 'c:\\\\d'").b`, `c:\\d`},
+		{"escapes", `parseTOML("a = \"x\\u00e9\"").a`, "xé"},
+		{"numbers", `let d = parseTOML("a = 0o17\nb = 0b101\nc = -3e2\nd = +inf"); [d.a, d.b, d.c, d.d]`, "[15, 5, -300, +Inf]"},
+		{"dotted keys", `let b = parseTOML("a.b.c = 1\na.b.d = 2").a.b; [b.c, b.d]`, "[1, 2]"},
+		{"inline table", `parseTOML("p = { x = 1, y.z = [true, false] }").p.y.z`, "[true, false]"},
+		{"nested arrays", `parseTOML("a = [[1, 2], [\"x\"]]").a`, "[[1, 2], [x]]"},
+		{"implicit tables", `let a = parseTOML("[a.b]\nc = 1\n[a]\nd = 2").a; [a.b.c, a.d]`, "[1, 2]"},
+		{"date", `let d = parseTOML("d = 1979-05-27").d; [d.year, d.month, d.day, d.kind]`, "[1979, 5, 27, date]"},
+		{"offset datetime", `let d = parseTOML("d = 1979-05-27T00:32:00-07:00").d; [d.day, d.hour, d.minute]`, "[27, 7, 32]"},
+		{"space separated datetime", `parseTOML("d = 1979-05-27 07:32:00").d.hour`, "7"},
+		{"local time", `let d = parseTOML("d = 07:32:15").d; [d.hour, d.second]`, "[7, 15]"},
+		{"empty", `parseTOML("# nothing\n")`, "{}"},
+		{"stringify", `stringifyTOML({name: "x", tags: ["a", "b"], db: {port: 5432, opts: {tls: true}}})`, "name = \"x\"\ntags = [\"a\", \"b\"]\n\n[db]\nport = 5432\n\n[db.opts]\ntls = true\n"},
+		{"stringify drops nulls", `stringifyTOML({a: null, b: 1})`, "b = 1\n"},
+		{"stringify quotes keys", `stringifyTOML(parseTOML("'a b' = 1.0"))`, "\"a b\" = 1.0\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestTOMLRead(t *testing.T) {
+	dir := filepath.ToSlash(t.TempDir())
+	os.WriteFile(filepath.Join(dir, "config.toml"), []byte(testConfigTOML), 0644)
+	read := `let c <== TOML("` + dir + `/config.toml"); `
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"top-level keys", read + `[c.title, c["quoted key"], c.site["example.com"]]`, `[Example, C:\temp, true]`},
+		{"table", read + `c.package.name`, "parsley"},
+		{"date", read + `c.package.released.day`, "1"},
+		{"datetime in UTC", read + `c.package.updated.hour`, "7"},
+		{"time", read + `c.package.at.minute`, "45"},
+		{"multi-line array", read + `c.package.limits.ports`, "[8000, 8001, 8002]"},
+		{"numbers", read + `[c.package.limits.ratio, c.package.limits.hex, c.package.limits.big]`, "[0.75, 255, 1000]"},
+		{"inline table", read + `c.package.limits.point.y`, "-2"},
+		{"array of tables", read + `c.bin.map(fn(b) { b.name })`, "[pars, pls]"},
+		{"multi-line string", read + `c.bin[0].notes`, "one line"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestTOMLWrite(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.ToSlash(filepath.Join(dir, "out.toml"))
+
+	result := testEvalWriteOp(`{title: "Site", build: {drafts: false, when: @2024-03-01}, menu: [{name: "Home", url: "/"}, {name: "Blog", weight: 2}], extra: {}} ==> TOML("` + target + `")`)
+	if result != nil && result.Type() == "ERROR" {
+		t.Fatalf("Evaluation error: %s", result.Inspect())
+	}
+	expected := `title = "Site"
+
+[build]
+drafts = false
+when = 2024-03-01
+
+[extra]
+
+[[menu]]
+name = "Home"
+url = "/"
+
+[[menu]]
+name = "Blog"
+weight = 2
+`
+	content, _ := os.ReadFile(target)
+	if string(content) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, content)
+	}
+
+	os.WriteFile(filepath.Join(dir, "config.toml"), []byte(testConfigTOML), 0644)
+	source := filepath.ToSlash(filepath.Join(dir, "config.toml"))
+	result = testEvalWriteOp(`let c <== TOML("` + source + `"); c ==> TOML("` + target + `"); let d <== TOML("` + target + `"); stringifyTOML(d) == stringifyTOML(c)`)
+	if result.Inspect() != "true" {
+		t.Errorf("expected a written document to read back the same, got %s", result.Inspect())
+	}
+}
+
+func TestTOMLFetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/toml")
+		w.Write([]byte(testConfigTOML))
+	}))
+	defer server.Close()
+
+	result := testEvalHelper(`let c <=/= TOML(url("` + server.URL + `")); c.bin[1].name`)
+	if result.Inspect() != "pls" {
+		t.Errorf("expected pls, got %s", result.Inspect())
+	}
+}
+
+func TestTOMLErrors(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.ToSlash(filepath.Join(dir, "out.toml"))
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`TOML()`, "wrong number of arguments"},
+		{`parseTOML(1)`, "expects string argument"},
+		{`parseTOML("a = 1\na = 2")`, "line 2: key a is defined more than once"},
+		{`parseTOML("[a]\n[a]")`, "table a is defined more than once"},
+		{`parseTOML("a.b = 1\n[a]")`, "table a is defined more than once"},
+		{`parseTOML("p = {x = 1}\n[p]")`, "defined more than once"},
+		{`parseTOML("a = [1]\n[[a]]")`, "isn't an array of tables"},
+		{`parseTOML("a = ")`, "expected a value"},
+		{`parseTOML("a = 01")`, "invalid value 01"},
+		{`parseTOML("a = \"open")`, "unterminated string"},
+		{`parseTOML("a = 1 b = 2")`, "after value"},
+		{`parseTOML("p = {x = 1,}")`, "in key"},
+		{`parseTOML("a = \"\\q\"")`, "invalid escape"},
+		{`stringifyTOML([1])`, "requires a dictionary"},
+		{`stringifyTOML({a: [1, null]})`, "a: TOML has no null value"},
+		{`[1, 2] ==> TOML("` + target + `")`, "requires a dictionary"},
+	}
+
+	for _, tt := range tests {
+		result := testEvalWriteOp(tt.input)
+		errObj, ok := result.(*evaluator.Error)
+		if !ok || !strings.Contains(errObj.Message, tt.expected) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.input, tt.expected, result)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+func TestTypedValueObjects(t *testing.T) {
+	if _, ok := testEvalChecked(t, "@2024-12-25").(*evaluator.Datetime); !ok {
+		t.Error("expected a *evaluator.Datetime")
+	}
+	if dur, ok := testEvalChecked(t, "@1h30m").(*evaluator.Duration); !ok || dur.Seconds() != 5400 {
+		t.Errorf("expected a 5400 second *evaluator.Duration, got %#v", dur)
+	}
+	if _, ok := testEvalChecked(t, "@./src/main.go").(*evaluator.Path); !ok {
+		t.Error("expected a *evaluator.Path")
+	}
+	if _, ok := testEvalChecked(t, "@https://example.com").(*evaluator.Url); !ok {
+		t.Error("expected a *evaluator.Url")
+	}
+}
+
+func TestTypedValueFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"dot field", "@2024-12-25.year", "2024"},
+		{"index field", `@1d["seconds"]`, "86400"},
+		{"type compat", "let p = @./a.txt; p.__type", "path"},
+		{"typeOf", "typeOf(@https://example.com)", "url"},
+		{"isA dict", `isA(@1h, "dict")`, "true"},
+		{"in", `"host" in @https://example.com`, "true"},
+		{"not in", `"nope" in @1h`, "false"},
+		{"keys", "@1h.keys().sort()", "[months, seconds, totalSeconds]"},
+		{"destructure", "let {year, month as m} = @2024-12-25; [year, m]", "[2024, 12]"},
+		{"for", "let dur = @1m; for (k, v in dur) { if (k == \"seconds\") v }", "[60]"},
+		{"toDict", "let u = @https://example.com:8080; let d = u.toDict(); [d.host, d.port, typeOf(d)]", "[example.com, 8080, dict]"},
+		{"repr", "repr(@1y2mo3d)", "@1y2mo3d"},
+		{"repr zero", "repr(@1h - @1h)", "@0s"},
+		{"toDebug", "toDebug({at: @2024-01-15, src: @./data.json})", "{at: @2024-01-15, src: @./data.json}"},
+		{"print", "@1h30m", "1 hour 30 minutes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalChecked(t, tt.input)
+			if result.Inspect() != tt.expected {
+				t.Errorf("%s: expected %s, got %s", tt.input, tt.expected, result.Inspect())
+			}
+		})
+	}
+}
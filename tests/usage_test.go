@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+	"github.com/sambeau/parsley/pkg/lexer"
+	"github.com/sambeau/parsley/pkg/parser"
+)
+
+func TestUsageCounts(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "in.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	input := `let s <== text(@./in.txt)
+s + ", world" ==> text(@./out.txt)
+let db = SQLITE(":memory:")
+let _ = db <=!=> "CREATE TABLE t (a INTEGER)"
+let _ = db <=!=> "INSERT INTO t (a) VALUES (1)"
+let rows = db <=??=> "SELECT a FROM t"
+"done"`
+
+	l := lexer.New(input)
+	program := parser.New(l).ParseProgram()
+	env := evaluator.NewEnvironment()
+	env.Filename = filepath.Join(dir, "main.pars")
+	env.Security = &evaluator.SecurityPolicy{AllowWriteAll: true}
+
+	evaluator.ResetUsage()
+	if result := evaluator.Eval(program, env); result.Inspect() != "done" {
+		t.Fatalf("unexpected result: %s", result.Inspect())
+	}
+
+	u := evaluator.CurrentUsage()
+	if u.FilesRead != 1 || u.BytesRead != 5 {
+		t.Errorf("expected 1 file read (5 bytes), got %d (%d bytes)", u.FilesRead, u.BytesRead)
+	}
+	if u.FilesWritten != 1 || u.BytesWritten != 12 {
+		t.Errorf("expected 1 file written (12 bytes), got %d (%d bytes)", u.FilesWritten, u.BytesWritten)
+	}
+	if u.SQLQueries != 3 {
+		t.Errorf("expected 3 SQL queries, got %d", u.SQLQueries)
+	}
+	if u.HTTPRequests != 0 || u.Commands != 0 {
+		t.Errorf("expected no requests or commands, got %d and %d", u.HTTPRequests, u.Commands)
+	}
+
+	evaluator.ResetUsage()
+	if u := evaluator.CurrentUsage(); u != (evaluator.Usage{}) {
+		t.Errorf("expected counts to be reset, got %+v", u)
+	}
+}
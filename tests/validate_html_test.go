@@ -0,0 +1,99 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+	"github.com/sambeau/parsley/pkg/formatter"
+)
+
+func TestValidateHTMLProblems(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		// Well-formed
+		{`<div class="a"><p>Hi <b>there</b></p><br><img src="x.png" /></div>`, nil},
+		{"<!DOCTYPE html><html><head><title>T</title></head><body></body></html>", nil},
+		{`<script>if (a < b) { document.write("<div>") }</script>`, nil},
+		{"plain text", nil},
+
+		// Optional end tags
+		{"<ul><li>One<li>Two</ul>", nil},
+		{"<table><tr><td>A<td>B<tr><td>C</table>", nil},
+		{"<dl><dt>Term<dd>Definition</dl>", nil},
+		{"<p>One<p>Two", []string{"line 1: <p> inside <p> (browsers close the <p> first)"}},
+
+		// Unclosed and stray tags
+		{"<div><span>Hi</div>", []string{"line 1: <span> is not closed before </div> on line 1"}},
+		{"<section>\n<div>\n</section>", []string{"line 2: <div> is not closed before </section> on line 3"}},
+		{"<main>\n<article>", []string{"line 1: <main> is never closed", "line 2: <article> is never closed"}},
+		{"<div></div></div>", []string{"line 1: unexpected </div> with no open <div>"}},
+		{"<b><i>x</b></i>", []string{
+			"line 1: <i> is not closed before </b> on line 1",
+			"line 1: unexpected </i> with no open <i>",
+		}},
+
+		// Duplicate ids
+		{"<h2 id=\"intro\">A</h2>\n<p id=\"intro\">B</p>", []string{`line 2: duplicate id "intro" (first used on line 1)`}},
+		{`<input id="x" /><input id="x" />`, []string{`line 1: duplicate id "x" (first used on line 1)`}},
+
+		// Invalid nesting
+		{"<p><div>Hi</div></p>", []string{"line 1: <div> inside <p> (browsers close the <p> first)"}},
+		{"<p><ul><li>x</li></ul></p>", []string{"line 1: <ul> inside <p> (browsers close the <p> first)"}},
+		{`<a href="/"><span><a href="/x">x</a></span></a>`, []string{"line 1: <a> inside <a> (interactive elements can't be nested)"}},
+		{"<button><a>x</a></button>", []string{"line 1: <a> inside <button> (interactive elements can't be nested)"}},
+		{"<form><div><form></form></div></form>", []string{"line 1: <form> inside <form>"}},
+		{"<li>x</li>", []string{"line 1: <li> outside of <ul>, <ol> or <menu>"}},
+		{"<div><li>x</li></div>", []string{"line 1: <li> inside <div>, not <ul>, <ol> or <menu>"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			var got []string
+			for _, p := range formatter.ValidateHTML(tt.input) {
+				got = append(got, p.String())
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestValidateHTMLBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`validateHTML("<p>Fine</p>")`, "[]"},
+		{`validateHTML(<div><p>Hi</p></div>)`, "[]"},
+		{`len(validateHTML("<p><div></div></p><i id=a></i><i id=a></i>"))`, "2"},
+		{`validateHTML("<p>\n<div></div></p>")[0].line`, "2"},
+		{`validateHTML("<em>")[0].message`, "<em> is never closed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Type() == evaluator.ERROR_OBJ {
+				t.Fatalf("Evaluation error: %s", result.Inspect())
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+
+	for input, errorContains := range map[string]string{
+		`validateHTML()`:  "wrong number of arguments to `validateHTML`",
+		`validateHTML(1)`: "argument to `validateHTML` must be a string",
+	} {
+		result := testEvalHelper(input)
+		if result.Type() != evaluator.ERROR_OBJ || !strings.Contains(result.Inspect(), errorContains) {
+			t.Errorf("%s: expected error containing %q, got %s", input, errorContains, result.Inspect())
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+// makeWalkTree creates a small directory tree and returns its root in
+// forward-slash form
+func makeWalkTree(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, name := range []string{"top.txt", "a/one.md", "a/b/two.json", "a/b/c/three.txt", "vendor/lib/x.txt"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("x"), 0644)
+	}
+	return filepath.ToSlash(root)
+}
+
+func TestWalk(t *testing.T) {
+	root := makeWalkTree(t)
+	names := `.map(fn(f) { f.name }).join(",")`
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"iterator", `walk("` + root + `").toArray()` + names, "a,b,c,three.txt,two.json,one.md,top.txt,vendor,lib,x.txt"},
+		{"for", `for (f in walk(dir("` + root + `"))) { if (f.isFile) { f.name } }.join(",")`, "three.txt,two.json,one.md,top.txt,x.txt"},
+		{"max depth", `walk("` + root + `", {maxDepth: 2}).toArray()` + names, "a,b,one.md,top.txt,vendor,lib"},
+		{"take", `walk("` + root + `").take(2).toArray()` + names, "a,b"},
+		{"callback", `walk("` + root + `", fn(e) { if (e.isDir) { e.name } }).join(",")`, "a,b,c,vendor,lib"},
+		{"depth", `walk("` + root + `", {maxDepth: 2}, fn(e, d) { e.name + d }).join(",")`, "a1,b2,one.md2,top.txt1,vendor1,lib2"},
+		{"skip", `walk("` + root + `", fn(e) { if (e.name == "vendor" || e.name == "b") { "skip" } else { e.name } }).join(",")`, "a,one.md,top.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestWalkSymlinks(t *testing.T) {
+	root := makeWalkTree(t)
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(outside, "linked.txt"), []byte("x"), 0644)
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Skipf("can't create symlinks: %v", err)
+	}
+	os.Symlink(root, filepath.Join(root, "a", "loop"))
+
+	files := `, fn(f) { if (f.isFile) { f.name } }).join(",")`
+	result := testEvalHelper(`walk("` + root + `"` + files)
+	if result.Inspect() != "three.txt,two.json,one.md,top.txt,x.txt" {
+		t.Errorf("expected symlinked directories not to be entered, got %s", result.Inspect())
+	}
+	result = testEvalHelper(`walk("` + root + `", {followSymlinks: true}` + files)
+	if result.Inspect() != "three.txt,two.json,one.md,linked.txt,top.txt,x.txt" {
+		t.Errorf("expected the link to be followed but not the loop, got %s", result.Inspect())
+	}
+}
+
+func TestWalkErrors(t *testing.T) {
+	root := makeWalkTree(t)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`walk()`, "wrong number of arguments"},
+		{`walk(5)`, "must be a path or directory"},
+		{`walk("` + root + `/top.txt")`, "must be a directory"},
+		{`walk("` + root + `/missing")`, "failed to read directory"},
+		{`walk("` + root + `", {maxDepth: 0})`, "must be a positive integer"},
+		{`walk("` + root + `", {followSymlinks: "yes"})`, "must be a boolean"},
+		{`walk("` + root + `", fn(a, b, c) { a })`, "must take 1 or 2 parameters"},
+		{`walk("` + root + `", fn(e) { e }, {maxDepth: 1})`, "must come before the function"},
+		{`walk("` + root + `", fn(e) { e.name / 0 })`, "type mismatch"},
+	}
+
+	for _, tt := range tests {
+		result := testEvalHelper(tt.input)
+		errObj, ok := result.(*evaluator.Error)
+		if !ok || !strings.Contains(errObj.Message, tt.expected) {
+			t.Errorf("%s: expected error containing %q, got %s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	policy := &evaluator.SecurityPolicy{RestrictRead: []string{root + "/vendor"}}
+	result := evalWithPolicy(t, `walk("`+root+`").toArray().map(fn(f) { f.name }).join(",")`, policy)
+	if result.Inspect() != "a,b,c,three.txt,two.json,one.md,top.txt" {
+		t.Errorf("expected the restricted directory to be left out, got %s", result.Inspect())
+	}
+}
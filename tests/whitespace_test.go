@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+func TestWhitespaceTrimMarkers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// {- trims before, -} trims after
+		{`<p>Hello   {- "World"}</p>`, "<p>HelloWorld</p>"},
+		{`<p>{"a" -}   b</p>`, "<p>ab</p>"},
+		{`let n = 3; <p>You have {n} item{- if (n != 1) {"s"} -} .</p>`, "<p>You have 3 items.</p>"},
+		{`<p>a  {- -}  b</p>`, "<p>ab</p>"},
+
+		// Line breaks and indentation are trimmed too
+		{"let name = \"Ann\"\n<p><b>Hi</b>\n    {- name -}\n    <i>!</i></p>", "<p><b>Hi</b>Ann<i>!</i></p>"},
+		{"let items = [1, 2]\n<span>Items:\n    {- for (i in items) { <b>{i}</b> } -}\n</span>", "<span>Items:<b>1</b><b>2</b></span>"},
+
+		// Only the whitespace next to the marker is trimmed
+		{`<p>a {- "b"} c</p>`, "<p>ab c</p>"},
+		{`<p><i>a</i>  {- "b"}</p>`, "<p><i>a</i>b</p>"},
+
+		// Without the space the dash is part of the expression
+		{`let x = 2; <p>{-x}</p>`, "<p>-2</p>"},
+		{`let x = 3; <p>{x - 1}</p>`, "<p>2</p>"},
+		{`let x = 3; <p>{x -1}</p>`, "<p>2</p>"},
+
+		// Whitespace on a line is kept as written
+		{`<p><b>a</b> <i>b</i></p>`, "<p><b>a</b> <i>b</i></p>"},
+		{`let a = 1; let b = 2; <p>{a} {b}</p>`, "<p>1 2</p>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Type() == evaluator.ERROR_OBJ {
+				t.Fatalf("Evaluation error: %s", result.Inspect())
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
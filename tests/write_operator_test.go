@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/sambeau/parsley/pkg/evaluator"
 	"github.com/sambeau/parsley/pkg/lexer"
@@ -390,3 +391,327 @@ func TestWriteReadRoundtrip(t *testing.T) {
 		})
 	}
 }
+
+// TestTypedValuesRoundtrip tests that typed values are written as strings and revived on read
+func TestTypedValuesRoundtrip(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "parsley_typed_roundtrip_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	jsonPath := filepath.Join(tmpDir, "typed.json")
+	yamlPath := filepath.Join(tmpDir, "typed.yaml")
+	record := `let rec = {due: @2024-05-01, at: @2024-05-01T09:30:00, every: @1d12h, src: @./data/in.csv, home: @https://example.com/x, note: "Plan"}; `
+
+	// The written JSON must not contain internal fields
+	result := testEvalWriteOp(record + `rec ==> JSON("` + jsonPath + `")`)
+	if result != nil && result.Type() == "ERROR" {
+		t.Fatalf("Evaluation error: %s", result.Inspect())
+	}
+	content, err := os.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	for _, want := range []string{`"due": "2024-05-01"`, `"at": "2024-05-01T09:30:00Z"`, `"every": "P1DT12H"`, `"src": "./data/in.csv"`, `"home": "https://example.com/x"`} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("expected JSON to contain %s, got:\n%s", want, content)
+		}
+	}
+	if strings.Contains(string(content), "unix") || strings.Contains(string(content), "months") {
+		t.Errorf("JSON leaks internal fields:\n%s", content)
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		expected string
+	}{
+		{
+			name:     "without revive dates stay strings",
+			code:     `let data <== JSON("` + jsonPath + `"); data.due`,
+			expected: "2024-05-01",
+		},
+		{
+			name:     "revived date",
+			code:     `let data <== JSON("` + jsonPath + `", {revive: true}); data.due.month`,
+			expected: "5",
+		},
+		{
+			name:     "revived datetime",
+			code:     `let data <== JSON("` + jsonPath + `", {revive: true}); data.at.hour`,
+			expected: "9",
+		},
+		{
+			name:     "revived duration supports arithmetic",
+			code:     `let data <== JSON("` + jsonPath + `", {revive: true}); (data.due + data.every).day`,
+			expected: "2",
+		},
+		{
+			name:     "other strings are unchanged",
+			code:     `let data <== JSON("` + jsonPath + `", {revive: true}); data.note`,
+			expected: "Plan",
+		},
+		{
+			name:     "YAML roundtrip with revive",
+			code:     record + `rec ==> YAML("` + yamlPath + `"); let data <== YAML("` + yamlPath + `", {revive: true}); data.every.seconds`,
+			expected: "129600",
+		},
+		{
+			name:     "JSON roundtrip keeps the instant of an offset datetime",
+			code:     `let d = @2024-12-25T14:30:00-05:00; {d: d} ==> JSON("` + jsonPath + `"); let data <== JSON("` + jsonPath + `", {revive: true}); [d.unix, data.d.unix]`,
+			expected: "[1735155000, 1735155000]",
+		},
+		{
+			name:     "YAML roundtrip keeps the instant of an offset datetime",
+			code:     `let d = @2024-12-25T14:30:00-05:00; {d: d} ==> YAML("` + yamlPath + `"); let data <== YAML("` + yamlPath + `", {revive: true}); [d.unix, data.d.unix]`,
+			expected: "[1735155000, 1735155000]",
+		},
+		{
+			name:     "parseJSON revive",
+			code:     `let r = parseJSON("[\"2024-02-29\", \"-PT5M\", \"Pizza\"]", {revive: true}); [r[0].day, r[1].seconds, r[2]]`,
+			expected: "[29, -300, Pizza]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalWriteOp(tt.code)
+			if result == nil {
+				t.Fatal("Expected result, got nil")
+			}
+			if result.Type() == "ERROR" {
+				t.Fatalf("Evaluation error: %s", result.Inspect())
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+// TestWriteOptions tests the append, atomic and mode options of file handles
+func TestWriteOptions(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "parsley_write_options_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tests := []struct {
+		name     string
+		code     string
+		file     string
+		expected string
+		mode     os.FileMode
+	}{
+		{
+			name:     "append option",
+			code:     `"a" ==> text("` + filepath.Join(tmpDir, "log.txt") + `", {append: true}); "b" ==> text("` + filepath.Join(tmpDir, "log.txt") + `", {append: true})`,
+			file:     "log.txt",
+			expected: "ab",
+		},
+		{
+			name:     "append option with lines",
+			code:     `let log = lines("` + filepath.Join(tmpDir, "log.lines") + `", {append: true}); "one" ==> log; "two" ==> log`,
+			file:     "log.lines",
+			expected: "one\ntwo\n",
+		},
+		{
+			name:     "atomic write",
+			code:     `"<html></html>" ==> text("` + filepath.Join(tmpDir, "index.html") + `", {atomic: true})`,
+			file:     "index.html",
+			expected: "<html></html>",
+		},
+		{
+			name:     "atomic write replaces existing file",
+			code:     `"old" ==> text("` + filepath.Join(tmpDir, "page.html") + `"); {v: 2} ==> JSON("` + filepath.Join(tmpDir, "page.html") + `", {atomic: true})`,
+			file:     "page.html",
+			expected: "{\n  \"v\": 2\n}",
+		},
+		{
+			name:     "octal mode",
+			code:     `"secret" ==> text("` + filepath.Join(tmpDir, "key.txt") + `", {mode: 0600})`,
+			file:     "key.txt",
+			expected: "secret",
+			mode:     0600,
+		},
+		{
+			name:     "string mode with atomic write",
+			code:     `"run" ==> text("` + filepath.Join(tmpDir, "run.sh") + `", {atomic: true, mode: "0755"})`,
+			file:     "run.sh",
+			expected: "run",
+			mode:     0755,
+		},
+		{
+			name:     "mode applies to existing files",
+			code:     `"x" ==> text("` + filepath.Join(tmpDir, "key.txt") + `", {mode: 0640})`,
+			file:     "key.txt",
+			expected: "x",
+			mode:     0640,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalWriteOp(tt.code)
+			if result != nil && result.Type() == "ERROR" {
+				t.Fatalf("Evaluation error: %s", result.Inspect())
+			}
+
+			filePath := filepath.Join(tmpDir, tt.file)
+			content, err := os.ReadFile(filePath)
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+			if string(content) != tt.expected {
+				t.Errorf("Expected file content %q, got %q", tt.expected, string(content))
+			}
+			if tt.mode != 0 {
+				info, err := os.Stat(filePath)
+				if err != nil {
+					t.Fatalf("Failed to stat file: %v", err)
+				}
+				if info.Mode().Perm() != tt.mode {
+					t.Errorf("Expected mode %o, got %o", tt.mode, info.Mode().Perm())
+				}
+			}
+		})
+	}
+
+	// Atomic writes must not leave temporary files behind
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to read dir: %v", err)
+	}
+	for _, e := range entries {
+		if strings.Contains(e.Name(), ".tmp-") {
+			t.Errorf("temporary file left behind: %s", e.Name())
+		}
+	}
+}
+
+// TestWriteOnlyIfChanged tests that onlyIfChanged leaves files with the same
+// content untouched
+func TestWriteOnlyIfChanged(t *testing.T) {
+	tmpDir := t.TempDir()
+	target := filepath.Join(tmpDir, "page.html")
+	lines := filepath.Join(tmpDir, "rows.txt")
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	tests := []struct {
+		name     string
+		code     string
+		file     string
+		expected string
+		touched  bool
+	}{
+		{"same text", `"<p>hi</p>" ==> text("` + target + `", {onlyIfChanged: true})`, target, "<p>hi</p>", false},
+		{"same text atomic", `"<p>hi</p>" ==> text("` + target + `", {onlyIfChanged: true, atomic: true})`, target, "<p>hi</p>", false},
+		{"changed text", `"<p>bye</p>" ==> text("` + target + `", {onlyIfChanged: true})`, target, "<p>bye</p>", true},
+		{"same length", `"<p>hey</p>" ==> text("` + target + `", {onlyIfChanged: true})`, target, "<p>hey</p>", true},
+		{"without the option", `"<p>hey</p>" ==> text("` + target + `")`, target, "<p>hey</p>", true},
+		{"same iterator", `iter(fn(y) { y("a"); y("b") }) ==> lines("` + lines + `", {onlyIfChanged: true})`, lines, "a\nb", false},
+	}
+
+	os.WriteFile(target, []byte("<p>hi</p>"), 0644)
+	os.WriteFile(lines, []byte("a\nb"), 0644)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Chtimes(tt.file, past, past)
+			result := testEvalWriteOp(tt.code)
+			if result != nil && result.Type() == "ERROR" {
+				t.Fatalf("Evaluation error: %s", result.Inspect())
+			}
+
+			content, _ := os.ReadFile(tt.file)
+			if string(content) != tt.expected {
+				t.Errorf("Expected file content %q, got %q", tt.expected, string(content))
+			}
+			info, err := os.Stat(tt.file)
+			if err != nil {
+				t.Fatalf("Failed to stat file: %v", err)
+			}
+			if touched := !info.ModTime().Equal(past); touched != tt.touched {
+				t.Errorf("Expected the file to be rewritten: %v, was: %v", tt.touched, touched)
+			}
+		})
+	}
+}
+
+// TestWriteOptionErrors tests invalid write options and the security policy
+func TestWriteOptionErrors(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "parsley_write_options_err_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	target := filepath.Join(tmpDir, "out.txt")
+
+	tests := []struct {
+		name          string
+		code          string
+		errorContains string
+	}{
+		{
+			name:          "atomic with append option",
+			code:          `"x" ==> text("` + target + `", {atomic: true, append: true})`,
+			errorContains: "cannot be used with append",
+		},
+		{
+			name:          "atomic with append operator",
+			code:          `"x" ==>> text("` + target + `", {atomic: true})`,
+			errorContains: "cannot be used with append",
+		},
+		{
+			name:          "onlyIfChanged with append",
+			code:          `"x" ==>> text("` + target + `", {onlyIfChanged: true})`,
+			errorContains: "onlyIfChanged cannot be used with append",
+		},
+		{
+			name:          "non-boolean onlyIfChanged",
+			code:          `"x" ==> text("` + target + `", {onlyIfChanged: 1})`,
+			errorContains: "`onlyIfChanged` option must be a boolean",
+		},
+		{
+			name:          "non-boolean append",
+			code:          `"x" ==> text("` + target + `", {append: "yes"})`,
+			errorContains: "`append` option must be a boolean",
+		},
+		{
+			name:          "invalid mode string",
+			code:          `"x" ==> text("` + target + `", {mode: "rw"})`,
+			errorContains: "octal permission string",
+		},
+		{
+			name:          "mode out of range",
+			code:          `"x" ==> text("` + target + `", {mode: 01777})`,
+			errorContains: "between 0000 and 0777",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalWriteOp(tt.code)
+			if result == nil || result.Type() != "ERROR" {
+				t.Fatalf("Expected error, got %v", result)
+			}
+			if !strings.Contains(result.Inspect(), tt.errorContains) {
+				t.Errorf("Expected error containing %q, got %q", tt.errorContains, result.Inspect())
+			}
+		})
+	}
+
+	// Atomic writes still honor the write policy
+	l := lexer.New(`"x" ==> text("` + target + `", {atomic: true})`)
+	p := parser.New(l)
+	env := evaluator.NewEnvironment()
+	env.Security = &evaluator.SecurityPolicy{}
+	result := evaluator.Eval(p.ParseProgram(), env)
+	if result == nil || result.Type() != "ERROR" || !strings.Contains(result.Inspect(), "security") {
+		t.Errorf("Expected security error, got %v", result)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("Expected no file to be written")
+	}
+}
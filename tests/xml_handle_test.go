@@ -0,0 +1,196 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sambeau/parsley/pkg/evaluator"
+)
+
+const testFeedXML = `<?xml version="1.0" encoding="UTF-8"?>
+<!-- a comment -->
+<feed xmlns="http://www.w3.org/2005/Atom" lang="en">
+  <title>News &amp; views</title>
+  <entry id="1">First</entry>
+  <entry id="2"><title>Second</title></entry>
+  <empty/>
+  <note><![CDATA[<b>raw</b>]]></note>
+</feed>
+`
+
+func TestXMLRead(t *testing.T) {
+	dir := filepath.ToSlash(t.TempDir())
+	os.WriteFile(filepath.Join(dir, "feed.xml"), []byte(testFeedXML), 0644)
+	read := `let doc <== XML("` + dir + `/feed.xml"`
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"text element", read + `); doc.feed.title`, "News & views"},
+		{"root attributes", read + `); doc.feed.attrs.lang`, "en"},
+		{"namespace declarations", read + `); doc.feed.attrs.xmlns`, "http://www.w3.org/2005/Atom"},
+		{"repeated elements", read + `); doc.feed.entry.length()`, "2"},
+		{"attributes and text", read + `); [doc.feed.entry[0].attrs.id, doc.feed.entry[0].text]`, "[1, First]"},
+		{"children", read + `); doc.feed.entry[1].title`, "Second"},
+		{"empty element", read + `); doc.feed.empty`, ""},
+		{"cdata", read + `); doc.feed.note`, "<b>raw</b>"},
+		{"arrays option", read + `, {arrays: ["title"]}); [doc.feed.title, doc.feed.entry[1].title]`, "[[News & views], [Second]]"},
+		{"key options", read + `, {attrsKey: "meta", textKey: "body"}); [doc.feed.entry[0].meta.id, doc.feed.entry[0].body]`, "[1, First]"},
+		{"error capture", `let {data, error} <== XML("` + dir + `/missing.xml"); error != null`, "true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalHelper(tt.input)
+			if result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+func TestXMLWrite(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.ToSlash(filepath.Join(dir, "out.xml"))
+
+	tests := []struct {
+		name     string
+		code     string
+		expected string
+	}{
+		{
+			"document",
+			`{catalog: {attrs: {version: 2}, book: [{attrs: {id: "b1"}, title: "Go & XML", price: 9.5}, {title: "Parsley", tags: null}]}} ==> XML("` + target + `")`,
+			`<?xml version="1.0" encoding="UTF-8"?>
+<catalog version="2">
+  <book id="b1">
+    <price>9.5</price>
+    <title>Go &amp; XML</title>
+  </book>
+  <book>
+    <tags/>
+    <title>Parsley</title>
+  </book>
+</catalog>
+`,
+		},
+		{
+			"root and indent options",
+			`{n: [1, 2], attrs: {count: 2}} ==> XML("` + target + `", {root: "nums", indent: 0})`,
+			`<?xml version="1.0" encoding="UTF-8"?>
+<nums count="2"><n>1</n><n>2</n></nums>
+`,
+		},
+		{
+			"text with children",
+			`{p: {text: "Hello", b: "world"}} ==> XML("` + target + `", {indent: 4})`,
+			`<?xml version="1.0" encoding="UTF-8"?>
+<p>
+    Hello
+    <b>world</b>
+</p>
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalWriteOp(tt.code)
+			if result != nil && result.Type() == "ERROR" {
+				t.Fatalf("Evaluation error: %s", result.Inspect())
+			}
+			content, _ := os.ReadFile(target)
+			if string(content) != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, content)
+			}
+		})
+	}
+
+	result := testEvalWriteOp(`{a: {attrs: {id: "x"}, b: ["1", "2"]}} ==> XML("` + target + `"); let doc <== XML("` + target + `"); [doc.a.attrs.id, doc.a.b]`)
+	if result.Inspect() != "[x, [1, 2]]" {
+		t.Errorf("expected a written document to read back the same, got %s", result.Inspect())
+	}
+}
+
+func TestXMLNamespaces(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.ToSlash(filepath.Join(dir, "rss.xml"))
+	target := filepath.ToSlash(filepath.Join(dir, "out.xml"))
+	document := `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom">
+  <channel>
+    <atom:link href="https://example.com/feed.xml" rel="self"/>
+    <link>https://example.com</link>
+    <title>News</title>
+  </channel>
+</rss>
+`
+	os.WriteFile(source, []byte(document), 0644)
+
+	result := testEvalHelper(`let doc <== XML("` + source + `"); [doc.rss.channel.link, doc.rss.channel["atom:link"].attrs.rel, doc.rss.attrs["xmlns:atom"]]`)
+	if result.Inspect() != "[https://example.com, self, http://www.w3.org/2005/Atom]" {
+		t.Errorf("expected prefixed names and namespace declarations, got %s", result.Inspect())
+	}
+
+	result = testEvalWriteOp(`let doc <== XML("` + source + `"); doc ==> XML("` + target + `")`)
+	if result != nil && result.Type() == "ERROR" {
+		t.Fatalf("Evaluation error: %s", result.Inspect())
+	}
+	content, _ := os.ReadFile(target)
+	if string(content) != document {
+		t.Errorf("expected the document to round trip, got:\n%s", content)
+	}
+}
+
+func TestXMLFetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(testFeedXML))
+	}))
+	defer server.Close()
+
+	result := testEvalHelper(`let doc <=/= XML(url("` + server.URL + `")); doc.feed.entry[1].title`)
+	if result.Inspect() != "Second" {
+		t.Errorf("expected Second, got %s", result.Inspect())
+	}
+}
+
+func TestXMLErrors(t *testing.T) {
+	dir := t.TempDir()
+	broken := filepath.ToSlash(filepath.Join(dir, "broken.xml"))
+	os.WriteFile(broken, []byte("<a><b></a>"), 0644)
+	unclosed := filepath.ToSlash(filepath.Join(dir, "unclosed.xml"))
+	os.WriteFile(unclosed, []byte("<a><b>"), 0644)
+	target := filepath.ToSlash(filepath.Join(dir, "out.xml"))
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`XML()`, "wrong number of arguments"},
+		{`XML(5)`, "must be a path, URL, or string"},
+		{`let d <== XML("` + broken + `"); d`, "failed to parse XML"},
+		{`let d <== XML("` + unclosed + `"); d`, "<b> is not closed"},
+		{`let d <== XML("` + broken + `", {arrays: "b"}); d`, "`arrays` must be an array"},
+		{`{a: 1, b: 2} ==> XML("` + target + `")`, "dictionary with one key"},
+		{`{a: [1, 2]} ==> XML("` + target + `")`, "cannot be an array"},
+		{`{a: {attrs: [1]}} ==> XML("` + target + `")`, "attrs of a must be a dictionary"},
+		{`{a: {attrs: {id: {x: 1}}}} ==> XML("` + target + `")`, "attribute id must be text"},
+		{`{a: 1} ==> XML("` + target + `", {root: "1x"})`, "must be an element name"},
+		{`{a: 1} ==> XML("` + target + `", {indent: 10})`, "between 0 and 9"},
+	}
+
+	for _, tt := range tests {
+		result := testEvalWriteOp(tt.input)
+		errObj, ok := result.(*evaluator.Error)
+		if !ok || !strings.Contains(errObj.Message, tt.expected) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.input, tt.expected, result)
+		}
+	}
+}
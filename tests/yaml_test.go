@@ -377,3 +377,147 @@ func TestYAMLEmptyFile(t *testing.T) {
 		t.Errorf("Expected %q, got %q", expected, result.Inspect())
 	}
 }
+
+// TestYAMLStreamsAndAnchors tests multi-document streams, anchors and merge keys
+func TestYAMLStreamsAndAnchors(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "parsley-yaml-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	files := map[string]string{
+		"stream.yaml": "---\nkind: Service\nname: web\n---\nkind: Deployment\nname: web\n",
+		"ci.yaml": `defaults: &defaults
+  image: golang:1.22
+  timeout: 10
+test:
+  <<: *defaults
+  timeout: 30
+lint:
+  <<: *defaults
+steps: &steps [build, test]
+release:
+  steps: *steps
+`,
+		"keys.yaml": "1: one\ntrue: yes\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write YAML file: %v", err)
+		}
+	}
+	testFilePath := filepath.Join(tmpDir, "test.pars")
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "multi-document stream returns an array",
+			input:    `let docs <== YAML(@./stream.yaml); [docs.length(), docs[0].kind, docs[1].kind]`,
+			expected: "[2, Service, Deployment]",
+		},
+		{
+			name:     "merge key copies anchored mapping",
+			input:    `let ci <== YAML(@./ci.yaml); ci.lint.image`,
+			expected: "golang:1.22",
+		},
+		{
+			name:     "merge key values can be overridden",
+			input:    `let ci <== YAML(@./ci.yaml); [ci.test.timeout, ci.lint.timeout]`,
+			expected: "[30, 10]",
+		},
+		{
+			name:     "alias resolves to anchored value",
+			input:    `let ci <== YAML(@./ci.yaml); ci.release.steps`,
+			expected: "[build, test]",
+		},
+		{
+			name:     "non-string keys",
+			input:    `let d <== YAML(@./keys.yaml); d["1"]`,
+			expected: "one",
+		},
+		{
+			name:     "parseYAML stream",
+			input:    `parseYAML("a: 1\n---\na: 2").map(fn(d) { d.a })`,
+			expected: "[1, 2]",
+		},
+		{
+			name:     "parseYAML single document",
+			input:    `parseYAML("name: web").name`,
+			expected: "web",
+		},
+		{
+			name:     "parseYAML revive",
+			input:    `parseYAML("timeout: PT1M", {revive: true}).timeout.seconds`,
+			expected: "60",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalYAMLWithFilename(tt.input, testFilePath)
+			if result.Inspect() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}
+
+// TestStringifyYAML tests stringifyYAML and YAML write indentation
+func TestStringifyYAML(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "parsley-yaml-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	testFilePath := filepath.Join(tmpDir, "test.pars")
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "default indent",
+			input:    `stringifyYAML({server: {port: 8080}})`,
+			expected: "server:\n    port: 8080\n",
+		},
+		{
+			name:     "custom indent",
+			input:    `stringifyYAML({server: {port: 8080, hosts: ["a"]}}, {indent: 2})`,
+			expected: "server:\n  hosts:\n    - a\n  port: 8080\n",
+		},
+		{
+			name:     "typed values as strings",
+			input:    `stringifyYAML({day: @2024-03-15})`,
+			expected: "day: \"2024-03-15\"\n",
+		},
+		{
+			name:     "round trip",
+			input:    `parseYAML(stringifyYAML({name: "web", ports: [80, 443]})).ports[1]`,
+			expected: "443",
+		},
+		{
+			name:     "file write with indent",
+			input:    `{a: {b: 1}} ==> YAML(@./out.yaml, {indent: 2}); let s <== text(@./out.yaml); s`,
+			expected: "a:\n  b: 1\n",
+		},
+		{
+			name:     "invalid indent",
+			input:    `stringifyYAML({a: 1}, {indent: 20})`,
+			expected: "`indent` option for YAML must be an integer between 2 and 9",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := testEvalYAMLWithFilename(tt.input, testFilePath)
+			if !strings.Contains(result.Inspect(), tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, result.Inspect())
+			}
+		})
+	}
+}